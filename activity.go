@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	statsTrendDays   = 7  // /stats 按天列出最近几天的消息数
+	statsChartDays   = 14 // /stats chart 图表覆盖的天数
+	statsTopUsers    = 5  // /stats 列出的最活跃用户数
+	statsTopUserDays = 7  // 最活跃用户的统计天数
+)
+
+// startOfDay 返回 t 当天零点（本地时间）
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// growthStatsText 统计今天、本周（从周一开始）和本月新增和活跃的用户数，读取失败时返回空字符串
+func (b *BotInstance) growthStatsText() string {
+	ctx := context.Background()
+	today := startOfDay(time.Now())
+	periods := []struct {
+		name  string
+		since time.Time
+	}{
+		{"今天", today},
+		{"本周", today.AddDate(0, 0, -(int(today.Weekday())+6)%7)},
+		{"本月", today.AddDate(0, 0, 1-today.Day())},
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n增长与活跃：")
+	for _, period := range periods {
+		newUsers, err := b.redisClient.CountNewUsers(ctx, period.since)
+		if err == nil {
+			var active int64
+			active, err = b.redisClient.CountActiveUsers(ctx, period.since)
+			sb.WriteString(fmt.Sprintf("\n- %s：新增 %d 位，活跃 %d 位", period.name, newUsers, active))
+		}
+		if err != nil {
+			log.Printf("获取增长统计失败: %v", err)
+			return ""
+		}
+	}
+	return sb.String()
+}
+
+// dailyStatsRange 读取截至今天的 days 天每日统计，按日期从早到晚排列
+func (b *BotInstance) dailyStatsRange(ctx context.Context, days int) ([]time.Time, []map[string]int64, error) {
+	today := time.Now()
+	dates := make([]time.Time, days)
+	stats := make([]map[string]int64, days)
+	for i := 0; i < days; i++ {
+		day := today.AddDate(0, 0, i-days+1)
+		s, err := b.redisClient.GetDailyStats(ctx, day)
+		if err != nil {
+			return nil, nil, err
+		}
+		dates[i], stats[i] = day, s
+	}
+	return dates, stats, nil
+}
+
+// trendStatsText 按天列出最近的消息数和平均首次响应时间，并列出最活跃的用户，读取失败时返回空字符串
+func (b *BotInstance) trendStatsText() string {
+	ctx := context.Background()
+	dates, stats, err := b.dailyStatsRange(ctx, statsTrendDays)
+	if err != nil {
+		log.Printf("获取每日统计失败: %v", err)
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n\n最近 %d 天消息（收到 / 回复）：", statsTrendDays))
+	totals := make(map[string]int64)
+	for i, day := range dates {
+		sb.WriteString(fmt.Sprintf("\n- %s %s：%d / %d", day.Format("01-02"), weekdayNames[day.Weekday()],
+			stats[i][cache.DailyMessagesReceived], stats[i][cache.DailyMessagesAnswered]))
+		for field, n := range stats[i] {
+			totals[field] += n
+		}
+	}
+	if avg, ok := averageResponse(totals); ok {
+		sb.WriteString(fmt.Sprintf("\n平均首次响应：%s（%d 次）", formatWait(avg), totals[cache.DailyResponses]))
+	}
+
+	top, err := b.redisClient.GetTopActiveUsers(ctx, time.Now(), statsTopUserDays, statsTopUsers)
+	if err != nil {
+		log.Printf("获取最活跃用户失败: %v", err)
+		return sb.String()
+	}
+	if len(top) > 0 {
+		sb.WriteString(fmt.Sprintf("\n\n最近 %d 天最活跃的用户：", statsTopUserDays))
+		for i, user := range top {
+			sb.WriteString(fmt.Sprintf("\n%d. %s：%d 条", i+1, b.userLabel(user.UserID), user.Messages))
+		}
+	}
+	return sb.String()
+}
+
+// handleInactive 处理 /inactive <天数> [purge]：统计超过指定天数未发消息的用户，带 purge 时将其移出用户集合。
+// 被移出的用户不再收到广播，资料保留，再次发消息时会自动重新加入。
+func (b *BotInstance) handleInactive(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	days := 0
+	if len(args) > 0 {
+		days, _ = strconv.Atoi(args[0])
+	}
+	purge := len(args) == 2 && args[1] == "purge"
+	if days <= 0 || len(args) > 2 || (len(args) == 2 && !purge) {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/inactive <天数> [purge]\n例如 /inactive 90 查看 90 天未发消息的用户数，/inactive 90 purge 将这些用户移出用户列表（不再收到广播，再次发消息时自动恢复）"))
+		return
+	}
+
+	ctx := context.Background()
+	userIDs, err := b.redisClient.GetInactiveUserIDs(ctx, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("获取不活跃用户失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取不活跃用户失败。"))
+		return
+	}
+	if !purge {
+		text := fmt.Sprintf("超过 %d 天未发消息的用户共 %d 位（没有活跃记录的早期用户不计入）。", days, len(userIDs))
+		if len(userIDs) > 0 {
+			text += fmt.Sprintf("\n发送 /inactive %d purge 可将他们移出用户列表。", days)
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		return
+	}
+
+	removed, err := b.redisClient.RemoveInactiveUsers(ctx, userIDs)
+	if err != nil {
+		log.Printf("移除不活跃用户失败（已移除 %d 位）: %v", removed, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 移除不活跃用户失败，已移除 %d 位。", removed)))
+		return
+	}
+	log.Printf("管理员 %d 移除了 %d 位超过 %d 天未活跃的用户", msg.From.ID, removed, days)
+	b.audit(msg.From.ID, cache.AuditPurge, fmt.Sprintf("移除了 %d 位超过 %d 天未发消息的用户", removed, days))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已将 %d 位超过 %d 天未发消息的用户移出用户列表。", removed, days)))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// roleOf 返回管理员的角色：ADMIN_IDS 中的管理员为超级管理员，通过 /addadmin 添加且未指定角色的为客服
+func (b *BotInstance) roleOf(userID int64) string {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	if b.superAdminIDs[userID] || b.adminRoles[userID] == cache.RoleSuperAdmin {
+		return cache.RoleSuperAdmin
+	}
+	return cache.RoleOperator
+}
+
+// isConfiguredSuperAdmin 报告用户是否为 ADMIN_IDS 中配置的超级管理员
+func (b *BotInstance) isConfiguredSuperAdmin(userID int64) bool {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	return b.superAdminIDs[userID]
+}
+
+// isSuperAdmin 报告用户是否为超级管理员，只有超级管理员可以增删管理员
+func (b *BotInstance) isSuperAdmin(userID int64) bool {
+	return b.roleOf(userID) == cache.RoleSuperAdmin
+}
+
+// roleAllows 报告管理员是否具有 role 要求的角色，只有超级管理员命令需要检查
+func (b *BotInstance) roleAllows(userID int64, role string) bool {
+	return role != cache.RoleSuperAdmin || b.isSuperAdmin(userID)
+}
+
+// commandAllowed 报告管理员是否有权限使用该命令，未注册的命令视为允许
+func (b *BotInstance) commandAllowed(userID int64, name string) bool {
+	cmd, ok := b.adminCommands.lookup(name)
+	return !ok || b.roleAllows(userID, cmd.Role)
+}
+
+// superAdminCallbacks 是只有超级管理员可以点击的回调前缀，对应只有超级管理员可以使用的命令所发出的按钮
+var superAdminCallbacks = []string{
+	settingsCallbackPrefix, // /settings
+	auditPageCallback,      // /auditlog
+	"bbuild_",              // /broadcast
+	"bbtn_",                // /broadcast 按钮编辑器
+	"bstop_",               // 广播进度中的停止按钮
+	"bcopy_",               // /broadcastcopy
+	"blib_",                // /broadcast 消息库
+	"btpl_",                // /broadcasttemplates
+	"brec_",                // /recurring
+	"sched_cancel_",        // /scheduled
+	"ar_del_",              // /setautoreply
+	"welcome_",             // /setwelcome 预览
+	"wmedit_",              // /welcomemenu
+}
+
+// callbackAllowed 报告管理员是否有权限点击该回调按钮，未列出的回调视为允许
+func (b *BotInstance) callbackAllowed(userID int64, data string) bool {
+	for _, prefix := range superAdminCallbacks {
+		if strings.HasPrefix(data, prefix) {
+			return b.roleAllows(userID, cache.RoleSuperAdmin)
+		}
+	}
+	return true
+}
+
+// roleName 返回角色的中文名称
+func roleName(role string) string {
+	if role == cache.RoleSuperAdmin {
+		return "超级管理员"
+	}
+	return "客服"
+}
+
+// adminIDList 返回当前所有管理员 ID 的副本
+func (b *BotInstance) adminIDList() []int64 {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	ids := make([]int64, 0, len(b.adminIDs))
+	for id := range b.adminIDs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// parseAdminCommandID 解析 /addadmin、/deladmin 的用户 ID 参数，返回 ID 及其余参数
+func (b *BotInstance) parseAdminCommandID(msg *tgbotapi.Message, usage string) (int64, []string, bool) {
+	args := strings.Fields(msg.CommandArguments())
+	var userID int64
+	var err error
+	if len(args) > 0 {
+		userID, err = strconv.ParseInt(args[0], 10, 64)
+	}
+	if len(args) == 0 || err != nil || userID == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法："+usage))
+		return 0, nil, false
+	}
+	return userID, args[1:], true
+}
+
+// handleAddAdmin 添加管理员（或修改已有管理员的角色）并保存到 Redis，立即生效
+func (b *BotInstance) handleAddAdmin(msg *tgbotapi.Message) {
+	userID, rest, ok := b.parseAdminCommandID(msg, "/addadmin <用户ID> [operator|superadmin]\n不指定角色时为客服（operator），只能回复用户，不能广播、修改设置或管理管理员。")
+	if !ok {
+		return
+	}
+	role := cache.RoleOperator
+	if len(rest) > 0 {
+		role = strings.ToLower(rest[0])
+		if role != cache.RoleOperator && role != cache.RoleSuperAdmin {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 无效的角色，只能是 operator 或 superadmin。"))
+			return
+		}
+	}
+	if b.isConfiguredSuperAdmin(userID) {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "该用户是 ADMIN_IDS 中配置的超级管理员，无需添加。"))
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := b.redisClient.AddAdmin(ctx, userID); err != nil {
+		log.Printf("添加管理员 %d 失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 添加管理员失败。"))
+		return
+	}
+	if err := b.redisClient.SetAdminRole(ctx, userID, role); err != nil {
+		log.Printf("设置管理员 %d 角色失败: %v", userID, err)
+	}
+	b.adminMu.Lock()
+	b.adminIDs[userID] = true
+	b.adminRoles[userID] = role
+	b.adminMu.Unlock()
+	b.setCommandsForUser(userID)
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已添加管理员 %d，角色：%s。", userID, roleName(role))))
+	log.Printf("管理员 %d 添加了管理员 %d，角色 %s", msg.From.ID, userID, role)
+	b.audit(msg.From.ID, cache.AuditAdmin, fmt.Sprintf("添加管理员 %d，角色 %s", userID, role))
+}
+
+// handleDelAdmin 移除通过 /addadmin 添加的管理员，ADMIN_IDS 中的超级管理员只能通过修改配置移除
+func (b *BotInstance) handleDelAdmin(msg *tgbotapi.Message) {
+	userID, _, ok := b.parseAdminCommandID(msg, "/deladmin <用户ID>")
+	if !ok {
+		return
+	}
+	if b.isConfiguredSuperAdmin(userID) {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 该用户是 ADMIN_IDS 中配置的超级管理员，只能通过修改配置移除。"))
+		return
+	}
+	ctx := context.Background()
+	removed, err := b.redisClient.RemoveAdmin(ctx, userID)
+	if err != nil {
+		log.Printf("移除管理员 %d 失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 移除管理员失败。"))
+		return
+	}
+	if !removed {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("用户 %d 不是管理员。", userID)))
+		return
+	}
+	if err := b.redisClient.DeleteAdminRole(ctx, userID); err != nil {
+		log.Printf("删除管理员 %d 角色失败: %v", userID, err)
+	}
+	b.adminMu.Lock()
+	delete(b.adminIDs, userID)
+	delete(b.adminRoles, userID)
+	b.adminMu.Unlock()
+	b.setCommandsForUser(userID)
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已移除管理员 %d。", userID)))
+	log.Printf("管理员 %d 移除了管理员 %d", msg.From.ID, userID)
+	b.audit(msg.From.ID, cache.AuditAdmin, fmt.Sprintf("移除管理员 %d", userID))
+}
+
+// handleListAdmins 列出当前所有管理员
+func (b *BotInstance) handleListAdmins(chatID int64) {
+	ctx := context.Background()
+	var sb strings.Builder
+	sb.WriteString("当前管理员：\n")
+	for _, id := range b.adminIDList() {
+		firstName, lastName, username, _ := b.redisClient.GetUserInfo(ctx, id)
+		name := strings.TrimSpace(firstName + " " + lastName)
+		if username != "" {
+			name = strings.TrimSpace(name + " @" + username)
+		}
+		if name == "" {
+			name = "Unknown"
+		}
+		sb.WriteString(fmt.Sprintf("- %s - ID: %d（%s）\n", name, id, roleName(b.roleOf(id))))
+	}
+	b.API.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
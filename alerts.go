@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultAlertInterval = 10 * time.Minute // 同类告警的最小间隔
+	apiFailureThreshold  = 5                // Telegram API 连续失败多少次发送告警
+)
+
+// alertConfig 是告警的配置
+type alertConfig struct {
+	ChatID   int64         // 接收告警的运维会话，为 0 时私信超级管理员
+	Interval time.Duration // 同类告警的最小间隔，期间的重复告警只计数
+}
+
+// loadAlertConfig 读取 OPS_CHAT_ID 和 ALERT_INTERVAL_MINUTES
+func loadAlertConfig() (alertConfig, error) {
+	cfg := alertConfig{Interval: defaultAlertInterval}
+	if chatStr := os.Getenv("OPS_CHAT_ID"); chatStr != "" {
+		chatID, err := strconv.ParseInt(chatStr, 10, 64)
+		if err != nil || chatID == 0 {
+			return cfg, fmt.Errorf("OPS_CHAT_ID 无效（%s）", chatStr)
+		}
+		cfg.ChatID = chatID
+	}
+	if minutesStr := os.Getenv("ALERT_INTERVAL_MINUTES"); minutesStr != "" {
+		minutes, err := strconv.Atoi(minutesStr)
+		if err != nil || minutes < 1 {
+			return cfg, fmt.Errorf("ALERT_INTERVAL_MINUTES 无效（%s），应为大于 0 的整数", minutesStr)
+		}
+		cfg.Interval = time.Duration(minutes) * time.Minute
+	}
+	return cfg, nil
+}
+
+// alerter 对告警按类型限流：同一类型在 Interval 内只发送一次，其余只计数并附在下一次告警中
+type alerter struct {
+	cfg        alertConfig
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+func newAlerter(cfg alertConfig) *alerter {
+	return &alerter{
+		cfg:        cfg,
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// allow 判断 key 类型的告警现在能否发送，返回此前被限流的次数
+func (a *alerter) allow(key string, now time.Time) (bool, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.last[key]; ok && now.Sub(last) < a.cfg.Interval {
+		a.suppressed[key]++
+		return false, 0
+	}
+	a.last[key] = now
+	skipped := a.suppressed[key]
+	delete(a.suppressed, key)
+	return true, skipped
+}
+
+// alert 在后台向运维会话发送一条告警，key 相同的告警受限流控制
+func (b *BotInstance) alert(key, text string) {
+	ok, skipped := b.alerts.allow(key, time.Now())
+	if !ok {
+		return
+	}
+	if skipped > 0 {
+		text += fmt.Sprintf("\n\n（此前 %s 内另有 %d 次同类告警未发送）", formatWait(b.alerts.cfg.Interval), skipped)
+	}
+	if b.chatNotify != nil {
+		b.chatNotify.send(notifyAlert, text)
+	}
+	go func() {
+		if b.alerts.cfg.ChatID == 0 {
+			for _, adminID := range b.adminIDList() {
+				if !b.isSuperAdmin(adminID) {
+					continue
+				}
+				if _, err := b.API.Send(tgbotapi.NewMessage(adminID, text)); err != nil {
+					log.Printf("发送告警给超级管理员 %d 失败: %v", adminID, err)
+				}
+			}
+			return
+		}
+		if _, err := b.API.Send(tgbotapi.NewMessage(b.alerts.cfg.ChatID, text)); err != nil {
+			log.Printf("发送告警到运维会话 %d 失败: %v", b.alerts.cfg.ChatID, err)
+		}
+	}()
+}
+
+// apiHealthClient 包装 Telegram API 的 HTTP 客户端，统计连续失败的请求。
+// 网络错误和 5xx 响应计为失败；4xx（例如用户屏蔽了机器人）说明 API 本身正常。
+type apiHealthClient struct {
+	next tgbotapi.HTTPClient
+
+	mu        sync.Mutex
+	failures  int
+	downSince time.Time // 达到失败阈值的时间，为零表示正常
+	lastErr   string
+	lastErrAt time.Time // 最近一次失败的时间，恢复后保留，供 /status 查看
+
+	// onChange 在 API 判定为不可用或恢复时被调用（在独立 goroutine 中）
+	onChange func(healthy bool, failures int, since time.Time, lastErr string)
+}
+
+// Do 发送请求并统计结果。请求地址中含有 Bot Token，返回的错误会去掉地址中的 Token，
+// 记录的错误只保留原因，避免 Token 出现在日志、告警和 /status 中
+func (c *apiHealthClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.Do(req)
+	switch {
+	case err != nil:
+		cause := err
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = redactBotToken(urlErr.URL)
+			cause = urlErr.Err
+		}
+		c.record(true, cause.Error())
+	case resp.StatusCode >= http.StatusInternalServerError:
+		c.record(true, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// 触发限速时由调用方重试，不影响判断
+	default:
+		c.record(false, "")
+	}
+	return resp, err
+}
+
+func (c *apiHealthClient) record(failed bool, errText string) {
+	c.mu.Lock()
+	var notify func()
+	if failed {
+		c.failures++
+		c.lastErr = errText
+		c.lastErrAt = time.Now()
+		if c.failures >= apiFailureThreshold && c.downSince.IsZero() {
+			c.downSince = time.Now()
+			failures, since, onChange := c.failures, c.downSince, c.onChange
+			log.Printf("Telegram API 连续 %d 次请求失败: %s", failures, errText)
+			if onChange != nil {
+				notify = func() { onChange(false, failures, since, errText) }
+			}
+		}
+	} else {
+		if !c.downSince.IsZero() {
+			failures, since, lastErr, onChange := c.failures, c.downSince, c.lastErr, c.onChange
+			log.Printf("Telegram API 已恢复，此前连续失败 %d 次", failures)
+			if onChange != nil {
+				notify = func() { onChange(true, failures, since, lastErr) }
+			}
+		}
+		c.failures = 0
+		c.downSince = time.Time{}
+	}
+	c.mu.Unlock()
+	if notify != nil {
+		go notify()
+	}
+}
+
+// botTokenPattern 匹配 Bot API 地址中 /bot<Token>/ 的部分
+var botTokenPattern = regexp.MustCompile(`/bot[^/]+/`)
+
+// redactBotToken 将地址中的 Bot Token 替换为占位符
+func redactBotToken(s string) string {
+	return botTokenPattern.ReplaceAllString(s, "/bot<TOKEN>/")
+}
+
+// lastError 返回最近一次失败的错误、时间和当前连续失败的次数，从未失败时错误为空
+func (c *apiHealthClient) lastError() (string, time.Time, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErr, c.lastErrAt, c.failures
+}
+
+// handleAPIHealthChange 在 Telegram API 连续失败或恢复时发送告警。
+// 不可用期间告警本身也可能发送失败，因此恢复时会再说明故障的持续时间。
+func (b *BotInstance) handleAPIHealthChange(healthy bool, failures int, since time.Time, lastErr string) {
+	if healthy {
+		b.alert("telegram_up", fmt.Sprintf("✅ Telegram API 已恢复\n故障开始于 %s，持续约 %s，期间连续失败 %d 次\n最后的错误：%s",
+			since.Format("2006-01-02 15:04:05"), formatWait(time.Since(since)), failures, lastErr))
+		return
+	}
+	b.alert("telegram_down", fmt.Sprintf("⚠️ Telegram API 连续 %d 次请求失败\n最后的错误：%s", failures, lastErr))
+}
+
+// handleRedisHealthChange 在 Redis 故障或恢复时发送告警
+func (b *BotInstance) handleRedisHealthChange(healthy bool) {
+	if healthy {
+		b.alert("redis_up", "✅ Redis 已恢复")
+	} else {
+		b.alert("redis_down", "⚠️ Redis 连接异常，部分功能受影响")
+	}
+}
+
+// alertPanic 报告处理更新时发生的 panic，同一处理函数的 panic 受限流控制
+func (b *BotInstance) alertPanic(handler string, r interface{}) {
+	b.alert("panic:"+handler, fmt.Sprintf("🔥 处理更新时发生 panic\n处理函数：%s\n错误：%v\n详细堆栈见日志。", handler, r))
+}
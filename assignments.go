@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// claimCallbackPrefix 是转发消息上“认领”按钮的回调前缀，后接用户 ID
+const claimCallbackPrefix = "claim_"
+
+// claimButtonRow 返回“认领”和“转接”按钮，只在转发到群组（多名客服共用的会话）时显示
+func claimButtonRow(chatID, userID int64) []tgbotapi.InlineKeyboardButton {
+	if chatID >= 0 {
+		return nil
+	}
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🙋 认领", fmt.Sprintf("%s%d", claimCallbackPrefix, userID)),
+		tgbotapi.NewInlineKeyboardButtonData("🔀 转接", fmt.Sprintf("%s%d", transferCallbackPrefix, userID)),
+	)
+}
+
+// assigneeCaption 返回转发标题中提及认领客服的一行（MarkdownV2），用户未被认领时为空
+func (b *BotInstance) assigneeCaption(userID int64) string {
+	adminID, name, err := b.redisClient.GetAssignee(context.Background(), userID)
+	if err != nil {
+		log.Printf("获取用户 %d 的认领客服失败: %v", userID, err)
+		return ""
+	}
+	if adminID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n认领客服: [%s](tg://user?id=%d)", escapeMarkdownV2(name), adminID)
+}
+
+// handleClaimCallback 处理“认领”按钮：点击的客服成为该用户的处理人，已被他人认领时改为由点击者处理
+func (b *BotInstance) handleClaimCallback(q *tgbotapi.CallbackQuery) {
+	userID, err := strconv.ParseInt(strings.TrimPrefix(q.Data, claimCallbackPrefix), 10, 64)
+	if err != nil {
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	name := adminDisplayName(q.From)
+	previous, err := b.redisClient.ClaimUser(context.Background(), userID, q.From.ID, name)
+	if err != nil {
+		log.Printf("管理员 %d 认领用户 %d 失败: %v", q.From.ID, userID, err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 认领失败，请稍后再试"))
+		return
+	}
+	if previous == q.From.ID {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "您已认领该用户"))
+		return
+	}
+
+	details := fmt.Sprintf("用户 %d", userID)
+	if previous != 0 {
+		details += fmt.Sprintf("（原由管理员 %d 处理）", previous)
+	}
+	b.audit(q.From.ID, cache.AuditAssign, details)
+	b.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已认领，该用户之后的消息会提及您"))
+	if q.Message != nil {
+		notice := tgbotapi.NewMessage(q.Message.Chat.ID, fmt.Sprintf("🙋 %s 已认领%s", name, b.userLabel(userID)))
+		notice.ReplyToMessageID = q.Message.MessageID
+		notice.AllowSendingWithoutReply = true
+		b.API.Send(notice)
+	}
+	log.Printf("管理员 %d 认领了用户 %d（原客服 %d）", q.From.ID, userID, previous)
+}
+
+// releaseAssignment 在会话解决后取消用户的认领
+func (b *BotInstance) releaseAssignment(userID int64) {
+	if _, err := b.redisClient.ReleaseUser(context.Background(), userID); err != nil {
+		log.Printf("取消用户 %d 的认领失败: %v", userID, err)
+	}
+}
+
+// handleMyConversations 列出发送者当前认领的用户及其工单状态
+func (b *BotInstance) handleMyConversations(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	ids, err := b.redisClient.GetOperatorAssignments(ctx, msg.From.ID)
+	if err != nil {
+		log.Printf("获取管理员 %d 认领的用户失败: %v", msg.From.ID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取认领的会话失败。"))
+		return
+	}
+	if len(ids) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "您当前没有认领的会话。在转发消息下点击“🙋 认领”即可认领用户。"))
+		return
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("您认领的会话共 %d 个：\n", len(ids)))
+	for _, id := range ids {
+		userID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		sb.WriteString(b.userLabel(userID))
+		if ticketID, _ := b.redisClient.GetUserTicketID(ctx, userID); ticketID != "" {
+			if ticket, ok, _ := b.redisClient.GetTicket(ctx, ticketID); ok {
+				sb.WriteString(fmt.Sprintf(" #%s %s", ticket.ID, ticketStatusName(ticket.Status)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n会话标记为已解决后自动取消认领。")
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+}
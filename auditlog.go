@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"my-tg-bot/internal/cache"
+)
+
+const (
+	auditPageSize       = 10          // /auditlog 每页显示的记录数
+	auditPageCallback   = "auditlog_" // “更早”按钮的回调前缀，后接当前页最后一条记录的 ID
+	auditDetailsMaxRune = 200         // 单条记录详情的最大显示长度
+)
+
+// auditActionNames 是审计操作类型的中文名称
+var auditActionNames = map[string]string{
+	cache.AuditBlock:     "拉黑",
+	cache.AuditUnblock:   "解除拉黑",
+	cache.AuditBroadcast: "广播",
+	cache.AuditWelcome:   "欢迎语",
+	cache.AuditNote:      "备注",
+	cache.AuditAdmin:     "管理员",
+	cache.AuditTag:       "标签",
+	cache.AuditSettings:  "设置",
+	cache.AuditImport:    "导入",
+	cache.AuditPurge:     "清理",
+	cache.AuditAssign:    "认领",
+	cache.AuditApprove:   "放行",
+	cache.AuditOrder:     "订单",
+}
+
+// audit 记录一次管理员操作，写入失败只记日志，不影响操作本身
+func (b *BotInstance) audit(actorID int64, action, details string) {
+	if err := b.redisClient.AddAuditEntry(context.Background(), actorID, action, details); err != nil {
+		log.Printf("写入审计日志失败（管理员 %d，操作 %s）: %v", actorID, action, err)
+	}
+}
+
+// handleAuditLog 处理 /auditlog 命令，显示最近的管理员操作
+func (b *BotInstance) handleAuditLog(msg *tgbotapi.Message) {
+	text, keyboard := b.auditLogPage("")
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	if keyboard != nil {
+		reply.ReplyMarkup = *keyboard
+	}
+	b.API.Send(reply)
+}
+
+// handleAuditLogCallback 处理“更早”按钮，在原消息中显示下一页
+func (b *BotInstance) handleAuditLogCallback(q *tgbotapi.CallbackQuery) {
+	b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+	text, keyboard := b.auditLogPage(strings.TrimPrefix(q.Data, auditPageCallback))
+	if keyboard != nil {
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(q.Message.Chat.ID, q.Message.MessageID, text, *keyboard))
+	} else {
+		b.API.Send(tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID, text))
+	}
+}
+
+// auditLogPage 生成 ID 早于 before 的一页审计记录，before 为空时从最新的记录开始
+func (b *BotInstance) auditLogPage(before string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	// 多取一条用于判断是否还有更早的记录
+	entries, err := b.redisClient.GetAuditEntries(context.Background(), before, auditPageSize+1)
+	if err != nil {
+		log.Printf("读取审计日志失败: %v", err)
+		return "❌ 读取审计日志失败，请稍后再试。", nil
+	}
+	if len(entries) == 0 {
+		if before == "" {
+			return "暂无管理员操作记录。", nil
+		}
+		return "没有更早的操作记录了。", nil
+	}
+
+	more := len(entries) > auditPageSize
+	if more {
+		entries = entries[:auditPageSize]
+	}
+	var sb strings.Builder
+	sb.WriteString("管理员操作记录（从新到旧）：\n")
+	for _, entry := range entries {
+		action := auditActionNames[entry.Action]
+		if action == "" {
+			action = entry.Action
+		}
+		details := []rune(entry.Details)
+		if len(details) > auditDetailsMaxRune {
+			details = append(details[:auditDetailsMaxRune], '…')
+		}
+		sb.WriteString(fmt.Sprintf("\n%s [%s] 管理员 %d\n%s\n", entry.At.Format("2006-01-02 15:04:05"), action, entry.ActorID, string(details)))
+	}
+	if !more {
+		return sb.String(), nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("更早", auditPageCallback+entries[len(entries)-1].ID),
+	))
+	return sb.String(), &keyboard
+}
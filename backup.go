@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// backupHeader 是备份文件中 keys 之前的字段
+type backupHeader struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Bot       string    `json:"bot"`
+}
+
+// handleBackup 处理 /backup：把 Redis 中的所有数据（配置、欢迎语、按钮、自动回复、用户、黑名单等）
+// 写成 JSON 备份文件发送给管理员，文件边生成边上传
+func (b *BotInstance) handleBackup(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	b.API.Send(tgbotapi.NewMessage(chatID, "⏳ 正在生成备份…"))
+	go func() {
+		started := time.Now()
+		r, w := io.Pipe()
+		counted := make(chan int, 1)
+		go func() {
+			n, err := b.writeBackup(context.Background(), w, started)
+			counted <- n
+			w.CloseWithError(err)
+		}()
+
+		doc := tgbotapi.NewDocument(chatID, tgbotapi.FileReader{Name: "backup-" + started.Format("20060102-150405") + ".json", Reader: r})
+		doc.Caption = "发送 /restore 并上传此文件即可恢复数据。"
+		_, err := b.API.Send(doc)
+		r.CloseWithError(err)
+		n := <-counted
+		if err != nil {
+			log.Printf("生成备份失败（已写入 %d 个键）: %v", n, err)
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ 生成备份失败："+err.Error()))
+			return
+		}
+		log.Printf("管理员 %d 生成了备份，共 %d 个键，耗时 %v", msg.From.ID, n, time.Since(started).Round(time.Millisecond))
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 备份完成，共 %d 个键。", n)))
+	}()
+}
+
+// writeBackup 将备份写入 w，格式为 {"version":1,"created_at":...,"bot":...,"keys":[...]}，返回写入的键数
+func (b *BotInstance) writeBackup(ctx context.Context, w io.Writer, now time.Time) (int, error) {
+	header, err := json.Marshal(backupHeader{Version: cache.BackupVersion, CreatedAt: now, Bot: b.API.Self.UserName})
+	if err != nil {
+		return 0, err
+	}
+	// 去掉结尾的 }，在其后追加 keys 数组
+	if _, err := fmt.Fprintf(w, "%s,\"keys\":[", header[:len(header)-1]); err != nil {
+		return 0, err
+	}
+	n := 0
+	err = b.redisClient.EachBackupKey(ctx, func(dump cache.KeyDump) error {
+		entry, err := json.Marshal(dump)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			entry = append([]byte{',', '\n'}, entry...)
+		}
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return n, err
+}
+
+// restoreDocument 在后台下载备份文件并写回 Redis
+func (b *BotInstance) restoreDocument(chatID, adminID int64, doc *tgbotapi.Document) {
+	b.API.Send(tgbotapi.NewMessage(chatID, "⏳ 正在恢复数据…"))
+	go func() {
+		n, err := b.runRestore(doc.FileID)
+		if err != nil {
+			log.Printf("管理员 %d 恢复备份失败（已恢复 %d 个键）: %v", adminID, n, err)
+			b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 恢复失败（已恢复 %d 个键）：%v", n, err)))
+			return
+		}
+		log.Printf("管理员 %d 从备份恢复了 %d 个键", adminID, n)
+		b.audit(adminID, cache.AuditImport, fmt.Sprintf("从备份恢复了 %d 个键", n))
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已恢复 %d 个键。管理员列表和定时广播在重启机器人后生效。", n)))
+	}()
+}
+
+// runRestore 逐个读取备份文件中的键并写回 Redis，返回恢复的键数
+func (b *BotInstance) runRestore(fileID string) (int, error) {
+	body, err := b.downloadFile(fileID)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return b.restoreBackup(context.Background(), json.NewDecoder(body))
+}
+
+// restoreBackup 解析备份文件，keys 数组中的每个键读到后立即恢复，不把整个文件载入内存
+func (b *BotInstance) restoreBackup(ctx context.Context, dec *json.Decoder) (int, error) {
+	invalid := errors.New("不是有效的备份文件")
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0, invalid
+	}
+	n := 0
+	versionChecked := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, invalid
+		}
+		switch tok {
+		case "version":
+			var version int
+			if err := dec.Decode(&version); err != nil || version != cache.BackupVersion {
+				return n, fmt.Errorf("不支持的备份版本 %d", version)
+			}
+			versionChecked = true
+		case "keys":
+			if !versionChecked {
+				return n, invalid
+			}
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return n, invalid
+			}
+			for dec.More() {
+				var dump cache.KeyDump
+				if err := dec.Decode(&dump); err != nil {
+					return n, fmt.Errorf("解析第 %d 个键失败: %w", n+1, err)
+				}
+				if err := b.redisClient.RestoreKey(ctx, dump); err != nil {
+					return n, fmt.Errorf("恢复键 %s 失败: %w", dump.Key, err)
+				}
+				n++
+			}
+			if _, err := dec.Token(); err != nil {
+				return n, invalid
+			}
+		default:
+			// 其他字段（created_at、bot）只用于说明
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return n, invalid
+			}
+		}
+	}
+	return n, nil
+}
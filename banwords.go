@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	ConfigBanwordsMode = "config:banwords_mode" // 命中违禁词时的处理方式：reject 或 flag，为空时为 reject
+
+	banwordsModeReject = "reject" // 不转发，提醒用户
+	banwordsModeFlag   = "flag"   // 照常转发，并提醒客服
+
+	defaultBanwordsMaxViolations = 3
+	defaultBanwordsMuteMinutes   = 60
+	banwordsViolationWindow      = 24 * time.Hour // 从第一次违规起计算违规次数的时间窗
+)
+
+// banwordsConfig 是违禁词自动禁言的配置，MaxViolations 为 0 时不自动禁言
+type banwordsConfig struct {
+	MaxViolations int
+	Mute          time.Duration
+}
+
+// loadBanwordsConfig 从 BANWORDS_MAX_VIOLATIONS 和 BANWORDS_MUTE_MINUTES 读取自动禁言配置
+func loadBanwordsConfig() banwordsConfig {
+	cfg := banwordsConfig{MaxViolations: defaultBanwordsMaxViolations, Mute: defaultBanwordsMuteMinutes * time.Minute}
+	if maxStr := os.Getenv("BANWORDS_MAX_VIOLATIONS"); maxStr != "" {
+		n, err := strconv.Atoi(maxStr)
+		if err != nil || n < 0 {
+			log.Printf("警告：BANWORDS_MAX_VIOLATIONS 无效（%s），使用默认值 %d", maxStr, defaultBanwordsMaxViolations)
+		} else {
+			cfg.MaxViolations = n
+		}
+	}
+	if muteStr := os.Getenv("BANWORDS_MUTE_MINUTES"); muteStr != "" {
+		n, err := strconv.Atoi(muteStr)
+		if err != nil || n < 1 {
+			log.Printf("警告：BANWORDS_MUTE_MINUTES 无效（%s），使用默认值 %d", muteStr, defaultBanwordsMuteMinutes)
+		} else {
+			cfg.Mute = time.Duration(n) * time.Minute
+		}
+	}
+	return cfg
+}
+
+// normalizeBanword 转为小写并去掉空白
+func normalizeBanword(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), "")
+}
+
+// matchBanwords 返回消息文字或说明中包含的违禁词。只由 ASCII 字符组成的词按整词匹配，
+// 避免 “ass” 命中 “class”；中文等其他文字没有词间空格，去掉空白后按子串匹配，使“坏 词”之类的写法也能命中
+func matchBanwords(msg *tgbotapi.Message, words []string) []string {
+	text := strings.ToLower(msg.Text + "\n" + msg.Caption)
+	compact := normalizeBanword(text)
+	if compact == "" {
+		return nil
+	}
+	var matched []string
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		if isASCII(word) && containsWord(text, word) || !isASCII(word) && strings.Contains(compact, word) {
+			matched = append(matched, word)
+		}
+	}
+	return matched
+}
+
+// isASCII 报告字符串是否只由 ASCII 字符组成
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// containsWord 报告 text 中是否有前后都不是字母、数字或下划线的 word
+func containsWord(text, word string) bool {
+	for i := 0; i <= len(text)-len(word); {
+		j := strings.Index(text[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+// isWordByte 报告字节是否为 ASCII 字母、数字或下划线，其他字符（包括中文）都视为单词边界
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// banwordsMode 返回命中违禁词时的处理方式
+func (b *BotInstance) banwordsMode(ctx context.Context) string {
+	mode, err := b.redisClient.GetConfigValue(ctx, ConfigBanwordsMode)
+	if err != nil || mode != banwordsModeFlag {
+		return banwordsModeReject
+	}
+	return mode
+}
+
+// checkBanwords 检查用户消息是否包含违禁词。reject 模式下不转发并提醒用户，flag 模式下照常转发并提醒客服；
+// 违规次数达到上限时临时禁言。返回 false 表示该消息不应继续处理
+func (b *BotInstance) checkBanwords(msg *tgbotapi.Message) bool {
+	ctx := context.Background()
+	words, err := b.redisClient.GetBannedWords(ctx)
+	if err != nil {
+		// 无法确认时放行，避免 Redis 故障导致客服转发中断
+		log.Printf("获取违禁词失败: %v", err)
+		return true
+	}
+	matched := matchBanwords(msg, words)
+	if len(matched) == 0 {
+		return true
+	}
+	userID := msg.From.ID
+	mode := b.banwordsMode(ctx)
+	log.Printf("用户 %d 的消息包含违禁词 %v（%s）", userID, matched, mode)
+
+	muted := false
+	if b.banwords.MaxViolations > 0 {
+		count, err := b.redisClient.CountBanwordViolation(ctx, userID, banwordsViolationWindow)
+		if err != nil {
+			log.Printf("记录用户 %d 的违禁词违规失败: %v", userID, err)
+		} else if count >= int64(b.banwords.MaxViolations) {
+			if err := b.redisClient.MuteUser(ctx, userID, b.banwords.Mute); err != nil {
+				log.Printf("禁言用户 %d 失败: %v", userID, err)
+			} else {
+				muted = true
+				b.redisClient.ResetBanwordViolations(ctx, userID)
+				log.Printf("用户 %d 24 小时内 %d 次发送违禁词，禁言 %v", userID, count, b.banwords.Mute)
+			}
+		}
+	}
+
+	warning := fmt.Sprintf("⚠️ %s 的消息包含违禁词：%s", b.userLabel(userID), strings.Join(matched, "、"))
+	if mode == banwordsModeReject {
+		warning += "\n消息未转发：" + truncateRunes(messageSummary(msg), 100)
+	}
+	if muted {
+		warning += fmt.Sprintf("\n多次违规，已禁言 %d 分钟。", int(b.banwords.Mute.Minutes()))
+	}
+	b.flagToAdmins(msg, warning, nil)
+
+	switch {
+	case muted:
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("您多次发送包含违禁词的消息，已被暂时限制 %d 分钟，期间的消息不会转交给客服。", int(b.banwords.Mute.Minutes()))))
+		return false
+	case mode == banwordsModeReject:
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "您的消息包含违禁内容，未发送给客服，请修改后重新发送。"))
+		return false
+	}
+	return true
+}
+
+// flagToAdmins 将关于用户消息的提醒（可带按钮）发到接收该用户消息的会话，启用话题模式时发到转发目标
+func (b *BotInstance) flagToAdmins(msg *tgbotapi.Message, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	target := b.forwardTarget()
+	if !b.topicsManager.Enabled() {
+		target = b.routeTarget(msg)
+	}
+	if target == 0 {
+		return
+	}
+	notice := tgbotapi.NewMessage(target, text)
+	if markup != nil {
+		notice.ReplyMarkup = markup
+	}
+	if _, err := b.API.Send(notice); err != nil {
+		log.Printf("发送用户 %d 的消息提醒失败: %v", msg.From.ID, err)
+	}
+}
+
+const banwordsUsage = "用法：\n" +
+	"/banwords list —— 查看违禁词\n" +
+	"/banwords add <词> [词…] —— 添加违禁词，多个词用空格分隔\n" +
+	"/banwords remove <词> [词…] —— 移除违禁词\n" +
+	"/banwords mode <reject|flag> —— reject：不转发并提醒用户；flag：照常转发并提醒客服"
+
+// handleBanwords 处理 /banwords：管理违禁词列表和命中时的处理方式
+func (b *BotInstance) handleBanwords(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	words := make([]string, 0, len(args)-1)
+	for _, word := range args[1:] {
+		if word = normalizeBanword(word); word != "" {
+			words = append(words, word)
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		list, err := b.redisClient.GetBannedWords(ctx)
+		if err != nil {
+			log.Printf("获取违禁词失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取违禁词失败。"))
+			return
+		}
+		sort.Strings(list)
+		var sb strings.Builder
+		if len(list) == 0 {
+			sb.WriteString("当前没有违禁词。\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("违禁词（%d 个）：\n%s\n", len(list), strings.Join(list, "、")))
+		}
+		mode := "reject（不转发并提醒用户）"
+		if b.banwordsMode(ctx) == banwordsModeFlag {
+			mode = "flag（照常转发并提醒客服）"
+		}
+		sb.WriteString("处理方式：" + mode + "\n")
+		if b.banwords.MaxViolations > 0 {
+			sb.WriteString(fmt.Sprintf("24 小时内违规 %d 次自动禁言 %d 分钟\n", b.banwords.MaxViolations, int(b.banwords.Mute.Minutes())))
+		} else {
+			sb.WriteString("不自动禁言\n")
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()+"\n"+banwordsUsage))
+	case "add":
+		if len(words) == 0 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, banwordsUsage))
+			return
+		}
+		added, err := b.redisClient.AddBannedWords(ctx, words...)
+		if err != nil {
+			log.Printf("添加违禁词失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 添加违禁词失败，请稍后再试。"))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditSettings, "添加违禁词："+strings.Join(words, "、"))
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已添加 %d 个违禁词。", added)))
+	case "remove", "del":
+		if len(words) == 0 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, banwordsUsage))
+			return
+		}
+		removed, err := b.redisClient.RemoveBannedWords(ctx, words...)
+		if err != nil {
+			log.Printf("移除违禁词失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 移除违禁词失败，请稍后再试。"))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditSettings, "移除违禁词："+strings.Join(words, "、"))
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已移除 %d 个违禁词。", removed)))
+	case "mode":
+		if len(args) != 2 || (args[1] != banwordsModeReject && args[1] != banwordsModeFlag) {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, banwordsUsage))
+			return
+		}
+		if err := b.redisClient.SetConfigValue(ctx, ConfigBanwordsMode, args[1]); err != nil {
+			log.Printf("保存违禁词处理方式失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 保存失败，请稍后再试。"))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditSettings, "违禁词处理方式改为 "+args[1])
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 违禁词处理方式已改为 "+args[1]+"。"))
+	default:
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, banwordsUsage))
+	}
+}
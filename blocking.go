@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"my-tg-bot/internal/cache"
+)
+
+// resolveUserArg 将命令参数解析为用户 ID：可以是数字 ID，也可以是 @username（从已保存的用户信息中查找）
+func (b *BotInstance) resolveUserArg(arg string) (int64, error) {
+	if userID, err := strconv.ParseInt(arg, 10, 64); err == nil && userID != 0 {
+		return userID, nil
+	}
+	username := strings.TrimPrefix(arg, "@")
+	if username == "" {
+		return 0, fmt.Errorf("无效的用户参数: %s", arg)
+	}
+	userID, err := b.redisClient.FindUserIDByUsername(context.Background(), username)
+	if err != nil {
+		return 0, err
+	}
+	if userID == 0 {
+		return 0, fmt.Errorf("找不到用户名为 @%s 的用户（只能查找联系过机器人的用户）", username)
+	}
+	return userID, nil
+}
+
+// userLabel 返回“用户 昵称 @用户名 (ID)”形式的用户描述
+func (b *BotInstance) userLabel(userID int64) string {
+	firstName, lastName, username, _ := b.redisClient.GetUserInfo(context.Background(), userID)
+	name := strings.TrimSpace(firstName + " " + lastName)
+	if username != "" {
+		name = strings.TrimSpace(name + " @" + username)
+	}
+	return fmt.Sprintf("用户 %s (%d)", name, userID)
+}
+
+// parseBlockCommandUser 解析 /block、/unblock 的参数，失败时向管理员说明原因
+func (b *BotInstance) parseBlockCommandUser(msg *tgbotapi.Message) (int64, bool) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 1 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("用法：/%s <用户ID|@用户名>", msg.Command())))
+		return 0, false
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return 0, false
+	}
+	return userID, true
+}
+
+// handleBlockCommand 处理 /block 命令，拉黑指定用户
+func (b *BotInstance) handleBlockCommand(msg *tgbotapi.Message) {
+	userID, ok := b.parseBlockCommandUser(msg)
+	if !ok {
+		return
+	}
+	if b.isAdmin(userID) {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 不能拉黑管理员。"))
+		return
+	}
+
+	ctx := context.Background()
+	blocked, err := b.redisClient.IsUserBlocked(ctx, userID)
+	if err != nil {
+		log.Printf("检查用户 %d 是否被拉黑失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 拉黑失败，请稍后重试。"))
+		return
+	}
+	if blocked {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 已在黑名单中。", b.userLabel(userID))))
+		return
+	}
+	if err := b.redisClient.AddBlockedUser(ctx, userID); err != nil {
+		log.Printf("拉黑用户 %d 失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 拉黑失败，请稍后重试。"))
+		return
+	}
+	log.Printf("管理员 %d 拉黑了用户 %d", msg.From.ID, userID)
+	b.audit(msg.From.ID, cache.AuditBlock, fmt.Sprintf("用户 %d", userID))
+	b.emitBlocked(userID, msg.From.ID, "command")
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已拉黑%s", b.userLabel(userID))))
+}
+
+// handleUnblockCommand 处理 /unblock 命令，将指定用户移出黑名单
+func (b *BotInstance) handleUnblockCommand(msg *tgbotapi.Message) {
+	userID, ok := b.parseBlockCommandUser(msg)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	blocked, err := b.redisClient.IsUserBlocked(ctx, userID)
+	if err != nil {
+		log.Printf("检查用户 %d 是否被拉黑失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 解除拉黑失败，请稍后重试。"))
+		return
+	}
+	if !blocked {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 不在黑名单中。", b.userLabel(userID))))
+		return
+	}
+	if err := b.redisClient.RemoveBlockedUser(ctx, userID); err != nil {
+		log.Printf("解除拉黑用户 %d 失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 解除拉黑失败，请稍后重试。"))
+		return
+	}
+	log.Printf("管理员 %d 解除拉黑了用户 %d", msg.From.ID, userID)
+	b.audit(msg.From.ID, cache.AuditUnblock, fmt.Sprintf("用户 %d", userID))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已解除拉黑%s", b.userLabel(userID))))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// defaultStateIdleMinutes 未完成的操作无活动多久后自动取消
+const defaultStateIdleMinutes = 30
+
+// loadStateIdleTimeout 从 STATE_IDLE_MINUTES 读取未完成操作的超时时间，0 表示不自动取消
+func loadStateIdleTimeout() time.Duration {
+	idleStr := os.Getenv("STATE_IDLE_MINUTES")
+	if idleStr == "" {
+		return defaultStateIdleMinutes * time.Minute
+	}
+	n, err := strconv.Atoi(idleStr)
+	if err != nil || n < 0 {
+		log.Printf("警告：STATE_IDLE_MINUTES 无效（%s），使用默认值 %d", idleStr, defaultStateIdleMinutes)
+		return defaultStateIdleMinutes * time.Minute
+	}
+	return time.Duration(n) * time.Minute
+}
+
+// hasAdminState 检查会话是否有未完成的操作：编辑状态、等待输入的设置或导入、广播草稿和欢迎语编辑
+func (b *BotInstance) hasAdminState(chatID int64) bool {
+	if b.adminStates[chatID] != 0 {
+		return true
+	}
+	if _, ok := b.pendingImports[chatID]; ok {
+		return true
+	}
+	if _, ok := b.pendingSettings[chatID]; ok {
+		return true
+	}
+	if _, ok := b.broadcastManager.Broadcasts[chatID]; ok {
+		return true
+	}
+	w := b.welcomeManager
+	_, topic := w.TopicEdits[chatID]
+	_, lang := w.LanguageEdits[chatID]
+	_, act := w.ActionEdits[chatID]
+	_, menu := w.MenuEdits[chatID]
+	return topic || lang || act || menu
+}
+
+// resetAdminState 清除会话所有未完成的操作，返回是否有被取消的操作
+func (b *BotInstance) resetAdminState(chatID int64) bool {
+	cancelled := b.hasAdminState(chatID)
+	delete(b.adminStates, chatID)
+	delete(b.pendingImports, chatID)
+	delete(b.pendingSettings, chatID)
+	delete(b.stateActivity, chatID)
+	// 两个管理器都要清除，不能因前者返回 true 而跳过后者
+	broadcastCancelled := b.broadcastManager.Reset(chatID)
+	welcomeCancelled := b.welcomeManager.Reset(chatID)
+	return cancelled || broadcastCancelled || welcomeCancelled
+}
+
+// touchAdminState 记录会话的操作时间，未完成的操作从此时起重新计算超时
+func (b *BotInstance) touchAdminState(chatID int64) {
+	if b.hasAdminState(chatID) {
+		b.stateActivity[chatID] = time.Now()
+	}
+}
+
+// expireIdleState 在处理管理员的更新前调用：未完成的操作超过 STATE_IDLE_MINUTES 无活动时自动取消，
+// 避免之后发送的普通消息被当作早已遗忘的编辑流程的输入
+func (b *BotInstance) expireIdleState(chatID int64) {
+	if b.stateIdle == 0 {
+		return
+	}
+	last, ok := b.stateActivity[chatID]
+	if !ok || time.Since(last) < b.stateIdle {
+		return
+	}
+	if b.resetAdminState(chatID) {
+		log.Printf("管理员会话 %d 的未完成操作已超时，自动取消", chatID)
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⌛ 之前未完成的操作已超过 %d 分钟无活动，已自动取消。", int(b.stateIdle.Minutes()))))
+	}
+}
+
+// handleCancel 处理管理员的 /cancel：取消当前会话中所有未完成的操作
+func (b *BotInstance) handleCancel(msg *tgbotapi.Message) {
+	if !b.resetAdminState(msg.Chat.ID) {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "当前没有进行中的操作。"))
+		return
+	}
+	log.Printf("管理员 %d 取消了会话 %d 中未完成的操作", msg.From.ID, msg.Chat.ID)
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "已取消，未保存的修改已丢弃。"))
+}
+
+// handleUserCancel 处理用户的 /cancel。用户没有多步操作，只需避免该命令被当作普通消息转交给客服
+func (b *BotInstance) handleUserCancel(msg *tgbotapi.Message) {
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "当前没有进行中的操作，直接发送消息即可联系客服。"))
+}
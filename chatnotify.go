@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/broadcast"
+)
+
+// notifyAlert 是同步到 Slack/Discord 的告警，其余类型与事件推送的事件类型相同
+const notifyAlert = "alert"
+
+// notifyTypes 可同步到 Slack/Discord 的通知类型
+var notifyTypes = append([]string{notifyAlert}, eventTypes...)
+
+// defaultNotifyEvents 未设置 NOTIFY_EVENTS 时同步的通知类型
+var defaultNotifyEvents = []string{eventMessageNew, eventUserNew, notifyAlert}
+
+const (
+	notifyQueueSize   = 500              // 等待发送的通知数，队列满时丢弃新通知
+	notifyTimeout     = 10 * time.Second // 单次请求的超时时间
+	notifyMaxAttempts = 3                // 每条通知最多发送的次数
+	notifyRetryWait   = 5 * time.Second  // 重试前的等待时间，收到 429 且带 Retry-After 时以其为准
+	slackMaxLength    = 3000             // Slack 消息的截断长度
+	discordMaxLength  = 2000             // Discord 消息的长度上限
+)
+
+// chatNotifyConfig 是 Slack/Discord 通知的配置
+type chatNotifyConfig struct {
+	SlackURL   string
+	DiscordURL string
+	Events     map[string]bool // 同步的通知类型
+}
+
+// loadChatNotifyConfig 从 NOTIFY_SLACK_WEBHOOK_URL、NOTIFY_DISCORD_WEBHOOK_URL 和 NOTIFY_EVENTS 读取配置，
+// 两个地址都未设置时返回 nil
+func loadChatNotifyConfig() (*chatNotifyConfig, error) {
+	cfg := &chatNotifyConfig{
+		SlackURL:   strings.TrimSpace(os.Getenv("NOTIFY_SLACK_WEBHOOK_URL")),
+		DiscordURL: strings.TrimSpace(os.Getenv("NOTIFY_DISCORD_WEBHOOK_URL")),
+		Events:     make(map[string]bool),
+	}
+	if cfg.SlackURL == "" && cfg.DiscordURL == "" {
+		return nil, nil
+	}
+	for name, raw := range map[string]string{"NOTIFY_SLACK_WEBHOOK_URL": cfg.SlackURL, "NOTIFY_DISCORD_WEBHOOK_URL": cfg.DiscordURL} {
+		if raw == "" {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("%s 无效，应为 https:// 开头的 Webhook 地址", name)
+		}
+	}
+	events := defaultNotifyEvents
+	if eventsStr := os.Getenv("NOTIFY_EVENTS"); eventsStr != "" {
+		events = strings.Split(eventsStr, ",")
+	}
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if !isNotifyType(event) {
+			return nil, fmt.Errorf("NOTIFY_EVENTS 中的类型无效（%s），可用类型：%s", event, strings.Join(notifyTypes, ", "))
+		}
+		cfg.Events[event] = true
+	}
+	return cfg, nil
+}
+
+func isNotifyType(event string) bool {
+	for _, t := range notifyTypes {
+		if t == event {
+			return true
+		}
+	}
+	return false
+}
+
+// describe 返回配置的可读描述，用于日志和配置检查
+func (cfg *chatNotifyConfig) describe() string {
+	var targets, events []string
+	if cfg.SlackURL != "" {
+		targets = append(targets, "Slack")
+	}
+	if cfg.DiscordURL != "" {
+		targets = append(targets, "Discord")
+	}
+	for _, t := range notifyTypes {
+		if cfg.Events[t] {
+			events = append(events, t)
+		}
+	}
+	return fmt.Sprintf("%s，%s", strings.Join(targets, "、"), strings.Join(events, ", "))
+}
+
+// chatNotifyJob 是向一个地址发送一条通知的任务
+type chatNotifyJob struct {
+	url     string
+	body    []byte
+	attempt int
+}
+
+// chatNotifier 将客户消息和告警同步到 Slack/Discord 频道。只用一个协程依次发送，保持消息顺序
+type chatNotifier struct {
+	cfg    chatNotifyConfig
+	client *http.Client
+	queue  chan chatNotifyJob
+}
+
+// newChatNotifier 启动发送通知的后台协程
+func newChatNotifier(cfg chatNotifyConfig) *chatNotifier {
+	n := &chatNotifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: notifyTimeout},
+		queue:  make(chan chatNotifyJob, notifyQueueSize),
+	}
+	go func() {
+		for job := range n.queue {
+			n.deliver(job)
+		}
+	}()
+	return n
+}
+
+// send 将文字通知加入发送队列，未启用该通知类型时忽略
+func (n *chatNotifier) send(event, text string) {
+	if !n.cfg.Events[event] {
+		return
+	}
+	if n.cfg.SlackURL != "" {
+		body, _ := json.Marshal(map[string]string{"text": escapeSlack(truncateRunes(text, slackMaxLength))})
+		n.enqueue(chatNotifyJob{url: n.cfg.SlackURL, body: body})
+	}
+	if n.cfg.DiscordURL != "" {
+		// 禁止提及，避免用户消息中的 @everyone 等打扰频道成员
+		body, _ := json.Marshal(map[string]interface{}{
+			"content":          truncateRunes(text, discordMaxLength),
+			"allowed_mentions": map[string][]string{"parse": {}},
+		})
+		n.enqueue(chatNotifyJob{url: n.cfg.DiscordURL, body: body})
+	}
+}
+
+// slackEscaper 转义 Slack 消息中的控制字符，避免用户消息中的 <!channel> 或 <链接|文字> 被 Slack 解析
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeSlack 转义 Slack 文本中的 &、< 和 >
+func escapeSlack(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+// enqueue 将通知加入队列，队列已满时丢弃
+func (n *chatNotifier) enqueue(job chatNotifyJob) {
+	select {
+	case n.queue <- job:
+	default:
+		log.Printf("Slack/Discord 通知队列已满，丢弃一条通知")
+	}
+}
+
+// deliver 发送一次通知，失败时按 isRetryableEventError 的规则重试
+func (n *chatNotifier) deliver(job chatNotifyJob) {
+	job.attempt++
+	wait, err := n.post(job)
+	if err == nil {
+		return
+	}
+	host := job.url
+	if u, parseErr := url.Parse(job.url); parseErr == nil {
+		host = u.Host // 地址中包含 Webhook 令牌，日志只记录域名
+	}
+	if !isRetryableEventError(err) || job.attempt >= notifyMaxAttempts {
+		log.Printf("发送通知到 %s 失败，已放弃（第 %d 次）: %v", host, job.attempt, err)
+		return
+	}
+	log.Printf("发送通知到 %s 失败，%s 后重试（第 %d 次）: %v", host, wait, job.attempt, err)
+	time.AfterFunc(wait, func() { n.enqueue(job) })
+}
+
+// post 发送一次请求，失败时同时返回建议的重试等待时间
+func (n *chatNotifier) post(job chatNotifyJob) (time.Duration, error) {
+	resp, err := n.client.Post(job.url, "application/json", bytes.NewReader(job.body))
+	if err != nil {
+		return notifyRetryWait, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	wait := notifyRetryWait
+	if seconds, err := time.ParseDuration(resp.Header.Get("Retry-After") + "s"); err == nil && seconds > 0 {
+		wait = seconds
+	}
+	return wait, eventStatusError{status: resp.StatusCode}
+}
+
+// describeEventUser 返回通知中显示的用户
+func describeEventUser(user eventUser) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.Username != "" {
+		name = strings.TrimSpace(name + " @" + user.Username)
+	}
+	return fmt.Sprintf("%s (%d)", name, user.ID)
+}
+
+// notifyText 将事件转换为通知文字
+func (b *BotInstance) notifyText(event string, data interface{}) string {
+	switch d := data.(type) {
+	case eventMessage:
+		text := d.Text
+		if text == "" {
+			text = "[" + d.Type + "]"
+		}
+		return fmt.Sprintf("💬 %s：\n%s", describeEventUser(d.User), text)
+	case eventUser:
+		return "🆕 新用户：" + describeEventUser(d)
+	case eventBlock:
+		return fmt.Sprintf("🚫 管理员 %d 拉黑了%s", d.AdminID, b.userLabel(d.UserID))
+	case eventPayment:
+		return fmt.Sprintf("💰 %s 付款成功：%d %s（最小货币单位）\n账单：%s", describeEventUser(d.User), d.TotalAmount, d.Currency, d.InvoicePayload)
+	case broadcast.Result:
+		state := "发送完成"
+		if d.Stopped {
+			state = "已停止"
+		}
+		return fmt.Sprintf("📢 广播 #%s %s：共 %d 人，成功 %d，失败 %d，跳过 %d", d.ID, state, d.Total, d.Sent, d.Failed, d.Skipped)
+	}
+	return event
+}
+
+// notifyChat 将事件同步到 Slack/Discord，未配置时不做任何事
+func (b *BotInstance) notifyChat(event string, data interface{}) {
+	if b.chatNotify == nil || !b.chatNotify.cfg.Events[event] {
+		return
+	}
+	b.chatNotify.send(event, b.notifyText(event, data))
+}
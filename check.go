@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/joho/godotenv"
+)
+
+// configCheck 收集每一项配置检查的结果
+type configCheck struct {
+	failed bool
+}
+
+func (c *configCheck) pass(item, detail string) {
+	fmt.Printf("[通过] %s：%s\n", item, detail)
+}
+
+func (c *configCheck) fail(item, detail string) {
+	c.failed = true
+	fmt.Printf("[失败] %s：%s\n", item, detail)
+}
+
+func (c *configCheck) skip(item, detail string) {
+	fmt.Printf("[跳过] %s：%s\n", item, detail)
+}
+
+// runConfigCheck 依次校验所有启动配置并打印报告，全部通过返回 0，否则返回 1
+func runConfigCheck() int {
+	c := &configCheck{}
+	fmt.Println("配置检查：")
+
+	if err := godotenv.Load(); err != nil {
+		c.skip(".env 文件", "未找到或无法读取，仅使用环境变量")
+	} else {
+		c.pass(".env 文件", "已加载")
+	}
+	if config, err := loadConfigFile(); err != nil {
+		c.fail("CONFIG_FILE", err.Error())
+	} else if config != nil {
+		applyConfigEnv(config)
+		c.pass("CONFIG_FILE", os.Getenv("CONFIG_FILE")+" 已加载")
+	}
+
+	var api *tgbotapi.BotAPI
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		c.fail("TELEGRAM_BOT_TOKEN", "未设置")
+	} else {
+		botAPI, err := loadBotAPIConfig()
+		if err != nil {
+			c.fail("Bot API 连接", err.Error())
+		} else {
+			if botAPI.Local {
+				c.pass("TELEGRAM_API_ENDPOINT", "使用自建 Bot API 服务器 "+os.Getenv("TELEGRAM_API_ENDPOINT"))
+			}
+			if botAPI.Proxy != nil {
+				c.pass("PROXY_URL", "经代理 "+botAPI.proxyLabel()+" 访问")
+			}
+		}
+		api, err = newBotAPI(token, botAPI)
+		if err != nil {
+			c.fail("TELEGRAM_BOT_TOKEN", "getMe 调用失败: "+err.Error())
+			api = nil
+		} else {
+			c.pass("TELEGRAM_BOT_TOKEN", "机器人账号 @"+api.Self.UserName)
+		}
+	}
+
+	redisAddr := os.Getenv("REDIS_ADDR")
+	redisDB, err := strconv.Atoi(os.Getenv("REDIS_DB"))
+	if os.Getenv("REDIS_DB") != "" && err != nil {
+		c.fail("REDIS_DB", "不是有效的数字")
+	}
+	redisClient, err := cache.NewRedisClient(redisAddr, os.Getenv("REDIS_PASSWORD"), redisDB, os.Getenv("REDIS_KEY_PREFIX"))
+	if err != nil {
+		c.fail("Redis 连接", fmt.Sprintf("%s 无法连接: %v", redisAddr, err))
+	} else {
+		c.pass("Redis 连接", fmt.Sprintf("%s，数据库 %d", redisAddr, redisDB))
+		if prefix := redisClient.KeyPrefix(); prefix != "" {
+			c.pass("REDIS_KEY_PREFIX", prefix)
+		}
+	}
+
+	adminIDStr := os.Getenv("ADMIN_IDS")
+	adminIDs, invalid := parseAdminIDs(adminIDStr)
+	switch {
+	case adminIDStr == "":
+		c.fail("ADMIN_IDS", "未设置，将没有任何管理员")
+	case len(invalid) > 0:
+		c.fail("ADMIN_IDS", "以下条目不是有效的数字 ID: "+strings.Join(invalid, ", "))
+	default:
+		c.pass("ADMIN_IDS", fmt.Sprintf("共 %d 位管理员", len(adminIDs)))
+	}
+
+	forumStr := os.Getenv("FORUM_GROUP_ID")
+	forumID, err := strconv.ParseInt(forumStr, 10, 64)
+	switch {
+	case forumStr == "":
+		c.skip("FORUM_GROUP_ID", "未设置，不启用话题模式")
+	case err != nil:
+		c.fail("FORUM_GROUP_ID", "不是有效的数字 ID")
+	case api == nil:
+		c.skip("FORUM_GROUP_ID", "机器人令牌无效，无法检查可达性")
+	default:
+		chat, err := api.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: forumID}})
+		if err != nil {
+			c.fail("FORUM_GROUP_ID", fmt.Sprintf("无法访问群组 %d: %v", forumID, err))
+		} else if !chat.IsSuperGroup() {
+			c.fail("FORUM_GROUP_ID", fmt.Sprintf("会话 %d 不是超级群组，无法使用话题", forumID))
+		} else {
+			c.pass("FORUM_GROUP_ID", fmt.Sprintf("群组 %d（%s）可访问，请确认已开启话题且机器人拥有管理话题权限", forumID, chat.Title))
+		}
+	}
+
+	forwardStr := os.Getenv("FORWARD_TO_ADMIN_ID")
+	forwardID, err := strconv.ParseInt(forwardStr, 10, 64)
+	switch {
+	case forwardStr == "" && forumStr != "":
+		c.skip("FORWARD_TO_ADMIN_ID", "未设置，用户消息将转发到话题群组")
+	case forwardStr == "":
+		c.fail("FORWARD_TO_ADMIN_ID", "未设置，用户消息将无法转发")
+	case err != nil:
+		c.fail("FORWARD_TO_ADMIN_ID", "不是有效的数字 ID")
+	case api == nil:
+		c.skip("FORWARD_TO_ADMIN_ID", "机器人令牌无效，无法检查可达性")
+	default:
+		chat, err := api.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: forwardID}})
+		if err != nil {
+			c.fail("FORWARD_TO_ADMIN_ID", fmt.Sprintf("无法访问会话 %d（管理员需先私聊机器人，或将机器人加入群组）: %v", forwardID, err))
+		} else {
+			c.pass("FORWARD_TO_ADMIN_ID", fmt.Sprintf("会话 %d（%s）可访问", forwardID, chat.Type))
+		}
+	}
+
+	if webhook, err := loadWebhookConfig(); err != nil {
+		c.fail("Webhook", err.Error())
+	} else if webhook == nil {
+		c.skip("Webhook", "未设置 WEBHOOK_URL，使用长轮询")
+	} else {
+		detail := fmt.Sprintf("%s，监听 %s", webhook.URL.String(), webhook.ListenAddr)
+		if webhook.SecretToken == "" {
+			detail += "，警告：未设置 WEBHOOK_SECRET，无法验证请求来源"
+		}
+		if webhook.CertFile != "" {
+			if _, err := os.Stat(webhook.CertFile); err != nil {
+				c.fail("Webhook", "无法读取 TLS_CERT_FILE: "+err.Error())
+			} else if _, err := os.Stat(webhook.KeyFile); err != nil {
+				c.fail("Webhook", "无法读取 TLS_KEY_FILE: "+err.Error())
+			} else {
+				c.pass("Webhook", detail+"，HTTPS")
+			}
+		} else {
+			c.pass("Webhook", detail+"，HTTP（需由反向代理提供 HTTPS）")
+		}
+	}
+
+	if subscribe, err := loadSubscribeConfig(); err != nil {
+		c.fail("REQUIRED_CHANNEL", err.Error())
+	} else if subscribe == nil {
+		c.skip("REQUIRED_CHANNEL", "未设置，不要求用户关注频道")
+	} else if api == nil {
+		c.skip("REQUIRED_CHANNEL", "机器人令牌无效，无法检查频道")
+	} else {
+		// 机器人需要是频道管理员才能查询其他用户的成员状态
+		member, err := api.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID:             subscribe.ChatID,
+			SuperGroupUsername: subscribe.Username,
+			UserID:             api.Self.ID,
+		}})
+		if err != nil {
+			c.fail("REQUIRED_CHANNEL", fmt.Sprintf("无法访问频道 %s: %v", subscribe.key(), err))
+		} else if !member.IsAdministrator() && !member.IsCreator() {
+			c.fail("REQUIRED_CHANNEL", fmt.Sprintf("机器人不是频道 %s 的管理员，无法查询用户是否已加入", subscribe.key()))
+		} else {
+			c.pass("REQUIRED_CHANNEL", fmt.Sprintf("%s，加入链接 %s", subscribe.key(), subscribe.JoinURL))
+		}
+	}
+
+	if events, err := loadEventConfig(); err != nil {
+		c.fail("EVENT_WEBHOOK_URLS", err.Error())
+	} else if events == nil {
+		c.skip("EVENT_WEBHOOK_URLS", "未设置，不推送事件")
+	} else {
+		c.pass("EVENT_WEBHOOK_URLS", events.describe())
+	}
+	if translate, err := loadTranslateConfig(); err != nil {
+		c.fail("TRANSLATE_PROVIDER", err.Error())
+	} else if translate == nil {
+		c.skip("TRANSLATE_PROVIDER", "未设置，不自动翻译")
+	} else {
+		c.pass("TRANSLATE_PROVIDER", translate.describe())
+	}
+	if prefixes := loadPaymentPrefixes(); len(prefixes) == 0 {
+		c.skip("PAYMENT_PAYLOAD_PREFIXES", "未设置，"+describePaymentPrefixes(prefixes))
+	} else {
+		c.pass("PAYMENT_PAYLOAD_PREFIXES", describePaymentPrefixes(prefixes))
+	}
+	if email, err := loadEmailConfig(); err != nil {
+		c.fail("SMTP_HOST", err.Error())
+	} else if email == nil {
+		c.skip("SMTP_HOST", "未设置，不发送邮件通知")
+	} else {
+		c.pass("SMTP_HOST", email.describe())
+	}
+	if notify, err := loadChatNotifyConfig(); err != nil {
+		c.fail("NOTIFY_EVENTS", err.Error())
+	} else if notify == nil {
+		c.skip("NOTIFY_EVENTS", "未设置 Slack/Discord Webhook，不同步通知")
+	} else {
+		c.pass("NOTIFY_EVENTS", notify.describe())
+	}
+	if dashboard, err := loadDashboardConfig(); err != nil {
+		c.fail("DASHBOARD_ADDR", err.Error())
+	} else if dashboard == nil {
+		c.skip("DASHBOARD_ADDR", "未设置，不启动网页后台")
+	} else {
+		c.pass("DASHBOARD_ADDR", "网页后台监听 "+dashboard.ListenAddr)
+	}
+	if reports, err := loadReportConfig(); err != nil {
+		c.fail("REPORT_TIME", err.Error())
+	} else if reports == nil {
+		c.skip("REPORT_TIME", "未设置，不发送统计报告")
+	} else {
+		c.pass("REPORT_TIME", fmt.Sprintf("每天 %02d:%02d 发送日报，%s发送周报", reports.At/60, reports.At%60, weekdayNames[reports.Weekday]))
+	}
+
+	alerts, err := loadAlertConfig()
+	switch {
+	case err != nil:
+		c.fail("OPS_CHAT_ID", err.Error())
+	case alerts.ChatID == 0:
+		c.skip("OPS_CHAT_ID", "未设置，告警将私信超级管理员")
+	case api == nil:
+		c.skip("OPS_CHAT_ID", "机器人令牌无效，无法检查可达性")
+	default:
+		chat, err := api.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: alerts.ChatID}})
+		if err != nil {
+			c.fail("OPS_CHAT_ID", fmt.Sprintf("无法访问会话 %d: %v", alerts.ChatID, err))
+		} else {
+			c.pass("OPS_CHAT_ID", fmt.Sprintf("会话 %d（%s）可访问，同类告警间隔 %s", alerts.ChatID, chat.Type, formatWait(alerts.Interval)))
+		}
+	}
+
+	if logging, err := loadLoggingConfig(); err != nil {
+		c.fail("日志", err.Error())
+	} else {
+		detail := "级别 " + logging.Level.String()
+		if logging.JSON {
+			detail += "，JSON 格式"
+		}
+		if logging.File != "" {
+			detail += fmt.Sprintf("，写入 %s（超过 %d MB 轮转，保留 %d 个）", logging.File, logging.MaxSize>>20, logging.Backups)
+		}
+		c.pass("日志", detail)
+	}
+
+	if digestStr := os.Getenv("DIGEST_SECONDS"); digestStr != "" {
+		if wait, err := parseDigestSetting(digestStr); err != nil {
+			c.fail("DIGEST_SECONDS", err.Error())
+		} else {
+			c.pass("DIGEST_SECONDS", describeDigest(wait))
+		}
+	}
+
+	if spamStr := os.Getenv("SPAM_SENSITIVITY"); spamStr != "" {
+		if level, err := parseSpamSetting(spamStr); err != nil {
+			c.fail("SPAM_SENSITIVITY", err.Error())
+		} else {
+			c.pass("SPAM_SENSITIVITY", level.Label)
+		}
+	}
+
+	if workersStr := os.Getenv("UPDATE_WORKERS"); workersStr != "" {
+		if workers, err := strconv.Atoi(workersStr); err != nil || workers < 1 {
+			c.fail("UPDATE_WORKERS", "必须是大于 0 的整数")
+		} else {
+			c.pass("UPDATE_WORKERS", workersStr)
+		}
+	}
+
+	if workersStr := os.Getenv("BROADCAST_WORKERS"); workersStr != "" {
+		if workers, err := strconv.Atoi(workersStr); err != nil || workers < 1 {
+			c.fail("BROADCAST_WORKERS", "必须是大于 0 的整数")
+		} else {
+			c.pass("BROADCAST_WORKERS", workersStr)
+		}
+	}
+
+	if redisClient == nil {
+		c.skip("广播调度数据", "Redis 不可用")
+	} else {
+		ctx := context.Background()
+		scheduled, err := redisClient.GetScheduledBroadcasts(ctx)
+		if err != nil {
+			c.fail("定时广播队列", err.Error())
+		} else {
+			c.pass("定时广播队列", fmt.Sprintf("%d 条待发送", len(scheduled)))
+		}
+		inProgress, err := redisClient.GetInProgressBroadcastIDs(ctx)
+		if err != nil {
+			c.fail("未完成的广播", err.Error())
+		} else {
+			c.pass("未完成的广播", fmt.Sprintf("%d 条将在启动后续发", len(inProgress)))
+		}
+	}
+
+	if c.failed {
+		fmt.Println("\n❌ 配置检查未通过，请修正上述失败项后再启动。")
+		return 1
+	}
+	fmt.Println("\n✅ 配置检查全部通过。")
+	return 0
+}
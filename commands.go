@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"my-tg-bot/internal/autoreply"
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// registerCommands 注册管理员命令和用户命令，注册顺序即命令菜单和 /help 中的顺序
+func (b *BotInstance) registerCommands() {
+	const (
+		operator   = cache.RoleOperator
+		superAdmin = cache.RoleSuperAdmin
+	)
+	chatOnly := func(handler func(chatID int64)) func(*tgbotapi.Message) {
+		return func(msg *tgbotapi.Message) { handler(msg.Chat.ID) }
+	}
+
+	b.adminCommands = newCommandRouter()
+	b.adminCommands.register(
+		command{Name: "start", Description: "查看欢迎信息", Role: operator, Handler: b.handleAdminStart},
+		command{Name: "help", Description: "查看可用命令", Role: operator, Handler: b.handleHelp},
+		command{Name: "cancel", Description: "取消当前未完成的操作", Role: operator, Handler: b.handleCancel},
+		command{Name: "setwelcome", Description: "设置欢迎语（可指定语言代码）", Role: superAdmin, Handler: b.handleSetWelcome},
+		command{Name: "setbuttons", Description: "设置欢迎按钮", Role: superAdmin, Handler: chatOnly(b.welcomeManager.StartSetButtonsProcess)},
+		command{Name: "welcomemenu", Description: "编辑欢迎菜单", Role: superAdmin, Handler: chatOnly(b.welcomeManager.StartMenuEditor)},
+		command{Name: "welcomeaction", Description: "设置欢迎动作按钮的回复", Role: superAdmin, Handler: b.handleWelcomeAction},
+		command{Name: "settopicwelcome", Description: "设置主题或来源入口欢迎语", Role: superAdmin, Handler: b.handleSetTopicWelcome},
+		command{Name: "setautoreply", Description: "设置关键词自动回复", Role: superAdmin, Handler: chatOnly(b.autoreplyManager.StartSetAutoReplyProcess)},
+		command{Name: "settings", Description: "打开设置面板", Role: superAdmin, Handler: b.handleSettings},
+		command{Name: "reloadconfig", Description: "重新加载配置文件", Role: superAdmin, Handler: b.handleReloadConfig},
+		command{Name: "setforward", Description: "设置用户消息的转发目标", Role: superAdmin, Handler: b.handleSetForward},
+		command{Name: "sethours", Description: "设置工作时间", Role: superAdmin, Handler: b.handleSetHours},
+		command{Name: "setaway", Description: "设置非工作时间自动回复", Role: superAdmin, Handler: b.handleSetAway},
+		command{Name: "broadcast", Description: "创建广播", Role: superAdmin, Handler: chatOnly(b.broadcastManager.StartBroadcastBuilder)},
+		command{Name: "scheduled", Description: "查看定时广播", Role: superAdmin, Handler: chatOnly(b.broadcastManager.ListScheduledBroadcasts)},
+		command{Name: "recurring", Description: "查看周期广播", Role: superAdmin, Handler: chatOnly(b.broadcastManager.ListRecurringBroadcasts)},
+		command{Name: "broadcastcopy", Description: "转发任意消息进行广播", Role: superAdmin, Handler: chatOnly(b.broadcastManager.StartCopyBroadcast)},
+		command{Name: "broadcasttemplates", Description: "查看广播模板", Role: superAdmin, Handler: chatOnly(b.broadcastManager.ListBroadcastTemplates)},
+		command{Name: "broadcaststats", Description: "查看广播按钮点击统计", Role: superAdmin, Handler: func(msg *tgbotapi.Message) {
+			b.broadcastManager.ListBroadcastClickStats(msg.Chat.ID, strings.TrimSpace(msg.CommandArguments()))
+		}},
+		command{Name: "inbox", Description: "查看尚未回复的用户消息", Role: operator, Handler: b.handleInbox},
+		command{Name: "open", Description: "查看未解决的会话", Role: operator, Handler: chatOnly(b.handleOpenTickets)},
+		command{Name: "reply", Description: "按用户 ID、用户名或工单号直接发送消息", Role: operator, Handler: b.handleReply},
+		command{Name: "myconversations", Description: "查看我认领的会话", Role: operator, Handler: b.handleMyConversations},
+		command{Name: "ticket", Description: "查看工单详情", Role: operator, Handler: b.handleTicket},
+		command{Name: "history", Description: "查看与用户的对话记录", Role: operator, Handler: b.handleHistory},
+		command{Name: "search", Description: "搜索对话记录", Role: operator, Handler: b.handleSearch},
+		command{Name: "listblocked", Description: "查看拉黑用户列表", Role: operator, Handler: func(msg *tgbotapi.Message) { b.handleListBlocked(msg.Chat.ID, blockedListPos{}) }},
+		command{Name: "block", Description: "拉黑用户（ID 或 @用户名）", Role: operator, Handler: b.handleBlockCommand},
+		command{Name: "unblock", Description: "解除拉黑用户（ID 或 @用户名）", Role: operator, Handler: b.handleUnblockCommand},
+		command{Name: "whois", Description: "查看用户资料", Role: operator, Handler: b.handleWhois},
+		command{Name: "note", Description: "为用户添加备注", Role: operator, Handler: b.handleNote},
+		command{Name: "tag", Description: "为用户添加标签", Role: operator, Handler: b.handleTagCommand},
+		command{Name: "untag", Description: "移除用户的标签", Role: operator, Handler: b.handleUntagCommand},
+		command{Name: "vip", Description: "查看或标记 VIP 用户", Role: operator, Handler: b.handleVIP},
+		command{Name: "unvip", Description: "取消用户的 VIP", Role: operator, Handler: b.handleUnVIP},
+		command{Name: "order", Description: "创建、查看和修改用户的订单", Role: operator, Handler: b.handleOrder},
+		command{Name: "translate", Description: "查看或切换会话的自动翻译", Role: operator, Handler: b.handleTranslate},
+		command{Name: "tags", Description: "查看标签及带标签的用户", Role: operator, Handler: b.handleTags},
+		command{Name: "unreachable", Description: "查看屏蔽机器人的用户", Role: operator, Handler: b.handleUnreachable},
+		command{Name: "stats", Description: "查看用户统计", Role: operator, Handler: b.handleUserStats},
+		command{Name: "teamstats", Description: "查看客服回复与解决统计", Role: operator, Handler: b.handleTeamStats},
+		command{Name: "exportusers", Description: "导出所有用户为 CSV", Role: superAdmin, Handler: b.handleExportUsers},
+		command{Name: "importusers", Description: "从文件导入用户", Role: superAdmin, Handler: b.handleImportCommand(importUsers)},
+		command{Name: "importblocked", Description: "从文件导入黑名单", Role: superAdmin, Handler: b.handleImportCommand(importBlocked)},
+		command{Name: "backup", Description: "备份所有数据", Role: superAdmin, Handler: b.handleBackup},
+		command{Name: "restore", Description: "从备份文件恢复数据", Role: superAdmin, Handler: b.handleImportCommand(importRestore)},
+		command{Name: "cancelimport", Description: "取消等待上传的导入", Role: superAdmin, Handler: b.handleCancelImport},
+		command{Name: "banwords", Description: "管理违禁词", Role: superAdmin, Handler: b.handleBanwords},
+		command{Name: "drip", Description: "管理新用户的跟进消息", Role: superAdmin, Handler: b.handleDrip},
+		command{Name: "inactive", Description: "查看或清理长期不活跃的用户", Role: superAdmin, Handler: b.handleInactive},
+		command{Name: "recountstats", Description: "重建统计计数器", Role: superAdmin, Handler: chatOnly(b.handleRecountStats)},
+		command{Name: "status", Description: "查看运行状态", Role: operator, Handler: b.handleStatus},
+		command{Name: "selftest", Description: "自检转发与回复路由", Role: operator, Handler: b.handleSelfTest},
+		command{Name: "addtester", Description: "添加广播测试用户", Role: superAdmin, Handler: b.handleAddTester},
+		command{Name: "removetesters", Description: "移除广播测试用户", Role: superAdmin, Handler: b.handleRemoveTesters},
+		command{Name: "auditlog", Description: "查看管理员操作记录", Role: superAdmin, Handler: b.handleAuditLog},
+		command{Name: "admins", Description: "查看管理员列表", Role: operator, Handler: chatOnly(b.handleListAdmins)},
+		command{Name: "addadmin", Description: "添加管理员", Role: superAdmin, Handler: b.handleAddAdmin},
+		command{Name: "deladmin", Description: "移除管理员", Role: superAdmin, Handler: b.handleDelAdmin},
+	)
+
+	b.userCommands = newCommandRouter()
+	b.userCommands.register(
+		command{Name: "start", Description: "获取欢迎信息", Handler: b.handleUserStart},
+		command{Name: "help", Description: "查看可用命令", Handler: b.handleHelp},
+		command{Name: "stop", Description: "退订广播", Handler: b.handleUserStop},
+		command{Name: "cancel", Description: "取消当前操作", Handler: b.handleUserCancel},
+		command{Name: "resume", Description: "重新订阅广播", Handler: b.handleUserResume},
+		command{Name: "myorders", Description: "查看我的订单", Handler: b.handleUserOrders},
+	)
+}
+
+// commandsFor 返回 chatID 对应的用户可以使用的命令：管理员按角色过滤，其他用户为用户命令
+func (b *BotInstance) commandsFor(userID int64) []command {
+	if b.isAdmin(userID) {
+		return b.adminCommands.visible(func(cmd command) bool { return b.roleAllows(userID, cmd.Role) })
+	}
+	return b.userCommands.visible(func(command) bool { return true })
+}
+
+// handleHelp 列出发送者可以使用的命令
+func (b *BotInstance) handleHelp(msg *tgbotapi.Message) {
+	var sb strings.Builder
+	sb.WriteString("可用命令：\n")
+	for _, cmd := range b.commandsFor(msg.From.ID) {
+		sb.WriteString(fmt.Sprintf("/%s - %s\n", cmd.Name, cmd.Description))
+	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+}
+
+// handleAdminStart 处理管理员的 /start，带参数时打开对应的功能
+func (b *BotInstance) handleAdminStart(msg *tgbotapi.Message) {
+	b.setCommandsForUser(msg.Chat.ID)
+	if msg.CommandArguments() == autoreply.InlineStartParameter && b.commandAllowed(msg.From.ID, "setautoreply") {
+		// 从内联查询的“点此添加”按钮进入
+		b.autoreplyManager.StartSetAutoReplyProcess(msg.Chat.ID)
+		return
+	}
+	if id, ok := strings.CutPrefix(msg.CommandArguments(), ticketStartPrefix); ok {
+		// 从搜索结果中的工单链接进入
+		b.showTicket(msg.Chat.ID, cache.NormalizeTicketID(id))
+		return
+	}
+	b.welcomeManager.HandleStartCommand(msg.Chat.ID, msg.From.LanguageCode)
+}
+
+// handleWelcomeAction 处理 /welcomeaction：不带参数时列出动作，/welcomeaction <名称> 设置回复，/welcomeaction del <名称> 删除
+func (b *BotInstance) handleWelcomeAction(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	switch {
+	case len(args) == 0:
+		b.welcomeManager.ListActions(msg.Chat.ID)
+	case len(args) == 2 && args[0] == "del":
+		b.welcomeManager.DeleteAction(msg.Chat.ID, msg.From.ID, args[1])
+	case len(args) == 1:
+		b.welcomeManager.StartSetActionProcess(msg.Chat.ID, args[0])
+	default:
+		b.welcomeManager.ListActions(msg.Chat.ID)
+	}
+}
+
+// handleSetTopicWelcome 处理 /settopicwelcome <主题或来源>
+func (b *BotInstance) handleSetTopicWelcome(msg *tgbotapi.Message) {
+	topic := strings.TrimSpace(msg.CommandArguments())
+	if !startPayloadPattern.MatchString(topic) {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/settopicwelcome <主题或来源>\n只能包含字母、数字、下划线和连字符，例如：/settopicwelcome sales\n设置后通过 ?start=topic_sales 或 ?start=sales 进入的用户会收到该欢迎语"))
+		return
+	}
+	b.welcomeManager.StartSetTopicWelcomeProcess(msg.Chat.ID, topic)
+}
+
+// handleUserStart 处理用户的 /start：重新订阅广播，记录深度链接的来源和主题，并发送对应的欢迎语
+func (b *BotInstance) handleUserStart(msg *tgbotapi.Message) {
+	b.setCommandsForUser(msg.Chat.ID)
+	resubscribed, err := b.redisClient.RemoveBroadcastOptOut(context.Background(), msg.From.ID)
+	if err != nil {
+		log.Printf("用户 %d 重新订阅广播失败: %v", msg.From.ID, err)
+	} else if resubscribed {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已重新订阅广播。"))
+	}
+	source := parseStartSource(msg.CommandArguments())
+	if source != "" {
+		if _, err := b.redisClient.RecordUserSource(context.Background(), msg.From.ID, source); err != nil {
+			log.Printf("记录用户 %d 的来源 %s 失败: %v", msg.From.ID, source, err)
+		}
+	}
+	// 主题链接使用主题欢迎语，其他链接使用以完整参数命名的入口欢迎语
+	entry := source
+	topic := parseStartTopic(msg.CommandArguments())
+	if topic != "" {
+		entry = topic
+		if err := b.redisClient.SetUserTopic(context.Background(), msg.From.ID, topic); err != nil {
+			log.Printf("记录用户 %d 的主题 %s 失败: %v", msg.From.ID, topic, err)
+		}
+	}
+	b.welcomeManager.HandleTopicStart(msg.Chat.ID, entry, msg.From.LanguageCode)
+	b.enrollDrip(msg.From.ID)
+}
+
+// handleUserStop 处理用户的 /stop：退订广播
+func (b *BotInstance) handleUserStop(msg *tgbotapi.Message) {
+	if err := b.redisClient.AddBroadcastOptOut(context.Background(), msg.From.ID); err != nil {
+		log.Printf("用户 %d 退订广播失败: %v", msg.From.ID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 退订失败，请稍后再试。"))
+		return
+	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "已退订广播，客服功能不受影响。发送 /resume 可重新订阅。"))
+}
+
+// handleUserResume 处理用户的 /resume：重新订阅广播
+func (b *BotInstance) handleUserResume(msg *tgbotapi.Message) {
+	resubscribed, err := b.redisClient.RemoveBroadcastOptOut(context.Background(), msg.From.ID)
+	if err != nil {
+		log.Printf("用户 %d 重新订阅广播失败: %v", msg.From.ID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 重新订阅失败，请稍后再试。"))
+		return
+	}
+	if resubscribed {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已重新订阅广播。"))
+	} else {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "您当前已订阅广播，发送 /stop 可退订。"))
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/welcome"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// configWatchInterval 开启 CONFIG_WATCH 时检查配置文件是否修改的间隔
+const configWatchInterval = 5 * time.Second
+
+// configFile 是 CONFIG_FILE 指定的 YAML 配置文件
+type configFile struct {
+	Env    map[string]string `yaml:"env"`    // 环境变量，覆盖 .env 和进程环境中的同名变量
+	Texts  configTexts       `yaml:"texts"`  // 文案，保存到 Redis，与对应的管理命令等效
+	Routes *[]string         `yaml:"routes"` // 转发路由规则，格式同设置面板；设置后以文件为准
+}
+
+// configTexts 是配置文件中的文案，未出现的项保持不变
+type configTexts struct {
+	Welcome *string `yaml:"welcome"` // 默认欢迎语，同 /setwelcome
+	Away    *string `yaml:"away"`    // 非工作时间的离开消息，同 /setaway
+}
+
+// loadConfigFile 读取 CONFIG_FILE 指定的配置文件，未设置时返回 nil
+func loadConfigFile() (*configFile, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var cfg configFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	if cfg.Routes != nil {
+		for _, input := range *cfg.Routes {
+			if _, err := parseForwardRoute(input); err != nil {
+				return nil, fmt.Errorf("配置文件中的转发路由规则“%s”无效: %w", input, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// applyConfigEnv 将配置文件中的环境变量写入进程环境，之后读取配置的代码都会使用这些值
+func applyConfigEnv(cfg *configFile) {
+	if cfg == nil {
+		return
+	}
+	for name, value := range cfg.Env {
+		os.Setenv(strings.ToUpper(name), value)
+	}
+}
+
+// applyConfigData 将配置文件中的文案和转发路由规则保存到 Redis 并生效，返回修改了的项
+func (b *BotInstance) applyConfigData(cfg *configFile) ([]string, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	ctx := context.Background()
+	var changed []string
+	texts := []struct {
+		name  string
+		key   string
+		value *string
+	}{
+		{"欢迎语", welcome.ConfigWelcomeMessage, cfg.Texts.Welcome},
+		{"离开消息", ConfigAwayMessage, cfg.Texts.Away},
+	}
+	for _, text := range texts {
+		if text.value == nil {
+			continue
+		}
+		current, err := b.redisClient.GetConfigValue(ctx, text.key)
+		if err != nil {
+			return changed, fmt.Errorf("读取%s失败: %w", text.name, err)
+		}
+		if current == *text.value {
+			continue
+		}
+		if err := b.redisClient.SetConfigValue(ctx, text.key, *text.value); err != nil {
+			return changed, fmt.Errorf("保存%s失败: %w", text.name, err)
+		}
+		changed = append(changed, text.name)
+	}
+
+	if cfg.Routes != nil {
+		replaced, err := b.replaceForwardRoutes(*cfg.Routes)
+		if err != nil {
+			return changed, err
+		}
+		if replaced {
+			changed = append(changed, "转发路由规则")
+		}
+	}
+	return changed, nil
+}
+
+// replaceForwardRoutes 用配置文件中的规则替换现有的转发路由规则。规则相同时不做修改，
+// 以免重置规则 ID 和轮流分配的记录
+func (b *BotInstance) replaceForwardRoutes(inputs []string) (bool, error) {
+	routes := make([]forwardRoute, 0, len(inputs))
+	for _, input := range inputs {
+		route, err := parseForwardRoute(input)
+		if err != nil {
+			return false, fmt.Errorf("转发路由规则“%s”无效: %w", input, err)
+		}
+		routes = append(routes, route)
+	}
+	current := b.forwardRoutes()
+	if len(current) == len(routes) {
+		same := true
+		for i := range routes {
+			if current[i].Kind != routes[i].Kind || current[i].Value != routes[i].Value || !reflect.DeepEqual(current[i].Targets, routes[i].Targets) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false, nil
+		}
+	}
+
+	ctx := context.Background()
+	for _, route := range current {
+		if _, err := b.redisClient.DeleteForwardRoute(ctx, route.ID); err != nil {
+			return false, fmt.Errorf("删除转发路由规则 #%s 失败: %w", route.ID, err)
+		}
+	}
+	for _, route := range routes {
+		payload, err := json.Marshal(route)
+		if err != nil {
+			return false, err
+		}
+		if _, err := b.redisClient.AddForwardRoute(ctx, string(payload)); err != nil {
+			return false, fmt.Errorf("保存转发路由规则失败: %w", err)
+		}
+	}
+	return true, b.loadForwardRoutes()
+}
+
+// reloadConfig 重新读取配置文件并立即生效：管理员、/settings 中各项的默认值、文案和转发路由规则。
+// Bot Token、Redis、Webhook、代理、日志和并发数等启动时使用的配置需重启后生效
+func (b *BotInstance) reloadConfig() ([]string, error) {
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("未设置 CONFIG_FILE")
+	}
+	applyConfigEnv(cfg)
+
+	b.reloadConfiguredAdmins()
+	env := loadEnvSettings()
+	b.settingsMu.Lock()
+	b.envSettings = env
+	routes := b.settings.Routes
+	b.settings = env
+	b.settings.Routes = routes
+	b.settingsMu.Unlock()
+	// /settings 中保存的值仍然优先于配置文件
+	b.loadStoredSettings()
+
+	return b.applyConfigData(cfg)
+}
+
+// reloadConfiguredAdmins 按 ADMIN_IDS 重新确定超级管理员，通过 /addadmin 添加的管理员保持不变
+func (b *BotInstance) reloadConfiguredAdmins() {
+	configured, invalid := parseAdminIDs(os.Getenv("ADMIN_IDS"))
+	if len(invalid) > 0 {
+		log.Printf("警告：ADMIN_IDS 中以下条目无效，已忽略: %v", invalid)
+	}
+	extra, err := b.redisClient.GetAdminIDs(context.Background())
+	if err != nil {
+		// 无法确认时保留现有管理员，避免误删
+		log.Printf("读取 Redis 中的管理员失败，保留现有管理员: %v", err)
+		return
+	}
+	adminIDs := make(map[int64]bool, len(configured)+len(extra))
+	for id := range configured {
+		adminIDs[id] = true
+	}
+	for _, id := range extra {
+		adminIDs[id] = true
+	}
+	b.adminMu.Lock()
+	b.adminIDs = adminIDs
+	b.superAdminIDs = configured
+	b.adminMu.Unlock()
+}
+
+// handleReloadConfig 处理 /reloadconfig：重新读取配置文件
+func (b *BotInstance) handleReloadConfig(msg *tgbotapi.Message) {
+	changed, err := b.reloadConfig()
+	if err != nil {
+		log.Printf("重新加载配置失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 重新加载配置失败："+err.Error()))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditSettings, "重新加载配置文件")
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 配置已重新加载。"+describeConfigChanges(changed)+
+		"\nBot Token、Redis、Webhook、代理、日志和并发数等启动配置需重启后生效。"))
+}
+
+// describeConfigChanges 描述重新加载时修改了的文案和规则
+func describeConfigChanges(changed []string) string {
+	if len(changed) == 0 {
+		return ""
+	}
+	return "\n已更新：" + strings.Join(changed, "、")
+}
+
+// StartConfigWatcher 在设置 CONFIG_WATCH=1 时定期检查配置文件，修改后自动重新加载
+func (b *BotInstance) StartConfigWatcher() {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" || os.Getenv("CONFIG_WATCH") != "1" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("无法监视配置文件 %s: %v", path, err)
+		return
+	}
+	lastMod := info.ModTime()
+	log.Printf("正在监视配置文件 %s，修改后自动重新加载", path)
+	go func() {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			changed, err := b.reloadConfig()
+			if err != nil {
+				log.Printf("自动重新加载配置失败: %v", err)
+				b.alert("config_reload", "⚠️ 配置文件已修改，但重新加载失败："+err.Error())
+				continue
+			}
+			log.Printf("配置文件已修改，已自动重新加载%s", describeConfigChanges(changed))
+		}
+	}()
+}
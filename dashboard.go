@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/broadcast"
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+//go:embed web/dashboard.html
+var dashboardPage []byte
+
+const (
+	dashboardCookie         = "kefu_dashboard"
+	dashboardMinTokenLength = 16
+	dashboardPageSize       = 50  // 会话和用户列表每页的人数
+	dashboardHistoryLimit   = 100 // 会话详情显示的消息条数
+	dashboardSearchLimit    = 50  // 搜索用户最多返回的人数
+	dashboardSearchPageSize = 500 // 搜索时每次读取的用户数
+	dashboardMaxBody        = 64 << 10
+)
+
+// dashboardConfig 是网页后台的配置，未设置 DASHBOARD_ADDR 时为 nil
+type dashboardConfig struct {
+	ListenAddr string
+	Token      string
+}
+
+// loadDashboardConfig 读取 DASHBOARD_ADDR 和 DASHBOARD_TOKEN，未设置 DASHBOARD_ADDR 时返回 nil
+func loadDashboardConfig() (*dashboardConfig, error) {
+	addr := os.Getenv("DASHBOARD_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	token := os.Getenv("DASHBOARD_TOKEN")
+	if len(token) < dashboardMinTokenLength {
+		return nil, fmt.Errorf("启用网页后台时 DASHBOARD_TOKEN 至少需要 %d 个字符", dashboardMinTokenLength)
+	}
+	if webhook, _ := loadWebhookConfig(); webhook != nil && webhook.ListenAddr == addr {
+		return nil, fmt.Errorf("DASHBOARD_ADDR 不能与 Webhook 的监听地址 %s 相同", addr)
+	}
+	return &dashboardConfig{ListenAddr: addr, Token: token}, nil
+}
+
+// sessionValue 是登录后保存在 Cookie 中的值，不直接保存令牌
+func (cfg *dashboardConfig) sessionValue() string {
+	sum := sha256.Sum256([]byte("kefu-dashboard:" + cfg.Token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authorized 检查请求是否携带有效的 Cookie 或 Authorization: Bearer 令牌
+func (cfg *dashboardConfig) authorized(r *http.Request) bool {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(cfg.Token)) == 1
+	}
+	cookie, err := r.Cookie(dashboardCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(cfg.sessionValue())) == 1
+}
+
+// StartDashboard 在设置 DASHBOARD_ADDR 时启动网页后台
+func (b *BotInstance) StartDashboard() {
+	cfg, err := loadDashboardConfig()
+	if err != nil {
+		log.Printf("警告：%v，不启动网页后台", err)
+		return
+	}
+	if cfg == nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Write(dashboardPage)
+	})
+	mux.HandleFunc("/api/login", b.dashboardLogin(cfg))
+	mux.HandleFunc("/api/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: dashboardCookie, Path: "/", MaxAge: -1})
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	})
+	api := map[string]http.HandlerFunc{
+		"/api/conversations": b.dashboardConversations,
+		"/api/history":       b.dashboardHistory,
+		"/api/reply":         b.dashboardReply,
+		"/api/users":         b.dashboardUsers,
+		"/api/tags":          b.dashboardTags,
+		"/api/broadcast":     b.dashboardBroadcast,
+		"/api/stats":         b.dashboardStats,
+	}
+	for path, handler := range api {
+		handler := handler
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if !cfg.authorized(r) {
+				writeJSONError(w, http.StatusUnauthorized, "未登录")
+				return
+			}
+			handler(w, r)
+		})
+	}
+
+	go func() {
+		log.Printf("网页后台监听 %s", cfg.ListenAddr)
+		if err := http.ListenAndServe(cfg.ListenAddr, mux); err != nil {
+			log.Printf("网页后台已停止: %v", err)
+			b.alert("dashboard", "⚠️ 网页后台已停止："+err.Error())
+		}
+	}()
+}
+
+// dashboardLogin 校验令牌并设置登录 Cookie。令牌错误时延迟响应，减缓暴力猜测
+func (b *BotInstance) dashboardLogin(cfg *dashboardConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(req.Token), []byte(cfg.Token)) != 1 {
+			log.Printf("网页后台登录失败，来自 %s", r.RemoteAddr)
+			time.Sleep(time.Second)
+			writeJSONError(w, http.StatusUnauthorized, "令牌错误")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     dashboardCookie,
+			Value:    cfg.sessionValue(),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteStrictMode,
+			MaxAge:   int((30 * 24 * time.Hour).Seconds()),
+		})
+		log.Printf("网页后台登录成功，来自 %s", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}
+}
+
+// readJSON 解析 POST 请求的 JSON 请求体，失败时写入错误响应并返回 false。
+// 要求 Content-Type 为 application/json，使跨站表单无法伪造请求
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "只支持 POST")
+		return false
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "请求体必须是 JSON")
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, dashboardMaxBody)).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的请求: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("写入网页后台响应失败: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// dashboardActor 返回网页后台操作记录在其名下的管理员：ID 最小的超级管理员。
+// 网页后台发起的回复计入该管理员的统计，广播进度也发送给该管理员
+func (b *BotInstance) dashboardActor() int64 {
+	for _, id := range b.adminIDList() {
+		if b.isSuperAdmin(id) {
+			return id
+		}
+	}
+	return 0
+}
+
+// dashboardUser 是网页后台显示的用户
+type dashboardUser struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Username   string   `json:"username,omitempty"`
+	FirstSeen  int64    `json:"first_seen,omitempty"`
+	LastActive int64    `json:"last_active,omitempty"`
+	Blocked    bool     `json:"blocked"`
+	VIP        bool     `json:"vip"`
+	Tags       []string `json:"tags"`
+	WaitingFor int64    `json:"waiting_since,omitempty"` // 等待客服回复的开始时间，未在等待时为 0
+	Snippet    string   `json:"snippet,omitempty"`       // 最后一条消息的摘要
+}
+
+// dashboardUsersFor 读取一批用户的资料，保持 userIDs 的顺序
+func (b *BotInstance) dashboardUsersFor(ctx context.Context, userIDs []string) ([]dashboardUser, error) {
+	records, err := b.redisClient.GetUserRecords(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]dashboardUser, 0, len(records))
+	for _, record := range records {
+		users = append(users, b.dashboardUserFrom(record))
+	}
+	return users, nil
+}
+
+func (b *BotInstance) dashboardUserFrom(record cache.UserRecord) dashboardUser {
+	p := record.Profile
+	user := dashboardUser{
+		ID:       record.UserID,
+		Name:     strings.TrimSpace(p.FirstName + " " + p.LastName),
+		Username: p.Username,
+		Blocked:  record.Blocked,
+		VIP:      b.isVIP(record.UserID),
+		Tags:     record.Tags,
+	}
+	if user.Tags == nil {
+		user.Tags = []string{}
+	}
+	if !p.FirstSeen.IsZero() {
+		user.FirstSeen = p.FirstSeen.Unix()
+	}
+	if !p.LastActive.IsZero() {
+		user.LastActive = p.LastActive.Unix()
+	}
+	return user
+}
+
+// dashboardConversations 返回等待回复的会话（等待最久的在前）和最近活跃的会话
+func (b *BotInstance) dashboardConversations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	waiting, total, err := b.redisClient.GetResponseWaiting(ctx, 0, dashboardPageSize)
+	if err != nil {
+		log.Printf("网页后台获取待回复列表失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取待回复列表失败")
+		return
+	}
+	since := make(map[int64]int64, len(waiting))
+	ids := make([]string, 0, len(waiting)+dashboardPageSize)
+	for _, item := range waiting {
+		since[item.UserID] = item.Since.Unix()
+		ids = append(ids, strconv.FormatInt(item.UserID, 10))
+	}
+	recent, _, err := b.redisClient.GetRecentUserIDs(ctx, 0, dashboardPageSize)
+	if err != nil {
+		log.Printf("网页后台获取最近活跃用户失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取最近活跃用户失败")
+		return
+	}
+	for _, id := range recent {
+		if userID, _ := strconv.ParseInt(id, 10, 64); since[userID] == 0 {
+			ids = append(ids, id)
+		}
+	}
+
+	users, err := b.dashboardUsersFor(ctx, ids)
+	if err != nil {
+		log.Printf("网页后台获取用户资料失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取用户资料失败")
+		return
+	}
+	for i := range users {
+		users[i].WaitingFor = since[users[i].ID]
+		if entries, err := b.redisClient.GetHistory(ctx, users[i].ID, 1); err == nil && len(entries) > 0 {
+			users[i].Snippet = truncateRunes(entries[0].Text, inboxSnippetLength)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"waiting_total": total, "conversations": users})
+}
+
+// dashboardHistory 返回与用户的对话记录，按时间从旧到新排列
+func (b *BotInstance) dashboardHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user"), 10, 64)
+	if err != nil || userID == 0 {
+		writeJSONError(w, http.StatusBadRequest, "无效的用户 ID")
+		return
+	}
+	ctx := r.Context()
+	entries, err := b.redisClient.GetHistory(ctx, userID, dashboardHistoryLimit)
+	if err != nil {
+		log.Printf("网页后台获取用户 %d 的对话记录失败: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "获取对话记录失败")
+		return
+	}
+	if entries == nil {
+		entries = []cache.HistoryEntry{}
+	}
+	users, err := b.dashboardUsersFor(ctx, []string{strconv.FormatInt(userID, 10)})
+	if err != nil || len(users) == 0 {
+		users = []dashboardUser{{ID: userID, Tags: []string{}}}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user": users[0], "messages": entries})
+}
+
+// dashboardReply 以文字回复用户，与在 Telegram 中回复一样记录到工单和对话记录
+func (b *BotInstance) dashboardReply(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID int64  `json:"user_id"`
+		Text   string `json:"text"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.UserID == 0 || req.Text == "" {
+		writeJSONError(w, http.StatusBadRequest, "用户和回复内容不能为空")
+		return
+	}
+	actor := b.dashboardActor()
+	if actor == 0 {
+		writeJSONError(w, http.StatusServiceUnavailable, "未配置超级管理员，无法回复")
+		return
+	}
+	text, translatedTo := b.translateOutbound(req.UserID, req.Text)
+	sent, err := b.API.Send(tgbotapi.NewMessage(req.UserID, text))
+	if err != nil {
+		failure := classifySendError(err)
+		log.Printf("网页后台回复用户 %d 失败（原因：%s）: %v", req.UserID, failure, err)
+		writeJSONError(w, http.StatusBadGateway, "发送失败："+failure.String())
+		return
+	}
+	b.recordAdminReply(&tgbotapi.User{ID: actor, FirstName: "网页后台"}, req.UserID, &sent)
+	log.Printf("网页后台回复了用户 %d", req.UserID)
+	writeJSON(w, http.StatusOK, map[string]string{"translated_to": translatedTo})
+}
+
+// dashboardUsers 按最后活跃时间分页列出用户；带 q 参数时按 ID、用户名或昵称搜索
+func (b *BotInstance) dashboardUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@"))
+	if query != "" {
+		users, err := b.searchDashboardUsers(ctx, query)
+		if err != nil {
+			log.Printf("网页后台搜索用户失败: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "搜索用户失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"total": len(users), "users": users})
+		return
+	}
+
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	ids, total, err := b.redisClient.GetRecentUserIDs(ctx, max(offset, 0), dashboardPageSize)
+	if err != nil {
+		log.Printf("网页后台获取用户列表失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取用户列表失败")
+		return
+	}
+	users, err := b.dashboardUsersFor(ctx, ids)
+	if err != nil {
+		log.Printf("网页后台获取用户资料失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取用户资料失败")
+		return
+	}
+	if users == nil {
+		users = []dashboardUser{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total": total, "offset": offset, "users": users})
+}
+
+// searchDashboardUsers 分页遍历全部用户，返回 ID、用户名或昵称包含 query 的用户，最多 dashboardSearchLimit 位
+func (b *BotInstance) searchDashboardUsers(ctx context.Context, query string) ([]dashboardUser, error) {
+	users := []dashboardUser{}
+	var pageErr error
+	err := b.redisClient.EachUserIDPage(ctx, cache.UsersSetKey, dashboardSearchPageSize, func(ids []string) bool {
+		records, err := b.redisClient.GetUserRecords(ctx, ids)
+		if err != nil {
+			pageErr = err
+			return false
+		}
+		for _, record := range records {
+			p := record.Profile
+			fields := []string{strconv.FormatInt(record.UserID, 10), p.Username, p.FirstName + " " + p.LastName}
+			for _, field := range fields {
+				if strings.Contains(strings.ToLower(field), query) {
+					users = append(users, b.dashboardUserFrom(record))
+					break
+				}
+			}
+			if len(users) >= dashboardSearchLimit {
+				return false
+			}
+		}
+		return ctx.Err() == nil
+	})
+	if err == nil {
+		err = pageErr
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].LastActive > users[j].LastActive })
+	return users, err
+}
+
+// dashboardTags 返回所有标签及人数，供广播选择接收范围
+func (b *BotInstance) dashboardTags(w http.ResponseWriter, r *http.Request) {
+	counts, err := b.redisClient.GetTagCounts(r.Context())
+	if err != nil {
+		log.Printf("网页后台获取标签失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取标签失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, counts)
+}
+
+// dashboardBroadcast 立即发送文字广播，接收范围为全部用户或带某个标签的用户
+func (b *BotInstance) dashboardBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text    string `json:"text"`
+		Tag     string `json:"tag"`
+		Silent  bool   `json:"silent"`
+		Protect bool   `json:"protect"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	actor := b.dashboardActor()
+	if actor == 0 {
+		writeJSONError(w, http.StatusServiceUnavailable, "未配置超级管理员，无法接收广播进度")
+		return
+	}
+	msg := broadcast.Message{Text: strings.TrimSpace(req.Text), Silent: req.Silent, Protect: req.Protect}
+	if req.Tag != "" {
+		tag := cache.NormalizeTag(req.Tag)
+		if tag == "" {
+			writeJSONError(w, http.StatusBadRequest, "无效的标签")
+			return
+		}
+		msg.Target = broadcast.AudienceTagPrefix + tag
+	}
+	id, err := b.broadcastManager.SendBroadcast(actor, actor, msg, "网页后台")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("网页后台发起了广播 %s", id)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+// dashboardStats 返回用户总数等计数，以及最近 statsChartDays 天每天的统计
+func (b *BotInstance) dashboardStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	counters, err := b.redisClient.GetStatsCounters(ctx)
+	if err != nil {
+		log.Printf("网页后台获取统计失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取统计失败")
+		return
+	}
+	dates, stats, err := b.dailyStatsRange(ctx, statsChartDays)
+	if err != nil {
+		log.Printf("网页后台获取每日统计失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "获取每日统计失败")
+		return
+	}
+	type day struct {
+		Date  string           `json:"date"`
+		Stats map[string]int64 `json:"stats"`
+	}
+	days := make([]day, len(dates))
+	for i := range dates {
+		days[i] = day{Date: dates[i].Format("01-02"), Stats: stats[i]}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"total":       counters.Total,
+		"blocked":     counters.Blocked,
+		"opt_out":     counters.OptOut,
+		"unreachable": counters.Unreachable,
+		"labels":      dailyStatLabels,
+		"days":        days,
+	})
+}
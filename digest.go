@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// digestMaxTextLength 是汇总消息中文字部分的最大字符数，需低于 Telegram 单条消息 4096 字符的上限
+const digestMaxTextLength = 3500
+
+// loadDigestConfig 从 DIGEST_SECONDS 读取汇总转发的等待时间，未设置或为 0 时逐条转发
+func loadDigestConfig() time.Duration {
+	secondsStr := os.Getenv("DIGEST_SECONDS")
+	if secondsStr == "" {
+		return 0
+	}
+	seconds, err := parseDigestSetting(secondsStr)
+	if err != nil {
+		log.Printf("警告：DIGEST_SECONDS 无效（%s），逐条转发用户消息", secondsStr)
+		return 0
+	}
+	return seconds
+}
+
+// parseDigestSetting 解析汇总等待的秒数，0 表示关闭汇总
+func parseDigestSetting(value string) (time.Duration, error) {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds < 0 || seconds > 3600 {
+		return 0, fmt.Errorf("等待秒数必须是 0 到 3600 之间的整数")
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func describeDigest(wait time.Duration) string {
+	if wait == 0 {
+		return "关闭（逐条转发）"
+	}
+	return fmt.Sprintf("每位用户 %d 秒内的消息合并转发", int(wait.Seconds()))
+}
+
+// digestSettings 返回当前的汇总等待时间，为 0 时不汇总
+func (b *BotInstance) digestSettings() time.Duration {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings.Digest
+}
+
+// digestCheckInterval 是检查汇总转发时间的间隔
+const digestCheckInterval = time.Second
+
+// addDigest 将用户消息加入等待汇总转发的一批，返回 true 表示这是一批的第一条。
+// 一批消息保存在 Redis 中，重启后仍会转发；转发目标和转发时间以第一条消息为准
+func (b *BotInstance) addDigest(msg *tgbotapi.Message, target int64, wait time.Duration) (bool, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return false, err
+	}
+	return b.redisClient.AddDigestMessage(context.Background(), msg.From.ID, target, string(payload), time.Now().Add(wait))
+}
+
+// StartDigestScheduler 定期检查已到转发时间的汇总，交给该用户的工作协程转发，
+// 与该用户的新消息按顺序处理。需在工作池启动后调用
+func (b *BotInstance) StartDigestScheduler() {
+	go func() {
+		ticker := time.NewTicker(digestCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			users, err := b.redisClient.GetDueDigests(context.Background(), time.Now())
+			if err != nil {
+				log.Printf("获取待转发的消息汇总失败: %v", err)
+				continue
+			}
+			for _, userID := range users {
+				userID := userID
+				if !b.updatePool.run(userID, func() { b.flushDigest(userID) }) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// flushDigest 转发用户已到时间的一批消息，转发后从 Redis 中删除。
+// 同一批可能被重复安排，已转发或尚未到时间时不做任何事
+func (b *BotInstance) flushDigest(userID int64) {
+	ctx := context.Background()
+	target, payloads, err := b.redisClient.GetDigest(ctx, userID, time.Now())
+	if err != nil {
+		log.Printf("读取用户 %d 的消息汇总失败: %v", userID, err)
+		return
+	}
+	if len(payloads) == 0 {
+		return
+	}
+	msgs := make([]*tgbotapi.Message, 0, len(payloads))
+	for _, payload := range payloads {
+		var msg tgbotapi.Message
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.From == nil || msg.Chat == nil {
+			log.Printf("解析用户 %d 的汇总消息失败: %v", userID, err)
+			continue
+		}
+		msgs = append(msgs, &msg)
+	}
+	if len(msgs) > 0 && target != 0 {
+		b.forwardDigest(target, msgs)
+	}
+	if err := b.redisClient.ClearDigest(ctx, userID, len(payloads)); err != nil {
+		log.Printf("清除用户 %d 的消息汇总失败: %v", userID, err)
+	}
+}
+
+// forwardDigest 将一位用户的一批消息合并为一条汇总转发给管理员：文字消息直接写入汇总，
+// 其他消息在汇总中标注类型后原样复制到汇总下方，管理员回复汇总或其中任一消息都会发给该用户
+func (b *BotInstance) forwardDigest(target int64, msgs []*tgbotapi.Message) {
+	first, last := msgs[0], msgs[len(msgs)-1]
+
+	var sb strings.Builder
+	var texts, media []*tgbotapi.Message
+	for _, msg := range msgs {
+		line := msg.Text
+		if messageType(msg) != "text" {
+			line = messageSummary(msg)
+			media = append(media, msg)
+		} else {
+			texts = append(texts, msg)
+		}
+		sb.WriteString(fmt.Sprintf("%s %s\n", time.Unix(int64(msg.Date), 0).Format("15:04:05"), line))
+	}
+	body := truncateRunes(strings.TrimSpace(sb.String()), digestMaxTextLength)
+
+	headerID, headerText, err := b.sendForwardHeader(target, last, "\n\n"+
+		escapeMarkdownV2(fmt.Sprintf("[汇总，共 %d 条消息]\n%s", len(msgs), body)))
+	if err != nil {
+		failure := classifySendError(err)
+		log.Printf("发送用户 %d 的消息汇总给管理员失败（原因：%s）: %v", first.From.ID, failure, err)
+		b.emailUndelivered(failure, msgs...)
+		b.API.Send(tgbotapi.NewMessage(first.Chat.ID, userAckText(failure)))
+		return
+	}
+	// 文字消息写在汇总中，重复标注和译文都附在汇总上
+	for _, msg := range texts {
+		b.rememberRepeatHeader(msg, target, headerID, headerText)
+		b.translateInbound(msg, target, headerID)
+	}
+	for _, msg := range media {
+		if err := b.copyToAdmin(target, headerID, msg); err != nil {
+			log.Printf("复制用户 %d 的消息到汇总失败（原因：%s）: %v", msg.From.ID, classifySendError(err), err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	dripCheckInterval = time.Minute
+	// dripEnrollWindow 首次联系后多久内 /start 的用户视为新用户，开始发送跟进消息
+	dripEnrollWindow = 10 * time.Minute
+)
+
+// dripStep 是跟进消息序列中的一步：用户首次 /start 后经过 Delay 发送 Text
+type dripStep struct {
+	ID    string        `json:"-"`
+	Delay time.Duration `json:"delay"`
+	Text  string        `json:"text"`
+}
+
+// delaySeconds 返回步骤的延迟秒数，用作用户进度
+func (s dripStep) delaySeconds() int64 {
+	return int64(s.Delay / time.Second)
+}
+
+// parseDripDelay 解析跟进延迟，格式为数字加单位 m（分钟）、h（小时）或 d（天），例如 30m、1h、3d
+func parseDripDelay(input string) (time.Duration, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	units := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour}
+	if len(input) < 2 {
+		return 0, fmt.Errorf("无效的延迟：%s", input)
+	}
+	unit, ok := units[input[len(input)-1]]
+	n, err := strconv.Atoi(input[:len(input)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("无效的延迟：%s，应为数字加 m、h 或 d，例如 30m、1h、3d", input)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatDripDelay 将延迟格式化为“x 天”“x 小时”或“x 分钟”
+func formatDripDelay(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d 天", int(d/(24*time.Hour)))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d 小时", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%d 分钟", int(d/time.Minute))
+}
+
+// loadDripSteps 从 Redis 读取跟进消息步骤，按延迟从短到长排列
+func (b *BotInstance) loadDripSteps(ctx context.Context) ([]dripStep, error) {
+	payloads, err := b.redisClient.GetDripSteps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]dripStep, 0, len(payloads))
+	for id, payload := range payloads {
+		var step dripStep
+		if err := json.Unmarshal([]byte(payload), &step); err != nil || step.Text == "" {
+			log.Printf("忽略无效的跟进消息步骤 %s: %v", id, err)
+			continue
+		}
+		step.ID = id
+		steps = append(steps, step)
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Delay < steps[j].Delay })
+	return steps, nil
+}
+
+// nextDripStep 返回延迟长于 lastDelay 秒的第一个步骤，没有时 ok 为 false。
+// 进度按延迟而不是序号记录，增删步骤后用户不会重复收到或跳过已有的步骤
+func nextDripStep(steps []dripStep, lastDelay int64) (dripStep, bool) {
+	for _, step := range steps {
+		if step.delaySeconds() > lastDelay {
+			return step, true
+		}
+	}
+	return dripStep{}, false
+}
+
+// enrollDrip 新用户首次 /start 时开始发送跟进消息。只有首次联系在 dripEnrollWindow 内的用户才会开始，
+// 设置跟进消息前就已联系过的老用户再次 /start 时不会收到；已开始过的用户不会重新开始
+func (b *BotInstance) enrollDrip(userID int64) {
+	ctx := context.Background()
+	profile, ok, err := b.redisClient.GetUserProfile(ctx, userID)
+	if err != nil {
+		log.Printf("读取用户 %d 的资料失败: %v", userID, err)
+		return
+	}
+	if !ok || profile.FirstSeen.IsZero() || time.Since(profile.FirstSeen) > dripEnrollWindow {
+		return
+	}
+	steps, err := b.loadDripSteps(ctx)
+	if err != nil {
+		log.Printf("读取跟进消息步骤失败: %v", err)
+		return
+	}
+	if len(steps) == 0 {
+		return
+	}
+	now := time.Now()
+	if _, err := b.redisClient.StartDrip(ctx, userID, now, now.Add(steps[0].Delay)); err != nil {
+		log.Printf("为用户 %d 安排跟进消息失败: %v", userID, err)
+	}
+}
+
+// stopDrip 停止向用户发送后续的跟进消息
+func (b *BotInstance) stopDrip(userID int64) {
+	stopped, err := b.redisClient.StopDrip(context.Background(), userID)
+	if err != nil {
+		log.Printf("停止用户 %d 的跟进消息失败: %v", userID, err)
+	} else if stopped {
+		log.Printf("已停止用户 %d 的跟进消息", userID)
+	}
+}
+
+// StartDripScheduler 启动后台检查，定期发送已到时间的跟进消息
+func (b *BotInstance) StartDripScheduler() {
+	go func() {
+		ticker := time.NewTicker(dripCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.sendDueDrips(time.Now())
+		}
+	}()
+}
+
+// sendDueDrips 向下一条跟进消息已到时间的用户发送该消息，并安排后续步骤。
+// 已拉黑、已退订广播或屏蔽了机器人的用户停止跟进
+func (b *BotInstance) sendDueDrips(now time.Time) {
+	ctx := context.Background()
+	due, err := b.redisClient.GetDueDrips(ctx, now)
+	if err != nil {
+		log.Printf("获取待发送的跟进消息失败: %v", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+	steps, err := b.loadDripSteps(ctx)
+	if err != nil {
+		log.Printf("读取跟进消息步骤失败: %v", err)
+		return
+	}
+	for _, item := range due {
+		step, ok := nextDripStep(steps, item.LastDelay)
+		if !ok {
+			b.advanceDrip(ctx, item.UserID, item.LastDelay, time.Time{})
+			continue
+		}
+		if sendAt := item.StartedAt.Add(step.Delay); sendAt.After(now) {
+			// 步骤被删除或修改后，按现有步骤重新安排发送时间
+			b.advanceDrip(ctx, item.UserID, item.LastDelay, sendAt)
+			continue
+		}
+		blocked, _ := b.redisClient.IsUserBlocked(ctx, item.UserID)
+		optedOut, _ := b.redisClient.IsBroadcastOptedOut(ctx, item.UserID)
+		if blocked || optedOut {
+			b.stopDrip(item.UserID)
+			continue
+		}
+
+		sent, err := b.API.Send(tgbotapi.NewMessage(item.UserID, step.Text))
+		if err != nil {
+			failure := classifySendError(err)
+			log.Printf("发送跟进消息 #%s 给用户 %d 失败（原因：%s）: %v", step.ID, item.UserID, failure, err)
+			if failure == sendFailureBlocked || failure == sendFailureChatNotFound {
+				b.stopDrip(item.UserID)
+			}
+			continue
+		}
+		b.recordHistory(item.UserID, cache.HistoryOutbound, "跟进消息", &sent)
+
+		var next time.Time
+		if following, ok := nextDripStep(steps, step.delaySeconds()); ok {
+			next = item.StartedAt.Add(following.Delay)
+		}
+		b.advanceDrip(ctx, item.UserID, step.delaySeconds(), next)
+	}
+}
+
+// advanceDrip 记录用户的跟进进度，next 为零值时停止跟进
+func (b *BotInstance) advanceDrip(ctx context.Context, userID, delay int64, next time.Time) {
+	if err := b.redisClient.AdvanceDrip(ctx, userID, delay, next); err != nil {
+		log.Printf("更新用户 %d 的跟进进度失败: %v", userID, err)
+	}
+}
+
+const dripUsage = "用法：\n" +
+	"/drip —— 查看跟进消息\n" +
+	"/drip add <延迟> <内容> —— 添加跟进消息，延迟从用户首次 /start 起计算，例如 /drip add 1h 使用小贴士…、/drip add 3d 限时优惠…\n" +
+	"/drip del <编号> —— 删除跟进消息\n\n" +
+	"用户发来任何消息后停止向其发送后续的跟进消息。"
+
+// handleDrip 处理 /drip：查看、添加或删除跟进消息
+func (b *BotInstance) handleDrip(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	args := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 3)
+	switch args[0] {
+	case "":
+		steps, err := b.loadDripSteps(ctx)
+		if err != nil {
+			log.Printf("读取跟进消息步骤失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 读取跟进消息失败。"))
+			return
+		}
+		var sb strings.Builder
+		if len(steps) == 0 {
+			sb.WriteString("当前没有跟进消息。\n")
+		} else {
+			sb.WriteString("跟进消息（从用户首次 /start 起计算）：\n")
+			for _, step := range steps {
+				sb.WriteString(fmt.Sprintf("#%s +%s：%s\n", step.ID, formatDripDelay(step.Delay), truncateRunes(step.Text, 60)))
+			}
+			if active, err := b.redisClient.CountActiveDrips(ctx); err == nil {
+				sb.WriteString(fmt.Sprintf("\n正在跟进的用户：%d 位\n", active))
+			}
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()+"\n"+dripUsage))
+	case "add":
+		if len(args) < 3 || strings.TrimSpace(args[2]) == "" {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, dripUsage))
+			return
+		}
+		delay, err := parseDripDelay(args[1])
+		if err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+			return
+		}
+		payload, err := json.Marshal(dripStep{Delay: delay, Text: strings.TrimSpace(args[2])})
+		if err != nil {
+			log.Printf("序列化跟进消息失败: %v", err)
+			return
+		}
+		id, err := b.redisClient.AddDripStep(ctx, string(payload))
+		if err != nil {
+			log.Printf("保存跟进消息失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 保存跟进消息失败，请稍后再试。"))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditSettings, fmt.Sprintf("添加跟进消息 #%s（+%s）", id, formatDripDelay(delay)))
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已添加跟进消息 #%s，新用户首次 /start 后 %s发送。", id, formatDripDelay(delay))))
+	case "del":
+		if len(args) < 2 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, dripUsage))
+			return
+		}
+		id := strings.TrimPrefix(strings.TrimSpace(args[1]), "#")
+		removed, err := b.redisClient.DeleteDripStep(ctx, id)
+		if err != nil {
+			log.Printf("删除跟进消息 %s 失败: %v", id, err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 删除跟进消息失败，请稍后再试。"))
+			return
+		}
+		if !removed {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("找不到跟进消息 #%s。", id)))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditSettings, "删除跟进消息 #"+id)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已删除跟进消息 #%s。", id)))
+	default:
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, dripUsage))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxEditQuoteLength 编辑通知中原内容和新内容各自最多显示的字符数
+const maxEditQuoteLength = 1500
+
+// messageText 返回消息的文字内容：文本消息的文本或媒体消息的标题
+func messageText(msg *tgbotapi.Message) string {
+	if msg.Text != "" {
+		return msg.Text
+	}
+	return msg.Caption
+}
+
+// linkMessage 记录会话 chatID 中内容为 text 的消息 messageID 与另一侧会话 targetChatID 中的消息 targetMessageID 相对应，供之后同步编辑
+func (b *BotInstance) linkMessage(chatID int64, messageID int, targetChatID int64, targetMessageID int, text string) {
+	link := cache.MessageLink{ChatID: targetChatID, MessageID: targetMessageID, Text: text}
+	if err := b.redisClient.SaveMessageLink(context.Background(), chatID, messageID, link); err != nil {
+		log.Printf("保存消息 %d:%d 的对应关系失败: %v", chatID, messageID, err)
+	}
+}
+
+// handleEditedMessage 处理消息编辑：用户编辑消息时通知客服，客服编辑回复时同步修改已送达用户的消息
+func (b *BotInstance) handleEditedMessage(msg *tgbotapi.Message) {
+	if msg.From == nil {
+		return
+	}
+	if b.isAdmin(msg.From.ID) {
+		if b.isForwardTarget(msg.Chat.ID) {
+			b.syncAdminEdit(msg)
+		}
+		return
+	}
+	if msg.Chat.IsPrivate() {
+		b.notifyUserEdit(msg)
+	}
+}
+
+// notifyUserEdit 在转发给客服的副本下回复一条编辑通知，显示编辑前后的内容
+func (b *BotInstance) notifyUserEdit(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	link, ok, err := b.redisClient.GetMessageLink(ctx, msg.Chat.ID, msg.MessageID)
+	if err != nil {
+		log.Printf("查询用户 %d 消息 %d 的转发副本失败: %v", msg.From.ID, msg.MessageID, err)
+		return
+	}
+	if !ok {
+		return // 消息未转发给客服（例如命中了自动回复）或已过期
+	}
+
+	newText := messageText(msg)
+	notice := tgbotapi.NewMessage(link.ChatID, fmt.Sprintf("✏️ 用户编辑了消息\n%s\n\n原内容：\n%s\n\n新内容：\n%s",
+		b.userLabel(msg.From.ID), quoteEdit(link.Text), quoteEdit(newText)))
+	notice.ReplyToMessageID = link.MessageID
+	notice.AllowSendingWithoutReply = true
+	sent, err := b.API.Send(notice)
+	if err != nil {
+		log.Printf("发送用户 %d 的编辑通知失败: %v", msg.From.ID, err)
+		return
+	}
+	// 客服可以直接回复编辑通知来回复用户
+	b.saveForwardMapping(link.ChatID, sent.MessageID, 0, msg)
+	if err := b.redisClient.UpdateMessageLinkText(ctx, msg.Chat.ID, msg.MessageID, newText); err != nil {
+		log.Printf("更新用户 %d 消息 %d 的内容失败: %v", msg.From.ID, msg.MessageID, err)
+	}
+	b.recordHistory(msg.From.ID, cache.HistoryInbound, "用户（编辑）", msg)
+}
+
+// syncAdminEdit 将客服对回复的编辑同步到已送达用户的消息，只支持文字和标题
+func (b *BotInstance) syncAdminEdit(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	link, ok, err := b.redisClient.GetMessageLink(ctx, msg.Chat.ID, msg.MessageID)
+	if err != nil {
+		log.Printf("查询管理员消息 %d 的送达消息失败: %v", msg.MessageID, err)
+		return
+	}
+	if !ok {
+		return // 不是回复给用户的消息
+	}
+
+	// 与回复时一样，开启自动翻译时同步译文
+	var edit tgbotapi.Chattable
+	switch {
+	case msg.Text != "":
+		text, _ := b.translateOutbound(link.ChatID, msg.Text)
+		edit = tgbotapi.NewEditMessageText(link.ChatID, link.MessageID, text)
+	case msg.Caption != "" || link.Text != "":
+		caption, _ := b.translateOutbound(link.ChatID, msg.Caption)
+		edit = tgbotapi.NewEditMessageCaption(link.ChatID, link.MessageID, caption)
+	default:
+		return
+	}
+	if _, err := b.API.Request(edit); err != nil {
+		if strings.Contains(err.Error(), "message is not modified") {
+			return
+		}
+		log.Printf("同步管理员 %d 的编辑到用户 %d 失败: %v", msg.From.ID, link.ChatID, err)
+		b.replyInThread(msg, "❌ 编辑未能同步给用户："+classifySendError(err).String())
+		return
+	}
+	if err := b.redisClient.UpdateMessageLinkText(ctx, msg.Chat.ID, msg.MessageID, messageText(msg)); err != nil {
+		log.Printf("更新管理员消息 %d 的内容失败: %v", msg.MessageID, err)
+	}
+	b.recordHistory(link.ChatID, cache.HistoryOutbound, "客服 "+adminDisplayName(msg.From)+"（编辑）", msg)
+}
+
+// quoteEdit 返回编辑通知中显示的内容，过长时截断
+func quoteEdit(text string) string {
+	if text == "" {
+		return "（无文字）"
+	}
+	if runes := []rune(text); len(runes) > maxEditQuoteLength {
+		return string(runes[:maxEditQuoteLength]) + "…"
+	}
+	return text
+}
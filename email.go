@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultSMTPPort          = 587
+	emailQueueSize           = 100              // 等待发送的邮件数，队列满时丢弃新邮件
+	emailTimeout             = 30 * time.Second // 连接 SMTP 服务器的超时时间
+	emailCheckInterval       = time.Minute      // 检查未回复消息的间隔
+	emailUndeliveredInterval = 10 * time.Minute // 同一用户的消息无法转交时，发送邮件的最小间隔
+	emailMaxUsers            = 20               // 一封未回复邮件最多列出的用户数
+	emailMaxMessages         = 10               // 每位用户最多列出的未回复消息数
+	emailWaitingPageSize     = 100              // 检查未回复消息时每次读取的用户数
+)
+
+// emailConfig 是邮件通知的配置，未设置 SMTP_HOST 时为 nil
+type emailConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	From       string
+	To         []string
+	Unanswered time.Duration // 用户消息超过该时间未回复时发送邮件，为 0 时不发送
+	LinkBase   string        // 网页后台的公网地址，用于生成邮件中的会话链接，可为空
+}
+
+// loadEmailConfig 读取 SMTP_*、EMAIL_TO、EMAIL_UNANSWERED_MINUTES 和 DASHBOARD_PUBLIC_URL，未设置 SMTP_HOST 时返回 nil
+func loadEmailConfig() (*emailConfig, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+	cfg := &emailConfig{
+		Host:     host,
+		Port:     defaultSMTPPort,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		LinkBase: strings.TrimSuffix(os.Getenv("DASHBOARD_PUBLIC_URL"), "/"),
+	}
+	if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("SMTP_PORT 无效（%s）", portStr)
+		}
+		cfg.Port = port
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("SMTP_FROM 无效（%s），未设置时使用 SMTP_USERNAME，需为邮箱地址", cfg.From)
+	}
+	for _, addr := range strings.Split(os.Getenv("EMAIL_TO"), ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return nil, fmt.Errorf("EMAIL_TO 中的地址无效（%s）", addr)
+		}
+		cfg.To = append(cfg.To, addr)
+	}
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("设置 SMTP_HOST 时必须设置 EMAIL_TO")
+	}
+	if minutesStr := os.Getenv("EMAIL_UNANSWERED_MINUTES"); minutesStr != "" {
+		minutes, err := strconv.Atoi(minutesStr)
+		if err != nil || minutes < 0 {
+			return nil, fmt.Errorf("EMAIL_UNANSWERED_MINUTES 无效（%s），应为不小于 0 的整数", minutesStr)
+		}
+		cfg.Unanswered = time.Duration(minutes) * time.Minute
+	}
+	return cfg, nil
+}
+
+// describe 返回配置的可读描述，用于日志和配置检查
+func (cfg *emailConfig) describe() string {
+	unanswered := "不发送未回复邮件"
+	if cfg.Unanswered > 0 {
+		unanswered = fmt.Sprintf("消息超过 %s 未回复时发送", formatWait(cfg.Unanswered))
+	}
+	return fmt.Sprintf("通过 %s:%d 发送给 %s，%s，消息无法转交客服时发送", cfg.Host, cfg.Port, strings.Join(cfg.To, ", "), unanswered)
+}
+
+// emailMessage 是一封待发送的邮件
+type emailMessage struct {
+	subject string
+	body    string
+}
+
+// emailNotifier 在后台依次发送邮件，不阻塞消息处理
+type emailNotifier struct {
+	cfg         emailConfig
+	queue       chan emailMessage
+	undelivered *alerter // 按用户限制无法转交邮件的频率
+}
+
+// newEmailNotifier 启动发送邮件的后台协程
+func newEmailNotifier(cfg emailConfig) *emailNotifier {
+	n := &emailNotifier{
+		cfg:         cfg,
+		queue:       make(chan emailMessage, emailQueueSize),
+		undelivered: newAlerter(alertConfig{Interval: emailUndeliveredInterval}),
+	}
+	go func() {
+		for msg := range n.queue {
+			if err := n.send(msg); err != nil {
+				log.Printf("发送邮件“%s”失败: %v", msg.subject, err)
+			}
+		}
+	}()
+	return n
+}
+
+// enqueue 将邮件加入发送队列，队列已满时丢弃
+func (n *emailNotifier) enqueue(subject, body string) {
+	select {
+	case n.queue <- emailMessage{subject: subject, body: body}:
+	default:
+		log.Printf("邮件队列已满，丢弃邮件“%s”", subject)
+	}
+}
+
+// send 发送一封邮件。端口 465 使用 TLS 直连，其余端口在服务器支持时使用 STARTTLS
+func (n *emailNotifier) send(msg emailMessage) error {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	if n.cfg.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: n.cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && n.cfg.Port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	from, _ := mail.ParseAddress(n.cfg.From)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range n.cfg.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.compose(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose 生成邮件原文，正文为 UTF-8 纯文本，使用 base64 编码
+func (n *emailNotifier) compose(msg emailMessage) []byte {
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", n.cfg.From},
+		{"To", strings.Join(n.cfg.To, ", ")},
+		{"Subject", mime.BEncoding.Encode("UTF-8", msg.subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=UTF-8"},
+		{"Content-Transfer-Encoding", "base64"},
+	}
+	for _, h := range headers {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// conversationLinks 返回邮件中打开与用户会话的链接：网页后台、论坛话题或 Telegram 私聊
+func (b *BotInstance) conversationLinks(userID int64) string {
+	var links []string
+	if b.email.cfg.LinkBase != "" {
+		links = append(links, fmt.Sprintf("网页后台：%s/#user=%d", b.email.cfg.LinkBase, userID))
+	}
+	if b.topicsManager.Enabled() {
+		if link, err := b.topicsManager.TopicLink(userID); err == nil && link != "" {
+			links = append(links, "话题："+link)
+		}
+	}
+	links = append(links, fmt.Sprintf("Telegram：tg://user?id=%d", userID))
+	return strings.Join(links, "\n")
+}
+
+// adminChatUnreachable 判断转发失败是否因为无法送达客服会话，而不是用户消息本身的问题
+func adminChatUnreachable(failure sendFailure) bool {
+	return failure != sendFailureNone && failure != sendFailureTooBig && failure != sendFailureUnsupported
+}
+
+// emailUndelivered 用户消息 msgs 无法转交客服会话时发送邮件，同一用户受 emailUndeliveredInterval 限流
+func (b *BotInstance) emailUndelivered(failure sendFailure, msgs ...*tgbotapi.Message) {
+	if b.email == nil || len(msgs) == 0 || !adminChatUnreachable(failure) {
+		return
+	}
+	userID := msgs[0].From.ID
+	ok, skipped := b.email.undelivered.allow(strconv.FormatInt(userID, 10), time.Now())
+	if !ok {
+		return
+	}
+	lines := make([]string, len(msgs))
+	for i, msg := range msgs {
+		lines[i] = strings.TrimSpace(messageText(msg))
+		if kind := messageType(msg); kind != "text" {
+			lines[i] = strings.TrimSpace(messageTypeLabels[kind] + " " + lines[i])
+		}
+	}
+	label := b.userLabel(userID)
+	body := fmt.Sprintf("机器人无法将%s 的消息转交到客服会话（原因：%s）。\n\n消息内容：\n%s\n\n", label, failure, strings.Join(lines, "\n"))
+	if skipped > 0 {
+		body += fmt.Sprintf("此前 %s 内该用户另有 %d 条消息也未能转交。\n\n", formatWait(emailUndeliveredInterval), skipped)
+	}
+	body += "打开会话：\n" + b.conversationLinks(userID) + "\n"
+	b.email.enqueue("⚠️ 用户消息无法转交客服："+label, body)
+}
+
+// StartEmailWatcher 在设置 EMAIL_UNANSWERED_MINUTES 时定期检查未回复的消息，超时后发送邮件
+func (b *BotInstance) StartEmailWatcher() {
+	if b.email == nil || b.email.cfg.Unanswered == 0 {
+		return
+	}
+	log.Printf("已启用未回复邮件：超过 %v 未回复时发送邮件", b.email.cfg.Unanswered)
+	go func() {
+		ticker := time.NewTicker(emailCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.checkUnansweredEmail()
+		}
+	}()
+}
+
+// checkUnansweredEmail 将新超过等待时间的用户合并为一封邮件，每次等待只发送一次
+func (b *BotInstance) checkUnansweredEmail() {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-b.email.cfg.Unanswered)
+	var overdue []cache.AwaitingReply
+	for offset := int64(0); ; offset += emailWaitingPageSize {
+		waiting, _, err := b.redisClient.GetResponseWaiting(ctx, offset, emailWaitingPageSize)
+		if err != nil {
+			log.Printf("获取等待回复的用户失败: %v", err)
+			return
+		}
+		done := len(waiting) < emailWaitingPageSize
+		for _, item := range waiting {
+			if item.Since.After(cutoff) {
+				done = true
+				break
+			}
+			first, err := b.redisClient.MarkUnansweredEmailed(ctx, item.UserID, item.Since)
+			if err != nil {
+				log.Printf("记录用户 %d 的未回复邮件失败: %v", item.UserID, err)
+				continue
+			}
+			if first {
+				overdue = append(overdue, item)
+			}
+		}
+		if done {
+			break
+		}
+	}
+	if len(overdue) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("以下 %d 位用户的消息超过 %s 未回复：\n", len(overdue), formatWait(b.email.cfg.Unanswered)))
+	for i, item := range overdue {
+		if i == emailMaxUsers {
+			sb.WriteString(fmt.Sprintf("\n另有 %d 位用户未列出，请在 /inbox 中查看。\n", len(overdue)-emailMaxUsers))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("\n%s，已等待 %s\n", b.slaUserLabel(item.UserID), formatWait(time.Since(item.Since))))
+		if entries, err := b.redisClient.GetHistory(ctx, item.UserID, cache.HistoryLimit); err == nil {
+			var messages []string
+			for _, entry := range entries {
+				if entry.Direction == cache.HistoryInbound && !entry.At.Before(item.Since) {
+					messages = append(messages, fmt.Sprintf("[%s] %s", entry.At.Format("01-02 15:04"), entry.Text))
+				}
+			}
+			if len(messages) > emailMaxMessages {
+				messages = messages[len(messages)-emailMaxMessages:]
+			}
+			for _, text := range messages {
+				sb.WriteString("  " + text + "\n")
+			}
+		}
+		sb.WriteString(b.conversationLinks(item.UserID) + "\n")
+	}
+	b.email.enqueue(fmt.Sprintf("⏰ %d 位用户的消息未回复", len(overdue)), sb.String())
+}
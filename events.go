@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 推送给外部系统的事件类型
+const (
+	eventUserNew           = "user.new"            // 新用户首次发来消息
+	eventMessageNew        = "message.new"         // 用户发来新消息
+	eventUserBlocked       = "user.blocked"        // 管理员拉黑用户
+	eventBroadcastFinished = "broadcast.completed" // 广播发送结束（含手动停止）
+	eventPaymentReceived   = "payment.received"    // 收到用户付款
+)
+
+// eventTypes 所有事件类型
+var eventTypes = []string{eventUserNew, eventMessageNew, eventUserBlocked, eventBroadcastFinished, eventPaymentReceived}
+
+const (
+	eventQueueSize   = 1000             // 等待推送的事件数，队列满时丢弃新事件
+	eventWorkers     = 4                // 并发推送的协程数
+	eventTimeout     = 10 * time.Second // 单次推送的超时时间
+	eventMaxAttempts = 5                // 每个事件最多推送的次数
+	eventRetryBase   = 2 * time.Second  // 第一次重试的等待时间，之后每次翻倍
+	eventSignature   = "X-Kefu-Signature"
+	eventHeader      = "X-Kefu-Event"
+	eventDelivery    = "X-Kefu-Delivery"
+)
+
+// eventConfig 是事件推送的配置
+type eventConfig struct {
+	URLs   []string        // 接收事件的地址
+	Secret string          // 签名密钥，为空时不签名
+	Events map[string]bool // 推送的事件类型，为 nil 时推送全部
+}
+
+// loadEventConfig 从 EVENT_WEBHOOK_URLS、EVENT_WEBHOOK_SECRET 和 EVENT_WEBHOOK_EVENTS 读取事件推送配置，
+// 未设置 EVENT_WEBHOOK_URLS 时返回 nil
+func loadEventConfig() (*eventConfig, error) {
+	urlsStr := os.Getenv("EVENT_WEBHOOK_URLS")
+	if urlsStr == "" {
+		return nil, nil
+	}
+	cfg := &eventConfig{Secret: os.Getenv("EVENT_WEBHOOK_SECRET")}
+	for _, raw := range strings.Split(urlsStr, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("EVENT_WEBHOOK_URLS 中的地址无效（%s），应为 http:// 或 https:// 开头的地址", raw)
+		}
+		cfg.URLs = append(cfg.URLs, raw)
+	}
+	if len(cfg.URLs) == 0 {
+		return nil, nil
+	}
+	if eventsStr := os.Getenv("EVENT_WEBHOOK_EVENTS"); eventsStr != "" {
+		cfg.Events = make(map[string]bool)
+		for _, event := range strings.Split(eventsStr, ",") {
+			event = strings.TrimSpace(event)
+			if !isEventType(event) {
+				return nil, fmt.Errorf("EVENT_WEBHOOK_EVENTS 中的事件类型无效（%s），可用类型：%s", event, strings.Join(eventTypes, ", "))
+			}
+			cfg.Events[event] = true
+		}
+	}
+	return cfg, nil
+}
+
+func isEventType(event string) bool {
+	for _, t := range eventTypes {
+		if t == event {
+			return true
+		}
+	}
+	return false
+}
+
+// describe 返回配置的可读描述，用于日志和配置检查
+func (cfg *eventConfig) describe() string {
+	events := "全部事件"
+	if cfg.Events != nil {
+		names := make([]string, 0, len(cfg.Events))
+		for _, t := range eventTypes {
+			if cfg.Events[t] {
+				names = append(names, t)
+			}
+		}
+		events = strings.Join(names, ", ")
+	}
+	signed := "不签名"
+	if cfg.Secret != "" {
+		signed = "HMAC-SHA256 签名"
+	}
+	return fmt.Sprintf("%d 个地址，%s，%s", len(cfg.URLs), events, signed)
+}
+
+// eventDeliveryJob 是向一个地址推送一个事件的任务
+type eventDeliveryJob struct {
+	url     string
+	event   string
+	id      string
+	body    []byte
+	attempt int
+}
+
+// eventBus 将事件以 JSON POST 到外部地址。推送在后台进行，失败时按指数退避重试，不阻塞消息处理
+type eventBus struct {
+	cfg    eventConfig
+	client *http.Client
+	queue  chan eventDeliveryJob
+}
+
+// newEventBus 启动推送事件的后台协程
+func newEventBus(cfg eventConfig) *eventBus {
+	bus := &eventBus{
+		cfg:    cfg,
+		client: &http.Client{Timeout: eventTimeout},
+		queue:  make(chan eventDeliveryJob, eventQueueSize),
+	}
+	for i := 0; i < eventWorkers; i++ {
+		go func() {
+			for job := range bus.queue {
+				bus.deliver(job)
+			}
+		}()
+	}
+	return bus
+}
+
+// eventPayload 是推送的 JSON 内容
+type eventPayload struct {
+	ID    string      `json:"id"`
+	Event string      `json:"event"`
+	Time  int64       `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// publish 将事件加入推送队列，未启用该事件类型时忽略
+func (bus *eventBus) publish(event string, data interface{}) {
+	if bus.cfg.Events != nil && !bus.cfg.Events[event] {
+		return
+	}
+	id := newEventID()
+	body, err := json.Marshal(eventPayload{ID: id, Event: event, Time: time.Now().Unix(), Data: data})
+	if err != nil {
+		log.Printf("序列化事件 %s 失败: %v", event, err)
+		return
+	}
+	for _, u := range bus.cfg.URLs {
+		bus.enqueue(eventDeliveryJob{url: u, event: event, id: id, body: body})
+	}
+}
+
+// enqueue 将推送任务加入队列，队列已满时丢弃
+func (bus *eventBus) enqueue(job eventDeliveryJob) {
+	select {
+	case bus.queue <- job:
+	default:
+		log.Printf("事件推送队列已满，丢弃事件 %s（%s）", job.id, job.event)
+	}
+}
+
+// deliver 推送一次事件。网络错误、5xx 和 429 响应稍后重试，其余 4xx 响应说明接收方拒绝，不再重试
+func (bus *eventBus) deliver(job eventDeliveryJob) {
+	job.attempt++
+	err := bus.post(job)
+	if err == nil {
+		return
+	}
+	if !isRetryableEventError(err) || job.attempt >= eventMaxAttempts {
+		log.Printf("推送事件 %s（%s）到 %s 失败，已放弃（第 %d 次）: %v", job.id, job.event, job.url, job.attempt, err)
+		return
+	}
+	wait := eventRetryBase << (job.attempt - 1)
+	log.Printf("推送事件 %s（%s）到 %s 失败，%s 后重试（第 %d 次）: %v", job.id, job.event, job.url, wait, job.attempt, err)
+	time.AfterFunc(wait, func() { bus.enqueue(job) })
+}
+
+// eventStatusError 是接收方返回的非 2xx 响应
+type eventStatusError struct {
+	status int
+}
+
+func (e eventStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.status)
+}
+
+func isRetryableEventError(err error) bool {
+	if statusErr, ok := err.(eventStatusError); ok {
+		return statusErr.status >= http.StatusInternalServerError || statusErr.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// post 发送一次请求，设置了密钥时附带 signEvent 签名
+func (bus *eventBus) post(job eventDeliveryJob) error {
+	req, err := http.NewRequest(http.MethodPost, job.url, bytes.NewReader(job.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(eventHeader, job.event)
+	req.Header.Set(eventDelivery, job.id)
+	if bus.cfg.Secret != "" {
+		req.Header.Set(eventSignature, signEvent(bus.cfg.Secret, job.body))
+	}
+	resp, err := bus.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return eventStatusError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+// signEvent 返回请求体的签名头：sha256=<HMAC-SHA256 十六进制>
+func signEvent(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newEventID 生成事件 ID，同一事件重试时 ID 不变，接收方可据此去重
+func newEventID() string {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// eventUser 是事件中的用户信息
+type eventUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Language  string `json:"language_code,omitempty"`
+}
+
+func newEventUser(user *tgbotapi.User) eventUser {
+	return eventUser{ID: user.ID, Username: user.UserName, FirstName: user.FirstName, LastName: user.LastName, Language: user.LanguageCode}
+}
+
+// eventMessage 是 message.new 事件的内容
+type eventMessage struct {
+	User      eventUser `json:"user"`
+	MessageID int       `json:"message_id"`
+	Type      string    `json:"type"`
+	Text      string    `json:"text,omitempty"`
+	Date      int       `json:"date"`
+}
+
+// eventBlock 是 user.blocked 事件的内容
+type eventBlock struct {
+	UserID  int64  `json:"user_id"`
+	AdminID int64  `json:"admin_id"`
+	Source  string `json:"source"` // 拉黑的入口：command、message、profile 或 quarantine
+}
+
+// eventPayment 是 payment.received 事件的内容
+type eventPayment struct {
+	User                    eventUser `json:"user"`
+	Currency                string    `json:"currency"`
+	TotalAmount             int       `json:"total_amount"`
+	InvoicePayload          string    `json:"invoice_payload"`
+	TelegramPaymentChargeID string    `json:"telegram_payment_charge_id"`
+	ProviderPaymentChargeID string    `json:"provider_payment_charge_id"`
+}
+
+// emitBlocked 推送 user.blocked 事件
+func (b *BotInstance) emitBlocked(userID, adminID int64, source string) {
+	b.emit(eventUserBlocked, eventBlock{UserID: userID, AdminID: adminID, Source: source})
+}
+
+// emit 推送事件并同步到 Slack/Discord，都未配置时不做任何事
+func (b *BotInstance) emit(event string, data interface{}) {
+	b.notifyChat(event, data)
+	if b.events == nil {
+		return
+	}
+	b.events.publish(event, data)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignEvent(t *testing.T) {
+	tests := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		// RFC 4231 测试用例 2
+		{"Jefe", "what do ya want for nothing?", "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"secret", `{"id":"1"}`, "sha256=6146142a2ce0159e84c0767881e4ec80bc397da62526e7d19f70795eb79460c0"},
+	}
+	for _, tt := range tests {
+		if got := signEvent(tt.secret, []byte(tt.body)); got != tt.want {
+			t.Errorf("signEvent(%q, %q) = %s，期望 %s", tt.secret, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestEventPost(t *testing.T) {
+	body := []byte(`{"id":"abc","event":"user.new"}`)
+	tests := []struct {
+		name          string
+		secret        string
+		status        int
+		wantSignature string
+		wantErr       bool
+		wantRetryable bool
+	}{
+		{"带签名", "secret", http.StatusOK, signEvent("secret", body), false, false},
+		{"未设置密钥时不签名", "", http.StatusNoContent, "", false, false},
+		{"4xx 不重试", "secret", http.StatusBadRequest, signEvent("secret", body), true, false},
+		{"429 重试", "secret", http.StatusTooManyRequests, signEvent("secret", body), true, true},
+		{"5xx 重试", "secret", http.StatusBadGateway, signEvent("secret", body), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			var gotBody []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				gotBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			bus := &eventBus{cfg: eventConfig{Secret: tt.secret}, client: server.Client()}
+			err := bus.post(eventDeliveryJob{url: server.URL, event: eventUserNew, id: "abc", body: body})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("post 错误 = %v，期望出错 %v", err, tt.wantErr)
+			}
+			if err != nil && isRetryableEventError(err) != tt.wantRetryable {
+				t.Errorf("isRetryableEventError(%v) = %v，期望 %v", err, !tt.wantRetryable, tt.wantRetryable)
+			}
+			if sig := got.Header.Get(eventSignature); sig != tt.wantSignature {
+				t.Errorf("签名头 = %q，期望 %q", sig, tt.wantSignature)
+			}
+			if got.Header.Get(eventHeader) != eventUserNew || got.Header.Get(eventDelivery) != "abc" {
+				t.Errorf("事件头 = %q、%q，期望 %q、abc", got.Header.Get(eventHeader), got.Header.Get(eventDelivery), eventUserNew)
+			}
+			if string(gotBody) != string(body) {
+				t.Errorf("请求体 = %s，期望 %s", gotBody, body)
+			}
+		})
+	}
+}
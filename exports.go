@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// exportPageSize 导出时每次从 Redis 读取的用户数
+const exportPageSize = 500
+
+// userCSVHeader 是导出文件的表头
+var userCSVHeader = []string{"id", "username", "first_name", "last_name", "first_seen", "last_active", "blocked", "tags"}
+
+// handleExportUsers 处理 /exportusers：在后台把所有用户写成 CSV 并作为文件发送。
+// CSV 边生成边上传，每次只读取一页用户，用户很多时也不会全部载入内存
+func (b *BotInstance) handleExportUsers(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	b.API.Send(tgbotapi.NewMessage(chatID, "⏳ 正在导出用户，完成后会发送 CSV 文件…"))
+	go func() {
+		started := time.Now()
+		r, w := io.Pipe()
+		counted := make(chan int, 1)
+		go func() {
+			n, err := b.writeUsersCSV(context.Background(), w)
+			counted <- n
+			w.CloseWithError(err)
+		}()
+
+		doc := tgbotapi.NewDocument(chatID, tgbotapi.FileReader{Name: "users-" + started.Format("20060102-150405") + ".csv", Reader: r})
+		_, err := b.API.Send(doc)
+		// 上传失败时读取端可能已停止，关闭后写入协程才能结束
+		r.CloseWithError(err)
+		n := <-counted
+		if err != nil {
+			log.Printf("导出用户失败（已写入 %d 位）: %v", n, err)
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ 导出用户失败："+err.Error()))
+			return
+		}
+		log.Printf("管理员 %d 导出了 %d 位用户，耗时 %v", msg.From.ID, n, time.Since(started).Round(time.Millisecond))
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已导出 %d 位用户。", n)))
+	}()
+}
+
+// writeUsersCSV 将用户集合中的用户以及不在其中的拉黑用户逐页写入 w，返回写入的用户数
+func (b *BotInstance) writeUsersCSV(ctx context.Context, w io.Writer) (int, error) {
+	// 写入 UTF-8 BOM，便于 Excel 正确识别中文
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return 0, err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(userCSVHeader); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var writeErr error
+	writePage := func(userIDs []string) bool {
+		var records []cache.UserRecord
+		records, writeErr = b.redisClient.GetUserRecords(ctx, userIDs)
+		if writeErr != nil {
+			return false
+		}
+		for _, record := range records {
+			if writeErr = cw.Write(userCSVRow(record)); writeErr != nil {
+				return false
+			}
+			n++
+		}
+		cw.Flush()
+		writeErr = cw.Error()
+		return writeErr == nil
+	}
+
+	if err := b.redisClient.EachUserIDPage(ctx, cache.UsersSetKey, exportPageSize, writePage); err != nil {
+		return n, err
+	}
+	if writeErr != nil {
+		return n, writeErr
+	}
+	// 通过 ID 拉黑、从未发过消息的用户不在用户集合中
+	err := b.redisClient.EachUserIDPage(ctx, cache.BlockedUsersSet, exportPageSize, func(userIDs []string) bool {
+		var rest []string
+		if rest, writeErr = b.redisClient.FilterNonUsers(ctx, userIDs); writeErr != nil {
+			return false
+		}
+		return len(rest) == 0 || writePage(rest)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, writeErr
+}
+
+func userCSVRow(record cache.UserRecord) []string {
+	return []string{
+		strconv.FormatInt(record.UserID, 10),
+		csvText(record.Profile.Username),
+		csvText(record.Profile.FirstName),
+		csvText(record.Profile.LastName),
+		formatCSVTime(record.Profile.FirstSeen),
+		formatCSVTime(record.Profile.LastActive),
+		strconv.FormatBool(record.Blocked),
+		csvText(strings.Join(record.Tags, " ")),
+	}
+}
+
+// csvText 在以 =、+、-、@ 开头的单元格前加上单引号，避免用户填写的名称在表格软件中被当作公式执行
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// formatCSVTime 将时间格式化为 RFC 3339，未记录时为空
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultFloodMaxPerMinute = 20
+	defaultFloodMuteMinutes  = 10
+)
+
+// floodConfig 是用户刷屏限制的配置，MaxPerMinute 为 0 时不限制
+type floodConfig struct {
+	MaxPerMinute int
+	Mute         time.Duration
+}
+
+// loadFloodConfig 从 FLOOD_MAX_PER_MINUTE 和 FLOOD_MUTE_MINUTES 读取刷屏限制配置
+func loadFloodConfig() floodConfig {
+	cfg := floodConfig{MaxPerMinute: defaultFloodMaxPerMinute, Mute: defaultFloodMuteMinutes * time.Minute}
+	if maxStr := os.Getenv("FLOOD_MAX_PER_MINUTE"); maxStr != "" {
+		n, err := strconv.Atoi(maxStr)
+		if err != nil || n < 0 {
+			log.Printf("警告：FLOOD_MAX_PER_MINUTE 无效（%s），使用默认值 %d", maxStr, defaultFloodMaxPerMinute)
+		} else {
+			cfg.MaxPerMinute = n
+		}
+	}
+	if muteStr := os.Getenv("FLOOD_MUTE_MINUTES"); muteStr != "" {
+		n, err := strconv.Atoi(muteStr)
+		if err != nil || n < 1 {
+			log.Printf("警告：FLOOD_MUTE_MINUTES 无效（%s），使用默认值 %d", muteStr, defaultFloodMuteMinutes)
+		} else {
+			cfg.Mute = time.Duration(n) * time.Minute
+		}
+	}
+	return cfg
+}
+
+// checkFlood 检查用户是否发送过于频繁。超过每分钟上限时临时禁言并通知用户；
+// 禁言期间的消息直接丢弃。返回 false 表示该消息不应继续处理。
+func (b *BotInstance) checkFlood(msg *tgbotapi.Message) bool {
+	flood := b.floodSettings()
+	if flood.MaxPerMinute == 0 {
+		return true
+	}
+	ctx := context.Background()
+	remaining, err := b.redisClient.UserMuteRemaining(ctx, msg.From.ID)
+	if err != nil {
+		// 无法确认时放行，避免 Redis 故障导致客服转发中断
+		log.Printf("检查用户 %d 禁言状态失败: %v", msg.From.ID, err)
+		return true
+	}
+	if remaining > 0 {
+		return false
+	}
+
+	count, err := b.redisClient.CountUserMessage(ctx, msg.From.ID, time.Minute)
+	if err != nil {
+		log.Printf("统计用户 %d 消息频率失败: %v", msg.From.ID, err)
+		return true
+	}
+	if count <= int64(flood.MaxPerMinute) {
+		return true
+	}
+
+	if err := b.redisClient.MuteUser(ctx, msg.From.ID, flood.Mute); err != nil {
+		log.Printf("禁言用户 %d 失败: %v", msg.From.ID, err)
+		return true
+	}
+	log.Printf("用户 %d 一分钟内发送超过 %d 条消息，禁言 %v", msg.From.ID, flood.MaxPerMinute, flood.Mute)
+	notice := fmt.Sprintf("您发送消息过于频繁，已被暂时限制 %d 分钟，期间的消息不会转交给客服。请稍后再试。", int(flood.Mute.Minutes()))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, notice))
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleSetForward 处理 /setforward：带会话 ID 时直接设置转发目标，reset 恢复 FORWARD_TO_ADMIN_ID，
+// 不带参数时等待管理员转发一条来自目标会话的消息（或发送会话 ID）
+func (b *BotInstance) handleSetForward(msg *tgbotapi.Message) {
+	arg := strings.TrimSpace(msg.CommandArguments())
+	switch arg {
+	case "":
+		b.pendingSettings[msg.Chat.ID] = settingForward
+		text := fmt.Sprintf("当前转发目标：%s\n\n请转发一条来自目标群组或频道的消息，或直接发送会话 ID（个人会话只能发送用户 ID）。\n"+
+			"机器人需要能在该会话中发言。发送 /setforward reset 恢复 FORWARD_TO_ADMIN_ID（%s），发送 /cancel 取消。",
+			describeForward(b.forwardTarget()), describeForward(b.envDefaults().ForwardTo))
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		return
+	case "reset":
+		delete(b.pendingSettings, msg.Chat.ID)
+		if err := b.saveSetting(msg.From.ID, settingForward, ""); err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+			return
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已恢复默认转发目标："+describeForward(b.forwardTarget())))
+		return
+	}
+
+	delete(b.pendingSettings, msg.Chat.ID)
+	if err := b.validateSetting(settingForward, arg); err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	if err := b.saveSetting(msg.From.ID, settingForward, arg); err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 转发目标已设置为 "+arg+"，用户消息将立即转发到该会话。"))
+}
+
+// forwardedChatID 返回转发消息的来源群组或频道；消息不是转发的时 ok 为 false。
+// 转发自个人的消息只能说明是谁发的，不能说明管理员想转发到哪个会话，因此个人会话必须直接发送 ID
+func forwardedChatID(msg *tgbotapi.Message) (chatID int64, ok bool, err error) {
+	switch {
+	case msg.ForwardFromChat != nil:
+		return msg.ForwardFromChat.ID, true, nil
+	case msg.ForwardFrom != nil:
+		return 0, false, fmt.Errorf("转发个人消息无法确定目标会话，个人会话请直接发送用户 ID")
+	case msg.ForwardSenderName != "":
+		return 0, false, fmt.Errorf("该消息的发送者隐藏了转发来源，请直接发送会话 ID")
+	}
+	return 0, false, nil
+}
+
+// validateForwardTarget 确认机器人能访问并在会话中发言：发送一条说明消息，失败时返回原因
+func (b *BotInstance) validateForwardTarget(chatID int64) error {
+	if _, err := b.API.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: chatID}}); err != nil {
+		return fmt.Errorf("无法访问会话 %d（管理员需先私聊机器人，或将机器人加入群组）: %v", chatID, err)
+	}
+	notice := tgbotapi.NewMessage(chatID, "✅ 此会话已被设置为用户消息的转发目标，在这里回复转发的消息即可回复用户。")
+	if _, err := b.API.Send(notice); err != nil {
+		return fmt.Errorf("机器人无法在会话 %d 中发言（%s）", chatID, classifySendError(err))
+	}
+	return nil
+}
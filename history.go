@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultHistoryCount = 20
+	// maxTextLength 是 Telegram 单条文本消息的长度上限
+	maxTextLength = 4096
+)
+
+// recordHistory 将用户对话中的一条消息记入对话记录，direction 为 cache.HistoryInbound 或 cache.HistoryOutbound
+func (b *BotInstance) recordHistory(userID int64, direction, author string, msg *tgbotapi.Message) {
+	entry := cache.HistoryEntry{
+		At:        time.Now(),
+		Direction: direction,
+		Type:      messageType(msg),
+		Author:    author,
+		Text:      messageSummary(msg),
+	}
+	if err := b.redisClient.AddHistoryEntry(context.Background(), userID, entry); err != nil {
+		log.Printf("记录用户 %d 的对话失败: %v", userID, err)
+	}
+	b.indexMessage(userID, entry, msg)
+}
+
+// handleHistory 处理 /history <用户ID或@用户名> [条数]，显示与用户最近的对话
+func (b *BotInstance) handleHistory(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	usage := fmt.Sprintf("用法：/history <用户ID或@用户名> [条数]\n条数默认 %d，最多 %d。", defaultHistoryCount, cache.HistoryLimit)
+	if len(args) == 0 || len(args) > 2 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, usage))
+		return
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	n := defaultHistoryCount
+	if len(args) == 2 {
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, usage))
+			return
+		}
+		n = min(n, cache.HistoryLimit)
+	}
+
+	entries, err := b.redisClient.GetHistory(context.Background(), userID, n)
+	if err != nil {
+		log.Printf("获取用户 %d 的对话记录失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取对话记录失败。"))
+		return
+	}
+	if len(entries) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 没有对话记录。", b.userLabel(userID))))
+		return
+	}
+
+	lines := []string{fmt.Sprintf("%s 最近 %d 条对话：\n", b.userLabel(userID), len(entries))}
+	for _, entry := range entries {
+		arrow := "⬅️"
+		if entry.Direction == cache.HistoryOutbound {
+			arrow = "➡️"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s：%s", entry.At.Format("01-02 15:04"), arrow, entry.Author, entry.Text))
+	}
+	b.sendLongText(msg.Chat.ID, lines, "")
+}
+
+// sendLongText 将多行文本按行拆分成不超过 Telegram 长度上限的若干条消息发送，parseMode 为空时发送纯文本
+func (b *BotInstance) sendLongText(chatID int64, lines []string, parseMode string) {
+	var sb strings.Builder
+	send := func() {
+		reply := tgbotapi.NewMessage(chatID, sb.String())
+		reply.ParseMode = parseMode
+		reply.DisableWebPagePreview = true
+		if _, err := b.API.Send(reply); err != nil {
+			log.Printf("发送消息到 %d 失败: %v", chatID, err)
+		}
+		sb.Reset()
+	}
+	for _, line := range lines {
+		if sb.Len() > 0 && len([]rune(sb.String()))+len([]rune(line))+1 > maxTextLength {
+			send()
+		}
+		sb.WriteString(line + "\n")
+	}
+	if sb.Len() > 0 {
+		send()
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	ConfigBusinessHours = "config:business_hours" // 工作时间，格式见 parseBusinessHours，为空时全天工作
+	ConfigAwayMessage   = "config:away_message"   // 非工作时间自动发送给用户的消息
+
+	defaultAwayMessage = "您好，现在是非工作时间，您的消息已记录，客服上班后会尽快回复您。"
+
+	awayDigestInterval = time.Minute
+	// awayDigestPerUser 汇总中每位用户最多列出的消息条数
+	awayDigestPerUser = 3
+	// maxAwayDigestUsers 汇总中最多列出的用户数
+	maxAwayDigestUsers = 30
+)
+
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// businessHours 是每周的工作时间。End 不大于 Start 时表示跨夜，例如 22:00-06:00
+type businessHours struct {
+	Start, End int     // 当天零点起的分钟数
+	Days       [7]bool // 按 time.Weekday 索引，表示哪天开始上班
+	spec       string  // 原始配置
+	loc        *time.Location
+}
+
+// parseBusinessHours 解析 "09:00-18:00 [1-5]"，星期用 1-7 表示周一到周日，
+// 可写成区间或用逗号分隔，例如 "1-5" 或 "1,3,5"；省略时每天都工作
+func parseBusinessHours(spec string) (businessHours, error) {
+	h := businessHours{spec: strings.TrimSpace(spec), loc: time.Local}
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 2 {
+		return h, fmt.Errorf("格式应为：开始-结束 [星期]，例如 09:00-18:00 1-5")
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return h, fmt.Errorf("时间段 %s 无效，应为 09:00-18:00 的形式", fields[0])
+	}
+	var err error
+	if h.Start, err = parseClock(start); err != nil {
+		return h, err
+	}
+	if h.End, err = parseClock(end); err != nil {
+		return h, err
+	}
+
+	if len(fields) == 1 {
+		for i := range h.Days {
+			h.Days[i] = true
+		}
+		return h, nil
+	}
+	for _, part := range strings.Split(fields[1], ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil || first < 1 || first > 7 {
+			return h, fmt.Errorf("星期 %s 无效，请使用 1-7 表示周一到周日", part)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(to)
+			if err != nil || last < first || last > 7 {
+				return h, fmt.Errorf("星期 %s 无效，请使用 1-7 表示周一到周日", part)
+			}
+		}
+		for d := first; d <= last; d++ {
+			h.Days[d%7] = true // 7 表示周日，对应 time.Sunday
+		}
+	}
+	return h, nil
+}
+
+// parseClock 将 "HH:MM" 解析为当天零点起的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("时间 %s 无效，应为 HH:MM，例如 09:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// isOpen 报告 t 是否在工作时间内
+func (h businessHours) isOpen(t time.Time) bool {
+	t = t.In(h.loc)
+	m := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	switch {
+	case h.Start == h.End:
+		return h.Days[today]
+	case h.Start < h.End:
+		return h.Days[today] && m >= h.Start && m < h.End
+	default:
+		// 跨夜：零点后属于前一天的班次
+		return (h.Days[today] && m >= h.Start) || (h.Days[yesterday] && m < h.End)
+	}
+}
+
+// nextOpen 返回 t 之后最近的上班时间
+func (h businessHours) nextOpen(t time.Time) time.Time {
+	t = t.In(h.loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, h.loc)
+	for d := 0; d <= 7; d++ {
+		day := midnight.AddDate(0, 0, d)
+		open := day.Add(time.Duration(h.Start) * time.Minute)
+		if open.After(t) && h.Days[day.Weekday()] {
+			return open
+		}
+	}
+	return t.Add(24 * time.Hour) // 没有任何工作日时不会发生，保底一天后
+}
+
+// describe 返回便于阅读的工作时间描述
+func (h businessHours) describe() string {
+	var days []string
+	for d := 1; d <= 7; d++ {
+		if h.Days[d%7] {
+			days = append(days, weekdayNames[d%7])
+		}
+	}
+	dayText := strings.Join(days, "、")
+	if len(days) == 7 {
+		dayText = "每天"
+	}
+	clock := func(m int) string { return fmt.Sprintf("%02d:%02d", m/60, m%60) }
+	text := fmt.Sprintf("%s %s-%s", dayText, clock(h.Start), clock(h.End))
+	if h.End <= h.Start && h.Start != h.End {
+		text += "（跨夜）"
+	}
+	return text
+}
+
+// loadBusinessHours 读取工作时间配置，ok 为 false 表示未设置或读取失败（按全天工作处理）
+func (b *BotInstance) loadBusinessHours(ctx context.Context) (h businessHours, ok bool) {
+	spec, err := b.redisClient.GetConfigValue(ctx, ConfigBusinessHours)
+	if err != nil {
+		log.Printf("获取工作时间失败: %v", err)
+		return h, false
+	}
+	if spec == "" {
+		return h, false
+	}
+	h, err = parseBusinessHours(spec)
+	if err != nil {
+		log.Printf("工作时间配置无效（%s）: %v", spec, err)
+		return h, false
+	}
+	return h, true
+}
+
+// handleSetHours 处理 /sethours：不带参数时显示当前工作时间，off 关闭，其余参数设置工作时间
+func (b *BotInstance) handleSetHours(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	args := strings.TrimSpace(msg.CommandArguments())
+	switch args {
+	case "":
+		text := "当前未设置工作时间，全天不会发送离开消息。"
+		if h, ok := b.loadBusinessHours(ctx); ok {
+			status := "非工作时间"
+			if h.isOpen(time.Now()) {
+				status = "工作时间"
+			}
+			text = fmt.Sprintf("当前工作时间：%s\n现在是%s。", h.describe(), status)
+		}
+		text += "\n\n用法：/sethours 09:00-18:00 [1-5]\n星期用 1-7 表示周一到周日，省略时每天；结束早于开始表示跨夜。\n/sethours off 关闭工作时间\n/setaway 设置非工作时间的自动回复"
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		return
+	case "off":
+		if err := b.redisClient.SetConfigValue(ctx, ConfigBusinessHours, ""); err != nil {
+			log.Printf("关闭工作时间失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 关闭工作时间失败。"))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditSettings, "关闭工作时间")
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已关闭工作时间，不再发送离开消息。"))
+		return
+	}
+
+	h, err := parseBusinessHours(args)
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	if err := b.redisClient.SetConfigValue(ctx, ConfigBusinessHours, h.spec); err != nil {
+		log.Printf("保存工作时间失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 保存工作时间失败。"))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditSettings, "工作时间设置为 "+h.describe())
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 工作时间已设置为：%s（服务器时区 %s）", h.describe(), time.Now().Format("MST"))))
+}
+
+// handleSetAway 处理 /setaway：不带参数时显示当前离开消息，clear 恢复默认，其余内容作为新的离开消息
+func (b *BotInstance) handleSetAway(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	text := strings.TrimSpace(msg.CommandArguments())
+	switch text {
+	case "":
+		current := b.awayMessage(ctx)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "当前离开消息：\n"+current+"\n\n用法：/setaway <消息内容>\n/setaway clear 恢复默认消息"))
+		return
+	case "clear":
+		text = ""
+	}
+	if err := b.redisClient.SetConfigValue(ctx, ConfigAwayMessage, text); err != nil {
+		log.Printf("保存离开消息失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 保存离开消息失败。"))
+		return
+	}
+	if text == "" {
+		b.audit(msg.From.ID, cache.AuditSettings, "恢复默认离开消息")
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已恢复默认离开消息。"))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditSettings, "离开消息修改为："+text)
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 离开消息已更新。"))
+}
+
+// awayMessage 返回自定义的离开消息，未设置时返回默认消息
+func (b *BotInstance) awayMessage(ctx context.Context) string {
+	text, err := b.redisClient.GetConfigValue(ctx, ConfigAwayMessage)
+	if err != nil {
+		log.Printf("获取离开消息失败: %v", err)
+	}
+	if text == "" {
+		return defaultAwayMessage
+	}
+	return text
+}
+
+// handleAwayMessage 在非工作时间记录用户消息以便上班后汇总，并在本次非工作时间内首次收到该用户消息时发送离开消息。
+// 消息仍会照常转发给客服。
+func (b *BotInstance) handleAwayMessage(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	h, ok := b.loadBusinessHours(ctx)
+	now := time.Now()
+	if !ok || h.isOpen(now) {
+		return
+	}
+
+	away := cache.AwayMessage{UserID: msg.From.ID, At: now, Summary: messageSummary(msg)}
+	if err := b.redisClient.AddAwayMessage(ctx, away); err != nil {
+		log.Printf("记录用户 %d 的非工作时间消息失败: %v", msg.From.ID, err)
+	}
+
+	first, err := b.redisClient.MarkAwayNotified(ctx, msg.From.ID, h.nextOpen(now).Sub(now))
+	if err != nil {
+		log.Printf("记录用户 %d 的离开消息状态失败: %v", msg.From.ID, err)
+		return
+	}
+	if !first {
+		return
+	}
+	sent, err := b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, b.awayMessage(ctx)))
+	if err != nil {
+		log.Printf("发送离开消息给用户 %d 失败: %v", msg.From.ID, err)
+		return
+	}
+	b.recordHistory(msg.From.ID, cache.HistoryOutbound, "离开消息", &sent)
+}
+
+// StartAwayDigest 启动后台检查，工作时间开始（或关闭工作时间）后将非工作时间收到的消息汇总发送给客服
+func (b *BotInstance) StartAwayDigest() {
+	go func() {
+		ticker := time.NewTicker(awayDigestInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.sendAwayDigest()
+		}
+	}()
+}
+
+// sendAwayDigest 在工作时间内取出并发送汇总，非工作时间不做任何事
+func (b *BotInstance) sendAwayDigest() {
+	ctx := context.Background()
+	if h, ok := b.loadBusinessHours(ctx); ok && !h.isOpen(time.Now()) {
+		return
+	}
+	messages, n, err := b.redisClient.GetAwayMessages(ctx)
+	if err != nil {
+		log.Printf("获取非工作时间消息汇总失败: %v", err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	if len(messages) > 0 {
+		for _, part := range splitMessageText(b.formatAwayDigest(messages), maxTextLength) {
+			if err := b.notifyForwardTarget(part); err != nil {
+				// 保留汇总，下一次检查时重新发送
+				return
+			}
+		}
+	}
+	if err := b.redisClient.TrimAwayMessages(ctx, n); err != nil {
+		log.Printf("清除已发送的非工作时间消息汇总失败: %v", err)
+	}
+}
+
+// splitMessageText 按行将文字拆分为不超过 limit 个字符的多段，超长的单行按字符截断
+func splitMessageText(text string, limit int) []string {
+	var parts []string
+	var current []rune
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runes := []rune(line)
+		if len(current)+len(runes) > limit && len(current) > 0 {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		for len(runes) > limit {
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+// formatAwayDigest 按用户分组生成汇总，用户按第一条消息的时间排序
+func (b *BotInstance) formatAwayDigest(messages []cache.AwayMessage) string {
+	var users []int64
+	byUser := make(map[int64][]cache.AwayMessage)
+	for _, msg := range messages {
+		if _, ok := byUser[msg.UserID]; !ok {
+			users = append(users, msg.UserID)
+		}
+		byUser[msg.UserID] = append(byUser[msg.UserID], msg)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🌅 非工作时间共收到 %d 条消息，来自 %d 位用户：\n", len(messages), len(users)))
+	for i, userID := range users {
+		if i == maxAwayDigestUsers {
+			sb.WriteString(fmt.Sprintf("\n… 另有 %d 位用户未列出", len(users)-maxAwayDigestUsers))
+			break
+		}
+		msgs := byUser[userID]
+		sb.WriteString(fmt.Sprintf("\n%s（%d 条）\n", b.userLabel(userID), len(msgs)))
+		for j, msg := range msgs {
+			if j == awayDigestPerUser {
+				sb.WriteString(fmt.Sprintf("  … 另有 %d 条\n", len(msgs)-awayDigestPerUser))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("  %s %s\n", msg.At.Format("01-02 15:04"), msg.Summary))
+		}
+	}
+	return sb.String()
+}
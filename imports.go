@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"my-tg-bot/internal/cache"
+)
+
+// 导入类型
+const (
+	importUsers   = "users"
+	importBlocked = "blocked"
+	importRestore = "restore" // 从 /backup 生成的备份文件恢复
+)
+
+const (
+	importDownloadLimit = 2 * time.Minute
+	maxInvalidRowsShown = 10 // 导入结果中最多列出的无效行号
+)
+
+// importResult 是一次导入的统计
+type importResult struct {
+	Rows    int   // 读取的数据行数（不含表头和空行）
+	Added   int   // 新加入集合的用户数
+	Invalid []int // 无效的行号
+}
+
+// handleImportCommand 处理 /importusers 和 /importblocked：回复一个文件时直接导入，否则等待管理员上传文件
+func (b *BotInstance) handleImportCommand(kind string) func(msg *tgbotapi.Message) {
+	return func(msg *tgbotapi.Message) {
+		if reply := msg.ReplyToMessage; reply != nil && reply.Document != nil {
+			b.processUpload(msg.Chat.ID, msg.From.ID, kind, reply.Document)
+			return
+		}
+		b.pendingImports[msg.Chat.ID] = kind
+		prompt := "请上传要导入的文件：CSV（包含 id 列，或第一列为用户 ID）或每行一个用户 ID 的文本文件。"
+		if kind == importRestore {
+			prompt = "请上传 /backup 生成的备份文件。备份中的键会覆盖现有数据，备份中没有的键保持不变。"
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, prompt+"发送 /cancelimport 取消。"))
+	}
+}
+
+// handleCancelImport 处理 /cancelimport：取消等待上传的导入
+func (b *BotInstance) handleCancelImport(msg *tgbotapi.Message) {
+	if _, ok := b.pendingImports[msg.Chat.ID]; !ok {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "当前没有等待上传的导入。"))
+		return
+	}
+	delete(b.pendingImports, msg.Chat.ID)
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "已取消导入。"))
+}
+
+// handlePendingImport 如果会话正在等待导入文件，处理管理员上传的文件并返回 true
+func (b *BotInstance) handlePendingImport(msg *tgbotapi.Message) bool {
+	kind, ok := b.pendingImports[msg.Chat.ID]
+	if !ok {
+		return false
+	}
+	if msg.Document == nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "请以文件形式上传要导入的列表，或发送 /cancelimport 取消。"))
+		return true
+	}
+	delete(b.pendingImports, msg.Chat.ID)
+	b.processUpload(msg.Chat.ID, msg.From.ID, kind, msg.Document)
+	return true
+}
+
+// processUpload 按导入类型处理上传的文件
+func (b *BotInstance) processUpload(chatID, adminID int64, kind string, doc *tgbotapi.Document) {
+	if limit := b.botAPI.maxDownloadSize(); doc.FileSize > limit {
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 文件超过 %d MB，机器人无法下载。", limit>>20)))
+		return
+	}
+	if kind == importRestore {
+		b.restoreDocument(chatID, adminID, doc)
+		return
+	}
+	b.importDocument(chatID, adminID, kind, doc)
+}
+
+// importDocument 在后台下载文件并导入其中的用户 ID，完成后发送统计
+func (b *BotInstance) importDocument(chatID, adminID int64, kind string, doc *tgbotapi.Document) {
+	b.API.Send(tgbotapi.NewMessage(chatID, "⏳ 正在导入…"))
+	go func() {
+		result, err := b.runImport(kind, doc.FileID)
+		if err != nil {
+			log.Printf("管理员 %d 导入 %s 失败: %v", adminID, kind, err)
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ 导入失败："+err.Error()))
+			return
+		}
+		log.Printf("管理员 %d 导入 %s：%d 行，新增 %d，无效 %d", adminID, kind, result.Rows, result.Added, len(result.Invalid))
+		b.audit(adminID, cache.AuditImport, fmt.Sprintf("导入 %s：%d 行，新增 %d，无效 %d", kind, result.Rows, result.Added, len(result.Invalid)))
+		b.API.Send(tgbotapi.NewMessage(chatID, formatImportResult(kind, result)))
+	}()
+}
+
+// runImport 下载文件，解析出用户 ID 并加入对应的集合
+func (b *BotInstance) runImport(kind, fileID string) (importResult, error) {
+	body, err := b.downloadFile(fileID)
+	if err != nil {
+		return importResult{}, err
+	}
+	defer body.Close()
+
+	userIDs, result, err := parseImportIDs(body)
+	if err != nil {
+		return result, err
+	}
+	ctx := context.Background()
+	if kind == importBlocked {
+		result.Added, err = b.redisClient.ImportBlockedUsers(ctx, userIDs)
+	} else {
+		result.Added, err = b.redisClient.ImportUsers(ctx, userIDs)
+	}
+	return result, err
+}
+
+// parseImportIDs 从 CSV 或每行一个 ID 的文本中读取用户 ID。
+// 第一行包含 id 列时视为表头并读取该列，否则读取每行的第一列；无效的行记录行号后跳过
+func parseImportIDs(r io.Reader) ([]int64, importResult, error) {
+	var result importResult
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	column := 0
+	var userIDs []int64
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Rows++
+				result.Invalid = append(result.Invalid, parseErr.Line)
+				continue
+			}
+			return nil, result, fmt.Errorf("读取文件失败: %w", err)
+		}
+		if first {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			if i := headerColumn(record, "id"); i >= 0 {
+				column = i
+				continue
+			}
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		result.Rows++
+		var userID int64
+		if column < len(record) {
+			userID, err = strconv.ParseInt(strings.TrimSpace(record[column]), 10, 64)
+		}
+		if err != nil || userID <= 0 {
+			row, _ := reader.FieldPos(0)
+			result.Invalid = append(result.Invalid, row)
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, result, nil
+}
+
+// headerColumn 返回表头中名为 name 的列（不区分大小写），没有时返回 -1
+func headerColumn(header []string, name string) int {
+	for i, field := range header {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func formatImportResult(kind string, result importResult) string {
+	target := "用户列表"
+	if kind == importBlocked {
+		target = "黑名单"
+	}
+	valid := result.Rows - len(result.Invalid)
+	text := fmt.Sprintf("✅ 导入%s完成：共 %d 行，新增 %d 位，已存在 %d 位，无效 %d 行。",
+		target, result.Rows, result.Added, valid-result.Added, len(result.Invalid))
+	if len(result.Invalid) > 0 {
+		lines := make([]string, 0, maxInvalidRowsShown)
+		for i, line := range result.Invalid {
+			if i == maxInvalidRowsShown {
+				lines = append(lines, "…")
+				break
+			}
+			lines = append(lines, strconv.Itoa(line))
+		}
+		text += "\n无效的行：" + strings.Join(lines, "、")
+	}
+	return text
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	inboxPagePrefix    = "inbox_page_" // 翻页按钮的回调前缀，后接偏移量
+	inboxDonePrefix    = "inbox_done_" // “本页标记已处理”的回调前缀，后接“偏移量_最早等待时间_最晚等待时间”（Unix 秒）
+	inboxSnippetLength = 40            // 每条待回复消息显示的摘要长度
+)
+
+// handleInbox 处理 /inbox：列出尚未被任何客服回复的用户
+func (b *BotInstance) handleInbox(msg *tgbotapi.Message) {
+	text, keyboard, err := b.inboxPage(0)
+	if err != nil {
+		log.Printf("获取待回复列表失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取待回复列表失败。"))
+		return
+	}
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyMarkup = keyboard
+	b.API.Send(reply)
+}
+
+// inboxPage 生成从 offset 开始的一页待回复列表，等待最久的排在最前，每位用户一个跳转到会话的按钮
+func (b *BotInstance) inboxPage(offset int64) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	ctx := context.Background()
+	waiting, total, err := b.redisClient.GetResponseWaiting(ctx, offset, UsersPerPage)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(waiting) == 0 && offset > 0 {
+		// 列表在翻页期间变短，回到第一页
+		offset = 0
+		if waiting, total, err = b.redisClient.GetResponseWaiting(ctx, 0, UsersPerPage); err != nil {
+			return "", nil, err
+		}
+	}
+	if total == 0 {
+		return "📭 所有用户消息都已回复。", nil, nil
+	}
+
+	now := time.Now()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📥 待回复的用户共 %d 位（第 %d-%d 位，等待最久的在前）：\n", total, offset+1, offset+int64(len(waiting))))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, item := range waiting {
+		sb.WriteString(fmt.Sprintf("\n%d. %s\n   已等待 %s", offset+int64(i)+1, b.userLabel(item.UserID), formatWait(now.Sub(item.Since))))
+		if entries, err := b.redisClient.GetHistory(ctx, item.UserID, 1); err == nil && len(entries) > 0 {
+			sb.WriteString("：" + truncateRunes(entries[0].Text, inboxSnippetLength))
+		}
+
+		label := fmt.Sprintf("💬 %d. 打开会话", offset+int64(i)+1)
+		url := fmt.Sprintf("tg://user?id=%d", item.UserID)
+		if ticket := b.userTicket(item.UserID); ticket != "" {
+			label = fmt.Sprintf("💬 %d. 工单 #%s", offset+int64(i)+1, ticket)
+			url = fmt.Sprintf("https://t.me/%s?start=%s%s", b.API.Self.UserName, ticketStartPrefix, ticket)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL(label, url)))
+	}
+
+	// 本页用户的等待开始时间按顺序排列，用首尾时间表示本页范围，避免在回调数据中列出所有用户
+	first, last := waiting[0].Since.Unix(), waiting[len(waiting)-1].Since.Unix()
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ 本页标记已处理", fmt.Sprintf("%s%d_%d_%d", inboxDonePrefix, offset, first, last)),
+	))
+	var pagination []tgbotapi.InlineKeyboardButton
+	if offset > 0 {
+		pagination = append(pagination, tgbotapi.NewInlineKeyboardButtonData("上一页", fmt.Sprintf("%s%d", inboxPagePrefix, max(offset-UsersPerPage, 0))))
+	}
+	if offset+int64(len(waiting)) < total {
+		pagination = append(pagination, tgbotapi.NewInlineKeyboardButtonData("下一页", fmt.Sprintf("%s%d", inboxPagePrefix, offset+UsersPerPage)))
+	}
+	if len(pagination) > 0 {
+		rows = append(rows, pagination)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard, nil
+}
+
+// handleInboxCallback 处理 /inbox 的翻页和“本页标记已处理”按钮
+func (b *BotInstance) handleInboxCallback(q *tgbotapi.CallbackQuery) {
+	if q.Message == nil {
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	var offset int64
+	answer := ""
+	if strings.HasPrefix(q.Data, inboxDonePrefix) {
+		parts := strings.Split(strings.TrimPrefix(q.Data, inboxDonePrefix), "_")
+		if len(parts) != 3 {
+			b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+			return
+		}
+		offset, _ = strconv.ParseInt(parts[0], 10, 64)
+		from, err1 := strconv.ParseInt(parts[1], 10, 64)
+		to, err2 := strconv.ParseInt(parts[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+			return
+		}
+		userIDs, err := b.redisClient.ClearResponseWaitBetween(context.Background(), time.Unix(from, 0), time.Unix(to, 0))
+		if err != nil {
+			log.Printf("管理员 %d 批量标记待回复消息失败: %v", q.From.ID, err)
+			b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 操作失败，请稍后再试"))
+			return
+		}
+		for _, userID := range userIDs {
+			b.clearAwaitingReply(userID)
+		}
+		log.Printf("管理员 %d 将 %d 位用户的消息标记为已处理", q.From.ID, len(userIDs))
+		answer = fmt.Sprintf("✅ 已将 %d 位用户标记为已处理", len(userIDs))
+	} else {
+		offset, _ = strconv.ParseInt(strings.TrimPrefix(q.Data, inboxPagePrefix), 10, 64)
+	}
+
+	text, keyboard, err := b.inboxPage(max(offset, 0))
+	if err != nil {
+		log.Printf("获取待回复列表失败: %v", err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 获取待回复列表失败"))
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	b.API.Send(edit)
+	b.API.Request(tgbotapi.NewCallback(q.ID, answer))
+}
@@ -0,0 +1,240 @@
+package autoreply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// State constants for the auto-reply editor
+const (
+	StateAwaitingAutoReplyRule = iota + 30 // Use a higher start value to avoid conflicts
+)
+
+// regexPrefix 规则以此开头时按正则表达式匹配，否则按关键词（不区分大小写）匹配
+const regexPrefix = "re:"
+
+// Rule is a single auto-reply rule.
+type Rule struct {
+	ID      string `json:"-"`
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex,omitempty"`
+	Reply   string `json:"reply"`
+}
+
+// Manager handles keyword auto-replies and the admin flow that edits them.
+type Manager struct {
+	API         *tgbotapi.BotAPI
+	RedisClient *cache.RedisClient
+	AdminStates map[int64]int
+
+	compiledMu sync.Mutex                // 用户消息可能被多个协程同时匹配
+	compiled   map[string]*regexp.Regexp // 已编译的正则，按表达式缓存
+}
+
+// NewManager creates a new auto-reply manager.
+func NewManager(api *tgbotapi.BotAPI, redisClient *cache.RedisClient, adminStates map[int64]int) *Manager {
+	return &Manager{
+		API:         api,
+		RedisClient: redisClient,
+		AdminStates: adminStates,
+		compiled:    make(map[string]*regexp.Regexp),
+	}
+}
+
+// Match returns the reply of the first rule (in creation order) matching text.
+func (m *Manager) Match(text string) (string, bool) {
+	if strings.TrimSpace(text) == "" {
+		return "", false
+	}
+	rules, err := m.rules(context.Background())
+	if err != nil {
+		log.Printf("读取自动回复规则失败: %v", err)
+		return "", false
+	}
+	lower := strings.ToLower(text)
+	for _, rule := range rules {
+		if rule.Regex {
+			re := m.regexp(rule.Pattern)
+			if re != nil && re.MatchString(text) {
+				return rule.Reply, true
+			}
+			continue
+		}
+		if strings.Contains(lower, strings.ToLower(rule.Pattern)) {
+			return rule.Reply, true
+		}
+	}
+	return "", false
+}
+
+// StartSetAutoReplyProcess lists the current rules and asks the admin for a new one.
+func (m *Manager) StartSetAutoReplyProcess(chatID int64) {
+	rules, err := m.rules(context.Background())
+	if err != nil {
+		log.Printf("读取自动回复规则失败: %v", err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 读取自动回复规则失败。"))
+		return
+	}
+
+	var sb strings.Builder
+	if len(rules) == 0 {
+		sb.WriteString("当前没有自动回复规则。\n\n")
+	} else {
+		sb.WriteString("当前自动回复规则（按添加顺序匹配，点击下方按钮删除）：\n")
+		for _, rule := range rules {
+			sb.WriteString(fmt.Sprintf("#%s %s → %s\n", rule.ID, describePattern(rule), preview(rule.Reply)))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("请发送新规则，格式为：\n关键词 | 回复内容\n\n例如：\n价格 | 套餐价格请查看 https://example.com/price\nre:(地址|在哪) | 我们的地址是……\n\n关键词不区分大小写；以 re: 开头的按正则表达式匹配。命中规则的用户消息会直接自动回复，不再转发给客服。发送 /cancel 取消。")
+	if m.API.Self.SupportsInlineQueries {
+		sb.WriteString(fmt.Sprintf("\n\n在任意聊天中输入 @%s 关键词，可以快速选择并发送这些回复。", m.API.Self.UserName))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	if len(rules) > 0 {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, rule := range rules {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🗑 删除 #"+rule.ID+" "+describePattern(rule), "ar_del_"+rule.ID),
+			))
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	m.API.Send(msg)
+	m.AdminStates[chatID] = StateAwaitingAutoReplyRule
+}
+
+// HandleAdminMessageInput processes messages from admins while they are adding an auto-reply rule.
+func (m *Manager) HandleAdminMessageInput(msg *tgbotapi.Message) bool {
+	if m.AdminStates[msg.Chat.ID] != StateAwaitingAutoReplyRule {
+		return false
+	}
+	chatID := msg.Chat.ID
+
+	rule, err := parseRule(msg.Text)
+	if err != nil {
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"\n请重新发送，或发送 /cancel 取消。"))
+		return true
+	}
+	payload, _ := json.Marshal(rule)
+	id, err := m.RedisClient.AddAutoReplyRule(context.Background(), string(payload))
+	if err != nil {
+		log.Printf("保存自动回复规则失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 保存自动回复规则失败，请稍后再试。"))
+		return true
+	}
+	m.AdminStates[chatID] = 0 // StateNone
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已添加自动回复规则 #%s：%s", id, describePattern(rule))))
+	log.Printf("添加自动回复规则 %s（%s），chatID: %d", id, rule.Pattern, chatID)
+	return true
+}
+
+// HandleCallbackQuery handles the delete buttons of the rule list.
+func (m *Manager) HandleCallbackQuery(q *tgbotapi.CallbackQuery) bool {
+	if !strings.HasPrefix(q.Data, "ar_del_") {
+		return false
+	}
+	id := strings.TrimPrefix(q.Data, "ar_del_")
+	deleted, err := m.RedisClient.DeleteAutoReplyRule(context.Background(), id)
+	if err != nil {
+		log.Printf("删除自动回复规则 %s 失败: %v", id, err)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 删除失败"))
+		return true
+	}
+	if !deleted {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "规则不存在或已删除"))
+		return true
+	}
+	m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 规则已删除"))
+	m.API.Request(tgbotapi.NewDeleteMessage(q.Message.Chat.ID, q.Message.MessageID))
+	m.StartSetAutoReplyProcess(q.Message.Chat.ID)
+	log.Printf("删除自动回复规则 %s，chatID: %d", id, q.Message.Chat.ID)
+	return true
+}
+
+// rules 读取所有规则并按 ID（即添加顺序）排序
+func (m *Manager) rules(ctx context.Context) ([]Rule, error) {
+	raw, err := m.RedisClient.GetAutoReplyRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]Rule, 0, len(raw))
+	for id, payload := range raw {
+		var rule Rule
+		if err := json.Unmarshal([]byte(payload), &rule); err != nil {
+			log.Printf("解析自动回复规则 %s 失败: %v", id, err)
+			continue
+		}
+		rule.ID = id
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		a, _ := strconv.Atoi(rules[i].ID)
+		b, _ := strconv.Atoi(rules[j].ID)
+		return a < b
+	})
+	return rules, nil
+}
+
+// regexp 返回已编译的正则表达式，无效时返回 nil
+func (m *Manager) regexp(pattern string) *regexp.Regexp {
+	m.compiledMu.Lock()
+	defer m.compiledMu.Unlock()
+	if re, ok := m.compiled[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("自动回复正则 %q 无效: %v", pattern, err)
+	}
+	m.compiled[pattern] = re
+	return re
+}
+
+// parseRule 解析“关键词 | 回复内容”格式的规则，回复内容可以包含多行
+func parseRule(text string) (Rule, error) {
+	parts := strings.SplitN(text, "|", 2)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("格式不正确，应为：关键词 | 回复内容")
+	}
+	rule := Rule{Pattern: strings.TrimSpace(parts[0]), Reply: strings.TrimSpace(parts[1])}
+	if strings.HasPrefix(rule.Pattern, regexPrefix) {
+		rule.Regex = true
+		rule.Pattern = strings.TrimSpace(strings.TrimPrefix(rule.Pattern, regexPrefix))
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return Rule{}, fmt.Errorf("正则表达式无效：%v", err)
+		}
+	}
+	if rule.Pattern == "" || rule.Reply == "" {
+		return Rule{}, fmt.Errorf("关键词和回复内容都不能为空")
+	}
+	return rule, nil
+}
+
+func describePattern(rule Rule) string {
+	if rule.Regex {
+		return regexPrefix + rule.Pattern
+	}
+	return rule.Pattern
+}
+
+// preview 截取回复内容的开头用于列表展示
+func preview(text string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if runes := []rune(text); len(runes) > 30 {
+		return string(runes[:30]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,70 @@
+package autoreply
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// maxInlineResults Telegram 每次内联查询最多返回 50 条结果
+	maxInlineResults = 50
+	// InlineStartParameter 没有匹配结果时“点此添加”按钮打开私聊所带的 start 参数
+	InlineStartParameter = "autoreply"
+)
+
+// HandleInlineQuery answers "@bot <keyword>" with the auto-reply rules matching the keyword,
+// so admins can send a canned answer in any chat. Callers must check that the sender is an admin.
+func (m *Manager) HandleInlineQuery(q *tgbotapi.InlineQuery) {
+	rules, err := m.rules(context.Background())
+	if err != nil {
+		log.Printf("读取自动回复规则失败: %v", err)
+	}
+
+	results := make([]interface{}, 0, min(len(rules), maxInlineResults))
+	for _, rule := range m.searchRules(rules, q.Query) {
+		if len(results) == maxInlineResults {
+			break
+		}
+		article := tgbotapi.NewInlineQueryResultArticle("ar_"+rule.ID, describePattern(rule), rule.Reply)
+		article.Description = preview(rule.Reply)
+		results = append(results, article)
+	}
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: q.ID,
+		Results:       results,
+		IsPersonal:    true,
+		CacheTime:     0, // 规则修改后立即生效
+	}
+	if len(results) == 0 {
+		answer.SwitchPMText = "没有匹配的回复，点此添加"
+		answer.SwitchPMParameter = InlineStartParameter
+	}
+	if _, err := m.API.Request(answer); err != nil {
+		log.Printf("回答内联查询失败: %v", err)
+	}
+}
+
+// searchRules 返回关键词、正则或回复内容与 query 匹配的规则，query 为空时返回全部规则
+func (m *Manager) searchRules(rules []Rule, query string) []Rule {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return rules
+	}
+	var matched []Rule
+	for _, rule := range rules {
+		switch {
+		case strings.Contains(strings.ToLower(rule.Pattern), query),
+			strings.Contains(strings.ToLower(rule.Reply), query):
+			matched = append(matched, rule)
+		case rule.Regex:
+			if re := m.regexp(rule.Pattern); re != nil && re.MatchString(query) {
+				matched = append(matched, rule)
+			}
+		}
+	}
+	return matched
+}
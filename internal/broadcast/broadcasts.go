@@ -2,12 +2,17 @@ package broadcast
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
 
 	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/keyboard"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -17,14 +22,65 @@ const (
 	StateBroadcastAwaitText = iota + 10 // Use a higher start value to avoid conflicts
 	StateBroadcastAwaitMedia
 	StateBroadcastAwaitButtons
+	StateBroadcastAwaitScheduleTime
+	StateBroadcastAwaitTemplateName
+	StateBroadcastAwaitLibraryName
+	StateBroadcastAwaitCopySource
+	StateBroadcastAwaitRecurringSpec
+	StateBroadcastAwaitButtonText
+	StateBroadcastAwaitButtonTarget
+)
+
+const (
+	DefaultWorkers    = 4  // 默认并发发送数，保持较小以免触发 Telegram 限制
+	MaxSendsPerSecond = 25 // 所有广播合计的每秒发送上限
+)
+
+// Telegram 的长度上限，按 UTF-16 编码单元计算
+const (
+	MaxCaptionLength = 1024
+	MaxMessageLength = 4096
+)
+
+// textLength 按 Telegram 的计数方式（UTF-16 编码单元）计算文本长度
+func textLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// captionWillSplit 报告媒体广播的文本是否超出标题上限，需要拆成媒体和文本两条消息发送
+func captionWillSplit(broadcast Message) bool {
+	return broadcast.MediaID != "" && textLength("📢 "+broadcast.Text) > MaxCaptionLength
+}
+
+// Audience 决定广播的接收人范围
+const (
+	AudienceAll  = ""     // 所有用户
+	AudienceTest = "test" // 仅广播测试组
 )
 
 // Message defines the structure for a broadcast message.
 type Message struct {
-	Text    string
-	MediaID string
-	Type    string // "photo", "video", etc.
-	Buttons tgbotapi.InlineKeyboardMarkup
+	Text        string                        `json:"text"`
+	MediaID     string                        `json:"media_id"`
+	Type        string                        `json:"type"` // "photo", "video", etc.
+	Buttons     tgbotapi.InlineKeyboardMarkup `json:"buttons"`
+	TrackClicks bool                          `json:"track_clicks,omitempty"` // 按钮改为回调按钮以记录点击
+	Target      string                        `json:"target,omitempty"`       // 接收范围：AudienceAll 或按标签筛选
+	Silent      bool                          `json:"silent,omitempty"`       // 静默发送（disable_notification），用户收到时不响铃
+	Protect     bool                          `json:"protect,omitempty"`      // 禁止转发和保存（protect_content）
+	ParseMode   string                        `json:"parse_mode,omitempty"`   // 文本格式：空为纯文本，或 MarkdownV2、HTML
+
+	// 复制模式：原样复制管理员发送或转发的消息，不使用上面的文本、媒体和按钮
+	CopyFromChatID   int64  `json:"copy_from_chat_id,omitempty"`
+	CopyMessageIDs   []int  `json:"copy_message_ids,omitempty"` // 相册包含多条消息
+	CopyMediaGroupID string `json:"copy_media_group_id,omitempty"`
+}
+
+// broadcastJob 是发送中广播的持久化内容，用于重启后继续发送
+type broadcastJob struct {
+	ChatID   int64   `json:"chat_id"`
+	Message  Message `json:"message"`
+	Audience string  `json:"audience,omitempty"`
 }
 
 // Manager handles all broadcast-related logic.
@@ -34,6 +90,18 @@ type Manager struct {
 	AdminStates               map[int64]int
 	Broadcasts                map[int64]Message
 	BroadcastPromptMessageIDs map[int64]int
+	Workers                   int    // 每个广播的并发发送数
+	DefaultParseMode          string // 新建广播的默认文本格式，空为纯文本
+
+	// OnFinish 在广播（测试广播除外）发送结束或被停止后调用，可为 nil
+	OnFinish func(result Result)
+
+	limiter *rateLimiter // 全局发送限流，所有广播的所有 worker 共享
+
+	buttonEdits map[int64]*buttonEdit // 按钮编辑器中正在添加、修改或移动的按钮
+
+	runMu   sync.Mutex
+	running map[string]context.CancelFunc // 正在发送的广播，用于“停止发送”
 }
 
 // NewManager creates a new broadcast manager.
@@ -44,13 +112,27 @@ func NewManager(api *tgbotapi.BotAPI, redisClient *cache.RedisClient, adminState
 		AdminStates:               adminStates,
 		Broadcasts:                make(map[int64]Message),
 		BroadcastPromptMessageIDs: make(map[int64]int),
+		Workers:                   DefaultWorkers,
+		limiter:                   newRateLimiter(),
+		buttonEdits:               make(map[int64]*buttonEdit),
+		running:                   make(map[string]context.CancelFunc),
 	}
 }
 
+// Reset 清除 chatID 未完成的广播草稿和按钮编辑，返回是否有需要清除的内容
+func (m *Manager) Reset(chatID int64) bool {
+	_, draft := m.Broadcasts[chatID]
+	_, edit := m.buttonEdits[chatID]
+	delete(m.Broadcasts, chatID)
+	delete(m.BroadcastPromptMessageIDs, chatID)
+	delete(m.buttonEdits, chatID)
+	return draft || edit
+}
+
 // StartBroadcastBuilder initializes the broadcast creation process for an admin.
 func (m *Manager) StartBroadcastBuilder(chatID int64) {
 	log.Printf("开始广播构建，chatID: %d", chatID)
-	m.Broadcasts[chatID] = Message{}
+	m.Broadcasts[chatID] = Message{ParseMode: m.DefaultParseMode}
 	m.AdminStates[chatID] = StateBroadcastAwaitText
 	msg := tgbotapi.NewMessage(chatID, "请输入广播的文本内容，或点击下方按钮取消：")
 	msg.ReplyMarkup = m.getCancelKeyboard()
@@ -63,6 +145,38 @@ func (m *Manager) StartBroadcastBuilder(chatID int64) {
 
 // HandleCallbackQuery processes callback queries related to the broadcast builder.
 func (m *Manager) HandleCallbackQuery(q *tgbotapi.CallbackQuery) bool {
+	if strings.HasPrefix(q.Data, "sched_cancel_") {
+		m.cancelScheduledBroadcast(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "btpl_") {
+		m.handleTemplateCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "brec_") {
+		m.handleRecurringCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "bcopy_") {
+		m.handleCopyCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "bstop_") {
+		m.handleStopCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "blib_") {
+		m.handleLibraryCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "bclick_") {
+		m.handleClickCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "bbtn_") {
+		m.handleButtonEditorCallback(q)
+		return true
+	}
 	if !strings.HasPrefix(q.Data, "bbuild_") {
 		return false
 	}
@@ -70,6 +184,14 @@ func (m *Manager) HandleCallbackQuery(q *tgbotapi.CallbackQuery) bool {
 	log.Printf("处理广播回调，chatID %d，数据: %s", q.Message.Chat.ID, q.Data)
 	callback := tgbotapi.NewCallback(q.ID, "")
 	m.API.Request(callback)
+	if strings.HasPrefix(q.Data, "bbuild_tgt_") {
+		m.handleTargetCallback(q)
+		return true
+	}
+	if strings.HasPrefix(q.Data, "bbuild_pm_") {
+		m.handleParseModeCallback(q)
+		return true
+	}
 
 	chatID := q.Message.Chat.ID
 	action := q.Data
@@ -98,40 +220,19 @@ func (m *Manager) HandleCallbackQuery(q *tgbotapi.CallbackQuery) bool {
 		currentBroadcast.MediaID = ""
 		currentBroadcast.Type = ""
 		m.Broadcasts[chatID] = currentBroadcast
-		m.AdminStates[chatID] = StateBroadcastAwaitButtons
 		callback := tgbotapi.NewCallback(q.ID, "✅ 已跳过媒体设置")
 		m.API.Request(callback)
-		msgText := "媒体已跳过！请输入广播的按钮，每行一个，格式为：\n`按钮文字 | 链接`\n\n例如：\n`关注频道 | https://t.me/channel`\n`靓号商城 | https://t.me/store`\n或点击下方按钮跳过（清除按钮）："
-		msg := tgbotapi.NewMessage(chatID, msgText)
-		msg.ParseMode = tgbotapi.ModeMarkdown
-		msg.ReplyMarkup = m.getSkipButtonsKeyboard()
-		_, err := m.API.Send(msg)
-		if err != nil {
-			log.Printf("发送按钮设置提示失败，chatID %d: %v", chatID, err)
-		}
-		log.Printf("媒体跳过，切换到 StateBroadcastAwaitButtons，chatID: %d", chatID)
+		m.sendButtonEditor(chatID, "媒体已跳过！请设置广播的按钮，不需要按钮时直接点击「✅ 完成」。")
+		log.Printf("媒体跳过，打开按钮编辑器，chatID: %d", chatID)
 	case "bbuild_set_buttons":
-		m.AdminStates[chatID] = StateBroadcastAwaitButtons
-		msgText := "请输入广播的按钮，每行一个，格式为：\n`按钮文字 | 链接`\n\n例如：\n`关注频道 | https://t.me/channel`\n`靓号商城 | https://t.me/store`\n或点击下方按钮跳过（清除按钮）："
-		msg := tgbotapi.NewMessage(chatID, msgText)
-		msg.ParseMode = tgbotapi.ModeMarkdown
-		msg.ReplyMarkup = m.getSkipButtonsKeyboard()
-		_, err := m.API.Send(msg)
-		if err != nil {
-			log.Printf("发送按钮设置提示失败，chatID %d: %v", chatID, err)
-		}
-		log.Printf("设置状态为 StateBroadcastAwaitButtons，chatID: %d", chatID)
-	case "bbuild_skip_buttons":
-		currentBroadcast := m.Broadcasts[chatID]
-		currentBroadcast.Buttons = tgbotapi.NewInlineKeyboardMarkup()
-		m.Broadcasts[chatID] = currentBroadcast
-		m.AdminStates[chatID] = 0 // StateNone
-		callback := tgbotapi.NewCallback(q.ID, "✅ 已跳过按钮设置")
-		m.API.Request(callback)
-		m.sendBroadcastBuilderMenu(chatID)
-		log.Printf("按钮跳过，切换到 StateNone，chatID: %d", chatID)
+		m.sendButtonEditor(chatID, "")
+		log.Printf("打开按钮编辑器，chatID: %d", chatID)
 	case "bbuild_preview":
 		m.sendBroadcastPreview(chatID)
+	case "bbuild_target":
+		m.sendTargetMenu(chatID)
+	case "bbuild_parse_mode":
+		m.sendParseModeMenu(chatID)
 	case "bbuild_cancel":
 		m.AdminStates[chatID] = 0 // StateNone
 		delete(m.Broadcasts, chatID)
@@ -141,8 +242,42 @@ func (m *Manager) HandleCallbackQuery(q *tgbotapi.CallbackQuery) bool {
 		msg := tgbotapi.NewMessage(chatID, "广播创建已取消。")
 		m.API.Send(msg)
 		log.Printf("广播创建已取消，chatID: %d", chatID)
+	case "bbuild_save_template":
+		m.promptTemplateName(chatID)
+	case "bbuild_templates":
+		m.sendTemplateList(chatID)
+	case "bbuild_save_library":
+		m.promptBroadcastTemplateName(chatID)
+	case "bbuild_schedule":
+		m.promptScheduleTime(chatID)
+	case "bbuild_recurring":
+		m.promptRecurringSpec(chatID)
+	case "bbuild_test_send":
+		m.executeTestBroadcast(chatID)
+	case "bbuild_toggle_track":
+		currentBroadcast := m.Broadcasts[chatID]
+		currentBroadcast.TrackClicks = !currentBroadcast.TrackClicks
+		m.Broadcasts[chatID] = currentBroadcast
+		m.sendBroadcastBuilderMenu(chatID)
+	case "bbuild_toggle_silent":
+		currentBroadcast := m.Broadcasts[chatID]
+		currentBroadcast.Silent = !currentBroadcast.Silent
+		m.Broadcasts[chatID] = currentBroadcast
+		m.sendBroadcastBuilderMenu(chatID)
+	case "bbuild_toggle_protect":
+		currentBroadcast := m.Broadcasts[chatID]
+		currentBroadcast.Protect = !currentBroadcast.Protect
+		m.Broadcasts[chatID] = currentBroadcast
+		m.sendBroadcastBuilderMenu(chatID)
+	case "bbuild_send_unengaged":
+		if m.executeUnengagedBroadcast(q) {
+			m.AdminStates[chatID] = 0 // StateNone
+			delete(m.Broadcasts, chatID)
+			delete(m.BroadcastPromptMessageIDs, chatID)
+			m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		}
 	case "bbuild_send":
-		m.executeBroadcast(chatID)
+		m.executeBroadcast(chatID, q.From.ID)
 		m.AdminStates[chatID] = 0 // StateNone
 		delete(m.Broadcasts, chatID)
 		delete(m.BroadcastPromptMessageIDs, chatID)
@@ -174,6 +309,20 @@ func (m *Manager) HandleMessageInput(msg *tgbotapi.Message) bool {
 			m.API.Send(errMsg)
 			return true
 		}
+		if textLength("📢 "+msg.Text) > MaxMessageLength {
+			log.Printf("广播文本过长，chatID %d", chatID)
+			errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("文本过长，Telegram 单条消息最多 %d 个字符，请精简后重新输入。", MaxMessageLength))
+			errMsg.ReplyMarkup = m.getCancelKeyboard()
+			m.API.Send(errMsg)
+			return true
+		}
+		if err := m.validateBroadcastText(chatID, currentBroadcast.ParseMode, msg.Text); err != nil {
+			log.Printf("广播文本格式错误，chatID %d: %v", chatID, err)
+			errMsg := tgbotapi.NewMessage(chatID, err.Error()+"\n\n请修改后重新输入，或点击下方按钮取消。")
+			errMsg.ReplyMarkup = m.getCancelKeyboard()
+			m.API.Send(errMsg)
+			return true
+		}
 		currentBroadcast.Text = msg.Text
 		m.Broadcasts[chatID] = currentBroadcast
 		m.AdminStates[chatID] = StateBroadcastAwaitMedia
@@ -206,50 +355,49 @@ func (m *Manager) HandleMessageInput(msg *tgbotapi.Message) bool {
 		currentBroadcast.MediaID = mediaID
 		currentBroadcast.Type = mediaType
 		m.Broadcasts[chatID] = currentBroadcast
-		m.AdminStates[chatID] = StateBroadcastAwaitButtons
 		deleteUserMsg := tgbotapi.NewDeleteMessage(chatID, msg.MessageID)
 		m.API.Request(deleteUserMsg)
-		buttonPrompt := tgbotapi.NewMessage(chatID, "媒体已设置！请输入广播的按钮，每行一个，格式为：\n`按钮文字 | 链接`\n\n例如：\n`关注频道 | https://t.me/channel`\n`靓号商城 | https://t.me/store`\n或点击下方按钮跳过（清除按钮）：")
-		buttonPrompt.ParseMode = tgbotapi.ModeMarkdown
-		buttonPrompt.ReplyMarkup = m.getSkipButtonsKeyboard()
-		_, err := m.API.Send(buttonPrompt)
-		if err != nil {
-			log.Printf("发送按钮提示失败，chatID %d: %v", chatID, err)
-		}
-		log.Printf("媒体设置完成，切换到 StateBroadcastAwaitButtons，chatID: %d", chatID)
+		m.sendButtonEditor(chatID, "媒体已设置！请设置广播的按钮，不需要按钮时直接点击「✅ 完成」。")
+		log.Printf("媒体设置完成，打开按钮编辑器，chatID: %d", chatID)
 
 	case StateBroadcastAwaitButtons:
-		lines := strings.Split(msg.Text, "\n")
-		for i, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-			parts := strings.SplitN(line, "|", 2)
-			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
-				log.Printf("无效按钮格式，chatID %d，第 %d 行: %s", chatID, i+1, line)
-				errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("第 %d 行格式错误：%s\n正确格式为：按钮文字 | 链接\n例如：关注频道 | https://t.me/channel", i+1, line))
-				errMsg.ReplyMarkup = m.getSkipButtonsKeyboard()
-				m.API.Send(errMsg)
-				return true
-			}
-			url := strings.TrimSpace(parts[1])
-			url = strings.Trim(url, "`")
-			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-				log.Printf("无效 URL，chatID %d，第 %d 行: %s", chatID, i+1, url)
-				errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("第 %d 行 URL 无效：%s\n请使用 http:// 或 https:// 开头的链接", i+1, url))
-				errMsg.ReplyMarkup = m.getSkipButtonsKeyboard()
-				m.API.Send(errMsg)
-				return true
-			}
+		if err := keyboard.Validate(msg.Text); err != nil {
+			log.Printf("无效按钮格式，chatID %d: %v", chatID, err)
+			errMsg := tgbotapi.NewMessage(chatID, "❌ "+err.Error())
+			errMsg.ReplyMarkup = buttonEditorBackKeyboard()
+			m.API.Send(errMsg)
+			return true
 		}
-		currentBroadcast.Buttons = ParseButtons(msg.Text)
+		if !m.saveCallbackReplies(chatID, keyboard.CallbackReplies(msg.Text)) {
+			errMsg := tgbotapi.NewMessage(chatID, "❌ 保存回调按钮失败，请稍后重试。")
+			errMsg.ReplyMarkup = buttonEditorBackKeyboard()
+			m.API.Send(errMsg)
+			return true
+		}
+		currentBroadcast.Buttons = keyboard.Parse(msg.Text)
 		m.Broadcasts[chatID] = currentBroadcast
-		m.AdminStates[chatID] = 0 // StateNone
 		deleteUserMsg := tgbotapi.NewDeleteMessage(chatID, msg.MessageID)
 		m.API.Request(deleteUserMsg)
-		m.sendBroadcastBuilderMenu(chatID)
-		log.Printf("按钮设置完成，切换到 StateNone，chatID: %d", chatID)
+		m.sendButtonEditor(chatID, "✅ 按钮已设置，可继续调整或点击「✅ 完成」。")
+		log.Printf("按钮批量设置完成，chatID: %d", chatID)
+
+	case StateBroadcastAwaitScheduleTime:
+		m.handleScheduleTimeInput(msg)
+
+	case StateBroadcastAwaitTemplateName:
+		m.handleTemplateNameInput(msg)
+
+	case StateBroadcastAwaitLibraryName:
+		m.handleBroadcastTemplateNameInput(msg)
+
+	case StateBroadcastAwaitCopySource:
+		m.handleCopySourceInput(msg)
+
+	case StateBroadcastAwaitRecurringSpec:
+		m.handleRecurringSpecInput(msg)
+
+	case StateBroadcastAwaitButtonText, StateBroadcastAwaitButtonTarget:
+		m.handleButtonFieldInput(msg)
 	}
 	return true
 }
@@ -261,13 +409,6 @@ func (m *Manager) getSkipMediaKeyboard() tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(row)
 }
 
-// getSkipButtonsKeyboard 获取跳过按钮的键盘
-func (m *Manager) getSkipButtonsKeyboard() tgbotapi.InlineKeyboardMarkup {
-	skipButton := tgbotapi.NewInlineKeyboardButtonData("⏭️ 跳过按钮", "bbuild_skip_buttons")
-	row := tgbotapi.NewInlineKeyboardRow(skipButton)
-	return tgbotapi.NewInlineKeyboardMarkup(row)
-}
-
 // getCancelKeyboard 获取取消的键盘
 func (m *Manager) getCancelKeyboard() tgbotapi.InlineKeyboardMarkup {
 	cancelButton := tgbotapi.NewInlineKeyboardButtonData("❌ 取消广播", "bbuild_cancel")
@@ -281,10 +422,11 @@ func (m *Manager) sendBroadcastBuilderMenu(chatID int64) {
 	text += "请确认你的广播消息内容：\n\n"
 	text += "1️⃣ **文本内容:** "
 	if broadcast.Text != "" {
-		text += fmt.Sprintf("✅ %s\n", broadcast.Text)
+		text += fmt.Sprintf("✅ %s\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdown, broadcast.Text))
 	} else {
 		text += "❌ (未设置)\n"
 	}
+	text += fmt.Sprintf("🔤 **文本格式:** %s\n", parseModeLabel(broadcast.ParseMode))
 
 	text += "2️⃣ **媒体内容 (图片/视频):** "
 	if broadcast.MediaID != "" {
@@ -299,11 +441,33 @@ func (m *Manager) sendBroadcastBuilderMenu(chatID int64) {
 	} else {
 		text += "❌ (未设置)\n"
 	}
+	text += fmt.Sprintf("4️⃣ **接收对象:** %s\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdown, targetLabel(broadcast.Target)))
+	if count, err := m.reachableCount(context.Background(), broadcast.Target); err != nil {
+		log.Printf("统计广播可送达人数失败，chatID %d: %v", chatID, err)
+	} else {
+		text += fmt.Sprintf("📬 **可送达:** %d 位用户（已排除退订广播和屏蔽机器人的用户）\n", count)
+	}
+	if broadcast.TrackClicks {
+		text += "📊 **点击追踪:** 已开启（用户点击按钮后会收到链接）\n"
+	}
+	if broadcast.Silent {
+		text += "🔕 **静默发送:** 已开启（用户收到消息时不会响铃）\n"
+	}
+	if broadcast.Protect {
+		text += "🔒 **禁止转发:** 已开启（用户无法转发或保存消息）\n"
+	}
+	if captionWillSplit(broadcast) {
+		text += fmt.Sprintf("\n⚠️ 文本超过媒体标题的 %d 字符上限，发送时将先发送媒体，再单独发送完整文本（按钮附在文本消息上）。\n", MaxCaptionLength)
+	}
 	text += "\n"
 
 	if broadcast.Text != "" || broadcast.MediaID != "" {
 		text += "点击 **发送预览** 查看当前效果。\n"
-		text += "点击 **确认发送** 将消息推送给所有用户。\n"
+		text += "点击 **发送给测试组** 先在测试用户的不同客户端上确认效果。\n"
+		if _, note := m.unengagedSegment(context.Background()); note != "" {
+			text += fmt.Sprintf("“上次广播未互动用户”暂不可用：%s。\n", note)
+		}
+		text += fmt.Sprintf("点击 **确认发送** 将消息推送给%s。\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdown, targetLabel(broadcast.Target)))
 	} else {
 		text += "请至少设置文本或媒体内容以继续。\n"
 	}
@@ -334,19 +498,57 @@ func (m *Manager) getBroadcastBuilderKeyboard(broadcast Message) tgbotapi.Inline
 	)
 	row2 := tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("3️⃣ 修改按钮", "bbuild_set_buttons"),
+		tgbotapi.NewInlineKeyboardButtonData("📁 从模板选择", "bbuild_templates"),
 	)
-	rows = append(rows, row1, row2)
+	row3 := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("4️⃣ 修改接收对象", "bbuild_target"),
+		tgbotapi.NewInlineKeyboardButtonData("🔤 文本格式", "bbuild_parse_mode"),
+	)
+	silentText := "🔕 静默发送：关"
+	if broadcast.Silent {
+		silentText = "🔕 静默发送：开"
+	}
+	protectText := "🔒 禁止转发：关"
+	if broadcast.Protect {
+		protectText = "🔒 禁止转发：开"
+	}
+	row4 := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(silentText, "bbuild_toggle_silent"),
+		tgbotapi.NewInlineKeyboardButtonData(protectText, "bbuild_toggle_protect"),
+	)
+	rows = append(rows, row1, row2, row3, row4)
+
+	if len(broadcast.Buttons.InlineKeyboard) > 0 {
+		trackText := "📊 点击追踪：关"
+		if broadcast.TrackClicks {
+			trackText = "📊 点击追踪：开"
+		}
+		templateRow := tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💾 保存为模板", "bbuild_save_template"),
+			tgbotapi.NewInlineKeyboardButtonData(trackText, "bbuild_toggle_track"),
+		)
+		rows = append(rows, templateRow)
+	}
 
 	if broadcast.Text != "" || broadcast.MediaID != "" {
 		previewRow := tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("👀 发送预览", "bbuild_preview"),
+			tgbotapi.NewInlineKeyboardButtonData("🧪 发送给测试组", "bbuild_test_send"),
+		)
+		libraryRow := tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📝 保存为广播模板", "bbuild_save_library"),
+			tgbotapi.NewInlineKeyboardButtonData("🔁 周期发送", "bbuild_recurring"),
 		)
-		rows = append(rows, previewRow)
+		rows = append(rows, previewRow, libraryRow)
 
 		sendRow := tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🚀 确认发送", "bbuild_send"),
+			tgbotapi.NewInlineKeyboardButtonData("⏰ 定时发送", "bbuild_schedule"),
 		)
-		rows = append(rows, sendRow)
+		segmentRow := tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎯 上次广播未互动用户", "bbuild_send_unengaged"),
+		)
+		rows = append(rows, sendRow, segmentRow)
 	}
 
 	cancelRow := tgbotapi.NewInlineKeyboardRow(
@@ -368,11 +570,13 @@ func (m *Manager) sendBroadcastPreview(chatID int64) {
 
 	previewMsg := tgbotapi.NewMessage(chatID, "--- 预览 ---")
 	m.API.Send(previewMsg)
+	// 回调按钮需要替换为 bclick_ 按钮才能发送，预览的点击不计入统计
+	broadcast.Buttons = m.previewButtons(chatID, broadcast.Buttons)
 	m.sendComplexMessage(chatID, broadcast)
 	log.Printf("发送广播预览，chatID: %d", chatID)
 }
 
-func (m *Manager) executeBroadcast(chatID int64) {
+func (m *Manager) executeBroadcast(chatID, actorID int64) {
 	broadcast := m.Broadcasts[chatID]
 	if broadcast.Text == "" && broadcast.MediaID == "" {
 		msg := tgbotapi.NewMessage(chatID, "无法发送，广播内容为空。")
@@ -381,7 +585,188 @@ func (m *Manager) executeBroadcast(chatID int64) {
 		return
 	}
 
-	allUserIDsStr, err := m.RedisClient.GetAllUserIDs(context.Background(), "telegram_bot_users")
+	id, err := m.RedisClient.NextBroadcastID(context.Background())
+	if err != nil {
+		log.Printf("生成广播ID失败，chatID %d: %v", chatID, err)
+		msg := tgbotapi.NewMessage(chatID, "广播失败：无法创建广播任务。")
+		m.API.Send(msg)
+		return
+	}
+	m.auditBroadcast(actorID, id, broadcast, broadcast.Target, "立即发送")
+	m.deliverBroadcast(chatID, id, broadcast, broadcast.Target)
+}
+
+// SendBroadcast 立即将广播发送给 broadcast.Target 中的用户，进度和结果报告给 chatID，
+// 以管理员 actorID 的名义和 source 记录在审计日志中。供 Telegram 之外的入口（如网页后台）使用，返回广播 ID
+func (m *Manager) SendBroadcast(actorID, chatID int64, broadcast Message, source string) (string, error) {
+	if broadcast.Text == "" && broadcast.MediaID == "" {
+		return "", fmt.Errorf("广播内容为空")
+	}
+	if broadcast.MediaID == "" && textLength("📢 "+broadcast.Text) > MaxMessageLength {
+		return "", fmt.Errorf("广播内容超过 %d 个字符", MaxMessageLength)
+	}
+	id, err := m.RedisClient.NextBroadcastID(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("生成广播 ID 失败: %w", err)
+	}
+	m.auditBroadcast(actorID, id, broadcast, broadcast.Target, source)
+	m.deliverBroadcast(chatID, id, broadcast, broadcast.Target)
+	return id, nil
+}
+
+// executeTestBroadcast 将当前草稿仅发送给测试组，草稿保留以便随后正式发送
+func (m *Manager) executeTestBroadcast(chatID int64) {
+	broadcast := m.Broadcasts[chatID]
+	if broadcast.Text == "" && broadcast.MediaID == "" {
+		msg := tgbotapi.NewMessage(chatID, "无法发送，广播内容为空。")
+		m.API.Send(msg)
+		return
+	}
+
+	ctx := context.Background()
+	testers, err := m.RedisClient.GetTestUserIDs(ctx)
+	if err != nil {
+		log.Printf("获取测试组失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取测试组失败。"))
+		return
+	}
+	if len(testers) == 0 {
+		m.API.Send(tgbotapi.NewMessage(chatID, "测试组为空，请先使用 /addtester <用户ID> 添加测试用户。"))
+		return
+	}
+
+	id, err := m.RedisClient.NextBroadcastID(ctx)
+	if err != nil {
+		log.Printf("生成广播ID失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "发送失败：无法创建广播任务。"))
+		return
+	}
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("🧪 正在发送给测试组（%d 位用户）…", len(testers))))
+	m.deliverBroadcast(chatID, id, broadcast, AudienceTest)
+	log.Printf("测试组广播 %s 已开始，chatID: %d", id, chatID)
+}
+
+// recipients 返回指定接收范围内的用户ID
+func (m *Manager) recipients(ctx context.Context, audience string) ([]string, error) {
+	if audience == AudienceTest {
+		return m.RedisClient.GetTestUserIDs(ctx)
+	}
+	if strings.HasPrefix(audience, AudienceUnengagedPrefix) {
+		return m.RedisClient.GetUnengagedUserIDs(ctx, strings.TrimPrefix(audience, AudienceUnengagedPrefix))
+	}
+	if strings.HasPrefix(audience, AudienceTagPrefix) {
+		return m.RedisClient.GetTagUserIDs(ctx, strings.TrimPrefix(audience, AudienceTagPrefix))
+	}
+	if strings.HasPrefix(audience, AudienceWithoutTagPrefix) {
+		return m.RedisClient.GetUserIDsWithoutTag(ctx, strings.TrimPrefix(audience, AudienceWithoutTagPrefix))
+	}
+	if strings.HasPrefix(audience, AudienceActivePrefix) || strings.HasPrefix(audience, AudienceInactivePrefix) {
+		return m.activityRecipients(ctx, audience)
+	}
+	return m.RedisClient.GetAllUserIDs(ctx, cache.UsersSetKey)
+}
+
+// recipientPageSize 分页读取全体用户时每页的建议数量
+const recipientPageSize = 500
+
+// recipientPages 返回接收范围内的用户数，以及按页遍历这些用户ID的函数（fn 返回 false 时停止）。
+// 全体用户使用 SSCAN 分页读取，避免一次把所有用户载入内存；其他接收范围本身较小，一次读取后作为单页返回。
+func (m *Manager) recipientPages(ctx context.Context, audience string) (int, func(fn func(userIDs []string) bool) error, error) {
+	if audience == AudienceTest || isTargetAudience(audience) || strings.HasPrefix(audience, AudienceUnengagedPrefix) {
+		userIDs, err := m.recipients(ctx, audience)
+		if err != nil {
+			return 0, nil, err
+		}
+		each := func(fn func([]string) bool) error {
+			if len(userIDs) > 0 {
+				fn(userIDs)
+			}
+			return nil
+		}
+		return len(userIDs), each, nil
+	}
+	total, err := m.RedisClient.CountUserIDs(ctx, cache.UsersSetKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	each := func(fn func([]string) bool) error {
+		return m.RedisClient.EachUserIDPage(ctx, cache.UsersSetKey, recipientPageSize, fn)
+	}
+	return int(total), each, nil
+}
+
+// reachableCount 统计接收范围内当前可以送达的用户数（未退订广播、未屏蔽机器人）。
+// 全员广播直接读取计数器，其他接收范围逐页检查接收用户
+func (m *Manager) reachableCount(ctx context.Context, audience string) (int, error) {
+	if audience == AudienceAll {
+		n, err := m.RedisClient.CountReachableUsers(ctx)
+		return int(n), err
+	}
+	_, each, err := m.recipientPages(ctx, audience)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = each(func(userIDs []string) bool {
+		var n int
+		n, err = m.RedisClient.CountBroadcastReachable(ctx, userIDs)
+		count += n
+		return err == nil
+	})
+	return count, err
+}
+
+// ResumeBroadcasts continues every broadcast that was still in progress when the bot stopped.
+func (m *Manager) ResumeBroadcasts() {
+	ctx := context.Background()
+	ids, err := m.RedisClient.GetInProgressBroadcastIDs(ctx)
+	if err != nil {
+		log.Printf("获取未完成的广播失败: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		payload, err := m.RedisClient.GetBroadcastJob(ctx, id)
+		var job broadcastJob
+		if err == nil && payload != "" {
+			err = json.Unmarshal([]byte(payload), &job)
+		}
+		if err != nil || payload == "" {
+			log.Printf("读取未完成的广播 %s 失败，放弃续发: %v", id, err)
+			m.RedisClient.FinishBroadcast(ctx, id)
+			continue
+		}
+
+		log.Printf("继续发送未完成的广播 %s，chatID %d", id, job.ChatID)
+		notice := tgbotapi.NewMessage(job.ChatID, fmt.Sprintf("♻️ 广播 #%s 在重启前未发送完成，正在继续发送给剩余用户。", id))
+		m.API.Send(notice)
+		m.deliverBroadcast(job.ChatID, id, job.Message, job.Audience)
+	}
+}
+
+// auditBroadcast 将管理员 actorID 发起的广播记入审计日志，source 说明广播的来源（立即发送、定时、复制等）
+func (m *Manager) auditBroadcast(actorID int64, id string, broadcast Message, audience, source string) {
+	target := audience
+	if target == AudienceAll {
+		target = "所有用户"
+	}
+	details := fmt.Sprintf("广播 #%s（%s），接收范围：%s", id, source, target)
+	if preview := []rune(broadcast.Text); len(preview) > 0 {
+		if len(preview) > 50 {
+			preview = append(preview[:50], '…')
+		}
+		details += "，内容：" + string(preview)
+	}
+	if err := m.RedisClient.AddAuditEntry(context.Background(), actorID, cache.AuditBroadcast, details); err != nil {
+		log.Printf("写入广播 %s 的审计日志失败: %v", id, err)
+	}
+}
+
+// deliverBroadcast 在后台将广播发送给 audience 中所有尚未收到的用户，并把结果报告给 chatID。
+// 每位成功送达的用户都会记录到 bcast:<id>:done，重启或重复触发时据此跳过，避免重复发送。
+func (m *Manager) deliverBroadcast(chatID int64, id string, broadcast Message, audience string) {
+	ctx := context.Background()
+	total, eachPage, err := m.recipientPages(ctx, audience)
 	if err != nil {
 		log.Printf("获取所有用户ID失败，chatID %d: %v", chatID, err)
 		msg := tgbotapi.NewMessage(chatID, "广播失败：无法获取用户列表。")
@@ -389,62 +774,282 @@ func (m *Manager) executeBroadcast(chatID int64) {
 		return
 	}
 
+	payload, err := json.Marshal(broadcastJob{ChatID: chatID, Message: broadcast, Audience: audience})
+	if err == nil {
+		err = m.RedisClient.MarkBroadcastInProgress(ctx, id, string(payload))
+	}
+	if err != nil {
+		log.Printf("保存广播 %s 进度失败，重启后将无法续发: %v", id, err)
+	}
+
+	if len(broadcast.Buttons.InlineKeyboard) > 0 {
+		var links map[string]string
+		broadcast.Buttons, links = trackedButtons(id, broadcast.Buttons, m.callbackReplies(ctx, broadcast.Buttons), broadcast.TrackClicks)
+		if err := m.RedisClient.SaveBroadcastLinks(ctx, id, links); err != nil {
+			log.Printf("保存广播 %s 按钮链接失败: %v", id, err)
+		}
+		if len(links) > 0 && audience != AudienceTest {
+			if err := m.RedisClient.AddClickHistory(ctx, id); err != nil {
+				log.Printf("记录广播 %s 点击统计失败: %v", id, err)
+			}
+		}
+	}
+
+	label := "广播"
+	if audience == AudienceTest {
+		label = "测试组广播"
+	} else if isTargetAudience(audience) {
+		label = fmt.Sprintf("广播（%s）", targetLabel(audience))
+	}
+	progressMsg := tgbotapi.NewMessage(chatID, progressText(label, id, 0, total))
+	progressMsg.ReplyMarkup = stopKeyboard(id)
+	sentProgress, err := m.API.Send(progressMsg)
+	if err != nil {
+		log.Printf("发送广播 %s 进度消息失败: %v", id, err)
+	}
+
+	runCtx, finishRun := m.startRun(id)
+
 	go func() {
-		count := 0
-		for _, userIDStr := range allUserIDsStr {
-			userID, _ := strconv.ParseInt(userIDStr, 10, 64)
-			if userID != 0 {
-				if m.sendComplexMessage(userID, broadcast) {
-					count++
+		defer finishRun()
+		var (
+			mu        sync.Mutex
+			count     int
+			failed    int
+			skipped   int
+			processed int
+		)
+		userIDs := make(chan int64)
+		wait := startWorkers(m.Workers, userIDs, func(userID int64) {
+			result := m.deliverToUser(ctx, id, userID, broadcast)
+			mu.Lock()
+			switch result {
+			case deliverySent:
+				count++
+			case deliveryFailed:
+				failed++
+			case deliveryDuplicate:
+				skipped++
+			}
+			processed++
+			mu.Unlock()
+		})
+
+		// 定期刷新进度消息，只在进度有变化时编辑，避免 “message is not modified” 错误
+		progressDone := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(progressInterval)
+			defer ticker.Stop()
+			last := 0
+			for {
+				select {
+				case <-progressDone:
+					return
+				case <-ticker.C:
+				}
+				mu.Lock()
+				current := processed
+				mu.Unlock()
+				if current == last || sentProgress.MessageID == 0 {
+					continue
+				}
+				last = current
+				edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, sentProgress.MessageID, progressText(label, id, current, total), stopKeyboard(id))
+				if _, err := m.API.Send(edit); err != nil {
+					log.Printf("更新广播 %s 进度失败: %v", id, err)
 				}
 			}
+		}()
+
+		// 逐页读取接收用户并交给发送协程，停止广播时不再读取后续页
+		err := eachPage(func(page []string) bool {
+			for _, userIDStr := range page {
+				userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+				if userID == 0 {
+					continue
+				}
+				select {
+				case userIDs <- userID:
+				case <-runCtx.Done():
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			log.Printf("读取广播 %s 的接收用户失败，剩余用户未发送: %v", id, err)
+		}
+		close(userIDs)
+		wait()
+		close(progressDone)
+		stopped := runCtx.Err() != nil && processed < total
+
+		if err := m.RedisClient.FinishBroadcast(ctx, id); err != nil {
+			log.Printf("清理广播 %s 进度失败: %v", id, err)
+		}
+		if audience != AudienceTest {
+			if err := m.RedisClient.IncrDailyStat(ctx, cache.DailyBroadcasts); err != nil {
+				log.Printf("记录广播 %s 的每日统计失败: %v", id, err)
+			}
+		}
+		// 只有完整发送的全员广播才作为“上次广播”，分群或测试广播不会覆盖它
+		if audience == AudienceAll && !stopped {
+			if err := m.RedisClient.SetLastBroadcast(ctx, id, broadcast.TrackClicks || keyboard.HasCallbackButtons(broadcast.Buttons)); err != nil {
+				log.Printf("记录上次广播 %s 失败: %v", id, err)
+			}
+		}
+
+		if sentProgress.MessageID != 0 {
+			final := progressText(label, id, processed, total)
+			if stopped {
+				final += "（已停止）"
+			} else {
+				final += "（已完成）"
+			}
+			m.API.Send(tgbotapi.NewEditMessageText(chatID, sentProgress.MessageID, final))
+		}
+
+		var text string
+		if stopped {
+			text = fmt.Sprintf("⏹ %s #%s 已停止发送，已成功发送给 %d 位用户，失败 %d 位，剩余 %d 位未发送。", label, id, count, failed, total-processed)
+		} else {
+			text = fmt.Sprintf("✅ %s #%s 发送完成，共成功发送给 %d 位用户，失败 %d 位。", label, id, count, failed)
 		}
-		confirmMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 广播发送完成，共成功发送给 %d 位用户。", count))
+		if skipped > 0 {
+			text += fmt.Sprintf("\n（另有 %d 位用户此前已收到，已跳过）", skipped)
+		}
+		confirmMsg := tgbotapi.NewMessage(chatID, text)
 		m.API.Send(confirmMsg)
-		log.Printf("广播发送完成，chatID %d，成功发送给 %d 位用户", chatID, count)
+		log.Printf("广播 %s 发送结束（停止：%v），chatID %d，成功 %d 位，失败 %d 位，跳过 %d 位", id, stopped, chatID, count, failed, skipped)
+		if m.OnFinish != nil && audience != AudienceTest {
+			m.OnFinish(Result{ID: id, Audience: audience, Total: total, Sent: count, Failed: failed, Skipped: skipped, Stopped: stopped})
+		}
 	}()
 }
 
+// startWorkers 启动 workers 个发送协程，并发地对 userIDs 中的每位用户调用 deliver。
+// 发送速度由所有协程共享的限流器控制；返回的 wait 在 userIDs 关闭且全部处理完后返回。
+func startWorkers(workers int, userIDs <-chan int64, deliver func(userID int64)) (wait func()) {
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range userIDs {
+				deliver(userID)
+			}
+		}()
+	}
+	return wg.Wait
+}
+
+// Result 是一次广播的发送结果
+type Result struct {
+	ID       string `json:"id"`
+	Audience string `json:"audience"`
+	Total    int    `json:"total"`
+	Sent     int    `json:"sent"`
+	Failed   int    `json:"failed"`
+	Skipped  int    `json:"skipped"`
+	Stopped  bool   `json:"stopped"`
+}
+
+// deliveryResult 是向单个用户发送广播的结果
+type deliveryResult int
+
+const (
+	deliverySent      deliveryResult = iota
+	deliveryFailed                   // 发送失败
+	deliveryDuplicate                // 此前已收到，跳过
+	deliveryExcluded                 // 已退订广播或屏蔽了机器人，不发送
+)
+
+// deliverToUser 向单个用户发送广播，跳过已退订、屏蔽机器人或此前已收到的用户
+func (m *Manager) deliverToUser(ctx context.Context, id string, userID int64, broadcast Message) deliveryResult {
+	optedOut, err := m.RedisClient.IsBroadcastOptedOut(ctx, userID)
+	if err != nil {
+		log.Printf("检查用户 %d 是否退订广播失败: %v", userID, err)
+	}
+	if optedOut {
+		return deliveryExcluded
+	}
+	unreachable, err := m.RedisClient.IsUnreachableUser(ctx, userID)
+	if err != nil {
+		log.Printf("检查用户 %d 是否屏蔽机器人失败: %v", userID, err)
+	}
+	if unreachable {
+		return deliveryExcluded
+	}
+	delivered, err := m.RedisClient.IsBroadcastDelivered(ctx, id, userID)
+	if err != nil {
+		log.Printf("检查广播 %s 对用户 %d 的送达状态失败: %v", id, userID, err)
+	}
+	if delivered {
+		return deliveryDuplicate
+	}
+
+	if !m.sendComplexMessage(userID, broadcast) {
+		return deliveryFailed
+	}
+	if err := m.RedisClient.MarkBroadcastDelivered(ctx, id, userID); err != nil {
+		log.Printf("记录广播 %s 送达用户 %d 失败: %v", id, userID, err)
+	}
+	return deliverySent
+}
+
 func (m *Manager) sendComplexMessage(chatID int64, broadcast Message) bool {
 	var err error
 	// 添加 📢 前缀到文本或媒体标题
 	messageText := "📢 " + broadcast.Text
 
-	if broadcast.MediaID != "" {
-		var shareable tgbotapi.Chattable
-		var markup *tgbotapi.InlineKeyboardMarkup
-		if len(broadcast.Buttons.InlineKeyboard) > 0 {
-			markup = &broadcast.Buttons
-		}
-
-		switch broadcast.Type {
-		case "photo":
-			photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(broadcast.MediaID))
-			photo.Caption = messageText
-			photo.ReplyMarkup = markup
-			shareable = photo
-		case "video":
-			video := tgbotapi.NewVideo(chatID, tgbotapi.FileID(broadcast.MediaID))
-			video.Caption = messageText
-			video.ReplyMarkup = markup
-			shareable = video
-		}
-		if shareable != nil {
-			_, err = m.API.Send(shareable)
-		} else {
-			err = fmt.Errorf("不支持的媒体类型: %s", broadcast.Type)
+	if broadcast.CopyFromChatID != 0 {
+		err = m.sendCopy(chatID, broadcast)
+		messageText = fmt.Sprintf("[复制消息 %v]", broadcast.CopyMessageIDs)
+	} else if broadcast.MediaID != "" {
+		withButtons := len(broadcast.Buttons.InlineKeyboard) > 0
+
+		// 标题超出上限时，媒体只带简短标题，完整文本和按钮放在随后的文本消息中
+		split := captionWillSplit(broadcast)
+		caption := messageText
+		if split {
+			caption = "📢"
+			withButtons = false
 		}
-	} else if broadcast.Text != "" {
-		msg := tgbotapi.NewMessage(chatID, messageText)
-		if len(broadcast.Buttons.InlineKeyboard) > 0 {
-			msg.ReplyMarkup = broadcast.Buttons
+
+		params := broadcastParams(chatID, broadcast)
+		params.AddNonEmpty("caption", caption)
+		if withButtons {
+			err = params.AddInterface("reply_markup", broadcast.Buttons)
 		}
-		_, err = m.API.Send(msg)
+		if err == nil {
+			switch broadcast.Type {
+			case "photo":
+				params.AddNonEmpty("photo", broadcast.MediaID)
+				err = m.requestWithRetry("sendPhoto", params)
+			case "video":
+				params.AddNonEmpty("video", broadcast.MediaID)
+				err = m.requestWithRetry("sendVideo", params)
+			default:
+				err = fmt.Errorf("不支持的媒体类型: %s", broadcast.Type)
+			}
+		}
+
+		if err == nil && split {
+			err = m.sendBroadcastText(chatID, broadcast, messageText)
+		}
+	} else if broadcast.Text != "" {
+		err = m.sendBroadcastText(chatID, broadcast, messageText)
 	}
 
 	if err != nil {
 		if strings.Contains(err.Error(), "bot was blocked by the user") {
-			log.Printf("用户 %d 已屏蔽机器人，将从广播列表移除。", chatID)
+			log.Printf("用户 %d 已屏蔽机器人，记为不可达用户。", chatID)
+			if err := m.RedisClient.AddUnreachableUser(context.Background(), chatID); err != nil {
+				log.Printf("记录不可达用户 %d 失败: %v", chatID, err)
+			}
 		} else {
 			log.Printf("发送消息给 %d 失败: %v", chatID, err)
 		}
@@ -454,32 +1059,25 @@ func (m *Manager) sendComplexMessage(chatID int64, broadcast Message) bool {
 	return true
 }
 
-// ParseButtons is a helper function to parse button data from a string.
-func ParseButtons(data string) tgbotapi.InlineKeyboardMarkup {
-	lines := strings.Split(data, "\n")
-	var buttons []tgbotapi.InlineKeyboardButton
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) == 2 {
-			text := strings.TrimSpace(parts[0])
-			url := strings.TrimSpace(parts[1])
-			url = strings.Trim(url, "`")
-			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(text, url))
-		}
-	}
-
-	var rows [][]tgbotapi.InlineKeyboardButton
-	for i := 0; i < len(buttons); i += 2 {
-		if i+1 < len(buttons) {
-			rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i], buttons[i+1]))
-		} else {
-			rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i]))
+// sendBroadcastText 发送广播的文本消息，按钮附在该消息上
+func (m *Manager) sendBroadcastText(chatID int64, broadcast Message, text string) error {
+	params := broadcastParams(chatID, broadcast)
+	params.AddNonEmpty("text", text)
+	if len(broadcast.Buttons.InlineKeyboard) > 0 {
+		if err := params.AddInterface("reply_markup", broadcast.Buttons); err != nil {
+			return err
 		}
 	}
+	return m.requestWithRetry("sendMessage", params)
+}
 
-	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+// broadcastParams 返回发送广播消息的公共参数，包括静默发送和禁止转发选项。
+// tgbotapi 的消息配置不支持 protect_content，因此广播直接按参数调用接口。
+func broadcastParams(chatID int64, broadcast Message) tgbotapi.Params {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddBool("disable_notification", broadcast.Silent)
+	params.AddBool("protect_content", broadcast.Protect)
+	params.AddNonEmpty("parse_mode", broadcast.ParseMode)
+	return params
 }
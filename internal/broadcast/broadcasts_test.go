@@ -0,0 +1,101 @@
+package broadcast
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	benchRecipients = 50                     // 每次广播的接收人数
+	benchLatency    = 100 * time.Millisecond // 模拟的 Telegram API 单次请求耗时
+)
+
+// fakeTelegram 模拟 Telegram Bot API：每个请求耗时 latency，并记录发送消息的时间用于计算峰值速率
+type fakeTelegram struct {
+	latency time.Duration
+
+	mu    sync.Mutex
+	sends []time.Time
+}
+
+func (f *fakeTelegram) Do(req *http.Request) (*http.Response, error) {
+	body := `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`
+	if strings.HasSuffix(req.URL.Path, "/getMe") {
+		body = `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bench","username":"bench_bot"}}`
+	} else {
+		f.mu.Lock()
+		f.sends = append(f.sends, time.Now())
+		f.mu.Unlock()
+		time.Sleep(f.latency)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+// peakRate 返回任意 1 秒内发出的最多请求数
+func (f *fakeTelegram) peakRate() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	peak, start := 0, 0
+	for end := range f.sends {
+		for f.sends[end].Sub(f.sends[start]) >= time.Second {
+			start++
+		}
+		peak = max(peak, end-start+1)
+	}
+	return peak
+}
+
+// BenchmarkBroadcastSend 对比逐个发送（workers=1）和并发发送的耗时，并检查并发时仍不超过全局限流。
+// go test -run '^$' -bench BroadcastSend ./internal/broadcast
+func BenchmarkBroadcastSend(b *testing.B) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	broadcast := Message{Text: "benchmark"}
+
+	for _, workers := range []int{1, DefaultWorkers, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			client := &fakeTelegram{latency: benchLatency}
+			api, err := tgbotapi.NewBotAPIWithClient("TOKEN", tgbotapi.APIEndpoint, client)
+			if err != nil {
+				b.Fatal(err)
+			}
+			m := NewManager(api, nil, nil)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				userIDs := make(chan int64)
+				wait := startWorkers(workers, userIDs, func(userID int64) {
+					if !m.sendComplexMessage(userID, broadcast) {
+						b.Errorf("发送给用户 %d 失败", userID)
+					}
+				})
+				for userID := int64(1); userID <= benchRecipients; userID++ {
+					userIDs <- userID
+				}
+				close(userIDs)
+				wait()
+			}
+			b.StopTimer()
+
+			peak := client.peakRate()
+			b.ReportMetric(float64(peak), "peak-sends/s")
+			// 令牌桶允许一次突发 sendBurst 条，此后每秒 MaxSendsPerSecond 条
+			if peak > MaxSendsPerSecond+sendBurst {
+				b.Fatalf("任意 1 秒内发送了 %d 条，超过限流 %d 条", peak, MaxSendsPerSecond+sendBurst)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/keyboard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// buttonEdit 是按钮编辑器中正在添加、修改或移动的按钮。Row 为 -1 表示正在添加新按钮
+type buttonEdit struct {
+	Row, Col int
+	Field    string // 正在输入的字段："text" 或 "target"
+	Text     string
+	Target   string
+}
+
+// sendButtonEditor 显示按钮编辑器：按钮按实际排列显示作为预览，点击任一按钮可修改、移动或删除
+func (m *Manager) sendButtonEditor(chatID int64, notice string) {
+	delete(m.buttonEdits, chatID)
+	m.AdminStates[chatID] = 0 // StateNone
+	rows := m.Broadcasts[chatID].Buttons.InlineKeyboard
+
+	text := notice
+	if text != "" {
+		text += "\n\n"
+	}
+	text += "🔘 按钮编辑器\n\n"
+	if len(rows) == 0 {
+		text += "当前还没有按钮。点击「➕ 添加按钮」逐个添加，或点击「📝 批量输入」一次输入多个按钮。"
+	} else {
+		count := 0
+		for _, row := range rows {
+			count += len(row)
+		}
+		text += fmt.Sprintf("共 %d 个按钮，%d 行。下方按实际排列预览，点击任一按钮可修改、移动或删除。", count, len(rows))
+	}
+
+	var buttonRows [][]tgbotapi.InlineKeyboardButton
+	for r, row := range rows {
+		var preview []tgbotapi.InlineKeyboardButton
+		for c, button := range row {
+			label := button.Text
+			if _, ok := keyboard.CallbackKey(button); ok {
+				label = "💬 " + label
+			}
+			preview = append(preview, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("bbtn_sel_%d_%d", r, c)))
+		}
+		buttonRows = append(buttonRows, preview)
+	}
+	buttonRows = append(buttonRows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ 添加按钮", "bbtn_add"),
+			tgbotapi.NewInlineKeyboardButtonData("📝 批量输入", "bbtn_bulk"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📁 从模板选择", "bbuild_templates"),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 清空按钮", "bbtn_clear"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 完成", "bbtn_done"),
+		),
+	)
+	m.sendButtonPrompt(chatID, text, tgbotapi.NewInlineKeyboardMarkup(buttonRows...))
+}
+
+// sendButtonPrompt 替换按钮编辑器的当前消息
+func (m *Manager) sendButtonPrompt(chatID int64, text string, markup tgbotapi.InlineKeyboardMarkup) {
+	if m.BroadcastPromptMessageIDs[chatID] != 0 {
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, m.BroadcastPromptMessageIDs[chatID]))
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = markup
+	sent, err := m.API.Send(msg)
+	if err != nil {
+		log.Printf("发送按钮编辑器失败，chatID %d: %v", chatID, err)
+		return
+	}
+	m.BroadcastPromptMessageIDs[chatID] = sent.MessageID
+}
+
+// promptButtonLines 提示管理员一次输入多个按钮，每行一个
+func (m *Manager) promptButtonLines(chatID int64) {
+	m.AdminStates[chatID] = StateBroadcastAwaitButtons
+	msgText := "请输入广播的按钮，每行一个，格式为：\n`按钮文字 | 链接`\n\n例如：\n`关注频道 | https://t.me/channel`\n`靓号商城 | https://t.me/store`\n\n" +
+		"也可以添加回调按钮，用户点击后弹出提示并统计点击：\n`感兴趣 | 回调:感谢反馈，客服稍后联系你`\n\n" +
+		"默认两个按钮一排。需要自定义排列时，用 `&&` 把同一排的按钮写在一行，每行一排：\n`官网 | https://example.com && 客服 | https://t.me/support`\n\n" +
+		"输入的按钮会替换当前所有按钮。"
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = buttonEditorBackKeyboard()
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送按钮设置提示失败，chatID %d: %v", chatID, err)
+	}
+	log.Printf("设置状态为 StateBroadcastAwaitButtons，chatID: %d", chatID)
+}
+
+func buttonEditorBackKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回按钮编辑器", "bbtn_back"),
+	))
+}
+
+// promptButtonField 提示管理员输入按钮文字或链接
+func (m *Manager) promptButtonField(chatID int64, edit *buttonEdit, field string) {
+	edit.Field = field
+	m.buttonEdits[chatID] = edit
+	var text string
+	if field == "text" {
+		m.AdminStates[chatID] = StateBroadcastAwaitButtonText
+		text = "请输入按钮上显示的文字："
+	} else {
+		m.AdminStates[chatID] = StateBroadcastAwaitButtonTarget
+		text = "请输入按钮的链接（http:// 或 https:// 开头），\n或输入 `回调:提示文字` 创建回调按钮（用户点击后弹出提示并统计点击）："
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = buttonEditorBackKeyboard()
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送按钮输入提示失败，chatID %d: %v", chatID, err)
+	}
+}
+
+// handleButtonFieldInput 处理按钮编辑器中输入的按钮文字或链接
+func (m *Manager) handleButtonFieldInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	edit := m.buttonEdits[chatID]
+	if edit == nil {
+		m.sendButtonEditor(chatID, "")
+		return
+	}
+	input := strings.TrimSpace(msg.Text)
+	if edit.Field == "text" {
+		if err := keyboard.ValidateText(input); err != nil {
+			errMsg := tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"，请重新输入。")
+			errMsg.ReplyMarkup = buttonEditorBackKeyboard()
+			m.API.Send(errMsg)
+			return
+		}
+		edit.Text = input
+	} else {
+		if err := keyboard.ValidateTarget(input); err != nil {
+			errMsg := tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"，请重新输入。")
+			errMsg.ReplyMarkup = buttonEditorBackKeyboard()
+			m.API.Send(errMsg)
+			return
+		}
+		if reply, ok := keyboard.ParseCallbackTarget(input); ok && !m.saveCallbackReplies(chatID, map[string]string{keyboard.ReplyKey(reply): reply}) {
+			errMsg := tgbotapi.NewMessage(chatID, "❌ 保存回调按钮失败，请稍后重试。")
+			errMsg.ReplyMarkup = buttonEditorBackKeyboard()
+			m.API.Send(errMsg)
+			return
+		}
+		edit.Target = input
+	}
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, msg.MessageID))
+
+	if edit.Row >= 0 {
+		// 修改已有按钮
+		m.setButton(chatID, edit.Row, edit.Col, keyboard.NewButton(edit.Text, edit.Target))
+		m.sendButtonEditor(chatID, "✅ 按钮已更新。")
+		return
+	}
+	if edit.Field == "text" {
+		m.promptButtonField(chatID, edit, "target")
+		return
+	}
+	m.AdminStates[chatID] = 0 // StateNone
+	m.sendPlacementMenu(chatID, "请选择新按钮「"+edit.Text+"」放在哪一行：")
+}
+
+// sendPlacementMenu 让管理员选择按钮放在哪一行
+func (m *Manager) sendPlacementMenu(chatID int64, text string) {
+	rows := m.Broadcasts[chatID].Buttons.InlineKeyboard
+	var buttonRows [][]tgbotapi.InlineKeyboardButton
+	for r, row := range rows {
+		if len(row) >= keyboard.MaxButtonsPerRow {
+			continue
+		}
+		labels := make([]string, 0, len(row))
+		for _, button := range row {
+			labels = append(labels, button.Text)
+		}
+		buttonRows = append(buttonRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("第 %d 行末尾（%s）", r+1, strings.Join(labels, "、")), fmt.Sprintf("bbtn_place_%d", r)),
+		))
+	}
+	buttonRows = append(buttonRows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("➕ 新的一行", "bbtn_place_new")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回按钮编辑器", "bbtn_back")),
+	)
+	m.sendButtonPrompt(chatID, text, tgbotapi.NewInlineKeyboardMarkup(buttonRows...))
+}
+
+// sendButtonActions 显示单个按钮的操作菜单
+func (m *Manager) sendButtonActions(chatID int64, r, c int) {
+	button := m.Broadcasts[chatID].Buttons.InlineKeyboard[r][c]
+	target := keyboard.Target(button, m.callbackReplies(context.Background(), tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button))))
+	text := fmt.Sprintf("按钮：%s\n目标：%s\n位置：第 %d 行第 %d 个\n\n请选择操作：", button.Text, target, r+1, c+1)
+	pos := fmt.Sprintf("%d_%d", r, c)
+	m.sendButtonPrompt(chatID, text, tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ 修改文字", "bbtn_text_"+pos),
+			tgbotapi.NewInlineKeyboardButtonData("🔗 修改链接", "bbtn_target_"+pos),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ 左移", "bbtn_left_"+pos),
+			tgbotapi.NewInlineKeyboardButtonData("➡️ 右移", "bbtn_right_"+pos),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↕️ 移到其他行", "bbtn_move_"+pos),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 删除", "bbtn_del_"+pos),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回按钮编辑器", "bbtn_back"),
+		),
+	))
+}
+
+// handleButtonEditorCallback 处理按钮编辑器的按钮
+func (m *Manager) handleButtonEditorCallback(q *tgbotapi.CallbackQuery) {
+	chatID := q.Message.Chat.ID
+	action := strings.TrimPrefix(q.Data, "bbtn_")
+	m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+
+	switch action {
+	case "add":
+		m.promptButtonField(chatID, &buttonEdit{Row: -1}, "text")
+		return
+	case "bulk":
+		m.promptButtonLines(chatID)
+		return
+	case "clear":
+		current := m.Broadcasts[chatID]
+		current.Buttons = tgbotapi.NewInlineKeyboardMarkup()
+		m.Broadcasts[chatID] = current
+		m.sendButtonEditor(chatID, "✅ 已清空所有按钮。")
+		return
+	case "back":
+		m.sendButtonEditor(chatID, "")
+		return
+	case "done":
+		delete(m.buttonEdits, chatID)
+		m.AdminStates[chatID] = 0 // StateNone
+		m.sendBroadcastBuilderMenu(chatID)
+		log.Printf("按钮编辑完成，chatID: %d", chatID)
+		return
+	}
+
+	if strings.HasPrefix(action, "place_") {
+		m.placeButton(chatID, strings.TrimPrefix(action, "place_"))
+		return
+	}
+
+	// 其余操作都针对某个已有按钮：<操作>_<行>_<列>
+	parts := strings.Split(action, "_")
+	if len(parts) != 3 {
+		return
+	}
+	r, errR := strconv.Atoi(parts[1])
+	c, errC := strconv.Atoi(parts[2])
+	rows := m.Broadcasts[chatID].Buttons.InlineKeyboard
+	if errR != nil || errC != nil || r < 0 || r >= len(rows) || c < 0 || c >= len(rows[r]) {
+		m.sendButtonEditor(chatID, "按钮已变化，请重新选择。")
+		return
+	}
+	button := rows[r][c]
+	replies := m.callbackReplies(context.Background(), tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button)))
+
+	switch parts[0] {
+	case "sel":
+		m.sendButtonActions(chatID, r, c)
+	case "text", "target":
+		edit := &buttonEdit{Row: r, Col: c, Text: button.Text, Target: keyboard.Target(button, replies)}
+		m.promptButtonField(chatID, edit, parts[0])
+	case "left", "right":
+		to := c - 1
+		if parts[0] == "right" {
+			to = c + 1
+		}
+		if to >= 0 && to < len(rows[r]) {
+			rows[r][c], rows[r][to] = rows[r][to], rows[r][c]
+			c = to
+		}
+		m.sendButtonActions(chatID, r, c)
+	case "move":
+		m.buttonEdits[chatID] = &buttonEdit{Row: r, Col: c, Text: button.Text, Target: keyboard.Target(button, replies)}
+		m.sendPlacementMenu(chatID, "请选择按钮「"+button.Text+"」移到哪一行：")
+	case "del":
+		m.removeButton(chatID, r, c)
+		m.sendButtonEditor(chatID, "✅ 按钮「"+button.Text+"」已删除。")
+	}
+}
+
+// placeButton 将正在添加或移动的按钮放到指定行末尾，row 为 "new" 时新起一行
+func (m *Manager) placeButton(chatID int64, row string) {
+	edit := m.buttonEdits[chatID]
+	if edit == nil {
+		m.sendButtonEditor(chatID, "")
+		return
+	}
+	button := keyboard.NewButton(edit.Text, edit.Target)
+	if edit.Row >= 0 {
+		// 移动已有按钮：先从原位置移除，目标行号在原行被删除时需要前移
+		rowsBefore := len(m.Broadcasts[chatID].Buttons.InlineKeyboard)
+		m.removeButton(chatID, edit.Row, edit.Col)
+		if r, err := strconv.Atoi(row); err == nil && r > edit.Row && len(m.Broadcasts[chatID].Buttons.InlineKeyboard) < rowsBefore {
+			row = strconv.Itoa(r - 1)
+		}
+	}
+
+	current := m.Broadcasts[chatID]
+	rows := current.Buttons.InlineKeyboard
+	if r, err := strconv.Atoi(row); err == nil && r >= 0 && r < len(rows) && len(rows[r]) < keyboard.MaxButtonsPerRow {
+		rows[r] = append(rows[r], button)
+	} else {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	current.Buttons = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	m.Broadcasts[chatID] = current
+	m.sendButtonEditor(chatID, "✅ 按钮「"+button.Text+"」已放置。")
+}
+
+// setButton 替换指定位置的按钮
+func (m *Manager) setButton(chatID int64, r, c int, button tgbotapi.InlineKeyboardButton) {
+	rows := m.Broadcasts[chatID].Buttons.InlineKeyboard
+	if r < len(rows) && c < len(rows[r]) {
+		rows[r][c] = button
+	}
+}
+
+// removeButton 删除指定位置的按钮，行为空时一并删除该行
+func (m *Manager) removeButton(chatID int64, r, c int) {
+	current := m.Broadcasts[chatID]
+	rows := current.Buttons.InlineKeyboard
+	if r >= len(rows) || c >= len(rows[r]) {
+		return
+	}
+	rows[r] = append(rows[r][:c], rows[r][c+1:]...)
+	if len(rows[r]) == 0 {
+		rows = append(rows[:r], rows[r+1:]...)
+	}
+	current.Buttons = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	m.Broadcasts[chatID] = current
+}
@@ -0,0 +1,117 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StartCopyBroadcast starts the copy-mode broadcast: the admin sends or forwards any message (channel post,
+// album, poll, …) and the bot copies it to every user without going through the builder.
+func (m *Manager) StartCopyBroadcast(chatID int64) {
+	m.Broadcasts[chatID] = Message{}
+	m.AdminStates[chatID] = StateBroadcastAwaitCopySource
+	msg := tgbotapi.NewMessage(chatID, "请发送或转发要广播的消息（支持频道帖子、相册、投票等任意消息），机器人会原样复制给所有用户：")
+	msg.ReplyMarkup = m.getCancelKeyboard()
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送复制广播提示失败，chatID %d: %v", chatID, err)
+	}
+	log.Printf("设置状态为 StateBroadcastAwaitCopySource，chatID: %d", chatID)
+}
+
+// handleCopySourceInput 记录要复制的消息。相册的每条消息会分别到达，属于同一相册的消息追加到同一草稿中，
+// 只在第一条到达时显示确认菜单。
+func (m *Manager) handleCopySourceInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	current := m.Broadcasts[chatID]
+	if msg.MediaGroupID != "" && msg.MediaGroupID == current.CopyMediaGroupID {
+		current.CopyMessageIDs = append(current.CopyMessageIDs, msg.MessageID)
+		sort.Ints(current.CopyMessageIDs) // copyMessages 要求消息 ID 递增
+		m.Broadcasts[chatID] = current
+		return
+	}
+
+	m.Broadcasts[chatID] = Message{
+		CopyFromChatID:   chatID,
+		CopyMessageIDs:   []int{msg.MessageID},
+		CopyMediaGroupID: msg.MediaGroupID,
+	}
+	m.sendCopyMenu(chatID)
+}
+
+// sendCopyMenu 显示复制广播的确认菜单
+func (m *Manager) sendCopyMenu(chatID int64) {
+	text := "📋 已收到要广播的消息。\n" +
+		"点击「确认发送」后将原样复制给所有用户（不显示转发来源）。\n" +
+		"发送完成前请不要删除这条消息，否则将无法继续复制。\n" +
+		"如需更换，直接发送或转发另一条消息即可。"
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👀 发送预览", "bcopy_preview"),
+			tgbotapi.NewInlineKeyboardButtonData("🚀 确认发送", "bcopy_send"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "bbuild_cancel"),
+		),
+	)
+
+	if m.BroadcastPromptMessageIDs[chatID] != 0 {
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, m.BroadcastPromptMessageIDs[chatID]))
+	}
+	sent, err := m.API.Send(msg)
+	if err != nil {
+		log.Printf("发送复制广播菜单失败，chatID %d: %v", chatID, err)
+		return
+	}
+	m.BroadcastPromptMessageIDs[chatID] = sent.MessageID
+}
+
+// handleCopyCallback 处理复制广播菜单上的预览和发送按钮
+func (m *Manager) handleCopyCallback(q *tgbotapi.CallbackQuery) {
+	chatID := q.Message.Chat.ID
+	broadcast := m.Broadcasts[chatID]
+	if broadcast.CopyFromChatID == 0 {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "请先发送要广播的消息"))
+		return
+	}
+	m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+
+	switch q.Data {
+	case "bcopy_preview":
+		m.API.Send(tgbotapi.NewMessage(chatID, "--- 预览 ---"))
+		broadcast.Buttons = m.previewButtons(chatID, broadcast.Buttons)
+		m.sendComplexMessage(chatID, broadcast)
+	case "bcopy_send":
+		id, err := m.RedisClient.NextBroadcastID(context.Background())
+		if err != nil {
+			log.Printf("生成广播ID失败，chatID %d: %v", chatID, err)
+			m.API.Send(tgbotapi.NewMessage(chatID, "广播失败：无法创建广播任务。"))
+			return
+		}
+		m.AdminStates[chatID] = 0 // StateNone
+		delete(m.Broadcasts, chatID)
+		delete(m.BroadcastPromptMessageIDs, chatID)
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		m.auditBroadcast(q.From.ID, id, broadcast, AudienceAll, "复制消息")
+		m.deliverBroadcast(chatID, id, broadcast, AudienceAll)
+		log.Printf("复制广播 %s 已开始，chatID: %d", id, chatID)
+	}
+}
+
+// sendCopy 将复制模式的广播消息复制给用户，相册使用 copyMessages 一次复制以保持成组显示
+func (m *Manager) sendCopy(chatID int64, broadcast Message) error {
+	params := broadcastParams(chatID, broadcast)
+	params.AddNonZero64("from_chat_id", broadcast.CopyFromChatID)
+	if len(broadcast.CopyMessageIDs) == 1 {
+		params.AddNonZero("message_id", broadcast.CopyMessageIDs[0])
+		return m.requestWithRetry("copyMessage", params)
+	}
+	if err := params.AddInterface("message_ids", broadcast.CopyMessageIDs); err != nil {
+		return fmt.Errorf("编码相册消息 ID 失败: %w", err)
+	}
+	return m.requestWithRetry("copyMessages", params)
+}
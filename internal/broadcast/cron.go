@@ -0,0 +1,161 @@
+package broadcast
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule 是解析后的五段式 cron 表达式（分 时 日 月 周），每段用位图表示允许的取值
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // 日、周字段为 * 时，两者按“与”匹配，否则按 cron 惯例按“或”匹配
+}
+
+// cronField 描述 cron 各字段的取值范围
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"分钟", 0, 59},
+	{"小时", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	{"星期", 0, 7}, // 0 和 7 都表示周日
+}
+
+var weekdayNames = map[string]int{
+	"日": 0, "天": 0, "一": 1, "二": 2, "三": 3, "四": 4, "五": 5, "六": 6,
+}
+
+var (
+	dailyPattern   = regexp.MustCompile(`^每天\s*(\d{1,2}):(\d{2})$`)
+	weeklyPattern  = regexp.MustCompile(`^每周([日天一二三四五六])\s*(\d{1,2}):(\d{2})$`)
+	monthlyPattern = regexp.MustCompile(`^每月(\d{1,2})[号日]\s*(\d{1,2}):(\d{2})$`)
+)
+
+// parseRecurringSpec 解析周期表达式，支持“每天 10:00”“每周一 10:00”“每月1号 10:00”以及五段式 cron 表达式，
+// 返回对应的 cron 表达式
+func parseRecurringSpec(input string) (string, *cronSchedule, error) {
+	input = strings.TrimSpace(input)
+	expr := input
+	if m := dailyPattern.FindStringSubmatch(input); m != nil {
+		expr = fmt.Sprintf("%s %s * * *", m[2], m[1])
+	} else if m := weeklyPattern.FindStringSubmatch(input); m != nil {
+		expr = fmt.Sprintf("%s %s * * %d", m[3], m[2], weekdayNames[m[1]])
+	} else if m := monthlyPattern.FindStringSubmatch(input); m != nil {
+		expr = fmt.Sprintf("%s %s %s * *", m[3], m[2], m[1])
+	}
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	return expr, schedule, nil
+}
+
+// parseCron 解析五段式 cron 表达式，每段支持 *、数字、范围 a-b、列表 a,b 和步长 */n、a-b/n
+func parseCron(expr string) (*cronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron 表达式需要 5 段（分 时 日 月 周），实际为 %d 段", len(parts))
+	}
+	bits := make([]uint64, len(parts))
+	for i, part := range parts {
+		b, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 周字段中的 7 与 0 同为周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			rangePart = item[:i]
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s字段的步长无效：%s", f.name, item)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("%s字段无效：%s", f.name, item)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("%s字段无效：%s", f.name, item)
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s字段超出范围 %d-%d：%s", f.name, f.min, f.max, item)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// next 返回 t 之后（不含 t 所在的分钟）第一个满足表达式的时间，五年内都没有匹配时返回零值
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
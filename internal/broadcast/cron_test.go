@@ -0,0 +1,75 @@
+package broadcast
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurringSpec(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantExpr string
+		wantErr  string
+	}{
+		{"每天 10:00", "00 10 * * *", ""},
+		{"每天9:30", "30 9 * * *", ""},
+		{"每周一 08:15", "15 08 * * 1", ""},
+		{"每周日 20:00", "00 20 * * 0", ""},
+		{"每周天 20:00", "00 20 * * 0", ""},
+		{"每月1号 10:00", "00 10 1 * *", ""},
+		{"每月15日 23:59", "59 23 15 * *", ""},
+		{"  */15 9-18 * * 1-5  ", "*/15 9-18 * * 1-5", ""},
+		{"每天 25:00", "", "小时字段超出范围"},
+		{"每月32号 10:00", "", "日字段超出范围"},
+		{"每天 10:60", "", "分钟字段超出范围"},
+		{"0 10 * *", "", "需要 5 段"},
+		{"0 10 * * 8", "", "星期字段超出范围"},
+		{"*/0 * * * *", "", "步长无效"},
+		{"a 10 * * *", "", "分钟字段无效"},
+		{"0 18-9 * * *", "", "小时字段超出范围"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, schedule, err := parseRecurringSpec(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseRecurringSpec(%q) 错误 = %v，期望包含 %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || schedule == nil || expr != tt.wantExpr {
+				t.Errorf("parseRecurringSpec(%q) = %q, %v，期望 %q", tt.input, expr, err, tt.wantExpr)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-01 是周一
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 10 * * *", time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * 5", time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 1, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 日和周都指定时按“或”匹配：15 号或周三，先到的是 1 月 3 日周三
+		{"0 0 15 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := schedule.next(from); !got.Equal(tt.want) {
+			t.Errorf("%q 的下次执行时间 = %v，期望 %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/keyboard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// AudienceUnengagedPrefix 后接广播 ID，表示收到该广播但未点击任何按钮的用户
+const AudienceUnengagedPrefix = "unengaged:"
+
+// previewBroadcastID 是预览消息中追踪按钮使用的广播 ID 前缀，后接管理员的 chatID，预览的点击不计入统计
+const previewBroadcastID = "preview"
+
+// previewID 返回管理员预览消息使用的广播 ID，每个管理员各自一份，互不覆盖
+func previewID(chatID int64) string {
+	return previewBroadcastID + strconv.FormatInt(chatID, 10)
+}
+
+// saveCallbackReplies 保存回调按钮的提示文字，草稿按钮的 callback_data 中只有提示文字的短键
+func (m *Manager) saveCallbackReplies(chatID int64, replies map[string]string) bool {
+	if err := m.RedisClient.SaveCallbackReplies(context.Background(), replies); err != nil {
+		log.Printf("保存回调按钮提示文字失败，chatID %d: %v", chatID, err)
+		return false
+	}
+	return true
+}
+
+// callbackReplies 读取键盘中回调按钮的提示文字（短键 -> 提示文字）
+func (m *Manager) callbackReplies(ctx context.Context, markup tgbotapi.InlineKeyboardMarkup) map[string]string {
+	replies, err := m.RedisClient.GetCallbackReplies(ctx, keyboard.CallbackKeys(markup))
+	if err != nil {
+		log.Printf("读取回调按钮提示文字失败: %v", err)
+	}
+	return replies
+}
+
+// previewButtons 将预览消息中的回调按钮替换为 bclick_ 按钮，使用管理员自己的预览 ID
+func (m *Manager) previewButtons(chatID int64, markup tgbotapi.InlineKeyboardMarkup) tgbotapi.InlineKeyboardMarkup {
+	if !keyboard.HasCallbackButtons(markup) {
+		return markup
+	}
+	ctx := context.Background()
+	id := previewID(chatID)
+	markup, links := trackedButtons(id, markup, m.callbackReplies(ctx, markup), false)
+	if err := m.RedisClient.SaveBroadcastLinks(ctx, id, links); err != nil {
+		log.Printf("保存预览按钮失败，chatID %d: %v", chatID, err)
+	}
+	return markup
+}
+
+// trackedButtons 将回调按钮（以及 trackURLs 为 true 时的 URL 按钮）替换为携带广播 ID 的 bclick_ 按钮，
+// 用户点击时可记录互动。返回的 links 以按钮序号保存原始“按钮文字 | 链接”或“按钮文字 | 回调:提示文字”，
+// 点击后据此把链接发给用户或弹出提示；replies 为回调按钮短键对应的提示文字。
+func trackedButtons(id string, markup tgbotapi.InlineKeyboardMarkup, replies map[string]string, trackURLs bool) (tgbotapi.InlineKeyboardMarkup, map[string]string) {
+	links := make(map[string]string)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	index := 0
+	for _, row := range markup.InlineKeyboard {
+		var newRow []tgbotapi.InlineKeyboardButton
+		for _, button := range row {
+			key := strconv.Itoa(index)
+			if replyKey, ok := keyboard.CallbackKey(button); ok {
+				links[key] = fmt.Sprintf("%s | %s%s", button.Text, keyboard.CallbackPrefix, replies[replyKey])
+			} else if button.URL != nil && trackURLs {
+				links[key] = fmt.Sprintf("%s | %s", button.Text, *button.URL)
+			} else {
+				newRow = append(newRow, button)
+				continue
+			}
+			newRow = append(newRow, tgbotapi.NewInlineKeyboardButtonData(button.Text, fmt.Sprintf("bclick_%s_%s", id, key)))
+			index++
+		}
+		rows = append(rows, newRow)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), links
+}
+
+// handleClickCallback records that a recipient tapped a tracked broadcast button, then either sends them
+// the link or shows the callback button's reply.
+func (m *Manager) handleClickCallback(q *tgbotapi.CallbackQuery) {
+	parts := strings.Split(q.Data, "_")
+	if len(parts) != 3 {
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	id, index := parts[1], parts[2]
+	ctx := context.Background()
+
+	if !strings.HasPrefix(id, previewBroadcastID) {
+		if err := m.RedisClient.RecordBroadcastClick(ctx, id, index, q.From.ID); err != nil {
+			log.Printf("记录广播 %s 用户 %d 的点击失败: %v", id, q.From.ID, err)
+		}
+	}
+
+	link, err := m.RedisClient.GetBroadcastLink(ctx, id, index)
+	if err != nil || link == "" {
+		log.Printf("获取广播 %s 按钮 %s 的链接失败: %v", id, index, err)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "链接已失效"))
+		return
+	}
+
+	parts = strings.SplitN(link, "|", 2)
+	text := strings.TrimSpace(parts[0])
+	url := strings.TrimSpace(parts[len(parts)-1])
+	if reply, ok := keyboard.ParseCallbackTarget(url); ok {
+		answer := tgbotapi.NewCallbackWithAlert(q.ID, reply)
+		m.API.Request(answer)
+		return
+	}
+	m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+
+	msg := tgbotapi.NewMessage(q.From.ID, "🔗 "+text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonURL("点击打开", url),
+	))
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送广播链接给用户 %d 失败: %v", q.From.ID, err)
+	}
+}
+
+// unengagedSegment 返回可用于“上次广播未互动用户”的广播 ID；不可用时返回空 ID 和原因
+func (m *Manager) unengagedSegment(ctx context.Context) (id string, note string) {
+	id, trackClicks, err := m.RedisClient.GetLastBroadcast(ctx)
+	if err != nil {
+		log.Printf("获取上次广播失败: %v", err)
+		return "", "无法读取上次广播记录"
+	}
+	if id == "" {
+		return "", "还没有已完成的广播"
+	}
+	if !trackClicks {
+		return "", fmt.Sprintf("上次广播 #%s 未开启点击追踪", id)
+	}
+	return id, ""
+}
+
+// executeUnengagedBroadcast 将当前草稿发送给收到上次广播但没有点击按钮的用户
+func (m *Manager) executeUnengagedBroadcast(q *tgbotapi.CallbackQuery) bool {
+	chatID := q.Message.Chat.ID
+	broadcast := m.Broadcasts[chatID]
+	if broadcast.Text == "" && broadcast.MediaID == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "无法发送，广播内容为空。"))
+		return false
+	}
+
+	ctx := context.Background()
+	lastID, note := m.unengagedSegment(ctx)
+	if lastID == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "“上次广播未互动用户”暂不可用："+note+"。\n开启「📊 点击追踪」发送一次全员广播后即可使用。"))
+		return false
+	}
+
+	id, err := m.RedisClient.NextBroadcastID(ctx)
+	if err != nil {
+		log.Printf("生成广播ID失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "广播失败：无法创建广播任务。"))
+		return false
+	}
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("🎯 正在发送给广播 #%s 的未互动用户…", lastID)))
+	m.auditBroadcast(q.From.ID, id, broadcast, AudienceUnengagedPrefix+lastID, "重发给未互动用户")
+	m.deliverBroadcast(chatID, id, broadcast, AudienceUnengagedPrefix+lastID)
+	return true
+}
+
+// ListBroadcastClickStats shows click-through statistics for recent broadcasts with tracked buttons,
+// or for a single broadcast when an ID is given.
+func (m *Manager) ListBroadcastClickStats(chatID int64, id string) {
+	ctx := context.Background()
+	ids := []string{strings.TrimPrefix(id, "#")}
+	if ids[0] == "" {
+		var err error
+		ids, err = m.RedisClient.GetClickHistory(ctx)
+		if err != nil {
+			log.Printf("获取广播点击统计列表失败: %v", err)
+			m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取广播点击统计失败。"))
+			return
+		}
+		if len(ids) == 0 {
+			m.API.Send(tgbotapi.NewMessage(chatID, "还没有带追踪按钮的广播。开启「📊 点击追踪」或添加回调按钮（按钮文字 | 回调:提示文字）后发送广播即可统计点击。"))
+			return
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📊 广播点击统计：\n")
+	for _, id := range ids {
+		stats, err := m.RedisClient.GetBroadcastClickStats(ctx, id)
+		if err != nil {
+			log.Printf("获取广播 %s 点击统计失败: %v", id, err)
+			sb.WriteString(fmt.Sprintf("\n#%s：读取失败\n", id))
+			continue
+		}
+		if len(stats.Buttons) == 0 {
+			sb.WriteString(fmt.Sprintf("\n#%s：没有追踪按钮或统计已过期\n", id))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n#%s 送达 %d 人，%d 人点击（%s）\n", id, stats.Delivered, stats.Engaged, clickRate(stats.Engaged, stats.Delivered)))
+		for _, button := range stats.Buttons {
+			label := strings.TrimSpace(strings.SplitN(button.Label, "|", 2)[0])
+			sb.WriteString(fmt.Sprintf("  • %s：%d 次，%d 人（%s）\n", label, button.Clicks, button.Users, clickRate(button.Users, stats.Delivered)))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("\n统计保留 %d 天，使用 /broadcaststats <广播ID> 查看单次广播。", int(cache.BroadcastTrackingTTL.Hours()/24)))
+	m.API.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
+
+// clickRate 返回点击率的百分比文本
+func clickRate(clicked, delivered int64) string {
+	if delivered == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(clicked)*100/float64(delivered))
+}
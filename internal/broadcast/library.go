@@ -0,0 +1,120 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// promptBroadcastTemplateName asks the admin to name the current draft so it can be reused later.
+func (m *Manager) promptBroadcastTemplateName(chatID int64) {
+	broadcast := m.Broadcasts[chatID]
+	if broadcast.Text == "" && broadcast.MediaID == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "广播内容为空，无法保存为广播模板。"))
+		return
+	}
+	m.AdminStates[chatID] = StateBroadcastAwaitLibraryName
+	msg := tgbotapi.NewMessage(chatID, "请输入广播模板的名称（同名模板将被覆盖）：")
+	msg.ReplyMarkup = m.getCancelKeyboard()
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送广播模板名称提示失败，chatID %d: %v", chatID, err)
+	}
+	log.Printf("设置状态为 StateBroadcastAwaitLibraryName，chatID: %d", chatID)
+}
+
+// handleBroadcastTemplateNameInput saves the whole current draft (text, media, buttons and options) under the given name.
+func (m *Manager) handleBroadcastTemplateNameInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	name := strings.TrimSpace(msg.Text)
+	if name == "" || len(name) > maxTemplateNameBytes {
+		errMsg := tgbotapi.NewMessage(chatID, "模板名称不能为空且不能过长，请重新输入：")
+		errMsg.ReplyMarkup = m.getCancelKeyboard()
+		m.API.Send(errMsg)
+		return
+	}
+
+	payload, err := json.Marshal(m.Broadcasts[chatID])
+	if err == nil {
+		err = m.RedisClient.SaveBroadcastTemplate(context.Background(), name, string(payload))
+	}
+	if err != nil {
+		log.Printf("保存广播模板失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 保存广播模板失败，请稍后再试。"))
+		return
+	}
+
+	m.AdminStates[chatID] = 0 // StateNone
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, msg.MessageID))
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 广播模板「%s」已保存，使用 /broadcasttemplates 查看。", name)))
+	m.sendBroadcastBuilderMenu(chatID)
+	log.Printf("广播模板 %s 已保存，chatID: %d", name, chatID)
+}
+
+// ListBroadcastTemplates lists saved broadcast templates with buttons to start a broadcast from each one or delete it.
+func (m *Manager) ListBroadcastTemplates(chatID int64) {
+	names, err := m.RedisClient.GetBroadcastTemplateNames(context.Background())
+	if err != nil {
+		log.Printf("获取广播模板失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取广播模板失败。"))
+		return
+	}
+	if len(names) == 0 {
+		m.API.Send(tgbotapi.NewMessage(chatID, "还没有保存任何广播模板。在 /broadcast 构建菜单中点击「📝 保存为广播模板」即可保存。"))
+		return
+	}
+	sort.Strings(names)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, name := range names {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🚀 "+name, "blib_use_"+name),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 删除", "blib_del_"+name),
+		))
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("广播模板共 %d 个，点击模板以其内容开始新的广播：", len(names)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	m.API.Send(msg)
+}
+
+// handleLibraryCallback starts a new broadcast from a saved template or deletes it.
+func (m *Manager) handleLibraryCallback(q *tgbotapi.CallbackQuery) {
+	ctx := context.Background()
+	chatID := q.Message.Chat.ID
+
+	switch {
+	case strings.HasPrefix(q.Data, "blib_use_"):
+		name := strings.TrimPrefix(q.Data, "blib_use_")
+		payload, err := m.RedisClient.GetBroadcastTemplate(ctx, name)
+		var broadcast Message
+		if err == nil && payload != "" {
+			err = json.Unmarshal([]byte(payload), &broadcast)
+		}
+		if err != nil || payload == "" {
+			log.Printf("读取广播模板 %s 失败，chatID %d: %v", name, chatID, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 模板不存在或已损坏"))
+			return
+		}
+		m.Broadcasts[chatID] = broadcast
+		m.AdminStates[chatID] = 0 // StateNone
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已载入广播模板"))
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		m.sendBroadcastBuilderMenu(chatID)
+		log.Printf("从广播模板 %s 开始广播构建，chatID: %d", name, chatID)
+	case strings.HasPrefix(q.Data, "blib_del_"):
+		name := strings.TrimPrefix(q.Data, "blib_del_")
+		if err := m.RedisClient.DeleteBroadcastTemplate(ctx, name); err != nil {
+			log.Printf("删除广播模板 %s 失败，chatID %d: %v", name, chatID, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 删除失败"))
+			return
+		}
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 模板已删除"))
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		m.ListBroadcastTemplates(chatID)
+		log.Printf("删除广播模板 %s，chatID: %d", name, chatID)
+	}
+}
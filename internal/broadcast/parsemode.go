@@ -0,0 +1,113 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// parseModeLabel 返回广播格式的显示名称
+func parseModeLabel(mode string) string {
+	switch mode {
+	case tgbotapi.ModeMarkdownV2:
+		return "MarkdownV2"
+	case tgbotapi.ModeHTML:
+		return "HTML"
+	default:
+		return "纯文本"
+	}
+}
+
+// parseModeHint 返回对应格式的书写提示
+func parseModeHint(mode string) string {
+	switch mode {
+	case tgbotapi.ModeMarkdownV2:
+		return "MarkdownV2 支持 *粗体* _斜体_ __下划线__ ~删除线~ `代码` [文字](链接)，" +
+			"其余位置的 _ * [ ] ( ) ~ ` > # + - = | { } . ! 需要在前面加 \\ 转义。"
+	case tgbotapi.ModeHTML:
+		return "HTML 支持 <b> <i> <u> <s> <code> <pre> <a href=\"链接\"> 等标签，" +
+			"普通文本中的 < > & 需要写成 &lt; &gt; &amp;。"
+	default:
+		return "纯文本不解析任何格式，文本会原样发送。"
+	}
+}
+
+// sendParseModeMenu 显示广播格式选择菜单
+func (m *Manager) sendParseModeMenu(chatID int64) {
+	current := m.Broadcasts[chatID].ParseMode
+	option := func(mode, data string) tgbotapi.InlineKeyboardButton {
+		label := parseModeLabel(mode)
+		if mode == current {
+			label = "✅ " + label
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(label, data)
+	}
+	msg := tgbotapi.NewMessage(chatID, "请选择广播文本的格式，切换时会用当前文本发送一条预览进行校验：\n\n"+
+		"• "+parseModeHint(tgbotapi.ModeMarkdownV2)+"\n• "+parseModeHint(tgbotapi.ModeHTML))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			option("", "bbuild_pm_plain"),
+			option(tgbotapi.ModeMarkdownV2, "bbuild_pm_markdown"),
+			option(tgbotapi.ModeHTML, "bbuild_pm_html"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回", "bbuild_pm_back"),
+		),
+	)
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送广播格式菜单失败，chatID %d: %v", chatID, err)
+	}
+}
+
+// handleParseModeCallback 切换广播格式。已有文本时先校验，格式错误则保留原格式并提示原因
+func (m *Manager) handleParseModeCallback(q *tgbotapi.CallbackQuery) {
+	chatID := q.Message.Chat.ID
+	mode := ""
+	switch q.Data {
+	case "bbuild_pm_markdown":
+		mode = tgbotapi.ModeMarkdownV2
+	case "bbuild_pm_html":
+		mode = tgbotapi.ModeHTML
+	case "bbuild_pm_back":
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		m.sendBroadcastBuilderMenu(chatID)
+		return
+	}
+
+	broadcast := m.Broadcasts[chatID]
+	if err := m.validateBroadcastText(chatID, mode, broadcast.Text); err != nil {
+		m.API.Send(tgbotapi.NewMessage(chatID, err.Error()+"\n\n格式未切换，请先修改文本内容。"))
+		return
+	}
+	broadcast.ParseMode = mode
+	m.Broadcasts[chatID] = broadcast
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+	m.sendBroadcastBuilderMenu(chatID)
+	log.Printf("广播格式设置为 %s，chatID: %d", parseModeLabel(mode), chatID)
+}
+
+// validateBroadcastText 按指定格式把文本作为预览发给管理员，由 Telegram 校验格式是否正确。
+// 格式错误时返回包含 Telegram 报错和书写提示的错误，纯文本或空文本不做校验。
+func (m *Manager) validateBroadcastText(chatID int64, mode, text string) error {
+	if mode == "" || text == "" {
+		return nil
+	}
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonEmpty("text", "📢 "+text)
+	params.AddNonEmpty("parse_mode", mode)
+	_, err := m.API.MakeRequest("sendMessage", params)
+	if err == nil {
+		return nil
+	}
+
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) && strings.Contains(tgErr.Message, "can't parse entities") {
+		return fmt.Errorf("❌ 文本不符合 %s 格式：%s\n%s", parseModeLabel(mode), tgErr.Message, parseModeHint(mode))
+	}
+	log.Printf("发送格式预览失败，chatID %d: %v", chatID, err)
+	return nil
+}
@@ -0,0 +1,89 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// progressInterval 广播进度消息的刷新间隔，过于频繁会触发编辑消息的限流
+const progressInterval = 3 * time.Second
+
+// startRun 登记一个正在发送的广播，返回在管理员点击“停止发送”时被取消的 context 及清理函数
+func (m *Manager) startRun(id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.runMu.Lock()
+	m.running[id] = cancel
+	m.runMu.Unlock()
+	return ctx, func() {
+		m.runMu.Lock()
+		delete(m.running, id)
+		m.runMu.Unlock()
+		cancel()
+	}
+}
+
+// stopRun 取消正在发送的广播，广播不在发送中时返回 false
+func (m *Manager) stopRun(id string) bool {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	cancel, ok := m.running[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// RunningBroadcasts 返回正在发送的广播 ID
+func (m *Manager) RunningBroadcasts() []string {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	ids := make([]string, 0, len(m.running))
+	for id := range m.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// handleStopCallback handles the "⏹ 停止发送" button on a broadcast progress message.
+func (m *Manager) handleStopCallback(q *tgbotapi.CallbackQuery) {
+	id := strings.TrimPrefix(q.Data, "bstop_")
+	if !m.stopRun(id) {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "广播已结束"))
+		return
+	}
+	m.API.Request(tgbotapi.NewCallback(q.ID, "⏹ 正在停止发送…"))
+	log.Printf("管理员 %d 停止了广播 %s", q.From.ID, id)
+}
+
+// stopKeyboard 返回进度消息上的停止按钮
+func stopKeyboard(id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⏹ 停止发送", "bstop_"+id),
+	))
+}
+
+// progressText 生成进度消息的文本，如“📤 广播 #12 已发送 1 200/8 000”
+func progressText(label, id string, processed, total int) string {
+	return fmt.Sprintf("📤 %s #%s 已发送 %s/%s", label, id, formatCount(processed), formatCount(total))
+}
+
+// formatCount 每三位用空格分隔数字，便于阅读较大的用户数
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	var sb strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
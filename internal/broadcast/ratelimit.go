@@ -0,0 +1,113 @@
+package broadcast
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sendBurst        = 5                // 令牌桶容量，限制瞬时突发的发送数
+	maxSendAttempts  = 5                // 单条消息遇到限流时的最多尝试次数
+	baseRetryBackoff = time.Second      // 未返回 retry_after 时的初始退避时间，之后逐次翻倍
+	maxRetryBackoff  = 60 * time.Second // 退避时间上限
+	refillInterval   = time.Second / MaxSendsPerSecond
+)
+
+// rateLimiter 是所有广播共享的令牌桶，以 MaxSendsPerSecond 的速度补充令牌。
+// 收到 429 时调用 pause，让所有 worker 一起等待，而不是各自继续撞限流。
+type rateLimiter struct {
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{tokens: sendBurst, last: time.Now()}
+}
+
+// wait 阻塞直到取得一个令牌
+func (l *rateLimiter) wait() {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if now.Before(l.pausedUntil) {
+			delay := l.pausedUntil.Sub(now)
+			l.mu.Unlock()
+			time.Sleep(delay)
+			continue
+		}
+		l.tokens += float64(now.Sub(l.last)) / float64(refillInterval)
+		if l.tokens > sendBurst {
+			l.tokens = sendBurst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		delay := time.Duration((1 - l.tokens) * float64(refillInterval))
+		l.mu.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+// pause 在 d 时间内暂停发放令牌
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		l.tokens = 0
+	}
+}
+
+// requestWithRetry 经过限流器调用 Bot API 接口。遇到 429 Too Many Requests 时按 retry_after（没有时按指数退避）
+// 暂停所有发送后重试，其他错误直接返回。
+func (m *Manager) requestWithRetry(endpoint string, params tgbotapi.Params) error {
+	return m.withRetry(func() error {
+		_, err := m.API.MakeRequest(endpoint, params)
+		return err
+	})
+}
+
+// withRetry 经过限流器执行一次发送，按 requestWithRetry 的规则处理限流
+func (m *Manager) withRetry(send func() error) error {
+	backoff := baseRetryBackoff
+	var err error
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		m.limiter.wait()
+		err = send()
+
+		delay, limited := retryDelay(err, backoff)
+		if !limited {
+			return err
+		}
+		log.Printf("发送广播被限流（第 %d 次），暂停 %v 后重试", attempt, delay)
+		m.limiter.pause(delay)
+		backoff = nextBackoff(backoff)
+	}
+	return err
+}
+
+// retryDelay 判断 err 是否为 429 限流错误，是则返回应暂停的时间：有 retry_after 时按它，否则按当前退避时间
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var tgErr *tgbotapi.Error
+	if err == nil || !errors.As(err, &tgErr) || tgErr.Code != 429 {
+		return 0, false
+	}
+	if tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second, true
+	}
+	return backoff, true
+}
+
+// nextBackoff 将退避时间翻倍，不超过 maxRetryBackoff
+func nextBackoff(backoff time.Duration) time.Duration {
+	return min(backoff*2, maxRetryBackoff)
+}
@@ -0,0 +1,108 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		backoff     time.Duration
+		wantDelay   time.Duration
+		wantLimited bool
+	}{
+		{"发送成功", nil, time.Second, 0, false},
+		{"普通错误", errors.New("network"), time.Second, 0, false},
+		{"其他 API 错误", &tgbotapi.Error{Code: 403, Message: "Forbidden"}, time.Second, 0, false},
+		{"按 retry_after 暂停", &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}, time.Second, 7 * time.Second, true},
+		{"没有 retry_after 时按退避时间", &tgbotapi.Error{Code: 429}, 4 * time.Second, 4 * time.Second, true},
+		{"包装后的限流错误", fmt.Errorf("发送: %w", &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 2}}), time.Second, 2 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, limited := retryDelay(tt.err, tt.backoff)
+			if delay != tt.wantDelay || limited != tt.wantLimited {
+				t.Errorf("retryDelay = %v, %v，期望 %v, %v", delay, limited, tt.wantDelay, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		want    time.Duration
+	}{
+		{baseRetryBackoff, 2 * time.Second},
+		{16 * time.Second, 32 * time.Second},
+		{32 * time.Second, maxRetryBackoff},
+		{maxRetryBackoff, maxRetryBackoff},
+	}
+	for _, tt := range tests {
+		if got := nextBackoff(tt.backoff); got != tt.want {
+			t.Errorf("nextBackoff(%v) = %v，期望 %v", tt.backoff, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	l := newRateLimiter()
+	l.pause(10 * time.Second)
+	until := l.pausedUntil
+	if l.tokens != 0 || time.Until(until) <= 9*time.Second {
+		t.Fatalf("pause 后 tokens = %v、剩余暂停 %v，期望清空令牌并暂停约 10s", l.tokens, time.Until(until))
+	}
+	// 较短的暂停不会提前结束已有的暂停
+	l.pause(time.Second)
+	if !l.pausedUntil.Equal(until) {
+		t.Errorf("较短的 pause 将暂停结束时间改为 %v，期望保持 %v", l.pausedUntil, until)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := newRateLimiter()
+	start := time.Now()
+	for i := 0; i < sendBurst; i++ {
+		l.wait()
+	}
+	if elapsed := time.Since(start); elapsed >= refillInterval {
+		t.Errorf("突发的 %d 个令牌耗时 %v，期望无需等待", sendBurst, elapsed)
+	}
+	l.wait()
+	if elapsed := time.Since(start); elapsed < refillInterval/2 {
+		t.Errorf("令牌耗尽后第 %d 次取令牌只用了 %v，期望等待补充", sendBurst+1, elapsed)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"一次成功", []error{nil}, 1, false},
+		{"其他错误不重试", []error{&tgbotapi.Error{Code: 400, Message: "Bad Request"}}, 1, true},
+		{"限流后重试成功", []error{&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}}, nil}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{limiter: newRateLimiter()}
+			attempts := 0
+			err := m.withRetry(func() error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			if attempts != tt.wantAttempts || (err != nil) != tt.wantErr {
+				t.Errorf("withRetry 尝试 %d 次、err = %v，期望尝试 %d 次、出错 %v", attempts, err, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// recurringBroadcast 是保存在 Redis 中的周期广播
+type recurringBroadcast struct {
+	ID        string    `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	CreatedBy int64     `json:"created_by,omitempty"` // 设置周期广播的管理员，旧数据中没有时以 ChatID 代替
+	Spec      string    `json:"spec"`                 // 管理员输入的周期，如“每周一 10:00”
+	Cron      string    `json:"cron"`                 // 对应的五段式 cron 表达式
+	Message   Message   `json:"message"`
+	Paused    bool      `json:"paused,omitempty"`
+	NextRun   time.Time `json:"next_run"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+}
+
+// promptRecurringSpec asks the admin how often the current draft should be sent.
+func (m *Manager) promptRecurringSpec(chatID int64) {
+	m.AdminStates[chatID] = StateBroadcastAwaitRecurringSpec
+	text := "请输入发送周期，例如：\n" +
+		"`每天 09:30`\n`每周一 10:00`\n`每月1号 08:00`\n" +
+		"也可以输入五段式 cron 表达式（分 时 日 月 周），例如 `0 10 * * 1-5` 表示工作日 10:00。"
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = m.getCancelKeyboard()
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送周期提示失败，chatID %d: %v", chatID, err)
+	}
+	log.Printf("设置状态为 StateBroadcastAwaitRecurringSpec，chatID: %d", chatID)
+}
+
+// handleRecurringSpecInput saves the current draft as a recurring broadcast.
+func (m *Manager) handleRecurringSpecInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	spec := strings.TrimSpace(msg.Text)
+	expr, schedule, err := parseRecurringSpec(spec)
+	if err != nil {
+		errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 周期格式错误：%v\n请重新输入。", err))
+		errMsg.ReplyMarkup = m.getCancelKeyboard()
+		m.API.Send(errMsg)
+		return
+	}
+	nextRun := schedule.next(time.Now())
+	if nextRun.IsZero() {
+		errMsg := tgbotapi.NewMessage(chatID, "❌ 该周期在未来五年内不会触发，请重新输入。")
+		errMsg.ReplyMarkup = m.getCancelKeyboard()
+		m.API.Send(errMsg)
+		return
+	}
+
+	broadcast := m.Broadcasts[chatID]
+	if broadcast.Text == "" && broadcast.MediaID == "" {
+		m.AdminStates[chatID] = 0 // StateNone
+		m.API.Send(tgbotapi.NewMessage(chatID, "无法设置周期发送，广播内容为空。"))
+		return
+	}
+
+	ctx := context.Background()
+	id, err := m.RedisClient.NextRecurringBroadcastID(ctx)
+	if err == nil {
+		err = m.saveRecurring(ctx, recurringBroadcast{ID: id, ChatID: chatID, CreatedBy: msg.From.ID, Spec: spec, Cron: expr, Message: broadcast, NextRun: nextRun})
+	}
+	if err != nil {
+		log.Printf("保存周期广播失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 保存周期广播失败，请稍后再试。"))
+		return
+	}
+
+	m.AdminStates[chatID] = 0 // StateNone
+	delete(m.Broadcasts, chatID)
+	if m.BroadcastPromptMessageIDs[chatID] != 0 {
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, m.BroadcastPromptMessageIDs[chatID]))
+		delete(m.BroadcastPromptMessageIDs, chatID)
+	}
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, msg.MessageID))
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 周期广播 #%s 已创建（%s），下次发送时间：%s。\n使用 /recurring 查看、暂停或删除。", id, spec, nextRun.Format(scheduleTimeLayout))))
+	log.Printf("周期广播 %s 已保存，chatID %d，周期 %s（%s）", id, chatID, spec, expr)
+}
+
+// ListRecurringBroadcasts shows all recurring broadcasts with buttons to pause, resume or delete each one.
+func (m *Manager) ListRecurringBroadcasts(chatID int64) {
+	jobs, err := m.loadRecurringBroadcasts(context.Background())
+	if err != nil {
+		log.Printf("获取周期广播列表失败: %v", err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取周期广播列表失败。"))
+		return
+	}
+	if len(jobs) == 0 {
+		m.API.Send(tgbotapi.NewMessage(chatID, "当前没有周期广播。在 /broadcast 构建菜单中点击「🔁 周期发送」即可创建。"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("周期广播：\n")
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, job := range jobs {
+		status := "下次发送 " + job.NextRun.Format(scheduleTimeLayout)
+		toggle := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⏸ 暂停 #%s", job.ID), "brec_pause_"+job.ID)
+		if job.Paused {
+			status = "已暂停"
+			toggle = tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("▶️ 恢复 #%s", job.ID), "brec_resume_"+job.ID)
+		}
+		sb.WriteString(fmt.Sprintf("#%s %s（%s）\n   %s\n", job.ID, job.Spec, status, schedulePreview(job.Message)))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			toggle,
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 删除 #%s", job.ID), "brec_del_"+job.ID),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	m.API.Send(msg)
+}
+
+// handleRecurringCallback pauses, resumes or deletes a recurring broadcast.
+func (m *Manager) handleRecurringCallback(q *tgbotapi.CallbackQuery) {
+	ctx := context.Background()
+	chatID := q.Message.Chat.ID
+	action := strings.TrimPrefix(q.Data, "brec_")
+	i := strings.Index(action, "_")
+	if i < 0 {
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	action, id := action[:i], action[i+1:]
+
+	if action == "del" {
+		if err := m.RedisClient.DeleteRecurringBroadcast(ctx, id); err != nil {
+			log.Printf("删除周期广播 %s 失败: %v", id, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 删除失败"))
+			return
+		}
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 周期广播已删除"))
+		log.Printf("周期广播 %s 已删除，chatID %d", id, chatID)
+	} else {
+		job, err := m.loadRecurring(ctx, id)
+		if err != nil {
+			log.Printf("读取周期广播 %s 失败: %v", id, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 周期广播不存在"))
+			return
+		}
+		job.Paused = action == "pause"
+		if !job.Paused {
+			// 恢复时从现在起重新计算，不补发暂停期间错过的发送
+			if schedule, err := parseCron(job.Cron); err == nil {
+				job.NextRun = schedule.next(time.Now())
+			}
+		}
+		if err := m.saveRecurring(ctx, job); err != nil {
+			log.Printf("更新周期广播 %s 失败: %v", id, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 操作失败"))
+			return
+		}
+		answer := "▶️ 周期广播已恢复"
+		if job.Paused {
+			answer = "⏸ 周期广播已暂停"
+		}
+		m.API.Request(tgbotapi.NewCallback(q.ID, answer))
+		log.Printf("周期广播 %s 暂停状态设为 %v，chatID %d", id, job.Paused, chatID)
+	}
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+	m.ListRecurringBroadcasts(chatID)
+}
+
+// runDueRecurringBroadcasts 发送所有到期的周期广播，并计算下次发送时间
+func (m *Manager) runDueRecurringBroadcasts() {
+	ctx := context.Background()
+	jobs, err := m.loadRecurringBroadcasts(ctx)
+	if err != nil {
+		log.Printf("获取周期广播失败: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if job.Paused || job.NextRun.IsZero() || job.NextRun.After(now) {
+			continue
+		}
+		schedule, err := parseCron(job.Cron)
+		if err != nil {
+			log.Printf("周期广播 %s 的表达式 %q 无效，已暂停: %v", job.ID, job.Cron, err)
+			job.Paused = true
+			m.saveRecurring(ctx, job)
+			continue
+		}
+
+		// 先保存下次发送时间再发送，避免发送期间重复触发
+		job.LastRun = now
+		job.NextRun = schedule.next(now)
+		if err := m.saveRecurring(ctx, job); err != nil {
+			log.Printf("更新周期广播 %s 失败，本次跳过: %v", job.ID, err)
+			continue
+		}
+
+		id, err := m.RedisClient.NextBroadcastID(ctx)
+		if err != nil {
+			log.Printf("生成广播ID失败，周期广播 %s 本次跳过: %v", job.ID, err)
+			continue
+		}
+		log.Printf("开始发送周期广播 %s（广播 %s），chatID %d", job.ID, id, job.ChatID)
+		m.API.Send(tgbotapi.NewMessage(job.ChatID, fmt.Sprintf("🔁 周期广播 #%s 开始发送（广播 #%s），下次发送时间：%s。", job.ID, id, job.NextRun.Format(scheduleTimeLayout))))
+		actor := job.CreatedBy
+		if actor == 0 {
+			actor = job.ChatID
+		}
+		m.auditBroadcast(actor, id, job.Message, job.Message.Target, "周期广播 #"+job.ID)
+		m.deliverBroadcast(job.ChatID, id, job.Message, job.Message.Target)
+	}
+}
+
+func (m *Manager) saveRecurring(ctx context.Context, job recurringBroadcast) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return m.RedisClient.SaveRecurringBroadcast(ctx, job.ID, string(payload))
+}
+
+func (m *Manager) loadRecurring(ctx context.Context, id string) (recurringBroadcast, error) {
+	var job recurringBroadcast
+	payload, err := m.RedisClient.GetRecurringBroadcast(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	if payload == "" {
+		return job, fmt.Errorf("周期广播 %s 不存在", id)
+	}
+	err = json.Unmarshal([]byte(payload), &job)
+	return job, err
+}
+
+// loadRecurringBroadcasts 按 ID 顺序返回所有周期广播，无法解析的记录会被跳过
+func (m *Manager) loadRecurringBroadcasts(ctx context.Context) ([]recurringBroadcast, error) {
+	payloads, err := m.RedisClient.GetRecurringBroadcasts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]recurringBroadcast, 0, len(payloads))
+	for id, payload := range payloads {
+		var job recurringBroadcast
+		if err := json.Unmarshal([]byte(payload), &job); err != nil {
+			log.Printf("解析周期广播 %s 失败: %v", id, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(jobs[i].ID, "R"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(jobs[j].ID, "R"))
+		return a < b
+	})
+	return jobs, nil
+}
+
+// CountRecurringBroadcasts 返回启用中和已暂停的周期广播数
+func (m *Manager) CountRecurringBroadcasts(ctx context.Context) (active, paused int, err error) {
+	jobs, err := m.loadRecurringBroadcasts(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, job := range jobs {
+		if job.Paused {
+			paused++
+		} else {
+			active++
+		}
+	}
+	return active, paused, nil
+}
@@ -0,0 +1,241 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	scheduleTimeLayout    = "2006-01-02 15:04"
+	schedulerPollInterval = 30 * time.Second
+	schedulePreviewLength = 30
+)
+
+// scheduledBroadcast 是保存在 Redis 中的定时广播内容
+type scheduledBroadcast struct {
+	ChatID    int64     `json:"chat_id"`
+	CreatedBy int64     `json:"created_by,omitempty"` // 设置定时的管理员，旧数据中没有时以 ChatID 代替
+	SendAt    time.Time `json:"send_at"`
+	Message   Message   `json:"message"`
+}
+
+// StartScheduler starts the goroutine that delivers scheduled broadcasts once they are due.
+func (m *Manager) StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(schedulerPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.runDueBroadcasts()
+			m.runDueRecurringBroadcasts()
+		}
+	}()
+	log.Printf("定时广播调度器已启动，轮询间隔 %s", schedulerPollInterval)
+}
+
+func (m *Manager) runDueBroadcasts() {
+	ctx := context.Background()
+	ids, err := m.RedisClient.GetDueScheduledBroadcastIDs(ctx, time.Now())
+	if err != nil {
+		log.Printf("获取到期定时广播失败: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		claimed, err := m.RedisClient.ClaimScheduledBroadcast(ctx, id)
+		if err != nil {
+			log.Printf("领取定时广播 %s 失败: %v", id, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		scheduled, err := m.loadScheduledBroadcast(ctx, id)
+		if err != nil {
+			log.Printf("读取定时广播 %s 失败: %v", id, err)
+			m.RedisClient.DeleteScheduledBroadcastPayload(ctx, id)
+			continue
+		}
+
+		log.Printf("开始发送定时广播 %s，chatID %d", id, scheduled.ChatID)
+		notice := tgbotapi.NewMessage(scheduled.ChatID, fmt.Sprintf("⏰ 定时广播 #%s 开始发送。", id))
+		m.API.Send(notice)
+		// 广播 ID 沿用定时队列中的 ID，重复触发时会跳过已送达的用户
+		actor := scheduled.CreatedBy
+		if actor == 0 {
+			actor = scheduled.ChatID
+		}
+		m.auditBroadcast(actor, id, scheduled.Message, scheduled.Message.Target, "定时广播")
+		m.deliverBroadcast(scheduled.ChatID, id, scheduled.Message, scheduled.Message.Target)
+		m.RedisClient.DeleteScheduledBroadcastPayload(ctx, id)
+	}
+}
+
+func (m *Manager) loadScheduledBroadcast(ctx context.Context, id string) (scheduledBroadcast, error) {
+	var scheduled scheduledBroadcast
+	payload, err := m.RedisClient.GetScheduledBroadcastPayload(ctx, id)
+	if err != nil {
+		return scheduled, err
+	}
+	if payload == "" {
+		return scheduled, fmt.Errorf("定时广播 %s 内容不存在", id)
+	}
+	err = json.Unmarshal([]byte(payload), &scheduled)
+	return scheduled, err
+}
+
+// promptScheduleTime asks the admin for the time at which the current draft should be sent.
+func (m *Manager) promptScheduleTime(chatID int64) {
+	m.AdminStates[chatID] = StateBroadcastAwaitScheduleTime
+	text := fmt.Sprintf("请输入发送时间，格式为：\n`%s`\n\n例如：`%s`", scheduleTimeLayout, time.Now().Add(time.Hour).Format(scheduleTimeLayout))
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = m.getCancelKeyboard()
+	_, err := m.API.Send(msg)
+	if err != nil {
+		log.Printf("发送定时时间提示失败，chatID %d: %v", chatID, err)
+	}
+	log.Printf("设置状态为 StateBroadcastAwaitScheduleTime，chatID: %d", chatID)
+}
+
+// handleScheduleTimeInput stores the current draft in the schedule queue.
+func (m *Manager) handleScheduleTimeInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	sendAt, err := time.ParseInLocation(scheduleTimeLayout, strings.TrimSpace(msg.Text), time.Local)
+	if err != nil {
+		errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("时间格式错误，请按 %s 格式输入。", scheduleTimeLayout))
+		errMsg.ReplyMarkup = m.getCancelKeyboard()
+		m.API.Send(errMsg)
+		return
+	}
+	if !sendAt.After(time.Now()) {
+		errMsg := tgbotapi.NewMessage(chatID, "发送时间必须晚于当前时间，请重新输入。")
+		errMsg.ReplyMarkup = m.getCancelKeyboard()
+		m.API.Send(errMsg)
+		return
+	}
+
+	broadcast := m.Broadcasts[chatID]
+	if broadcast.Text == "" && broadcast.MediaID == "" {
+		m.AdminStates[chatID] = 0 // StateNone
+		errMsg := tgbotapi.NewMessage(chatID, "无法定时，广播内容为空。")
+		m.API.Send(errMsg)
+		return
+	}
+
+	ctx := context.Background()
+	id, err := m.RedisClient.NextBroadcastID(ctx)
+	if err == nil {
+		var payload []byte
+		payload, err = json.Marshal(scheduledBroadcast{ChatID: chatID, CreatedBy: msg.From.ID, SendAt: sendAt, Message: broadcast})
+		if err == nil {
+			err = m.RedisClient.AddScheduledBroadcast(ctx, id, sendAt, string(payload))
+		}
+	}
+	if err != nil {
+		log.Printf("保存定时广播失败，chatID %d: %v", chatID, err)
+		errMsg := tgbotapi.NewMessage(chatID, "❌ 保存定时广播失败，请稍后再试。")
+		m.API.Send(errMsg)
+		return
+	}
+
+	m.AdminStates[chatID] = 0 // StateNone
+	delete(m.Broadcasts, chatID)
+	if m.BroadcastPromptMessageIDs[chatID] != 0 {
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, m.BroadcastPromptMessageIDs[chatID]))
+		delete(m.BroadcastPromptMessageIDs, chatID)
+	}
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, msg.MessageID))
+
+	reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 定时广播 #%s 已安排在 %s 发送。\n使用 /scheduled 查看或取消。", id, sendAt.Format(scheduleTimeLayout)))
+	m.API.Send(reply)
+	log.Printf("定时广播 %s 已保存，chatID %d，发送时间 %s", id, chatID, sendAt.Format(scheduleTimeLayout))
+}
+
+// ListScheduledBroadcasts shows all pending scheduled broadcasts with a cancel button for each.
+func (m *Manager) ListScheduledBroadcasts(chatID int64) {
+	ctx := context.Background()
+	entries, err := m.RedisClient.GetScheduledBroadcasts(ctx)
+	if err != nil {
+		log.Printf("获取定时广播列表失败: %v", err)
+		failMsg := tgbotapi.NewMessage(chatID, "❌ 获取定时广播列表失败。")
+		m.API.Send(failMsg)
+		return
+	}
+
+	if len(entries) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "当前没有待发送的定时广播。")
+		m.API.Send(msg)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("待发送的定时广播：\n")
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for i, entry := range entries {
+		preview := "（内容已丢失）"
+		if scheduled, err := m.loadScheduledBroadcast(ctx, entry.ID); err == nil {
+			preview = schedulePreview(scheduled.Message)
+		}
+		sb.WriteString(fmt.Sprintf("%d. #%s %s\n   %s\n", i+1, entry.ID, entry.SendAt.Format(scheduleTimeLayout), preview))
+		cancelButton := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("取消 #%s", entry.ID), "sched_cancel_"+entry.ID)
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(cancelButton))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	m.API.Send(msg)
+}
+
+// cancelScheduledBroadcast removes a scheduled broadcast unless the scheduler already took it.
+func (m *Manager) cancelScheduledBroadcast(q *tgbotapi.CallbackQuery) {
+	ctx := context.Background()
+	id := strings.TrimPrefix(q.Data, "sched_cancel_")
+
+	scheduled, err := m.RedisClient.IsBroadcastScheduled(ctx, id)
+	if err != nil {
+		log.Printf("检查定时广播 %s 失败: %v", id, err)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 取消失败，请稍后再试"))
+		return
+	}
+	claimed := false
+	if scheduled {
+		claimed, err = m.RedisClient.ClaimScheduledBroadcast(ctx, id)
+		if err != nil {
+			log.Printf("取消定时广播 %s 失败: %v", id, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 取消失败，请稍后再试"))
+			return
+		}
+	}
+	if !claimed {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "已发送，无法取消"))
+		return
+	}
+
+	m.RedisClient.DeleteScheduledBroadcastPayload(ctx, id)
+	m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 定时广播已取消"))
+	m.API.Request(tgbotapi.NewDeleteMessage(q.Message.Chat.ID, q.Message.MessageID))
+	m.ListScheduledBroadcasts(q.Message.Chat.ID)
+	log.Printf("定时广播 %s 已取消，chatID %d", id, q.Message.Chat.ID)
+}
+
+func schedulePreview(broadcast Message) string {
+	text := strings.ReplaceAll(broadcast.Text, "\n", " ")
+	if utf8.RuneCountInString(text) > schedulePreviewLength {
+		text = string([]rune(text)[:schedulePreviewLength]) + "…"
+	}
+	if broadcast.MediaID != "" {
+		text = fmt.Sprintf("[%s] %s", broadcast.Type, text)
+	}
+	if broadcast.Target != AudienceAll {
+		text += "（发送给" + targetLabel(broadcast.Target) + "）"
+	}
+	return text
+}
@@ -0,0 +1,174 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 按标签筛选的接收范围，后接标签名
+const (
+	AudienceTagPrefix        = "tag:"   // 带有该标签的用户
+	AudienceWithoutTagPrefix = "notag:" // 不带该标签的用户
+)
+
+// 按活跃度筛选的接收范围，后接天数
+const (
+	AudienceActivePrefix   = "active:"   // 最近 N 天内活跃过的用户
+	AudienceInactivePrefix = "inactive:" // 超过 N 天未活跃的用户
+)
+
+// maxTargetTagButtons 选择标签时最多列出的标签数
+const maxTargetTagButtons = 30
+
+// isTargetAudience 报告 audience 是否为广播构建器中可选的筛选范围（标签或活跃度）
+func isTargetAudience(audience string) bool {
+	for _, prefix := range []string{AudienceTagPrefix, AudienceWithoutTagPrefix, AudienceActivePrefix, AudienceInactivePrefix} {
+		if strings.HasPrefix(audience, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// audienceDays 解析活跃度范围中的天数
+func audienceDays(audience, prefix string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimPrefix(audience, prefix))
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("无效的接收范围: %s", audience)
+	}
+	return days, nil
+}
+
+// activityRecipients 返回按活跃度筛选的用户 ID
+func (m *Manager) activityRecipients(ctx context.Context, audience string) ([]string, error) {
+	if strings.HasPrefix(audience, AudienceActivePrefix) {
+		days, err := audienceDays(audience, AudienceActivePrefix)
+		if err != nil {
+			return nil, err
+		}
+		return m.RedisClient.GetActiveUserIDs(ctx, time.Now().AddDate(0, 0, -days))
+	}
+	days, err := audienceDays(audience, AudienceInactivePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return m.RedisClient.GetInactiveUserIDs(ctx, time.Now().AddDate(0, 0, -days))
+}
+
+// targetLabel 返回接收范围的中文描述
+func targetLabel(target string) string {
+	switch {
+	case strings.HasPrefix(target, AudienceActivePrefix):
+		return fmt.Sprintf("最近 %s 天活跃的用户", strings.TrimPrefix(target, AudienceActivePrefix))
+	case strings.HasPrefix(target, AudienceInactivePrefix):
+		return fmt.Sprintf("%s 天以上未活跃的用户", strings.TrimPrefix(target, AudienceInactivePrefix))
+	case strings.HasPrefix(target, AudienceTagPrefix):
+		return fmt.Sprintf("带标签 #%s 的用户", strings.TrimPrefix(target, AudienceTagPrefix))
+	case strings.HasPrefix(target, AudienceWithoutTagPrefix):
+		return fmt.Sprintf("不带标签 #%s 的用户", strings.TrimPrefix(target, AudienceWithoutTagPrefix))
+	}
+	return "所有用户"
+}
+
+// sendTargetMenu 让管理员选择广播的接收范围
+func (m *Manager) sendTargetMenu(chatID int64) {
+	current := m.Broadcasts[chatID].Target
+	text := fmt.Sprintf("当前接收对象：%s\n请选择广播的接收对象：\n（活跃度按用户最后一次给机器人发消息的时间计算，开始记录前联系过、之后再未发消息的用户不计入）", targetLabel(current))
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("👥 所有用户", "bbuild_tgt_all")),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏷️ 带某标签的用户", "bbuild_tgt_with"),
+			tgbotapi.NewInlineKeyboardButtonData("🚫 不带某标签的用户", "bbuild_tgt_without"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🟢 最近 7 天活跃", "bbuild_tgt_act_7"),
+			tgbotapi.NewInlineKeyboardButtonData("🟢 最近 30 天活跃", "bbuild_tgt_act_30"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💤 30 天以上未活跃", "bbuild_tgt_inact_30"),
+		),
+	)
+	if _, err := m.API.Send(msg); err != nil {
+		log.Printf("发送接收对象菜单失败，chatID %d: %v", chatID, err)
+	}
+}
+
+// sendTargetTagList 列出所有标签供选择，exclude 为 true 时选择的是要排除的标签
+func (m *Manager) sendTargetTagList(chatID int64, exclude bool) {
+	counts, err := m.RedisClient.GetTagCounts(context.Background())
+	if err != nil {
+		log.Printf("获取标签列表失败，chatID %d: %v", chatID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取标签列表失败。"))
+		return
+	}
+	if len(counts) == 0 {
+		m.API.Send(tgbotapi.NewMessage(chatID, "还没有任何标签，请先使用 /tag <用户ID|@用户名> <标签> 为用户添加标签。"))
+		return
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	if len(tags) > maxTargetTagButtons {
+		tags = tags[:maxTargetTagButtons]
+	}
+
+	prefix, prompt := "bbuild_tgt_in_", "请选择标签，广播将只发送给带有该标签的用户："
+	if exclude {
+		prefix, prompt = "bbuild_tgt_ex_", "请选择标签，广播将发送给不带该标签的所有用户："
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, tag := range tags {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("#%s（%d 位用户）", tag, counts[tag]), prefix+tag),
+		))
+	}
+	msg := tgbotapi.NewMessage(chatID, prompt)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	m.API.Send(msg)
+}
+
+// handleTargetCallback 处理接收对象选择相关的按钮
+func (m *Manager) handleTargetCallback(q *tgbotapi.CallbackQuery) {
+	chatID := q.Message.Chat.ID
+	action := strings.TrimPrefix(q.Data, "bbuild_tgt_")
+
+	var target string
+	switch {
+	case action == "with":
+		m.sendTargetTagList(chatID, false)
+		return
+	case action == "without":
+		m.sendTargetTagList(chatID, true)
+		return
+	case action == "all":
+		target = AudienceAll
+	case strings.HasPrefix(action, "in_"):
+		target = AudienceTagPrefix + strings.TrimPrefix(action, "in_")
+	case strings.HasPrefix(action, "ex_"):
+		target = AudienceWithoutTagPrefix + strings.TrimPrefix(action, "ex_")
+	case strings.HasPrefix(action, "act_"):
+		target = AudienceActivePrefix + strings.TrimPrefix(action, "act_")
+	case strings.HasPrefix(action, "inact_"):
+		target = AudienceInactivePrefix + strings.TrimPrefix(action, "inact_")
+	default:
+		return
+	}
+
+	currentBroadcast := m.Broadcasts[chatID]
+	currentBroadcast.Target = target
+	m.Broadcasts[chatID] = currentBroadcast
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+	m.sendBroadcastBuilderMenu(chatID)
+	log.Printf("广播接收对象设置为 %s，chatID: %d", targetLabel(target), chatID)
+}
@@ -0,0 +1,136 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"my-tg-bot/internal/keyboard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTemplateNameBytes 限制模板名称长度，保证 "btpl_use_<名称>" 不超过 Telegram 64 字节的回调数据上限
+const maxTemplateNameBytes = 48
+
+// promptTemplateName asks the admin to name the button set of the current draft.
+func (m *Manager) promptTemplateName(chatID int64) {
+	if len(m.Broadcasts[chatID].Buttons.InlineKeyboard) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "当前广播没有设置按钮，无法保存为模板。")
+		m.API.Send(msg)
+		return
+	}
+	m.AdminStates[chatID] = StateBroadcastAwaitTemplateName
+	msg := tgbotapi.NewMessage(chatID, "请输入按钮模板的名称（同名模板将被覆盖）：")
+	msg.ReplyMarkup = m.getCancelKeyboard()
+	_, err := m.API.Send(msg)
+	if err != nil {
+		log.Printf("发送模板名称提示失败，chatID %d: %v", chatID, err)
+	}
+	log.Printf("设置状态为 StateBroadcastAwaitTemplateName，chatID: %d", chatID)
+}
+
+// handleTemplateNameInput saves the current draft's buttons under the given name.
+func (m *Manager) handleTemplateNameInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	name := strings.TrimSpace(msg.Text)
+	if name == "" || len(name) > maxTemplateNameBytes {
+		errMsg := tgbotapi.NewMessage(chatID, "模板名称不能为空且不能过长，请重新输入：")
+		errMsg.ReplyMarkup = m.getCancelKeyboard()
+		m.API.Send(errMsg)
+		return
+	}
+
+	ctx := context.Background()
+	markup := m.Broadcasts[chatID].Buttons
+	buttons := keyboard.Format(markup, m.callbackReplies(ctx, markup))
+	err := m.RedisClient.SaveButtonTemplate(ctx, name, buttons)
+	if err != nil {
+		log.Printf("保存按钮模板失败，chatID %d: %v", chatID, err)
+		errMsg := tgbotapi.NewMessage(chatID, "❌ 保存按钮模板失败，请稍后再试。")
+		m.API.Send(errMsg)
+		return
+	}
+
+	m.AdminStates[chatID] = 0 // StateNone
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, msg.MessageID))
+	reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 按钮模板「%s」已保存。", name))
+	m.API.Send(reply)
+	m.sendBroadcastBuilderMenu(chatID)
+	log.Printf("按钮模板 %s 已保存，chatID: %d", name, chatID)
+}
+
+// sendTemplateList lists saved button templates with buttons to apply or delete each one.
+func (m *Manager) sendTemplateList(chatID int64) {
+	templates, err := m.RedisClient.GetButtonTemplates(context.Background())
+	if err != nil {
+		log.Printf("获取按钮模板失败，chatID %d: %v", chatID, err)
+		errMsg := tgbotapi.NewMessage(chatID, "❌ 获取按钮模板失败。")
+		m.API.Send(errMsg)
+		return
+	}
+	if len(templates) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "还没有保存任何按钮模板。设置按钮后可在构建菜单中点击「💾 保存为模板」。")
+		m.API.Send(msg)
+		return
+	}
+
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, name := range names {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📁 "+name, "btpl_use_"+name),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 删除", "btpl_del_"+name),
+		))
+	}
+	msg := tgbotapi.NewMessage(chatID, "请选择要使用的按钮模板：")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	m.API.Send(msg)
+}
+
+// handleTemplateCallback applies or deletes a saved button template.
+func (m *Manager) handleTemplateCallback(q *tgbotapi.CallbackQuery) {
+	ctx := context.Background()
+	chatID := q.Message.Chat.ID
+
+	switch {
+	case strings.HasPrefix(q.Data, "btpl_use_"):
+		name := strings.TrimPrefix(q.Data, "btpl_use_")
+		buttons, err := m.RedisClient.GetButtonTemplate(ctx, name)
+		if err != nil || buttons == "" {
+			log.Printf("读取按钮模板 %s 失败，chatID %d: %v", name, chatID, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 模板不存在或已被删除"))
+			return
+		}
+		if !m.saveCallbackReplies(chatID, keyboard.CallbackReplies(buttons)) {
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 保存回调按钮失败，请稍后重试"))
+			return
+		}
+		currentBroadcast := m.Broadcasts[chatID]
+		currentBroadcast.Buttons = keyboard.Parse(buttons)
+		m.Broadcasts[chatID] = currentBroadcast
+		m.AdminStates[chatID] = 0 // StateNone
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已应用按钮模板"))
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		m.sendBroadcastBuilderMenu(chatID)
+		log.Printf("应用按钮模板 %s，chatID: %d", name, chatID)
+	case strings.HasPrefix(q.Data, "btpl_del_"):
+		name := strings.TrimPrefix(q.Data, "btpl_del_")
+		if err := m.RedisClient.DeleteButtonTemplate(ctx, name); err != nil {
+			log.Printf("删除按钮模板 %s 失败，chatID %d: %v", name, chatID, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 删除失败"))
+			return
+		}
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 模板已删除"))
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		m.sendTemplateList(chatID)
+		log.Printf("删除按钮模板 %s，chatID: %d", name, chatID)
+	}
+}
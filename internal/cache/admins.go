@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+)
+
+// AdminsSet 通过 /addadmin 添加的管理员，启动时与 ADMIN_IDS 合并
+const AdminsSet = "bot_admins"
+
+// AddAdmin 添加管理员，返回是否为新增
+func (rc *RedisClient) AddAdmin(ctx context.Context, userID int64) (bool, error) {
+	n, err := rc.rdb.SAdd(ctx, AdminsSet, strconv.FormatInt(userID, 10)).Result()
+	return n > 0, err
+}
+
+// RemoveAdmin 移除管理员，返回是否确实移除
+func (rc *RedisClient) RemoveAdmin(ctx context.Context, userID int64) (bool, error) {
+	n, err := rc.rdb.SRem(ctx, AdminsSet, strconv.FormatInt(userID, 10)).Result()
+	return n > 0, err
+}
+
+// GetAdminIDs 获取所有通过命令添加的管理员 ID
+func (rc *RedisClient) GetAdminIDs(ctx context.Context) ([]int64, error) {
+	members, err := rc.rdb.SMembers(ctx, AdminsSet).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		if id, err := strconv.ParseInt(member, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// 管理员角色
+const (
+	RoleSuperAdmin = "superadmin" // 可以使用所有命令并管理管理员
+	RoleOperator   = "operator"   // 只能回复用户及使用日常客服命令
+)
+
+// AdminRolesKey 管理员角色 Hash：字段为用户 ID，值为角色。ADMIN_IDS 中的管理员始终为超级管理员，不在此记录
+const AdminRolesKey = "bot_admin_roles"
+
+// SetAdminRole 设置管理员角色
+func (rc *RedisClient) SetAdminRole(ctx context.Context, userID int64, role string) error {
+	return rc.rdb.HSet(ctx, AdminRolesKey, strconv.FormatInt(userID, 10), role).Err()
+}
+
+// DeleteAdminRole 删除管理员角色记录
+func (rc *RedisClient) DeleteAdminRole(ctx context.Context, userID int64) error {
+	return rc.rdb.HDel(ctx, AdminRolesKey, strconv.FormatInt(userID, 10)).Err()
+}
+
+// GetAdminRoles 获取所有管理员角色
+func (rc *RedisClient) GetAdminRoles(ctx context.Context) (map[int64]string, error) {
+	vals, err := rc.rdb.HGetAll(ctx, AdminRolesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[int64]string, len(vals))
+	for idStr, role := range vals {
+		if id, err := strconv.ParseInt(idStr, 10, 64); err == nil {
+			roles[id] = role
+		}
+	}
+	return roles, nil
+}
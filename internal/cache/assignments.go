@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	AssignmentsKey            = "assignments"           // Hash：用户 ID -> 认领该用户的客服 ID
+	AssigneeNamesKey          = "assignee_names"        // Hash：客服 ID -> 认领时的显示名称
+	operatorAssignmentsPrefix = "operator_assignments:" // Set：某位客服认领的用户 ID，后接客服 ID
+)
+
+// operatorAssignmentsKey 是某位客服认领的用户集合
+func operatorAssignmentsKey(adminID int64) string {
+	return fmt.Sprintf("%s%d", operatorAssignmentsPrefix, adminID)
+}
+
+// assignmentRetries 认领状态在读取和写入之间被他人修改时的重试次数
+const assignmentRetries = 5
+
+// 认领脚本中的键都通过 KEYS 传入：KEYS[1] 为 AssignmentsKey，KEYS[2] 为调用前读到的原客服的集合，
+// KEYS[3] 为新客服的集合。用户当前的客服与调用前读到的不一致时返回 -1，由调用方重新读取后重试
+
+// claimUser 将用户分配给新的客服，并从原客服的集合中移除，返回原客服 ID（没有时为 0）
+var claimUser = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+if previous ~= ARGV[3] then
+	return -1
+end
+if previous ~= '' then
+	redis.call('SREM', KEYS[2], ARGV[1])
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('SADD', KEYS[3], ARGV[1])
+return tonumber(previous) or 0`)
+
+// releaseUser 取消用户的分配，返回原客服 ID（没有时为 0）
+var releaseUser = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+if previous ~= ARGV[2] then
+	return -1
+end
+if previous == '' then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+return tonumber(previous)`)
+
+// assigneeID 返回当前认领用户的客服 ID，未被认领时为 0
+func (rc *RedisClient) assigneeID(ctx context.Context, userID int64) (int64, error) {
+	val, err := rc.rdb.HGet(ctx, AssignmentsKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
+
+// assigneeArg 将客服 ID 转换为脚本参数，0 表示未被认领
+func assigneeArg(adminID int64) string {
+	if adminID == 0 {
+		return ""
+	}
+	return strconv.FormatInt(adminID, 10)
+}
+
+// ClaimUser 由客服认领用户，已被他人认领时改为由该客服处理，返回原来认领的客服 ID（没有时为 0）
+func (rc *RedisClient) ClaimUser(ctx context.Context, userID, adminID int64, adminName string) (int64, error) {
+	if err := rc.rdb.HSet(ctx, AssigneeNamesKey, adminID, adminName).Err(); err != nil {
+		return 0, err
+	}
+	for i := 0; i < assignmentRetries; i++ {
+		previous, err := rc.assigneeID(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		keys := []string{AssignmentsKey, operatorAssignmentsKey(previous), operatorAssignmentsKey(adminID)}
+		n, err := claimUser.Run(ctx, rc.rdb, keys, userID, adminID, assigneeArg(previous)).Int64()
+		if err != nil || n != -1 {
+			return n, err
+		}
+	}
+	return 0, fmt.Errorf("用户 %d 的认领状态正在被修改，请稍后再试", userID)
+}
+
+// ReleaseUser 取消用户的认领，返回原来认领的客服 ID（没有时为 0）
+func (rc *RedisClient) ReleaseUser(ctx context.Context, userID int64) (int64, error) {
+	for i := 0; i < assignmentRetries; i++ {
+		previous, err := rc.assigneeID(ctx, userID)
+		if err != nil || previous == 0 {
+			return 0, err
+		}
+		keys := []string{AssignmentsKey, operatorAssignmentsKey(previous)}
+		n, err := releaseUser.Run(ctx, rc.rdb, keys, userID, assigneeArg(previous)).Int64()
+		if err != nil || n != -1 {
+			return n, err
+		}
+	}
+	return 0, fmt.Errorf("用户 %d 的认领状态正在被修改，请稍后再试", userID)
+}
+
+// GetAssignee 返回认领该用户的客服 ID 和显示名称，未被认领时 adminID 为 0
+func (rc *RedisClient) GetAssignee(ctx context.Context, userID int64) (adminID int64, name string, err error) {
+	val, err := rc.rdb.HGet(ctx, AssignmentsKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	adminID, err = strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	name, err = rc.rdb.HGet(ctx, AssigneeNamesKey, val).Result()
+	if err == redis.Nil {
+		return adminID, val, nil
+	}
+	return adminID, name, err
+}
+
+// GetOperatorAssignments 返回客服认领的所有用户 ID
+func (rc *RedisClient) GetOperatorAssignments(ctx context.Context, adminID int64) ([]string, error) {
+	return rc.rdb.SMembers(ctx, operatorAssignmentsKey(adminID)).Result()
+}
+
+// transferUser 仅在用户当前由 ARGV[2] 认领时将其转给 ARGV[3]，返回是否转接成功。
+// KEYS[2]、KEYS[3] 分别为原客服和新客服的集合
+var transferUser = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('SREM', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('SADD', KEYS[3], ARGV[1])
+return 1`)
+
+// TransferUser 将 fromID 认领的用户转给 toID，用户已不由 fromID 认领时返回 false
+func (rc *RedisClient) TransferUser(ctx context.Context, userID, fromID, toID int64, toName string) (bool, error) {
+	if err := rc.rdb.HSet(ctx, AssigneeNamesKey, toID, toName).Err(); err != nil {
+		return false, err
+	}
+	keys := []string{AssignmentsKey, operatorAssignmentsKey(fromID), operatorAssignmentsKey(toID)}
+	n, err := transferUser.Run(ctx, rc.rdb, keys, userID, fromID, toID).Int64()
+	return n == 1, err
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	AuditLogKey    = "audit_log" // Stream：管理员操作记录
+	auditLogMaxLen = 10000       // 审计日志保留的大致条数
+)
+
+// 审计日志的操作类型
+const (
+	AuditBlock     = "block"     // 拉黑用户
+	AuditUnblock   = "unblock"   // 解除拉黑
+	AuditBroadcast = "broadcast" // 发送广播
+	AuditWelcome   = "welcome"   // 修改欢迎语
+	AuditNote      = "note"      // 添加或清除备注
+	AuditAdmin     = "admin"     // 添加或移除管理员
+	AuditTag       = "tag"       // 修改用户标签
+	AuditSettings  = "settings"  // 修改营业时间、离开模式等设置
+	AuditImport    = "import"    // 导入用户或恢复备份
+	AuditPurge     = "purge"     // 清理不活跃用户
+	AuditAssign    = "assign"    // 认领用户
+	AuditApprove   = "approve"   // 放行被隔离的消息
+	AuditOrder     = "order"     // 创建或修改订单
+)
+
+// AuditEntry 是审计日志中的一条记录
+type AuditEntry struct {
+	ID      string // Stream 条目 ID，用于翻页
+	At      time.Time
+	ActorID int64
+	Action  string
+	Details string
+}
+
+// AddAuditEntry 记录一次管理员操作，日志只保留最近约 auditLogMaxLen 条
+func (rc *RedisClient) AddAuditEntry(ctx context.Context, actorID int64, action, details string) error {
+	return rc.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: AuditLogKey,
+		MaxLen: auditLogMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"actor":   actorID,
+			"action":  action,
+			"details": details,
+		},
+	}).Err()
+}
+
+// GetAuditEntries 按时间从新到旧返回最多 count 条审计记录；before 非空时只返回 ID 早于 before 的记录
+func (rc *RedisClient) GetAuditEntries(ctx context.Context, before string, count int64) ([]AuditEntry, error) {
+	end := "+"
+	if before != "" {
+		// 旧版 Redis 不支持 "(" 排他区间，手动计算前一个 ID
+		prev, ok := previousStreamID(before)
+		if !ok {
+			return nil, nil
+		}
+		end = prev
+	}
+	messages, err := rc.rdb.XRevRangeN(ctx, AuditLogKey, end, "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(messages))
+	for _, msg := range messages {
+		entry := AuditEntry{ID: msg.ID}
+		if ms, _, ok := parseStreamID(msg.ID); ok {
+			entry.At = time.UnixMilli(ms)
+		}
+		if actor, ok := msg.Values["actor"].(string); ok {
+			entry.ActorID, _ = strconv.ParseInt(actor, 10, 64)
+		}
+		entry.Action, _ = msg.Values["action"].(string)
+		entry.Details, _ = msg.Values["details"].(string)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseStreamID 解析形如 <毫秒>-<序号> 的 Stream ID
+func parseStreamID(id string) (ms, seq int64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseInt(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// previousStreamID 返回紧邻 id 之前的 Stream ID，id 已是最小 ID 或格式无效时 ok 为 false
+func previousStreamID(id string) (string, bool) {
+	ms, seq, ok := parseStreamID(id)
+	if !ok || ms < 0 || seq < 0 {
+		return "", false
+	}
+	if seq > 0 {
+		return fmt.Sprintf("%d-%d", ms, seq-1), true
+	}
+	if ms == 0 {
+		return "", false
+	}
+	// 只给出毫秒时，作为区间终点的序号默认取最大值，即前一毫秒的最后一条
+	return strconv.FormatInt(ms-1, 10), true
+}
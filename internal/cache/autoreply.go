@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+)
+
+const (
+	AutoReplyRulesKey = "autoreply_rules" // 自动回复规则 Hash：字段为规则 ID，值为规则内容（JSON）
+	autoReplySeq      = "autoreply_seq"   // 自动回复规则 ID 自增计数器
+)
+
+// AddAutoReplyRule 保存一条自动回复规则，返回新规则的 ID
+func (rc *RedisClient) AddAutoReplyRule(ctx context.Context, payload string) (string, error) {
+	seq, err := rc.rdb.Incr(ctx, autoReplySeq).Result()
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(seq, 10)
+	return id, rc.rdb.HSet(ctx, AutoReplyRulesKey, id, payload).Err()
+}
+
+// GetAutoReplyRules 获取所有自动回复规则
+func (rc *RedisClient) GetAutoReplyRules(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, AutoReplyRulesKey).Result()
+}
+
+// DeleteAutoReplyRule 删除指定的自动回复规则，返回规则是否存在
+func (rc *RedisClient) DeleteAutoReplyRule(ctx context.Context, id string) (bool, error) {
+	n, err := rc.rdb.HDel(ctx, AutoReplyRulesKey, id).Result()
+	return n > 0, err
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BackupVersion 是备份文件格式的版本
+const BackupVersion = 1
+
+// backupExcludedPrefixes 是不需要备份的缓存和临时键
+var backupExcludedPrefixes = []string{"flood:", "channel_member:", "daily_active:top:", UpdateOffsetKey}
+
+const (
+	backupScanCount  = 500  // 备份时每次 SCAN 的建议键数
+	restoreChunkSize = 1000 // 恢复集合、列表等时每条命令写入的元素数
+	backupTypeString = "string"
+	backupTypeHash   = "hash"
+	backupTypeSet    = "set"
+	backupTypeZSet   = "zset"
+	backupTypeList   = "list"
+	backupTypeStream = "stream"
+)
+
+// KeyDump 是备份文件中的一个 Redis 键
+type KeyDump struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	TTL   int64           `json:"ttl,omitempty"` // 剩余的过期时间（秒），0 表示不过期
+	Value json.RawMessage `json:"value"`
+}
+
+// StreamEntry 是 Stream 中的一条记录，恢复时保留原 ID
+type StreamEntry struct {
+	ID     string            `json:"id"`
+	Values map[string]string `json:"values"`
+}
+
+// ZMember 是有序集合中的一个成员
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+func backupExcluded(key string) bool {
+	for _, prefix := range backupExcludedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// EachBackupKey 使用 SCAN 遍历所有需要备份的键，逐个读取其类型、过期时间和值后调用 fn，fn 返回错误时停止
+func (rc *RedisClient) EachBackupKey(ctx context.Context, fn func(KeyDump) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := rc.rdb.Scan(ctx, cursor, "*", backupScanCount).Result()
+		if err != nil {
+			return err
+		}
+		dumps, err := rc.dumpKeys(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for _, dump := range dumps {
+			if err := fn(dump); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// dumpKeys 用两次管道读取一批键的类型、值和过期时间，跳过不需要备份、已过期或类型不受支持的键
+func (rc *RedisClient) dumpKeys(ctx context.Context, keys []string) ([]KeyDump, error) {
+	var wanted []string
+	for _, key := range keys {
+		if !backupExcluded(key) {
+			wanted = append(wanted, key)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
+	pipe := rc.rdb.Pipeline()
+	types := make([]*redis.StatusCmd, len(wanted))
+	for i, key := range wanted {
+		types[i] = pipe.Type(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		key, keyType string
+		value        redis.Cmder
+		ttl          *redis.DurationCmd
+	}
+	pipe = rc.rdb.Pipeline()
+	var reads []pending
+	for i, key := range wanted {
+		read := pending{key: key, keyType: types[i].Val()}
+		switch read.keyType {
+		case backupTypeString:
+			read.value = pipe.Get(ctx, key)
+		case backupTypeHash:
+			read.value = pipe.HGetAll(ctx, key)
+		case backupTypeSet:
+			read.value = pipe.SMembers(ctx, key)
+		case backupTypeList:
+			read.value = pipe.LRange(ctx, key, 0, -1)
+		case backupTypeZSet:
+			read.value = pipe.ZRangeWithScores(ctx, key, 0, -1)
+		case backupTypeStream:
+			read.value = pipe.XRange(ctx, key, "-", "+")
+		default:
+			// 键已过期（none）或是不使用的类型
+			continue
+		}
+		read.ttl = pipe.TTL(ctx, key)
+		reads = append(reads, read)
+	}
+	// 两次管道之间过期的字符串键会返回 redis.Nil，跳过即可
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	dumps := make([]KeyDump, 0, len(reads))
+	for _, read := range reads {
+		var value interface{}
+		switch cmd := read.value.(type) {
+		case *redis.StringCmd:
+			if cmd.Err() == redis.Nil {
+				continue
+			}
+			value = cmd.Val()
+		case *redis.MapStringStringCmd:
+			value = cmd.Val()
+		case *redis.StringSliceCmd:
+			value = cmd.Val()
+		case *redis.ZSliceCmd:
+			members := make([]ZMember, len(cmd.Val()))
+			for i, z := range cmd.Val() {
+				member, _ := z.Member.(string)
+				members[i] = ZMember{Member: member, Score: z.Score}
+			}
+			value = members
+		case *redis.XMessageSliceCmd:
+			entries := make([]StreamEntry, len(cmd.Val()))
+			for i, msg := range cmd.Val() {
+				values := make(map[string]string, len(msg.Values))
+				for field, v := range msg.Values {
+					values[field] = fmt.Sprint(v)
+				}
+				entries[i] = StreamEntry{ID: msg.ID, Values: values}
+			}
+			value = entries
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		dump := KeyDump{Key: read.key, Type: read.keyType, Value: raw}
+		if ttl := read.ttl.Val(); ttl > 0 {
+			dump.TTL = int64(ttl / time.Second)
+		}
+		dumps = append(dumps, dump)
+	}
+	return dumps, nil
+}
+
+// RestoreKey 用备份中的内容替换一个键
+func (rc *RedisClient) RestoreKey(ctx context.Context, dump KeyDump) error {
+	pipe := rc.rdb.TxPipeline()
+	pipe.Del(ctx, dump.Key)
+	switch dump.Type {
+	case backupTypeString:
+		var value string
+		if err := json.Unmarshal(dump.Value, &value); err != nil {
+			return err
+		}
+		pipe.Set(ctx, dump.Key, value, 0)
+	case backupTypeHash:
+		var value map[string]string
+		if err := json.Unmarshal(dump.Value, &value); err != nil {
+			return err
+		}
+		if len(value) > 0 {
+			pipe.HSet(ctx, dump.Key, value)
+		}
+	case backupTypeSet, backupTypeList:
+		var value []string
+		if err := json.Unmarshal(dump.Value, &value); err != nil {
+			return err
+		}
+		for start := 0; start < len(value); start += restoreChunkSize {
+			chunk := value[start:min(start+restoreChunkSize, len(value))]
+			members := make([]interface{}, len(chunk))
+			for i, member := range chunk {
+				members[i] = member
+			}
+			if dump.Type == backupTypeSet {
+				pipe.SAdd(ctx, dump.Key, members...)
+			} else {
+				pipe.RPush(ctx, dump.Key, members...)
+			}
+		}
+	case backupTypeZSet:
+		var value []ZMember
+		if err := json.Unmarshal(dump.Value, &value); err != nil {
+			return err
+		}
+		for start := 0; start < len(value); start += restoreChunkSize {
+			chunk := value[start:min(start+restoreChunkSize, len(value))]
+			members := make([]redis.Z, len(chunk))
+			for i, z := range chunk {
+				members[i] = redis.Z{Member: z.Member, Score: z.Score}
+			}
+			pipe.ZAdd(ctx, dump.Key, members...)
+		}
+	case backupTypeStream:
+		var value []StreamEntry
+		if err := json.Unmarshal(dump.Value, &value); err != nil {
+			return err
+		}
+		for _, entry := range value {
+			values := make(map[string]interface{}, len(entry.Values))
+			for field, v := range entry.Values {
+				values[field] = v
+			}
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: dump.Key, ID: entry.ID, Values: values})
+		}
+	default:
+		return fmt.Errorf("不支持的类型 %s", dump.Type)
+	}
+	if dump.TTL > 0 {
+		pipe.Expire(ctx, dump.Key, time.Duration(dump.TTL)*time.Second)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BannedWordsKey 违禁词集合，保存小写形式
+const BannedWordsKey = "banned_words"
+
+func banwordViolationsKey(userID int64) string {
+	return fmt.Sprintf("banword_violations:%d", userID)
+}
+
+// AddBannedWords 添加违禁词，返回新增的数量
+func (rc *RedisClient) AddBannedWords(ctx context.Context, words ...string) (int64, error) {
+	members := make([]interface{}, len(words))
+	for i, word := range words {
+		members[i] = word
+	}
+	return rc.rdb.SAdd(ctx, BannedWordsKey, members...).Result()
+}
+
+// RemoveBannedWords 移除违禁词，返回实际移除的数量
+func (rc *RedisClient) RemoveBannedWords(ctx context.Context, words ...string) (int64, error) {
+	members := make([]interface{}, len(words))
+	for i, word := range words {
+		members[i] = word
+	}
+	return rc.rdb.SRem(ctx, BannedWordsKey, members...).Result()
+}
+
+// GetBannedWords 获取所有违禁词
+func (rc *RedisClient) GetBannedWords(ctx context.Context) ([]string, error) {
+	return rc.rdb.SMembers(ctx, BannedWordsKey).Result()
+}
+
+// CountBanwordViolation 记录用户的一次违禁词违规，返回 window 内（从第一次违规起计算）的违规次数
+func (rc *RedisClient) CountBanwordViolation(ctx context.Context, userID int64, window time.Duration) (int64, error) {
+	key := banwordViolationsKey(userID)
+	count, err := rc.rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		err = rc.rdb.Expire(ctx, key, window).Err()
+	}
+	return count, err
+}
+
+// ResetBanwordViolations 清除用户的违规次数
+func (rc *RedisClient) ResetBanwordViolations(ctx context.Context, userID int64) error {
+	return rc.rdb.Del(ctx, banwordViolationsKey(userID)).Err()
+}
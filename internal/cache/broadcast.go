@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	BroadcastsInProgressKey = "broadcasts_in_progress"  // 正在发送中的广播 ID 集合
+	LastBroadcastKey        = "broadcast_last"          // 最近一次完成的全员广播（Hash：id、track_clicks）
+	ClickHistoryKey         = "broadcast_click_history" // 带有追踪按钮的广播 ID 列表，最新的在前
+	CallbackRepliesKey      = "callback_replies"        // Hash：回调按钮提示文字的短键 -> 提示文字
+	broadcastSeq            = "broadcast_seq"           // 广播 ID 自增计数器
+
+	// ClickHistoryLimit 点击统计列表保留的广播数量
+	ClickHistoryLimit = 20
+
+	// BroadcastTrackingTTL 广播完成后送达、互动记录的保留时间
+	BroadcastTrackingTTL = 30 * 24 * time.Hour
+)
+
+func broadcastJobKey(id string) string {
+	return fmt.Sprintf("bcast:%s:job", id)
+}
+
+func broadcastDoneKey(id string) string {
+	return fmt.Sprintf("bcast:%s:done", id)
+}
+
+func broadcastEngagedKey(id string) string {
+	return fmt.Sprintf("bcast:%s:engaged", id)
+}
+
+func broadcastLinksKey(id string) string {
+	return fmt.Sprintf("bcast:%s:links", id)
+}
+
+func broadcastClicksKey(id string) string {
+	return fmt.Sprintf("bcast:%s:clicks", id)
+}
+
+func broadcastButtonClickersKey(id, index string) string {
+	return fmt.Sprintf("bcast:%s:clicked:%s", id, index)
+}
+
+// NextBroadcastID 生成一个新的广播 ID，立即发送和定时发送的广播共用该序列
+func (rc *RedisClient) NextBroadcastID(ctx context.Context) (string, error) {
+	id, err := rc.rdb.Incr(ctx, broadcastSeq).Result()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// MarkBroadcastInProgress 保存广播任务内容并标记为 in_progress，以便重启后继续发送
+func (rc *RedisClient) MarkBroadcastInProgress(ctx context.Context, id, payload string) error {
+	err := rc.rdb.Set(ctx, broadcastJobKey(id), payload, 0).Err()
+	if err != nil {
+		return err
+	}
+	return rc.rdb.SAdd(ctx, BroadcastsInProgressKey, id).Err()
+}
+
+// GetInProgressBroadcastIDs 获取所有未完成的广播 ID
+func (rc *RedisClient) GetInProgressBroadcastIDs(ctx context.Context) ([]string, error) {
+	return rc.rdb.SMembers(ctx, BroadcastsInProgressKey).Result()
+}
+
+// GetBroadcastJob 获取广播任务内容，不存在时返回空字符串
+func (rc *RedisClient) GetBroadcastJob(ctx context.Context, id string) (string, error) {
+	val, err := rc.rdb.Get(ctx, broadcastJobKey(id)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// MarkBroadcastDelivered 记录某个用户已成功收到该广播
+func (rc *RedisClient) MarkBroadcastDelivered(ctx context.Context, id string, userID int64) error {
+	return rc.rdb.SAdd(ctx, broadcastDoneKey(id), strconv.FormatInt(userID, 10)).Err()
+}
+
+// IsBroadcastDelivered 检查某个用户是否已收到该广播
+func (rc *RedisClient) IsBroadcastDelivered(ctx context.Context, id string, userID int64) (bool, error) {
+	return rc.rdb.SIsMember(ctx, broadcastDoneKey(id), strconv.FormatInt(userID, 10)).Result()
+}
+
+// FinishBroadcast 广播发送完成后清理进度记录。送达集合保留 BroadcastTrackingTTL，
+// 用于之后筛选“未互动用户”
+func (rc *RedisClient) FinishBroadcast(ctx context.Context, id string) error {
+	err := rc.rdb.Del(ctx, broadcastJobKey(id)).Err()
+	if err != nil {
+		return err
+	}
+	err = rc.rdb.Expire(ctx, broadcastDoneKey(id), BroadcastTrackingTTL).Err()
+	if err != nil {
+		return err
+	}
+	return rc.rdb.SRem(ctx, BroadcastsInProgressKey, id).Err()
+}
+
+// SetLastBroadcast 记录最近一次完成的全员广播
+func (rc *RedisClient) SetLastBroadcast(ctx context.Context, id string, trackClicks bool) error {
+	return rc.rdb.HSet(ctx, LastBroadcastKey, "id", id, "track_clicks", strconv.FormatBool(trackClicks)).Err()
+}
+
+// GetLastBroadcast 获取最近一次完成的全员广播，不存在时 id 为空
+func (rc *RedisClient) GetLastBroadcast(ctx context.Context) (id string, trackClicks bool, err error) {
+	vals, err := rc.rdb.HMGet(ctx, LastBroadcastKey, "id", "track_clicks").Result()
+	if err != nil {
+		return "", false, err
+	}
+	if s, ok := vals[0].(string); ok {
+		id = s
+	}
+	if s, ok := vals[1].(string); ok {
+		trackClicks, _ = strconv.ParseBool(s)
+	}
+	return id, trackClicks, nil
+}
+
+// SaveBroadcastLinks 保存追踪按钮对应的原始链接（字段为按钮序号，值为“按钮文字 | 链接”）
+func (rc *RedisClient) SaveBroadcastLinks(ctx context.Context, id string, links map[string]string) error {
+	if len(links) == 0 {
+		return nil
+	}
+	err := rc.rdb.HSet(ctx, broadcastLinksKey(id), links).Err()
+	if err != nil {
+		return err
+	}
+	return rc.rdb.Expire(ctx, broadcastLinksKey(id), BroadcastTrackingTTL).Err()
+}
+
+// GetBroadcastLink 获取追踪按钮对应的原始链接，不存在时返回空字符串
+func (rc *RedisClient) GetBroadcastLink(ctx context.Context, id, index string) (string, error) {
+	val, err := rc.rdb.HGet(ctx, broadcastLinksKey(id), index).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// SaveCallbackReplies 保存回调按钮的提示文字（字段为短键）。草稿、模板和定时广播都可能引用，因此不设过期时间
+func (rc *RedisClient) SaveCallbackReplies(ctx context.Context, replies map[string]string) error {
+	if len(replies) == 0 {
+		return nil
+	}
+	return rc.rdb.HSet(ctx, CallbackRepliesKey, replies).Err()
+}
+
+// GetCallbackReplies 获取回调按钮短键对应的提示文字，不存在的短键不包含在结果中
+func (rc *RedisClient) GetCallbackReplies(ctx context.Context, keys []string) (map[string]string, error) {
+	replies := make(map[string]string)
+	if len(keys) == 0 {
+		return replies, nil
+	}
+	vals, err := rc.rdb.HMGet(ctx, CallbackRepliesKey, keys...).Result()
+	if err != nil {
+		return replies, err
+	}
+	for i, val := range vals {
+		if s, ok := val.(string); ok {
+			replies[keys[i]] = s
+		}
+	}
+	return replies, nil
+}
+
+// GetBroadcastLinks 获取广播所有追踪按钮（字段为按钮序号，值为“按钮文字 | 链接”）
+func (rc *RedisClient) GetBroadcastLinks(ctx context.Context, id string) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, broadcastLinksKey(id)).Result()
+}
+
+// RecordBroadcastClick 记录用户点击了广播中的某个按钮：累计按钮点击次数、记录点击过该按钮的用户，
+// 并将用户标记为已互动
+func (rc *RedisClient) RecordBroadcastClick(ctx context.Context, id, index string, userID int64) error {
+	member := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, broadcastClicksKey(id), index, 1)
+	pipe.SAdd(ctx, broadcastButtonClickersKey(id, index), member)
+	pipe.SAdd(ctx, broadcastEngagedKey(id), member)
+	pipe.Expire(ctx, broadcastClicksKey(id), BroadcastTrackingTTL)
+	pipe.Expire(ctx, broadcastButtonClickersKey(id, index), BroadcastTrackingTTL)
+	pipe.Expire(ctx, broadcastEngagedKey(id), BroadcastTrackingTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ButtonClickStats 是广播中单个追踪按钮的点击统计
+type ButtonClickStats struct {
+	Index  string
+	Label  string // “按钮文字 | 链接”
+	Clicks int64  // 总点击次数
+	Users  int64  // 点击过的用户数
+}
+
+// BroadcastClickStats 是一次广播的点击统计
+type BroadcastClickStats struct {
+	ID        string
+	Delivered int64 // 成功送达的用户数
+	Engaged   int64 // 点击过任意按钮的用户数
+	Buttons   []ButtonClickStats
+}
+
+// GetBroadcastClickStats 获取广播的送达人数以及每个追踪按钮的点击次数和点击人数，按按钮序号排序
+func (rc *RedisClient) GetBroadcastClickStats(ctx context.Context, id string) (BroadcastClickStats, error) {
+	stats := BroadcastClickStats{ID: id}
+	links, err := rc.GetBroadcastLinks(ctx, id)
+	if err != nil {
+		return stats, err
+	}
+	clicks, err := rc.rdb.HGetAll(ctx, broadcastClicksKey(id)).Result()
+	if err != nil {
+		return stats, err
+	}
+
+	pipe := rc.rdb.Pipeline()
+	delivered := pipe.SCard(ctx, broadcastDoneKey(id))
+	engaged := pipe.SCard(ctx, broadcastEngagedKey(id))
+	users := make(map[string]*redis.IntCmd, len(links))
+	for index := range links {
+		users[index] = pipe.SCard(ctx, broadcastButtonClickersKey(id, index))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return stats, err
+	}
+
+	stats.Delivered = delivered.Val()
+	stats.Engaged = engaged.Val()
+	for index, label := range links {
+		total, _ := strconv.ParseInt(clicks[index], 10, 64)
+		stats.Buttons = append(stats.Buttons, ButtonClickStats{Index: index, Label: label, Clicks: total, Users: users[index].Val()})
+	}
+	sort.Slice(stats.Buttons, func(i, j int) bool {
+		a, _ := strconv.Atoi(stats.Buttons[i].Index)
+		b, _ := strconv.Atoi(stats.Buttons[j].Index)
+		return a < b
+	})
+	return stats, nil
+}
+
+// AddClickHistory 将带有追踪按钮的广播加入点击统计列表，只保留最近 ClickHistoryLimit 条
+func (rc *RedisClient) AddClickHistory(ctx context.Context, id string) error {
+	pipe := rc.rdb.TxPipeline()
+	pipe.LRem(ctx, ClickHistoryKey, 0, id)
+	pipe.LPush(ctx, ClickHistoryKey, id)
+	pipe.LTrim(ctx, ClickHistoryKey, 0, ClickHistoryLimit-1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetClickHistory 获取点击统计列表中的广播 ID，最新的在前
+func (rc *RedisClient) GetClickHistory(ctx context.Context) ([]string, error) {
+	return rc.rdb.LRange(ctx, ClickHistoryKey, 0, -1).Result()
+}
+
+// GetUnengagedUserIDs 获取收到了广播但没有点击任何按钮的用户ID
+func (rc *RedisClient) GetUnengagedUserIDs(ctx context.Context, id string) ([]string, error) {
+	return rc.rdb.SDiff(ctx, broadcastDoneKey(id), broadcastEngagedKey(id)).Result()
+}
+
+// ButtonTemplatesKey 保存广播按钮模板的 Hash：字段为模板名称，值为按钮文本（每行“按钮文字 | 链接”）
+const ButtonTemplatesKey = "broadcast_button_templates"
+
+// SaveButtonTemplate 保存（或覆盖）一个按钮模板
+func (rc *RedisClient) SaveButtonTemplate(ctx context.Context, name, buttons string) error {
+	return rc.rdb.HSet(ctx, ButtonTemplatesKey, name, buttons).Err()
+}
+
+// GetButtonTemplates 获取所有按钮模板
+func (rc *RedisClient) GetButtonTemplates(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, ButtonTemplatesKey).Result()
+}
+
+// GetButtonTemplate 获取指定按钮模板，不存在时返回空字符串
+func (rc *RedisClient) GetButtonTemplate(ctx context.Context, name string) (string, error) {
+	val, err := rc.rdb.HGet(ctx, ButtonTemplatesKey, name).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// DeleteButtonTemplate 删除指定按钮模板
+func (rc *RedisClient) DeleteButtonTemplate(ctx context.Context, name string) error {
+	return rc.rdb.HDel(ctx, ButtonTemplatesKey, name).Err()
+}
+
+// TestUsersSet 广播测试组成员，用于正式发送前的小范围试发
+const TestUsersSet = "broadcast_test_users"
+
+// AddTestUser 将用户加入广播测试组
+func (rc *RedisClient) AddTestUser(ctx context.Context, userID int64) error {
+	return rc.rdb.SAdd(ctx, TestUsersSet, strconv.FormatInt(userID, 10)).Err()
+}
+
+// RemoveTestUsers 将指定用户移出广播测试组，未指定用户时清空测试组
+func (rc *RedisClient) RemoveTestUsers(ctx context.Context, userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return rc.rdb.Del(ctx, TestUsersSet).Err()
+	}
+	members := make([]interface{}, 0, len(userIDs))
+	for _, id := range userIDs {
+		members = append(members, strconv.FormatInt(id, 10))
+	}
+	return rc.rdb.SRem(ctx, TestUsersSet, members...).Err()
+}
+
+// GetTestUserIDs 获取广播测试组的所有用户ID
+func (rc *RedisClient) GetTestUserIDs(ctx context.Context) ([]string, error) {
+	return rc.rdb.SMembers(ctx, TestUsersSet).Result()
+}
+
+// CountBroadcastReachable 统计 userIDs 中未退订广播且未屏蔽机器人的用户数
+func (rc *RedisClient) CountBroadcastReachable(ctx context.Context, userIDs []string) (int, error) {
+	pipe := rc.rdb.Pipeline()
+	optedOut := make([]*redis.BoolCmd, len(userIDs))
+	unreachable := make([]*redis.BoolCmd, len(userIDs))
+	for i, id := range userIDs {
+		optedOut[i] = pipe.SIsMember(ctx, OptOutUsersSet, id)
+		unreachable[i] = pipe.SIsMember(ctx, UnreachableUsersSet, id)
+	}
+	if len(userIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+	}
+	count := 0
+	for i := range userIDs {
+		if !optedOut[i].Val() && !unreachable[i].Val() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// BroadcastTemplatesKey 保存完整广播模板的 Hash：字段为模板名称，值为广播内容的 JSON（文本、媒体文件 ID、按钮等）
+const BroadcastTemplatesKey = "broadcast_templates"
+
+// SaveBroadcastTemplate 保存（或覆盖）一个广播模板
+func (rc *RedisClient) SaveBroadcastTemplate(ctx context.Context, name, payload string) error {
+	return rc.rdb.HSet(ctx, BroadcastTemplatesKey, name, payload).Err()
+}
+
+// GetBroadcastTemplateNames 获取所有广播模板的名称
+func (rc *RedisClient) GetBroadcastTemplateNames(ctx context.Context) ([]string, error) {
+	return rc.rdb.HKeys(ctx, BroadcastTemplatesKey).Result()
+}
+
+// GetBroadcastTemplate 获取指定广播模板，不存在时返回空字符串
+func (rc *RedisClient) GetBroadcastTemplate(ctx context.Context, name string) (string, error) {
+	val, err := rc.rdb.HGet(ctx, BroadcastTemplatesKey, name).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// DeleteBroadcastTemplate 删除指定广播模板
+func (rc *RedisClient) DeleteBroadcastTemplate(ctx context.Context, name string) error {
+	return rc.rdb.HDel(ctx, BroadcastTemplatesKey, name).Err()
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DigestTargetKey = "digest_target" // Hash：用户 ID -> 等待汇总转发的一批消息的转发目标
+	DigestDueKey    = "digest_due"    // ZSet：有消息等待汇总转发的用户，分数为转发时间（Unix 秒）
+)
+
+func digestMessagesKey(userID int64) string {
+	return fmt.Sprintf("digest:%d", userID)
+}
+
+// AddDigestMessage 将用户的一条消息（JSON）加入等待汇总转发的一批，返回 true 表示这是一批的第一条；
+// 第一条消息决定这一批的转发目标和转发时间 due
+func (rc *RedisClient) AddDigestMessage(ctx context.Context, userID, target int64, payload string, due time.Time) (bool, error) {
+	user := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	n := pipe.RPush(ctx, digestMessagesKey(userID), payload)
+	pipe.HSetNX(ctx, DigestTargetKey, user, target)
+	pipe.ZAddNX(ctx, DigestDueKey, redis.Z{Score: float64(due.Unix()), Member: user})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return n.Val() == 1, nil
+}
+
+// GetDueDigests 获取已到转发时间的用户
+func (rc *RedisClient) GetDueDigests(ctx context.Context, now time.Time) ([]int64, error) {
+	users, err := rc.rdb.ZRangeByScore(ctx, DigestDueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		if id, err := strconv.ParseInt(user, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// GetDigest 读取用户已到转发时间的一批消息和转发目标，不删除；尚未到时间或没有消息时 payloads 为空
+func (rc *RedisClient) GetDigest(ctx context.Context, userID int64, now time.Time) (int64, []string, error) {
+	user := strconv.FormatInt(userID, 10)
+	due, err := rc.rdb.ZScore(ctx, DigestDueKey, user).Result()
+	if err == redis.Nil || (err == nil && int64(due) > now.Unix()) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	pipe := rc.rdb.Pipeline()
+	target := pipe.HGet(ctx, DigestTargetKey, user)
+	payloads := pipe.LRange(ctx, digestMessagesKey(userID), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, nil, err
+	}
+	targetID, _ := strconv.ParseInt(target.Val(), 10, 64)
+	return targetID, payloads.Val(), nil
+}
+
+// ClearDigest 在一批消息转发后删除其中的前 n 条，并清除这一批的转发目标和转发时间
+func (rc *RedisClient) ClearDigest(ctx context.Context, userID int64, n int) error {
+	user := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	pipe.LTrim(ctx, digestMessagesKey(userID), int64(n), -1)
+	pipe.HDel(ctx, DigestTargetKey, user)
+	pipe.ZRem(ctx, DigestDueKey, user)
+	_, err := pipe.Exec(ctx)
+	return err
+}
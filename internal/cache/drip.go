@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DripStepsKey    = "drip_steps"    // 跟进消息 Hash：字段为步骤 ID，值为步骤内容（JSON）
+	dripStepSeq     = "drip_step_seq" // 跟进消息步骤 ID 自增计数器
+	DripStartedKey  = "drip_started"  // Hash：用户 ID -> 首次 /start 的时间（Unix 秒），已记录的用户不会重新开始
+	DripProgressKey = "drip_progress" // Hash：用户 ID -> 最近一次已发送步骤的延迟（秒）
+	DripDueKey      = "drip_due"      // ZSet：等待发送下一条跟进消息的用户，分数为发送时间（Unix 秒）
+)
+
+// AddDripStep 保存一条跟进消息步骤，返回新步骤的 ID
+func (rc *RedisClient) AddDripStep(ctx context.Context, payload string) (string, error) {
+	seq, err := rc.rdb.Incr(ctx, dripStepSeq).Result()
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(seq, 10)
+	return id, rc.rdb.HSet(ctx, DripStepsKey, id, payload).Err()
+}
+
+// GetDripSteps 获取所有跟进消息步骤
+func (rc *RedisClient) GetDripSteps(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, DripStepsKey).Result()
+}
+
+// DeleteDripStep 删除跟进消息步骤，返回步骤是否存在
+func (rc *RedisClient) DeleteDripStep(ctx context.Context, id string) (bool, error) {
+	n, err := rc.rdb.HDel(ctx, DripStepsKey, id).Result()
+	return n > 0, err
+}
+
+// StartDrip 记录用户首次 /start 的时间并安排第一条跟进消息在 due 发送，用户已开始过时返回 false 且不做任何事
+func (rc *RedisClient) StartDrip(ctx context.Context, userID int64, at, due time.Time) (bool, error) {
+	user := strconv.FormatInt(userID, 10)
+	started, err := rc.rdb.HSetNX(ctx, DripStartedKey, user, at.Unix()).Result()
+	if err != nil || !started {
+		return false, err
+	}
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, DripProgressKey, user, -1)
+	pipe.ZAdd(ctx, DripDueKey, redis.Z{Score: float64(due.Unix()), Member: user})
+	_, err = pipe.Exec(ctx)
+	return true, err
+}
+
+// DripProgress 是一位用户的跟进进度
+type DripProgress struct {
+	UserID    int64
+	StartedAt time.Time
+	LastDelay int64 // 最近一次已发送步骤的延迟（秒），尚未发送时为 -1
+}
+
+// GetDueDrips 获取下一条跟进消息已到发送时间的用户
+func (rc *RedisClient) GetDueDrips(ctx context.Context, now time.Time) ([]DripProgress, error) {
+	users, err := rc.rdb.ZRangeByScore(ctx, DripDueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	pipe := rc.rdb.Pipeline()
+	started := pipe.HMGet(ctx, DripStartedKey, users...)
+	progress := pipe.HMGet(ctx, DripProgressKey, users...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	due := make([]DripProgress, 0, len(users))
+	for i, user := range users {
+		item := DripProgress{LastDelay: -1}
+		item.UserID, _ = strconv.ParseInt(user, 10, 64)
+		if s, ok := started.Val()[i].(string); ok {
+			unix, _ := strconv.ParseInt(s, 10, 64)
+			item.StartedAt = time.Unix(unix, 0)
+		}
+		if s, ok := progress.Val()[i].(string); ok {
+			item.LastDelay, _ = strconv.ParseInt(s, 10, 64)
+		}
+		due = append(due, item)
+	}
+	return due, nil
+}
+
+// AdvanceDrip 记录用户已收到延迟为 delay 的步骤，next 为零值时表示没有后续步骤，停止跟进
+func (rc *RedisClient) AdvanceDrip(ctx context.Context, userID int64, delay int64, next time.Time) error {
+	user := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, DripProgressKey, user, delay)
+	if next.IsZero() {
+		pipe.ZRem(ctx, DripDueKey, user)
+	} else {
+		pipe.ZAdd(ctx, DripDueKey, redis.Z{Score: float64(next.Unix()), Member: user})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// StopDrip 停止向用户发送后续的跟进消息，返回用户此前是否在跟进中
+func (rc *RedisClient) StopDrip(ctx context.Context, userID int64) (bool, error) {
+	n, err := rc.rdb.ZRem(ctx, DripDueKey, strconv.FormatInt(userID, 10)).Result()
+	return n > 0, err
+}
+
+// CountActiveDrips 返回正在跟进中的用户数
+func (rc *RedisClient) CountActiveDrips(ctx context.Context) (int64, error) {
+	return rc.rdb.ZCard(ctx, DripDueKey).Result()
+}
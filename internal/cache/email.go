@@ -0,0 +1,15 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// unansweredEmailRetention 未回复邮件发送记录的保留时间
+const unansweredEmailRetention = 7 * 24 * time.Hour
+
+// MarkUnansweredEmailed 记录已为用户从 since 开始的等待发送过未回复邮件，返回 false 表示此前已经发送过
+func (rc *RedisClient) MarkUnansweredEmailed(ctx context.Context, userID int64, since time.Time) (bool, error) {
+	return rc.rdb.SetNX(ctx, fmt.Sprintf("unanswered_emailed:%d:%d", userID, since.Unix()), 1, unansweredEmailRetention).Result()
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func floodCounterKey(userID int64, window time.Time) string {
+	return fmt.Sprintf("flood:%d:%d", userID, window.Unix())
+}
+
+func muteKey(userID int64) string {
+	return fmt.Sprintf("muted:%d", userID)
+}
+
+// CountUserMessage 在以 window 为长度的固定时间窗内为用户消息计数，返回当前窗口内的消息数
+func (rc *RedisClient) CountUserMessage(ctx context.Context, userID int64, window time.Duration) (int64, error) {
+	key := floodCounterKey(userID, time.Now().Truncate(window))
+	pipe := rc.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// MuteUser 临时禁言用户，到期后自动解除
+func (rc *RedisClient) MuteUser(ctx context.Context, userID int64, d time.Duration) error {
+	return rc.rdb.Set(ctx, muteKey(userID), "1", d).Err()
+}
+
+// UserMuteRemaining 返回用户剩余的禁言时间，未被禁言时返回 0
+func (rc *RedisClient) UserMuteRemaining(ctx context.Context, userID int64) (time.Duration, error) {
+	ttl, err := rc.rdb.PTTL(ctx, muteKey(userID)).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
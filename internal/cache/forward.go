@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ForwardMappingTTL 转发消息映射的保留时间，过期后由 Redis 自动清理，管理员无法再通过回复该消息联系用户
+const ForwardMappingTTL = 30 * 24 * time.Hour
+
+// ForwardMapping 记录管理员会话中的一条转发消息来自哪位用户
+type ForwardMapping struct {
+	UserID    int64 // 原始用户 ID
+	ChatID    int64 // 用户与机器人的会话 ID，回复发送到这里
+	MessageID int   // 用户原始消息 ID
+	HeaderID  int   // 同一次转发中带用户信息的标题消息 ID，没有标题时为 0
+}
+
+func forwardMappingKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("fwd:%d:%d", chatID, messageID)
+}
+
+// SaveForwardMapping 记录转发到管理员会话（adminChatID）中的消息 adminMessageID 对应的原始用户
+func (rc *RedisClient) SaveForwardMapping(ctx context.Context, adminChatID int64, adminMessageID int, mapping ForwardMapping) error {
+	key := forwardMappingKey(adminChatID, adminMessageID)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, key,
+		"user_id", strconv.FormatInt(mapping.UserID, 10),
+		"chat_id", strconv.FormatInt(mapping.ChatID, 10),
+		"message_id", strconv.Itoa(mapping.MessageID),
+		"header_id", strconv.Itoa(mapping.HeaderID),
+	)
+	pipe.Expire(ctx, key, ForwardMappingTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetForwardMapping 查询转发消息对应的原始用户，映射不存在或已过期时 ok 为 false
+func (rc *RedisClient) GetForwardMapping(ctx context.Context, adminChatID int64, adminMessageID int) (mapping ForwardMapping, ok bool, err error) {
+	vals, err := rc.rdb.HGetAll(ctx, forwardMappingKey(adminChatID, adminMessageID)).Result()
+	if err != nil || len(vals) == 0 {
+		return mapping, false, err
+	}
+	mapping.UserID, _ = strconv.ParseInt(vals["user_id"], 10, 64)
+	mapping.ChatID, _ = strconv.ParseInt(vals["chat_id"], 10, 64)
+	mapping.MessageID, _ = strconv.Atoi(vals["message_id"])
+	mapping.HeaderID, _ = strconv.Atoi(vals["header_id"])
+	if mapping.ChatID == 0 {
+		mapping.ChatID = mapping.UserID
+	}
+	return mapping, mapping.UserID != 0, nil
+}
+
+func forwardHeaderKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("fwd_header:%d:%d", chatID, messageID)
+}
+
+// SaveForwardHeader 保存转发标题消息最初发送的文本（MarkdownV2），编辑标题时以此为基础
+func (rc *RedisClient) SaveForwardHeader(ctx context.Context, chatID int64, messageID int, text string) error {
+	return rc.rdb.Set(ctx, forwardHeaderKey(chatID, messageID), text, ForwardMappingTTL).Err()
+}
+
+// GetForwardHeader 获取转发标题消息最初发送的文本，不存在或已过期时返回空字符串
+func (rc *RedisClient) GetForwardHeader(ctx context.Context, chatID int64, messageID int) (string, error) {
+	text, err := rc.rdb.Get(ctx, forwardHeaderKey(chatID, messageID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return text, err
+}
+
+func forwardReceiptKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("fwd_receipt:%d:%d", chatID, messageID)
+}
+
+// SaveForwardReceipt 保存转发标题末尾最近一次的已回复标记，之后编辑标题时保留该标记
+func (rc *RedisClient) SaveForwardReceipt(ctx context.Context, chatID int64, messageID int, receipt string) error {
+	return rc.rdb.Set(ctx, forwardReceiptKey(chatID, messageID), receipt, ForwardMappingTTL).Err()
+}
+
+// GetForwardReceipt 获取转发标题的已回复标记，尚未回复或已过期时返回空字符串
+func (rc *RedisClient) GetForwardReceipt(ctx context.Context, chatID int64, messageID int) (string, error) {
+	receipt, err := rc.rdb.Get(ctx, forwardReceiptKey(chatID, messageID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return receipt, err
+}
+
+// MessageLink 记录一条消息在另一侧会话中对应的消息，用于同步编辑：
+// 用户消息对应转发给客服的副本，客服回复对应送达用户的消息
+type MessageLink struct {
+	ChatID    int64  // 对应消息所在的会话
+	MessageID int    // 对应消息的 ID
+	Text      string // 源消息最近一次的文字内容（文本或标题），用于显示编辑前的内容
+}
+
+func messageLinkKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("msglink:%d:%d", chatID, messageID)
+}
+
+// SaveMessageLink 记录会话 chatID 中的消息 messageID 对应的消息，与转发映射保留同样长的时间
+func (rc *RedisClient) SaveMessageLink(ctx context.Context, chatID int64, messageID int, link MessageLink) error {
+	key := messageLinkKey(chatID, messageID)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, key,
+		"chat_id", strconv.FormatInt(link.ChatID, 10),
+		"message_id", strconv.Itoa(link.MessageID),
+		"text", link.Text,
+	)
+	pipe.Expire(ctx, key, ForwardMappingTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetMessageLink 查询消息对应的消息，不存在或已过期时 ok 为 false
+func (rc *RedisClient) GetMessageLink(ctx context.Context, chatID int64, messageID int) (link MessageLink, ok bool, err error) {
+	vals, err := rc.rdb.HGetAll(ctx, messageLinkKey(chatID, messageID)).Result()
+	if err != nil || len(vals) == 0 {
+		return link, false, err
+	}
+	link.ChatID, _ = strconv.ParseInt(vals["chat_id"], 10, 64)
+	link.MessageID, _ = strconv.Atoi(vals["message_id"])
+	link.Text = vals["text"]
+	return link, link.ChatID != 0 && link.MessageID != 0, nil
+}
+
+// UpdateMessageLinkText 更新源消息的文字内容，映射不存在时不做任何事
+func (rc *RedisClient) UpdateMessageLinkText(ctx context.Context, chatID int64, messageID int, text string) error {
+	key := messageLinkKey(chatID, messageID)
+	n, err := rc.rdb.Exists(ctx, key).Result()
+	if err != nil || n == 0 {
+		return err
+	}
+	return rc.rdb.HSet(ctx, key, "text", text).Err()
+}
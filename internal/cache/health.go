@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisFailureThreshold = 3                // 连续失败多少次视为 Redis 不可用
+	healthCheckInterval   = 10 * time.Second // 后台 PING 间隔
+)
+
+// ErrUnavailable 在 Redis 判定为不可用期间立即返回，避免每次请求都等待连接超时
+var ErrUnavailable = errors.New("Redis 暂不可用")
+
+// probeKey 标记上下文中的命令是健康检查，Redis 不可用时仍然发送，用于发现恢复
+type probeKey struct{}
+
+// healthHook 观察每条 Redis 命令的结果，用于判断连接是否正常。
+// Redis 不可用期间除健康检查外的命令直接返回 ErrUnavailable，不再访问网络。
+type healthHook struct {
+	rc *RedisClient
+}
+
+func (h healthHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h healthHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.rc.rejects(ctx) {
+			cmd.SetErr(ErrUnavailable)
+			return ErrUnavailable
+		}
+		err := next(ctx, cmd)
+		h.rc.recordResult(err)
+		return err
+	}
+}
+
+func (h healthHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if h.rc.rejects(ctx) {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrUnavailable)
+			}
+			return ErrUnavailable
+		}
+		err := next(ctx, cmds)
+		h.rc.recordResult(err)
+		return err
+	}
+}
+
+// rejects 报告是否应跳过这条命令：Redis 不可用且不是健康检查
+func (rc *RedisClient) rejects(ctx context.Context) bool {
+	return ctx.Value(probeKey{}) == nil && !rc.Healthy()
+}
+
+// recordResult 根据命令结果更新连续失败计数，并在可用状态切换时触发 OnHealthChange。
+// redis.Nil 和 Redis 服务端返回的错误（如 WRONGTYPE）说明连接本身正常，不计为失败。
+func (rc *RedisClient) recordResult(err error) {
+	var redisErr redis.Error
+	failed := err != nil && err != redis.Nil && !errors.As(err, &redisErr)
+
+	rc.healthMu.Lock()
+	changed := false
+	if failed {
+		rc.failures++
+		if rc.failures >= redisFailureThreshold && !rc.down {
+			rc.down = true
+			changed = true
+		}
+	} else {
+		rc.failures = 0
+		if rc.down {
+			rc.down = false
+			changed = true
+		}
+	}
+	down := rc.down
+	rc.healthMu.Unlock()
+
+	if changed {
+		if down {
+			log.Printf("Redis 连续 %d 次请求失败，判定为不可用: %v", redisFailureThreshold, err)
+		} else {
+			log.Println("Redis 已恢复")
+		}
+		if rc.OnHealthChange != nil {
+			go rc.OnHealthChange(!down)
+		}
+	}
+}
+
+// Healthy 报告 Redis 当前是否可用。不可用时调用方应跳过非关键的记录操作。
+func (rc *RedisClient) Healthy() bool {
+	rc.healthMu.Lock()
+	defer rc.healthMu.Unlock()
+	return !rc.down
+}
+
+// StartHealthCheck 启动后台 PING，使空闲时也能发现 Redis 故障及恢复
+func (rc *RedisClient) StartHealthCheck() {
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			rc.Ping(ctx)
+			cancel()
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// outageLatency 模拟 Redis 故障时每次请求等待连接超时的耗时
+const outageLatency = 50 * time.Millisecond
+
+// outageHook 模拟 Redis 服务：down 为 true 时每条命令等待 outageLatency 后返回网络错误，calls 记录实际到达的请求数
+type outageHook struct {
+	down  *atomic.Bool
+	calls *atomic.Int32
+}
+
+func (h outageHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h outageHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := h.serve()
+		cmd.SetErr(err)
+		return err
+	}
+}
+
+func (h outageHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := h.serve()
+		for _, cmd := range cmds {
+			cmd.SetErr(err)
+		}
+		return err
+	}
+}
+
+func (h outageHook) serve() error {
+	h.calls.Add(1)
+	if h.down.Load() {
+		time.Sleep(outageLatency)
+		return errors.New("dial tcp 127.0.0.1:6379: i/o timeout")
+	}
+	return nil
+}
+
+func TestUnhealthyRedisFailsFast(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	t.Cleanup(func() { rdb.Close() })
+	rc := &RedisClient{rdb: rdb, userInfo: make(map[int64]storedUserInfo)}
+	rdb.AddHook(healthHook{rc: rc})
+	rdb.AddHook(outageHook{down: &down, calls: &calls})
+	ctx := context.Background()
+
+	down.Store(true)
+	for i := 0; i < redisFailureThreshold; i++ {
+		if _, err := rc.IsUserBlocked(ctx, 1); err == nil {
+			t.Fatal("Redis 故障时应返回错误")
+		}
+	}
+	if rc.Healthy() {
+		t.Fatalf("连续 %d 次失败后 Healthy() 应为 false", redisFailureThreshold)
+	}
+
+	// 不可用期间普通命令和管道都立即返回 ErrUnavailable，不再等待超时
+	calls.Store(0)
+	start := time.Now()
+	if _, err := rc.IsUserBlocked(ctx, 1); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("IsUserBlocked 错误 = %v，期望 ErrUnavailable", err)
+	}
+	if err := rc.StoreUserInfo(ctx, &tgbotapi.User{ID: 1, FirstName: "Bob"}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("StoreUserInfo 错误 = %v，期望 ErrUnavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed >= outageLatency {
+		t.Errorf("不可用期间的请求耗时 %v，期望立即返回", elapsed)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("不可用期间有 %d 个请求到达 Redis，期望 0", n)
+	}
+
+	// 健康检查仍然发送，成功后恢复
+	if err := rc.Ping(ctx); err == nil {
+		t.Error("Redis 仍故障时 Ping 应返回错误")
+	}
+	if calls.Load() != 1 || rc.Healthy() {
+		t.Fatalf("故障期间 Ping 应到达 Redis 且保持不可用，实际到达 %d 次、Healthy() = %v", calls.Load(), rc.Healthy())
+	}
+	down.Store(false)
+	if err := rc.Ping(ctx); err != nil {
+		t.Fatalf("Redis 恢复后 Ping 失败: %v", err)
+	}
+	if !rc.Healthy() {
+		t.Fatal("Ping 成功后 Healthy() 应为 true")
+	}
+	if _, err := rc.IsUserBlocked(ctx, 1); err != nil {
+		t.Errorf("恢复后 IsUserBlocked 失败: %v", err)
+	}
+}
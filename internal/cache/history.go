@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	HistoryLimit = 200 // 每位用户保留的对话记录条数
+
+	HistoryInbound  = "in"  // 用户发给机器人的消息
+	HistoryOutbound = "out" // 客服或机器人发给用户的消息
+)
+
+func historyKey(userID int64) string {
+	return fmt.Sprintf("history:%d", userID)
+}
+
+// HistoryEntry 是对话记录中的一条消息
+type HistoryEntry struct {
+	At        time.Time `json:"at"`
+	Direction string    `json:"dir"`  // HistoryInbound 或 HistoryOutbound
+	Type      string    `json:"type"` // 消息类型，例如 text、photo
+	Author    string    `json:"author"`
+	Text      string    `json:"text"` // 消息摘要
+}
+
+// AddHistoryEntry 记录用户对话中的一条消息，只保留最近 HistoryLimit 条
+func (rc *RedisClient) AddHistoryEntry(ctx context.Context, userID int64, entry HistoryEntry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := historyKey(userID)
+	pipe := rc.rdb.TxPipeline()
+	pipe.LPush(ctx, key, payload)
+	pipe.LTrim(ctx, key, 0, HistoryLimit-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetHistory 获取用户最近的 n 条对话记录，按时间从旧到新排列
+func (rc *RedisClient) GetHistory(ctx context.Context, userID int64, n int) ([]HistoryEntry, error) {
+	payloads, err := rc.rdb.LRange(ctx, historyKey(userID), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]HistoryEntry, 0, len(payloads))
+	for i := len(payloads) - 1; i >= 0; i-- {
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(payloads[i]), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
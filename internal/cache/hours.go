@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AwayDigestKey   = "away_digest" // List：非工作时间收到的用户消息，工作时间开始时汇总发送给客服
+	AwayDigestLimit = 500           // 汇总中最多保留的消息条数
+)
+
+func awayNotifiedKey(userID int64) string {
+	return fmt.Sprintf("away_notified:%d", userID)
+}
+
+// AwayMessage 是非工作时间收到的一条用户消息
+type AwayMessage struct {
+	UserID  int64
+	At      time.Time
+	Summary string
+}
+
+// MarkAwayNotified 记录已向用户发送离开消息，ttl 内再次调用返回 false，避免重复打扰用户
+func (rc *RedisClient) MarkAwayNotified(ctx context.Context, userID int64, ttl time.Duration) (bool, error) {
+	return rc.rdb.SetNX(ctx, awayNotifiedKey(userID), "1", ttl).Result()
+}
+
+// AddAwayMessage 将非工作时间收到的消息加入汇总，只保留最近 AwayDigestLimit 条
+func (rc *RedisClient) AddAwayMessage(ctx context.Context, msg AwayMessage) error {
+	entry := fmt.Sprintf("%d %d %s", msg.At.Unix(), msg.UserID, msg.Summary)
+	pipe := rc.rdb.TxPipeline()
+	pipe.RPush(ctx, AwayDigestKey, entry)
+	pipe.LTrim(ctx, AwayDigestKey, -AwayDigestLimit, -1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetAwayMessages 按时间顺序读取汇总中的所有消息，不删除；同时返回读取的条目数，
+// 汇总发送成功后以此调用 TrimAwayMessages，期间新加入的消息会保留到下一次汇总
+func (rc *RedisClient) GetAwayMessages(ctx context.Context) ([]AwayMessage, int, error) {
+	entries, err := rc.rdb.LRange(ctx, AwayDigestKey, 0, -1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	messages := make([]AwayMessage, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, " ", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		unix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		userID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, AwayMessage{UserID: userID, At: time.Unix(unix, 0), Summary: parts[2]})
+	}
+	return messages, len(entries), nil
+}
+
+// TrimAwayMessages 删除汇总中最早的 n 条消息
+func (rc *RedisClient) TrimAwayMessages(ctx context.Context, n int) error {
+	return rc.rdb.LTrim(ctx, AwayDigestKey, int64(n), -1).Err()
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 客服每日统计的字段，Hash 字段名为“客服ID:字段”
+const (
+	OperatorReplies         = "replies"          // 回复的消息数
+	OperatorResponses       = "responses"        // 计入响应时间的首次回复数
+	OperatorResponseSeconds = "response_seconds" // 首次回复的等待时间之和（秒）
+	OperatorResolved        = "resolved"         // 标记为已解决的会话数
+)
+
+// OperatorStats 是一位客服在一段时间内的统计
+type OperatorStats struct {
+	AdminID         int64
+	Replies         int64
+	Responses       int64
+	ResponseSeconds int64
+	Resolved        int64
+}
+
+// operatorStatsKey 返回某天（本地时间）所有客服的统计 Hash，例如 operator_stats:2024-01-31
+func operatorStatsKey(day time.Time) string {
+	return "operator_stats:" + day.Format("2006-01-02")
+}
+
+// operatorField 返回客服统计 Hash 中某位客服某个字段的字段名
+func operatorField(adminID int64, field string) string {
+	return strconv.FormatInt(adminID, 10) + ":" + field
+}
+
+// incrOperatorStat 将客服当天的统计字段增加 n
+func (rc *RedisClient) incrOperatorStat(ctx context.Context, adminID int64, field string, n int64, at time.Time) error {
+	key := operatorStatsKey(at)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, key, operatorField(adminID, field), n)
+	pipe.Expire(ctx, key, dailyStatsRetention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RecordOperatorResolved 将客服当天解决的会话数加一
+func (rc *RedisClient) RecordOperatorResolved(ctx context.Context, adminID int64, at time.Time) error {
+	return rc.incrOperatorStat(ctx, adminID, OperatorResolved, 1, at)
+}
+
+// GetOperatorStats 汇总截至 last 的 days 天内每位客服的统计
+func (rc *RedisClient) GetOperatorStats(ctx context.Context, last time.Time, days int) (map[int64]*OperatorStats, error) {
+	stats := make(map[int64]*OperatorStats)
+	for i := 0; i < days; i++ {
+		vals, err := rc.rdb.HGetAll(ctx, operatorStatsKey(last.AddDate(0, 0, -i))).Result()
+		if err != nil {
+			return nil, err
+		}
+		for field, val := range vals {
+			idStr, name, ok := strings.Cut(field, ":")
+			if !ok {
+				continue
+			}
+			adminID, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				continue
+			}
+			n, _ := strconv.ParseInt(val, 10, 64)
+			s := stats[adminID]
+			if s == nil {
+				s = &OperatorStats{AdminID: adminID}
+				stats[adminID] = s
+			}
+			switch name {
+			case OperatorReplies:
+				s.Replies += n
+			case OperatorResponses:
+				s.Responses += n
+			case OperatorResponseSeconds:
+				s.ResponseSeconds += n
+			case OperatorResolved:
+				s.Resolved += n
+			}
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	OrdersKey       = "orders"    // ZSet：订单号 -> 最后更新时间，用于按时间列出订单
+	orderSeq        = "order_seq" // 订单号自增计数器
+	orderNumberBase = 1000        // 订单号从 O1001 开始
+)
+
+// 订单状态
+const (
+	OrderStatusPending   = "pending"   // 待处理
+	OrderStatusPaid      = "paid"      // 已付款
+	OrderStatusShipped   = "shipped"   // 已发货
+	OrderStatusDelivered = "delivered" // 已完成
+	OrderStatusCancelled = "cancelled" // 已取消
+)
+
+// OrderStatuses 所有订单状态，按订单流转的顺序排列
+var OrderStatuses = []string{OrderStatusPending, OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled}
+
+func orderKey(id string) string {
+	return fmt.Sprintf("order:%s", id)
+}
+
+// userOrdersKey 是用户的订单号集合，按创建时间排序
+func userOrdersKey(userID int64) string {
+	return fmt.Sprintf("user_orders:%d", userID)
+}
+
+// Order 是关联到用户的一条订单记录
+type Order struct {
+	ID        string // 形如 O1024
+	UserID    int64
+	Item      string
+	Status    string
+	Note      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NormalizeOrderID 将输入的订单号（如 "#o1024"）转换为存储使用的形式
+func NormalizeOrderID(input string) string {
+	return strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(input), "#"))
+}
+
+// CreateOrder 为用户创建一条状态为待处理的订单
+func (rc *RedisClient) CreateOrder(ctx context.Context, userID int64, item, note string) (Order, error) {
+	seq, err := rc.rdb.Incr(ctx, orderSeq).Result()
+	if err != nil {
+		return Order{}, err
+	}
+	now := time.Now()
+	order := Order{
+		ID:        fmt.Sprintf("O%d", orderNumberBase+seq),
+		UserID:    userID,
+		Item:      item,
+		Status:    OrderStatusPending,
+		Note:      note,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, orderKey(order.ID),
+		"user_id", strconv.FormatInt(userID, 10),
+		"item", item,
+		"status", order.Status,
+		"note", note,
+		"created_at", strconv.FormatInt(now.Unix(), 10),
+		"updated_at", strconv.FormatInt(now.Unix(), 10),
+	)
+	pipe.ZAdd(ctx, userOrdersKey(userID), redis.Z{Score: float64(now.Unix()), Member: order.ID})
+	pipe.ZAdd(ctx, OrdersKey, redis.Z{Score: float64(now.Unix()), Member: order.ID})
+	_, err = pipe.Exec(ctx)
+	return order, err
+}
+
+// GetOrder 获取订单，订单不存在时第二个返回值为 false
+func (rc *RedisClient) GetOrder(ctx context.Context, id string) (Order, bool, error) {
+	fields, err := rc.rdb.HGetAll(ctx, orderKey(id)).Result()
+	if err != nil || len(fields) == 0 {
+		return Order{}, false, err
+	}
+	userID, _ := strconv.ParseInt(fields["user_id"], 10, 64)
+	created, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	updated, _ := strconv.ParseInt(fields["updated_at"], 10, 64)
+	return Order{
+		ID:        id,
+		UserID:    userID,
+		Item:      fields["item"],
+		Status:    fields["status"],
+		Note:      fields["note"],
+		CreatedAt: time.Unix(created, 0),
+		UpdatedAt: time.Unix(updated, 0),
+	}, true, nil
+}
+
+// UpdateOrder 修改订单的状态、商品或备注，为空的参数保持不变
+func (rc *RedisClient) UpdateOrder(ctx context.Context, id, status, item, note string) error {
+	now := time.Now().Unix()
+	values := []interface{}{"updated_at", strconv.FormatInt(now, 10)}
+	if status != "" {
+		values = append(values, "status", status)
+	}
+	if item != "" {
+		values = append(values, "item", item)
+	}
+	if note != "" {
+		values = append(values, "note", note)
+	}
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, orderKey(id), values...)
+	pipe.ZAdd(ctx, OrdersKey, redis.Z{Score: float64(now), Member: id})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetUserOrders 按创建时间从新到旧返回用户最近的 limit 条订单
+func (rc *RedisClient) GetUserOrders(ctx context.Context, userID int64, limit int64) ([]Order, error) {
+	ids, err := rc.rdb.ZRevRange(ctx, userOrdersKey(userID), 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return rc.getOrders(ctx, ids)
+}
+
+// GetRecentOrders 按最后更新时间从新到旧返回最近的 limit 条订单
+func (rc *RedisClient) GetRecentOrders(ctx context.Context, limit int64) ([]Order, error) {
+	ids, err := rc.rdb.ZRevRange(ctx, OrdersKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return rc.getOrders(ctx, ids)
+}
+
+// getOrders 依次读取订单，跳过已不存在的订单
+func (rc *RedisClient) getOrders(ctx context.Context, ids []string) ([]Order, error) {
+	orders := make([]Order, 0, len(ids))
+	for _, id := range ids {
+		order, ok, err := rc.GetOrder(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// singleKeyCommands 是第一个参数为键的命令，覆盖本包用到的全部单键命令
+var singleKeyCommands = map[string]bool{
+	"get": true, "set": true, "setnx": true, "setex": true, "getset": true, "incr": true, "incrby": true, "decr": true, "expire": true, "pexpire": true,
+	"ttl": true, "pttl": true, "type": true, "persist": true,
+	"hset": true, "hmset": true, "hsetnx": true, "hget": true, "hmget": true, "hgetall": true, "hdel": true, "hincrby": true,
+	"hkeys": true, "hvals": true, "hlen": true, "hexists": true, "hscan": true,
+	"sadd": true, "srem": true, "smembers": true, "sismember": true, "scard": true, "sscan": true, "srandmember": true,
+	"zadd": true, "zrem": true, "zscore": true, "zcard": true, "zcount": true, "zincrby": true, "zrange": true,
+	"zrangebyscore": true, "zrevrange": true, "zrevrangebyscore": true, "zremrangebyscore": true, "zscan": true,
+	"lpush": true, "rpush": true, "lrange": true, "ltrim": true, "lrem": true, "llen": true, "lpop": true, "rpop": true,
+	"xadd": true, "xrange": true, "xrevrange": true, "xlen": true, "xtrim": true,
+}
+
+// multiKeyCommands 是所有参数都是键的命令
+var multiKeyCommands = map[string]bool{
+	"del": true, "unlink": true, "exists": true, "mget": true,
+	"sdiff": true, "sinter": true, "sunion": true, "sdiffstore": true,
+}
+
+// keylessCommands 是不带键的命令（包括建立连接时的 HELLO、AUTH、CLIENT、SELECT），原样发送
+var keylessCommands = map[string]bool{
+	"ping": true, "hello": true, "auth": true, "select": true, "client": true, "quit": true, "echo": true,
+	"multi": true, "exec": true, "discard": true, "info": true, "dbsize": true, "time": true, "script": true,
+}
+
+// rawKeysKey 标记上下文中的命令不添加键前缀，用于迁移旧数据
+type rawKeysKey struct{}
+
+// prefixHook 为每条命令的键加上 RedisClient 的前缀，并从 SCAN 返回的键中去掉前缀，
+// 使多个机器人可以共用同一个 Redis 数据库，而其余代码无需感知前缀
+type prefixHook struct {
+	prefix string
+}
+
+func (h prefixHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h prefixHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if ctx.Value(rawKeysKey{}) != nil {
+			return next(ctx, cmd)
+		}
+		if err := h.prefixArgs(cmd); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err := next(ctx, cmd)
+		h.stripScan(cmd)
+		return err
+	}
+}
+
+func (h prefixHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if ctx.Value(rawKeysKey{}) != nil {
+			return next(ctx, cmds)
+		}
+		// 管道中有任何一条命令无法加前缀时整个管道都不发送，避免部分命令读写其他机器人的键
+		for _, cmd := range cmds {
+			if err := h.prefixArgs(cmd); err != nil {
+				for _, c := range cmds {
+					c.SetErr(err)
+				}
+				return err
+			}
+		}
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			h.stripScan(cmd)
+		}
+		return err
+	}
+}
+
+// prefixArgs 就地为命令参数中的键加上前缀。未归类的命令无法确定哪些参数是键，直接返回错误，
+// 避免不带前缀地读写其他机器人的数据；新用到的命令需要先加入上面的列表
+func (h prefixHook) prefixArgs(cmd redis.Cmder) error {
+	args := cmd.Args()
+	name := strings.ToLower(cmd.Name())
+	if keylessCommands[name] {
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("键前缀：命令 %s 缺少键", name)
+	}
+	switch {
+	case singleKeyCommands[name]:
+		args[1] = h.key(args[1])
+	case multiKeyCommands[name]:
+		for i := 1; i < len(args); i++ {
+			args[i] = h.key(args[i])
+		}
+	case name == "eval" || name == "evalsha" || name == "eval_ro" || name == "evalsha_ro":
+		// EVAL script numkeys key [key ...] arg [arg ...]，只有前 numkeys 个参数是键。
+		// 脚本中访问的键都必须通过 KEYS 传入，不能在脚本里拼接键名
+		if len(args) < 3 {
+			return fmt.Errorf("键前缀：命令 %s 缺少 numkeys", name)
+		}
+		n, _ := strconv.Atoi(fmt.Sprint(args[2]))
+		for i := 3; i < 3+n && i < len(args); i++ {
+			args[i] = h.key(args[i])
+		}
+	case name == "zunionstore" || name == "zinterstore":
+		// ZUNIONSTORE dest numkeys key [key ...] [WEIGHTS ...] [AGGREGATE ...]
+		if len(args) < 3 {
+			return fmt.Errorf("键前缀：命令 %s 缺少 numkeys", name)
+		}
+		args[1] = h.key(args[1])
+		n, _ := strconv.Atoi(fmt.Sprint(args[2]))
+		for i := 3; i < 3+n && i < len(args); i++ {
+			args[i] = h.key(args[i])
+		}
+	case name == "scan":
+		// SCAN cursor [MATCH pattern] [COUNT n]，没有 MATCH 时会返回其他机器人的键，不允许使用。
+		// 迭代器翻页时重复使用同一条命令，已加过前缀的模式不再重复添加
+		for i := 2; i+1 < len(args); i++ {
+			if strings.EqualFold(fmt.Sprint(args[i]), "match") {
+				if pattern := fmt.Sprint(args[i+1]); !strings.HasPrefix(pattern, h.prefix) {
+					args[i+1] = h.prefix + pattern
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("键前缀：SCAN 必须带有 MATCH")
+	default:
+		return fmt.Errorf("键前缀：命令 %s 未归类，无法确定哪些参数是键", name)
+	}
+	return nil
+}
+
+// stripScan 去掉 SCAN 返回的键的前缀
+func (h prefixHook) stripScan(cmd redis.Cmder) {
+	scan, ok := cmd.(*redis.ScanCmd)
+	if !ok || strings.ToLower(cmd.Name()) != "scan" {
+		return
+	}
+	keys, cursor := scan.Val()
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, h.prefix)
+	}
+	scan.SetVal(keys, cursor)
+}
+
+func (h prefixHook) key(arg interface{}) interface{} {
+	return h.prefix + fmt.Sprint(arg)
+}
+
+// KeyPrefix 返回所有键的前缀，未设置时为空
+func (rc *RedisClient) KeyPrefix() string {
+	return rc.prefix
+}
+
+// MigrateKeyPrefix 将数据库中没有前缀的键重命名为带前缀的键，用于为已有数据启用前缀。
+// 目标键已存在时跳过。应在数据库中只有本机器人的旧数据时执行，否则其他机器人的键也会被移动
+func (rc *RedisClient) MigrateKeyPrefix(ctx context.Context) (moved, skipped int, err error) {
+	if rc.prefix == "" {
+		return 0, 0, fmt.Errorf("未设置键前缀")
+	}
+	raw := context.WithValue(ctx, rawKeysKey{}, true)
+	var cursor uint64
+	for {
+		keys, next, err := rc.rdb.Scan(raw, cursor, "*", backupScanCount).Result()
+		if err != nil {
+			return moved, skipped, err
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, rc.prefix) {
+				continue
+			}
+			ok, err := rc.rdb.RenameNX(raw, key, rc.prefix+key).Result()
+			if err != nil {
+				return moved, skipped, fmt.Errorf("重命名 %s 失败: %w", key, err)
+			}
+			if ok {
+				moved++
+			} else {
+				skipped++
+			}
+		}
+		if next == 0 {
+			return moved, skipped, nil
+		}
+		cursor = next
+	}
+}
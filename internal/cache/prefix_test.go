@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// recordHook 记录经过 prefixHook 处理后的命令参数，不连接 Redis，所有命令都返回空结果
+type recordHook struct {
+	cmds *[]string
+}
+
+func (h recordHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h recordHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.record(cmd)
+		return nil
+	}
+}
+
+func (h recordHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.record(cmd)
+		}
+		return nil
+	}
+}
+
+func (h recordHook) record(cmd redis.Cmder) {
+	args := make([]string, len(cmd.Args()))
+	for i, arg := range cmd.Args() {
+		args[i] = fmt.Sprint(arg)
+	}
+	*h.cmds = append(*h.cmds, strings.Join(args, " "))
+}
+
+// newRecordingClient 返回带有键前缀的 RedisClient，发出的命令记录在返回的切片中
+func newRecordingClient(t *testing.T, prefix string) (*RedisClient, *[]string) {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	t.Cleanup(func() { rdb.Close() })
+	rc := &RedisClient{rdb: rdb, prefix: prefix, userInfo: make(map[int64]storedUserInfo)}
+	rdb.AddHook(prefixHook{prefix: prefix})
+	var cmds []string
+	rdb.AddHook(recordHook{cmds: &cmds})
+	return rc, &cmds
+}
+
+func TestPrefixArgs(t *testing.T) {
+	h := prefixHook{prefix: "bot1:"}
+	tests := []struct {
+		name    string
+		args    []interface{}
+		want    []interface{}
+		wantErr bool
+	}{
+		{"单键命令", []interface{}{"get", "a"}, []interface{}{"get", "bot1:a"}, false},
+		{"单键命令的字段不加前缀", []interface{}{"hset", "user:1", "username", "bob"}, []interface{}{"hset", "bot1:user:1", "username", "bob"}, false},
+		{"多键命令", []interface{}{"del", "a", "b"}, []interface{}{"del", "bot1:a", "bot1:b"}, false},
+		{"SDIFFSTORE", []interface{}{"sdiffstore", "dst", "a", "b"}, []interface{}{"sdiffstore", "bot1:dst", "bot1:a", "bot1:b"}, false},
+		{"EVAL 只处理 KEYS", []interface{}{"eval", "return 1", 2, "a", "b", "arg"}, []interface{}{"eval", "return 1", 2, "bot1:a", "bot1:b", "arg"}, false},
+		{"EVALSHA 只处理 KEYS", []interface{}{"evalsha", "abc", "1", "a", "arg"}, []interface{}{"evalsha", "abc", "1", "bot1:a", "arg"}, false},
+		{"ZUNIONSTORE", []interface{}{"zunionstore", "dst", 2, "a", "b", "weights", 1, 2}, []interface{}{"zunionstore", "bot1:dst", 2, "bot1:a", "bot1:b", "weights", 1, 2}, false},
+		{"SCAN MATCH", []interface{}{"scan", 0, "match", "user:*", "count", 100}, []interface{}{"scan", 0, "match", "bot1:user:*", "count", 100}, false},
+		{"SCAN 翻页不重复加前缀", []interface{}{"scan", 7, "match", "bot1:user:*"}, []interface{}{"scan", 7, "match", "bot1:user:*"}, false},
+		{"SCAN 没有 MATCH", []interface{}{"scan", 0}, nil, true},
+		{"无键命令", []interface{}{"multi"}, []interface{}{"multi"}, false},
+		{"连接命令", []interface{}{"hello", 3}, []interface{}{"hello", 3}, false},
+		{"未归类的命令", []interface{}{"rename", "a", "b"}, nil, true},
+		{"缺少键", []interface{}{"get"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := redis.NewCmd(context.Background(), tt.args...)
+			err := h.prefixArgs(cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prefixArgs(%v) 错误 = %v，期望出错 %v", tt.args, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(cmd.Args(), tt.want) {
+				t.Errorf("prefixArgs 后参数 = %v，期望 %v", cmd.Args(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStripScan(t *testing.T) {
+	h := prefixHook{prefix: "bot1:"}
+	cmd := redis.NewScanCmd(context.Background(), nil, "scan", 0, "match", "bot1:*")
+	cmd.SetVal([]string{"bot1:user:1", "bot1:usernames"}, 42)
+	h.stripScan(cmd)
+	keys, cursor := cmd.Val()
+	if want := []string{"user:1", "usernames"}; !reflect.DeepEqual(keys, want) || cursor != 42 {
+		t.Errorf("stripScan 后 = %v, %d，期望 %v, 42", keys, cursor, want)
+	}
+}
+
+func TestPrefixHookRejectsUnclassifiedCommands(t *testing.T) {
+	rc, cmds := newRecordingClient(t, "bot1:")
+	ctx := context.Background()
+	if err := rc.rdb.Rename(ctx, "a", "b").Err(); err == nil {
+		t.Error("未归类的命令应返回错误")
+	}
+	pipe := rc.rdb.Pipeline()
+	get := pipe.Get(ctx, "a")
+	pipe.Rename(ctx, "a", "b")
+	if _, err := pipe.Exec(ctx); err == nil || get.Err() == nil {
+		t.Error("管道中有未归类的命令时整个管道应返回错误")
+	}
+	if len(*cmds) != 0 {
+		t.Errorf("出错的命令不应发送，实际发送了 %q", *cmds)
+	}
+	// 迁移旧数据时不加前缀，任何命令都原样发送
+	raw := context.WithValue(ctx, rawKeysKey{}, true)
+	if err := rc.rdb.Rename(raw, "a", "b").Err(); err != nil {
+		t.Errorf("rawKeysKey 下的命令不应被拒绝: %v", err)
+	}
+}
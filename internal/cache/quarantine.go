@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// QuarantineTTL 被隔离的消息等待管理员处理的时间，过期后无法再放行
+	QuarantineTTL = 7 * 24 * time.Hour
+
+	quarantineSeq  = "quarantine_seq"
+	SpamTrustedKey = "spam_trusted" // 管理员放行过的用户，不再检查垃圾链接
+)
+
+func quarantineKey(id int64) string {
+	return fmt.Sprintf("quarantine:%d", id)
+}
+
+// SaveQuarantine 保存一条被隔离的消息（JSON），返回隔离 ID
+func (rc *RedisClient) SaveQuarantine(ctx context.Context, payload string) (int64, error) {
+	id, err := rc.rdb.Incr(ctx, quarantineSeq).Result()
+	if err != nil {
+		return 0, err
+	}
+	return id, rc.rdb.Set(ctx, quarantineKey(id), payload, QuarantineTTL).Err()
+}
+
+// TakeQuarantine 取出并删除被隔离的消息，已处理或已过期时返回空字符串，保证每条消息只被处理一次
+func (rc *RedisClient) TakeQuarantine(ctx context.Context, id int64) (string, error) {
+	key := quarantineKey(id)
+	pipe := rc.rdb.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", err
+	}
+	payload, err := get.Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return payload, err
+}
+
+// TrustUser 将用户标记为可信，之后的消息不再检查垃圾链接
+func (rc *RedisClient) TrustUser(ctx context.Context, userID int64) error {
+	return rc.rdb.SAdd(ctx, SpamTrustedKey, strconv.FormatInt(userID, 10)).Err()
+}
+
+// IsUserTrusted 检查用户是否被标记为可信
+func (rc *RedisClient) IsUserTrusted(ctx context.Context, userID int64) (bool, error) {
+	return rc.rdb.SIsMember(ctx, SpamTrustedKey, strconv.FormatInt(userID, 10)).Result()
+}
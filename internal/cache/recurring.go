@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RecurringBroadcastsKey = "recurring_broadcasts" // Hash：周期广播 ID -> 周期广播内容的 JSON
+	recurringSeq           = "recurring_seq"        // 周期广播 ID 自增计数器
+)
+
+// NextRecurringBroadcastID 生成新的周期广播 ID，形如 R1
+func (rc *RedisClient) NextRecurringBroadcastID(ctx context.Context) (string, error) {
+	seq, err := rc.rdb.Incr(ctx, recurringSeq).Result()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("R%d", seq), nil
+}
+
+// SaveRecurringBroadcast 保存（或更新）一个周期广播
+func (rc *RedisClient) SaveRecurringBroadcast(ctx context.Context, id, payload string) error {
+	return rc.rdb.HSet(ctx, RecurringBroadcastsKey, id, payload).Err()
+}
+
+// GetRecurringBroadcasts 获取所有周期广播
+func (rc *RedisClient) GetRecurringBroadcasts(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, RecurringBroadcastsKey).Result()
+}
+
+// GetRecurringBroadcast 获取指定周期广播，不存在时返回空字符串
+func (rc *RedisClient) GetRecurringBroadcast(ctx context.Context, id string) (string, error) {
+	val, err := rc.rdb.HGet(ctx, RecurringBroadcastsKey, id).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// DeleteRecurringBroadcast 删除指定周期广播
+func (rc *RedisClient) DeleteRecurringBroadcast(ctx context.Context, id string) error {
+	return rc.rdb.HDel(ctx, RecurringBroadcastsKey, id).Err()
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -12,16 +14,40 @@ import (
 
 const (
 	UsersSetKey     = "telegram_bot_users"
-	BlockedUsersSet = "blocked_users" // 新增：用于存储黑名单的 Redis Set Key redis.go 我怎么新增个查看main.go可以查看拉黑的用户列表
+	BlockedUsersSet = "blocked_users"    // 新增：用于存储黑名单的 Redis Set Key redis.go 我怎么新增个查看main.go可以查看拉黑的用户列表
+	OptOutUsersSet  = "broadcast_optout" // 退订广播的用户，仍保留在 UsersSetKey 中以便继续联系客服
+	UsernamesKey    = "usernames"        // Hash：小写用户名 -> 用户 ID，用于按 @username 查找用户
 )
 
 // RedisClient 封装了 Redis 客户端
 type RedisClient struct {
-	rdb *redis.Client
+	rdb    *redis.Client
+	prefix string // 所有键的前缀，为空时不加前缀
+
+	// OnHealthChange 在 Redis 可用状态切换时被调用（在独立 goroutine 中）
+	OnHealthChange func(healthy bool)
+
+	healthMu sync.Mutex
+	failures int
+	down     bool
+
+	userInfoMu sync.Mutex
+	userInfo   map[int64]storedUserInfo // 最近写入过的用户信息，避免每条消息都重写未变化的资料
 }
 
-// NewRedisClient 创建并返回一个新的 RedisClient 实例
-func NewRedisClient(addr, password string, db int) (*RedisClient, error) {
+// storedUserInfo 记录最近一次写入 Redis 的用户资料和写入时间
+type storedUserInfo struct {
+	firstName, lastName, username string
+	at                            time.Time
+}
+
+const (
+	userInfoCacheTTL   = time.Minute // 资料未变化时，最多每隔这么久刷新一次最后活跃时间
+	userInfoCacheLimit = 10000       // 本地缓存超过该数量时清理过期条目
+)
+
+// NewRedisClient 创建并返回一个新的 RedisClient 实例，prefix 非空时所有键都加上该前缀
+func NewRedisClient(addr, password string, db int, prefix string) (*RedisClient, error) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
@@ -36,12 +62,34 @@ func NewRedisClient(addr, password string, db int) (*RedisClient, error) {
 		return nil, err
 	}
 
-	return &RedisClient{rdb: rdb}, nil
+	rc := &RedisClient{rdb: rdb, prefix: prefix, userInfo: make(map[int64]storedUserInfo)}
+	rdb.AddHook(healthHook{rc: rc})
+	if prefix != "" {
+		rdb.AddHook(prefixHook{prefix: prefix})
+	}
+	return rc, nil
 }
 
-// CheckAndAddUser 检查用户是否存在，如果不存在则添加
-func (rc *RedisClient) CheckAndAddUser(ctx context.Context, key string, userID int64) {
-	rc.rdb.SAdd(ctx, key, strconv.FormatInt(userID, 10))
+// Ping 检查 Redis 连接是否可用。Redis 判定为不可用时仍会实际发送，成功后恢复其他命令
+func (rc *RedisClient) Ping(ctx context.Context) error {
+	return rc.rdb.Ping(context.WithValue(ctx, probeKey{}, true)).Err()
+}
+
+// CheckAndAddUser 检查用户是否存在，如果不存在则添加，返回是否为新添加的用户。
+// 新加入用户集合的用户同时记录首次联系时间，最后活跃时间由 StoreUserInfo 在每条消息时更新。
+func (rc *RedisClient) CheckAndAddUser(ctx context.Context, key string, userID int64) (bool, error) {
+	if key == UsersSetKey {
+		added, err := rc.addCounted(ctx, UsersSetKey, StatsTotalUsersKey, userID)
+		if err != nil || !added {
+			return false, err
+		}
+		if err := rc.markFirstSeen(ctx, userID, time.Now()); err != nil {
+			return true, err
+		}
+		return true, rc.IncrDailyStat(ctx, DailyNewUsers)
+	}
+	n, err := rc.rdb.SAdd(ctx, key, strconv.FormatInt(userID, 10)).Result()
+	return n > 0, err
 }
 
 // GetAllUserIDs 获取所有用户ID
@@ -49,6 +97,35 @@ func (rc *RedisClient) GetAllUserIDs(ctx context.Context, key string) ([]string,
 	return rc.rdb.SMembers(ctx, key).Result()
 }
 
+// ScanUserIDs 使用 SSCAN 从 cursor 开始读取集合的一页用户ID，返回下一页的游标，游标为 0 表示已遍历完。
+// count 只是建议的每页数量：小集合可能一次返回全部成员，集合在遍历期间变化时同一成员也可能重复返回。
+func (rc *RedisClient) ScanUserIDs(ctx context.Context, key string, cursor uint64, count int64) ([]string, uint64, error) {
+	return rc.rdb.SScan(ctx, key, cursor, "", count).Result()
+}
+
+// EachUserIDPage 使用 SSCAN 分页遍历集合中的全部用户ID，每页调用一次 fn，fn 返回 false 时停止遍历
+func (rc *RedisClient) EachUserIDPage(ctx context.Context, key string, count int64, fn func(userIDs []string) bool) error {
+	var cursor uint64
+	for {
+		ids, next, err := rc.ScanUserIDs(ctx, key, cursor, count)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 && !fn(ids) {
+			return nil
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// CountUserIDs 返回集合中的用户数
+func (rc *RedisClient) CountUserIDs(ctx context.Context, key string) (int64, error) {
+	return rc.rdb.SCard(ctx, key).Result()
+}
+
 // SetConfigValue 设置配置值
 func (rc *RedisClient) SetConfigValue(ctx context.Context, key, value string) error {
 	return rc.rdb.Set(ctx, key, value, 0).Err()
@@ -65,12 +142,17 @@ func (rc *RedisClient) GetConfigValue(ctx context.Context, key string) (string,
 
 // AddBlockedUser 将用户添加到黑名单
 func (rc *RedisClient) AddBlockedUser(ctx context.Context, userID int64) error {
-	return rc.rdb.SAdd(ctx, BlockedUsersSet, strconv.FormatInt(userID, 10)).Err()
+	added, err := rc.addCounted(ctx, BlockedUsersSet, StatsBlockedUsersKey, userID)
+	if err != nil || !added {
+		return err
+	}
+	return rc.IncrDailyStat(ctx, DailyBlocks)
 }
 
 // RemoveBlockedUser 将用户从黑名单中移除
 func (rc *RedisClient) RemoveBlockedUser(ctx context.Context, userID int64) error {
-	return rc.rdb.SRem(ctx, BlockedUsersSet, strconv.FormatInt(userID, 10)).Err()
+	_, err := rc.removeCounted(ctx, BlockedUsersSet, StatsBlockedUsersKey, userID)
+	return err
 }
 
 // IsUserBlocked 检查用户是否在黑名单中
@@ -83,27 +165,124 @@ func (rc *RedisClient) GetBlockedUserIDs(ctx context.Context) ([]string, error)
 	return rc.rdb.SMembers(ctx, BlockedUsersSet).Result()
 }
 
+// ScanBlockedUserIDs 使用 SSCAN 读取一页被拉黑的用户ID，用法同 ScanUserIDs
+func (rc *RedisClient) ScanBlockedUserIDs(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error) {
+	return rc.ScanUserIDs(ctx, BlockedUsersSet, cursor, count)
+}
+
+// AddBroadcastOptOut 将用户加入广播退订列表
+func (rc *RedisClient) AddBroadcastOptOut(ctx context.Context, userID int64) error {
+	_, err := rc.addCounted(ctx, OptOutUsersSet, StatsOptOutUsersKey, userID)
+	return err
+}
+
+// RemoveBroadcastOptOut 将用户从广播退订列表移除，返回用户此前是否已退订
+func (rc *RedisClient) RemoveBroadcastOptOut(ctx context.Context, userID int64) (bool, error) {
+	return rc.removeCounted(ctx, OptOutUsersSet, StatsOptOutUsersKey, userID)
+}
+
+// IsBroadcastOptedOut 检查用户是否已退订广播
+func (rc *RedisClient) IsBroadcastOptedOut(ctx context.Context, userID int64) (bool, error) {
+	return rc.rdb.SIsMember(ctx, OptOutUsersSet, strconv.FormatInt(userID, 10)).Result()
+}
+
 // StoreUserInfo 存储用户的用户名和昵称到 Redis Hash（key: "user:<userID>"）
 func (rc *RedisClient) StoreUserInfo(ctx context.Context, user *tgbotapi.User) error {
 	if user == nil {
 		return nil // 无用户对象，不存储
 	}
-	key := fmt.Sprintf("user:%d", user.ID)
+	now := time.Now()
+	info := storedUserInfo{firstName: user.FirstName, lastName: user.LastName, username: user.UserName, at: now}
+	if !rc.userInfoChanged(user.ID, info) {
+		return nil
+	}
 
-	// 使用多次 HSet 调用来兼容旧版 Redis
-	err := rc.rdb.HSet(ctx, key, "first_name", user.FirstName).Err()
+	key := fmt.Sprintf("user:%d", user.ID)
+	id := strconv.FormatInt(user.ID, 10)
+	unix := strconv.FormatInt(now.Unix(), 10)
+	// 所有写入放在同一个管道中，一次往返完成
+	_, err := rc.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"first_name":    user.FirstName,
+			"last_name":     user.LastName,
+			"username":      user.UserName,
+			lastActiveField: unix,
+		})
+		pipe.HSetNX(ctx, key, firstSeenField, unix)
+		pipe.ZAdd(ctx, LastActiveZSetKey, redis.Z{Score: float64(now.Unix()), Member: id})
+		if user.UserName != "" {
+			pipe.HSet(ctx, UsernamesKey, strings.ToLower(user.UserName), id)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	err = rc.rdb.HSet(ctx, key, "last_name", user.LastName).Err()
+	rc.rememberUserInfo(user.ID, info)
+	return nil
+}
+
+// userInfoChanged 判断用户资料是否需要写入：资料有变化，或距上次写入已超过 userInfoCacheTTL
+func (rc *RedisClient) userInfoChanged(userID int64, info storedUserInfo) bool {
+	rc.userInfoMu.Lock()
+	defer rc.userInfoMu.Unlock()
+	prev, ok := rc.userInfo[userID]
+	if !ok || info.at.Sub(prev.at) >= userInfoCacheTTL {
+		return true
+	}
+	return prev.firstName != info.firstName || prev.lastName != info.lastName || prev.username != info.username
+}
+
+// rememberUserInfo 记录已写入的用户资料，缓存过大时顺带清理过期条目
+func (rc *RedisClient) rememberUserInfo(userID int64, info storedUserInfo) {
+	rc.userInfoMu.Lock()
+	defer rc.userInfoMu.Unlock()
+	if len(rc.userInfo) >= userInfoCacheLimit {
+		for id, prev := range rc.userInfo {
+			if info.at.Sub(prev.at) >= userInfoCacheTTL {
+				delete(rc.userInfo, id)
+			}
+		}
+	}
+	rc.userInfo[userID] = info
+}
+
+// FindUserIDByUsername 根据用户名（不含 @，不区分大小写）查找用户 ID，找不到时返回 0。
+// 只查询用户名索引（由 StoreUserInfo 维护，升级前的用户由 EnsureUsernameIndex 补建），不扫描用户资料。
+func (rc *RedisClient) FindUserIDByUsername(ctx context.Context, username string) (int64, error) {
+	username = strings.ToLower(strings.TrimPrefix(username, "@"))
+	idStr, err := rc.rdb.HGet(ctx, UsernamesKey, username).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
-	err = rc.rdb.HSet(ctx, key, "username", user.UserName).Err()
+	userID, _ := strconv.ParseInt(idStr, 10, 64)
+	// 用户名可能已被原用户更换，确认当前仍属于该用户
+	_, _, current, err := rc.GetUserInfo(ctx, userID)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	if !strings.EqualFold(current, username) {
+		rc.rdb.HDel(ctx, UsernamesKey, username)
+		return 0, nil
+	}
+	return userID, nil
+}
+
+// SetUserTopic 记录用户通过深度链接进入时携带的主题（key: "topic:<userID>"）
+func (rc *RedisClient) SetUserTopic(ctx context.Context, userID int64, topic string) error {
+	return rc.rdb.Set(ctx, fmt.Sprintf("topic:%d", userID), topic, 0).Err()
+}
+
+// GetUserTopic 获取用户的主题，未设置时返回空字符串
+func (rc *RedisClient) GetUserTopic(ctx context.Context, userID int64) (string, error) {
+	val, err := rc.rdb.Get(ctx, fmt.Sprintf("topic:%d", userID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
 }
 
 // GetUserInfo 从 Redis Hash 获取用户的用户名和昵称
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// benchUserID 是基准测试写入的用户 ID，所有键都带有独立的前缀，不影响机器人的数据
+const benchUserID = 900000001
+
+// newBenchClient 连接 REDIS_ADDR 指定的 Redis，未设置或无法连接时跳过基准测试
+func newBenchClient(b *testing.B) *RedisClient {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		b.Skip("未设置 REDIS_ADDR，跳过需要 Redis 的基准测试")
+	}
+	db, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+	prefix := fmt.Sprintf("bench:%d:", time.Now().UnixNano())
+	rc, err := NewRedisClient(addr, os.Getenv("REDIS_PASSWORD"), db, prefix)
+	if err != nil {
+		b.Skipf("无法连接到 Redis %s: %v", addr, err)
+	}
+	b.Cleanup(func() {
+		ctx := context.Background()
+		rc.rdb.Del(ctx, fmt.Sprintf("user:%d", benchUserID), LastActiveZSetKey, UsernamesKey)
+		rc.rdb.Close()
+	})
+	return rc
+}
+
+// storeUserInfoSequential 是改为管道之前的 StoreUserInfo：每个字段一次 HSET，共 6～7 次往返
+func storeUserInfoSequential(ctx context.Context, rc *RedisClient, user *tgbotapi.User) error {
+	key := fmt.Sprintf("user:%d", user.ID)
+	for _, field := range [][2]string{
+		{"first_name", user.FirstName},
+		{"last_name", user.LastName},
+		{"username", user.UserName},
+	} {
+		if err := rc.rdb.HSet(ctx, key, field[0], field[1]).Err(); err != nil {
+			return err
+		}
+	}
+	unix := time.Now().Unix()
+	now := strconv.FormatInt(unix, 10)
+	if err := rc.rdb.HSetNX(ctx, key, firstSeenField, now).Err(); err != nil {
+		return err
+	}
+	if err := rc.rdb.HSet(ctx, key, lastActiveField, now).Err(); err != nil {
+		return err
+	}
+	id := strconv.FormatInt(user.ID, 10)
+	if err := rc.rdb.ZAdd(ctx, LastActiveZSetKey, redis.Z{Score: float64(unix), Member: id}).Err(); err != nil {
+		return err
+	}
+	if user.UserName != "" {
+		return rc.rdb.HSet(ctx, UsernamesKey, strings.ToLower(user.UserName), id).Err()
+	}
+	return nil
+}
+
+// BenchmarkStoreUserInfo 对比逐条 HSET、单次管道写入，以及资料未变化时命中本地缓存的耗时。
+// 需要 Redis：REDIS_ADDR=127.0.0.1:6379 go test -run '^$' -bench StoreUserInfo ./internal/cache
+func BenchmarkStoreUserInfo(b *testing.B) {
+	ctx := context.Background()
+	user := &tgbotapi.User{ID: benchUserID, FirstName: "Bench", LastName: "User", UserName: "bench_user"}
+
+	b.Run("sequential", func(b *testing.B) {
+		rc := newBenchClient(b)
+		for i := 0; i < b.N; i++ {
+			if err := storeUserInfoSequential(ctx, rc, user); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pipelined", func(b *testing.B) {
+		rc := newBenchClient(b)
+		for i := 0; i < b.N; i++ {
+			// 每次修改昵称，使本地缓存不命中，测量的是管道写入本身
+			changed := *user
+			changed.FirstName = "Bench" + strconv.Itoa(i%2)
+			if err := rc.StoreUserInfo(ctx, &changed); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("unchanged", func(b *testing.B) {
+		rc := newBenchClient(b)
+		for i := 0; i < b.N; i++ {
+			if err := rc.StoreUserInfo(ctx, user); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func repeatKey(userID int64, digest string) string {
+	return fmt.Sprintf("repeat:%d:%s", userID, digest)
+}
+
+// CountRepeat 记录用户在 window 内（从第一次发送起计算）又发送了一次内容摘要为 digest 的消息，返回发送次数
+func (rc *RedisClient) CountRepeat(ctx context.Context, userID int64, digest string, window time.Duration) (int64, error) {
+	key := repeatKey(userID, digest)
+	count, err := rc.rdb.HIncrBy(ctx, key, "count", 1).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		err = rc.rdb.Expire(ctx, key, window).Err()
+	}
+	return count, err
+}
+
+// SetRepeatHeader 记录该内容转发给客服时的标题消息及其原始文本，重复发送时在该标题上标注次数
+func (rc *RedisClient) SetRepeatHeader(ctx context.Context, userID int64, digest string, chatID int64, headerID int, text string) error {
+	return rc.rdb.HSet(ctx, repeatKey(userID, digest), "chat", chatID, "header", headerID, "text", text).Err()
+}
+
+// GetRepeatHeader 获取该内容转发时的标题消息，尚未转发或已过期时 headerID 为 0
+func (rc *RedisClient) GetRepeatHeader(ctx context.Context, userID int64, digest string) (chatID int64, headerID int, text string, err error) {
+	vals, err := rc.rdb.HMGet(ctx, repeatKey(userID, digest), "chat", "header", "text").Result()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if s, ok := vals[0].(string); ok {
+		chatID, _ = strconv.ParseInt(s, 10, 64)
+	}
+	if s, ok := vals[1].(string); ok {
+		headerID, _ = strconv.Atoi(s)
+	}
+	if s, ok := vals[2].(string); ok {
+		text = s
+	}
+	return chatID, headerID, text, nil
+}
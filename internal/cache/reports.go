@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 每日统计的字段
+const (
+	DailyNewUsers         = "new_users"         // 新增用户
+	DailyMessagesReceived = "messages_received" // 收到的用户消息
+	DailyMessagesAnswered = "messages_answered" // 客服回复的消息
+	DailyBlocks           = "blocks"            // 拉黑的用户
+	DailyBroadcasts       = "broadcasts"        // 发送完成或停止的广播
+	DailyResponses        = "responses"         // 计入响应时间的客服首次回复
+	DailyResponseSeconds  = "response_seconds"  // 首次回复的等待时间之和（秒）
+	ResponseWaitingKey    = "response_waiting"  // ZSet：等待客服回复的用户，分数为最早一条未回复消息的时间
+	dailyStatsRetention   = 60 * 24 * time.Hour // 每日统计保留时间
+	reportSentRetention   = 8 * 24 * time.Hour  // 报告发送记录保留时间，需覆盖一周
+)
+
+// DailyStatFields 是每日统计字段的展示顺序
+var DailyStatFields = []string{DailyNewUsers, DailyMessagesReceived, DailyMessagesAnswered, DailyBlocks, DailyBroadcasts}
+
+// dailyStatsKey 返回某天（本地时间）的统计 Hash，例如 daily_stats:2024-01-31
+func dailyStatsKey(day time.Time) string {
+	return "daily_stats:" + day.Format("2006-01-02")
+}
+
+// dailyActiveKey 返回某天每位用户发送消息数的 ZSet
+func dailyActiveKey(day time.Time) string {
+	return "daily_active:" + day.Format("2006-01-02")
+}
+
+// recordResponse 用户在等待回复时，计算等待时间并计入当天的响应统计和回复客服的统计，返回等待秒数，不在等待中时返回 -1
+var recordResponse = redis.NewScript(`
+local since = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not since then
+	return -1
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local wait = math.max(tonumber(ARGV[2]) - tonumber(since), 0)
+redis.call('HINCRBY', KEYS[2], ARGV[4], 1)
+redis.call('HINCRBY', KEYS[2], ARGV[5], wait)
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+redis.call('HINCRBY', KEYS[3], ARGV[6], 1)
+redis.call('HINCRBY', KEYS[3], ARGV[7], wait)
+redis.call('EXPIRE', KEYS[3], ARGV[3])
+return wait`)
+
+// IncrDailyStat 将今天的统计字段加一
+func (rc *RedisClient) IncrDailyStat(ctx context.Context, field string) error {
+	key := dailyStatsKey(time.Now())
+	pipe := rc.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, key, field, 1)
+	pipe.Expire(ctx, key, dailyStatsRetention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RecordInboundMessage 记录一条用户消息：计入当天收到的消息数和该用户当天的消息数，
+// 并在用户尚未等待回复时开始计算响应时间
+func (rc *RedisClient) RecordInboundMessage(ctx context.Context, userID int64, at time.Time) error {
+	user := strconv.FormatInt(userID, 10)
+	statsKey, activeKey := dailyStatsKey(at), dailyActiveKey(at)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, statsKey, DailyMessagesReceived, 1)
+	pipe.Expire(ctx, statsKey, dailyStatsRetention)
+	pipe.ZIncrBy(ctx, activeKey, 1, user)
+	pipe.Expire(ctx, activeKey, dailyStatsRetention)
+	pipe.ZAddNX(ctx, ResponseWaitingKey, redis.Z{Score: float64(at.Unix()), Member: user})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RecordAnswer 记录客服 adminID 的一条回复：计入当天回复的消息数和该客服的回复数，用户在等待回复时同时记录响应时间。
+// waited 为用户等待的时间，ok 为 false 表示用户此前没有未回复的消息
+func (rc *RedisClient) RecordAnswer(ctx context.Context, adminID, userID int64, at time.Time) (waited time.Duration, ok bool, err error) {
+	if err := rc.IncrDailyStat(ctx, DailyMessagesAnswered); err != nil {
+		return 0, false, err
+	}
+	if err := rc.incrOperatorStat(ctx, adminID, OperatorReplies, 1, at); err != nil {
+		return 0, false, err
+	}
+	keys := []string{ResponseWaitingKey, dailyStatsKey(at), operatorStatsKey(at)}
+	args := []interface{}{strconv.FormatInt(userID, 10), at.Unix(), int64(dailyStatsRetention.Seconds()), DailyResponses, DailyResponseSeconds,
+		operatorField(adminID, OperatorResponses), operatorField(adminID, OperatorResponseSeconds)}
+	seconds, err := recordResponse.Run(ctx, rc.rdb, keys, args...).Int64()
+	if err != nil || seconds < 0 {
+		return 0, false, err
+	}
+	return time.Duration(seconds) * time.Second, true, nil
+}
+
+// ClearResponseWait 会话未经回复就被解决时，停止计算该用户的响应时间
+func (rc *RedisClient) ClearResponseWait(ctx context.Context, userID int64) error {
+	return rc.rdb.ZRem(ctx, ResponseWaitingKey, strconv.FormatInt(userID, 10)).Err()
+}
+
+// GetDailyStats 返回某天的统计（包括 DailyStatFields 和响应时间字段），没有记录的字段为 0
+func (rc *RedisClient) GetDailyStats(ctx context.Context, day time.Time) (map[string]int64, error) {
+	vals, err := rc.rdb.HGetAll(ctx, dailyStatsKey(day)).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]int64, len(DailyStatFields)+2)
+	for _, field := range append([]string{DailyResponses, DailyResponseSeconds}, DailyStatFields...) {
+		stats[field], _ = strconv.ParseInt(vals[field], 10, 64)
+	}
+	return stats, nil
+}
+
+// UserActivity 是一位用户在一段时间内发送的消息数
+type UserActivity struct {
+	UserID   int64
+	Messages int64
+}
+
+// GetTopActiveUsers 返回截至 last 的 days 天内发送消息最多的 n 位用户
+func (rc *RedisClient) GetTopActiveUsers(ctx context.Context, last time.Time, days, n int) ([]UserActivity, error) {
+	keys := make([]string, days)
+	for i := range keys {
+		keys[i] = dailyActiveKey(last.AddDate(0, 0, -i))
+	}
+	// 汇总结果写入临时键，短时间后自动删除
+	dest := fmt.Sprintf("daily_active:top:%s:%d", last.Format("2006-01-02"), days)
+	pipe := rc.rdb.TxPipeline()
+	pipe.ZUnionStore(ctx, dest, &redis.ZStore{Keys: keys})
+	top := pipe.ZRevRangeWithScores(ctx, dest, 0, int64(n-1))
+	pipe.Expire(ctx, dest, time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	users := make([]UserActivity, 0, len(top.Val()))
+	for _, z := range top.Val() {
+		member, _ := z.Member.(string)
+		userID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		users = append(users, UserActivity{UserID: userID, Messages: int64(z.Score)})
+	}
+	return users, nil
+}
+
+// MarkReportSent 记录某个周期的报告已发送，返回 false 表示此前已经发送过（如重启后）
+func (rc *RedisClient) MarkReportSent(ctx context.Context, kind, period string) (bool, error) {
+	return rc.rdb.SetNX(ctx, "report_sent:"+kind+":"+period, 1, reportSentRetention).Result()
+}
+
+// GetResponseWaiting 按等待时间从长到短返回从 offset 开始的 count 位等待客服回复的用户，以及等待中的总人数
+func (rc *RedisClient) GetResponseWaiting(ctx context.Context, offset, count int64) ([]AwaitingReply, int64, error) {
+	pipe := rc.rdb.TxPipeline()
+	entries := pipe.ZRangeWithScores(ctx, ResponseWaitingKey, offset, offset+count-1)
+	total := pipe.ZCard(ctx, ResponseWaitingKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, 0, err
+	}
+	waiting := make([]AwaitingReply, 0, len(entries.Val()))
+	for _, entry := range entries.Val() {
+		member, _ := entry.Member.(string)
+		userID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		waiting = append(waiting, AwaitingReply{UserID: userID, Since: time.Unix(int64(entry.Score), 0)})
+	}
+	return waiting, total.Val(), nil
+}
+
+// ClearResponseWaitBetween 停止计算等待开始时间在 [from, to] 内的所有用户的响应时间，返回这些用户的 ID
+func (rc *RedisClient) ClearResponseWaitBetween(ctx context.Context, from, to time.Time) ([]int64, error) {
+	members, err := rc.rdb.ZRangeByScore(ctx, ResponseWaitingKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	args := make([]interface{}, len(members))
+	userIDs := make([]int64, 0, len(members))
+	for i, member := range members {
+		args[i] = member
+		if userID, err := strconv.ParseInt(member, 10, 64); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, rc.rdb.ZRem(ctx, ResponseWaitingKey, args...).Err()
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ForwardRoutesKey = "forward_routes"    // 转发路由规则 Hash：字段为规则 ID，值为规则内容（JSON）
+	forwardRouteSeq  = "forward_route_seq" // 转发路由规则 ID 自增计数器
+	routeCounterKey  = "route_rr"          // Hash：规则 ID -> 轮流分配的计数
+)
+
+// routeAssignKey 返回记录某条规则下用户分配到哪个会话的 Hash
+func routeAssignKey(routeID string) string {
+	return "route_assign:" + routeID
+}
+
+// assignRoute 用户已分配且该会话仍在规则中时沿用原会话，否则轮流分配下一个会话
+var assignRoute = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1])
+if current then
+	for i = 3, #ARGV do
+		if ARGV[i] == current then
+			return current
+		end
+	end
+end
+local n = redis.call('HINCRBY', KEYS[2], ARGV[2], 1)
+local target = ARGV[3 + (n - 1) % (#ARGV - 2)]
+redis.call('HSET', KEYS[1], ARGV[1], target)
+return target`)
+
+// AddForwardRoute 保存一条转发路由规则，返回新规则的 ID
+func (rc *RedisClient) AddForwardRoute(ctx context.Context, payload string) (string, error) {
+	seq, err := rc.rdb.Incr(ctx, forwardRouteSeq).Result()
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(seq, 10)
+	return id, rc.rdb.HSet(ctx, ForwardRoutesKey, id, payload).Err()
+}
+
+// GetForwardRoutes 获取所有转发路由规则
+func (rc *RedisClient) GetForwardRoutes(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, ForwardRoutesKey).Result()
+}
+
+// DeleteForwardRoute 删除转发路由规则及其分配记录，返回规则是否存在
+func (rc *RedisClient) DeleteForwardRoute(ctx context.Context, id string) (bool, error) {
+	pipe := rc.rdb.TxPipeline()
+	del := pipe.HDel(ctx, ForwardRoutesKey, id)
+	pipe.Del(ctx, routeAssignKey(id))
+	pipe.HDel(ctx, routeCounterKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return del.Val() > 0, nil
+}
+
+// AssignRouteTarget 为用户在规则的多个会话中选择一个：已分配过的用户固定由同一会话处理，新用户轮流分配
+func (rc *RedisClient) AssignRouteTarget(ctx context.Context, routeID string, userID int64, targets []int64) (int64, error) {
+	args := make([]interface{}, 0, len(targets)+2)
+	args = append(args, userID, routeID)
+	for _, target := range targets {
+		args = append(args, target)
+	}
+	keys := []string{routeAssignKey(routeID), routeCounterKey}
+	target, err := assignRoute.Run(ctx, rc.rdb, keys, args...).Text()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(target, 10, 64)
+}
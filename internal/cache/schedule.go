@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const ScheduledBroadcastsKey = "scheduled_broadcasts" // Sorted Set：成员为广播 ID，分数为发送时间（Unix 秒）
+
+// ScheduledEntry 表示定时广播队列中的一项
+type ScheduledEntry struct {
+	ID     string
+	SendAt time.Time
+}
+
+func scheduledBroadcastKey(id string) string {
+	return fmt.Sprintf("scheduled_broadcast:%s", id)
+}
+
+// AddScheduledBroadcast 保存广播内容并按发送时间加入定时队列
+func (rc *RedisClient) AddScheduledBroadcast(ctx context.Context, id string, sendAt time.Time, payload string) error {
+	err := rc.rdb.Set(ctx, scheduledBroadcastKey(id), payload, 0).Err()
+	if err != nil {
+		return err
+	}
+	return rc.rdb.ZAdd(ctx, ScheduledBroadcastsKey, redis.Z{Score: float64(sendAt.Unix()), Member: id}).Err()
+}
+
+// GetScheduledBroadcasts 按发送时间顺序返回所有待发送的定时广播
+func (rc *RedisClient) GetScheduledBroadcasts(ctx context.Context) ([]ScheduledEntry, error) {
+	items, err := rc.rdb.ZRangeWithScores(ctx, ScheduledBroadcastsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ScheduledEntry, 0, len(items))
+	for _, item := range items {
+		id, _ := item.Member.(string)
+		entries = append(entries, ScheduledEntry{ID: id, SendAt: time.Unix(int64(item.Score), 0)})
+	}
+	return entries, nil
+}
+
+// GetDueScheduledBroadcastIDs 返回发送时间不晚于 now 的定时广播 ID
+func (rc *RedisClient) GetDueScheduledBroadcastIDs(ctx context.Context, now time.Time) ([]string, error) {
+	return rc.rdb.ZRangeByScore(ctx, ScheduledBroadcastsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+}
+
+// GetScheduledBroadcastPayload 获取定时广播的内容，不存在时返回空字符串
+func (rc *RedisClient) GetScheduledBroadcastPayload(ctx context.Context, id string) (string, error) {
+	val, err := rc.rdb.Get(ctx, scheduledBroadcastKey(id)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, err
+}
+
+// IsBroadcastScheduled 检查定时广播是否仍在队列中
+func (rc *RedisClient) IsBroadcastScheduled(ctx context.Context, id string) (bool, error) {
+	_, err := rc.rdb.ZScore(ctx, ScheduledBroadcastsKey, id).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClaimScheduledBroadcast 将定时广播移出队列。返回 false 表示已被调度器或其他管理员取走，
+// 调用方据此避免重复发送或取消已发送的广播。
+func (rc *RedisClient) ClaimScheduledBroadcast(ctx context.Context, id string) (bool, error) {
+	removed, err := rc.rdb.ZRem(ctx, ScheduledBroadcastsKey, id).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// DeleteScheduledBroadcastPayload 删除定时广播的内容
+func (rc *RedisClient) DeleteScheduledBroadcastPayload(ctx context.Context, id string) error {
+	return rc.rdb.Del(ctx, scheduledBroadcastKey(id)).Err()
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	SearchMessagesKey = "search_messages" // Hash：消息 ID -> 已索引的消息（JSON）
+	SearchTimelineKey = "search_timeline" // ZSet：消息 ID，分数为消息时间（Unix 秒），用于清理过期索引
+	searchSeq         = "search_seq"      // 已索引消息 ID 自增计数器
+
+	SearchRetention  = 90 * 24 * time.Hour // 索引保留时间，超过后不再能被搜索到
+	searchPruneBatch = 100                 // 每次写入索引时最多清理的过期消息数
+)
+
+func searchTokenKey(token string) string {
+	return "search:" + token
+}
+
+// IndexedMessage 是搜索索引中的一条消息
+type IndexedMessage struct {
+	ID        string    `json:"-"`
+	UserID    int64     `json:"user"`
+	At        time.Time `json:"at"`
+	Direction string    `json:"dir"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	Tokens    []string  `json:"tokens"` // 该消息写入的词项，清理时用于从倒排索引中移除
+}
+
+// IndexMessage 将消息写入倒排索引（每个词项一个 Set），并顺带清理超过 SearchRetention 的旧消息
+func (rc *RedisClient) IndexMessage(ctx context.Context, msg IndexedMessage) error {
+	if len(msg.Tokens) == 0 {
+		return nil
+	}
+	seq, err := rc.rdb.Incr(ctx, searchSeq).Result()
+	if err != nil {
+		return err
+	}
+	id := strconv.FormatInt(seq, 10)
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, SearchMessagesKey, id, payload)
+	pipe.ZAdd(ctx, SearchTimelineKey, redis.Z{Score: float64(msg.At.Unix()), Member: id})
+	for _, token := range msg.Tokens {
+		pipe.SAdd(ctx, searchTokenKey(token), id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return rc.pruneSearchIndex(ctx, time.Now().Add(-SearchRetention))
+}
+
+// pruneSearchIndex 从索引中移除 before 之前的消息，每次最多 searchPruneBatch 条
+func (rc *RedisClient) pruneSearchIndex(ctx context.Context, before time.Time) error {
+	ids, err := rc.rdb.ZRangeByScore(ctx, SearchTimelineKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(before.Unix(), 10),
+		Count: searchPruneBatch,
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	payloads, err := rc.rdb.HMGet(ctx, SearchMessagesKey, ids...).Result()
+	if err != nil {
+		return err
+	}
+	pipe := rc.rdb.TxPipeline()
+	for i, id := range ids {
+		if s, ok := payloads[i].(string); ok {
+			var msg IndexedMessage
+			if json.Unmarshal([]byte(s), &msg) == nil {
+				for _, token := range msg.Tokens {
+					pipe.SRem(ctx, searchTokenKey(token), id)
+				}
+			}
+		}
+		pipe.HDel(ctx, SearchMessagesKey, id)
+		pipe.ZRem(ctx, SearchTimelineKey, id)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SearchMessages 返回包含所有词项的消息，顺序不固定
+func (rc *RedisClient) SearchMessages(ctx context.Context, tokens []string) ([]IndexedMessage, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		keys = append(keys, searchTokenKey(token))
+	}
+	ids, err := rc.rdb.SInter(ctx, keys...).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	payloads, err := rc.rdb.HMGet(ctx, SearchMessagesKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]IndexedMessage, 0, len(ids))
+	for i, id := range ids {
+		s, ok := payloads[i].(string)
+		if !ok {
+			continue
+		}
+		var msg IndexedMessage
+		if err := json.Unmarshal([]byte(s), &msg); err != nil {
+			continue
+		}
+		msg.ID = id
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
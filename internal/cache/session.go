@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AdminSessionTTL 管理员未完成的操作（状态、广播草稿等）在 Redis 中的保留时间
+const AdminSessionTTL = 7 * 24 * time.Hour
+
+func adminSessionKey(chatID int64) string {
+	return fmt.Sprintf("admin_session:%d", chatID)
+}
+
+// AdminSession 是管理员会话中需要跨重启保留的内容
+type AdminSession struct {
+	State          int    // 当前操作状态
+	BroadcastDraft string // 广播草稿（JSON），为空表示没有草稿
+	TopicEdit      string // 正在编辑欢迎语的入口主题
+	ActiveAt       int64  // 最后一次操作的 Unix 时间，用于超时自动取消
+}
+
+// SaveAdminSession 保存管理员会话；会话为空时删除记录
+func (rc *RedisClient) SaveAdminSession(ctx context.Context, chatID int64, session AdminSession) error {
+	key := adminSessionKey(chatID)
+	if session == (AdminSession{}) {
+		return rc.rdb.Del(ctx, key).Err()
+	}
+	pipe := rc.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key,
+		"state", strconv.Itoa(session.State),
+		"broadcast_draft", session.BroadcastDraft,
+		"topic_edit", session.TopicEdit,
+		"active_at", strconv.FormatInt(session.ActiveAt, 10),
+	)
+	pipe.Expire(ctx, key, AdminSessionTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetAdminSession 读取管理员会话，不存在时返回零值
+func (rc *RedisClient) GetAdminSession(ctx context.Context, chatID int64) (AdminSession, error) {
+	var session AdminSession
+	vals, err := rc.rdb.HGetAll(ctx, adminSessionKey(chatID)).Result()
+	if err == redis.Nil {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	session.State, _ = strconv.Atoi(vals["state"])
+	session.BroadcastDraft = vals["broadcast_draft"]
+	session.TopicEdit = vals["topic_edit"]
+	session.ActiveAt, _ = strconv.ParseInt(vals["active_at"], 10, 64)
+	return session, nil
+}
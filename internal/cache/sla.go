@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	SLAWaitingKey   = "sla_waiting"   // 有未回复消息的用户 ZSet，分值为最早一条未回复消息的时间
+	SLARemindersKey = "sla_reminders" // Hash：用户 ID -> 已发送的提醒次数
+)
+
+// MarkAwaitingReply 记录用户有消息等待回复，已在等待中时保留最早的时间
+func (rc *RedisClient) MarkAwaitingReply(ctx context.Context, userID int64, at time.Time) error {
+	return rc.rdb.ZAddNX(ctx, SLAWaitingKey, redis.Z{Score: float64(at.Unix()), Member: strconv.FormatInt(userID, 10)}).Err()
+}
+
+// ClearAwaitingReply 用户的消息已被回复（或会话已解决），清除等待记录和提醒次数
+func (rc *RedisClient) ClearAwaitingReply(ctx context.Context, userID int64) error {
+	user := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	pipe.ZRem(ctx, SLAWaitingKey, user)
+	pipe.HDel(ctx, SLARemindersKey, user)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AwaitingReply 是一位等待回复的用户
+type AwaitingReply struct {
+	UserID    int64
+	Since     time.Time // 最早一条未回复消息的时间
+	Reminders int       // 已发送的提醒次数
+}
+
+// GetAwaitingReplies 获取等待时间早于 before 的所有用户
+func (rc *RedisClient) GetAwaitingReplies(ctx context.Context, before time.Time) ([]AwaitingReply, error) {
+	entries, err := rc.rdb.ZRangeByScoreWithScores(ctx, SLAWaitingKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(before.Unix(), 10),
+	}).Result()
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	users := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		users = append(users, entry.Member.(string))
+	}
+	counts, err := rc.rdb.HMGet(ctx, SLARemindersKey, users...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := make([]AwaitingReply, 0, len(entries))
+	for i, entry := range entries {
+		userID, _ := strconv.ParseInt(users[i], 10, 64)
+		item := AwaitingReply{UserID: userID, Since: time.Unix(int64(entry.Score), 0)}
+		if s, ok := counts[i].(string); ok {
+			item.Reminders, _ = strconv.Atoi(s)
+		}
+		waiting = append(waiting, item)
+	}
+	return waiting, nil
+}
+
+// IncrSLAReminders 增加用户的提醒次数，返回新的次数
+func (rc *RedisClient) IncrSLAReminders(ctx context.Context, userID int64) (int, error) {
+	n, err := rc.rdb.HIncrBy(ctx, SLARemindersKey, strconv.FormatInt(userID, 10), 1).Result()
+	return int(n), err
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sourceField     = "source"      // 用户首次通过深度链接进入时携带的来源参数
+	lastSourceField = "last_source" // 用户最近一次通过深度链接进入时携带的来源参数
+
+	StartSourcesKey = "start_sources" // Hash：来源参数 -> 以该来源首次进入的用户数
+)
+
+// recordSource 只在用户还没有来源时写入首次来源并增加该来源的计数，保证计数与用户记录一致
+var recordSource = redis.NewScript(`
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[3]) == 1 then
+	redis.call('HINCRBY', KEYS[2], ARGV[3], 1)
+	return 1
+end
+return 0`)
+
+// RecordUserSource 记录用户通过 "/start <来源>" 进入时的来源参数。
+// 首次来源只记录一次并计入来源统计，first 表示这是该用户的首次来源；最近来源每次都会更新。
+func (rc *RedisClient) RecordUserSource(ctx context.Context, userID int64, source string) (first bool, err error) {
+	keys := []string{fmt.Sprintf("user:%d", userID), StartSourcesKey}
+	n, err := recordSource.Run(ctx, rc.rdb, keys, sourceField, lastSourceField, source).Int()
+	return n == 1, err
+}
+
+// GetSourceSignups 返回每个来源首次进入的用户数
+func (rc *RedisClient) GetSourceSignups(ctx context.Context) (map[string]int64, error) {
+	vals, err := rc.rdb.HGetAll(ctx, StartSourcesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(vals))
+	for source, val := range vals {
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			continue
+		}
+		counts[source] = n
+	}
+	return counts, nil
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	UnreachableUsersSet = "bot_blocked_users" // 广播时发现已屏蔽机器人的用户
+
+	StatsTotalUsersKey       = "stats:total_users"
+	StatsBlockedUsersKey     = "stats:blocked_users"
+	StatsOptOutUsersKey      = "stats:optout_users"
+	StatsUnreachableUsersKey = "stats:unreachable_users"
+	StatsReachableUsersKey   = "stats:reachable_users" // 可送达广播的用户数：在用户集合中，且未退订、未屏蔽机器人
+
+	reachableRecountKey = "stats:reachable_recount" // 重建可送达计数时的临时集合
+)
+
+// StatsCounters 是 /stats 使用的计数器快照
+type StatsCounters struct {
+	Total       int64
+	Blocked     int64
+	OptOut      int64
+	Unreachable int64
+	Reachable   int64
+}
+
+// countedUpdate 对集合执行 SADD 或 SREM（ARGV[1]），仅在成员确实新增或移除时调整计数器，保证两者一致。
+// 同时比较每位用户变化前后是否可送达广播（在用户集合中，且未退订、未屏蔽机器人），据此调整可送达计数器。
+// KEYS：集合、计数器、用户集合、退订集合、不可达集合、可送达计数器；ARGV[2:] 为用户 ID
+var countedUpdate = redis.NewScript(`
+local function reachable(id)
+	return redis.call('SISMEMBER', KEYS[3], id) == 1
+		and redis.call('SISMEMBER', KEYS[4], id) == 0
+		and redis.call('SISMEMBER', KEYS[5], id) == 0
+end
+local changed, delta = 0, 0
+for i = 2, #ARGV do
+	local before = reachable(ARGV[i])
+	if redis.call(ARGV[1], KEYS[1], ARGV[i]) == 1 then
+		changed = changed + 1
+		local after = reachable(ARGV[i])
+		if before and not after then
+			delta = delta - 1
+		elseif after and not before then
+			delta = delta + 1
+		end
+	end
+end
+if changed > 0 then
+	if ARGV[1] == 'SADD' then
+		redis.call('INCRBY', KEYS[2], changed)
+	else
+		redis.call('DECRBY', KEYS[2], changed)
+	end
+	redis.call('INCRBY', KEYS[6], delta)
+end
+return changed`)
+
+// runCounted 对集合执行 op（SADD 或 SREM）并同步调整计数器，返回实际新增或移除的成员数
+func (rc *RedisClient) runCounted(ctx context.Context, op, set, counter string, members ...interface{}) (int, error) {
+	keys := []string{set, counter, UsersSetKey, OptOutUsersSet, UnreachableUsersSet, StatsReachableUsersKey}
+	return countedUpdate.Run(ctx, rc.rdb, keys, append([]interface{}{op}, members...)...).Int()
+}
+
+// counterSets 记录每个计数器对应的权威集合，用于重建计数
+var counterSets = map[string]string{
+	StatsTotalUsersKey:       UsersSetKey,
+	StatsBlockedUsersKey:     BlockedUsersSet,
+	StatsOptOutUsersKey:      OptOutUsersSet,
+	StatsUnreachableUsersKey: UnreachableUsersSet,
+}
+
+// addCounted 将用户加入集合，新增时同步增加计数器，返回是否为新增
+func (rc *RedisClient) addCounted(ctx context.Context, set, counter string, userID int64) (bool, error) {
+	added, err := rc.runCounted(ctx, "SADD", set, counter, strconv.FormatInt(userID, 10))
+	return added == 1, err
+}
+
+// importBatchSize 批量导入时每个脚本调用加入的用户数，避免单次调用参数过多
+const importBatchSize = 500
+
+// addCountedMany 将一批用户加入集合并同步增加计数器，返回新增的用户数
+func (rc *RedisClient) addCountedMany(ctx context.Context, set, counter string, userIDs []int64) (int, error) {
+	added := 0
+	for start := 0; start < len(userIDs); start += importBatchSize {
+		batch := userIDs[start:min(start+importBatchSize, len(userIDs))]
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = strconv.FormatInt(id, 10)
+		}
+		n, err := rc.runCounted(ctx, "SADD", set, counter, args...)
+		if err != nil {
+			return added, err
+		}
+		added += n
+	}
+	return added, nil
+}
+
+// ImportUsers 将一批用户加入用户集合，返回新增的用户数
+func (rc *RedisClient) ImportUsers(ctx context.Context, userIDs []int64) (int, error) {
+	return rc.addCountedMany(ctx, UsersSetKey, StatsTotalUsersKey, userIDs)
+}
+
+// ImportBlockedUsers 将一批用户加入黑名单，返回新增的用户数
+func (rc *RedisClient) ImportBlockedUsers(ctx context.Context, userIDs []int64) (int, error) {
+	return rc.addCountedMany(ctx, BlockedUsersSet, StatsBlockedUsersKey, userIDs)
+}
+
+// removeCounted 将用户移出集合，移除时同步减少计数器，返回是否确实移除
+func (rc *RedisClient) removeCounted(ctx context.Context, set, counter string, userID int64) (bool, error) {
+	removed, err := rc.runCounted(ctx, "SREM", set, counter, strconv.FormatInt(userID, 10))
+	return removed == 1, err
+}
+
+// AddUnreachableUser 记录已屏蔽机器人的用户
+func (rc *RedisClient) AddUnreachableUser(ctx context.Context, userID int64) error {
+	_, err := rc.addCounted(ctx, UnreachableUsersSet, StatsUnreachableUsersKey, userID)
+	return err
+}
+
+// RemoveUnreachableUser 用户重新与机器人互动后，将其移出不可达用户集合
+func (rc *RedisClient) RemoveUnreachableUser(ctx context.Context, userID int64) (bool, error) {
+	return rc.removeCounted(ctx, UnreachableUsersSet, StatsUnreachableUsersKey, userID)
+}
+
+// IsUnreachableUser 检查用户是否已屏蔽机器人
+func (rc *RedisClient) IsUnreachableUser(ctx context.Context, userID int64) (bool, error) {
+	return rc.rdb.SIsMember(ctx, UnreachableUsersSet, strconv.FormatInt(userID, 10)).Result()
+}
+
+// GetUnreachableUserIDs 获取所有已屏蔽机器人的用户ID
+func (rc *RedisClient) GetUnreachableUserIDs(ctx context.Context) ([]string, error) {
+	return rc.rdb.SMembers(ctx, UnreachableUsersSet).Result()
+}
+
+// ClearUnreachableUsers 清空不可达用户集合及其计数器，并重建可送达计数
+func (rc *RedisClient) ClearUnreachableUsers(ctx context.Context) error {
+	pipe := rc.rdb.TxPipeline()
+	pipe.Del(ctx, UnreachableUsersSet)
+	pipe.Set(ctx, StatsUnreachableUsersKey, 0, 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	_, err := rc.recountReachable(ctx)
+	return err
+}
+
+// GetStatsCounters 读取所有统计计数器
+func (rc *RedisClient) GetStatsCounters(ctx context.Context) (StatsCounters, error) {
+	var counters StatsCounters
+	vals, err := rc.rdb.MGet(ctx, StatsTotalUsersKey, StatsBlockedUsersKey, StatsOptOutUsersKey, StatsUnreachableUsersKey, StatsReachableUsersKey).Result()
+	if err != nil {
+		return counters, err
+	}
+	targets := []*int64{&counters.Total, &counters.Blocked, &counters.OptOut, &counters.Unreachable, &counters.Reachable}
+	for i, val := range vals {
+		if s, ok := val.(string); ok {
+			*targets[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return counters, nil
+}
+
+// RecountStats 根据权威集合重建所有计数器，用于计数漂移后的修复
+func (rc *RedisClient) RecountStats(ctx context.Context) (StatsCounters, error) {
+	for counter, set := range counterSets {
+		n, err := rc.rdb.SCard(ctx, set).Result()
+		if err != nil {
+			return StatsCounters{}, err
+		}
+		if err := rc.rdb.Set(ctx, counter, n, 0).Err(); err != nil {
+			return StatsCounters{}, err
+		}
+	}
+	if _, err := rc.recountReachable(ctx); err != nil {
+		return StatsCounters{}, err
+	}
+	return rc.GetStatsCounters(ctx)
+}
+
+// recountReachable 根据用户、退订和不可达集合重建可送达计数器
+func (rc *RedisClient) recountReachable(ctx context.Context) (int64, error) {
+	pipe := rc.rdb.TxPipeline()
+	n := pipe.SDiffStore(ctx, reachableRecountKey, UsersSetKey, OptOutUsersSet, UnreachableUsersSet)
+	pipe.Del(ctx, reachableRecountKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return n.Val(), rc.rdb.Set(ctx, StatsReachableUsersKey, n.Val(), 0).Err()
+}
+
+// CountReachableUsers 返回可送达广播的用户数，即全员广播实际会发送的人数
+func (rc *RedisClient) CountReachableUsers(ctx context.Context) (int64, error) {
+	n, err := rc.rdb.Get(ctx, StatsReachableUsersKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// EnsureStatsCounters 在计数器尚未初始化时（如从旧版本升级）从集合重建
+func (rc *RedisClient) EnsureStatsCounters(ctx context.Context) error {
+	exists, err := rc.rdb.Exists(ctx, StatsTotalUsersKey, StatsReachableUsersKey).Result()
+	if err != nil || exists == 2 {
+		return err
+	}
+	_, err = rc.RecountStats(ctx)
+	return err
+}
@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRecountReachableUsesPrefix(t *testing.T) {
+	rc, cmds := newRecordingClient(t, "bot1:")
+	if _, err := rc.recountReachable(context.Background()); err != nil {
+		t.Fatalf("recountReachable: %v", err)
+	}
+	want := []string{
+		"multi",
+		"sdiffstore bot1:stats:reachable_recount bot1:telegram_bot_users bot1:broadcast_optout bot1:bot_blocked_users",
+		"del bot1:stats:reachable_recount",
+		"exec",
+		"set bot1:stats:reachable_users 0",
+	}
+	if !reflect.DeepEqual(*cmds, want) {
+		t.Errorf("命令 = %q\n期望 %q", *cmds, want)
+	}
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func channelMemberKey(channel string, userID int64) string {
+	return fmt.Sprintf("channel_member:%s:%d", channel, userID)
+}
+
+// SetChannelMember 缓存用户是否已加入频道 channel，ttl 到期后需要重新查询
+func (rc *RedisClient) SetChannelMember(ctx context.Context, channel string, userID int64, member bool, ttl time.Duration) error {
+	val := "0"
+	if member {
+		val = "1"
+	}
+	return rc.rdb.Set(ctx, channelMemberKey(channel, userID), val, ttl).Err()
+}
+
+// GetChannelMember 返回缓存的频道成员状态，cached 为 false 表示没有缓存或已过期
+func (rc *RedisClient) GetChannelMember(ctx context.Context, channel string, userID int64) (member, cached bool, err error) {
+	val, err := rc.rdb.Get(ctx, channelMemberKey(channel, userID)).Result()
+	if err == redis.Nil {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return val == "1", true, nil
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TagsSetKey   = "tags" // 所有正在使用的标签名
+	MaxTagLength = 32     // 标签会出现在按钮回调数据中，需要限制长度
+)
+
+// tagPattern 标签只能包含小写字母、数字、下划线、连字符和中文
+var tagPattern = regexp.MustCompile(`^[\p{Han}a-z0-9_-]+$`)
+
+func userTagsKey(userID int64) string {
+	return fmt.Sprintf("user_tags:%d", userID)
+}
+
+func tagUsersKey(tag string) string {
+	return fmt.Sprintf("tag_users:%s", tag)
+}
+
+// NormalizeTag 将输入的标签（可带 #）转换为存储使用的小写形式，不合法时返回空字符串
+func NormalizeTag(input string) string {
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(input), "#"))
+	if tag == "" || len(tag) > MaxTagLength || !tagPattern.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
+
+// AddUserTag 为用户添加标签，返回是否为新增
+func (rc *RedisClient) AddUserTag(ctx context.Context, userID int64, tag string) (bool, error) {
+	user := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	added := pipe.SAdd(ctx, userTagsKey(userID), tag)
+	pipe.SAdd(ctx, tagUsersKey(tag), user)
+	pipe.SAdd(ctx, TagsSetKey, tag)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return added.Val() == 1, nil
+}
+
+// RemoveUserTag 移除用户的标签，标签不再有用户时从标签列表中删除，返回是否确实移除
+func (rc *RedisClient) RemoveUserTag(ctx context.Context, userID int64, tag string) (bool, error) {
+	user := strconv.FormatInt(userID, 10)
+	pipe := rc.rdb.TxPipeline()
+	removed := pipe.SRem(ctx, userTagsKey(userID), tag)
+	pipe.SRem(ctx, tagUsersKey(tag), user)
+	remaining := pipe.SCard(ctx, tagUsersKey(tag))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if remaining.Val() == 0 {
+		if err := rc.rdb.SRem(ctx, TagsSetKey, tag).Err(); err != nil {
+			return false, err
+		}
+	}
+	return removed.Val() == 1, nil
+}
+
+// GetUserTags 返回用户的所有标签（按名称排序）
+func (rc *RedisClient) GetUserTags(ctx context.Context, userID int64) ([]string, error) {
+	tags, err := rc.rdb.SMembers(ctx, userTagsKey(userID)).Result()
+	sort.Strings(tags)
+	return tags, err
+}
+
+// GetTagUserIDs 返回带有该标签的所有用户 ID
+func (rc *RedisClient) GetTagUserIDs(ctx context.Context, tag string) ([]string, error) {
+	return rc.rdb.SMembers(ctx, tagUsersKey(tag)).Result()
+}
+
+// GetUserIDsWithoutTag 返回所有用户中不带该标签的用户 ID
+func (rc *RedisClient) GetUserIDsWithoutTag(ctx context.Context, tag string) ([]string, error) {
+	return rc.rdb.SDiff(ctx, UsersSetKey, tagUsersKey(tag)).Result()
+}
+
+// GetTagCounts 返回所有标签及其用户数
+func (rc *RedisClient) GetTagCounts(ctx context.Context) (map[string]int64, error) {
+	tags, err := rc.rdb.SMembers(ctx, TagsSetKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := rc.rdb.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(tags))
+	for _, tag := range tags {
+		cmds[tag] = pipe.SCard(ctx, tagUsersKey(tag))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(tags))
+	for tag, cmd := range cmds {
+		counts[tag] = cmd.Val()
+	}
+	return counts, nil
+}
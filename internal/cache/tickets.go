@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	UserTicketsKey       = "user_tickets" // Hash：用户 ID -> 工单号
+	ticketSeq            = "ticket_seq"   // 工单号自增计数器
+	TicketMessagesLimit  = 20             // 每个工单保留的最近消息条数
+	ticketNumberBase     = 1000           // 工单号从 A1001 开始
+	ticketCreatedAtField = "created_at"
+)
+
+// 工单状态：用户发来消息后为 open，客服回复后为 pending（等待用户），标记已解决后为 closed
+const (
+	TicketStatusOpen    = "open"
+	TicketStatusPending = "pending"
+	TicketStatusClosed  = "closed"
+)
+
+// TicketStatuses 所有工单状态
+var TicketStatuses = []string{TicketStatusOpen, TicketStatusPending, TicketStatusClosed}
+
+// ticketStatusKey 是处于某状态的工单号集合
+func ticketStatusKey(status string) string {
+	return fmt.Sprintf("tickets:%s", status)
+}
+
+func ticketKey(id string) string {
+	return fmt.Sprintf("ticket:%s", id)
+}
+
+func ticketMessagesKey(id string) string {
+	return fmt.Sprintf("ticket:%s:messages", id)
+}
+
+// Ticket 是一位用户的会话工单
+type Ticket struct {
+	ID        string // 形如 A1024
+	UserID    int64
+	Status    string
+	CreatedAt time.Time
+}
+
+// NormalizeTicketID 将用户输入的工单号（如 "#a1024"）转换为存储使用的形式
+func NormalizeTicketID(input string) string {
+	return strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(input), "#"))
+}
+
+// GetOrCreateUserTicket 获取用户的工单，没有时创建一个新工单
+func (rc *RedisClient) GetOrCreateUserTicket(ctx context.Context, userID int64) (Ticket, error) {
+	user := strconv.FormatInt(userID, 10)
+	id, err := rc.rdb.HGet(ctx, UserTicketsKey, user).Result()
+	if err == nil {
+		ticket, _, err := rc.GetTicket(ctx, id)
+		return ticket, err
+	}
+	if err != redis.Nil {
+		return Ticket{}, err
+	}
+
+	seq, err := rc.rdb.Incr(ctx, ticketSeq).Result()
+	if err != nil {
+		return Ticket{}, err
+	}
+	ticket := Ticket{
+		ID:        fmt.Sprintf("A%d", ticketNumberBase+seq),
+		UserID:    userID,
+		Status:    TicketStatusOpen,
+		CreatedAt: time.Now(),
+	}
+	created, err := rc.rdb.HSetNX(ctx, UserTicketsKey, user, ticket.ID).Result()
+	if err != nil {
+		return Ticket{}, err
+	}
+	if !created {
+		// 并发创建时以先写入的工单为准
+		return rc.GetOrCreateUserTicket(ctx, userID)
+	}
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, ticketKey(ticket.ID),
+		"user_id", user,
+		"status", ticket.Status,
+		ticketCreatedAtField, strconv.FormatInt(ticket.CreatedAt.Unix(), 10),
+	)
+	pipe.SAdd(ctx, ticketStatusKey(ticket.Status), ticket.ID)
+	_, err = pipe.Exec(ctx)
+	return ticket, err
+}
+
+// GetUserTicketID 获取用户的工单号，没有工单时返回空字符串（不会创建新工单）
+func (rc *RedisClient) GetUserTicketID(ctx context.Context, userID int64) (string, error) {
+	id, err := rc.rdb.HGet(ctx, UserTicketsKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return id, err
+}
+
+// SetTicketStatus 更新工单状态，并同步维护各状态的工单集合
+func (rc *RedisClient) SetTicketStatus(ctx context.Context, id, status string) error {
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, ticketKey(id), "status", status)
+	for _, s := range TicketStatuses {
+		if s != status {
+			pipe.SRem(ctx, ticketStatusKey(s), id)
+		}
+	}
+	pipe.SAdd(ctx, ticketStatusKey(status), id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetTicketIDsByStatus 获取处于指定状态的所有工单号
+func (rc *RedisClient) GetTicketIDsByStatus(ctx context.Context, status string) ([]string, error) {
+	return rc.rdb.SMembers(ctx, ticketStatusKey(status)).Result()
+}
+
+// CountTicketsByStatus 统计各状态的工单数
+func (rc *RedisClient) CountTicketsByStatus(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64, len(TicketStatuses))
+	for _, status := range TicketStatuses {
+		n, err := rc.rdb.SCard(ctx, ticketStatusKey(status)).Result()
+		if err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, nil
+}
+
+// GetTicket 按工单号获取工单，不存在时 ok 为 false
+func (rc *RedisClient) GetTicket(ctx context.Context, id string) (ticket Ticket, ok bool, err error) {
+	vals, err := rc.rdb.HGetAll(ctx, ticketKey(id)).Result()
+	if err != nil || len(vals) == 0 {
+		return ticket, false, err
+	}
+	ticket.ID = id
+	ticket.UserID, _ = strconv.ParseInt(vals["user_id"], 10, 64)
+	ticket.Status = vals["status"]
+	if ts, err := strconv.ParseInt(vals[ticketCreatedAtField], 10, 64); err == nil {
+		ticket.CreatedAt = time.Unix(ts, 0)
+	}
+	return ticket, true, nil
+}
+
+// AddTicketMessage 记录工单的一条消息摘要，只保留最近 TicketMessagesLimit 条
+func (rc *RedisClient) AddTicketMessage(ctx context.Context, id, entry string) error {
+	pipe := rc.rdb.TxPipeline()
+	pipe.LPush(ctx, ticketMessagesKey(id), entry)
+	pipe.LTrim(ctx, ticketMessagesKey(id), 0, TicketMessagesLimit-1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetTicketMessages 获取工单最近的 n 条消息摘要，按时间从旧到新排列
+func (rc *RedisClient) GetTicketMessages(ctx context.Context, id string, n int) ([]string, error) {
+	entries, err := rc.rdb.LRange(ctx, ticketMessagesKey(id), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
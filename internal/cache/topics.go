@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ForumTopicsKey       = "forum_topics"        // Hash：用户 ID -> 论坛话题 ID
+	ForumTopicUsersKey   = "forum_topic_users"   // Hash：论坛话题 ID -> 用户 ID
+	ClosedForumTopicsSet = "forum_topics_closed" // 已关闭的论坛话题 ID
+)
+
+// SetUserForumTopic 记录用户与论坛话题的双向对应关系
+func (rc *RedisClient) SetUserForumTopic(ctx context.Context, userID int64, threadID int) error {
+	user := strconv.FormatInt(userID, 10)
+	thread := strconv.Itoa(threadID)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HSet(ctx, ForumTopicsKey, user, thread)
+	pipe.HSet(ctx, ForumTopicUsersKey, thread, user)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetUserForumTopic 获取用户对应的论坛话题 ID，不存在时返回 0
+func (rc *RedisClient) GetUserForumTopic(ctx context.Context, userID int64) (int, error) {
+	val, err := rc.rdb.HGet(ctx, ForumTopicsKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	threadID, _ := strconv.Atoi(val)
+	return threadID, nil
+}
+
+// GetForumTopicUser 获取论坛话题对应的用户 ID，不存在时返回 0
+func (rc *RedisClient) GetForumTopicUser(ctx context.Context, threadID int) (int64, error) {
+	val, err := rc.rdb.HGet(ctx, ForumTopicUsersKey, strconv.Itoa(threadID)).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	userID, _ := strconv.ParseInt(val, 10, 64)
+	return userID, nil
+}
+
+// DeleteUserForumTopic 删除用户与论坛话题的对应关系（话题已被删除时使用）
+func (rc *RedisClient) DeleteUserForumTopic(ctx context.Context, userID int64, threadID int) error {
+	thread := strconv.Itoa(threadID)
+	pipe := rc.rdb.TxPipeline()
+	pipe.HDel(ctx, ForumTopicsKey, strconv.FormatInt(userID, 10))
+	pipe.HDel(ctx, ForumTopicUsersKey, thread)
+	pipe.SRem(ctx, ClosedForumTopicsSet, thread)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetForumTopicClosed 记录论坛话题的关闭状态
+func (rc *RedisClient) SetForumTopicClosed(ctx context.Context, threadID int, closed bool) error {
+	if closed {
+		return rc.rdb.SAdd(ctx, ClosedForumTopicsSet, strconv.Itoa(threadID)).Err()
+	}
+	return rc.rdb.SRem(ctx, ClosedForumTopicsSet, strconv.Itoa(threadID)).Err()
+}
+
+// IsForumTopicClosed 检查论坛话题是否已被关闭
+func (rc *RedisClient) IsForumTopicClosed(ctx context.Context, threadID int) (bool, error) {
+	return rc.rdb.SIsMember(ctx, ClosedForumTopicsSet, strconv.Itoa(threadID)).Result()
+}
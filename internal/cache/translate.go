@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TranslateOffKey = "translate_off" // 关闭自动翻译的用户集合
+	UserLanguageKey = "user_language" // Hash：用户 ID -> 最近一条消息识别出的语言代码
+)
+
+// SetTranslateEnabled 开启或关闭与用户会话的自动翻译，状态未变化时返回 false
+func (rc *RedisClient) SetTranslateEnabled(ctx context.Context, userID int64, enabled bool) (bool, error) {
+	user := strconv.FormatInt(userID, 10)
+	var n int64
+	var err error
+	if enabled {
+		n, err = rc.rdb.SRem(ctx, TranslateOffKey, user).Result()
+	} else {
+		n, err = rc.rdb.SAdd(ctx, TranslateOffKey, user).Result()
+	}
+	return n > 0, err
+}
+
+// IsTranslateEnabled 检查与用户的会话是否开启自动翻译，默认开启
+func (rc *RedisClient) IsTranslateEnabled(ctx context.Context, userID int64) (bool, error) {
+	off, err := rc.rdb.SIsMember(ctx, TranslateOffKey, strconv.FormatInt(userID, 10)).Result()
+	return !off, err
+}
+
+// CountTranslateOff 返回关闭了自动翻译的会话数
+func (rc *RedisClient) CountTranslateOff(ctx context.Context) (int64, error) {
+	return rc.rdb.SCard(ctx, TranslateOffKey).Result()
+}
+
+// SetUserLanguage 记录用户使用的语言
+func (rc *RedisClient) SetUserLanguage(ctx context.Context, userID int64, lang string) error {
+	return rc.rdb.HSet(ctx, UserLanguageKey, strconv.FormatInt(userID, 10), lang).Err()
+}
+
+// GetUserLanguage 获取用户使用的语言，未记录时返回空字符串
+func (rc *RedisClient) GetUserLanguage(ctx context.Context, userID int64) (string, error) {
+	lang, err := rc.rdb.HGet(ctx, UserLanguageKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return lang, err
+}
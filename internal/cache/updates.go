@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// UpdateOffsetKey 长轮询时已处理完的最大连续更新 ID，重启后从下一条继续获取
+const UpdateOffsetKey = "update_offset"
+
+// GetUpdateOffset 读取保存的更新位置，未保存时返回 0
+func (rc *RedisClient) GetUpdateOffset(ctx context.Context) (int, error) {
+	value, err := rc.rdb.Get(ctx, UpdateOffsetKey).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// SetUpdateOffset 保存已处理完的最大连续更新 ID
+func (rc *RedisClient) SetUpdateOffset(ctx context.Context, updateID int) error {
+	return rc.rdb.Set(ctx, UpdateOffsetKey, updateID, 0).Err()
+}
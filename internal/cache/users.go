@@ -0,0 +1,315 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	firstSeenField  = "first_seen"  // 用户第一次发消息的时间（Unix 秒）
+	lastActiveField = "last_active" // 用户最后一次发消息的时间（Unix 秒）
+	UserNotesLimit  = 50            // 每位用户保留的备注条数
+
+	LastActiveZSetKey = "user_last_active"  // ZSet：用户 ID，分数为最后活跃时间（Unix 秒），用于按活跃度筛选广播对象
+	FirstSeenZSetKey  = "user_first_seen"   // ZSet：用户 ID，分数为首次联系时间（Unix 秒），用于统计新增用户
+	usernamesIndexed  = "usernames_indexed" // 用户名索引已根据全部用户资料建立的标记
+)
+
+// recordFirstSeen 在用户资料中补记首次联系时间（已有时保留），并以该时间加入首次联系 ZSet
+var recordFirstSeen = redis.NewScript(`
+redis.call('HSETNX', KEYS[1], ARGV[2], ARGV[3])
+local first = redis.call('HGET', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], 'NX', first, ARGV[1])`)
+
+func userNotesKey(userID int64) string {
+	return fmt.Sprintf("user_notes:%d", userID)
+}
+
+// UserProfile 是 Redis 中保存的用户资料
+type UserProfile struct {
+	FirstName  string
+	LastName   string
+	Username   string
+	FirstSeen  time.Time // 未记录时为零值
+	LastActive time.Time
+	Source     string // 首次通过深度链接进入时的来源参数，未记录时为空
+	LastSource string // 最近一次通过深度链接进入时的来源参数
+}
+
+// GetUserProfile 获取用户资料，ok 为 false 表示没有该用户的任何记录
+func (rc *RedisClient) GetUserProfile(ctx context.Context, userID int64) (profile UserProfile, ok bool, err error) {
+	vals, err := rc.rdb.HGetAll(ctx, fmt.Sprintf("user:%d", userID)).Result()
+	if err != nil || len(vals) == 0 {
+		return UserProfile{}, false, err
+	}
+	return profileFromHash(vals), true, nil
+}
+
+func profileFromHash(vals map[string]string) UserProfile {
+	return UserProfile{
+		FirstName:  vals["first_name"],
+		LastName:   vals["last_name"],
+		Username:   vals["username"],
+		FirstSeen:  parseUnix(vals[firstSeenField]),
+		LastActive: parseUnix(vals[lastActiveField]),
+		Source:     vals[sourceField],
+		LastSource: vals[lastSourceField],
+	}
+}
+
+// UserRecord 是导出用的完整用户记录
+type UserRecord struct {
+	UserID  int64
+	Profile UserProfile // 没有资料时为零值
+	Blocked bool
+	Tags    []string
+}
+
+// GetUserRecords 用一次管道读取一批用户的资料、拉黑状态和标签，无效的用户 ID 会被跳过
+func (rc *RedisClient) GetUserRecords(ctx context.Context, userIDs []string) ([]UserRecord, error) {
+	type pending struct {
+		userID  int64
+		profile *redis.MapStringStringCmd
+		blocked *redis.BoolCmd
+		tags    *redis.StringSliceCmd
+	}
+	pipe := rc.rdb.Pipeline()
+	cmds := make([]pending, 0, len(userIDs))
+	for _, idStr := range userIDs {
+		userID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		cmds = append(cmds, pending{
+			userID:  userID,
+			profile: pipe.HGetAll(ctx, "user:"+idStr),
+			blocked: pipe.SIsMember(ctx, BlockedUsersSet, idStr),
+			tags:    pipe.SMembers(ctx, userTagsKey(userID)),
+		})
+	}
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	records := make([]UserRecord, len(cmds))
+	for i, cmd := range cmds {
+		tags := cmd.tags.Val()
+		sort.Strings(tags)
+		records[i] = UserRecord{UserID: cmd.userID, Profile: profileFromHash(cmd.profile.Val()), Blocked: cmd.blocked.Val(), Tags: tags}
+	}
+	return records, nil
+}
+
+// FilterNonUsers 返回 userIDs 中不在用户集合里的 ID
+func (rc *RedisClient) FilterNonUsers(ctx context.Context, userIDs []string) ([]string, error) {
+	pipe := rc.rdb.Pipeline()
+	found := make([]*redis.BoolCmd, len(userIDs))
+	for i, id := range userIDs {
+		found[i] = pipe.SIsMember(ctx, UsersSetKey, id)
+	}
+	if len(userIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var rest []string
+	for i, cmd := range found {
+		if !cmd.Val() {
+			rest = append(rest, userIDs[i])
+		}
+	}
+	return rest, nil
+}
+
+// GetActiveUserIDs 返回 since 之后活跃过的用户 ID
+func (rc *RedisClient) GetActiveUserIDs(ctx context.Context, since time.Time) ([]string, error) {
+	return rc.rdb.ZRangeByScore(ctx, LastActiveZSetKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+}
+
+// GetRecentUserIDs 按最后活跃时间从新到旧返回从 offset 开始的 count 位用户 ID，以及有活跃记录的总人数
+func (rc *RedisClient) GetRecentUserIDs(ctx context.Context, offset, count int64) ([]string, int64, error) {
+	pipe := rc.rdb.TxPipeline()
+	ids := pipe.ZRevRange(ctx, LastActiveZSetKey, offset, offset+count-1)
+	total := pipe.ZCard(ctx, LastActiveZSetKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, 0, err
+	}
+	return ids.Val(), total.Val(), nil
+}
+
+// GetInactiveUserIDs 返回最后活跃时间早于 before 的用户 ID。
+// 没有活跃记录的用户（开始记录前联系过的用户）不包含在内。
+func (rc *RedisClient) GetInactiveUserIDs(ctx context.Context, before time.Time) ([]string, error) {
+	return rc.rdb.ZRangeByScore(ctx, LastActiveZSetKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(before.Unix(), 10),
+	}).Result()
+}
+
+// markFirstSeen 记录用户的首次联系时间
+func (rc *RedisClient) markFirstSeen(ctx context.Context, userID int64, now time.Time) error {
+	keys := []string{fmt.Sprintf("user:%d", userID), FirstSeenZSetKey}
+	err := recordFirstSeen.Run(ctx, rc.rdb, keys, strconv.FormatInt(userID, 10), firstSeenField, strconv.FormatInt(now.Unix(), 10)).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+// EnsureFirstSeenIndex 在首次联系 ZSet 尚未建立时（如从旧版本升级）根据用户资料中的 first_seen 补建。
+// 没有 first_seen 记录的用户无法确定首次联系时间，不计入新增用户统计。
+func (rc *RedisClient) EnsureFirstSeenIndex(ctx context.Context) error {
+	exists, err := rc.rdb.Exists(ctx, FirstSeenZSetKey).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	var indexErr error
+	err = rc.EachUserIDPage(ctx, UsersSetKey, 500, func(userIDs []string) bool {
+		pipe := rc.rdb.Pipeline()
+		cmds := make([]*redis.StringCmd, len(userIDs))
+		for i, id := range userIDs {
+			cmds[i] = pipe.HGet(ctx, "user:"+id, firstSeenField)
+		}
+		// 没有 first_seen 的用户使 Exec 返回 redis.Nil，不算错误
+		if _, indexErr = pipe.Exec(ctx); indexErr == redis.Nil {
+			indexErr = nil
+		}
+		if indexErr != nil {
+			return false
+		}
+		var members []redis.Z
+		for i, id := range userIDs {
+			if first := parseUnix(cmds[i].Val()); !first.IsZero() {
+				members = append(members, redis.Z{Score: float64(first.Unix()), Member: id})
+			}
+		}
+		if len(members) > 0 {
+			indexErr = rc.rdb.ZAddNX(ctx, FirstSeenZSetKey, members...).Err()
+		}
+		return indexErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return indexErr
+}
+
+// EnsureUsernameIndex 在用户名索引尚未根据全部用户资料建立时（如从旧版本升级）补建，此后由 StoreUserInfo 维护。
+// 索引中已有的用户名是较新的记录，不会被覆盖。
+func (rc *RedisClient) EnsureUsernameIndex(ctx context.Context) error {
+	exists, err := rc.rdb.Exists(ctx, usernamesIndexed).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	var indexErr error
+	err = rc.EachUserIDPage(ctx, UsersSetKey, 500, func(userIDs []string) bool {
+		pipe := rc.rdb.Pipeline()
+		cmds := make([]*redis.StringCmd, len(userIDs))
+		for i, id := range userIDs {
+			cmds[i] = pipe.HGet(ctx, "user:"+id, "username")
+		}
+		// 没有用户名的用户使 Exec 返回 redis.Nil，不算错误
+		if _, indexErr = pipe.Exec(ctx); indexErr == redis.Nil {
+			indexErr = nil
+		}
+		if indexErr != nil {
+			return false
+		}
+		pipe = rc.rdb.Pipeline()
+		for i, id := range userIDs {
+			if username := cmds[i].Val(); username != "" {
+				pipe.HSetNX(ctx, UsernamesKey, strings.ToLower(username), id)
+			}
+		}
+		if pipe.Len() > 0 {
+			_, indexErr = pipe.Exec(ctx)
+		}
+		return indexErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if indexErr != nil {
+		return indexErr
+	}
+	return rc.rdb.Set(ctx, usernamesIndexed, 1, 0).Err()
+}
+
+// CountNewUsers 返回 since 之后首次联系的用户数
+func (rc *RedisClient) CountNewUsers(ctx context.Context, since time.Time) (int64, error) {
+	return rc.rdb.ZCount(ctx, FirstSeenZSetKey, strconv.FormatInt(since.Unix(), 10), "+inf").Result()
+}
+
+// CountActiveUsers 返回 since 之后活跃过的用户数
+func (rc *RedisClient) CountActiveUsers(ctx context.Context, since time.Time) (int64, error) {
+	return rc.rdb.ZCount(ctx, LastActiveZSetKey, strconv.FormatInt(since.Unix(), 10), "+inf").Result()
+}
+
+// RemoveInactiveUsers 将指定用户移出用户集合和活跃时间 ZSet，返回实际移除的用户数。
+// 用户资料和首次联系时间保留，用户再次发消息时会重新加入。
+func (rc *RedisClient) RemoveInactiveUsers(ctx context.Context, userIDs []string) (int, error) {
+	removed := 0
+	for _, idStr := range userIDs {
+		userID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		ok, err := rc.removeCounted(ctx, UsersSetKey, StatsTotalUsersKey, userID)
+		if err != nil {
+			return removed, err
+		}
+		if err := rc.rdb.ZRem(ctx, LastActiveZSetKey, idStr).Err(); err != nil {
+			return removed, err
+		}
+		if ok {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// AddUserNote 为用户添加一条管理员备注，只保留最近 UserNotesLimit 条
+func (rc *RedisClient) AddUserNote(ctx context.Context, userID int64, note string) error {
+	key := userNotesKey(userID)
+	pipe := rc.rdb.TxPipeline()
+	pipe.LPush(ctx, key, note)
+	pipe.LTrim(ctx, key, 0, UserNotesLimit-1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetUserNotes 按时间顺序返回用户最近的 n 条备注
+func (rc *RedisClient) GetUserNotes(ctx context.Context, userID int64, n int) ([]string, error) {
+	notes, err := rc.rdb.LRange(ctx, userNotesKey(userID), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+		notes[i], notes[j] = notes[j], notes[i]
+	}
+	return notes, nil
+}
+
+// ClearUserNotes 删除用户的所有备注
+func (rc *RedisClient) ClearUserNotes(ctx context.Context, userID int64) error {
+	return rc.rdb.Del(ctx, userNotesKey(userID)).Err()
+}
+
+func parseUnix(val string) time.Time {
+	sec, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
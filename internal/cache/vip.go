@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// VIPUsersKey VIP 用户集合
+const VIPUsersKey = "vip_users"
+
+func vipPinKey(userID int64) string {
+	return fmt.Sprintf("vip_pin:%d", userID)
+}
+
+// AddVIP 将用户标记为 VIP，已是 VIP 时返回 false
+func (rc *RedisClient) AddVIP(ctx context.Context, userID int64) (bool, error) {
+	n, err := rc.rdb.SAdd(ctx, VIPUsersKey, strconv.FormatInt(userID, 10)).Result()
+	return n > 0, err
+}
+
+// RemoveVIP 取消用户的 VIP 标记，不是 VIP 时返回 false
+func (rc *RedisClient) RemoveVIP(ctx context.Context, userID int64) (bool, error) {
+	n, err := rc.rdb.SRem(ctx, VIPUsersKey, strconv.FormatInt(userID, 10)).Result()
+	return n > 0, err
+}
+
+// IsVIP 检查用户是否为 VIP
+func (rc *RedisClient) IsVIP(ctx context.Context, userID int64) (bool, error) {
+	return rc.rdb.SIsMember(ctx, VIPUsersKey, strconv.FormatInt(userID, 10)).Result()
+}
+
+// GetVIPs 获取所有 VIP 用户
+func (rc *RedisClient) GetVIPs(ctx context.Context) ([]int64, error) {
+	members, err := rc.rdb.SMembers(ctx, VIPUsersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		if id, err := strconv.ParseInt(member, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// SetVIPPin 记录为 VIP 用户置顶的消息，已有未回复的置顶时返回 false 且不做任何事
+func (rc *RedisClient) SetVIPPin(ctx context.Context, userID, chatID int64, messageID int) (bool, error) {
+	return rc.rdb.SetNX(ctx, vipPinKey(userID), fmt.Sprintf("%d:%d", chatID, messageID), ForwardMappingTTL).Result()
+}
+
+// TakeVIPPin 取出并删除为 VIP 用户置顶的消息，没有时 ok 为 false
+func (rc *RedisClient) TakeVIPPin(ctx context.Context, userID int64) (chatID int64, messageID int, ok bool, err error) {
+	key := vipPinKey(userID)
+	pipe := rc.rdb.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, 0, false, err
+	}
+	value, err := get.Result()
+	if err == redis.Nil {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	chatStr, msgStr, found := strings.Cut(value, ":")
+	chatID, err1 := strconv.ParseInt(chatStr, 10, 64)
+	messageID, err2 := strconv.Atoi(msgStr)
+	if !found || err1 != nil || err2 != nil {
+		return 0, 0, false, nil
+	}
+	return chatID, messageID, true, nil
+}
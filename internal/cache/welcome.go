@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WelcomeLanguagesKey 已设置多语言欢迎语的语言代码集合
+const WelcomeLanguagesKey = "welcome_languages"
+
+// AddWelcomeLanguage 记录某个语言已设置欢迎语
+func (rc *RedisClient) AddWelcomeLanguage(ctx context.Context, lang string) error {
+	return rc.rdb.SAdd(ctx, WelcomeLanguagesKey, lang).Err()
+}
+
+// RemoveWelcomeLanguage 移除某个语言的欢迎语记录
+func (rc *RedisClient) RemoveWelcomeLanguage(ctx context.Context, lang string) error {
+	return rc.rdb.SRem(ctx, WelcomeLanguagesKey, lang).Err()
+}
+
+// GetWelcomeLanguages 获取所有已设置欢迎语的语言代码
+func (rc *RedisClient) GetWelcomeLanguages(ctx context.Context) ([]string, error) {
+	return rc.rdb.SMembers(ctx, WelcomeLanguagesKey).Result()
+}
+
+// WelcomeActionsKey 欢迎按钮动作的回复内容，field 为动作名称，value 为序列化后的回复
+const WelcomeActionsKey = "welcome_actions"
+
+// SetWelcomeAction 保存动作的回复内容
+func (rc *RedisClient) SetWelcomeAction(ctx context.Context, name, payload string) error {
+	return rc.rdb.HSet(ctx, WelcomeActionsKey, name, payload).Err()
+}
+
+// GetWelcomeAction 获取动作的回复内容，未设置时返回空字符串
+func (rc *RedisClient) GetWelcomeAction(ctx context.Context, name string) (string, error) {
+	payload, err := rc.rdb.HGet(ctx, WelcomeActionsKey, name).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return payload, err
+}
+
+// GetWelcomeActions 获取所有动作的回复内容
+func (rc *RedisClient) GetWelcomeActions(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, WelcomeActionsKey).Result()
+}
+
+// DeleteWelcomeAction 删除动作，动作不存在时返回 false
+func (rc *RedisClient) DeleteWelcomeAction(ctx context.Context, name string) (bool, error) {
+	n, err := rc.rdb.HDel(ctx, WelcomeActionsKey, name).Result()
+	return n > 0, err
+}
+
+const (
+	WelcomeMenuKey = "welcome_menu"     // 欢迎菜单 Hash：字段为节点 ID，值为节点内容（JSON），根节点 ID 为 0
+	welcomeMenuSeq = "welcome_menu_seq" // 欢迎菜单节点 ID 自增计数器
+)
+
+// NextWelcomeMenuID 分配一个新的欢迎菜单节点 ID
+func (rc *RedisClient) NextWelcomeMenuID(ctx context.Context) (int64, error) {
+	return rc.rdb.Incr(ctx, welcomeMenuSeq).Result()
+}
+
+// SetWelcomeMenuNode 保存欢迎菜单节点
+func (rc *RedisClient) SetWelcomeMenuNode(ctx context.Context, id int64, payload string) error {
+	return rc.rdb.HSet(ctx, WelcomeMenuKey, strconv.FormatInt(id, 10), payload).Err()
+}
+
+// GetWelcomeMenu 获取欢迎菜单的所有节点
+func (rc *RedisClient) GetWelcomeMenu(ctx context.Context) (map[string]string, error) {
+	return rc.rdb.HGetAll(ctx, WelcomeMenuKey).Result()
+}
+
+// DeleteWelcomeMenuNodes 删除欢迎菜单节点
+func (rc *RedisClient) DeleteWelcomeMenuNodes(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	fields := make([]string, len(ids))
+	for i, id := range ids {
+		fields[i] = strconv.FormatInt(id, 10)
+	}
+	return rc.rdb.HDel(ctx, WelcomeMenuKey, fields...).Err()
+}
@@ -0,0 +1,326 @@
+// Package keyboard 解析、校验和序列化管理员输入的内联按钮配置，供欢迎语、广播等功能共用。
+//
+// 按钮配置每个按钮写作“按钮文字 | 链接”。默认每行一个按钮，两个一排；使用 && 或空行时
+// 每行是一排按钮，&& 连接同一排的多个按钮。链接也可以写成“回调:提示文字”，创建回调按钮；
+// 或写成“动作:名称”，创建动作按钮，点击后由使用方回复为该动作配置的内容。
+package keyboard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// RowSeparator 在同一行中连接多个按钮，例如“官网 | https://a.com && 客服 | https://t.me/x”
+	RowSeparator = "&&"
+	// CallbackPrefix 标记回调按钮：“按钮文字 | 回调:点击后显示的文字”
+	CallbackPrefix = "回调:"
+	// ActionPrefix 标记动作按钮：“按钮文字 | 动作:名称”
+	ActionPrefix = "动作:"
+	// ActionDataPrefix 动作按钮的 callback_data 前缀，后接动作名称
+	ActionDataPrefix = "wact_"
+
+	MaxButtonsPerRow       = 8   // Telegram 每排最多显示的按钮数
+	MaxTextLength          = 64  // 按钮文字的最大长度，过长的文字在客户端会被截断
+	MaxCallbackReplyLength = 200 // 回调按钮提示文字的最大长度（answerCallbackQuery 的上限）
+
+	// callbackDataPrefix 回调按钮的 callback_data 前缀，后接提示文字的短键（见 ReplyKey）。
+	// 提示文字由使用方按短键另行保存，并在发送前将按钮替换为自己的回调按钮
+	callbackDataPrefix = "bcb:"
+)
+
+// actionNamePattern 动作名称只能包含小写字母、数字和下划线，保证 callback_data 不超过 64 字节
+var actionNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// length 按 Telegram 的计数方式（UTF-16 编码单元）计算文本长度
+func length(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// Parse 将按钮配置解析为内联键盘，格式错误的按钮会被跳过（需要提示错误时先调用 Validate）
+func Parse(data string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, specs := range splitRows(data) {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, spec := range specs {
+			text, target, ok := splitSpec(spec)
+			if !ok {
+				continue
+			}
+			row = append(row, NewButton(text, target))
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// Validate 检查按钮配置的格式、按钮文字长度、链接协议和每排按钮数，返回第一处错误（包含行号）
+func Validate(data string) error {
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		specs := strings.Split(line, RowSeparator)
+		if len(specs) > MaxButtonsPerRow {
+			return fmt.Errorf("第 %d 行有 %d 个按钮，每排最多 %d 个", i+1, len(specs), MaxButtonsPerRow)
+		}
+		for _, spec := range specs {
+			text, target, ok := splitSpec(spec)
+			if !ok || text == "" || target == "" {
+				return fmt.Errorf("第 %d 行格式错误：%s\n正确格式为：按钮文字 | 链接\n例如：关注频道 | https://t.me/channel", i+1, strings.TrimSpace(spec))
+			}
+			if err := ValidateText(text); err != nil {
+				return fmt.Errorf("第 %d 行%v", i+1, err)
+			}
+			if err := ValidateTarget(target); err != nil {
+				return fmt.Errorf("第 %d 行%v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateText 检查按钮文字不为空、不换行且不超过 MaxTextLength
+func ValidateText(text string) error {
+	if text == "" || strings.Contains(text, "\n") {
+		return fmt.Errorf("按钮文字不能为空，也不能换行")
+	}
+	if length(text) > MaxTextLength {
+		return fmt.Errorf("按钮文字「%s」过长，最多 %d 个字符", text, MaxTextLength)
+	}
+	return nil
+}
+
+// ValidateTarget 检查按钮目标是 http(s) 链接、有效的回调按钮提示或动作名称
+func ValidateTarget(target string) error {
+	if name, ok := ParseActionTarget(target); ok {
+		return ValidateActionName(name)
+	}
+	if reply, ok := ParseCallbackTarget(target); ok {
+		if reply == "" || length(reply) > MaxCallbackReplyLength {
+			return fmt.Errorf("回调按钮的提示文字不能为空，且不能超过 %d 个字符", MaxCallbackReplyLength)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		return fmt.Errorf("链接无效：%s\n请使用 http:// 或 https:// 开头的链接", target)
+	}
+	return nil
+}
+
+// Format 将键盘转换回按钮配置，每排一行，同一排的按钮用 && 连接。
+// 只包含链接按钮、回调按钮和动作按钮，其他按钮会被忽略；replies 为回调按钮短键对应的提示文字。
+func Format(markup tgbotapi.InlineKeyboardMarkup, replies map[string]string) string {
+	var lines []string
+	joined := false
+	for _, row := range markup.InlineKeyboard {
+		var specs []string
+		for _, button := range row {
+			if target := Target(button, replies); target != "" {
+				specs = append(specs, fmt.Sprintf("%s | %s", button.Text, target))
+			}
+		}
+		if len(specs) > 1 {
+			joined = true
+		}
+		if len(specs) > 0 {
+			lines = append(lines, strings.Join(specs, " "+RowSeparator+" "))
+		}
+	}
+	if !joined && len(lines) > 1 {
+		// 每排只有一个按钮时用空行分隔，避免被按默认格式两个一排解析
+		return strings.Join(lines, "\n\n")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewButton 根据按钮文字和目标（链接、“回调:提示文字”或“动作:名称”）创建按钮
+func NewButton(text, target string) tgbotapi.InlineKeyboardButton {
+	if name, ok := ParseActionTarget(target); ok {
+		return tgbotapi.NewInlineKeyboardButtonData(text, ActionDataPrefix+name)
+	}
+	if reply, ok := ParseCallbackTarget(target); ok {
+		return tgbotapi.NewInlineKeyboardButtonData(text, callbackDataPrefix+ReplyKey(reply))
+	}
+	return tgbotapi.NewInlineKeyboardButtonURL(text, target)
+}
+
+// Target 返回按钮的目标，格式与 NewButton 的输入一致；不是链接、回调或动作按钮时返回空字符串。
+// 回调按钮的提示文字从 replies（短键 -> 提示文字）中查找
+func Target(button tgbotapi.InlineKeyboardButton, replies map[string]string) string {
+	if name, ok := ActionName(button); ok {
+		return ActionPrefix + name
+	}
+	if key, ok := CallbackKey(button); ok {
+		return CallbackPrefix + replies[key]
+	}
+	if button.URL != nil {
+		return *button.URL
+	}
+	return ""
+}
+
+// ReplyKey 返回回调按钮提示文字的短键。提示文字最长 200 个字符，放不进 64 字节的 callback_data，
+// 因此 callback_data 中只保存短键；相同的提示文字得到相同的短键
+func ReplyKey(reply string) string {
+	sum := sha256.Sum256([]byte(reply))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CallbackKey 返回回调按钮提示文字的短键，不是回调按钮时 ok 为 false
+func CallbackKey(button tgbotapi.InlineKeyboardButton) (key string, ok bool) {
+	if button.CallbackData == nil || !strings.HasPrefix(*button.CallbackData, callbackDataPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(*button.CallbackData, callbackDataPrefix), true
+}
+
+// CallbackKeys 返回键盘中回调按钮提示文字的短键
+func CallbackKeys(markup tgbotapi.InlineKeyboardMarkup) []string {
+	var keys []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if key, ok := CallbackKey(button); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// CallbackReplies 返回按钮配置中回调按钮的短键和提示文字，使用方需要在使用 Parse 的结果前保存
+func CallbackReplies(data string) map[string]string {
+	replies := make(map[string]string)
+	for _, specs := range splitRows(data) {
+		for _, spec := range specs {
+			if _, target, ok := splitSpec(spec); ok {
+				if reply, ok := ParseCallbackTarget(target); ok {
+					replies[ReplyKey(reply)] = reply
+				}
+			}
+		}
+	}
+	return replies
+}
+
+// ActionName 返回动作按钮的动作名称，不是动作按钮时 ok 为 false
+func ActionName(button tgbotapi.InlineKeyboardButton) (name string, ok bool) {
+	if button.CallbackData == nil || !strings.HasPrefix(*button.CallbackData, ActionDataPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(*button.CallbackData, ActionDataPrefix), true
+}
+
+// ActionNames 返回键盘中动作按钮引用的动作名称，按出现顺序排列且不重复
+func ActionNames(markup tgbotapi.InlineKeyboardMarkup) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if name, ok := ActionName(button); ok && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// ValidateActionName 检查动作名称只包含小写字母、数字和下划线，且不超过 32 个字符
+func ValidateActionName(name string) error {
+	if !actionNamePattern.MatchString(name) {
+		return fmt.Errorf("动作名称「%s」无效，只能包含小写字母、数字和下划线，最多 32 个字符", name)
+	}
+	return nil
+}
+
+// HasCallbackButtons 报告键盘中是否包含回调按钮
+func HasCallbackButtons(markup tgbotapi.InlineKeyboardMarkup) bool {
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if _, ok := CallbackKey(button); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseCallbackTarget 解析按钮目标，是回调按钮时返回提示文字（兼容全角冒号的“回调：提示文字”）
+func ParseCallbackTarget(target string) (reply string, ok bool) {
+	for _, prefix := range []string{CallbackPrefix, "回调："} {
+		if strings.HasPrefix(target, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(target, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// ParseActionTarget 解析按钮目标，是动作按钮时返回动作名称（兼容全角冒号的“动作：名称”）
+func ParseActionTarget(target string) (name string, ok bool) {
+	for _, prefix := range []string{ActionPrefix, "动作："} {
+		if strings.HasPrefix(target, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(target, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// splitSpec 拆分“按钮文字 | 链接”，链接两侧的反引号会被去掉
+func splitSpec(spec string) (text, target string, ok bool) {
+	parts := strings.SplitN(spec, "|", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	text = strings.TrimSpace(parts[0])
+	target = strings.Trim(strings.TrimSpace(parts[1]), "`")
+	return text, target, true
+}
+
+// splitRows 将按钮配置拆分为每排的按钮配置
+func splitRows(data string) [][]string {
+	var lines []string
+	explicit := strings.Contains(data, RowSeparator)
+	blank := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			explicit = true // 按钮之间有空行，按排布局
+		}
+		lines = append(lines, line)
+	}
+
+	var rows [][]string
+	if !explicit {
+		// 默认格式：每行一个按钮，两个一排
+		for i := 0; i < len(lines); i += 2 {
+			rows = append(rows, lines[i:min(i+2, len(lines))])
+		}
+		return rows
+	}
+	for _, line := range lines {
+		var row []string
+		for _, spec := range strings.Split(line, RowSeparator) {
+			if spec = strings.TrimSpace(spec); spec != "" {
+				row = append(row, spec)
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
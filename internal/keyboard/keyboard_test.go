@@ -0,0 +1,131 @@
+package keyboard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// layout 返回键盘每排的按钮文字，便于比较排列
+func layout(markup tgbotapi.InlineKeyboardMarkup) [][]string {
+	var rows [][]string
+	for _, row := range markup.InlineKeyboard {
+		var texts []string
+		for _, button := range row {
+			texts = append(texts, button.Text)
+		}
+		rows = append(rows, texts)
+	}
+	return rows
+}
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want [][]string
+	}{
+		{"默认两个一排", "A | https://a.com\nB | https://b.com\nC | https://c.com", [][]string{{"A", "B"}, {"C"}}},
+		{"&& 连接同一排", "A | https://a.com && B | https://b.com\nC | https://c.com", [][]string{{"A", "B"}, {"C"}}},
+		{"空行分隔时每行一排", "A | https://a.com\n\nB | https://b.com\nC | https://c.com", [][]string{{"A"}, {"B"}, {"C"}}},
+		{"跳过格式错误的按钮", "A | https://a.com\n没有链接\nB | https://b.com\nC | https://c.com", [][]string{{"A"}, {"B", "C"}}},
+		{"空配置", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := layout(Parse(tt.data)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) 排列 = %v，期望 %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseButtonKinds(t *testing.T) {
+	markup := Parse("链接 | `https://a.com` && 回调 | 回调：感谢反馈 && 动作 | 动作:faq")
+	row := markup.InlineKeyboard[0]
+	if row[0].URL == nil || *row[0].URL != "https://a.com" {
+		t.Errorf("链接按钮 URL = %v，期望去掉反引号后的 https://a.com", row[0].URL)
+	}
+	if key, ok := CallbackKey(row[1]); !ok || key != ReplyKey("感谢反馈") {
+		t.Errorf("回调按钮短键 = %q, %v，期望 %q", key, ok, ReplyKey("感谢反馈"))
+	}
+	if name, ok := ActionName(row[2]); !ok || name != "faq" {
+		t.Errorf("动作按钮名称 = %q, %v，期望 faq", name, ok)
+	}
+	if !HasCallbackButtons(markup) {
+		t.Error("HasCallbackButtons 应为 true")
+	}
+}
+
+func TestCallbackDataFitsTelegramLimit(t *testing.T) {
+	reply := strings.Repeat("很长的提示", MaxCallbackReplyLength/5)
+	button := NewButton("按钮", CallbackPrefix+reply)
+	if n := len(*button.CallbackData); n > 64 {
+		t.Errorf("callback_data 长度为 %d 字节，超过 Telegram 的 64 字节上限", n)
+	}
+}
+
+func TestCallbackReplies(t *testing.T) {
+	data := "A | 回调:你好 && B | https://b.com\nC | 回调：再见\nD | 动作:faq"
+	want := map[string]string{ReplyKey("你好"): "你好", ReplyKey("再见"): "再见"}
+	if got := CallbackReplies(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("CallbackReplies = %v，期望 %v", got, want)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	tests := []string{
+		"A | https://a.com && B | https://b.com\nC | 回调:你好",
+		"A | https://a.com\n\nB | 动作:faq",
+		"A | https://a.com",
+	}
+	for _, data := range tests {
+		markup := Parse(data)
+		got := Format(markup, CallbackReplies(data))
+		if got != data {
+			t.Errorf("Format(Parse(%q)) = %q", data, got)
+		}
+		if !reflect.DeepEqual(layout(Parse(got)), layout(markup)) {
+			t.Errorf("重新解析 %q 后排列改变", got)
+		}
+	}
+}
+
+func TestFormatSkipsOtherButtons(t *testing.T) {
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("其他", "other"),
+		tgbotapi.NewInlineKeyboardButtonURL("A", "https://a.com"),
+	))
+	if got, want := Format(markup, nil), "A | https://a.com"; got != want {
+		t.Errorf("Format = %q，期望 %q", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{"A | https://a.com && B | 回调:你好", ""},
+		{"A | ftp://a.com", "第 1 行链接无效"},
+		{"A | https://a.com\n没有链接", "第 2 行格式错误"},
+		{"A | 回调:", "第 1 行回调按钮的提示文字不能为空"},
+		{"A | 动作:Bad-Name", "第 1 行动作名称「Bad-Name」无效"},
+		{strings.Repeat("A | https://a.com && ", MaxButtonsPerRow) + "B | https://b.com", "每排最多"},
+		{strings.Repeat("长", MaxTextLength+1) + " | https://a.com", "过长"},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.data)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("Validate(%q) = %v，期望通过", tt.data, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Validate(%q) = %v，期望包含 %q", tt.data, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package topics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTopicNameLength Telegram 论坛话题名称的长度上限（字符数）
+const maxTopicNameLength = 128
+
+// forumTopic 是 createForumTopic 返回结果中用到的字段
+type forumTopic struct {
+	MessageThreadID int    `json:"message_thread_id"`
+	Name            string `json:"name"`
+}
+
+// Manager handles forwarding user conversations into per-user topics of a forum supergroup.
+type Manager struct {
+	API         *tgbotapi.BotAPI
+	RedisClient *cache.RedisClient
+	GroupID     int64 // 开启了话题功能的超级群组，为 0 时不启用话题模式
+
+	mu sync.Mutex // 串行化话题的创建，避免同一用户连续发消息时重复建话题
+}
+
+// NewManager creates a new forum topic manager for the given supergroup.
+func NewManager(api *tgbotapi.BotAPI, redisClient *cache.RedisClient, groupID int64) *Manager {
+	return &Manager{
+		API:         api,
+		RedisClient: redisClient,
+		GroupID:     groupID,
+	}
+}
+
+// Enabled reports whether forum-topic mode is configured.
+func (m *Manager) Enabled() bool {
+	return m.GroupID != 0
+}
+
+// ForwardUserMessage copies a user's message into that user's topic, creating the topic (and posting
+// header with keyboard as its first message) or reopening it as needed. It returns the ID of the copy
+// in the group.
+func (m *Manager) ForwardUserMessage(msg *tgbotapi.Message, header string, keyboard tgbotapi.InlineKeyboardMarkup) (int, error) {
+	ctx := context.Background()
+	threadID, err := m.ensureTopic(ctx, msg.From, header, keyboard)
+	if err != nil {
+		return 0, err
+	}
+
+	messageID, err := m.copyToTopic(threadID, msg)
+	if err == nil {
+		return messageID, nil
+	}
+
+	// 话题可能被管理员手动删除或关闭，按情况重建或重新打开后再试一次
+	switch {
+	case isTopicDeleted(err):
+		log.Printf("用户 %d 的话题 %d 已不存在，重新创建", msg.From.ID, threadID)
+		if err := m.RedisClient.DeleteUserForumTopic(ctx, msg.From.ID, threadID); err != nil {
+			return 0, err
+		}
+		threadID, err = m.ensureTopic(ctx, msg.From, header, keyboard)
+		if err != nil {
+			return 0, err
+		}
+	case isTopicClosed(err):
+		if err := m.reopenTopic(ctx, threadID); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+	return m.copyToTopic(threadID, msg)
+}
+
+// CloseUserTopic closes the topic of the given user. The topic is reopened automatically when the
+// user writes again.
+func (m *Manager) CloseUserTopic(userID int64) error {
+	ctx := context.Background()
+	threadID, err := m.RedisClient.GetUserForumTopic(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if threadID == 0 {
+		return fmt.Errorf("用户 %d 没有对应的话题", userID)
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", m.GroupID)
+	params.AddNonZero("message_thread_id", threadID)
+	if _, err := m.API.MakeRequest("closeForumTopic", params); err != nil && !isTopicNotModified(err) {
+		return err
+	}
+	return m.RedisClient.SetForumTopicClosed(ctx, threadID, true)
+}
+
+// UserForThread returns the user whose conversation lives in the given topic, or 0 if none.
+func (m *Manager) UserForThread(threadID int) (int64, error) {
+	return m.RedisClient.GetForumTopicUser(context.Background(), threadID)
+}
+
+// TopicLink returns a t.me link to the given user's topic, or "" if the user has none.
+func (m *Manager) TopicLink(userID int64) (string, error) {
+	threadID, err := m.RedisClient.GetUserForumTopic(context.Background(), userID)
+	if err != nil || threadID == 0 {
+		return "", err
+	}
+	// 超级群组 ID 形如 -100xxxxxxxxxx，链接中使用去掉 -100 前缀的部分
+	internalID := strings.TrimPrefix(strconv.FormatInt(m.GroupID, 10), "-100")
+	return fmt.Sprintf("https://t.me/c/%s/%d", internalID, threadID), nil
+}
+
+// ensureTopic 返回用户的话题 ID，没有时创建新话题，已关闭时重新打开
+func (m *Manager) ensureTopic(ctx context.Context, user *tgbotapi.User, header string, keyboard tgbotapi.InlineKeyboardMarkup) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	threadID, err := m.RedisClient.GetUserForumTopic(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if threadID != 0 {
+		closed, err := m.RedisClient.IsForumTopicClosed(ctx, threadID)
+		if err != nil {
+			log.Printf("检查话题 %d 是否关闭失败: %v", threadID, err)
+		}
+		if closed {
+			if err := m.reopenTopic(ctx, threadID); err != nil {
+				return 0, err
+			}
+		}
+		return threadID, nil
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", m.GroupID)
+	params.AddNonEmpty("name", topicName(user))
+	resp, err := m.API.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return 0, err
+	}
+	var topic forumTopic
+	if err := json.Unmarshal(resp.Result, &topic); err != nil {
+		return 0, err
+	}
+	if err := m.RedisClient.SetUserForumTopic(ctx, user.ID, topic.MessageThreadID); err != nil {
+		return 0, err
+	}
+	log.Printf("为用户 %d 创建话题 %d（%s）", user.ID, topic.MessageThreadID, topic.Name)
+
+	if err := m.sendHeader(topic.MessageThreadID, header, keyboard); err != nil {
+		log.Printf("发送话题 %d 的用户信息失败: %v", topic.MessageThreadID, err)
+	}
+	return topic.MessageThreadID, nil
+}
+
+// reopenTopic 重新打开已关闭的话题
+func (m *Manager) reopenTopic(ctx context.Context, threadID int) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", m.GroupID)
+	params.AddNonZero("message_thread_id", threadID)
+	if _, err := m.API.MakeRequest("reopenForumTopic", params); err != nil && !isTopicNotModified(err) {
+		return err
+	}
+	log.Printf("话题 %d 已重新打开", threadID)
+	return m.RedisClient.SetForumTopicClosed(ctx, threadID, false)
+}
+
+// sendHeader 在新话题中发送用户信息（MarkdownV2）及操作按钮
+func (m *Manager) sendHeader(threadID int, header string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", m.GroupID)
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonEmpty("text", header)
+	params.AddNonEmpty("parse_mode", "MarkdownV2")
+	if err := params.AddInterface("reply_markup", keyboard); err != nil {
+		return err
+	}
+	_, err := m.API.MakeRequest("sendMessage", params)
+	return err
+}
+
+// copyToTopic 将用户消息原样复制到话题中，返回副本的消息 ID
+func (m *Manager) copyToTopic(threadID int, msg *tgbotapi.Message) (int, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", m.GroupID)
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonZero64("from_chat_id", msg.Chat.ID)
+	params.AddNonZero("message_id", msg.MessageID)
+	resp, err := m.API.MakeRequest("copyMessage", params)
+	if err != nil {
+		return 0, err
+	}
+	var messageID tgbotapi.MessageID
+	if err := json.Unmarshal(resp.Result, &messageID); err != nil {
+		return 0, err
+	}
+	return messageID.MessageID, nil
+}
+
+// topicName 生成话题名称：用户昵称、用户名及 ID
+func topicName(user *tgbotapi.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.UserName != "" {
+		name += " @" + user.UserName
+	}
+	name = strings.TrimSpace(name + " (" + strconv.FormatInt(user.ID, 10) + ")")
+	if runes := []rune(name); len(runes) > maxTopicNameLength {
+		name = string(runes[:maxTopicNameLength])
+	}
+	return name
+}
+
+func isTopicDeleted(err error) bool {
+	text := strings.ToLower(err.Error())
+	return strings.Contains(text, "message thread not found") || strings.Contains(text, "topic_deleted")
+}
+
+func isTopicClosed(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "topic_closed")
+}
+
+func isTopicNotModified(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "topic_not_modified")
+}
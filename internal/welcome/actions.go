@@ -0,0 +1,198 @@
+package welcome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"my-tg-bot/internal/keyboard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// actionButtonsSeparator 单独一行时分隔动作回复的文本和按钮
+const actionButtonsSeparator = "---"
+
+// action 是欢迎动作按钮被点击后回复给用户的内容，Buttons 为按钮配置，可再包含动作按钮作为下一级菜单
+type action struct {
+	Text    string `json:"text"`
+	Buttons string `json:"buttons,omitempty"`
+}
+
+// parseActionInput 解析管理员输入的动作回复：“---”之前是文本，之后是按钮配置
+func parseActionInput(input string) (action, error) {
+	text, buttons := input, ""
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == actionButtonsSeparator {
+			text = strings.Join(lines[:i], "\n")
+			buttons = strings.TrimSpace(strings.Join(lines[i+1:], "\n"))
+			break
+		}
+	}
+	a := action{Text: strings.TrimSpace(text), Buttons: buttons}
+	if a.Text == "" {
+		return a, fmt.Errorf("回复文本不能为空")
+	}
+	if a.Buttons != "" {
+		if err := keyboard.Validate(a.Buttons); err != nil {
+			return a, err
+		}
+		if keyboard.HasCallbackButtons(keyboard.Parse(a.Buttons)) {
+			return a, fmt.Errorf("动作回复的按钮只支持链接按钮和动作按钮")
+		}
+	}
+	return a, nil
+}
+
+// input 返回动作回复在编辑时的输入格式
+func (a action) input() string {
+	if a.Buttons == "" {
+		return a.Text
+	}
+	return a.Text + "\n" + actionButtonsSeparator + "\n" + a.Buttons
+}
+
+// loadAction 读取动作的回复内容，未设置时 ok 为 false
+func (m *Manager) loadAction(ctx context.Context, name string) (a action, ok bool, err error) {
+	payload, err := m.RedisClient.GetWelcomeAction(ctx, name)
+	if err != nil || payload == "" {
+		return a, false, err
+	}
+	if err := json.Unmarshal([]byte(payload), &a); err != nil {
+		return a, false, err
+	}
+	return a, true, nil
+}
+
+// sendAction 将动作的回复内容发送到 chatID
+func (m *Manager) sendAction(chatID int64, a action) error {
+	msg := tgbotapi.NewMessage(chatID, a.Text)
+	if markup := keyboard.Parse(a.Buttons); len(markup.InlineKeyboard) > 0 {
+		msg.ReplyMarkup = markup
+	}
+	_, err := m.API.Send(msg)
+	return err
+}
+
+// HandleActionCallback 处理欢迎按钮中的动作按钮：向点击的用户回复该动作配置的内容
+func (m *Manager) HandleActionCallback(q *tgbotapi.CallbackQuery) {
+	name := strings.TrimPrefix(q.Data, keyboard.ActionDataPrefix)
+	a, ok, err := m.loadAction(context.Background(), name)
+	if err != nil {
+		log.Printf("获取欢迎动作 %s 失败: %v", name, err)
+	}
+	if !ok {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "该按钮暂不可用"))
+		return
+	}
+	m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+	if err := m.sendAction(q.From.ID, a); err != nil {
+		log.Printf("发送欢迎动作 %s 给用户 %d 失败: %v", name, q.From.ID, err)
+	}
+}
+
+// ListActions 列出已配置的欢迎动作及用法
+func (m *Manager) ListActions(chatID int64) {
+	actions, err := m.RedisClient.GetWelcomeActions(context.Background())
+	if err != nil {
+		log.Printf("获取欢迎动作列表失败: %v", err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取欢迎动作失败。"))
+		return
+	}
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	if len(names) == 0 {
+		sb.WriteString("当前没有欢迎动作。\n")
+	} else {
+		sb.WriteString("欢迎动作：\n")
+		for _, name := range names {
+			var a action
+			if err := json.Unmarshal([]byte(actions[name]), &a); err != nil {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("• %s：%s\n", name, truncate(a.Text, 40)))
+		}
+	}
+	sb.WriteString("\n用法：\n" +
+		"/welcomeaction <名称> —— 设置动作的回复内容\n" +
+		"/welcomeaction del <名称> —— 删除动作\n\n" +
+		"在欢迎按钮中写作「按钮文字 | 动作:名称」，用户点击后收到该动作的回复，例如常见问题、价格说明或下一级菜单。")
+	m.API.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
+
+// StartSetActionProcess 开始设置动作的回复内容
+func (m *Manager) StartSetActionProcess(chatID int64, name string) {
+	if err := keyboard.ValidateActionName(name); err != nil {
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()))
+		return
+	}
+	current := "（尚未设置）"
+	if a, ok, err := m.loadAction(context.Background(), name); err != nil {
+		current = "（无法获取当前内容）"
+	} else if ok {
+		current = a.input()
+	}
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("动作 %s 的当前回复：\n%s\n\n"+
+		"请输入用户点击「动作:%s」按钮后收到的回复文本。\n"+
+		"需要附带按钮（例如下一级菜单）时，在文本后单独写一行 %s，再按欢迎按钮的格式写按钮，例如：\n"+
+		"价格说明请选择：\n%s\n月付 | 动作:price_month\n年付 | 动作:price_year",
+		name, current, name, actionButtonsSeparator, actionButtonsSeparator)))
+
+	m.ActionEdits[chatID] = name
+	m.AdminStates[chatID] = StateAwaitingActionResponse
+}
+
+func (m *Manager) handleActionResponseInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	a, err := parseActionInput(msg.Text)
+	if err != nil {
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"\n请重新输入。"))
+		return
+	}
+	m.previewDraft(chatID, draft{Kind: draftAction, Action: m.ActionEdits[chatID], Text: a.Text, Buttons: a.Buttons})
+}
+
+// DeleteAction 删除动作，使用该动作的按钮点击后提示暂不可用，actorID 为记入审计日志的管理员
+func (m *Manager) DeleteAction(chatID, actorID int64, name string) {
+	removed, err := m.RedisClient.DeleteWelcomeAction(context.Background(), name)
+	if err != nil {
+		log.Printf("删除欢迎动作 %s 失败: %v", name, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 删除失败，请稍后再试。"))
+		return
+	}
+	if !removed {
+		m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("找不到动作 %s。", name)))
+		return
+	}
+	m.audit(actorID, "删除欢迎动作 "+name)
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已删除动作 %s。", name)))
+}
+
+// missingActions 返回按钮配置中引用但尚未设置回复内容的动作
+func (m *Manager) missingActions(ctx context.Context, buttons string) []string {
+	var missing []string
+	for _, name := range keyboard.ActionNames(keyboard.Parse(buttons)) {
+		if payload, err := m.RedisClient.GetWelcomeAction(ctx, name); err == nil && payload == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// truncate 将文本截断为最多 n 个字符
+func truncate(text string, n int) string {
+	runes := []rune(strings.ReplaceAll(text, "\n", " "))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n]) + "…"
+}
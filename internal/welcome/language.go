@@ -0,0 +1,102 @@
+package welcome
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ConfigLanguageWelcome 后接语言代码，保存该语言的欢迎语文本；图片/视频和按钮与默认欢迎语共用
+const ConfigLanguageWelcome = "config:welcome_message:lang:"
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// NormalizeLanguage 将 Telegram 的 language_code（如 "en-US"、"zh-hans"）转换为主语言代码（"en"、"zh"），
+// 无效时返回空字符串
+func NormalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if !languagePattern.MatchString(code) {
+		return ""
+	}
+	return code
+}
+
+// languageWelcome 返回指定语言的欢迎语文本，未设置时返回空字符串
+func (m *Manager) languageWelcome(ctx context.Context, lang string) string {
+	lang = NormalizeLanguage(lang)
+	if lang == "" {
+		return ""
+	}
+	text, err := m.RedisClient.GetConfigValue(ctx, ConfigLanguageWelcome+lang)
+	if err != nil {
+		log.Printf("获取 %s 欢迎语失败: %v", lang, err)
+		return ""
+	}
+	return text
+}
+
+// languageList 返回已设置欢迎语的语言代码，用于提示管理员
+func (m *Manager) languageList(ctx context.Context) string {
+	langs, err := m.RedisClient.GetWelcomeLanguages(ctx)
+	if err != nil {
+		log.Printf("获取多语言欢迎语列表失败: %v", err)
+		return ""
+	}
+	if len(langs) == 0 {
+		return "无"
+	}
+	sort.Strings(langs)
+	return strings.Join(langs, ", ")
+}
+
+// StartSetLanguageWelcomeProcess begins the process for an admin to set the welcome text for one language.
+func (m *Manager) StartSetLanguageWelcomeProcess(chatID int64, lang string) {
+	current := m.languageWelcome(context.Background(), lang)
+	if current == "" {
+		current = "（未设置，该语言的用户将看到默认欢迎语）"
+	}
+	text := fmt.Sprintf("语言 %s 的当前欢迎语：\n%s\n\n请输入该语言的新欢迎语文本。\n图片/视频和按钮与默认欢迎语共用；发送 /setwelcome %s clear 可删除该语言的欢迎语。", lang, current, lang)
+	m.API.Send(tgbotapi.NewMessage(chatID, text))
+
+	m.LanguageEdits[chatID] = lang
+	m.AdminStates[chatID] = StateAwaitingLanguageWelcome
+}
+
+// ClearLanguageWelcome deletes the welcome text of one language so its users fall back to the default welcome.
+// actorID is the admin recorded in the audit log.
+func (m *Manager) ClearLanguageWelcome(chatID, actorID int64, lang string) {
+	ctx := context.Background()
+	err := m.RedisClient.SetConfigValue(ctx, ConfigLanguageWelcome+lang, "")
+	if err == nil {
+		err = m.RedisClient.RemoveWelcomeLanguage(ctx, lang)
+	}
+	if err != nil {
+		log.Printf("删除 %s 欢迎语失败: %v", lang, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 删除失败，请稍后再试。"))
+		return
+	}
+	m.audit(actorID, fmt.Sprintf("删除语言 %s 的欢迎语", lang))
+	m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已删除语言 %s 的欢迎语，该语言的用户将看到默认欢迎语。", lang)))
+}
+
+func (m *Manager) handleLanguageWelcomeInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if msg.Text == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "多语言欢迎语只支持文本，请输入欢迎语文本。"))
+		return
+	}
+	if _, mediaID := m.welcomeMedia(context.Background()); mediaID != "" && len(utf16.Encode([]rune(msg.Text))) > MaxCaptionLength {
+		m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("默认欢迎语带有图片/视频，欢迎语文本最多 %d 个字符，请精简后重新输入。", MaxCaptionLength)))
+		return
+	}
+	m.previewDraft(chatID, draft{Kind: draftLanguage, Lang: m.LanguageEdits[chatID], Text: msg.Text})
+}
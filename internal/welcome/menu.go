@@ -0,0 +1,374 @@
+package welcome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/keyboard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// MenuCallbackPrefix 用户浏览欢迎菜单的回调前缀
+	MenuCallbackPrefix = "wmenu_"
+	menuOpenPrefix     = MenuCallbackPrefix + "open_" // 欢迎语下的菜单按钮，后接节点 ID，发送新消息显示菜单，不修改欢迎语
+	menuNavPrefix      = MenuCallbackPrefix + "nav_"  // 菜单消息中的按钮，后接节点 ID，在原消息上切换菜单
+
+	menuEditPrefix = "wmedit_" // 管理员编辑欢迎菜单的回调前缀，后接“操作_节点 ID”
+
+	defaultMenuText = "请选择：" // 根菜单未设置显示文字时使用
+)
+
+// menuNode 是欢迎菜单中的一项：Label 是上级菜单中的按钮文字，Text 是打开后显示的文字。
+// 根节点（ID 为 0）没有按钮，其子节点显示在欢迎语下方
+type menuNode struct {
+	ID     int64  `json:"-"`
+	Parent int64  `json:"parent"`
+	Label  string `json:"label"`
+	Text   string `json:"text"`
+}
+
+// menuTree 是从 Redis 读取的整个欢迎菜单
+type menuTree struct {
+	nodes    map[int64]*menuNode
+	children map[int64][]int64 // 节点 ID -> 按创建顺序排列的子节点 ID
+}
+
+// menuEdit 是管理员正在编辑的菜单节点：Add 为 true 时在 ID 下添加子菜单，否则修改 ID 本身
+type menuEdit struct {
+	ID  int64
+	Add bool
+}
+
+// loadMenu 读取欢迎菜单，根节点始终存在
+func (m *Manager) loadMenu(ctx context.Context) (*menuTree, error) {
+	payloads, err := m.RedisClient.GetWelcomeMenu(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := &menuTree{
+		nodes:    map[int64]*menuNode{0: {Text: defaultMenuText}},
+		children: make(map[int64][]int64),
+	}
+	for field, payload := range payloads {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		node := &menuNode{}
+		if err := json.Unmarshal([]byte(payload), node); err != nil {
+			log.Printf("忽略无效的欢迎菜单节点 %s: %v", field, err)
+			continue
+		}
+		node.ID = id
+		t.nodes[id] = node
+	}
+	for id, node := range t.nodes {
+		if id == 0 {
+			continue
+		}
+		if _, ok := t.nodes[node.Parent]; !ok {
+			// 上级已被删除的节点不可达
+			continue
+		}
+		t.children[node.Parent] = append(t.children[node.Parent], id)
+	}
+	for _, ids := range t.children {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return t, nil
+}
+
+// rows 为 parent 的每个子菜单生成一排按钮，回调数据为 prefix 加节点 ID
+func (t *menuTree) rows(parent int64, prefix string) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, id := range t.children[parent] {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t.nodes[id].Label, fmt.Sprintf("%s%d", prefix, id)),
+		))
+	}
+	return rows
+}
+
+// path 返回从根菜单到节点的路径，例如“主菜单 › 产品 › 价格”
+func (t *menuTree) path(id int64) string {
+	var labels []string
+	for id != 0 {
+		node, ok := t.nodes[id]
+		if !ok {
+			break
+		}
+		labels = append([]string{node.Label}, labels...)
+		id = node.Parent
+	}
+	return strings.Join(append([]string{"主菜单"}, labels...), " › ")
+}
+
+// subtree 返回节点及其所有下级节点的 ID
+func (t *menuTree) subtree(id int64) []int64 {
+	ids := []int64{id}
+	for _, child := range t.children[id] {
+		ids = append(ids, t.subtree(child)...)
+	}
+	return ids
+}
+
+// welcomeMarkup 返回欢迎语的键盘：按钮配置中的按钮在前，欢迎菜单的一级菜单在后
+func (m *Manager) welcomeMarkup(ctx context.Context, buttons string) tgbotapi.InlineKeyboardMarkup {
+	markup := keyboard.Parse(buttons)
+	t, err := m.loadMenu(ctx)
+	if err != nil {
+		log.Printf("获取欢迎菜单失败: %v", err)
+		return markup
+	}
+	rows := append(markup.InlineKeyboard, t.rows(0, menuOpenPrefix)...)
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// HandleMenuCallback 处理用户点击欢迎菜单按钮：显示该菜单的文字和下级菜单，非根菜单带返回上一级的按钮
+func (m *Manager) HandleMenuCallback(q *tgbotapi.CallbackQuery) {
+	open := strings.HasPrefix(q.Data, menuOpenPrefix)
+	raw := strings.TrimPrefix(strings.TrimPrefix(q.Data, menuOpenPrefix), menuNavPrefix)
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	t, err := m.loadMenu(context.Background())
+	if err != nil {
+		log.Printf("获取欢迎菜单失败: %v", err)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "菜单暂不可用，请稍后再试"))
+		return
+	}
+	node, ok := t.nodes[id]
+	if !ok {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "该菜单已失效"))
+		return
+	}
+	m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+
+	rows := t.rows(id, menuNavPrefix)
+	if id != 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回", fmt.Sprintf("%s%d", menuNavPrefix, node.Parent)),
+		))
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	// 从欢迎语打开菜单时发送新消息，保留欢迎语；在菜单消息中切换时直接修改该消息
+	if open || q.Message == nil || q.Message.Text == "" {
+		msg := tgbotapi.NewMessage(q.From.ID, node.Text)
+		if len(rows) > 0 {
+			msg.ReplyMarkup = markup
+		}
+		if _, err := m.API.Send(msg); err != nil {
+			log.Printf("发送欢迎菜单 %d 给用户 %d 失败: %v", id, q.From.ID, err)
+		}
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID, node.Text)
+	if len(rows) > 0 {
+		edit.ReplyMarkup = &markup
+	}
+	if _, err := m.API.Send(edit); err != nil {
+		log.Printf("切换用户 %d 的欢迎菜单到 %d 失败: %v", q.From.ID, id, err)
+	}
+}
+
+// StartMenuEditor 发送欢迎菜单的编辑面板，从根菜单开始
+func (m *Manager) StartMenuEditor(chatID int64) {
+	t, err := m.loadMenu(context.Background())
+	if err != nil {
+		log.Printf("获取欢迎菜单失败: %v", err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取欢迎菜单失败。"))
+		return
+	}
+	text, markup := t.editorPanel(0)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = markup
+	m.API.Send(msg)
+}
+
+// editorPanel 生成节点的编辑面板：显示文字和下级菜单，以及进入下级、添加、修改、删除和返回的按钮
+func (t *menuTree) editorPanel(id int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	node := t.nodes[id]
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🗂 欢迎菜单：%s\n\n显示文字：\n%s\n", t.path(id), node.Text))
+	if id == 0 {
+		sb.WriteString("\n一级菜单显示在欢迎语下方，点击后发送此处的显示文字和对应的菜单。")
+	}
+	if len(t.children[id]) == 0 {
+		sb.WriteString("\n没有下级菜单。")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, child := range t.children[id] {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📂 "+t.nodes[child].Label, fmt.Sprintf("%sview_%d", menuEditPrefix, child)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ 添加下级菜单", fmt.Sprintf("%sadd_%d", menuEditPrefix, id)),
+		tgbotapi.NewInlineKeyboardButtonData("✏️ 修改", fmt.Sprintf("%sedit_%d", menuEditPrefix, id)),
+	))
+	if id != 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 删除", fmt.Sprintf("%sdel_%d", menuEditPrefix, id)),
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ 上一级", fmt.Sprintf("%sview_%d", menuEditPrefix, node.Parent)),
+		))
+	}
+	return sb.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleMenuEditCallback 处理欢迎菜单编辑面板的按钮
+func (m *Manager) handleMenuEditCallback(q *tgbotapi.CallbackQuery) {
+	op, raw, _ := strings.Cut(strings.TrimPrefix(q.Data, menuEditPrefix), "_")
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || q.Message == nil {
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	chatID := q.Message.Chat.ID
+	ctx := context.Background()
+	t, err := m.loadMenu(ctx)
+	if err != nil {
+		log.Printf("获取欢迎菜单失败: %v", err)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 获取欢迎菜单失败"))
+		return
+	}
+	node, ok := t.nodes[id]
+	if !ok {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "该菜单已被删除"))
+		id, node = 0, t.nodes[0]
+		op = "view"
+	}
+
+	switch op {
+	case "add", "edit":
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		m.MenuEdits[chatID] = menuEdit{ID: id, Add: op == "add"}
+		m.AdminStates[chatID] = StateAwaitingMenuNode
+		var prompt string
+		switch {
+		case op == "add":
+			prompt = fmt.Sprintf("在「%s」下添加菜单。\n\n请输入两部分：第一行是按钮文字，之后是用户点击后看到的文字，例如：\n价格\n月付 30 元，年付 300 元。", t.path(id))
+		case id == 0:
+			prompt = fmt.Sprintf("当前显示文字：\n%s\n\n请输入用户返回主菜单时看到的文字：", node.Text)
+		default:
+			prompt = fmt.Sprintf("当前内容：\n%s\n%s\n\n请输入新的内容：第一行是按钮文字，之后是用户点击后看到的文字。", node.Label, node.Text)
+		}
+		m.API.Send(tgbotapi.NewMessage(chatID, prompt))
+		return
+	case "del":
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		text := fmt.Sprintf("确认删除「%s」", t.path(id))
+		if n := len(t.subtree(id)) - 1; n > 0 {
+			text += fmt.Sprintf("及其 %d 个下级菜单", n)
+		}
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 确认删除", fmt.Sprintf("%sdelok_%d", menuEditPrefix, id)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("%sview_%d", menuEditPrefix, id)),
+		))
+		m.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text+"？", markup))
+		return
+	case "delok":
+		if id == 0 {
+			m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+			return
+		}
+		if err := m.RedisClient.DeleteWelcomeMenuNodes(ctx, t.subtree(id)...); err != nil {
+			log.Printf("删除欢迎菜单 %d 失败: %v", id, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 删除失败"))
+			return
+		}
+		m.audit(q.From.ID, "删除欢迎菜单 "+t.path(id))
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已删除"))
+		if t, err = m.loadMenu(ctx); err != nil {
+			log.Printf("获取欢迎菜单失败: %v", err)
+			return
+		}
+		id = node.Parent
+	default:
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+	}
+	text, markup := t.editorPanel(id)
+	m.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, markup))
+}
+
+// handleMenuNodeInput 保存管理员输入的菜单内容，然后显示该菜单的编辑面板
+func (m *Manager) handleMenuNodeInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	edit, ok := m.MenuEdits[chatID]
+	if !ok {
+		m.AdminStates[chatID] = 0
+		return
+	}
+	input := strings.TrimSpace(msg.Text)
+	label, text := "", input
+	if edit.Add || edit.ID != 0 {
+		label, text, _ = strings.Cut(input, "\n")
+		label, text = strings.TrimSpace(label), strings.TrimSpace(text)
+		if err := keyboard.ValidateText(label); err != nil {
+			m.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"\n请重新输入。"))
+			return
+		}
+	}
+	if text == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 显示文字不能为空，请重新输入。"))
+		return
+	}
+
+	ctx := context.Background()
+	t, err := m.loadMenu(ctx)
+	if err != nil {
+		log.Printf("获取欢迎菜单失败: %v", err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取欢迎菜单失败，请稍后再试。"))
+		return
+	}
+	parent, ok := t.nodes[edit.ID]
+	if !ok {
+		delete(m.MenuEdits, chatID)
+		m.AdminStates[chatID] = 0
+		m.API.Send(tgbotapi.NewMessage(chatID, "该菜单已被删除。"))
+		return
+	}
+	node := &menuNode{ID: edit.ID, Parent: parent.Parent, Label: label, Text: text}
+	if edit.Add {
+		id, err := m.RedisClient.NextWelcomeMenuID(ctx)
+		if err != nil {
+			log.Printf("分配欢迎菜单 ID 失败: %v", err)
+			m.API.Send(tgbotapi.NewMessage(chatID, "❌ 保存失败，请稍后再试。"))
+			return
+		}
+		node = &menuNode{ID: id, Parent: edit.ID, Label: label, Text: text}
+	}
+	payload, err := json.Marshal(node)
+	if err == nil {
+		err = m.RedisClient.SetWelcomeMenuNode(ctx, node.ID, string(payload))
+	}
+	if err != nil {
+		log.Printf("保存欢迎菜单 %d 失败: %v", node.ID, err)
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 保存失败，请稍后再试。"))
+		return
+	}
+	delete(m.MenuEdits, chatID)
+	m.AdminStates[chatID] = 0
+
+	t.nodes[node.ID] = node
+	if edit.Add {
+		t.children[edit.ID] = append(t.children[edit.ID], node.ID)
+		m.audit(msg.From.ID, "添加欢迎菜单 "+t.path(node.ID))
+	} else {
+		m.audit(msg.From.ID, "修改欢迎菜单 "+t.path(node.ID))
+	}
+	panel, markup := t.editorPanel(node.ID)
+	reply := tgbotapi.NewMessage(chatID, "✅ 已保存。\n\n"+panel)
+	reply.ReplyMarkup = markup
+	m.API.Send(reply)
+}
@@ -0,0 +1,220 @@
+package welcome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// draftKind 区分欢迎语修改的内容
+type draftKind int
+
+const (
+	draftMessage  draftKind = iota // 默认欢迎语（文本或图片/视频）
+	draftButtons                   // 欢迎按钮
+	draftTopic                     // 主题欢迎语
+	draftLanguage                  // 某个语言的欢迎语文本
+	draftAction                    // 欢迎动作按钮的回复
+)
+
+// draft 是管理员输入后、确认保存前的欢迎语修改
+type draft struct {
+	Kind      draftKind
+	Topic     string
+	Lang      string
+	Action    string
+	Text      string
+	MediaType string
+	MediaID   string
+	Buttons   string
+}
+
+// previewDraft 按用户将看到的效果发送新欢迎语预览，并询问是否保存
+func (m *Manager) previewDraft(chatID int64, d draft) {
+	ctx := context.Background()
+	m.drafts[chatID] = d
+	m.AdminStates[chatID] = 0 // StateNone，等待确认
+
+	// 未修改的部分使用当前配置，预览与保存后的效果一致
+	buttons := d.Buttons
+	if d.Kind != draftButtons {
+		var err error
+		if buttons, err = m.RedisClient.GetConfigValue(ctx, ConfigWelcomeButtons); err != nil {
+			log.Printf("获取欢迎按钮失败: %v", err)
+		}
+	}
+	text, mediaType, mediaID := d.Text, d.MediaType, d.MediaID
+	if d.Kind == draftLanguage {
+		mediaType, mediaID = m.welcomeMedia(ctx)
+	}
+	if d.Kind == draftButtons {
+		text, _ = m.RedisClient.GetConfigValue(ctx, ConfigWelcomeMessage)
+		mediaType, mediaID = m.welcomeMedia(ctx)
+		if text == "" && mediaID == "" {
+			text = defaultWelcomeText
+		}
+	}
+
+	m.API.Send(tgbotapi.NewMessage(chatID, "--- 预览 ---"))
+	if d.Kind == draftAction {
+		if err := m.sendAction(chatID, action{Text: d.Text, Buttons: d.Buttons}); err != nil {
+			log.Printf("发送欢迎动作预览失败，chatID %d: %v", chatID, err)
+		}
+	} else {
+		m.sendWelcome(chatID, text, mediaType, mediaID, m.welcomeMarkup(ctx, buttons))
+	}
+
+	var what string
+	switch d.Kind {
+	case draftButtons:
+		what = "欢迎按钮"
+	case draftAction:
+		what = fmt.Sprintf("动作 %s 的回复", d.Action)
+	case draftTopic:
+		what = fmt.Sprintf("主题 %s 的欢迎语", d.Topic)
+	case draftLanguage:
+		what = fmt.Sprintf("语言 %s 的欢迎语", d.Lang)
+	default:
+		what = "欢迎语"
+	}
+	note := fmt.Sprintf("以上是新%s的预览，确认后才会生效。", what)
+	if d.Kind == draftButtons || d.Kind == draftAction {
+		if missing := m.missingActions(ctx, d.Buttons); len(missing) > 0 {
+			note += fmt.Sprintf("\n\n⚠️ 以下动作尚未设置回复内容，用户点击后会提示暂不可用：%s\n使用 /welcomeaction <名称> 设置。", strings.Join(missing, ", "))
+		}
+	}
+	confirm := tgbotapi.NewMessage(chatID, note)
+	confirm.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ 确认保存", "welcome_save"),
+		tgbotapi.NewInlineKeyboardButtonData("✏️ 继续编辑", "welcome_edit"),
+		tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "welcome_cancel"),
+	))
+	m.API.Send(confirm)
+}
+
+// HandleCallbackQuery processes the save / edit / cancel buttons under a welcome preview.
+func (m *Manager) HandleCallbackQuery(q *tgbotapi.CallbackQuery) bool {
+	if strings.HasPrefix(q.Data, menuEditPrefix) {
+		m.handleMenuEditCallback(q)
+		return true
+	}
+	if !strings.HasPrefix(q.Data, "welcome_") {
+		return false
+	}
+	chatID := q.Message.Chat.ID
+	d, ok := m.drafts[chatID]
+	if !ok {
+		m.API.Request(tgbotapi.NewCallback(q.ID, "该预览已失效"))
+		m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+		return true
+	}
+	delete(m.drafts, chatID)
+	m.API.Request(tgbotapi.NewDeleteMessage(chatID, q.Message.MessageID))
+
+	switch q.Data {
+	case "welcome_save":
+		if err := m.saveDraft(d); err != nil {
+			log.Printf("保存欢迎语失败，chatID %d: %v", chatID, err)
+			m.API.Request(tgbotapi.NewCallback(q.ID, "❌ 保存失败"))
+			m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("保存失败: %v", err)))
+			return true
+		}
+		delete(m.TopicEdits, chatID)
+		delete(m.LanguageEdits, chatID)
+		delete(m.ActionEdits, chatID)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已保存"))
+		switch d.Kind {
+		case draftButtons:
+			m.API.Send(tgbotapi.NewMessage(chatID, "✅ 欢迎按钮已更新。"))
+		case draftAction:
+			m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 动作 %s 的回复已更新。", d.Action)))
+		case draftTopic:
+			m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 主题 %s 的欢迎语已更新。", d.Topic)))
+		case draftLanguage:
+			m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 语言 %s 的欢迎语已更新。", d.Lang)))
+		default:
+			m.API.Send(tgbotapi.NewMessage(chatID, "✅ 欢迎语已更新。"))
+		}
+		log.Printf("欢迎语修改已保存（类型 %d），chatID: %d", d.Kind, chatID)
+		m.audit(q.From.ID, d.describe())
+	case "welcome_edit":
+		m.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		switch d.Kind {
+		case draftButtons:
+			m.StartSetButtonsProcess(chatID)
+		case draftTopic:
+			m.StartSetTopicWelcomeProcess(chatID, d.Topic)
+		case draftLanguage:
+			m.StartSetLanguageWelcomeProcess(chatID, d.Lang)
+		case draftAction:
+			m.StartSetActionProcess(chatID, d.Action)
+		default:
+			m.StartSetWelcomeProcess(chatID)
+		}
+	default:
+		delete(m.TopicEdits, chatID)
+		delete(m.LanguageEdits, chatID)
+		delete(m.ActionEdits, chatID)
+		m.API.Request(tgbotapi.NewCallback(q.ID, "已取消"))
+		m.API.Send(tgbotapi.NewMessage(chatID, "已取消，欢迎语未修改。"))
+	}
+	return true
+}
+
+// describe 返回审计日志中对这次修改的描述
+func (d draft) describe() string {
+	switch d.Kind {
+	case draftButtons:
+		return "修改欢迎按钮"
+	case draftTopic:
+		return fmt.Sprintf("修改主题 %s 的欢迎语：%s", d.Topic, d.Text)
+	case draftLanguage:
+		return fmt.Sprintf("修改语言 %s 的欢迎语：%s", d.Lang, d.Text)
+	case draftAction:
+		return fmt.Sprintf("修改欢迎动作 %s：%s", d.Action, d.Text)
+	}
+	return "修改欢迎语：" + d.Text
+}
+
+// audit 将欢迎语的修改记入审计日志
+func (m *Manager) audit(actorID int64, details string) {
+	if err := m.RedisClient.AddAuditEntry(context.Background(), actorID, cache.AuditWelcome, details); err != nil {
+		log.Printf("写入欢迎语审计日志失败，管理员 %d: %v", actorID, err)
+	}
+}
+
+// saveDraft 将确认后的修改写入 Redis
+func (m *Manager) saveDraft(d draft) error {
+	ctx := context.Background()
+	switch d.Kind {
+	case draftButtons:
+		return m.RedisClient.SetConfigValue(ctx, ConfigWelcomeButtons, d.Buttons)
+	case draftTopic:
+		return m.RedisClient.SetConfigValue(ctx, ConfigTopicWelcome+d.Topic, d.Text)
+	case draftLanguage:
+		if err := m.RedisClient.SetConfigValue(ctx, ConfigLanguageWelcome+d.Lang, d.Text); err != nil {
+			return err
+		}
+		return m.RedisClient.AddWelcomeLanguage(ctx, d.Lang)
+	case draftAction:
+		payload, err := json.Marshal(action{Text: d.Text, Buttons: d.Buttons})
+		if err != nil {
+			return err
+		}
+		return m.RedisClient.SetWelcomeAction(ctx, d.Action, string(payload))
+	}
+	err := m.RedisClient.SetConfigValue(ctx, ConfigWelcomeMessage, d.Text)
+	if err == nil {
+		err = m.RedisClient.SetConfigValue(ctx, ConfigWelcomeMediaID, d.MediaID)
+	}
+	if err == nil {
+		err = m.RedisClient.SetConfigValue(ctx, ConfigWelcomeMedia, d.MediaType)
+	}
+	return err
+}
@@ -3,9 +3,11 @@ package welcome
 import (
 	"context"
 	"fmt"
-	"strings"
+	"log"
+	"unicode/utf16"
 
 	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/keyboard"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -14,47 +16,148 @@ import (
 const (
 	StateAwaitingWelcomeMessage = iota + 20 // Use a higher start value to avoid conflicts
 	StateAwaitingWelcomeButtons
+	StateAwaitingTopicWelcome
+	StateAwaitingLanguageWelcome
+	StateAwaitingActionResponse // 等待输入欢迎动作按钮的回复内容
+	StateAwaitingMenuNode       // 等待输入欢迎菜单的内容
 )
 
 const (
 	ConfigWelcomeMessage = "config:welcome_message"
 	ConfigWelcomeButtons = "config:welcome_buttons"
+	ConfigTopicWelcome   = "config:welcome_message:topic:" // 后接主题名称或来源参数
+	ConfigWelcomeMediaID = "config:welcome_media_id"       // 欢迎语图片或视频的文件 ID，为空时只发送文本
+	ConfigWelcomeMedia   = "config:welcome_media_type"     // 欢迎语媒体类型：photo 或 video
 )
 
+// maxTopicLength 主题名称的最大长度，"topic_" 前缀加主题不能超过 start 参数的 64 个字符
+const maxTopicLength = 32
+
+// MaxCaptionLength Telegram 媒体标题的长度上限，按 UTF-16 编码单元计算
+const MaxCaptionLength = 1024
+
+const defaultWelcomeText = "👋 欢迎光临，我是私信小助手。直接在这里发消息，技术会回复。"
+
 // Manager handles all welcome-message-related logic.
 type Manager struct {
 	API         *tgbotapi.BotAPI
 	RedisClient *cache.RedisClient
 	AdminStates map[int64]int
+	TopicEdits  map[int64]string // 正在编辑主题欢迎语的管理员 -> 主题
+
+	LanguageEdits map[int64]string   // 正在编辑多语言欢迎语的管理员 -> 语言代码
+	ActionEdits   map[int64]string   // 正在编辑欢迎动作的管理员 -> 动作名称
+	MenuEdits     map[int64]menuEdit // 正在编辑欢迎菜单的管理员 -> 菜单节点
+
+	drafts map[int64]draft // 等待确认保存的欢迎语修改
 }
 
 // NewManager creates a new welcome message manager.
 func NewManager(api *tgbotapi.BotAPI, redisClient *cache.RedisClient, adminStates map[int64]int) *Manager {
 	return &Manager{
-		API:         api,
-		RedisClient: redisClient,
-		AdminStates: adminStates,
+		API:           api,
+		RedisClient:   redisClient,
+		AdminStates:   adminStates,
+		TopicEdits:    make(map[int64]string),
+		LanguageEdits: make(map[int64]string),
+		ActionEdits:   make(map[int64]string),
+		MenuEdits:     make(map[int64]menuEdit),
+		drafts:        make(map[int64]draft),
 	}
 }
 
-// HandleStartCommand sends the welcome message to a user.
-func (m *Manager) HandleStartCommand(chatID int64) {
-	welcomeMsgText, err := m.RedisClient.GetConfigValue(context.Background(), ConfigWelcomeMessage)
+// Reset 清除 chatID 正在编辑的欢迎语、动作和菜单及未保存的草稿，返回是否有需要清除的内容
+func (m *Manager) Reset(chatID int64) bool {
+	_, topic := m.TopicEdits[chatID]
+	_, lang := m.LanguageEdits[chatID]
+	_, act := m.ActionEdits[chatID]
+	_, menu := m.MenuEdits[chatID]
+	_, d := m.drafts[chatID]
+	delete(m.TopicEdits, chatID)
+	delete(m.LanguageEdits, chatID)
+	delete(m.ActionEdits, chatID)
+	delete(m.MenuEdits, chatID)
+	delete(m.drafts, chatID)
+	return topic || lang || act || menu || d
+}
+
+// HandleStartCommand sends the welcome message to a user in their language.
+func (m *Manager) HandleStartCommand(chatID int64, lang string) {
+	m.HandleTopicStart(chatID, "", lang)
+}
+
+// HandleTopicStart sends the welcome message for the given topic, falling back to the welcome for the
+// user's language and then the default welcome when the topic is empty or has no welcome configured.
+func (m *Manager) HandleTopicStart(chatID int64, topic, lang string) {
+	ctx := context.Background()
+	var welcomeMsgText string
+	var err error
+	if topic != "" {
+		welcomeMsgText, err = m.RedisClient.GetConfigValue(ctx, ConfigTopicWelcome+topic)
+	}
+	// 主题欢迎语只有文本；使用默认欢迎语（或其语言版本）时附带默认欢迎语的图片或视频
+	var mediaType, mediaID string
 	if err != nil || welcomeMsgText == "" {
-		welcomeMsgText = "👋 欢迎光临，我是私信小助手。直接在这里发消息，技术会回复。"
+		welcomeMsgText = m.languageWelcome(ctx, lang)
+		if welcomeMsgText == "" {
+			welcomeMsgText, err = m.RedisClient.GetConfigValue(ctx, ConfigWelcomeMessage)
+		}
+		mediaType, mediaID = m.welcomeMedia(ctx)
+	}
+	if (err != nil || welcomeMsgText == "") && mediaID == "" {
+		welcomeMsgText = defaultWelcomeText
 	}
 
-	buttonsStr, err := m.RedisClient.GetConfigValue(context.Background(), ConfigWelcomeButtons)
-	var keyboard tgbotapi.InlineKeyboardMarkup
-	if err == nil && buttonsStr != "" {
-		keyboard = ParseButtons(buttonsStr)
+	buttonsStr, err := m.RedisClient.GetConfigValue(ctx, ConfigWelcomeButtons)
+	if err != nil {
+		log.Printf("获取欢迎按钮失败: %v", err)
 	}
+	markup := m.welcomeMarkup(ctx, buttonsStr)
+	m.sendWelcome(chatID, welcomeMsgText, mediaType, mediaID, markup)
+}
 
-	msg := tgbotapi.NewMessage(chatID, welcomeMsgText)
-	if len(keyboard.InlineKeyboard) > 0 {
-		msg.ReplyMarkup = keyboard
+// welcomeMedia 返回默认欢迎语的媒体类型和文件 ID，未设置时文件 ID 为空
+func (m *Manager) welcomeMedia(ctx context.Context) (mediaType, mediaID string) {
+	mediaID, err := m.RedisClient.GetConfigValue(ctx, ConfigWelcomeMediaID)
+	if err != nil || mediaID == "" {
+		return "", ""
+	}
+	mediaType, err = m.RedisClient.GetConfigValue(ctx, ConfigWelcomeMedia)
+	if err != nil {
+		log.Printf("获取欢迎语媒体类型失败: %v", err)
+		return "", ""
+	}
+	return mediaType, mediaID
+}
+
+// sendWelcome 发送欢迎语：有媒体时发送图片或视频并以文本作为标题，按钮附在同一条消息上
+func (m *Manager) sendWelcome(chatID int64, text, mediaType, mediaID string, markup tgbotapi.InlineKeyboardMarkup) {
+	var c tgbotapi.Chattable
+	switch {
+	case mediaID != "" && mediaType == "photo":
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(mediaID))
+		photo.Caption = text
+		if len(markup.InlineKeyboard) > 0 {
+			photo.ReplyMarkup = markup
+		}
+		c = photo
+	case mediaID != "" && mediaType == "video":
+		video := tgbotapi.NewVideo(chatID, tgbotapi.FileID(mediaID))
+		video.Caption = text
+		if len(markup.InlineKeyboard) > 0 {
+			video.ReplyMarkup = markup
+		}
+		c = video
+	default:
+		msg := tgbotapi.NewMessage(chatID, text)
+		if len(markup.InlineKeyboard) > 0 {
+			msg.ReplyMarkup = markup
+		}
+		c = msg
+	}
+	if _, err := m.API.Send(c); err != nil {
+		log.Printf("发送欢迎语失败，chatID %d: %v", chatID, err)
 	}
-	m.API.Send(msg)
 }
 
 // StartSetWelcomeProcess begins the process for an admin to set the welcome message.
@@ -66,7 +169,10 @@ func (m *Manager) StartSetWelcomeProcess(chatID int64) {
 	} else if currentMsg == "" {
 		currentMsg = "（当前无欢迎语）"
 	}
-	displayMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("当前欢迎语：\n%s\n\n请输入新的欢迎语文本（可基于当前内容修改）：", currentMsg))
+	if mediaType, _ := m.welcomeMedia(context.Background()); mediaType != "" {
+		currentMsg = fmt.Sprintf("[%s] %s", mediaLabel(mediaType), currentMsg)
+	}
+	displayMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("当前欢迎语：\n%s\n\n已设置的多语言欢迎语：%s（使用 /setwelcome <语言代码> 编辑，如 /setwelcome en）\n\n请输入新的默认欢迎语文本（可基于当前内容修改），\n或发送一张图片或一个视频，图片/视频的说明文字将作为欢迎语：", currentMsg, m.languageList(context.Background())))
 	m.API.Send(displayMsg)
 
 	m.AdminStates[chatID] = StateAwaitingWelcomeMessage
@@ -81,7 +187,7 @@ func (m *Manager) StartSetButtonsProcess(chatID int64) {
 	} else if currentButtons == "" {
 		currentButtons = "（当前无按钮）"
 	}
-	msgText := fmt.Sprintf("当前欢迎按钮：\n%s\n\n请输入新的欢迎按钮，每行一个，格式为：\n`按钮文字 | 链接`\n\n例如：\n`关注频道 | https://t.me/channel`\n`靓号商城 | https://t.me/store`\n（可基于当前内容修改）", currentButtons)
+	msgText := fmt.Sprintf("当前欢迎按钮：\n%s\n\n请输入新的欢迎按钮，每行一个，格式为：\n`按钮文字 | 链接`\n\n例如：\n`关注频道 | https://t.me/channel`\n`靓号商城 | https://t.me/store`\n\n默认两个按钮一排。需要自定义排列时，用 `&&` 把同一排的按钮写在一行，每行一排：\n`官网 | https://example.com && 客服 | https://t.me/support`\n\n也可以添加动作按钮，用户点击后收到用 /welcomeaction 设置的回复：\n`常见问题 | 动作:faq`\n（可基于当前内容修改）", currentButtons)
 	msg := tgbotapi.NewMessage(chatID, msgText)
 	msg.ParseMode = tgbotapi.ModeMarkdown
 	m.API.Send(msg)
@@ -89,6 +195,26 @@ func (m *Manager) StartSetButtonsProcess(chatID int64) {
 	m.AdminStates[chatID] = StateAwaitingWelcomeButtons
 }
 
+// StartSetTopicWelcomeProcess begins the process for an admin to set the welcome message of a deep-link topic.
+// The same welcome is served to users arriving with the plain "?start=<topic>" source link.
+func (m *Manager) StartSetTopicWelcomeProcess(chatID int64, topic string) {
+	currentMsg, err := m.RedisClient.GetConfigValue(context.Background(), ConfigTopicWelcome+topic)
+	if err != nil {
+		currentMsg = "（无法获取当前欢迎语）"
+	} else if currentMsg == "" {
+		currentMsg = "（当前无主题欢迎语，将使用默认欢迎语）"
+	}
+	links := fmt.Sprintf("来源链接（只统计来源）：\nhttps://t.me/%s?start=%s", m.API.Self.UserName, topic)
+	if len(topic) <= maxTopicLength {
+		links = fmt.Sprintf("主题链接（同时标记用户主题）：\nhttps://t.me/%s?start=topic_%s\n", m.API.Self.UserName, topic) + links
+	}
+	displayMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("%s 的入口链接：\n%s\n\n当前欢迎语：\n%s\n\n请输入新的入口欢迎语：", topic, links, currentMsg))
+	m.API.Send(displayMsg)
+
+	m.TopicEdits[chatID] = topic
+	m.AdminStates[chatID] = StateAwaitingTopicWelcome
+}
+
 // HandleAdminMessageInput processes messages from admins when they are in a welcome-editing state.
 func (m *Manager) HandleAdminMessageInput(msg *tgbotapi.Message) bool {
 	state, ok := m.AdminStates[msg.From.ID]
@@ -103,64 +229,67 @@ func (m *Manager) HandleAdminMessageInput(msg *tgbotapi.Message) bool {
 	case StateAwaitingWelcomeButtons:
 		m.handleWelcomeButtonsInput(msg)
 		return true
+	case StateAwaitingTopicWelcome:
+		m.handleTopicWelcomeInput(msg)
+		return true
+	case StateAwaitingLanguageWelcome:
+		m.handleLanguageWelcomeInput(msg)
+		return true
+	case StateAwaitingActionResponse:
+		m.handleActionResponseInput(msg)
+		return true
+	case StateAwaitingMenuNode:
+		m.handleMenuNodeInput(msg)
+		return true
 	}
 	return false
 }
 
 func (m *Manager) handleWelcomeMessageInput(msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	err := m.RedisClient.SetConfigValue(context.Background(), ConfigWelcomeMessage, msg.Text)
-	if err != nil {
-		errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("保存欢迎语失败: %v", err))
-		m.API.Send(errMsg)
+	text, mediaType, mediaID := msg.Text, "", ""
+	if len(msg.Photo) > 0 {
+		text, mediaType, mediaID = msg.Caption, "photo", msg.Photo[len(msg.Photo)-1].FileID
+	} else if msg.Video != nil {
+		text, mediaType, mediaID = msg.Caption, "video", msg.Video.FileID
+	}
+	if text == "" && mediaID == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "请输入欢迎语文本，或发送一张图片或一个视频。"))
 		return
 	}
-	m.AdminStates[chatID] = 0 // StateNone
-	reply := tgbotapi.NewMessage(chatID, "✅ 欢迎语已更新。")
-	m.API.Send(reply)
-	m.HandleStartCommand(chatID)
+	if mediaID != "" && len(utf16.Encode([]rune(text))) > MaxCaptionLength {
+		m.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("图片/视频的说明文字最多 %d 个字符，请精简后重新发送。", MaxCaptionLength)))
+		return
+	}
+	m.previewDraft(chatID, draft{Kind: draftMessage, Text: text, MediaType: mediaType, MediaID: mediaID})
 }
 
-func (m *Manager) handleWelcomeButtonsInput(msg *tgbotapi.Message) {
+func (m *Manager) handleTopicWelcomeInput(msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	err := m.RedisClient.SetConfigValue(context.Background(), ConfigWelcomeButtons, msg.Text)
-	if err != nil {
-		errMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("保存按钮失败: %v", err))
-		m.API.Send(errMsg)
+	if msg.Text == "" {
+		m.API.Send(tgbotapi.NewMessage(chatID, "请输入主题欢迎语文本。"))
 		return
 	}
-	m.AdminStates[chatID] = 0 // StateNone
-	reply := tgbotapi.NewMessage(chatID, "✅ 欢迎按钮已更新。")
-	m.API.Send(reply)
-	m.HandleStartCommand(chatID)
+	m.previewDraft(chatID, draft{Kind: draftTopic, Topic: m.TopicEdits[chatID], Text: msg.Text})
 }
 
-// ParseButtons is a helper function to parse button data from a string.
-func ParseButtons(data string) tgbotapi.InlineKeyboardMarkup {
-	lines := strings.Split(data, "\n")
-	var buttons []tgbotapi.InlineKeyboardButton
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) == 2 {
-			text := strings.TrimSpace(parts[0])
-			url := strings.TrimSpace(parts[1])
-			url = strings.Trim(url, "`")
-			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(text, url))
-		}
+func (m *Manager) handleWelcomeButtonsInput(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if err := keyboard.Validate(msg.Text); err != nil {
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"\n请重新输入。"))
+		return
 	}
-
-	var rows [][]tgbotapi.InlineKeyboardButton
-	for i := 0; i < len(buttons); i += 2 {
-		if i+1 < len(buttons) {
-			rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i], buttons[i+1]))
-		} else {
-			rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i]))
-		}
+	if keyboard.HasCallbackButtons(keyboard.Parse(msg.Text)) {
+		m.API.Send(tgbotapi.NewMessage(chatID, "❌ 欢迎按钮只支持链接按钮和动作按钮，请重新输入。"))
+		return
 	}
+	m.previewDraft(chatID, draft{Kind: draftButtons, Buttons: msg.Text})
+}
 
-	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+// mediaLabel 返回媒体类型的显示名称
+func mediaLabel(mediaType string) string {
+	if mediaType == "video" {
+		return "视频"
+	}
+	return "图片"
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogFileMaxMB   = 100
+	defaultLogFileBackups = 5
+)
+
+// loggingConfig 是日志配置
+type loggingConfig struct {
+	Level   slog.Level
+	JSON    bool   // true 时输出 JSON，否则输出便于阅读的 key=value 文本
+	File    string // 不为空时同时写入该文件并按大小轮转
+	MaxSize int64  // 日志文件超过该大小（字节）时轮转
+	Backups int    // 保留的旧日志文件数
+}
+
+// loadLoggingConfig 从 LOG_LEVEL（debug/info/warn/error，默认 info，只作用于 slog 记录的日志）、LOG_FORMAT（console/json，默认 console）、
+// LOG_FILE、LOG_FILE_MAX_MB（默认 100）和 LOG_FILE_BACKUPS（默认 5）读取日志配置
+func loadLoggingConfig() (loggingConfig, error) {
+	cfg := loggingConfig{
+		Level:   slog.LevelInfo,
+		File:    os.Getenv("LOG_FILE"),
+		MaxSize: defaultLogFileMaxMB << 20,
+		Backups: defaultLogFileBackups,
+	}
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+			return cfg, fmt.Errorf("LOG_LEVEL 无效（%s），应为 debug、info、warn 或 error", level)
+		}
+	}
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "console", "text":
+	case "json":
+		cfg.JSON = true
+	default:
+		return cfg, fmt.Errorf("LOG_FORMAT 无效（%s），应为 console 或 json", format)
+	}
+	if sizeStr := os.Getenv("LOG_FILE_MAX_MB"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size < 1 {
+			return cfg, fmt.Errorf("LOG_FILE_MAX_MB 无效（%s），应为大于 0 的整数", sizeStr)
+		}
+		cfg.MaxSize = int64(size) << 20
+	}
+	if backupsStr := os.Getenv("LOG_FILE_BACKUPS"); backupsStr != "" {
+		backups, err := strconv.Atoi(backupsStr)
+		if err != nil || backups < 0 {
+			return cfg, fmt.Errorf("LOG_FILE_BACKUPS 无效（%s），应为不小于 0 的整数", backupsStr)
+		}
+		cfg.Backups = backups
+	}
+	return cfg, nil
+}
+
+// setupLogging 按配置创建 slog 默认 Logger，并把标准库 log 的输出也转到该 Logger。
+// 配置无效时保留标准库的默认输出并返回错误
+func setupLogging() error {
+	cfg, err := loadLoggingConfig()
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stderr
+	if cfg.File != "" {
+		file, err := openRotatingFile(cfg.File, cfg.MaxSize, cfg.Backups)
+		if err != nil {
+			return fmt.Errorf("打开日志文件 %s 失败: %w", cfg.File, err)
+		}
+		out = io.MultiWriter(os.Stderr, file)
+	}
+
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	var handler slog.Handler
+	if cfg.JSON {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	// slog.SetDefault 会让 log 的输出受 LOG_LEVEL 过滤，这里换成不分级、总是输出的写入器
+	log.SetFlags(0)
+	log.SetOutput(legacyLogWriter{handler: handler})
+	return nil
+}
+
+// legacyLogWriter 把尚未改用 slog 的 log.Printf 输出转成 slog 记录，使其使用同样的格式和输出位置。
+// 这些日志没有级别，统一记为 INFO 且不受 LOG_LEVEL 过滤，避免调高级别后连错误日志也被丢弃
+type legacyLogWriter struct {
+	handler slog.Handler
+}
+
+func (w legacyLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, msg, 0)
+	if err := w.handler.Handle(context.Background(), record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rotatingFile 是按大小轮转的日志文件：超过 maxSize 时把 path 改名为 path.1，原 path.1 改为 path.2，依此类推，
+// 只保留 backups 个旧文件
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			// 轮转失败时继续写入当前文件，避免丢失日志
+			fmt.Fprintf(os.Stderr, "轮转日志文件 %s 失败: %v\n", r.path, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件，依次后移旧文件并重新创建 path
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	if r.backups == 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.backups))
+		for i := r.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		os.Rename(r.path, r.path+".1")
+	}
+	return r.open()
+}
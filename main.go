@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"my-tg-bot/internal/autoreply"
 	"my-tg-bot/internal/broadcast"
 	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/keyboard"
+	"my-tg-bot/internal/topics"
 	"my-tg-bot/internal/welcome"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -25,121 +32,410 @@ const (
 // BotInstance 结构体保持不变
 type BotInstance struct {
 	API              *tgbotapi.BotAPI
-	adminIDs         map[int64]bool
+	adminIDs         map[int64]bool   // ADMIN_IDS 与 Redis 中添加的管理员合并后的结果，读写需持有 adminMu
+	superAdminIDs    map[int64]bool   // ADMIN_IDS 中配置的超级管理员，读写需持有 adminMu
+	adminRoles       map[int64]string // 通过 /addadmin 添加的管理员的角色，读写需持有 adminMu
+	adminMu          sync.RWMutex
 	adminStates      map[int64]int
-	forwardToAdminID int64
 	redisClient      *cache.RedisClient
 	broadcastManager *broadcast.Manager
 	welcomeManager   *welcome.Manager
+	topicsManager    *topics.Manager
+	autoreplyManager *autoreply.Manager
+	webhook          *webhookConfig   // 为 nil 时使用长轮询
+	updateOffsets    *updateTracker   // 长轮询时跟踪可以确认的更新，Webhook 模式下为 nil
+	botAPI           botAPIConfig     // Bot API 服务器的地址
+	restoredSessions map[int64]bool   // 已从 Redis 恢复过会话的 chatID
+	pendingImports   map[int64]string // chatID -> 等待上传文件的导入类型，只在管理员协程中访问
+	mediaGroups      *mediaGroupBuffer
+	sla              slaConfig
+	banwords         banwordsConfig
+	settings         runtimeSettings // 当前生效的设置，读写需持有 settingsMu
+	envSettings      runtimeSettings // 环境变量中的设置，恢复默认时使用，读写需持有 settingsMu
+	settingsMu       sync.RWMutex
+	pendingSettings  map[int64]string    // chatID -> 正在输入新值的设置项，只在管理员协程中访问
+	stateActivity    map[int64]time.Time // chatID -> 未完成操作的最后活动时间，只在管理员协程中访问
+	stateIdle        time.Duration       // 未完成操作无活动多久后自动取消，0 表示不自动取消
+	reports          *reportConfig       // 为 nil 时不发送统计报告
+	events           *eventBus           // 为 nil 时不推送事件
+	chatNotify       *chatNotifier       // 为 nil 时不同步通知到 Slack/Discord
+	email            *emailNotifier      // 为 nil 时不发送邮件通知
+	translator       *translator         // 为 nil 时不自动翻译
+	paymentPrefixes  []string            // 允许付款的账单 payload 前缀，为空时拒绝所有付款请求
+	alerts           *alerter
+	updateWorkers    int         // 并发处理更新的协程数
+	updatePool       *updatePool // Run 启动后才设置
+	apiHealth        *apiHealthClient
+	startedAt        time.Time
+	adminCommands    *commandRouter
+	userCommands     *commandRouter
 }
 
 // NewBotInstance 函数，添加日志以验证管理员 ID 和 Redis 连接
 func NewBotInstance() (*BotInstance, error) {
 	err := godotenv.Load()
+	if err := setupLogging(); err != nil {
+		log.Printf("警告：%v，使用默认日志输出", err)
+	}
 	if err != nil {
 		log.Println("警告：无法加载 .env 文件，将依赖环境变量。")
 	}
+	config, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	applyConfigEnv(config)
 
 	token := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if token == "" {
 		return nil, fmt.Errorf("请设置 TELEGRAM_BOT_TOKEN 环境变量")
 	}
 
-	api, err := tgbotapi.NewBotAPI(token)
+	botAPI, err := loadBotAPIConfig()
+	if err != nil {
+		return nil, err
+	}
+	api, err := newBotAPI(token, botAPI)
 	if err != nil {
 		return nil, err
 	}
+	if botAPI.Local {
+		log.Printf("使用自建 Bot API 服务器: %s", os.Getenv("TELEGRAM_API_ENDPOINT"))
+	}
+	if botAPI.Proxy != nil {
+		log.Printf("通过代理访问 Bot API: %s", botAPI.proxyLabel())
+	}
 
 	api.Debug = false
+	apiHealth := &apiHealthClient{next: api.Client}
+	api.Client = apiHealth
 	log.Printf("机器人账号 %s", api.Self.UserName)
 
 	redisAddr := os.Getenv("REDIS_ADDR")
 	redisPassword := os.Getenv("REDIS_PASSWORD")
 	redisDBStr := os.Getenv("REDIS_DB")
 	redisDB, _ := strconv.Atoi(redisDBStr)
-	redisClient, err := cache.NewRedisClient(redisAddr, redisPassword, redisDB)
+	redisClient, err := cache.NewRedisClient(redisAddr, redisPassword, redisDB, os.Getenv("REDIS_KEY_PREFIX"))
 	if err != nil {
 		return nil, fmt.Errorf("无法连接到 Redis: %w", err)
 	}
 	log.Printf("成功连接到 Redis，地址: %s, 数据库: %d", redisAddr, redisDB)
+	if prefix := redisClient.KeyPrefix(); prefix != "" {
+		log.Printf("Redis 键前缀: %s", prefix)
+	}
+	if err := redisClient.EnsureStatsCounters(context.Background()); err != nil {
+		log.Printf("初始化统计计数器失败: %v", err)
+	}
+	if err := redisClient.EnsureFirstSeenIndex(context.Background()); err != nil {
+		log.Printf("建立首次联系时间索引失败: %v", err)
+	}
+	if err := redisClient.EnsureUsernameIndex(context.Background()); err != nil {
+		log.Printf("建立用户名索引失败: %v", err)
+	}
 
-	adminIDs := make(map[int64]bool)
 	adminIDStr := os.Getenv("ADMIN_IDS")
+	adminIDs, invalidAdminIDs := parseAdminIDs(adminIDStr)
+	if len(invalidAdminIDs) > 0 {
+		log.Printf("警告：ADMIN_IDS 中以下条目无效，已忽略: %v", invalidAdminIDs)
+	}
 	if adminIDStr != "" {
-		ids := strings.Split(adminIDStr, ",")
-		for _, idStr := range ids {
-			id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-			if err == nil {
-				adminIDs[id] = true
-			}
-		}
 		log.Printf("加载的管理员 ID: %v", adminIDs)
 	} else {
 		log.Println("警告：未配置 ADMIN_IDS 环境变量")
 	}
+	superAdminIDs := make(map[int64]bool, len(adminIDs))
+	for id := range adminIDs {
+		superAdminIDs[id] = true
+	}
+	extraAdminIDs, err := redisClient.GetAdminIDs(context.Background())
+	if err != nil {
+		log.Printf("读取 Redis 中的管理员失败: %v", err)
+	} else if len(extraAdminIDs) > 0 {
+		for _, id := range extraAdminIDs {
+			adminIDs[id] = true
+		}
+		log.Printf("从 Redis 加载的管理员 ID: %v", extraAdminIDs)
+	}
+	adminRoles, err := redisClient.GetAdminRoles(context.Background())
+	if err != nil {
+		log.Printf("读取管理员角色失败: %v", err)
+		adminRoles = make(map[int64]string)
+	}
 
-	var forwardToAdminID int64
-	forwardToAdminIDStr := os.Getenv("FORWARD_TO_ADMIN_ID")
-	if forwardToAdminIDStr != "" {
-		forwardToAdminID, _ = strconv.ParseInt(forwardToAdminIDStr, 10, 64)
+	// 配置 FORUM_GROUP_ID 后启用话题模式：每位用户在该论坛超级群组中拥有独立话题
+	var forumGroupID int64
+	if forumGroupIDStr := os.Getenv("FORUM_GROUP_ID"); forumGroupIDStr != "" {
+		forumGroupID, err = strconv.ParseInt(forumGroupIDStr, 10, 64)
+		if err != nil {
+			log.Printf("警告：FORUM_GROUP_ID 无效（%s），不启用话题模式", forumGroupIDStr)
+			forumGroupID = 0
+		} else {
+			log.Printf("已启用话题模式，用户消息将转发到群组 %d 的独立话题中", forumGroupID)
+		}
+	}
+
+	webhook, err := loadWebhookConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	adminStates := make(map[int64]int)
 
-	return &BotInstance{
+	broadcastManager := broadcast.NewManager(api, redisClient, adminStates)
+	if workersStr := os.Getenv("BROADCAST_WORKERS"); workersStr != "" {
+		workers, err := strconv.Atoi(workersStr)
+		if err != nil || workers < 1 {
+			log.Printf("警告：BROADCAST_WORKERS 无效（%s），使用默认值 %d", workersStr, broadcast.DefaultWorkers)
+		} else {
+			broadcastManager.Workers = workers
+		}
+	}
+	log.Printf("广播并发数: %d，全局发送上限: %d 条/秒", broadcastManager.Workers, broadcast.MaxSendsPerSecond)
+
+	alerts, err := loadAlertConfig()
+	if err != nil {
+		log.Printf("警告：%v，告警将私信超级管理员", err)
+		alerts.ChatID = 0
+	}
+	if alerts.ChatID != 0 {
+		log.Printf("告警将发送到运维会话 %d，同类告警间隔 %s", alerts.ChatID, alerts.Interval)
+	}
+
+	reports, err := loadReportConfig()
+	if err != nil {
+		log.Printf("警告：%v，不发送统计报告", err)
+	}
+
+	var events *eventBus
+	if eventCfg, err := loadEventConfig(); err != nil {
+		log.Printf("警告：%v，不推送事件", err)
+	} else if eventCfg != nil {
+		events = newEventBus(*eventCfg)
+		log.Printf("已启用事件推送：%s", eventCfg.describe())
+	}
+
+	var email *emailNotifier
+	if emailCfg, err := loadEmailConfig(); err != nil {
+		log.Printf("警告：%v，不发送邮件通知", err)
+	} else if emailCfg != nil {
+		email = newEmailNotifier(*emailCfg)
+		log.Printf("已启用邮件通知：%s", emailCfg.describe())
+	}
+
+	var translate *translator
+	if translateCfg, err := loadTranslateConfig(); err != nil {
+		log.Printf("警告：%v，不启用自动翻译", err)
+	} else if translateCfg != nil {
+		translate = newTranslator(*translateCfg)
+		log.Printf("已启用自动翻译：%s", translateCfg.describe())
+	}
+
+	var chatNotify *chatNotifier
+	if notifyCfg, err := loadChatNotifyConfig(); err != nil {
+		log.Printf("警告：%v，不同步通知到 Slack/Discord", err)
+	} else if notifyCfg != nil {
+		chatNotify = newChatNotifier(*notifyCfg)
+		log.Printf("已启用 Slack/Discord 通知：%s", notifyCfg.describe())
+	}
+
+	bot := &BotInstance{
 		API:              api,
 		adminIDs:         adminIDs,
+		superAdminIDs:    superAdminIDs,
+		adminRoles:       adminRoles,
 		adminStates:      adminStates,
-		forwardToAdminID: forwardToAdminID,
 		redisClient:      redisClient,
-		broadcastManager: broadcast.NewManager(api, redisClient, adminStates),
+		broadcastManager: broadcastManager,
 		welcomeManager:   welcome.NewManager(api, redisClient, adminStates),
-	}, nil
+		topicsManager:    topics.NewManager(api, redisClient, forumGroupID),
+		autoreplyManager: autoreply.NewManager(api, redisClient, adminStates),
+		webhook:          webhook,
+		botAPI:           botAPI,
+		restoredSessions: make(map[int64]bool),
+		pendingImports:   make(map[int64]string),
+		mediaGroups:      newMediaGroupBuffer(),
+		sla:              loadSLAConfig(),
+		banwords:         loadBanwordsConfig(),
+		pendingSettings:  make(map[int64]string),
+		stateActivity:    make(map[int64]time.Time),
+		stateIdle:        loadStateIdleTimeout(),
+		reports:          reports,
+		events:           events,
+		chatNotify:       chatNotify,
+		email:            email,
+		translator:       translate,
+		paymentPrefixes:  loadPaymentPrefixes(),
+		alerts:           newAlerter(alerts),
+		updateWorkers:    loadUpdateWorkers(),
+		apiHealth:        apiHealth,
+		startedAt:        time.Now(),
+	}
+	bot.envSettings = loadEnvSettings()
+	bot.settings = bot.envSettings
+	bot.loadStoredSettings()
+	if changed, err := bot.applyConfigData(config); err != nil {
+		log.Printf("应用配置文件失败: %v", err)
+	} else if len(changed) > 0 {
+		log.Printf("已按配置文件更新：%s", strings.Join(changed, "、"))
+	}
+	bot.registerCommands()
+	// 先设置回调再启动后台 PING，避免健康检查的 goroutine 与回调的赋值并发
+	redisClient.OnHealthChange = bot.handleRedisHealthChange
+	redisClient.StartHealthCheck()
+	apiHealth.onChange = bot.handleAPIHealthChange
+	broadcastManager.OnFinish = func(result broadcast.Result) { bot.emit(eventBroadcastFinished, result) }
+	return bot, nil
+}
+
+// loadEnvSettings 从环境变量读取可在 /settings 中修改的设置的默认值
+func loadEnvSettings() runtimeSettings {
+	var forwardToAdminID int64
+	if forwardToAdminIDStr := os.Getenv("FORWARD_TO_ADMIN_ID"); forwardToAdminIDStr != "" {
+		forwardToAdminID, _ = strconv.ParseInt(forwardToAdminIDStr, 10, 64)
+	}
+	subscribe, err := loadSubscribeConfig()
+	if err != nil {
+		log.Printf("警告：%v，不启用强制关注频道", err)
+	} else if subscribe != nil {
+		log.Printf("已启用强制关注频道: %s", subscribe.key())
+	}
+	return runtimeSettings{ForwardTo: forwardToAdminID, Flood: loadFloodConfig(), Subscribe: subscribe, Digest: loadDigestConfig(), Spam: loadSpamConfig()}
+}
+
+// notifyAdmins 向所有管理员发送一条通知
+func (b *BotInstance) notifyAdmins(text string) {
+	for _, adminID := range b.adminIDList() {
+		if _, err := b.API.Send(tgbotapi.NewMessage(adminID, text)); err != nil {
+			log.Printf("通知管理员 %d 失败: %v", adminID, err)
+		}
+	}
 }
 
-// Run 函数保持不变
+// parseAdminIDs 解析逗号分隔的管理员 ID 列表，返回有效 ID 和无效条目
+func parseAdminIDs(adminIDStr string) (map[int64]bool, []string) {
+	adminIDs := make(map[int64]bool)
+	var invalid []string
+	if adminIDStr == "" {
+		return adminIDs, invalid
+	}
+	for _, idStr := range strings.Split(adminIDStr, ",") {
+		idStr = strings.TrimSpace(idStr)
+		if idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			invalid = append(invalid, idStr)
+			continue
+		}
+		adminIDs[id] = true
+	}
+	return adminIDs, invalid
+}
+
+// Run 根据配置通过 Webhook 或长轮询接收更新
 func (b *BotInstance) Run() {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := b.API.GetUpdatesChan(u)
+	var updates tgbotapi.UpdatesChannel
+	if b.webhook != nil {
+		var err error
+		updates, err = b.startWebhook()
+		if err != nil {
+			log.Fatalf("启动 Webhook 失败: %v", err)
+		}
+	} else {
+		// 之前以 Webhook 模式运行过时需先删除 Webhook，否则 getUpdates 会被拒绝
+		if _, err := b.API.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("删除 Webhook 失败: %v", err)
+		}
+		updates = b.pollUpdates()
+	}
+	b.broadcastManager.ResumeBroadcasts()
+	b.broadcastManager.StartScheduler()
+	b.StartSLAWatcher()
+	b.StartAwayDigest()
+	b.StartStatsReports()
+	b.StartDripScheduler()
+	b.StartConfigWatcher()
+	b.StartDashboard()
+	b.StartEmailWatcher()
 
+	log.Printf("更新处理并发数: %d", b.updateWorkers)
+	handle := b.updateHandler()
+	pool := newUpdatePool(b.updateWorkers, func(update tgbotapi.Update) {
+		handle(update)
+		b.finishUpdate(update.UpdateID)
+	})
+	b.updatePool = pool
+	b.StartDigestScheduler()
 	for update := range updates {
-		b.handleUpdate(update)
+		if b.beginUpdate(update.UpdateID) {
+			pool.dispatch(b.updateKey(update), update)
+		}
 	}
+	pool.close()
 }
 
-// handleUpdate 函数：新增存储用户信息的调用
-func (b *BotInstance) handleUpdate(update tgbotapi.Update) {
+// routeUpdate 按更新类型分发，是中间件链的最后一环
+func (b *BotInstance) routeUpdate(update tgbotapi.Update) {
 	switch {
 	case update.Message != nil:
-		ctx := context.Background()
-		// 存储用户的信息（用户名和昵称）
-		if update.Message.From != nil {
-			err := b.redisClient.StoreUserInfo(ctx, update.Message.From)
-			if err != nil {
-				log.Printf("存储用户 %d 信息失败: %v", update.Message.From.ID, err)
-			}
-		}
-		// 仅当用户未被拉黑时才记录
-		isBlocked, _ := b.redisClient.IsUserBlocked(ctx, update.Message.From.ID)
-		if !isBlocked {
-			b.redisClient.CheckAndAddUser(ctx, cache.UsersSetKey, update.Message.From.ID)
-		}
 		b.handleMessage(update.Message)
+	case update.EditedMessage != nil:
+		b.handleEditedMessage(update.EditedMessage)
+	case update.InlineQuery != nil:
+		b.handleInlineQuery(update.InlineQuery)
+	case update.PreCheckoutQuery != nil:
+		b.handlePreCheckoutQuery(update.PreCheckoutQuery)
 	case update.CallbackQuery != nil:
-		b.handleCallbackQuery(update.CallbackQuery)
+		q := update.CallbackQuery
+		if !b.isAdmin(q.From.ID) {
+			b.handleUserCallbackQuery(q)
+			return
+		}
+		if q.Message == nil {
+			b.handleCallbackQuery(q)
+			return
+		}
+		b.restoreAdminSession(q.Message.Chat.ID)
+		b.expireIdleState(q.Message.Chat.ID)
+		b.handleCallbackQuery(q)
+		b.touchAdminState(q.Message.Chat.ID)
+		b.saveAdminSession(q.Message.Chat.ID)
+	}
+}
+
+// handleInlineQuery 只为管理员提供自动回复内容的内联查询，其他用户得到空结果
+func (b *BotInstance) handleInlineQuery(q *tgbotapi.InlineQuery) {
+	if b.isAdmin(q.From.ID) {
+		b.autoreplyManager.HandleInlineQuery(q)
+		return
+	}
+	answer := tgbotapi.InlineConfig{InlineQueryID: q.ID, Results: []interface{}{}, IsPersonal: true, CacheTime: 300}
+	if _, err := b.API.Request(answer); err != nil {
+		log.Printf("回答用户 %d 的内联查询失败: %v", q.From.ID, err)
 	}
 }
 
 // isAdmin 函数保持不变
 func (b *BotInstance) isAdmin(userID int64) bool {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
 	return b.adminIDs[userID]
 }
 
 // handleMessage 函数保持不变
 func (b *BotInstance) handleMessage(msg *tgbotapi.Message) {
+	// 转发目标为群组时，群内的频道自动转发和非管理员成员的消息都不是客户消息
+	if b.isForwardTarget(msg.Chat.ID) && !msg.Chat.IsPrivate() {
+		if msg.IsAutomaticForward || !b.isAdmin(msg.From.ID) {
+			return
+		}
+	}
 	if b.isAdmin(msg.From.ID) {
+		b.restoreAdminSession(msg.Chat.ID)
+		b.expireIdleState(msg.Chat.ID)
 		b.handleAdminMessage(msg)
+		b.saveAdminSession(msg.Chat.ID)
 	} else {
 		b.handleUserMessage(msg)
 	}
@@ -147,33 +443,28 @@ func (b *BotInstance) handleMessage(msg *tgbotapi.Message) {
 
 // handleAdminMessage 更新了管理员回复的逻辑
 func (b *BotInstance) handleAdminMessage(msg *tgbotapi.Message) {
-	if msg.ReplyToMessage != nil && b.forwardToAdminID == msg.Chat.ID {
-		var originalUserID int64
-
-		// 从被回复消息的文本或标题中解析用户ID
-		var textToParse string
-		if msg.ReplyToMessage.Text != "" {
-			textToParse = msg.ReplyToMessage.Text
-		} else if msg.ReplyToMessage.Caption != "" {
-			textToParse = msg.ReplyToMessage.Caption
-		}
-
-		if textToParse != "" {
-			re := regexp.MustCompile(`\((\d+)\)`)
-			matches := re.FindStringSubmatch(textToParse)
-			if len(matches) > 1 {
-				id, err := strconv.ParseInt(matches[1], 10, 64)
-				if err == nil {
-					originalUserID = id
-				}
-			}
-		}
+	if msg.IsCommand() && msg.Command() == "close" && b.topicsManager.Enabled() && msg.Chat.ID == b.topicsManager.GroupID {
+		b.handleCloseTopic(msg)
+		return
+	}
 
-		if originalUserID != 0 {
+	// /reply 自行决定发送对象，即使回复的是转发消息也不按转发映射路由
+	if msg.ReplyToMessage != nil && b.isForwardTarget(msg.Chat.ID) && msg.Command() != "reply" {
+		target, ok := b.resolveReplyTarget(msg.Chat.ID, msg.ReplyToMessage)
+
+		if ok {
+			originalUserID := target.ChatID
+			if msg.MediaGroupID != "" {
+				b.mediaGroups.add(msg, func(msgs []*tgbotapi.Message) { b.replyAlbum(msgs, target) })
+				return
+			}
 			var replyMsg tgbotapi.Chattable
+			var translatedTo string
 			// 根据管理员回复的消息类型创建相应的消息
 			if msg.Text != "" {
-				replyMsg = tgbotapi.NewMessage(originalUserID, msg.Text)
+				var text string
+				text, translatedTo = b.translateOutbound(originalUserID, msg.Text)
+				replyMsg = tgbotapi.NewMessage(originalUserID, text)
 			} else if msg.Sticker != nil {
 				replyMsg = tgbotapi.NewSticker(originalUserID, tgbotapi.FileID(msg.Sticker.FileID))
 			} else if len(msg.Photo) > 0 {
@@ -184,29 +475,64 @@ func (b *BotInstance) handleAdminMessage(msg *tgbotapi.Message) {
 				video := tgbotapi.NewVideo(originalUserID, tgbotapi.FileID(msg.Video.FileID))
 				video.Caption = msg.Caption
 				replyMsg = video
+			} else if msg.Animation != nil {
+				animation := tgbotapi.NewAnimation(originalUserID, tgbotapi.FileID(msg.Animation.FileID))
+				animation.Caption = msg.Caption
+				replyMsg = animation
 			} else if msg.Document != nil {
 				doc := tgbotapi.NewDocument(originalUserID, tgbotapi.FileID(msg.Document.FileID))
 				doc.Caption = msg.Caption
 				replyMsg = doc
+			} else if msg.Voice != nil {
+				voice := tgbotapi.NewVoice(originalUserID, tgbotapi.FileID(msg.Voice.FileID))
+				voice.Caption = msg.Caption
+				replyMsg = voice
+			} else if msg.Audio != nil {
+				audio := tgbotapi.NewAudio(originalUserID, tgbotapi.FileID(msg.Audio.FileID))
+				audio.Caption = msg.Caption
+				replyMsg = audio
+			} else if msg.VideoNote != nil {
+				replyMsg = tgbotapi.NewVideoNote(originalUserID, msg.VideoNote.Length, tgbotapi.FileID(msg.VideoNote.FileID))
+			} else if msg.Venue != nil {
+				replyMsg = tgbotapi.NewVenue(originalUserID, msg.Venue.Title, msg.Venue.Address, msg.Venue.Location.Latitude, msg.Venue.Location.Longitude)
+			} else if msg.Location != nil {
+				replyMsg = tgbotapi.NewLocation(originalUserID, msg.Location.Latitude, msg.Location.Longitude)
+			} else if msg.Contact != nil {
+				contact := tgbotapi.NewContact(originalUserID, msg.Contact.PhoneNumber, msg.Contact.FirstName)
+				contact.LastName = msg.Contact.LastName
+				replyMsg = contact
+			} else if msg.Poll != nil {
+				// 重新发起同样的投票，而不是转发，避免暴露管理员身份
+				options := make([]string, 0, len(msg.Poll.Options))
+				for _, option := range msg.Poll.Options {
+					options = append(options, option.Text)
+				}
+				poll := tgbotapi.NewPoll(originalUserID, msg.Poll.Question, options...)
+				poll.AllowsMultipleAnswers = msg.Poll.AllowsMultipleAnswers
+				replyMsg = poll
 			}
 
 			if replyMsg != nil {
-				_, err := b.API.Send(replyMsg)
+				sent, err := b.API.Send(replyMsg)
 				if err != nil {
-					log.Printf("回复用户 %d 失败: %v", originalUserID, err)
-					failMsg := tgbotapi.NewMessage(b.forwardToAdminID, fmt.Sprintf("❌ 回复用户 %d 失败。", originalUserID))
-					b.API.Send(failMsg)
+					log.Printf("管理员 %d 回复用户 %d 失败: %v", msg.From.ID, originalUserID, err)
+					b.replyInThread(msg, fmt.Sprintf("❌ 回复用户 %d 失败：%s", originalUserID, classifySendError(err)))
 				} else {
-					confirmMsg := tgbotapi.NewMessage(b.forwardToAdminID, "✅ 已回复给用户。")
-					b.API.Send(confirmMsg)
+					b.linkMessage(msg.Chat.ID, msg.MessageID, originalUserID, sent.MessageID, messageText(msg))
+					b.recordAdminReply(msg.From, target.UserID, msg)
+					b.markForwardAnswered(msg.Chat.ID, target, msg.From)
+					if msg.Chat.IsPrivate() {
+						b.replyInThread(msg, "✅ 已回复给用户。"+translatedNote(translatedTo))
+					} else {
+						// 群内可能有多位管理员，注明由谁回复，避免重复处理
+						b.replyInThread(msg, fmt.Sprintf("✅ 已由 %s 回复给用户。%s", adminDisplayName(msg.From), translatedNote(translatedTo)))
+					}
 				}
 			} else {
-				failMsg := tgbotapi.NewMessage(b.forwardToAdminID, "❌ 回复失败，不支持的消息类型。")
-				b.API.Send(failMsg)
+				b.replyInThread(msg, "❌ 回复失败，不支持的消息类型。")
 			}
 		} else {
-			failMsg := tgbotapi.NewMessage(b.forwardToAdminID, "❌ 回复失败，无法从此消息中解析到用户ID。")
-			b.API.Send(failMsg)
+			b.replyInThread(msg, "❌ 回复失败，找不到此消息对应的用户（可能不是用户消息，或转发记录已过期）。")
 		}
 		return
 	}
@@ -214,33 +540,90 @@ func (b *BotInstance) handleAdminMessage(msg *tgbotapi.Message) {
 	// 处理管理员命令的逻辑
 	if msg.IsCommand() {
 		log.Printf("收到命令 %s 从 chatID %d", msg.Command(), msg.Chat.ID)
-		switch msg.Command() {
-		case "start":
-			b.setCommandsForUser(msg.Chat.ID)
-			b.welcomeManager.HandleStartCommand(msg.Chat.ID)
-		case "setwelcome":
-			b.welcomeManager.StartSetWelcomeProcess(msg.Chat.ID)
-		case "setbuttons":
-			b.welcomeManager.StartSetButtonsProcess(msg.Chat.ID)
-		case "broadcast":
-			b.broadcastManager.StartBroadcastBuilder(msg.Chat.ID)
-		case "listblocked":
-			b.handleListBlocked(msg.Chat.ID, 1)
-		case "stats":
-			b.handleUserStats(msg.Chat.ID)
-		default:
+		cmd, ok := b.adminCommands.lookup(msg.Command())
+		if !ok {
+			// 未注册的命令交给正在进行的编辑流程处理
 			b.handleAdminStatefulMessage(msg)
+			return
+		}
+		if !b.roleAllows(msg.From.ID, cmd.Role) {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 您没有权限使用该命令，请联系超级管理员。"))
+			return
 		}
+		cmd.Handler(msg)
+		b.touchAdminState(msg.Chat.ID)
 		return
 	}
 
 	b.handleAdminStatefulMessage(msg)
 }
 
-// handleListBlocked 函数：修改以显示用户名和昵称
-func (b *BotInstance) handleListBlocked(chatID int64, page int) {
+// blockedListPos 是拉黑列表中一页的起点：SSCAN 游标 cursor 返回的那批成员中跳过前 skip 个，
+// offset 为之前各页已列出的用户数。游标无法回退，因此只提供“下一页”和“第一页”。
+type blockedListPos struct {
+	cursor uint64
+	skip   int
+	offset int
+}
+
+// blockedPagePrefix 拉黑列表翻页按钮的回调数据前缀，格式为 blocked_page_<cursor>_<skip>_<offset>
+const blockedPagePrefix = "blocked_page_"
+
+func (p blockedListPos) callbackData() string {
+	return fmt.Sprintf("%s%d_%d_%d", blockedPagePrefix, p.cursor, p.skip, p.offset)
+}
+
+// parseBlockedListPos 解析翻页按钮的回调数据，格式不正确时返回第一页
+func parseBlockedListPos(data string) blockedListPos {
+	parts := strings.Split(strings.TrimPrefix(data, blockedPagePrefix), "_")
+	if len(parts) != 3 {
+		return blockedListPos{}
+	}
+	cursor, err1 := strconv.ParseUint(parts[0], 10, 64)
+	skip, err2 := strconv.Atoi(parts[1])
+	offset, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil || skip < 0 || offset < 0 {
+		return blockedListPos{}
+	}
+	return blockedListPos{cursor: cursor, skip: skip, offset: offset}
+}
+
+// scanBlockedPage 从 pos 开始用 SSCAN 读取最多 UsersPerPage 个被拉黑的用户，并返回下一页的起点，more 表示可能还有下一页
+func (b *BotInstance) scanBlockedPage(ctx context.Context, pos blockedListPos) (ids []string, next blockedListPos, more bool, err error) {
+	cursor, skip := pos.cursor, pos.skip
+	for {
+		batch, nextCursor, err := b.redisClient.ScanBlockedUserIDs(ctx, cursor, UsersPerPage)
+		if err != nil {
+			return nil, blockedListPos{}, false, err
+		}
+		batch = batch[min(skip, len(batch)):]
+		need := UsersPerPage - len(ids)
+		if len(batch) > need {
+			// 本批还有剩余，下一页从同一游标开始并跳过已列出的成员
+			ids = append(ids, batch[:need]...)
+			return ids, blockedListPos{cursor: cursor, skip: skip + need, offset: pos.offset + len(ids)}, true, nil
+		}
+		ids = append(ids, batch...)
+		if nextCursor == 0 {
+			return ids, blockedListPos{}, false, nil
+		}
+		cursor, skip = nextCursor, 0
+		if len(ids) == UsersPerPage {
+			return ids, blockedListPos{cursor: cursor, offset: pos.offset + len(ids)}, true, nil
+		}
+	}
+}
+
+// handleListBlocked 按页列出被拉黑的用户（显示用户名和昵称），pos 为该页的起点
+func (b *BotInstance) handleListBlocked(chatID int64, pos blockedListPos) {
 	ctx := context.Background()
-	blockedIDs, err := b.redisClient.GetBlockedUserIDs(ctx)
+	total, err := b.redisClient.CountUserIDs(ctx, cache.BlockedUsersSet)
+	var currentIDs []string
+	var next blockedListPos
+	var more bool
+	if err == nil {
+		currentIDs, next, more, err = b.scanBlockedPage(ctx, pos)
+	}
 	if err != nil {
 		log.Printf("获取拉黑用户列表失败: %v", err)
 		failMsg := tgbotapi.NewMessage(chatID, "❌ 获取拉黑用户列表失败。")
@@ -248,28 +631,21 @@ func (b *BotInstance) handleListBlocked(chatID int64, page int) {
 		return
 	}
 
-	if len(blockedIDs) == 0 {
+	if len(currentIDs) == 0 {
+		if pos.offset > 0 {
+			// 翻页期间有用户被解除拉黑，后面已经没有用户了，回到第一页
+			b.handleListBlocked(chatID, blockedListPos{})
+			return
+		}
 		noBlockedMsg := tgbotapi.NewMessage(chatID, "当前没有拉黑的用户。")
 		b.API.Send(noBlockedMsg)
 		return
 	}
 
-	totalPages := (len(blockedIDs) + UsersPerPage - 1) / UsersPerPage
-	if page < 1 || page > totalPages {
-		page = 1
-	}
-
-	start := (page - 1) * UsersPerPage
-	end := start + UsersPerPage
-	if end > len(blockedIDs) {
-		end = len(blockedIDs)
-	}
-	currentIDs := blockedIDs[start:end]
-
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("拉黑用户列表 (第 %d/%d 页):\n", page, totalPages))
+	sb.WriteString(fmt.Sprintf("拉黑用户列表 (共 %d 位，第 %d-%d 位):\n", total, pos.offset+1, pos.offset+len(currentIDs)))
 	for i, idStr := range currentIDs {
-		index := start + i + 1
+		index := pos.offset + i + 1
 		userID, _ := strconv.ParseInt(idStr, 10, 64)
 		firstName, lastName, username, err := b.redisClient.GetUserInfo(ctx, userID)
 		if err != nil {
@@ -310,17 +686,15 @@ func (b *BotInstance) handleListBlocked(chatID int64, page int) {
 		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(unblockButton))
 	}
 
-	if totalPages > 1 {
-		var paginationRow []tgbotapi.InlineKeyboardButton
-		if page > 1 {
-			paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData("上一页", fmt.Sprintf("page_prev_%d", page-1)))
-		}
-		if page < totalPages {
-			paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData("下一页", fmt.Sprintf("page_next_%d", page+1)))
-		}
-		if len(paginationRow) > 0 {
-			keyboard = append(keyboard, paginationRow)
-		}
+	var paginationRow []tgbotapi.InlineKeyboardButton
+	if pos.offset > 0 {
+		paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData("第一页", blockedListPos{}.callbackData()))
+	}
+	if more {
+		paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData("下一页", next.callbackData()))
+	}
+	if len(paginationRow) > 0 {
+		keyboard = append(keyboard, paginationRow)
 	}
 
 	listMsg := tgbotapi.NewMessage(chatID, sb.String())
@@ -330,33 +704,192 @@ func (b *BotInstance) handleListBlocked(chatID int64, page int) {
 	b.API.Send(listMsg)
 }
 
-// handleUserStats 函数保持不变
-func (b *BotInstance) handleUserStats(chatID int64) {
+// maxUnreachableListed /unreachable 最多列出的用户数
+const maxUnreachableListed = 50
+
+// handleUnreachable 查看已屏蔽机器人的用户，"/unreachable clear" 清空该列表
+func (b *BotInstance) handleUnreachable(msg *tgbotapi.Message) {
 	ctx := context.Background()
-	userIDs, err := b.redisClient.GetAllUserIDs(ctx, cache.UsersSetKey)
+	if strings.TrimSpace(msg.CommandArguments()) == "clear" {
+		if err := b.redisClient.ClearUnreachableUsers(ctx); err != nil {
+			log.Printf("清空不可达用户失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 清空失败。"))
+			return
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已清空屏蔽机器人的用户列表，下次广播将重新尝试发送给他们。"))
+		return
+	}
+
+	userIDs, err := b.redisClient.GetUnreachableUserIDs(ctx)
+	if err != nil {
+		log.Printf("获取不可达用户失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取屏蔽机器人的用户列表失败。"))
+		return
+	}
+	if len(userIDs) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "当前没有屏蔽机器人的用户。"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("屏蔽机器人的用户共 %d 位（广播时自动跳过）：\n", len(userIDs)))
+	for i, idStr := range userIDs {
+		if i == maxUnreachableListed {
+			sb.WriteString(fmt.Sprintf("… 另有 %d 位未列出\n", len(userIDs)-maxUnreachableListed))
+			break
+		}
+		sb.WriteString(idStr + "\n")
+	}
+	sb.WriteString("\n发送 /unreachable clear 可清空列表。用户再次给机器人发消息时会自动移出列表。")
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+}
+
+// handleUserStats 处理 /stats：读取增量维护的计数器，避免每次统计都加载整个用户集合，
+// 并附上增长、每日消息和响应时间等统计；"/stats chart" 发送每日消息数图表
+func (b *BotInstance) handleUserStats(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if strings.TrimSpace(msg.CommandArguments()) == "chart" {
+		b.sendStatsChart(chatID)
+		return
+	}
+	counters, err := b.redisClient.GetStatsCounters(context.Background())
 	if err != nil {
 		log.Printf("获取用户统计失败: %v", err)
 		failMsg := tgbotapi.NewMessage(chatID, "❌ 获取用户统计失败。")
 		b.API.Send(failMsg)
 		return
 	}
+	b.API.Send(tgbotapi.NewMessage(chatID, formatStats(counters)+b.growthStatsText()+b.trendStatsText()+b.sourceStatsText()+b.ticketStatsText()))
+}
 
-	totalUsers := len(userIDs)
-	blockedUsers, err := b.redisClient.GetBlockedUserIDs(ctx)
+// sourceStatsText 按人数从多到少列出各深度链接来源首次带来的用户数，没有来源记录时返回空字符串
+func (b *BotInstance) sourceStatsText() string {
+	counts, err := b.redisClient.GetSourceSignups(context.Background())
 	if err != nil {
-		log.Printf("获取拉黑用户统计失败: %v", err)
+		log.Printf("获取来源统计失败: %v", err)
+		return ""
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	sources := make([]string, 0, len(counts))
+	for source := range counts {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if counts[sources[i]] != counts[sources[j]] {
+			return counts[sources[i]] > counts[sources[j]]
+		}
+		return sources[i] < sources[j]
+	})
+	var sb strings.Builder
+	sb.WriteString("\n\n来源统计（首次通过链接进入的用户数）：")
+	for i, source := range sources {
+		if i == maxSourcesListed {
+			sb.WriteString(fmt.Sprintf("\n… 另有 %d 个来源未列出", len(sources)-maxSourcesListed))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("\n- %s: %d", source, counts[source]))
+	}
+	return sb.String()
+}
+
+// handleAddTester 将用户加入广播测试组，不带参数时显示当前测试组
+func (b *BotInstance) handleAddTester(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		testers, err := b.redisClient.GetTestUserIDs(ctx)
+		if err != nil {
+			log.Printf("获取测试组失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取测试组失败。"))
+			return
+		}
+		text := "用法：/addtester <用户ID>"
+		if len(testers) > 0 {
+			text += "\n\n当前测试组：\n" + strings.Join(testers, "\n")
+		} else {
+			text += "\n\n当前测试组为空。"
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		return
 	}
-	blockedCount := len(blockedUsers)
-	activeUsers := totalUsers - blockedCount
 
-	statsMsg := fmt.Sprintf("用户统计：\n- 总用户数: %d\n- 活跃用户数: %d\n- 拉黑用户数: %d", totalUsers, activeUsers, blockedCount)
-	msg := tgbotapi.NewMessage(chatID, statsMsg)
-	b.API.Send(msg)
+	var added []string
+	for _, arg := range args {
+		userID, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || userID == 0 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 无效的用户ID：%s", arg)))
+			continue
+		}
+		if err := b.redisClient.AddTestUser(ctx, userID); err != nil {
+			log.Printf("添加测试用户 %d 失败: %v", userID, err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 添加测试用户 %d 失败。", userID)))
+			continue
+		}
+		added = append(added, arg)
+	}
+	if len(added) > 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已加入测试组："+strings.Join(added, ", ")))
+	}
+}
+
+// handleRemoveTesters 移除指定的测试用户，不带参数时清空测试组
+func (b *BotInstance) handleRemoveTesters(msg *tgbotapi.Message) {
+	var userIDs []int64
+	for _, arg := range strings.Fields(msg.CommandArguments()) {
+		userID, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 无效的用户ID：%s", arg)))
+			return
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := b.redisClient.RemoveTestUsers(context.Background(), userIDs...); err != nil {
+		log.Printf("移除测试用户失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 移除测试用户失败。"))
+		return
+	}
+	if len(userIDs) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 测试组已清空。"))
+	} else {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已移除 %d 位测试用户。", len(userIDs))))
+	}
+}
+
+// handleRecountStats 从权威集合重建统计计数器
+func (b *BotInstance) handleRecountStats(chatID int64) {
+	counters, err := b.redisClient.RecountStats(context.Background())
+	if err != nil {
+		log.Printf("重建统计计数器失败: %v", err)
+		failMsg := tgbotapi.NewMessage(chatID, "❌ 重建统计计数器失败。")
+		b.API.Send(failMsg)
+		return
+	}
+	b.API.Send(tgbotapi.NewMessage(chatID, "✅ 统计计数器已重建。\n\n"+formatStats(counters)))
+}
+
+func formatStats(counters cache.StatsCounters) string {
+	activeUsers := counters.Total - counters.Blocked
+	text := fmt.Sprintf("用户统计：\n- 总用户数: %d\n- 活跃用户数: %d\n- 拉黑用户数: %d\n- 退订广播用户数: %d\n- 已屏蔽机器人用户数: %d\n- 可送达广播用户数: %d",
+		counters.Total, activeUsers, counters.Blocked, counters.OptOut, counters.Unreachable, counters.Reachable)
+	if counters.Total > 0 {
+		text += fmt.Sprintf("\n- 拉黑率: %.1f%%", float64(counters.Blocked)*100/float64(counters.Total))
+	}
+	return text
 }
 
 // handleAdminStatefulMessage 修改以支持广播和欢迎消息处理
 func (b *BotInstance) handleAdminStatefulMessage(msg *tgbotapi.Message) {
 	log.Printf("处理管理员状态消息，chatID %d，当前状态: %d", msg.Chat.ID, b.adminStates[msg.Chat.ID])
+	b.touchAdminState(msg.Chat.ID)
+	if b.handlePendingImport(msg) {
+		return
+	}
+	if b.handlePendingSetting(msg) {
+		return
+	}
 	if b.welcomeManager.HandleAdminMessageInput(msg) {
 		log.Printf("处理管理员消息（chatID %d）：已由 welcomeManager 处理", msg.Chat.ID)
 		return
@@ -365,11 +898,37 @@ func (b *BotInstance) handleAdminStatefulMessage(msg *tgbotapi.Message) {
 		log.Printf("处理管理员消息（chatID %d）：已由 broadcastManager 处理", msg.Chat.ID)
 		return
 	}
+	if b.autoreplyManager.HandleAdminMessageInput(msg) {
+		log.Printf("处理管理员消息（chatID %d）：已由 autoreplyManager 处理", msg.Chat.ID)
+		return
+	}
 	log.Printf("未处理的管理员消息（chatID %d）：%v", msg.Chat.ID, msg.Text)
 }
 
+// handleUserCallbackQuery 只处理普通用户可以触发的按钮（关注频道验证、广播按钮、欢迎动作按钮和欢迎菜单），
+// 其他回调会修改管理员的编辑状态，不能由用户触发，也不能与管理员的更新并发处理
+func (b *BotInstance) handleUserCallbackQuery(q *tgbotapi.CallbackQuery) {
+	switch {
+	case q.Data == subscribeCheckCallback:
+		b.handleSubscribeCheckCallback(q)
+	case strings.HasPrefix(q.Data, "bclick_"):
+		b.broadcastManager.HandleCallbackQuery(q)
+	case strings.HasPrefix(q.Data, keyboard.ActionDataPrefix):
+		b.welcomeManager.HandleActionCallback(q)
+	case strings.HasPrefix(q.Data, welcome.MenuCallbackPrefix):
+		b.welcomeManager.HandleMenuCallback(q)
+	default:
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+	}
+}
+
 // handleCallbackQuery 函数保持不变
 func (b *BotInstance) handleCallbackQuery(q *tgbotapi.CallbackQuery) {
+	if !b.callbackAllowed(q.From.ID, q.Data) {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 您没有权限执行该操作，请联系超级管理员。"))
+		return
+	}
+
 	if strings.HasPrefix(q.Data, "unblock_") {
 		parts := strings.Split(q.Data, "_")
 		if len(parts) != 2 {
@@ -385,24 +944,16 @@ func (b *BotInstance) handleCallbackQuery(q *tgbotapi.CallbackQuery) {
 			log.Printf("解除拉黑用户 %d 失败: %v", userID, err)
 			return
 		}
+		b.audit(q.From.ID, cache.AuditUnblock, fmt.Sprintf("用户 %d（黑名单列表）", userID))
 
 		callback := tgbotapi.NewCallback(q.ID, "✅ 用户已解除拉黑")
 		b.API.Request(callback)
-		currentPage := 1
-		b.handleListBlocked(q.Message.Chat.ID, currentPage)
+		b.handleListBlocked(q.Message.Chat.ID, blockedListPos{})
 		return
 	}
 
-	if strings.HasPrefix(q.Data, "page_prev_") || strings.HasPrefix(q.Data, "page_next_") {
-		parts := strings.Split(q.Data, "_")
-		if len(parts) != 3 {
-			return
-		}
-		newPage, err := strconv.Atoi(parts[2])
-		if err != nil {
-			return
-		}
-		b.handleListBlocked(q.Message.Chat.ID, newPage)
+	if strings.HasPrefix(q.Data, blockedPagePrefix) {
+		b.handleListBlocked(q.Message.Chat.ID, parseBlockedListPos(q.Data))
 		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
 		return
 	}
@@ -422,16 +973,81 @@ func (b *BotInstance) handleCallbackQuery(q *tgbotapi.CallbackQuery) {
 			log.Printf("拉黑用户 %d 失败: %v", userID, err)
 			return
 		}
+		b.audit(q.From.ID, cache.AuditBlock, fmt.Sprintf("用户 %d（消息按钮）", userID))
+		b.emitBlocked(userID, q.From.ID, "message")
 
 		callback := tgbotapi.NewCallback(q.ID, "✅ 用户已拉黑")
 		b.API.Request(callback)
 		return
 	}
 
+	if strings.HasPrefix(q.Data, "whois_block_") || strings.HasPrefix(q.Data, "whois_unblock_") {
+		b.handleWhoisCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, spamApprovePrefix) || strings.HasPrefix(q.Data, spamBlockPrefix) {
+		b.handleSpamCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, "resolve_") {
+		b.handleResolveCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, claimCallbackPrefix) {
+		b.handleClaimCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, transferCallbackPrefix) {
+		b.handleTransferCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, inboxPagePrefix) || strings.HasPrefix(q.Data, inboxDonePrefix) {
+		b.handleInboxCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, teamStatsCallback) {
+		b.handleTeamStatsCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, settingsCallbackPrefix) {
+		b.handleSettingsCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, auditPageCallback) {
+		b.handleAuditLogCallback(q)
+		return
+	}
+
 	if b.broadcastManager.HandleCallbackQuery(q) {
 		return
 	}
 
+	if b.autoreplyManager.HandleCallbackQuery(q) {
+		return
+	}
+
+	if b.welcomeManager.HandleCallbackQuery(q) {
+		return
+	}
+
+	if strings.HasPrefix(q.Data, keyboard.ActionDataPrefix) {
+		b.welcomeManager.HandleActionCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, welcome.MenuCallbackPrefix) {
+		b.welcomeManager.HandleMenuCallback(q)
+		return
+	}
+
 	callback := tgbotapi.NewCallback(q.ID, "")
 	b.API.Request(callback)
 }
@@ -445,86 +1061,368 @@ func escapeMarkdownV2(text string) string {
 	return text
 }
 
-// handleUserMessage 函数保持不变
-func (b *BotInstance) handleUserMessage(msg *tgbotapi.Message) {
-	isBlocked, err := b.redisClient.IsUserBlocked(context.Background(), msg.From.ID)
+// forwardHeader 生成转发给管理员的消息标题（MarkdownV2），包含用户名称、ID 及对话链接
+func forwardHeader(user *tgbotapi.User) string {
+	escapedName := escapeMarkdownV2(user.FirstName)
+	return fmt.Sprintf("收到来自用户 [%s \\(%d\\)](tg://user?id=%d) 的消息:", escapedName, user.ID, user.ID)
+}
+
+var (
+	// startTopicPattern 限制深度链接主题名称，Telegram 的 start 参数只允许这些字符
+	startTopicPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+	// startPayloadPattern 是 Telegram 允许的完整 start 参数
+	startPayloadPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// maxSourcesListed 是 /stats 中最多列出的来源数
+const maxSourcesListed = 20
+
+// handleSetWelcome 处理 /setwelcome [语言代码] [clear]：不带参数时编辑默认欢迎语，带语言代码时编辑该语言的欢迎语
+func (b *BotInstance) handleSetWelcome(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.welcomeManager.StartSetWelcomeProcess(msg.Chat.ID)
+		return
+	}
+	lang := welcome.NormalizeLanguage(args[0])
+	if lang == "" || len(args) > 2 || (len(args) == 2 && args[1] != "clear") {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/setwelcome [语言代码] [clear]\n例如：/setwelcome en 设置英文欢迎语，/setwelcome en clear 删除英文欢迎语"))
+		return
+	}
+	if len(args) == 2 {
+		b.welcomeManager.ClearLanguageWelcome(msg.Chat.ID, msg.From.ID, lang)
+		return
+	}
+	b.welcomeManager.StartSetLanguageWelcomeProcess(msg.Chat.ID, lang)
+}
+
+// parseStartSource 返回 "/start <参数>" 中用于来源统计的参数，无效或缺失时返回空字符串
+func parseStartSource(payload string) string {
+	payload = strings.TrimSpace(payload)
+	if !startPayloadPattern.MatchString(payload) {
+		return ""
+	}
+	return payload
+}
+
+// parseStartTopic 从 "/start topic_<名称>" 的参数中解析主题，无效或缺失时返回空字符串
+func parseStartTopic(payload string) string {
+	payload = strings.TrimSpace(payload)
+	if !strings.HasPrefix(payload, "topic_") {
+		return ""
+	}
+	topic := strings.TrimPrefix(payload, "topic_")
+	if !startTopicPattern.MatchString(topic) {
+		return ""
+	}
+	return topic
+}
+
+// isForwardTarget 报告 chatID 是否为接收用户消息的会话（转发目标、路由规则中的会话或话题模式的论坛群组）
+func (b *BotInstance) isForwardTarget(chatID int64) bool {
+	if forwardTo := b.forwardTarget(); forwardTo != 0 && chatID == forwardTo {
+		return true
+	}
+	if b.isRouteTarget(chatID) {
+		return true
+	}
+	return b.topicsManager.Enabled() && chatID == b.topicsManager.GroupID
+}
+
+// resolveReplyTarget 通过转发映射查找管理员所回复的消息来自哪位用户，
+// 与消息类型无关，贴纸、无标题媒体等都能正确路由
+func (b *BotInstance) resolveReplyTarget(chatID int64, replyTo *tgbotapi.Message) (cache.ForwardMapping, bool) {
+	mapping, ok, err := b.redisClient.GetForwardMapping(context.Background(), chatID, replyTo.MessageID)
 	if err != nil {
-		log.Printf("检查用户 %d 是否被拉黑失败: %v", msg.From.ID, err)
+		log.Printf("查询转发映射失败（chatID %d，消息 %d）: %v", chatID, replyTo.MessageID, err)
+	}
+	if ok || !b.topicsManager.Enabled() || chatID != b.topicsManager.GroupID {
+		return mapping, ok
+	}
+
+	// 话题内未显式回复的消息，其 ReplyToMessage 是话题的创建消息，消息 ID 即话题 ID
+	userID, err := b.topicsManager.UserForThread(replyTo.MessageID)
+	if err != nil {
+		log.Printf("查询话题 %d 对应的用户失败: %v", replyTo.MessageID, err)
+	}
+	if userID == 0 {
+		return mapping, false
+	}
+	return cache.ForwardMapping{UserID: userID, ChatID: userID}, true
+}
+
+// handleCloseTopic 关闭管理员所在话题，用户再次发消息时话题会自动重新打开
+func (b *BotInstance) handleCloseTopic(msg *tgbotapi.Message) {
+	if msg.ReplyToMessage == nil {
+		b.replyInThread(msg, "请在用户的话题中发送 /close。")
 		return
 	}
-	if isBlocked {
-		blockedMsg := tgbotapi.NewMessage(msg.Chat.ID, "您已经被拉黑，暂时无法使用。")
-		b.API.Send(blockedMsg)
+	target, ok := b.resolveReplyTarget(msg.Chat.ID, msg.ReplyToMessage)
+	if !ok {
+		b.replyInThread(msg, "❌ 找不到此话题对应的用户。")
 		return
 	}
+	b.replyInThread(msg, fmt.Sprintf("✅ 话题已由 %s 关闭，用户再次发消息时将自动重新打开。", adminDisplayName(msg.From)))
+	if err := b.topicsManager.CloseUserTopic(target.UserID); err != nil {
+		log.Printf("关闭用户 %d 的话题失败: %v", target.UserID, err)
+		b.replyInThread(msg, "❌ 关闭话题失败："+err.Error())
+	}
+}
+
+// replyInThread 以回复的形式在管理员消息所在的会话中发送提示。
+// 回复消息会被 Telegram 放入原消息所在的话题，因此群组话题中的提示不会跑到其他话题或私聊。
+func (b *BotInstance) replyInThread(msg *tgbotapi.Message, text string) {
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyToMessageID = msg.MessageID
+	reply.AllowSendingWithoutReply = true
+	if _, err := b.API.Send(reply); err != nil {
+		log.Printf("发送提示到 chatID %d 失败: %v", msg.Chat.ID, err)
+	}
+}
 
-	if msg.IsCommand() && msg.Command() == "start" {
-		b.setCommandsForUser(msg.Chat.ID)
-		b.welcomeManager.HandleStartCommand(msg.Chat.ID)
+// adminDisplayName 返回管理员的显示名称，优先使用用户名
+func adminDisplayName(user *tgbotapi.User) string {
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = strconv.FormatInt(user.ID, 10)
+	}
+	return name
+}
+
+// handleSelfTest 模拟一次完整的转发与回复流程，逐步报告配置是否正确
+func (b *BotInstance) handleSelfTest(msg *tgbotapi.Message) {
+	var sb strings.Builder
+	sb.WriteString("🔧 自检结果：\n")
+	report := func(ok bool, step, detail string) {
+		mark := "✅"
+		if !ok {
+			mark = "❌"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s：%s\n", mark, step, detail))
+	}
+	defer func() {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.redisClient.Ping(ctx); err != nil {
+		report(false, "Redis 连接", err.Error())
+	} else {
+		report(true, "Redis 连接", "正常")
+	}
+
+	forwardTo := b.forwardTarget()
+	if forwardTo == 0 {
+		report(false, "转发目标", "未配置 FORWARD_TO_ADMIN_ID，用户消息无法转发")
 		return
 	}
+	report(true, "转发目标", strconv.FormatInt(forwardTo, 10))
 
-	if b.forwardToAdminID != 0 {
-		escapedName := escapeMarkdownV2(msg.From.FirstName)
-		caption := fmt.Sprintf("收到来自用户 [%s \\(%d\\)](tg://user?id=%d) 的消息:", escapedName, msg.From.ID, msg.From.ID)
+	// 以管理员本人作为“用户”发送一条与正式转发格式相同的测试消息
+	testMsg := tgbotapi.NewMessage(forwardTo, forwardHeader(msg.From)+"\n\n"+escapeMarkdownV2("这是一条自检消息，回复它即可测试回复路由。"))
+	testMsg.ParseMode = "MarkdownV2"
+	sent, err := b.API.Send(testMsg)
+	if err != nil {
+		report(false, "发送测试转发", classifySendError(err).String()+"（机器人可能不在目标会话中或没有发言权限）")
+		return
+	}
+	report(true, "发送测试转发", fmt.Sprintf("消息 ID %d", sent.MessageID))
 
-		isBlocked, _ := b.redisClient.IsUserBlocked(context.Background(), msg.From.ID)
-		var blockButton tgbotapi.InlineKeyboardButton
-		if isBlocked {
-			blockButton = tgbotapi.NewInlineKeyboardButtonData("解除拉黑", fmt.Sprintf("unblock_%d", msg.From.ID))
-		} else {
-			blockButton = tgbotapi.NewInlineKeyboardButtonData("拉黑用户", fmt.Sprintf("block_%d", msg.From.ID))
-		}
-		dialogButton := tgbotapi.NewInlineKeyboardButtonURL("与用户对话", fmt.Sprintf("tg://user?id=%d", msg.From.ID))
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(dialogButton, blockButton))
-
-		var toAdminMsg tgbotapi.Chattable
-		if msg.Text != "" {
-			escapedText := escapeMarkdownV2(msg.Text)
-			m := tgbotapi.NewMessage(b.forwardToAdminID, caption+"\n\n"+escapedText)
-			m.ParseMode = "MarkdownV2"
-			m.ReplyMarkup = keyboard
-			toAdminMsg = m
-		} else if len(msg.Photo) > 0 {
-			p := tgbotapi.NewPhoto(b.forwardToAdminID, tgbotapi.FileID(msg.Photo[len(msg.Photo)-1].FileID))
-			p.Caption = caption
-			p.ParseMode = "MarkdownV2"
-			p.ReplyMarkup = &keyboard
-			toAdminMsg = p
-		} else if msg.Sticker != nil {
-			s := tgbotapi.NewSticker(b.forwardToAdminID, tgbotapi.FileID(msg.Sticker.FileID))
-			b.API.Send(s)
-			m := tgbotapi.NewMessage(b.forwardToAdminID, caption)
-			m.ParseMode = "MarkdownV2"
-			m.ReplyMarkup = keyboard
-			toAdminMsg = m
-		} else if msg.Video != nil {
-			v := tgbotapi.NewVideo(b.forwardToAdminID, tgbotapi.FileID(msg.Video.FileID))
-			v.Caption = caption
-			v.ParseMode = "MarkdownV2"
-			v.ReplyMarkup = &keyboard
-			toAdminMsg = v
-		} else if msg.Document != nil {
-			d := tgbotapi.NewDocument(b.forwardToAdminID, tgbotapi.FileID(msg.Document.FileID))
-			d.Caption = caption
-			d.ParseMode = "MarkdownV2"
-			d.ReplyMarkup = &keyboard
-			toAdminMsg = d
+	mapping := cache.ForwardMapping{UserID: msg.From.ID, ChatID: msg.Chat.ID, MessageID: msg.MessageID}
+	if err := b.redisClient.SaveForwardMapping(ctx, forwardTo, sent.MessageID, mapping); err != nil {
+		report(false, "保存转发映射", err.Error())
+		return
+	}
+	report(true, "保存转发映射", "正常")
+
+	target, _ := b.resolveReplyTarget(forwardTo, &sent)
+	resolvedID := target.UserID
+	if resolvedID != msg.From.ID {
+		report(false, "回复路由解析", fmt.Sprintf("解析得到 %d，期望 %d", resolvedID, msg.From.ID))
+		return
+	}
+	report(true, "回复路由解析", fmt.Sprintf("已解析回您的 ID %d", resolvedID))
+
+	if forwardTo != msg.From.ID {
+		sb.WriteString("\n提示：转发目标不是您的私聊，请确认您能在目标会话中看到测试消息。")
+	}
+	sb.WriteString("\n请在转发目标中回复测试消息，若收到“✅ 已回复给用户。”且您的私聊收到回复内容，则回复路由工作正常。")
+}
+
+// sendFailure 表示一次 Send 调用失败的大致原因
+type sendFailure int
+
+const (
+	sendFailureNone sendFailure = iota
+	sendFailureOther
+	sendFailureTooBig
+	sendFailureUnsupported
+	sendFailureBlocked
+	sendFailureChatNotFound
+	sendFailureRateLimited
+)
+
+// String 返回可直接展示给管理员的失败原因
+func (f sendFailure) String() string {
+	switch f {
+	case sendFailureNone:
+		return "无"
+	case sendFailureTooBig:
+		return "文件过大，超出 Telegram 机器人限制"
+	case sendFailureUnsupported:
+		return "不支持的消息或文件类型"
+	case sendFailureBlocked:
+		return "用户已屏蔽机器人"
+	case sendFailureChatNotFound:
+		return "找不到该用户的会话（用户可能已注销或从未启动机器人）"
+	case sendFailureRateLimited:
+		return "发送过于频繁，被 Telegram 限流"
+	}
+	return "未知错误"
+}
+
+// classifySendError 根据 Telegram 返回的错误描述归类失败原因
+func classifySendError(err error) sendFailure {
+	if err == nil {
+		return sendFailureNone
+	}
+	text := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(text, "too big"), strings.Contains(text, "too large"):
+		return sendFailureTooBig
+	case strings.Contains(text, "wrong file identifier"),
+		strings.Contains(text, "can't use file of type"),
+		strings.Contains(text, "type of file mismatch"),
+		strings.Contains(text, "wrong type of the web page content"),
+		strings.Contains(text, "message can't be copied"),
+		strings.Contains(text, "photo_invalid_dimensions"):
+		return sendFailureUnsupported
+	case strings.Contains(text, "bot was blocked by the user"), strings.Contains(text, "user is deactivated"):
+		return sendFailureBlocked
+	case strings.Contains(text, "chat not found"):
+		return sendFailureChatNotFound
+	case strings.Contains(text, "too many requests"):
+		return sendFailureRateLimited
+	}
+	return sendFailureOther
+}
+
+// saveForwardMapping 记录转发到管理员会话 adminChatID 的消息 messageID 来自用户消息 msg，供管理员回复时路由；
+// headerID 为同一次转发的标题消息，回复后在标题上标记已回复，没有时为 0
+func (b *BotInstance) saveForwardMapping(adminChatID int64, messageID, headerID int, msg *tgbotapi.Message) {
+	mapping := cache.ForwardMapping{UserID: msg.From.ID, ChatID: msg.Chat.ID, MessageID: msg.MessageID, HeaderID: headerID}
+	if err := b.redisClient.SaveForwardMapping(context.Background(), adminChatID, messageID, mapping); err != nil {
+		log.Printf("保存转发映射失败（消息 %d，用户 %d）: %v", messageID, msg.From.ID, err)
+	}
+}
+
+// handleUserMessage 转发用户消息给管理员，转发失败时向用户说明原因。黑名单和刷屏限制已在中间件中检查
+func (b *BotInstance) handleUserMessage(msg *tgbotapi.Message) {
+	if msg.SuccessfulPayment != nil {
+		b.handleSuccessfulPayment(msg)
+		return
+	}
+	if msg.IsCommand() {
+		if cmd, ok := b.userCommands.lookup(msg.Command()); ok {
+			cmd.Handler(msg)
+			return
+		}
+	}
+
+	if !b.checkSubscription(msg) {
+		return
+	}
+	if !b.checkBanwords(msg) || !b.checkSpam(msg) {
+		return
+	}
+
+	b.recordUserMessage(msg)
+
+	// 命中自动回复规则的常见问题直接答复，不再转发给客服
+	if !msg.IsCommand() {
+		if reply, ok := b.autoreplyManager.Match(msg.Text); ok {
+			sent, err := b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, reply))
+			if err != nil {
+				log.Printf("发送自动回复给用户 %d 失败: %v", msg.From.ID, err)
+			} else {
+				b.recordHistory(msg.From.ID, cache.HistoryOutbound, "自动回复", &sent)
+			}
+			return
+		}
+	}
+
+	b.handleAwayMessage(msg)
+
+	// 短时间内重复发送的相同内容只在第一次转发的标题上标注次数
+	if b.markRepeat(msg) {
+		return
+	}
+
+	b.forwardUserMessage(msg)
+}
+
+// recordUserMessage 记录用户发来的消息：写入会话和历史，重新打开会话并开始等待回复
+func (b *BotInstance) recordUserMessage(msg *tgbotapi.Message) {
+	// 用户发来新消息时会话重新变为待回复，包括已解决的会话
+	b.recordTicketMessage(msg.From.ID, "用户", msg)
+	b.recordHistory(msg.From.ID, cache.HistoryInbound, "用户", msg)
+	b.emit(eventMessageNew, eventMessage{User: newEventUser(msg.From), MessageID: msg.MessageID, Type: messageType(msg), Text: messageText(msg), Date: msg.Date})
+	b.recordInbound(msg.From.ID)
+	b.updateTicketStatus(msg.From.ID, cache.TicketStatusOpen)
+	b.markAwaitingReply(msg.From.ID)
+	// 用户已主动联系，不再发送跟进消息
+	b.stopDrip(msg.From.ID)
+}
+
+// forwardUserMessage 按话题、路由、相册和汇总设置将用户消息转交给客服，并答复用户转交结果
+func (b *BotInstance) forwardUserMessage(msg *tgbotapi.Message) {
+	if b.topicsManager.Enabled() {
+		b.forwardToTopic(msg)
+		return
+	}
+
+	forwardTo := b.routeTarget(msg)
+	if forwardTo != 0 && msg.MediaGroupID != "" {
+		b.mediaGroups.add(msg, b.forwardAlbum)
+		return
+	}
+
+	// 汇总模式下同一用户在等待时间内的消息合并为一条转发，只在一批的第一条消息时答复用户；VIP 用户的消息总是立即转发
+	if wait := b.digestSettings(); forwardTo != 0 && wait > 0 && !b.isVIP(msg.From.ID) {
+		first, err := b.addDigest(msg, forwardTo, wait)
+		if err != nil {
+			log.Printf("暂存用户 %d 的消息失败，改为立即转发: %v", msg.From.ID, err)
 		} else {
-			m := tgbotapi.NewMessage(b.forwardToAdminID, caption+"\n\n[不支持的消息类型]")
-			m.ParseMode = "MarkdownV2"
-			m.ReplyMarkup = keyboard
-			toAdminMsg = m
-			log.Printf("用户 %d 发送了不支持的消息类型", msg.From.ID)
+			if first {
+				b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, userAckText(sendFailureNone)))
+			}
+			return
 		}
+	}
 
-		if toAdminMsg != nil {
-			if _, err := b.API.Send(toAdminMsg); err != nil {
-				log.Printf("发送消息副本给管理员失败: %v", err)
+	if forwardTo != 0 {
+		// 先发送带用户信息和操作按钮的标题，再用 copyMessage 原样复制用户消息并回复到标题下，
+		// 保留格式、链接和自定义表情，任何可复制的消息类型都无需单独处理
+		var failure sendFailure
+		headerID, headerText, err := b.sendForwardHeader(forwardTo, msg, "")
+		if err != nil {
+			failure = classifySendError(err)
+			log.Printf("发送消息标题给管理员失败（用户 %d，原因：%s）: %v", msg.From.ID, failure, err)
+			b.emailUndelivered(failure, msg)
+		} else {
+			b.rememberRepeatHeader(msg, forwardTo, headerID, headerText)
+			if err := b.copyToAdmin(forwardTo, headerID, msg); err != nil {
+				failure = classifySendError(err)
+				log.Printf("复制消息给管理员失败（用户 %d，原因：%s）: %v", msg.From.ID, failure, err)
+				b.API.Send(tgbotapi.NewMessage(forwardTo, "[无法复制该消息："+failure.String()+"]"))
 			}
 		}
 
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "消息已收到，我们会尽快回复您。")
+		reply := tgbotapi.NewMessage(msg.Chat.ID, userAckText(failure))
 		b.API.Send(reply)
 	} else {
 		reply := tgbotapi.NewMessage(msg.Chat.ID, "抱歉，当前无法处理您的消息。请稍后再试或联系管理员。")
@@ -533,25 +1431,109 @@ func (b *BotInstance) handleUserMessage(msg *tgbotapi.Message) {
 	}
 }
 
-// setCommandsForUser 函数保持不变
-func (b *BotInstance) setCommandsForUser(chatID int64) {
-	var commands []tgbotapi.BotCommand
+// sendForwardHeader 发送转发给管理员的标题：用户信息、body（MarkdownV2）和操作按钮，回复标题即回复 msg 的发送者。
+// VIP 用户的标题会被置顶。返回标题的消息 ID 和文字
+func (b *BotInstance) sendForwardHeader(target int64, msg *tgbotapi.Message, body string) (int, string, error) {
+	header := tgbotapi.NewMessage(target, b.userCaption(msg.From)+body)
+	header.ParseMode = "MarkdownV2"
+	header.ReplyMarkup = b.userKeyboard(target, msg.From.ID)
+	sent, err := b.API.Send(header)
+	if err != nil {
+		return 0, "", err
+	}
+	b.saveForwardHeader(target, sent.MessageID, header.Text)
+	b.saveForwardMapping(target, sent.MessageID, sent.MessageID, msg)
+	if b.isVIP(msg.From.ID) {
+		b.pinVIPMessage(msg.From.ID, target, sent.MessageID)
+	}
+	return sent.MessageID, header.Text, nil
+}
 
-	if b.isAdmin(chatID) {
-		commands = []tgbotapi.BotCommand{
-			{Command: "start", Description: "查看欢迎信息"},
-			{Command: "setwelcome", Description: "设置欢迎语"},
-			{Command: "setbuttons", Description: "设置欢迎按钮"},
-			{Command: "broadcast", Description: "创建广播"},
-			{Command: "listblocked", Description: "查看拉黑用户列表"},
-			{Command: "stats", Description: "查看用户统计"},
-		}
+// copyToAdmin 将用户消息复制到 target 中的标题 headerID 下，记录回复映射和消息关联，并按需附上译文
+func (b *BotInstance) copyToAdmin(target int64, headerID int, msg *tgbotapi.Message) error {
+	copyMsg := tgbotapi.NewCopyMessage(target, msg.Chat.ID, msg.MessageID)
+	copyMsg.ReplyToMessageID = headerID
+	copyMsg.AllowSendingWithoutReply = true
+	copied, err := b.API.CopyMessage(copyMsg)
+	if err != nil {
+		return err
+	}
+	b.saveForwardMapping(target, copied.MessageID, headerID, msg)
+	b.linkMessage(msg.Chat.ID, msg.MessageID, target, copied.MessageID, messageText(msg))
+	b.translateInbound(msg, target, copied.MessageID)
+	return nil
+}
+
+// forwardToTopic 话题模式下将用户消息复制到该用户在论坛群组中的独立话题
+func (b *BotInstance) forwardToTopic(msg *tgbotapi.Message) {
+	var failure sendFailure
+	sentID, err := b.topicsManager.ForwardUserMessage(msg, b.userCaption(msg.From), b.userKeyboard(b.topicsManager.GroupID, msg.From.ID))
+	if err != nil {
+		failure = classifySendError(err)
+		log.Printf("转发用户 %d 的消息到话题失败（原因：%s）: %v", msg.From.ID, failure, err)
+		b.emailUndelivered(failure, msg)
 	} else {
-		commands = []tgbotapi.BotCommand{
-			{Command: "start", Description: "获取欢迎信息"},
+		b.saveForwardMapping(b.topicsManager.GroupID, sentID, 0, msg)
+		b.linkMessage(msg.Chat.ID, msg.MessageID, b.topicsManager.GroupID, sentID, messageText(msg))
+		b.translateInbound(msg, b.topicsManager.GroupID, sentID)
+		if b.isVIP(msg.From.ID) {
+			b.pinVIPMessage(msg.From.ID, b.topicsManager.GroupID, sentID)
 		}
 	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, userAckText(failure)))
+}
 
+// userCaption 生成转发消息的标题（MarkdownV2），附带工单号、用户的来源主题和认领客服，VIP 用户以醒目的标记开头
+func (b *BotInstance) userCaption(user *tgbotapi.User) string {
+	caption := forwardHeader(user)
+	if b.isVIP(user.ID) {
+		caption = escapeMarkdownV2(vipCaption) + "\n" + caption
+	}
+	if ticket := b.userTicket(user.ID); ticket != "" {
+		caption += "\n工单: " + escapeMarkdownV2("#"+ticket)
+	}
+	if topic, _ := b.redisClient.GetUserTopic(context.Background(), user.ID); topic != "" {
+		caption += "\n主题: " + escapeMarkdownV2(topic)
+	}
+	return caption + b.assigneeCaption(user.ID)
+}
+
+// userKeyboard 生成转发到 chatID 的消息下方的“与用户对话”、拉黑/解除拉黑、“标记已解决”及“认领”“转接”按钮
+func (b *BotInstance) userKeyboard(chatID, userID int64) tgbotapi.InlineKeyboardMarkup {
+	isBlocked, _ := b.redisClient.IsUserBlocked(context.Background(), userID)
+	var blockButton tgbotapi.InlineKeyboardButton
+	if isBlocked {
+		blockButton = tgbotapi.NewInlineKeyboardButtonData("解除拉黑", fmt.Sprintf("unblock_%d", userID))
+	} else {
+		blockButton = tgbotapi.NewInlineKeyboardButtonData("拉黑用户", fmt.Sprintf("block_%d", userID))
+	}
+	dialogButton := tgbotapi.NewInlineKeyboardButtonURL("与用户对话", fmt.Sprintf("tg://user?id=%d", userID))
+	rows := [][]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardRow(dialogButton, blockButton)}
+	if ticket := b.userTicket(userID); ticket != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ 标记已解决", "resolve_"+ticket)))
+	}
+	if row := claimButtonRow(chatID, userID); row != nil {
+		rows = append(rows, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// userAckText 根据转发结果生成回复给用户的提示
+func userAckText(failure sendFailure) string {
+	switch {
+	case failure == sendFailureTooBig:
+		return "抱歉，您发送的文件过大，无法转交给客服。请压缩后重试，或改用文字描述您的问题。"
+	case failure == sendFailureUnsupported:
+		return "抱歉，暂不支持该类型的消息。请改为发送文字、图片、视频或文件。"
+	case failure != sendFailureNone:
+		return "抱歉，消息暂时未能转交给客服，请稍后再试。"
+	}
+	return "消息已收到，我们会尽快回复您。"
+}
+
+// setCommandsForUser 函数保持不变
+func (b *BotInstance) setCommandsForUser(chatID int64) {
+	commands := botCommands(b.commandsFor(chatID))
 	config := tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeChat(chatID), commands...)
 	_, err := b.API.Request(config)
 	if err != nil {
@@ -559,8 +1541,18 @@ func (b *BotInstance) setCommandsForUser(chatID int64) {
 	}
 }
 
-// main 函数保持不变
+// main 函数：--check 或 CONFIG_CHECK=1 时只校验配置，不启动机器人
 func main() {
+	check := flag.Bool("check", false, "校验配置后退出，不启动机器人")
+	migratePrefix := flag.Bool("migrate-prefix", false, "将没有前缀的 Redis 键移动到 REDIS_KEY_PREFIX 下后退出")
+	flag.Parse()
+	if *check || os.Getenv("CONFIG_CHECK") == "1" {
+		os.Exit(runConfigCheck())
+	}
+	if *migratePrefix {
+		os.Exit(runPrefixMigration())
+	}
+
 	bot, err := NewBotInstance()
 	if err != nil {
 		log.Fatalf("初始化机器人失败: %v", err)
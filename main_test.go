@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/topics"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestClassifySendError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want sendFailure
+	}{
+		{nil, sendFailureNone},
+		{errors.New("Bad Request: file is too big"), sendFailureTooBig},
+		{errors.New("Request Entity Too Large"), sendFailureTooBig},
+		{errors.New("Bad Request: wrong file identifier/HTTP URL specified"), sendFailureUnsupported},
+		{errors.New("Bad Request: can't use file of type Video as Photo"), sendFailureUnsupported},
+		{errors.New("Bad Request: type of file mismatch"), sendFailureUnsupported},
+		{errors.New("Bad Request: message can't be copied"), sendFailureUnsupported},
+		{errors.New("Bad Request: PHOTO_INVALID_DIMENSIONS"), sendFailureUnsupported},
+		{errors.New("Forbidden: bot was blocked by the user"), sendFailureBlocked},
+		{errors.New("Forbidden: user is deactivated"), sendFailureBlocked},
+		{errors.New("Bad Request: chat not found"), sendFailureChatNotFound},
+		{errors.New("Too Many Requests: retry after 5"), sendFailureRateLimited},
+		{errors.New("Internal Server Error"), sendFailureOther},
+	}
+	for _, tt := range tests {
+		if got := classifySendError(tt.err); got != tt.want {
+			t.Errorf("classifySendError(%v) = %v，期望 %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUserAckText(t *testing.T) {
+	tests := []struct {
+		failure sendFailure
+		want    string
+	}{
+		{sendFailureNone, "消息已收到，我们会尽快回复您。"},
+		{sendFailureTooBig, "抱歉，您发送的文件过大，无法转交给客服。请压缩后重试，或改用文字描述您的问题。"},
+		{sendFailureUnsupported, "抱歉，暂不支持该类型的消息。请改为发送文字、图片、视频或文件。"},
+		{sendFailureBlocked, "抱歉，消息暂时未能转交给客服，请稍后再试。"},
+		{sendFailureRateLimited, "抱歉，消息暂时未能转交给客服，请稍后再试。"},
+		{sendFailureOther, "抱歉，消息暂时未能转交给客服，请稍后再试。"},
+	}
+	for _, tt := range tests {
+		if got := userAckText(tt.failure); got != tt.want {
+			t.Errorf("userAckText(%v) = %q，期望 %q", tt.failure, got, tt.want)
+		}
+	}
+}
+
+func TestParseStartTopic(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{"topic_billing", "billing"},
+		{"  topic_vip-2  ", "vip-2"},
+		{"topic_", ""},
+		{"topic_a b", ""},
+		{"topic_计费", ""},
+		{"topic_" + strings.Repeat("a", 33), ""},
+		{"billing", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseStartTopic(tt.payload); got != tt.want {
+			t.Errorf("parseStartTopic(%q) = %q，期望 %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestParseStartSource(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{"ads_2024", "ads_2024"},
+		{" channel-a ", "channel-a"},
+		{"topic_billing", "topic_billing"},
+		{strings.Repeat("a", 64), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 65), ""},
+		{"a b", ""},
+		{"来源", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseStartSource(tt.payload); got != tt.want {
+			t.Errorf("parseStartSource(%q) = %q，期望 %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlockedListPos(t *testing.T) {
+	tests := []struct {
+		data string
+		want blockedListPos
+	}{
+		{"blocked_page_0_0_0", blockedListPos{}},
+		{"blocked_page_18446744073709551615_3_40", blockedListPos{cursor: 18446744073709551615, skip: 3, offset: 40}},
+		{"blocked_page_12_0_20", blockedListPos{cursor: 12, offset: 20}},
+		{"blocked_page_", blockedListPos{}},
+		{"blocked_page_1_2", blockedListPos{}},
+		{"blocked_page_1_2_3_4", blockedListPos{}},
+		{"blocked_page_x_0_0", blockedListPos{}},
+		{"blocked_page_-1_0_0", blockedListPos{}},
+		{"blocked_page_1_-2_0", blockedListPos{}},
+		{"blocked_page_1_2_-3", blockedListPos{}},
+	}
+	for _, tt := range tests {
+		if got := parseBlockedListPos(tt.data); got != tt.want {
+			t.Errorf("parseBlockedListPos(%q) = %+v，期望 %+v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestBlockedListPosRoundTrip(t *testing.T) {
+	for _, pos := range []blockedListPos{{}, {cursor: 7, skip: 5, offset: 20}, {cursor: 1 << 63, offset: 100}} {
+		data := pos.callbackData()
+		if len(data) > 64 {
+			t.Errorf("回调数据 %q 超过 Telegram 的 64 字节上限", data)
+		}
+		if got := parseBlockedListPos(data); got != pos {
+			t.Errorf("parseBlockedListPos(%q) = %+v，期望 %+v", data, got, pos)
+		}
+	}
+}
+
+// startFakeRedis 启动一个只支持 HGETALL、HGET 的 RESP2 服务，数据来自 hashes，返回监听地址。
+// HELLO 返回错误让客户端退回 RESP2，其他命令一律回复 OK。
+func startFakeRedis(t *testing.T, hashes map[string]map[string]string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("无法监听本地端口: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, hashes)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFakeRedis(conn net.Conn, hashes map[string]map[string]string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		var reply strings.Builder
+		switch strings.ToLower(args[0]) {
+		case "hello":
+			reply.WriteString("-ERR unknown command 'hello'\r\n")
+		case "hgetall":
+			hash := hashes[args[1]]
+			fmt.Fprintf(&reply, "*%d\r\n", len(hash)*2)
+			for field, value := range hash {
+				fmt.Fprintf(&reply, "$%d\r\n%s\r\n$%d\r\n%s\r\n", len(field), field, len(value), value)
+			}
+		case "hget":
+			if value, ok := hashes[args[1]][args[2]]; ok {
+				fmt.Fprintf(&reply, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply.WriteString("$-1\r\n")
+			}
+		case "ping":
+			reply.WriteString("+PONG\r\n")
+		default:
+			reply.WriteString("+OK\r\n")
+		}
+		if _, err := conn.Write([]byte(reply.String())); err != nil {
+			return
+		}
+	}
+}
+
+// readRESPCommand 读取一条以 RESP 数组发送的命令
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("无效的命令: %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestResolveReplyTarget(t *testing.T) {
+	const (
+		adminChat int64 = 1001
+		groupID   int64 = -1002
+	)
+	addr := startFakeRedis(t, map[string]map[string]string{
+		"fwd:1001:10":            {"user_id": "42", "message_id": "7", "header_id": "9"},
+		"fwd:-1002:20":           {"user_id": "43", "chat_id": "-500", "message_id": "8"},
+		cache.ForumTopicUsersKey: {"30": "44"},
+	})
+	rc, err := cache.NewRedisClient(addr, "", 0, "")
+	if err != nil {
+		t.Fatalf("连接模拟 Redis 失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		groupID int64
+		chatID  int64
+		replyTo int
+		want    cache.ForwardMapping
+		wantOK  bool
+	}{
+		{"私聊回复转发的消息", 0, adminChat, 10, cache.ForwardMapping{UserID: 42, ChatID: 42, MessageID: 7, HeaderID: 9}, true},
+		{"私聊回复未知消息", 0, adminChat, 11, cache.ForwardMapping{}, false},
+		{"话题内回复转发的消息", groupID, groupID, 20, cache.ForwardMapping{UserID: 43, ChatID: -500, MessageID: 8}, true},
+		{"话题内未显式回复时按话题 ID 查找用户", groupID, groupID, 30, cache.ForwardMapping{UserID: 44, ChatID: 44}, true},
+		{"未知话题", groupID, groupID, 31, cache.ForwardMapping{}, false},
+		{"未启用话题时不按话题 ID 查找", 0, groupID, 30, cache.ForwardMapping{}, false},
+		{"其他会话不按话题 ID 查找", groupID, adminChat, 30, cache.ForwardMapping{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BotInstance{redisClient: rc, topicsManager: topics.NewManager(nil, rc, tt.groupID)}
+			got, ok := b.resolveReplyTarget(tt.chatID, &tgbotapi.Message{MessageID: tt.replyTo})
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("resolveReplyTarget(%d, %d) = %+v, %v，期望 %+v, %v", tt.chatID, tt.replyTo, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// mediaGroupDelay 相册中的每张图片以独立更新到达，等待这段时间收齐后再一起处理
+const mediaGroupDelay = 1500 * time.Millisecond
+
+// mediaGroupBuffer 按 MediaGroupID 暂存相册消息
+type mediaGroupBuffer struct {
+	mu     sync.Mutex
+	groups map[string][]*tgbotapi.Message
+}
+
+func newMediaGroupBuffer() *mediaGroupBuffer {
+	return &mediaGroupBuffer{groups: make(map[string][]*tgbotapi.Message)}
+}
+
+// add 暂存一条相册消息。收到相册的第一条消息时开始计时，到时后以按消息 ID 排序的整组消息调用 flush；
+// 同一相册后续消息传入的 flush 会被忽略。
+func (mb *mediaGroupBuffer) add(msg *tgbotapi.Message, flush func([]*tgbotapi.Message)) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	id := msg.MediaGroupID
+	_, pending := mb.groups[id]
+	mb.groups[id] = append(mb.groups[id], msg)
+	if pending {
+		return
+	}
+	time.AfterFunc(mediaGroupDelay, func() {
+		mb.mu.Lock()
+		msgs := mb.groups[id]
+		delete(mb.groups, id)
+		mb.mu.Unlock()
+		sort.Slice(msgs, func(i, j int) bool { return msgs[i].MessageID < msgs[j].MessageID })
+		flush(msgs)
+	})
+}
+
+// albumMedia 将相册消息转换为 SendMediaGroup 所需的媒体列表，保留每项原有的标题
+func albumMedia(msgs []*tgbotapi.Message) []interface{} {
+	var media []interface{}
+	for _, msg := range msgs {
+		switch {
+		case len(msg.Photo) > 0:
+			item := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(msg.Photo[len(msg.Photo)-1].FileID))
+			item.Caption = msg.Caption
+			media = append(media, item)
+		case msg.Video != nil:
+			item := tgbotapi.NewInputMediaVideo(tgbotapi.FileID(msg.Video.FileID))
+			item.Caption = msg.Caption
+			media = append(media, item)
+		case msg.Document != nil:
+			item := tgbotapi.NewInputMediaDocument(tgbotapi.FileID(msg.Document.FileID))
+			item.Caption = msg.Caption
+			media = append(media, item)
+		case msg.Audio != nil:
+			item := tgbotapi.NewInputMediaAudio(tgbotapi.FileID(msg.Audio.FileID))
+			item.Caption = msg.Caption
+			media = append(media, item)
+		}
+	}
+	return media
+}
+
+// forwardAlbum 将用户发送的整个相册作为一组转发给管理员，随后发送带操作按钮的标题消息
+func (b *BotInstance) forwardAlbum(msgs []*tgbotapi.Message) {
+	first := msgs[0]
+	forwardTo := b.routeTarget(first)
+	var failure sendFailure
+	sent, err := b.API.SendMediaGroup(tgbotapi.NewMediaGroup(forwardTo, albumMedia(msgs)))
+	if err != nil {
+		failure = classifySendError(err)
+		log.Printf("转发用户 %d 的相册给管理员失败（原因：%s）: %v", first.From.ID, failure, err)
+		b.emailUndelivered(failure, msgs...)
+	} else {
+		header := tgbotapi.NewMessage(forwardTo, b.userCaption(first.From)+"\n\n"+escapeMarkdownV2(fmt.Sprintf("[相册，共 %d 项]", len(sent))))
+		header.ParseMode = "MarkdownV2"
+		header.ReplyMarkup = b.userKeyboard(forwardTo, first.From.ID)
+		headerID := 0
+		if sentHeader, err := b.API.Send(header); err != nil {
+			log.Printf("发送相册标题给管理员失败（用户 %d）: %v", first.From.ID, err)
+		} else {
+			headerID = sentHeader.MessageID
+			b.saveForwardHeader(forwardTo, headerID, header.Text)
+			b.saveForwardMapping(forwardTo, headerID, headerID, first)
+		}
+		for i := range sent {
+			b.saveForwardMapping(forwardTo, sent[i].MessageID, headerID, first)
+			if i < len(msgs) {
+				b.linkMessage(msgs[i].Chat.ID, msgs[i].MessageID, forwardTo, sent[i].MessageID, messageText(msgs[i]))
+			}
+		}
+	}
+	b.API.Send(tgbotapi.NewMessage(first.Chat.ID, userAckText(failure)))
+}
+
+// replyAlbum 将管理员回复的整个相册发送给 target 对应的用户
+func (b *BotInstance) replyAlbum(msgs []*tgbotapi.Message, target cache.ForwardMapping) {
+	first := msgs[0]
+	userChatID := target.ChatID
+	sent, err := b.API.SendMediaGroup(tgbotapi.NewMediaGroup(userChatID, albumMedia(msgs)))
+	if err != nil {
+		log.Printf("管理员 %d 回复相册给用户 %d 失败: %v", first.From.ID, userChatID, err)
+		b.replyInThread(first, "❌ 回复相册失败："+classifySendError(err).String())
+		return
+	}
+	for i := range sent {
+		if i < len(msgs) {
+			b.linkMessage(msgs[i].Chat.ID, msgs[i].MessageID, userChatID, sent[i].MessageID, messageText(msgs[i]))
+		}
+	}
+	b.recordAdminReply(first.From, userChatID, first)
+	b.markForwardAnswered(first.Chat.ID, target, first.From)
+	if first.Chat.IsPrivate() {
+		b.replyInThread(first, "✅ 已将相册回复给用户。")
+	} else {
+		b.replyInThread(first, "✅ 已由 "+adminDisplayName(first.From)+" 将相册回复给用户。")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// updateHandler 处理一条更新
+type updateHandler func(update tgbotapi.Update)
+
+// middleware 包装 updateHandler，可以在调用 next 前后执行逻辑，或不调用 next 以拦截更新
+type middleware func(next updateHandler) updateHandler
+
+// chain 将中间件按顺序套在 handler 外层，第一个中间件最先执行
+func chain(handler updateHandler, middlewares ...middleware) updateHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// updateHandler 返回处理更新的完整流程：异常恢复、日志、用户记录、黑名单、刷屏限制，最后按类型分发
+func (b *BotInstance) updateHandler() updateHandler {
+	return chain(b.routeUpdate,
+		b.recoverMiddleware,
+		b.loggingMiddleware,
+		b.persistUserMiddleware,
+		b.blocklistMiddleware,
+		b.rateLimitMiddleware,
+	)
+}
+
+// updateSender 返回更新的发送者，没有发送者的更新返回 nil
+func updateSender(update tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.EditedMessage != nil:
+		return update.EditedMessage.From
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From
+	case update.InlineQuery != nil:
+		return update.InlineQuery.From
+	}
+	return nil
+}
+
+// updateType 返回更新的类型，用于日志
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	case update.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	}
+	return "other"
+}
+
+// isUserConversation 报告消息是否来自与客服对话的用户，而不是管理员或转发目标群组中的消息
+func (b *BotInstance) isUserConversation(msg *tgbotapi.Message) bool {
+	if msg.From == nil || b.isAdmin(msg.From.ID) {
+		return false
+	}
+	return msg.Chat.IsPrivate() || !b.isForwardTarget(msg.Chat.ID)
+}
+
+// recoverMiddleware 捕获处理更新时的 panic 并记录堆栈，避免一条异常更新导致整个机器人退出
+func (b *BotInstance) recoverMiddleware(next updateHandler) updateHandler {
+	return func(update tgbotapi.Update) {
+		defer func() {
+			if r := recover(); r != nil {
+				handler := b.handlerName(update)
+				slog.Error("处理更新时发生 panic", updateAttrs(update, handler, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))...)
+				b.alertPanic(handler, r)
+			}
+		}()
+		next(update)
+	}
+}
+
+// loggingMiddleware 在 DEBUG 级别记录每条更新的类型、发送者、处理函数和耗时，处理较慢的更新记为 WARN
+func (b *BotInstance) loggingMiddleware(next updateHandler) updateHandler {
+	return func(update tgbotapi.Update) {
+		start := time.Now()
+		next(update)
+		elapsed := time.Since(start)
+		level := slog.LevelDebug
+		if elapsed >= slowUpdateThreshold {
+			level = slog.LevelWarn
+		}
+		slog.Log(context.Background(), level, "更新处理完成", updateAttrs(update, b.handlerName(update), "duration_ms", elapsed.Milliseconds())...)
+	}
+}
+
+// slowUpdateThreshold 处理耗时超过该值的更新记为 WARN
+const slowUpdateThreshold = 5 * time.Second
+
+// updateAttrs 返回更新的日志字段：update_id、update_type、user_id、chat_id 和 handler，后面追加 extra
+func updateAttrs(update tgbotapi.Update, handler string, extra ...any) []any {
+	attrs := []any{"update_id", update.UpdateID, "update_type", updateType(update)}
+	if sender := updateSender(update); sender != nil {
+		attrs = append(attrs, "user_id", sender.ID)
+	}
+	var chat *tgbotapi.Chat
+	switch {
+	case update.Message != nil:
+		chat = update.Message.Chat
+	case update.EditedMessage != nil:
+		chat = update.EditedMessage.Chat
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		chat = update.CallbackQuery.Message.Chat
+	}
+	if chat != nil {
+		attrs = append(attrs, "chat_id", chat.ID)
+	}
+	attrs = append(attrs, "handler", handler)
+	return append(attrs, extra...)
+}
+
+// handlerName 返回处理该更新的函数名称，用于日志：命令为 command:<名称>，按钮为 callback:<回调数据前缀>
+func (b *BotInstance) handlerName(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		msg := update.Message
+		if msg.IsCommand() {
+			return "command:" + msg.Command()
+		}
+		if msg.From != nil && b.isAdmin(msg.From.ID) {
+			return "admin_message"
+		}
+		return "user_message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.CallbackQuery != nil:
+		prefix, _, _ := strings.Cut(update.CallbackQuery.Data, "_")
+		return "callback:" + prefix
+	case update.InlineQuery != nil:
+		return "inline_query"
+	}
+	return "unknown"
+}
+
+// persistUserMiddleware 记录发消息用户的资料和活跃时间，并把未拉黑的用户加入用户集合
+func (b *BotInstance) persistUserMiddleware(next updateHandler) updateHandler {
+	return func(update tgbotapi.Update) {
+		// Redis 不可用时跳过非关键的记录，保证消息转发不受影响
+		if update.Message != nil && update.Message.From != nil && b.redisClient.Healthy() {
+			b.persistUser(update.Message.From)
+		}
+		next(update)
+	}
+}
+
+// persistUser 存储用户的信息（用户名和昵称），用户重新发来消息说明已解除对机器人的屏蔽，恢复接收广播
+func (b *BotInstance) persistUser(user *tgbotapi.User) {
+	ctx := context.Background()
+	if err := b.redisClient.StoreUserInfo(ctx, user); err != nil {
+		log.Printf("存储用户 %d 信息失败: %v", user.ID, err)
+	}
+	if removed, err := b.redisClient.RemoveUnreachableUser(ctx, user.ID); err != nil {
+		log.Printf("移除不可达用户 %d 失败: %v", user.ID, err)
+	} else if removed {
+		log.Printf("用户 %d 已解除对机器人的屏蔽，恢复接收广播", user.ID)
+	}
+	// 仅当用户未被拉黑时才记录
+	isBlocked, _ := b.redisClient.IsUserBlocked(ctx, user.ID)
+	if !isBlocked {
+		added, err := b.redisClient.CheckAndAddUser(ctx, cache.UsersSetKey, user.ID)
+		if err != nil {
+			log.Printf("记录用户 %d 失败: %v", user.ID, err)
+		}
+		if added {
+			b.emit(eventUserNew, newEventUser(user))
+		}
+	}
+}
+
+// blocklistMiddleware 拦截被拉黑用户的消息、编辑和按钮点击，收到消息时告知用户
+func (b *BotInstance) blocklistMiddleware(next updateHandler) updateHandler {
+	return func(update tgbotapi.Update) {
+		sender := updateSender(update)
+		if sender == nil || b.isAdmin(sender.ID) {
+			next(update)
+			return
+		}
+		for _, msg := range []*tgbotapi.Message{update.Message, update.EditedMessage} {
+			if msg != nil && !b.isUserConversation(msg) {
+				next(update)
+				return
+			}
+		}
+
+		isBlocked, err := b.redisClient.IsUserBlocked(context.Background(), sender.ID)
+		if err != nil {
+			// 无法确认时按未拉黑处理，避免 Redis 故障导致客服转发中断
+			log.Printf("检查用户 %d 是否被拉黑失败，按未拉黑处理: %v", sender.ID, err)
+		}
+		if !isBlocked {
+			next(update)
+			return
+		}
+		switch {
+		case update.Message != nil:
+			b.API.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "您已经被拉黑，暂时无法使用。"))
+		case update.CallbackQuery != nil:
+			b.API.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		}
+	}
+}
+
+// rateLimitMiddleware 对用户消息执行刷屏限制，见 checkFlood
+func (b *BotInstance) rateLimitMiddleware(next updateHandler) updateHandler {
+	return func(update tgbotapi.Update) {
+		if msg := update.Message; msg != nil && b.isUserConversation(msg) && !b.checkFlood(msg) {
+			return
+		}
+		next(update)
+	}
+}
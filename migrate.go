@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"my-tg-bot/internal/cache"
+
+	"github.com/joho/godotenv"
+)
+
+// runPrefixMigration 将 Redis 中没有前缀的旧数据移动到 REDIS_KEY_PREFIX 下，成功返回 0，否则返回 1。
+// 为已有数据启用前缀时，在停止机器人后、启动其他共用该数据库的机器人前执行一次
+func runPrefixMigration() int {
+	godotenv.Load()
+	prefix := os.Getenv("REDIS_KEY_PREFIX")
+	if prefix == "" {
+		fmt.Println("❌ 请先设置 REDIS_KEY_PREFIX。")
+		return 1
+	}
+	redisAddr := os.Getenv("REDIS_ADDR")
+	redisDB, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+	redisClient, err := cache.NewRedisClient(redisAddr, os.Getenv("REDIS_PASSWORD"), redisDB, prefix)
+	if err != nil {
+		fmt.Printf("❌ 无法连接到 Redis %s: %v\n", redisAddr, err)
+		return 1
+	}
+	fmt.Printf("正在将数据库 %d 中没有前缀的键移动到 %q 下…\n", redisDB, prefix)
+	moved, skipped, err := redisClient.MigrateKeyPrefix(context.Background())
+	if err != nil {
+		fmt.Printf("❌ 迁移中断（已移动 %d 个键）: %v\n", moved, err)
+		return 1
+	}
+	fmt.Printf("✅ 已移动 %d 个键。", moved)
+	if skipped > 0 {
+		fmt.Printf("%d 个键的目标已存在，保持原样。", skipped)
+	}
+	fmt.Println()
+	return 0
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	orderListLimit   = 20 // /order list 显示的订单数
+	myOrdersLimit    = 10 // /myorders 显示的订单数
+	orderTimeLayout  = "2006-01-02 15:04"
+	orderItemMaxRune = 100 // 商品名称的最大长度
+)
+
+// orderStatusNames 是订单状态的中文名称
+var orderStatusNames = map[string]string{
+	cache.OrderStatusPending:   "待处理",
+	cache.OrderStatusPaid:      "已付款",
+	cache.OrderStatusShipped:   "已发货",
+	cache.OrderStatusDelivered: "已完成",
+	cache.OrderStatusCancelled: "已取消",
+}
+
+// orderFieldNames 是 /order 可修改的字段的中文名称
+var orderFieldNames = map[string]string{"status": "状态", "item": "商品", "note": "备注"}
+
+// parseOrderStatus 将状态代码或中文名称转换为订单状态，无法识别时返回空字符串
+func parseOrderStatus(input string) string {
+	input = strings.ToLower(strings.TrimSpace(input))
+	for _, status := range cache.OrderStatuses {
+		if input == status || input == orderStatusNames[status] {
+			return status
+		}
+	}
+	return ""
+}
+
+// orderStatusList 列出可用的订单状态，用于用法提示
+func orderStatusList() string {
+	names := make([]string, len(cache.OrderStatuses))
+	for i, status := range cache.OrderStatuses {
+		names[i] = fmt.Sprintf("%s（%s）", status, orderStatusNames[status])
+	}
+	return strings.Join(names, "、")
+}
+
+// describeOrder 返回订单的详细信息，forAdmin 时包含用户
+func (b *BotInstance) describeOrder(order cache.Order, forAdmin bool) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("订单 #%s：%s\n", order.ID, order.Item))
+	if forAdmin {
+		sb.WriteString("用户：" + b.userLabel(order.UserID) + "\n")
+	}
+	sb.WriteString("状态：" + orderStatusNames[order.Status] + "\n")
+	if order.Note != "" {
+		sb.WriteString("备注：" + order.Note + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("创建于 %s，更新于 %s", order.CreatedAt.Format(orderTimeLayout), order.UpdatedAt.Format(orderTimeLayout)))
+	return sb.String()
+}
+
+// notifyOrderUser 将订单的创建或状态变化通知给用户，返回给管理员的发送结果说明
+func (b *BotInstance) notifyOrderUser(order cache.Order, headline string) string {
+	sent, err := b.API.Send(tgbotapi.NewMessage(order.UserID, headline+"\n\n"+b.describeOrder(order, false)+"\n\n发送 /myorders 可随时查看您的订单。"))
+	if err != nil {
+		failure := classifySendError(err)
+		log.Printf("通知用户 %d 订单 #%s 的变化失败（原因：%s）: %v", order.UserID, order.ID, failure, err)
+		return "⚠️ 未能通知用户：" + failure.String()
+	}
+	b.recordHistory(order.UserID, cache.HistoryOutbound, "订单通知", &sent)
+	return "已通知用户。"
+}
+
+const orderUsage = "用法：\n" +
+	"/order list —— 查看最近更新的订单\n" +
+	"/order new <用户ID|@用户名> <商品> [| 备注] —— 为用户创建订单并通知用户\n" +
+	"/order <订单号> —— 查看订单\n" +
+	"/order user <用户ID|@用户名> —— 查看用户的订单\n" +
+	"/order status <订单号> <状态> [备注] —— 修改状态并通知用户\n" +
+	"/order item <订单号> <商品> —— 修改商品\n" +
+	"/order note <订单号> <备注> —— 修改备注\n"
+
+// handleOrder 处理 /order：创建、查看和修改用户的订单
+func (b *BotInstance) handleOrder(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		b.listOrders(msg.Chat.ID, 0)
+	case "new", "create":
+		b.createOrder(msg, args[1:])
+	case "user":
+		if len(args) != 2 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, orderUsage+"\n可用状态："+orderStatusList()))
+			return
+		}
+		userID, err := b.resolveUserArg(args[1])
+		if err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+			return
+		}
+		b.listOrders(msg.Chat.ID, userID)
+	case "status", "item", "note":
+		b.updateOrder(msg, args[0], args[1:])
+	default:
+		if len(args) != 1 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, orderUsage+"\n可用状态："+orderStatusList()))
+			return
+		}
+		order, ok := b.findOrder(msg.Chat.ID, args[0])
+		if ok {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, b.describeOrder(order, true)))
+		}
+	}
+}
+
+// findOrder 按订单号读取订单，失败或不存在时提示管理员并返回 false
+func (b *BotInstance) findOrder(chatID int64, input string) (cache.Order, bool) {
+	id := cache.NormalizeOrderID(input)
+	order, ok, err := b.redisClient.GetOrder(context.Background(), id)
+	if err != nil {
+		log.Printf("获取订单 #%s 失败: %v", id, err)
+		b.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取订单失败，请稍后再试。"))
+		return order, false
+	}
+	if !ok {
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("未找到订单 #%s。", id)))
+		return order, false
+	}
+	return order, true
+}
+
+// listOrders 列出用户的订单，userID 为 0 时列出最近更新的订单
+func (b *BotInstance) listOrders(chatID int64, userID int64) {
+	ctx := context.Background()
+	var orders []cache.Order
+	var err error
+	if userID == 0 {
+		orders, err = b.redisClient.GetRecentOrders(ctx, orderListLimit)
+	} else {
+		orders, err = b.redisClient.GetUserOrders(ctx, userID, orderListLimit)
+	}
+	if err != nil {
+		log.Printf("获取订单列表失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取订单列表失败。"))
+		return
+	}
+	if len(orders) == 0 {
+		b.API.Send(tgbotapi.NewMessage(chatID, "暂无订单。\n\n"+orderUsage))
+		return
+	}
+
+	var sb strings.Builder
+	if userID == 0 {
+		sb.WriteString("最近更新的订单：\n")
+	} else {
+		sb.WriteString(b.userLabel(userID) + " 的订单：\n")
+	}
+	for _, order := range orders {
+		sb.WriteString(fmt.Sprintf("#%s %s —— %s（%s）", order.ID, order.Item, orderStatusNames[order.Status], order.UpdatedAt.Format(orderTimeLayout)))
+		if userID == 0 {
+			sb.WriteString("，" + b.userLabel(order.UserID))
+		}
+		sb.WriteString("\n")
+	}
+	b.API.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
+
+// createOrder 处理 /order new <用户> <商品> [| 备注]
+func (b *BotInstance) createOrder(msg *tgbotapi.Message, args []string) {
+	if len(args) < 2 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, orderUsage))
+		return
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	item, note, _ := strings.Cut(strings.Join(args[1:], " "), "|")
+	item, note = strings.TrimSpace(item), strings.TrimSpace(note)
+	if item == "" {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, orderUsage))
+		return
+	}
+	item = truncateRunes(item, orderItemMaxRune)
+
+	order, err := b.redisClient.CreateOrder(context.Background(), userID, item, note)
+	if err != nil {
+		log.Printf("为用户 %d 创建订单失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 创建订单失败，请稍后再试。"))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditOrder, fmt.Sprintf("为用户 %d 创建订单 #%s：%s", userID, order.ID, item))
+	result := b.notifyOrderUser(order, "🧾 已为您创建订单。")
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已创建订单 #%s。%s\n\n%s", order.ID, result, b.describeOrder(order, true))))
+}
+
+// updateOrder 处理 /order status|item|note <订单号> <值>。只有状态变化会通知用户
+func (b *BotInstance) updateOrder(msg *tgbotapi.Message, field string, args []string) {
+	if len(args) < 2 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, orderUsage+"\n可用状态："+orderStatusList()))
+		return
+	}
+	order, ok := b.findOrder(msg.Chat.ID, args[0])
+	if !ok {
+		return
+	}
+	value := strings.Join(args[1:], " ")
+
+	var status, item, note string
+	switch field {
+	case "status":
+		status = parseOrderStatus(args[1])
+		if status == "" {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 无效的状态："+args[1]+"\n可用状态："+orderStatusList()))
+			return
+		}
+		if status == order.Status {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("订单 #%s 的状态已经是%s。", order.ID, orderStatusNames[status])))
+			return
+		}
+		note = strings.TrimSpace(strings.Join(args[2:], " "))
+	case "item":
+		item = truncateRunes(value, orderItemMaxRune)
+	case "note":
+		note = value
+	}
+
+	if err := b.redisClient.UpdateOrder(context.Background(), order.ID, status, item, note); err != nil {
+		log.Printf("修改订单 #%s 失败: %v", order.ID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 修改订单失败，请稍后再试。"))
+		return
+	}
+	previous := order.Status
+	order, ok = b.findOrder(msg.Chat.ID, order.ID)
+	if !ok {
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditOrder, fmt.Sprintf("订单 #%s 的%s改为：%s", order.ID, orderFieldNames[field], value))
+
+	result := ""
+	if status != "" {
+		result = b.notifyOrderUser(order, fmt.Sprintf("📦 您的订单状态已更新：%s → %s", orderStatusNames[previous], orderStatusNames[status]))
+	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已修改订单 #%s。%s\n\n%s", order.ID, result, b.describeOrder(order, true))))
+}
+
+// handleUserOrders 处理用户的 /myorders：查看自己的订单
+func (b *BotInstance) handleUserOrders(msg *tgbotapi.Message) {
+	orders, err := b.redisClient.GetUserOrders(context.Background(), msg.From.ID, myOrdersLimit)
+	if err != nil {
+		log.Printf("获取用户 %d 的订单失败: %v", msg.From.ID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取订单失败，请稍后再试。"))
+		return
+	}
+	if len(orders) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "您还没有订单。如有疑问，直接发送消息即可联系客服。"))
+		return
+	}
+	parts := make([]string, len(orders))
+	for i, order := range orders {
+		parts[i] = b.describeOrder(order, false)
+	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "🧾 您的订单：\n\n"+strings.Join(parts, "\n\n")))
+}
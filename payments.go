@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// paymentDeclinedMessage 是拒绝付款请求时显示给用户的说明
+const paymentDeclinedMessage = "暂时无法完成付款，请联系客服。"
+
+// loadPaymentPrefixes 从 PAYMENT_PAYLOAD_PREFIXES 读取允许付款的账单 payload 前缀（逗号分隔），
+// "*" 表示允许所有账单；未设置时返回 nil，拒绝所有付款请求
+func loadPaymentPrefixes() []string {
+	var prefixes []string
+	for _, prefix := range strings.Split(os.Getenv("PAYMENT_PAYLOAD_PREFIXES"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// describePaymentPrefixes 返回付款确认规则的说明
+func describePaymentPrefixes(prefixes []string) string {
+	if len(prefixes) == 0 {
+		return "拒绝所有付款请求"
+	}
+	for _, prefix := range prefixes {
+		if prefix == "*" {
+			return "确认所有付款请求"
+		}
+	}
+	return "确认 payload 以 " + strings.Join(prefixes, "、") + " 开头的付款请求"
+}
+
+// paymentAllowed 报告账单 payload 是否匹配允许付款的前缀
+func (b *BotInstance) paymentAllowed(payload string) bool {
+	for _, prefix := range b.paymentPrefixes {
+		if prefix == "*" || strings.HasPrefix(payload, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePreCheckoutQuery 回应用户的付款请求。机器人本身不发送账单，账单由外部系统使用同一个
+// Bot Token 发送，只有 payload 匹配 PAYMENT_PAYLOAD_PREFIXES 的账单才确认，其余的拒绝，
+// 避免任何人用本机器人的 Token 发出的账单都能扣款；订单是否有效由外部系统在收到 payment.received 事件后处理
+func (b *BotInstance) handlePreCheckoutQuery(q *tgbotapi.PreCheckoutQuery) {
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: q.ID, OK: true}
+	if !b.paymentAllowed(q.InvoicePayload) {
+		answer = tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: q.ID, ErrorMessage: paymentDeclinedMessage}
+		log.Printf("拒绝用户 %d 的付款请求：账单 %q 不在 PAYMENT_PAYLOAD_PREFIXES 中", q.From.ID, q.InvoicePayload)
+	}
+	if _, err := b.API.Request(answer); err != nil {
+		log.Printf("回应用户 %d 的付款请求失败: %v", q.From.ID, err)
+	}
+}
+
+// handleSuccessfulPayment 处理用户付款成功的消息：推送 payment.received 事件并提醒客服
+func (b *BotInstance) handleSuccessfulPayment(msg *tgbotapi.Message) {
+	payment := msg.SuccessfulPayment
+	log.Printf("收到用户 %d 的付款：%d %s（%s）", msg.From.ID, payment.TotalAmount, payment.Currency, payment.InvoicePayload)
+	b.emit(eventPaymentReceived, eventPayment{
+		User:                    newEventUser(msg.From),
+		Currency:                payment.Currency,
+		TotalAmount:             payment.TotalAmount,
+		InvoicePayload:          payment.InvoicePayload,
+		TelegramPaymentChargeID: payment.TelegramPaymentChargeID,
+		ProviderPaymentChargeID: payment.ProviderPaymentChargeID,
+	})
+	b.flagToAdmins(msg, fmt.Sprintf("💰 %s 付款成功：%d %s（最小货币单位）\n账单：%s\n交易号：%s",
+		b.userLabel(msg.From.ID), payment.TotalAmount, payment.Currency, payment.InvoicePayload, payment.TelegramPaymentChargeID), nil)
+}
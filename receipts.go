@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// saveForwardHeader 保存转发标题最初的文本，回复后据此在标题末尾标记已回复
+func (b *BotInstance) saveForwardHeader(chatID int64, messageID int, text string) {
+	if err := b.redisClient.SaveForwardHeader(context.Background(), chatID, messageID, text); err != nil {
+		log.Printf("保存转发标题 %d:%d 失败: %v", chatID, messageID, err)
+	}
+}
+
+// markForwardAnswered 在管理员回复的转发消息所属的标题末尾注明由谁、在何时回复，方便客服一眼看出哪些消息仍需处理。
+// 多次回复时只保留最近一次的标记；标题已过期、话题模式或无法编辑时不做任何事
+func (b *BotInstance) markForwardAnswered(chatID int64, target cache.ForwardMapping, admin *tgbotapi.User) {
+	if target.HeaderID == 0 {
+		return
+	}
+	text, err := b.redisClient.GetForwardHeader(context.Background(), chatID, target.HeaderID)
+	if err != nil {
+		log.Printf("获取转发标题 %d:%d 失败: %v", chatID, target.HeaderID, err)
+		return
+	}
+	if text == "" {
+		return
+	}
+	receipt := fmt.Sprintf("✅ 已回复 by %s at %s", adminDisplayName(admin), time.Now().Format("15:04"))
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, target.HeaderID, text+"\n\n"+escapeMarkdownV2(receipt), b.userKeyboard(chatID, target.UserID))
+	edit.ParseMode = "MarkdownV2"
+	if _, err := b.API.Send(edit); err != nil {
+		log.Printf("标记转发标题 %d:%d 已回复失败: %v", chatID, target.HeaderID, err)
+		return
+	}
+	if err := b.redisClient.SaveForwardReceipt(context.Background(), chatID, target.HeaderID, receipt); err != nil {
+		log.Printf("保存转发标题 %d:%d 的已回复标记失败: %v", chatID, target.HeaderID, err)
+	}
+}
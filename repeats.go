@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// repeatWindow 是识别重复消息的时间窗，从第一次发送起计算
+const repeatWindow = 10 * time.Minute
+
+// repeatDigest 返回文字消息内容的摘要，非文字消息返回空字符串
+func repeatDigest(msg *tgbotapi.Message) string {
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// markRepeat 检查用户是否在短时间内重复发送同样的文字。重复的消息照常记录，但不再转发，
+// 只在第一次转发的标题末尾标注“(重复 ×N)”。返回 true 表示已标注，该消息不应再转发
+func (b *BotInstance) markRepeat(msg *tgbotapi.Message) bool {
+	digest := repeatDigest(msg)
+	if digest == "" {
+		return false
+	}
+	ctx := context.Background()
+	count, err := b.redisClient.CountRepeat(ctx, msg.From.ID, digest, repeatWindow)
+	if err != nil {
+		log.Printf("记录用户 %d 的重复消息失败: %v", msg.From.ID, err)
+		return false
+	}
+	if count == 1 {
+		return false
+	}
+	chatID, headerID, text, err := b.redisClient.GetRepeatHeader(ctx, msg.From.ID, digest)
+	if err != nil || headerID == 0 || text == "" {
+		// 第一次发送时未按标题方式转发（话题模式或转发失败），照常转发
+		return false
+	}
+	marked := text + "\n\n" + escapeMarkdownV2(fmt.Sprintf("(重复 ×%d)", count))
+	// 标题已标记已回复时保留该标记
+	shown := marked
+	if receipt, _ := b.redisClient.GetForwardReceipt(ctx, chatID, headerID); receipt != "" {
+		shown += "\n\n" + escapeMarkdownV2(receipt)
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, headerID, shown, b.userKeyboard(chatID, msg.From.ID))
+	edit.ParseMode = "MarkdownV2"
+	if _, err := b.API.Send(edit); err != nil {
+		log.Printf("标注用户 %d 的重复消息失败: %v", msg.From.ID, err)
+		return false
+	}
+	// 之后标记已回复时保留重复次数
+	b.saveForwardHeader(chatID, headerID, marked)
+	log.Printf("用户 %d 第 %d 次发送相同内容，不再转发", msg.From.ID, count)
+	return true
+}
+
+// rememberRepeatHeader 记录文字消息转发时的标题，之后的重复消息在该标题上标注次数
+func (b *BotInstance) rememberRepeatHeader(msg *tgbotapi.Message, chatID int64, headerID int, text string) {
+	digest := repeatDigest(msg)
+	if digest == "" {
+		return
+	}
+	if err := b.redisClient.SetRepeatHeader(context.Background(), msg.From.ID, digest, chatID, headerID, text); err != nil {
+		log.Printf("记录用户 %d 的消息标题失败: %v", msg.From.ID, err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const replyUsage = "用法：\n" +
+	"/reply <用户ID|@用户名|#工单号> <内容> —— 直接向用户发送文字\n" +
+	"回复任意一条消息并发送 /reply <用户ID|@用户名|#工单号> —— 将被回复的消息原样发送给用户，适用于图片、文件等，以及无法识别来源的转发消息"
+
+// resolveReplyArg 解析 /reply 的目标：用户 ID、@用户名或工单号（#A1024 或 A1024）
+func (b *BotInstance) resolveReplyArg(arg string) (int64, error) {
+	if !strings.HasPrefix(arg, "#") {
+		if userID, err := b.resolveUserArg(arg); err == nil || strings.HasPrefix(arg, "@") {
+			return userID, err
+		}
+	}
+	id := cache.NormalizeTicketID(arg)
+	ticket, ok, err := b.ticketByID(id)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("找不到用户或工单：%s", arg)
+	}
+	return ticket.UserID, nil
+}
+
+// handleReply 处理 /reply：不依赖转发映射，直接向已知用户发送消息
+func (b *BotInstance) handleReply(msg *tgbotapi.Message) {
+	args := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 2)
+	if args[0] == "" {
+		b.replyInThread(msg, replyUsage)
+		return
+	}
+	userID, err := b.resolveReplyArg(args[0])
+	if err != nil {
+		b.replyInThread(msg, "❌ "+err.Error())
+		return
+	}
+
+	text := ""
+	if len(args) == 2 {
+		text = strings.TrimSpace(args[1])
+	}
+	var sentID int
+	var translatedTo string
+	content := msg
+	switch {
+	case text != "":
+		var outgoing string
+		outgoing, translatedTo = b.translateOutbound(userID, text)
+		sent, err := b.API.Send(tgbotapi.NewMessage(userID, outgoing))
+		if err != nil {
+			log.Printf("管理员 %d 通过 /reply 发送消息给用户 %d 失败: %v", msg.From.ID, userID, err)
+			b.replyInThread(msg, fmt.Sprintf("❌ 发送给%s失败：%s", b.userLabel(userID), classifySendError(err)))
+			return
+		}
+		sentID = sent.MessageID
+		// 历史和工单中只记录发送给用户的内容，不包括命令本身
+		content = &tgbotapi.Message{MessageID: msg.MessageID, Text: text}
+	case msg.ReplyToMessage != nil:
+		content = msg.ReplyToMessage
+		copied, err := b.API.CopyMessage(tgbotapi.NewCopyMessage(userID, msg.Chat.ID, content.MessageID))
+		if err != nil {
+			log.Printf("管理员 %d 通过 /reply 复制消息给用户 %d 失败: %v", msg.From.ID, userID, err)
+			b.replyInThread(msg, fmt.Sprintf("❌ 发送给%s失败：%s", b.userLabel(userID), classifySendError(err)))
+			return
+		}
+		sentID = copied.MessageID
+	default:
+		b.replyInThread(msg, replyUsage)
+		return
+	}
+
+	b.linkMessage(msg.Chat.ID, content.MessageID, userID, sentID, messageText(content))
+	b.recordAdminReply(msg.From, userID, content)
+	b.replyInThread(msg, fmt.Sprintf("✅ 已由 %s 发送给%s。%s", adminDisplayName(msg.From), b.userLabel(userID), translatedNote(translatedTo)))
+}
+
+// recordAdminReply 记录管理员 admin 发送给用户的消息 content：写入工单和对话记录，计入回复统计，并将会话改为等待用户
+func (b *BotInstance) recordAdminReply(admin *tgbotapi.User, userID int64, content *tgbotapi.Message) {
+	author := "客服 " + adminDisplayName(admin)
+	b.recordTicketMessage(userID, author, content)
+	b.recordHistory(userID, cache.HistoryOutbound, author, content)
+	b.recordAnswer(admin.ID, userID)
+	b.updateTicketStatus(userID, cache.TicketStatusPending)
+	b.clearAwaitingReply(userID)
+	b.unpinVIPMessage(userID)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+)
+
+const reportCheckInterval = time.Minute
+
+// dailyStatLabels 是每日统计字段在报告中的名称
+var dailyStatLabels = map[string]string{
+	cache.DailyNewUsers:         "新增用户",
+	cache.DailyMessagesReceived: "收到消息",
+	cache.DailyMessagesAnswered: "回复消息",
+	cache.DailyBlocks:           "拉黑用户",
+	cache.DailyBroadcasts:       "广播",
+}
+
+// reportConfig 是统计报告的配置，为 nil 时不发送报告
+type reportConfig struct {
+	At      int          // 每天发送日报的时间，当天零点起的分钟数
+	Weekday time.Weekday // 每周哪天随日报一起发送周报
+}
+
+// loadReportConfig 从 REPORT_TIME（HH:MM，本地时间）和 REPORT_WEEKDAY（1-7 表示周一到周日，默认周一）读取报告配置，
+// 未设置 REPORT_TIME 时返回 nil
+func loadReportConfig() (*reportConfig, error) {
+	at := os.Getenv("REPORT_TIME")
+	if at == "" {
+		return nil, nil
+	}
+	minutes, err := parseClock(at)
+	if err != nil {
+		return nil, fmt.Errorf("REPORT_TIME %w", err)
+	}
+	cfg := &reportConfig{At: minutes, Weekday: time.Monday}
+	if dayStr := os.Getenv("REPORT_WEEKDAY"); dayStr != "" {
+		day, err := strconv.Atoi(dayStr)
+		if err != nil || day < 1 || day > 7 {
+			return nil, fmt.Errorf("REPORT_WEEKDAY 无效（%s），应为 1-7", dayStr)
+		}
+		cfg.Weekday = time.Weekday(day % 7)
+	}
+	return cfg, nil
+}
+
+// StartStatsReports 启动后台检查，每天到点后把前一天的统计发送给客服，并在指定的星期附带过去 7 天的周报。
+// 发送记录保存在 Redis 中，重启后不会重复发送；到点时机器人未运行的，启动后当天补发。
+func (b *BotInstance) StartStatsReports() {
+	if b.reports == nil {
+		return
+	}
+	log.Printf("已启用统计报告：每天 %02d:%02d 发送日报，%s发送周报", b.reports.At/60, b.reports.At%60, weekdayNames[b.reports.Weekday])
+	go func() {
+		ticker := time.NewTicker(reportCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.sendDueReports(time.Now())
+		}
+	}()
+}
+
+// sendDueReports 在 now 已过当天的发送时间时发送尚未发送的日报和周报
+func (b *BotInstance) sendDueReports(now time.Time) {
+	if now.Hour()*60+now.Minute() < b.reports.At {
+		return
+	}
+	ctx := context.Background()
+	today := now.Format("2006-01-02")
+	yesterday := now.AddDate(0, 0, -1)
+	if b.markReportDue(ctx, "daily", today) {
+		b.sendStatsReport(ctx, "📊 日报（"+yesterday.Format("2006-01-02")+"）", yesterday, 1)
+	}
+	if now.Weekday() == b.reports.Weekday && b.markReportDue(ctx, "weekly", today) {
+		from := now.AddDate(0, 0, -7)
+		b.sendStatsReport(ctx, fmt.Sprintf("📈 周报（%s 至 %s）", from.Format("2006-01-02"), yesterday.Format("2006-01-02")), yesterday, 7)
+	}
+}
+
+// markReportDue 记录报告即将发送，返回 false 表示该报告已经发送过或记录失败
+func (b *BotInstance) markReportDue(ctx context.Context, kind, period string) bool {
+	due, err := b.redisClient.MarkReportSent(ctx, kind, period)
+	if err != nil {
+		log.Printf("记录 %s 报告 %s 失败: %v", kind, period, err)
+		return false
+	}
+	return due
+}
+
+// sendStatsReport 汇总截至 last 的 days 天统计并发送给客服
+func (b *BotInstance) sendStatsReport(ctx context.Context, title string, last time.Time, days int) {
+	totals := make(map[string]int64, len(cache.DailyStatFields))
+	for i := 0; i < days; i++ {
+		stats, err := b.redisClient.GetDailyStats(ctx, last.AddDate(0, 0, -i))
+		if err != nil {
+			log.Printf("读取每日统计失败: %v", err)
+			return
+		}
+		for field, n := range stats {
+			totals[field] += n
+		}
+	}
+	b.notifyForwardTarget(formatStatsReport(title, totals))
+}
+
+func formatStatsReport(title string, totals map[string]int64) string {
+	var sb strings.Builder
+	sb.WriteString(title)
+	for _, field := range cache.DailyStatFields {
+		sb.WriteString(fmt.Sprintf("\n- %s: %d", dailyStatLabels[field], totals[field]))
+	}
+	if avg, ok := averageResponse(totals); ok {
+		sb.WriteString("\n- 平均首次响应: " + formatWait(avg))
+	}
+	return sb.String()
+}
+
+// recordInbound 将用户消息计入每日统计，并开始计算客服的响应时间
+func (b *BotInstance) recordInbound(userID int64) {
+	if err := b.redisClient.RecordInboundMessage(context.Background(), userID, time.Now()); err != nil {
+		log.Printf("记录用户 %d 消息的每日统计失败: %v", userID, err)
+	}
+}
+
+// recordAnswer 将客服 adminID 的回复计入每日统计和客服统计，是对用户未回复消息的首次回复时记录响应时间
+func (b *BotInstance) recordAnswer(adminID, userID int64) {
+	if _, _, err := b.redisClient.RecordAnswer(context.Background(), adminID, userID, time.Now()); err != nil {
+		log.Printf("记录对用户 %d 回复的每日统计失败: %v", userID, err)
+	}
+}
+
+// averageResponse 根据累计的响应次数和等待秒数计算平均首次响应时间，没有记录时 ok 为 false
+func averageResponse(totals map[string]int64) (avg time.Duration, ok bool) {
+	if totals[cache.DailyResponses] == 0 {
+		return 0, false
+	}
+	return time.Duration(totals[cache.DailyResponseSeconds]/totals[cache.DailyResponses]) * time.Second, true
+}
+
+// formatWait 将等待时间格式化为“x 小时 y 分钟”“y 分钟”或“z 秒”
+func formatWait(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%d 小时 %d 分钟", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%d 分钟", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%d 秒", int(d.Seconds()))
+}
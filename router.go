@@ -0,0 +1,65 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// command 是一条可注册的命令
+type command struct {
+	Name        string
+	Description string // 显示在命令菜单和 /help 中
+	Role        string // 使用该命令需要的管理员角色（cache.RoleOperator 或 cache.RoleSuperAdmin），用户命令为空
+	Handler     func(msg *tgbotapi.Message)
+}
+
+// commandRouter 按名称分发命令，并按注册顺序生成命令菜单和帮助信息
+type commandRouter struct {
+	commands []command
+	byName   map[string]command
+}
+
+func newCommandRouter() *commandRouter {
+	return &commandRouter{byName: make(map[string]command)}
+}
+
+// register 注册命令，名称重复时后注册的覆盖先注册的
+func (r *commandRouter) register(commands ...command) {
+	for _, cmd := range commands {
+		if _, ok := r.byName[cmd.Name]; !ok {
+			r.commands = append(r.commands, cmd)
+		} else {
+			for i := range r.commands {
+				if r.commands[i].Name == cmd.Name {
+					r.commands[i] = cmd
+				}
+			}
+		}
+		r.byName[cmd.Name] = cmd
+	}
+}
+
+// lookup 按名称查找命令
+func (r *commandRouter) lookup(name string) (command, bool) {
+	cmd, ok := r.byName[name]
+	return cmd, ok
+}
+
+// visible 按注册顺序返回 allowed 允许的命令
+func (r *commandRouter) visible(allowed func(command) bool) []command {
+	var commands []command
+	for _, cmd := range r.commands {
+		if allowed(cmd) {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// botCommands 将命令转换为 setMyCommands 使用的命令列表
+func botCommands(commands []command) []tgbotapi.BotCommand {
+	list := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		list = append(list, tgbotapi.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	return list
+}
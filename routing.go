@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+	"my-tg-bot/internal/welcome"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 转发路由规则的匹配方式
+const (
+	routeTag      = "tag"    // 带有指定标签的用户
+	routeLanguage = "lang"   // Telegram 客户端语言为指定语言的用户
+	routeSource   = "source" // 最近一次通过指定深度链接来源进入的用户
+	routeAll      = "all"    // 所有用户，通常放在最后并配置多个会话轮流分配
+
+	settingRoutes = "routes" // 设置面板中的路由规则项
+)
+
+var routeKindNames = map[string]string{
+	routeTag:      "标签",
+	routeLanguage: "语言",
+	routeSource:   "来源",
+	routeAll:      "所有用户",
+}
+
+// forwardRoute 是一条转发路由规则：匹配的用户消息转发到 Targets，多个会话时按用户轮流分配
+type forwardRoute struct {
+	ID      string  `json:"-"`
+	Kind    string  `json:"kind"`
+	Value   string  `json:"value,omitempty"`
+	Targets []int64 `json:"targets"`
+}
+
+// describe 返回规则的可读描述
+func (r forwardRoute) describe() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("#%s %s", r.ID, routeKindNames[r.Kind]))
+	if r.Value != "" {
+		sb.WriteString(" " + r.Value)
+	}
+	targets := make([]string, len(r.Targets))
+	for i, target := range r.Targets {
+		targets[i] = strconv.FormatInt(target, 10)
+	}
+	sb.WriteString(" → " + strings.Join(targets, "、"))
+	if len(r.Targets) > 1 {
+		sb.WriteString("（轮流分配）")
+	}
+	return sb.String()
+}
+
+// parseForwardRoute 解析“匹配方式 [值] 会话ID...”，例如 “tag vip -100123”、“all -100123 -100456”
+func parseForwardRoute(input string) (forwardRoute, error) {
+	fields := strings.Fields(input)
+	if len(fields) < 2 {
+		return forwardRoute{}, fmt.Errorf("格式应为“匹配方式 [值] 会话ID...”")
+	}
+	route := forwardRoute{Kind: strings.ToLower(fields[0])}
+	rest := fields[1:]
+	switch route.Kind {
+	case routeTag:
+		route.Value = cache.NormalizeTag(rest[0])
+		if route.Value == "" {
+			return route, fmt.Errorf("无效的标签：%s", rest[0])
+		}
+		rest = rest[1:]
+	case routeLanguage:
+		route.Value = welcome.NormalizeLanguage(rest[0])
+		if route.Value == "" {
+			return route, fmt.Errorf("无效的语言代码：%s", rest[0])
+		}
+		rest = rest[1:]
+	case routeSource:
+		route.Value = parseStartSource(rest[0])
+		if route.Value == "" {
+			return route, fmt.Errorf("无效的来源：%s", rest[0])
+		}
+		rest = rest[1:]
+	case routeAll:
+	default:
+		return route, fmt.Errorf("未知的匹配方式 %s，可用：tag、lang、source、all", fields[0])
+	}
+	if len(rest) == 0 {
+		return route, fmt.Errorf("请至少指定一个会话 ID")
+	}
+	seen := make(map[int64]bool)
+	for _, arg := range rest {
+		chatID, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || chatID == 0 {
+			return route, fmt.Errorf("无效的会话 ID：%s", arg)
+		}
+		if !seen[chatID] {
+			seen[chatID] = true
+			route.Targets = append(route.Targets, chatID)
+		}
+	}
+	return route, nil
+}
+
+// loadForwardRoutes 从 Redis 读取转发路由规则，按创建顺序排列后生效
+func (b *BotInstance) loadForwardRoutes() error {
+	payloads, err := b.redisClient.GetForwardRoutes(context.Background())
+	if err != nil {
+		return err
+	}
+	routes := make([]forwardRoute, 0, len(payloads))
+	for id, payload := range payloads {
+		var route forwardRoute
+		if err := json.Unmarshal([]byte(payload), &route); err != nil || len(route.Targets) == 0 {
+			log.Printf("忽略无效的转发路由规则 %s: %v", id, err)
+			continue
+		}
+		route.ID = id
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		a, _ := strconv.ParseInt(routes[i].ID, 10, 64)
+		c, _ := strconv.ParseInt(routes[j].ID, 10, 64)
+		return a < c
+	})
+	b.settingsMu.Lock()
+	b.settings.Routes = routes
+	b.settingsMu.Unlock()
+	return nil
+}
+
+// forwardRoutes 返回当前生效的转发路由规则
+func (b *BotInstance) forwardRoutes() []forwardRoute {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings.Routes
+}
+
+// isRouteTarget 报告 chatID 是否为某条路由规则的转发会话
+func (b *BotInstance) isRouteTarget(chatID int64) bool {
+	for _, route := range b.forwardRoutes() {
+		for _, target := range route.Targets {
+			if target == chatID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routeTarget 按路由规则选择接收该用户消息的会话，没有匹配的规则时使用默认转发目标
+func (b *BotInstance) routeTarget(msg *tgbotapi.Message) int64 {
+	routes := b.forwardRoutes()
+	if len(routes) == 0 {
+		return b.forwardTarget()
+	}
+	ctx := context.Background()
+	userID := msg.From.ID
+
+	// 标签和来源只在有对应规则时读取一次
+	var tags map[string]bool
+	var source string
+	var tagsLoaded, sourceLoaded bool
+	for _, route := range routes {
+		matched := false
+		switch route.Kind {
+		case routeAll:
+			matched = true
+		case routeLanguage:
+			matched = welcome.NormalizeLanguage(msg.From.LanguageCode) == route.Value
+		case routeTag:
+			if !tagsLoaded {
+				tagsLoaded = true
+				userTags, err := b.redisClient.GetUserTags(ctx, userID)
+				if err != nil {
+					log.Printf("读取用户 %d 的标签失败，跳过标签路由: %v", userID, err)
+				}
+				tags = make(map[string]bool, len(userTags))
+				for _, tag := range userTags {
+					tags[tag] = true
+				}
+			}
+			matched = tags[route.Value]
+		case routeSource:
+			if !sourceLoaded {
+				sourceLoaded = true
+				profile, _, err := b.redisClient.GetUserProfile(ctx, userID)
+				if err != nil {
+					log.Printf("读取用户 %d 的来源失败，跳过来源路由: %v", userID, err)
+				}
+				source = profile.LastSource
+			}
+			matched = source != "" && source == route.Value
+		}
+		if !matched {
+			continue
+		}
+		if len(route.Targets) == 1 {
+			return route.Targets[0]
+		}
+		target, err := b.redisClient.AssignRouteTarget(ctx, route.ID, userID, route.Targets)
+		if err != nil {
+			log.Printf("为用户 %d 分配路由 %s 的会话失败，使用第一个会话: %v", userID, route.ID, err)
+			return route.Targets[0]
+		}
+		return target
+	}
+	return b.forwardTarget()
+}
+
+// routesPanel 生成路由规则列表和管理按钮
+func (b *BotInstance) routesPanel() (string, tgbotapi.InlineKeyboardMarkup) {
+	routes := b.forwardRoutes()
+	var sb strings.Builder
+	sb.WriteString("🧭 转发路由规则（按顺序匹配，第一条匹配的规则生效）\n\n")
+	if len(routes) == 0 {
+		sb.WriteString("暂无规则，所有用户消息转发到默认转发目标。\n")
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, route := range routes {
+		sb.WriteString(route.describe() + "\n")
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 删除 #"+route.ID, settingsCallbackPrefix+"route_del_"+route.ID),
+		))
+	}
+	sb.WriteString(fmt.Sprintf("\n没有匹配的规则时转发到默认转发目标：%s", describeForward(b.forwardTarget())))
+	if b.topicsManager.Enabled() {
+		sb.WriteString("\n\n已启用话题模式，路由规则不生效。")
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ 添加规则", settingsCallbackPrefix+"route_add"),
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回", settingsCallbackPrefix+"menu"),
+	))
+	return sb.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleRouteCallback 处理路由规则面板上的按钮，action 为去掉 settings_ 前缀后的回调数据
+func (b *BotInstance) handleRouteCallback(q *tgbotapi.CallbackQuery, action string) {
+	chatID := q.Message.Chat.ID
+	switch {
+	case action == "routes":
+		delete(b.pendingSettings, chatID)
+	case action == "route_add":
+		b.pendingSettings[chatID] = settingRoutes
+		text := "请发送新规则，格式为“匹配方式 [值] 会话ID...”：\n" +
+			"• tag vip -100123 —— 带 vip 标签的用户\n" +
+			"• lang en -100123 —— 客户端语言为英语的用户\n" +
+			"• source ads -100123 —— 最近通过 ads 深度链接进入的用户\n" +
+			"• all -100123 -100456 —— 所有用户\n\n" +
+			"指定多个会话时新用户轮流分配，之后固定由同一会话处理。机器人需要能在这些会话中发言。发送 /cancel 取消。"
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回", settingsCallbackPrefix+"routes"),
+		))
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, keyboard))
+		return
+	case strings.HasPrefix(action, "route_del_"):
+		id := strings.TrimPrefix(action, "route_del_")
+		removed, err := b.redisClient.DeleteForwardRoute(context.Background(), id)
+		if err != nil {
+			log.Printf("删除转发路由规则 %s 失败: %v", id, err)
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ 删除规则失败，请稍后再试。"))
+			return
+		}
+		if removed {
+			b.audit(q.From.ID, cache.AuditSettings, "删除转发路由规则 #"+id)
+		}
+		if err := b.loadForwardRoutes(); err != nil {
+			log.Printf("重新加载转发路由规则失败: %v", err)
+		}
+	}
+	text, keyboard := b.routesPanel()
+	b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, keyboard))
+}
+
+// handleRouteInput 处理管理员发送的新路由规则
+func (b *BotInstance) handleRouteInput(msg *tgbotapi.Message) {
+	route, err := parseForwardRoute(msg.Text)
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n请重新发送，或发送 /cancel 取消。"))
+		return
+	}
+	for _, target := range route.Targets {
+		if err := b.validateForwardTarget(target); err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n请重新发送，或发送 /cancel 取消。"))
+			return
+		}
+	}
+	payload, err := json.Marshal(route)
+	if err != nil {
+		log.Printf("序列化转发路由规则失败: %v", err)
+		return
+	}
+	id, err := b.redisClient.AddForwardRoute(context.Background(), string(payload))
+	if err != nil {
+		log.Printf("保存转发路由规则失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 保存规则失败，请稍后再试。"))
+		return
+	}
+	route.ID = id
+	if err := b.loadForwardRoutes(); err != nil {
+		log.Printf("重新加载转发路由规则失败: %v", err)
+	}
+	delete(b.pendingSettings, msg.Chat.ID)
+	b.audit(msg.From.ID, cache.AuditSettings, "添加转发路由规则 "+route.describe())
+
+	text, keyboard := b.routesPanel()
+	reply := tgbotapi.NewMessage(msg.Chat.ID, "✅ 已添加规则。\n\n"+text)
+	reply.ReplyMarkup = keyboard
+	b.API.Send(reply)
+}
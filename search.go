@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxSearchResults = 20
+	// maxIndexedTextLength 写入搜索索引的消息最多保留的字符数
+	maxIndexedTextLength = 1000
+	// searchSnippetRadius 搜索结果中关键词前后保留的字符数
+	searchSnippetRadius = 30
+	// ticketStartPrefix 管理员通过 "/start ticket_<工单号>" 深度链接打开工单
+	ticketStartPrefix = "ticket_"
+)
+
+// isCJK 报告字符是否为中日韩文字，这些文字没有空格分词，按单字和相邻两字建立索引
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// searchTokens 将文本切分为索引词项：拉丁字母和数字按单词（小写），中日韩文字按单字和相邻两字。
+// forQuery 为 true 时中日韩文字只使用相邻两字（单字时使用单字），减少求交集的集合数。
+func searchTokens(text string, forQuery bool) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(token string) {
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		add(string(word))
+		word = word[:0]
+	}
+	flushCJK := func() {
+		for i, r := range cjk {
+			if !forQuery || len(cjk) == 1 {
+				add(string(r))
+			}
+			if i+1 < len(cjk) {
+				add(string(cjk[i : i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// indexMessage 将用户对话中的文本消息写入搜索索引
+func (b *BotInstance) indexMessage(userID int64, entry cache.HistoryEntry, msg *tgbotapi.Message) {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	if runes := []rune(text); len(runes) > maxIndexedTextLength {
+		text = string(runes[:maxIndexedTextLength])
+	}
+	indexed := cache.IndexedMessage{
+		UserID:    userID,
+		At:        entry.At,
+		Direction: entry.Direction,
+		Author:    entry.Author,
+		Text:      text,
+		Tokens:    searchTokens(text, false),
+	}
+	if err := b.redisClient.IndexMessage(context.Background(), indexed); err != nil {
+		log.Printf("写入用户 %d 的消息搜索索引失败: %v", userID, err)
+	}
+}
+
+// handleSearch 处理 /search <关键词>，在对话记录中搜索包含关键词的消息，按时间从新到旧列出
+func (b *BotInstance) handleSearch(msg *tgbotapi.Message) {
+	keyword := strings.TrimSpace(msg.CommandArguments())
+	tokens := searchTokens(keyword, true)
+	if len(tokens) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("用法：/search <关键词>\n在最近 %d 天的对话中搜索，英文按整词匹配，中文按字词匹配。", int(cache.SearchRetention.Hours()/24))))
+		return
+	}
+
+	candidates, err := b.redisClient.SearchMessages(context.Background(), tokens)
+	if err != nil {
+		log.Printf("搜索对话记录失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 搜索失败。"))
+		return
+	}
+	// 倒排索引按词项匹配，再按原文确认每个关键词都出现（例如中文词语需要相邻）
+	keywords := strings.Fields(strings.ToLower(keyword))
+	var matches []cache.IndexedMessage
+	for _, candidate := range candidates {
+		if containsAll(strings.ToLower(candidate.Text), keywords) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("没有找到包含「%s」的消息。", keyword)))
+		return
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].At.After(matches[j].At) })
+
+	lines := []string{fmt.Sprintf("找到 %d 条包含「%s」的消息：\n", len(matches), html.EscapeString(keyword))}
+	if len(matches) > maxSearchResults {
+		lines[0] = fmt.Sprintf("找到 %d 条包含「%s」的消息，显示最近 %d 条：\n", len(matches), html.EscapeString(keyword), maxSearchResults)
+		matches = matches[:maxSearchResults]
+	}
+	for _, match := range matches {
+		arrow := "⬅️"
+		if match.Direction == cache.HistoryOutbound {
+			arrow = "➡️"
+		}
+		line := fmt.Sprintf("%s %s %s", match.At.Format("01-02 15:04"), arrow, html.EscapeString(b.userLabel(match.UserID)))
+		if match.Direction == cache.HistoryOutbound {
+			line += "（" + html.EscapeString(match.Author) + "）"
+		}
+		if ticket := b.userTicket(match.UserID); ticket != "" {
+			line += fmt.Sprintf(` <a href="https://t.me/%s?start=%s%s">工单 #%s</a>`, b.API.Self.UserName, ticketStartPrefix, ticket, ticket)
+		}
+		lines = append(lines, line+"\n"+html.EscapeString(searchSnippet(match.Text, keywords[0]))+"\n")
+	}
+	b.sendLongText(msg.Chat.ID, lines, tgbotapi.ModeHTML)
+}
+
+// containsAll 报告 text 是否包含所有关键词
+func containsAll(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if !strings.Contains(text, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchSnippet 截取关键词附近的文本
+func searchSnippet(text, lowerKeyword string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	runes := []rune(text)
+	start := 0
+	if i := strings.Index(strings.ToLower(text), lowerKeyword); i >= 0 {
+		start = len([]rune(strings.ToLower(text)[:i]))
+	}
+	from := max(start-searchSnippetRadius, 0)
+	to := min(start+len([]rune(lowerKeyword))+searchSnippetRadius, len(runes))
+	snippet := string(runes[from:to])
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
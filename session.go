@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"my-tg-bot/internal/broadcast"
+	"my-tg-bot/internal/cache"
+)
+
+// restoreAdminSession 在本进程首次处理该会话时，从 Redis 恢复重启前未完成的操作状态和广播草稿
+func (b *BotInstance) restoreAdminSession(chatID int64) {
+	if b.restoredSessions[chatID] {
+		return
+	}
+	session, err := b.redisClient.GetAdminSession(context.Background(), chatID)
+	if err != nil {
+		// 读取失败时不标记为已恢复，下次再试
+		log.Printf("恢复管理员会话 %d 失败: %v", chatID, err)
+		return
+	}
+	b.restoredSessions[chatID] = true
+	if session == (cache.AdminSession{}) {
+		return
+	}
+
+	b.adminStates[chatID] = session.State
+	if session.ActiveAt != 0 {
+		b.stateActivity[chatID] = time.Unix(session.ActiveAt, 0)
+	}
+	if session.BroadcastDraft != "" {
+		var draft broadcast.Message
+		if err := json.Unmarshal([]byte(session.BroadcastDraft), &draft); err != nil {
+			log.Printf("解析管理员 %d 的广播草稿失败: %v", chatID, err)
+		} else {
+			b.broadcastManager.Broadcasts[chatID] = draft
+		}
+	}
+	if session.TopicEdit != "" {
+		b.welcomeManager.TopicEdits[chatID] = session.TopicEdit
+	}
+	log.Printf("已恢复管理员会话 %d，状态: %d", chatID, session.State)
+}
+
+// saveAdminSession 将会话当前的操作状态和广播草稿写入 Redis，使其在重启后仍可继续
+func (b *BotInstance) saveAdminSession(chatID int64) {
+	session := cache.AdminSession{
+		State:     b.adminStates[chatID],
+		TopicEdit: b.welcomeManager.TopicEdits[chatID],
+	}
+	if !b.hasAdminState(chatID) {
+		delete(b.stateActivity, chatID)
+	} else if _, ok := b.stateActivity[chatID]; !ok {
+		b.stateActivity[chatID] = time.Now()
+	}
+	if draft, ok := b.broadcastManager.Broadcasts[chatID]; ok {
+		payload, err := json.Marshal(draft)
+		if err != nil {
+			log.Printf("序列化管理员 %d 的广播草稿失败: %v", chatID, err)
+		} else {
+			session.BroadcastDraft = string(payload)
+		}
+	}
+	if session != (cache.AdminSession{}) {
+		session.ActiveAt = b.stateActivity[chatID].Unix()
+	}
+	if err := b.redisClient.SaveAdminSession(context.Background(), chatID, session); err != nil {
+		log.Printf("保存管理员会话 %d 失败: %v", chatID, err)
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	ConfigForwardTarget    = "config:forward_target"     // 转发目标会话 ID，为空时使用 FORWARD_TO_ADMIN_ID
+	ConfigFloodLimit       = "config:flood_limit"        // 刷屏限制，格式为“每分钟条数 禁言分钟数”，为空时使用环境变量
+	ConfigRequiredChannel  = "config:required_channel"   // 强制关注频道，格式为“频道 [加入链接]”，off 表示关闭，为空时使用环境变量
+	ConfigDefaultParseMode = "config:default_parse_mode" // 新建广播的默认文本格式，为空时为纯文本
+	ConfigDigestSeconds    = "config:digest_seconds"     // 汇总转发的等待秒数，为空时使用 DIGEST_SECONDS
+
+	settingsCallbackPrefix = "settings_"
+	settingOff             = "off"
+)
+
+// 可在 /settings 中修改的设置项
+const (
+	settingForward = "forward"
+	settingAway    = "away"
+	settingFlood   = "flood"
+	settingChannel = "channel"
+	settingParse   = "parse"
+	settingDigest  = "digest"
+)
+
+// settingConfigKeys 是各设置项保存在 Redis 中的键
+var settingConfigKeys = map[string]string{
+	settingForward: ConfigForwardTarget,
+	settingAway:    ConfigAwayMessage,
+	settingFlood:   ConfigFloodLimit,
+	settingChannel: ConfigRequiredChannel,
+	settingParse:   ConfigDefaultParseMode,
+	settingDigest:  ConfigDigestSeconds,
+	settingSpam:    ConfigSpamSensitivity,
+}
+
+// runtimeSettings 是可以通过 /settings 在运行时修改的配置
+type runtimeSettings struct {
+	ForwardTo int64
+	Flood     floodConfig
+	Subscribe *subscribeConfig // 为 nil 时不要求用户关注频道
+	Routes    []forwardRoute   // 转发路由规则，保存在 Redis 中，不能通过环境变量配置
+	Digest    time.Duration    // 汇总转发的等待时间，为 0 时逐条转发
+	Spam      spamLevel        // 垃圾链接检测的灵敏度
+}
+
+// forwardTarget 返回当前接收用户消息的会话 ID，为 0 表示未配置
+func (b *BotInstance) forwardTarget() int64 {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings.ForwardTo
+}
+
+// envDefaults 返回环境变量中的设置，恢复默认时使用
+func (b *BotInstance) envDefaults() runtimeSettings {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.envSettings
+}
+
+// floodSettings 返回当前的刷屏限制
+func (b *BotInstance) floodSettings() floodConfig {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings.Flood
+}
+
+// subscribeSettings 返回当前的强制关注频道配置，为 nil 时不启用
+func (b *BotInstance) subscribeSettings() *subscribeConfig {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings.Subscribe
+}
+
+// loadStoredSettings 启动时读取通过 /settings 保存的配置，覆盖环境变量中的值；无效的值会被忽略
+func (b *BotInstance) loadStoredSettings() {
+	ctx := context.Background()
+	for _, setting := range []string{settingForward, settingFlood, settingChannel, settingParse, settingDigest, settingSpam} {
+		value, err := b.redisClient.GetConfigValue(ctx, settingConfigKeys[setting])
+		if err != nil {
+			log.Printf("读取设置 %s 失败，使用环境变量中的值: %v", setting, err)
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		if err := b.applySetting(setting, value); err != nil {
+			log.Printf("警告：已保存的设置 %s 无效（%s），使用环境变量中的值: %v", setting, value, err)
+		}
+	}
+	if err := b.loadForwardRoutes(); err != nil {
+		log.Printf("读取转发路由规则失败: %v", err)
+	}
+}
+
+// applySetting 解析设置值并立即生效，value 为空表示恢复环境变量中的值
+func (b *BotInstance) applySetting(setting, value string) error {
+	b.settingsMu.Lock()
+	defer b.settingsMu.Unlock()
+	switch setting {
+	case settingForward:
+		if value == "" {
+			b.settings.ForwardTo = b.envSettings.ForwardTo
+			return nil
+		}
+		chatID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || chatID == 0 {
+			return fmt.Errorf("会话 ID 必须是非零的数字")
+		}
+		b.settings.ForwardTo = chatID
+	case settingFlood:
+		if value == "" {
+			b.settings.Flood = b.envSettings.Flood
+			return nil
+		}
+		flood, err := parseFloodSetting(value)
+		if err != nil {
+			return err
+		}
+		b.settings.Flood = flood
+	case settingChannel:
+		switch value {
+		case "":
+			b.settings.Subscribe = b.envSettings.Subscribe
+			return nil
+		case settingOff:
+			b.settings.Subscribe = nil
+			return nil
+		}
+		fields := strings.Fields(value)
+		joinURL := ""
+		if len(fields) > 1 {
+			joinURL = fields[1]
+		}
+		cfg, err := parseSubscribeConfig(fields[0], joinURL)
+		if err != nil {
+			return err
+		}
+		if b.envSettings.Subscribe != nil {
+			cfg.CacheTTL = b.envSettings.Subscribe.CacheTTL
+		}
+		b.settings.Subscribe = cfg
+	case settingParse:
+		mode, ok := parseModeSetting(value)
+		if !ok {
+			return fmt.Errorf("未知的文本格式 %s", value)
+		}
+		b.broadcastManager.DefaultParseMode = mode
+	case settingDigest:
+		if value == "" {
+			b.settings.Digest = b.envSettings.Digest
+			return nil
+		}
+		wait, err := parseDigestSetting(value)
+		if err != nil {
+			return err
+		}
+		b.settings.Digest = wait
+	case settingSpam:
+		if value == "" {
+			b.settings.Spam = b.envSettings.Spam
+			return nil
+		}
+		level, err := parseSpamSetting(value)
+		if err != nil {
+			return err
+		}
+		b.settings.Spam = level
+	}
+	return nil
+}
+
+// parseFloodSetting 解析“每分钟条数 [禁言分钟数]”，条数为 0 表示不限制
+func parseFloodSetting(value string) (floodConfig, error) {
+	cfg := floodConfig{Mute: defaultFloodMuteMinutes * time.Minute}
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return cfg, fmt.Errorf("格式应为“每分钟条数 禁言分钟数”")
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 0 {
+		return cfg, fmt.Errorf("每分钟条数必须是不小于 0 的整数")
+	}
+	cfg.MaxPerMinute = n
+	if len(fields) == 2 {
+		minutes, err := strconv.Atoi(fields[1])
+		if err != nil || minutes < 1 {
+			return cfg, fmt.Errorf("禁言分钟数必须是大于 0 的整数")
+		}
+		cfg.Mute = time.Duration(minutes) * time.Minute
+	}
+	return cfg, nil
+}
+
+// parseModeSetting 将保存的格式名称转换为 Telegram 的 parse_mode，空值和 plain 表示纯文本
+func parseModeSetting(value string) (string, bool) {
+	switch strings.ToLower(value) {
+	case "", "plain":
+		return "", true
+	case "markdown", "markdownv2":
+		return tgbotapi.ModeMarkdownV2, true
+	case "html":
+		return tgbotapi.ModeHTML, true
+	}
+	return "", false
+}
+
+// handleSettings 处理 /settings 命令，显示设置面板
+func (b *BotInstance) handleSettings(msg *tgbotapi.Message) {
+	delete(b.pendingSettings, msg.Chat.ID)
+	text, keyboard := b.settingsPanel()
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyMarkup = keyboard
+	b.API.Send(reply)
+}
+
+// settingsPanel 生成设置面板的文本和按钮
+func (b *BotInstance) settingsPanel() (string, tgbotapi.InlineKeyboardMarkup) {
+	ctx := context.Background()
+	b.settingsMu.RLock()
+	settings := b.settings
+	b.settingsMu.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString("⚙️ 运行时设置（修改后立即生效，并保存到 Redis）\n\n")
+	sb.WriteString("📨 转发目标：" + describeForward(settings.ForwardTo) + b.settingSource(ctx, settingForward) + "\n")
+	sb.WriteString("🌙 离开消息：" + truncateRunes(b.awayMessage(ctx), 60) + b.settingSource(ctx, settingAway) + "\n")
+	sb.WriteString("🚦 刷屏限制：" + describeFlood(settings.Flood) + b.settingSource(ctx, settingFlood) + "\n")
+	sb.WriteString("📢 强制关注频道：" + describeChannel(settings.Subscribe) + b.settingSource(ctx, settingChannel) + "\n")
+	sb.WriteString("🔤 广播默认格式：" + describeParseMode(b.broadcastManager.DefaultParseMode) + "\n")
+	sb.WriteString("🗂 汇总转发：" + describeDigest(settings.Digest) + b.settingSource(ctx, settingDigest) + "\n")
+	sb.WriteString("🛡 垃圾链接检测：" + settings.Spam.Label + b.settingSource(ctx, settingSpam) + "\n")
+	sb.WriteString(fmt.Sprintf("🧭 转发路由规则：%d 条\n", len(settings.Routes)))
+	if b.topicsManager.Enabled() {
+		sb.WriteString(fmt.Sprintf("\n已启用话题模式，用户消息转发到群组 %d，转发目标只用于自检和通知。", b.topicsManager.GroupID))
+	}
+
+	button := func(label, setting string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, settingsCallbackPrefix+"edit_"+setting)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(button("📨 转发目标", settingForward), button("🌙 离开消息", settingAway)),
+		tgbotapi.NewInlineKeyboardRow(button("🚦 刷屏限制", settingFlood), button("📢 关注频道", settingChannel)),
+		tgbotapi.NewInlineKeyboardRow(button("🔤 广播格式", settingParse), button("🗂 汇总转发", settingDigest)),
+		tgbotapi.NewInlineKeyboardRow(button("🛡 垃圾链接", settingSpam), tgbotapi.NewInlineKeyboardButtonData("🧭 路由规则", settingsCallbackPrefix+"routes")),
+	)
+	return sb.String(), keyboard
+}
+
+// settingSource 说明设置项当前的值来自面板还是默认配置
+func (b *BotInstance) settingSource(ctx context.Context, setting string) string {
+	value, err := b.redisClient.GetConfigValue(ctx, settingConfigKeys[setting])
+	if err != nil || value == "" {
+		return "（默认）"
+	}
+	return ""
+}
+
+func describeForward(chatID int64) string {
+	if chatID == 0 {
+		return "未设置"
+	}
+	return strconv.FormatInt(chatID, 10)
+}
+
+func describeFlood(cfg floodConfig) string {
+	if cfg.MaxPerMinute == 0 {
+		return "不限制"
+	}
+	return fmt.Sprintf("每分钟最多 %d 条，超出后禁言 %d 分钟", cfg.MaxPerMinute, int(cfg.Mute.Minutes()))
+}
+
+func describeChannel(cfg *subscribeConfig) string {
+	if cfg == nil {
+		return "未启用"
+	}
+	return fmt.Sprintf("%s（%s）", cfg.key(), cfg.JoinURL)
+}
+
+func describeParseMode(mode string) string {
+	switch mode {
+	case tgbotapi.ModeMarkdownV2:
+		return "MarkdownV2"
+	case tgbotapi.ModeHTML:
+		return "HTML"
+	}
+	return "纯文本"
+}
+
+// truncateRunes 将文本截断为最多 n 个字符
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
+
+// handleSettingsCallback 处理设置面板上的按钮
+func (b *BotInstance) handleSettingsCallback(q *tgbotapi.CallbackQuery) {
+	chatID := q.Message.Chat.ID
+	action := strings.TrimPrefix(q.Data, settingsCallbackPrefix)
+	b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+
+	switch {
+	case action == "menu":
+		delete(b.pendingSettings, chatID)
+		text, keyboard := b.settingsPanel()
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, keyboard))
+	case action == "routes" || strings.HasPrefix(action, "route_"):
+		b.handleRouteCallback(q, action)
+	case strings.HasPrefix(action, "edit_"):
+		b.promptSetting(q, strings.TrimPrefix(action, "edit_"))
+	case strings.HasPrefix(action, "reset_"):
+		setting := strings.TrimPrefix(action, "reset_")
+		if _, ok := settingConfigKeys[setting]; !ok {
+			return
+		}
+		delete(b.pendingSettings, chatID)
+		if err := b.saveSetting(q.From.ID, setting, ""); err != nil {
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()))
+			return
+		}
+		text, keyboard := b.settingsPanel()
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, "✅ 已恢复默认值。\n\n"+text, keyboard))
+	case strings.HasPrefix(action, "parse_"):
+		if err := b.saveSetting(q.From.ID, settingParse, strings.TrimPrefix(action, "parse_")); err != nil {
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()))
+			return
+		}
+		text, keyboard := b.settingsPanel()
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, "✅ 广播默认格式已更新。\n\n"+text, keyboard))
+	case strings.HasPrefix(action, "spam_"):
+		if err := b.saveSetting(q.From.ID, settingSpam, strings.TrimPrefix(action, "spam_")); err != nil {
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()))
+			return
+		}
+		text, keyboard := b.settingsPanel()
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, "✅ 垃圾链接检测灵敏度已更新。\n\n"+text, keyboard))
+	}
+}
+
+// promptSetting 在面板消息中显示某个设置项的说明，并等待管理员发送新值
+func (b *BotInstance) promptSetting(q *tgbotapi.CallbackQuery, setting string) {
+	chatID := q.Message.Chat.ID
+	back := tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回", settingsCallbackPrefix+"menu")
+	reset := tgbotapi.NewInlineKeyboardButtonData("↩️ 恢复默认", settingsCallbackPrefix+"reset_"+setting)
+
+	var text string
+	switch setting {
+	case settingForward:
+		text = fmt.Sprintf("当前转发目标：%s\n\n请转发一条来自目标会话的消息，或发送新的会话 ID（个人、群组或频道的数字 ID），机器人需要能在该会话中发言。\n恢复默认将使用 FORWARD_TO_ADMIN_ID（%s）。",
+			describeForward(b.forwardTarget()), describeForward(b.envDefaults().ForwardTo))
+	case settingAway:
+		text = "当前离开消息：\n" + b.awayMessage(context.Background()) + "\n\n请发送新的离开消息，非工作时间收到用户消息时自动回复。\n恢复默认将使用内置的离开消息。"
+	case settingFlood:
+		text = fmt.Sprintf("当前刷屏限制：%s\n\n请发送“每分钟条数 禁言分钟数”，例如 20 10；发送 0 表示不限制。\n恢复默认将使用 FLOOD_MAX_PER_MINUTE / FLOOD_MUTE_MINUTES（%s）。",
+			describeFlood(b.floodSettings()), describeFlood(b.envDefaults().Flood))
+	case settingChannel:
+		text = fmt.Sprintf("当前强制关注频道：%s\n\n请发送“@频道用户名”或“频道数字ID 加入链接”，机器人需要是该频道的管理员；发送 off 关闭。\n恢复默认将使用 REQUIRED_CHANNEL（%s）。",
+			describeChannel(b.subscribeSettings()), describeChannel(b.envDefaults().Subscribe))
+	case settingDigest:
+		text = fmt.Sprintf("当前汇总转发：%s\n\n请发送等待秒数（0-3600），同一用户在这段时间内的消息会合并为一条汇总转发，适合消息量大的机器人；发送 0 表示逐条转发。\n恢复默认将使用 DIGEST_SECONDS（%s）。",
+			describeDigest(b.digestSettings()), describeDigest(b.envDefaults().Digest))
+	case settingParse:
+		current := b.broadcastManager.DefaultParseMode
+		option := func(mode, data string) tgbotapi.InlineKeyboardButton {
+			label := describeParseMode(mode)
+			if mode == current {
+				label = "✅ " + label
+			}
+			return tgbotapi.NewInlineKeyboardButtonData(label, settingsCallbackPrefix+"parse_"+data)
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(option("", "plain"), option(tgbotapi.ModeMarkdownV2, "markdown"), option(tgbotapi.ModeHTML, "html")),
+			tgbotapi.NewInlineKeyboardRow(back),
+		)
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, "请选择新建广播时默认使用的文本格式，创建广播时仍可单独修改：", keyboard))
+		return
+	case settingSpam:
+		current := b.spamSettings()
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, level := range spamLevels {
+			label := level.Label
+			if level.Name == current.Name {
+				label = "✅ " + label
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, settingsCallbackPrefix+"spam_"+level.Name)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(reset, back))
+		text = fmt.Sprintf("请选择垃圾链接检测的灵敏度。新用户发来主要由链接组成的消息时会被隔离，不转交客服，管理员可放行或拉黑；包含群组邀请链接时更容易被隔离。\n恢复默认将使用 SPAM_SENSITIVITY（%s）。", b.envDefaults().Spam.Label)
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, tgbotapi.NewInlineKeyboardMarkup(rows...)))
+		return
+	default:
+		return
+	}
+
+	b.pendingSettings[chatID] = setting
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(reset, back))
+	b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, keyboard))
+}
+
+// handlePendingSetting 处理管理员为设置项发送的新值，返回 true 表示消息已被处理
+func (b *BotInstance) handlePendingSetting(msg *tgbotapi.Message) bool {
+	setting, ok := b.pendingSettings[msg.Chat.ID]
+	if !ok {
+		return false
+	}
+	if msg.IsCommand() {
+		delete(b.pendingSettings, msg.Chat.ID)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "已取消，设置未修改。"))
+		return true
+	}
+	if setting == settingRoutes {
+		b.handleRouteInput(msg)
+		return true
+	}
+	value := strings.TrimSpace(msg.Text)
+	if setting == settingForward {
+		chatID, forwarded, err := forwardedChatID(msg)
+		if err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+			return true
+		}
+		if forwarded {
+			value = strconv.FormatInt(chatID, 10)
+		}
+	}
+	if value == "" {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "请以文字发送新的设置值，或发送 /cancel 取消。"))
+		return true
+	}
+	if err := b.validateSetting(setting, value); err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n请重新发送，或发送 /cancel 取消。"))
+		return true
+	}
+	if err := b.saveSetting(msg.From.ID, setting, value); err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n请重新发送，或发送 /cancel 取消。"))
+		return true
+	}
+	delete(b.pendingSettings, msg.Chat.ID)
+	text, keyboard := b.settingsPanel()
+	reply := tgbotapi.NewMessage(msg.Chat.ID, "✅ 设置已更新。\n\n"+text)
+	reply.ReplyMarkup = keyboard
+	b.API.Send(reply)
+	return true
+}
+
+// validateSetting 在保存前确认机器人能在新的转发目标中发言、能查询频道成员
+func (b *BotInstance) validateSetting(setting, value string) error {
+	switch setting {
+	case settingForward:
+		chatID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || chatID == 0 {
+			return fmt.Errorf("会话 ID 必须是非零的数字")
+		}
+		return b.validateForwardTarget(chatID)
+	case settingChannel:
+		if value == settingOff {
+			return nil
+		}
+		fields := strings.Fields(value)
+		joinURL := ""
+		if len(fields) > 1 {
+			joinURL = fields[1]
+		}
+		cfg, err := parseSubscribeConfig(fields[0], joinURL)
+		if err != nil {
+			return err
+		}
+		member, err := b.API.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID:             cfg.ChatID,
+			SuperGroupUsername: cfg.Username,
+			UserID:             b.API.Self.ID,
+		}})
+		if err != nil {
+			return fmt.Errorf("无法访问频道 %s: %v", cfg.key(), err)
+		}
+		if !member.IsAdministrator() && !member.IsCreator() {
+			return fmt.Errorf("机器人不是频道 %s 的管理员，无法查询用户是否已加入", cfg.key())
+		}
+	}
+	return nil
+}
+
+// saveSetting 保存设置项到 Redis 并立即生效，value 为空表示恢复默认
+func (b *BotInstance) saveSetting(adminID int64, setting, value string) error {
+	if setting == settingParse {
+		mode, ok := parseModeSetting(value)
+		if !ok {
+			return fmt.Errorf("未知的文本格式 %s", value)
+		}
+		value = mode
+	}
+	if setting != settingAway {
+		if err := b.applySetting(setting, value); err != nil {
+			return err
+		}
+	}
+	if err := b.redisClient.SetConfigValue(context.Background(), settingConfigKeys[setting], value); err != nil {
+		log.Printf("保存设置 %s 失败: %v", setting, err)
+		return fmt.Errorf("新设置已生效，但保存到 Redis 失败，重启后将恢复原值")
+	}
+
+	details := fmt.Sprintf("设置 %s 修改为：%s", setting, value)
+	if value == "" {
+		details = fmt.Sprintf("设置 %s 恢复默认", setting)
+	}
+	log.Printf("管理员 %d %s", adminID, details)
+	b.audit(adminID, cache.AuditSettings, details)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	slaCheckInterval        = time.Minute
+	defaultSLAEscalateAfter = 3 // 连续提醒多少次后升级通知超级管理员
+)
+
+// slaConfig 是未回复提醒的配置，Reminder 为 0 时不启用
+type slaConfig struct {
+	Reminder      time.Duration // 用户消息超过该时间未回复时提醒，之后每隔同样时间再次提醒
+	EscalateAfter int
+}
+
+// loadSLAConfig 从 SLA_REMINDER_MINUTES 和 SLA_ESCALATE_AFTER 读取提醒配置
+func loadSLAConfig() slaConfig {
+	var cfg slaConfig
+	if minutesStr := os.Getenv("SLA_REMINDER_MINUTES"); minutesStr != "" {
+		minutes, err := strconv.Atoi(minutesStr)
+		if err != nil || minutes < 1 {
+			log.Printf("警告：SLA_REMINDER_MINUTES 无效（%s），不启用未回复提醒", minutesStr)
+		} else {
+			cfg.Reminder = time.Duration(minutes) * time.Minute
+		}
+	}
+	cfg.EscalateAfter = defaultSLAEscalateAfter
+	if escalateStr := os.Getenv("SLA_ESCALATE_AFTER"); escalateStr != "" {
+		n, err := strconv.Atoi(escalateStr)
+		if err != nil || n < 1 {
+			log.Printf("警告：SLA_ESCALATE_AFTER 无效（%s），使用默认值 %d", escalateStr, defaultSLAEscalateAfter)
+		} else {
+			cfg.EscalateAfter = n
+		}
+	}
+	return cfg
+}
+
+// markAwaitingReply 记录用户有消息等待客服回复
+func (b *BotInstance) markAwaitingReply(userID int64) {
+	if b.sla.Reminder == 0 {
+		return
+	}
+	if err := b.redisClient.MarkAwaitingReply(context.Background(), userID, time.Now()); err != nil {
+		log.Printf("记录用户 %d 等待回复失败: %v", userID, err)
+	}
+}
+
+// clearAwaitingReply 客服已回复或会话已解决，停止对该用户的提醒
+func (b *BotInstance) clearAwaitingReply(userID int64) {
+	if b.sla.Reminder == 0 {
+		return
+	}
+	if err := b.redisClient.ClearAwaitingReply(context.Background(), userID); err != nil {
+		log.Printf("清除用户 %d 等待回复记录失败: %v", userID, err)
+	}
+}
+
+// StartSLAWatcher 启动后台检查，用户消息超时未回复时提醒管理员，多次提醒后升级通知超级管理员
+func (b *BotInstance) StartSLAWatcher() {
+	if b.sla.Reminder == 0 {
+		return
+	}
+	log.Printf("已启用未回复提醒：超过 %v 未回复时提醒，%d 次后升级", b.sla.Reminder, b.sla.EscalateAfter)
+	go func() {
+		ticker := time.NewTicker(slaCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.checkSLA()
+		}
+	}()
+}
+
+// checkSLA 对每位等待时间超过 (提醒次数+1)×提醒间隔 的用户发送一次提醒
+func (b *BotInstance) checkSLA() {
+	ctx := context.Background()
+	now := time.Now()
+	waiting, err := b.redisClient.GetAwaitingReplies(ctx, now.Add(-b.sla.Reminder))
+	if err != nil {
+		log.Printf("获取等待回复的用户失败: %v", err)
+		return
+	}
+	for _, item := range waiting {
+		waited := now.Sub(item.Since)
+		if waited < time.Duration(item.Reminders+1)*b.sla.Reminder {
+			continue
+		}
+		count, err := b.redisClient.IncrSLAReminders(ctx, item.UserID)
+		if err != nil {
+			log.Printf("更新用户 %d 提醒次数失败: %v", item.UserID, err)
+			continue
+		}
+
+		text := fmt.Sprintf("⏰ %s 的消息已等待 %d 分钟未回复（第 %d 次提醒）", b.slaUserLabel(item.UserID), int(waited.Minutes()), count)
+		b.notifyForwardTarget(text)
+		if count >= b.sla.EscalateAfter {
+			b.escalateSLA("🚨 升级提醒：" + strings.TrimPrefix(text, "⏰ "))
+		}
+	}
+}
+
+// slaUserLabel 返回提醒中显示的用户名称、ID 和工单号
+func (b *BotInstance) slaUserLabel(userID int64) string {
+	label := b.userLabel(userID)
+	if ticket := b.userTicket(userID); ticket != "" {
+		label += " 工单 #" + ticket
+	}
+	return label
+}
+
+// notifyForwardTarget 将通知发送到接收用户消息的会话，未配置时发送给所有管理员；返回发送到会话时的错误
+func (b *BotInstance) notifyForwardTarget(text string) error {
+	target := b.forwardTarget()
+	if b.topicsManager.Enabled() {
+		target = b.topicsManager.GroupID
+	}
+	if target == 0 {
+		b.notifyAdmins(text)
+		return nil
+	}
+	if _, err := b.API.Send(tgbotapi.NewMessage(target, text)); err != nil {
+		log.Printf("发送通知到客服会话失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// escalateSLA 私信通知所有超级管理员
+func (b *BotInstance) escalateSLA(text string) {
+	for _, adminID := range b.adminIDList() {
+		if !b.isSuperAdmin(adminID) {
+			continue
+		}
+		if _, err := b.API.Send(tgbotapi.NewMessage(adminID, text)); err != nil {
+			log.Printf("发送升级提醒给超级管理员 %d 失败: %v", adminID, err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	ConfigSpamSensitivity = "config:spam_sensitivity" // 垃圾链接检测的灵敏度，为空时使用 SPAM_SENSITIVITY
+
+	settingSpam = "spam"
+
+	spamApprovePrefix = "spam_ok_"    // 放行被隔离消息的回调前缀，后接隔离 ID
+	spamBlockPrefix   = "spam_block_" // 拉黑发送者的回调前缀，后接隔离 ID
+)
+
+// spamLevel 是垃圾链接检测的一档灵敏度：首次出现不超过 NewUserAge 的用户，
+// 消息中链接占比达到 MinLinkShare 时隔离；包含群组邀请链接时占比要求减半
+type spamLevel struct {
+	Name         string
+	Label        string
+	NewUserAge   time.Duration
+	MinLinkShare float64
+}
+
+// spamLevels 是可选的灵敏度，从低到高排列；off 不检测
+var spamLevels = []spamLevel{
+	{Name: settingOff, Label: "关闭"},
+	{Name: "low", Label: "低（1 小时内的新用户，链接占 80% 以上）", NewUserAge: time.Hour, MinLinkShare: 0.8},
+	{Name: "medium", Label: "中（24 小时内的新用户，链接占一半以上）", NewUserAge: 24 * time.Hour, MinLinkShare: 0.5},
+	{Name: "high", Label: "高（7 天内的新用户，链接占 30% 以上）", NewUserAge: 7 * 24 * time.Hour, MinLinkShare: 0.3},
+}
+
+var (
+	linkPattern   = regexp.MustCompile(`(?i)(https?://|www\.|(?:t|telegram)\.me/)\S+`)
+	invitePattern = regexp.MustCompile(`(?i)(?:t|telegram)\.me/(?:\+|joinchat/)`)
+)
+
+// parseSpamSetting 解析灵敏度名称
+func parseSpamSetting(value string) (spamLevel, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, level := range spamLevels {
+		if level.Name == value {
+			return level, nil
+		}
+	}
+	return spamLevels[0], fmt.Errorf("灵敏度必须是 off、low、medium 或 high")
+}
+
+// loadSpamConfig 从 SPAM_SENSITIVITY 读取垃圾链接检测的灵敏度，未设置时不检测
+func loadSpamConfig() spamLevel {
+	value := os.Getenv("SPAM_SENSITIVITY")
+	if value == "" {
+		return spamLevels[0]
+	}
+	level, err := parseSpamSetting(value)
+	if err != nil {
+		log.Printf("警告：SPAM_SENSITIVITY 无效（%s），不检测垃圾链接", value)
+	}
+	return level
+}
+
+// spamSettings 返回当前的垃圾链接检测灵敏度
+func (b *BotInstance) spamSettings() spamLevel {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings.Spam
+}
+
+// utf16Len 按 Telegram 的计数方式计算文本长度
+func utf16Len(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// linkShare 返回消息文字中链接所占的比例（不计空白），以及是否包含群组邀请链接
+func linkShare(msg *tgbotapi.Message) (float64, bool) {
+	text, entities := msg.Text, msg.Entities
+	if text == "" {
+		text, entities = msg.Caption, msg.CaptionEntities
+	}
+	total := utf16Len(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text))
+	if total == 0 {
+		return 0, false
+	}
+	links := 0
+	for _, match := range linkPattern.FindAllString(text, -1) {
+		links += utf16Len(match)
+	}
+	invite := invitePattern.MatchString(text)
+	for _, entity := range entities {
+		// 隐藏在文字后的链接按文字长度计入
+		if entity.Type == "text_link" {
+			links += entity.Length
+			invite = invite || invitePattern.MatchString(entity.URL)
+		}
+	}
+	return min(float64(links)/float64(total), 1), invite
+}
+
+// quarantinedMessage 是被隔离、等待管理员处理的用户消息
+type quarantinedMessage struct {
+	Message *tgbotapi.Message `json:"message"`
+}
+
+// checkSpam 检查新用户的消息是否主要由链接组成。命中时隔离该消息：不转发，
+// 将内容和“放行”“拉黑”按钮发给管理员。返回 false 表示该消息不应继续处理
+func (b *BotInstance) checkSpam(msg *tgbotapi.Message) bool {
+	level := b.spamSettings()
+	if level.Name == settingOff {
+		return true
+	}
+	share, invite := linkShare(msg)
+	threshold := level.MinLinkShare
+	if invite {
+		threshold /= 2
+	}
+	if share == 0 || share < threshold {
+		return true
+	}
+
+	ctx := context.Background()
+	userID := msg.From.ID
+	if trusted, err := b.redisClient.IsUserTrusted(ctx, userID); err != nil || trusted {
+		return true
+	}
+	profile, _, err := b.redisClient.GetUserProfile(ctx, userID)
+	if err != nil {
+		// 无法确认时放行，避免 Redis 故障导致客服转发中断
+		log.Printf("读取用户 %d 资料失败，跳过垃圾链接检测: %v", userID, err)
+		return true
+	}
+	if !profile.FirstSeen.IsZero() && time.Since(profile.FirstSeen) > level.NewUserAge {
+		return true
+	}
+
+	payload, err := json.Marshal(quarantinedMessage{Message: msg})
+	if err != nil {
+		log.Printf("序列化用户 %d 的消息失败: %v", userID, err)
+		return true
+	}
+	id, err := b.redisClient.SaveQuarantine(ctx, string(payload))
+	if err != nil {
+		log.Printf("隔离用户 %d 的消息失败: %v", userID, err)
+		return true
+	}
+	log.Printf("用户 %d 的消息疑似垃圾链接（链接占 %.0f%%），已隔离为 #%d", userID, share*100, id)
+
+	text := fmt.Sprintf("🛡 已隔离疑似垃圾消息 #%d\n来自新用户 %s，链接占 %.0f%%", id, b.userLabel(userID), share*100)
+	if invite {
+		text += "，包含群组邀请链接"
+	}
+	text += "：\n\n" + truncateRunes(messageSummary(msg), 500) + "\n\n放行后照常转交并不再检查该用户。"
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ 放行", fmt.Sprintf("%s%d", spamApprovePrefix, id)),
+		tgbotapi.NewInlineKeyboardButtonData("🚫 拉黑", fmt.Sprintf("%s%d", spamBlockPrefix, id)),
+	))
+	b.flagToAdmins(msg, text, &markup)
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "您的消息包含较多链接，需要客服审核后才会转交，请耐心等待。"))
+	return false
+}
+
+// handleSpamCallback 处理隔离消息下的“放行”和“拉黑”按钮
+func (b *BotInstance) handleSpamCallback(q *tgbotapi.CallbackQuery) {
+	approve := strings.HasPrefix(q.Data, spamApprovePrefix)
+	id, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimPrefix(q.Data, spamApprovePrefix), spamBlockPrefix), 10, 64)
+	if err != nil || q.Message == nil {
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	ctx := context.Background()
+	payload, err := b.redisClient.TakeQuarantine(ctx, id)
+	if err != nil {
+		log.Printf("读取隔离消息 #%d 失败: %v", id, err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 操作失败，请稍后再试"))
+		return
+	}
+	var item quarantinedMessage
+	if payload == "" || json.Unmarshal([]byte(payload), &item) != nil || item.Message == nil || item.Message.From == nil {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "该消息已处理或已过期"))
+		b.API.Send(tgbotapi.NewEditMessageReplyMarkup(q.Message.Chat.ID, q.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		return
+	}
+	msg := item.Message
+	userID := msg.From.ID
+
+	var result string
+	if approve {
+		if err := b.redisClient.TrustUser(ctx, userID); err != nil {
+			log.Printf("标记用户 %d 为可信失败: %v", userID, err)
+		}
+		b.audit(q.From.ID, cache.AuditApprove, fmt.Sprintf("用户 %d 的隔离消息 #%d", userID, id))
+		result = fmt.Sprintf("✅ 已由 %s 放行", adminDisplayName(q.From))
+		b.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已放行"))
+		// 放行的消息已经过检查，只记录会话并转交给客服；在该用户的工作协程中处理，与其后续消息保持顺序
+		go b.runForUser(userID, func() {
+			b.recordUserMessage(msg)
+			b.forwardUserMessage(msg)
+		})
+	} else {
+		if err := b.redisClient.AddBlockedUser(ctx, userID); err != nil {
+			log.Printf("拉黑用户 %d 失败: %v", userID, err)
+			b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 拉黑失败，请稍后再试"))
+			return
+		}
+		b.audit(q.From.ID, cache.AuditBlock, fmt.Sprintf("用户 %d（隔离消息 #%d）", userID, id))
+		b.emitBlocked(userID, q.From.ID, "quarantine")
+		result = fmt.Sprintf("🚫 已由 %s 拉黑发送者", adminDisplayName(q.From))
+		b.API.Request(tgbotapi.NewCallback(q.ID, "✅ 用户已拉黑"))
+	}
+	b.API.Send(tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID, q.Message.Text+"\n\n"+result))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 图表尺寸和颜色
+const (
+	chartWidth   = 720
+	chartHeight  = 360
+	chartPadding = 24
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	chartReceived   = color.RGBA{0x3b, 0x82, 0xf6, 0xff} // 收到的消息
+	chartAnswered   = color.RGBA{0x22, 0xc5, 0x5e, 0xff} // 回复的消息
+)
+
+// renderMessageChart 将每天收到和回复的消息数画成并列柱状图，返回 PNG 数据
+func renderMessageChart(received, answered []int64) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(chartBackground), image.Point{}, draw.Src)
+
+	bottom := chartHeight - chartPadding
+	top := chartPadding
+	draw.Draw(img, image.Rect(chartPadding, bottom, chartWidth-chartPadding, bottom+1), image.NewUniform(chartAxis), image.Point{}, draw.Src)
+
+	peak := int64(1)
+	for i := range received {
+		peak = max(peak, received[i], answered[i])
+	}
+	slot := (chartWidth - 2*chartPadding) / max(len(received), 1)
+	bar := max(slot/3, 1)
+	for i := range received {
+		left := chartPadding + i*slot + (slot-2*bar)/2
+		for j, series := range []struct {
+			value int64
+			color color.RGBA
+		}{{received[i], chartReceived}, {answered[i], chartAnswered}} {
+			height := int(series.value * int64(bottom-top) / peak)
+			x := left + j*bar
+			draw.Draw(img, image.Rect(x, bottom-height, x+bar-1, bottom), image.NewUniform(series.color), image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendStatsChart 发送最近 statsChartDays 天每天收到和回复的消息数柱状图
+func (b *BotInstance) sendStatsChart(chatID int64) {
+	dates, stats, err := b.dailyStatsRange(context.Background(), statsChartDays)
+	if err != nil {
+		log.Printf("获取每日统计失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取每日统计失败。"))
+		return
+	}
+	received := make([]int64, len(stats))
+	answered := make([]int64, len(stats))
+	for i, s := range stats {
+		received[i], answered[i] = s[cache.DailyMessagesReceived], s[cache.DailyMessagesAnswered]
+	}
+	data, err := renderMessageChart(received, answered)
+	if err != nil {
+		log.Printf("生成统计图表失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(chatID, "❌ 生成统计图表失败。"))
+		return
+	}
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "stats.png", Bytes: data})
+	photo.Caption = fmt.Sprintf("%s 至 %s 每天的消息数\n蓝色：收到，绿色：回复", dates[0].Format("01-02"), dates[len(dates)-1].Format("01-02"))
+	if _, err := b.API.Send(photo); err != nil {
+		log.Printf("发送统计图表失败: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// formatBytes 将字节数格式化为 KB、MB 或 GB
+func formatBytes(n uint64) string {
+	const unit = 1024
+	switch {
+	case n >= unit*unit*unit:
+		return fmt.Sprintf("%.1f GB", float64(n)/(unit*unit*unit))
+	case n >= unit*unit:
+		return fmt.Sprintf("%.1f MB", float64(n)/(unit*unit))
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/unit)
+}
+
+// handleStatus 处理 /status：汇总运行时间、内存、更新队列、Redis、Telegram API、广播和定时任务的状态
+func (b *BotInstance) handleStatus(msg *tgbotapi.Message) {
+	var sb strings.Builder
+	sb.WriteString("📟 运行状态\n\n")
+
+	sb.WriteString(fmt.Sprintf("运行时间：%s（启动于 %s）\n", formatWait(time.Since(b.startedAt)), b.startedAt.Format("2006-01-02 15:04:05")))
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	sb.WriteString(fmt.Sprintf("Go 版本：%s（%s/%s）\n", runtime.Version(), runtime.GOOS, runtime.GOARCH))
+	sb.WriteString(fmt.Sprintf("内存：已分配 %s，向系统申请 %s，GC %d 次\n", formatBytes(mem.HeapAlloc), formatBytes(mem.Sys), mem.NumGC))
+	sb.WriteString(fmt.Sprintf("协程数：%d\n", runtime.NumGoroutine()))
+
+	mode := "长轮询"
+	if b.webhook != nil {
+		mode = "Webhook"
+	}
+	if b.updatePool != nil {
+		queued, capacity := b.updatePool.queued()
+		sb.WriteString(fmt.Sprintf("更新队列：%d / %d 条等待处理（%s，%d 个工作协程）\n", queued, capacity, mode, b.updateWorkers))
+	}
+	if b.updateOffsets != nil {
+		sb.WriteString(fmt.Sprintf("处理中的更新：%d 条\n", b.updateOffsets.inFlight()))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := b.redisClient.Ping(ctx); err != nil {
+		sb.WriteString("Redis：❌ " + err.Error() + "\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("Redis：✅ 延迟 %s\n", time.Since(start).Round(100*time.Microsecond)))
+	}
+
+	lastErr, lastErrAt, failures := b.apiHealth.lastError()
+	switch {
+	case lastErr == "":
+		sb.WriteString("Telegram API：✅ 启动以来没有失败的请求\n")
+	case failures > 0:
+		sb.WriteString(fmt.Sprintf("Telegram API：⚠️ 连续失败 %d 次，最近的错误（%s）：%s\n", failures, lastErrAt.Format("01-02 15:04:05"), lastErr))
+	default:
+		sb.WriteString(fmt.Sprintf("Telegram API：✅ 正常，最近的错误（%s）：%s\n", lastErrAt.Format("01-02 15:04:05"), lastErr))
+	}
+
+	sb.WriteString("\n")
+	if running := b.broadcastManager.RunningBroadcasts(); len(running) > 0 {
+		sb.WriteString(fmt.Sprintf("正在发送的广播：%d 个（#%s）\n", len(running), strings.Join(running, "、#")))
+	} else {
+		sb.WriteString("正在发送的广播：无\n")
+	}
+	if scheduled, err := b.redisClient.GetScheduledBroadcasts(ctx); err != nil {
+		sb.WriteString("定时广播：读取失败\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("定时广播：%d 个待发送\n", len(scheduled)))
+	}
+	if active, paused, err := b.broadcastManager.CountRecurringBroadcasts(ctx); err != nil {
+		sb.WriteString("周期广播：读取失败\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("周期广播：%d 个启用，%d 个已暂停\n", active, paused))
+	}
+	if drips, err := b.redisClient.CountActiveDrips(ctx); err != nil {
+		sb.WriteString("跟进消息：读取失败\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("跟进消息：%d 位用户等待发送\n", drips))
+	}
+
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+}
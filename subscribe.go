@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultSubscribeCacheMinutes = 10
+	// subscribeMissCacheTTL 未加入频道的结果只缓存很短时间，用户加入后无需等待太久即可发消息
+	subscribeMissCacheTTL = time.Minute
+
+	subscribeCheckCallback = "subcheck"
+)
+
+// subscribeConfig 是强制关注频道的配置
+type subscribeConfig struct {
+	ChatID   int64  // 频道数字 ID，使用用户名时为 0
+	Username string // 频道用户名（带 @），使用数字 ID 时为空
+	JoinURL  string // 加入频道按钮的链接
+	CacheTTL time.Duration
+}
+
+// key 返回频道的标识，用于日志和缓存键
+func (c *subscribeConfig) key() string {
+	if c.Username != "" {
+		return c.Username
+	}
+	return strconv.FormatInt(c.ChatID, 10)
+}
+
+// loadSubscribeConfig 从 REQUIRED_CHANNEL、REQUIRED_CHANNEL_URL 和 REQUIRED_CHANNEL_CACHE_MINUTES 读取强制关注配置，
+// 未设置 REQUIRED_CHANNEL 时返回 nil（不启用）
+func loadSubscribeConfig() (*subscribeConfig, error) {
+	channel := strings.TrimSpace(os.Getenv("REQUIRED_CHANNEL"))
+	if channel == "" {
+		return nil, nil
+	}
+	cfg, err := parseSubscribeConfig(channel, strings.TrimSpace(os.Getenv("REQUIRED_CHANNEL_URL")))
+	if err != nil {
+		return nil, fmt.Errorf("REQUIRED_CHANNEL 配置错误：%w", err)
+	}
+	if minutesStr := os.Getenv("REQUIRED_CHANNEL_CACHE_MINUTES"); minutesStr != "" {
+		n, err := strconv.Atoi(minutesStr)
+		if err != nil || n < 1 {
+			log.Printf("警告：REQUIRED_CHANNEL_CACHE_MINUTES 无效（%s），使用默认值 %d", minutesStr, defaultSubscribeCacheMinutes)
+		} else {
+			cfg.CacheTTL = time.Duration(n) * time.Minute
+		}
+	}
+	return cfg, nil
+}
+
+// parseSubscribeConfig 解析频道（@channel 或数字 ID）和加入链接，使用用户名时加入链接可以为空
+func parseSubscribeConfig(channel, joinURL string) (*subscribeConfig, error) {
+	cfg := &subscribeConfig{
+		JoinURL:  joinURL,
+		CacheTTL: defaultSubscribeCacheMinutes * time.Minute,
+	}
+	if id, err := strconv.ParseInt(channel, 10, 64); err == nil {
+		cfg.ChatID = id
+	} else {
+		name := strings.TrimPrefix(channel, "@")
+		if name == "" || strings.ContainsAny(name, " /") {
+			return nil, fmt.Errorf("频道 %s 无效，请填写频道用户名（@channel）或数字 ID", channel)
+		}
+		cfg.Username = "@" + name
+		if cfg.JoinURL == "" {
+			cfg.JoinURL = "https://t.me/" + name
+		}
+	}
+	if cfg.JoinURL == "" {
+		return nil, fmt.Errorf("使用数字 ID 时必须提供加入链接（频道邀请链接）")
+	}
+	if !strings.HasPrefix(cfg.JoinURL, "https://") && !strings.HasPrefix(cfg.JoinURL, "http://") {
+		return nil, fmt.Errorf("加入链接 %s 无效，请使用 https:// 开头的链接", cfg.JoinURL)
+	}
+	return cfg, nil
+}
+
+// isChannelMember 调用 getChatMember 查询用户是否在频道中
+func (b *BotInstance) isChannelMember(cfg *subscribeConfig, userID int64) (bool, error) {
+	member, err := b.API.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+		ChatID:             cfg.ChatID,
+		SuperGroupUsername: cfg.Username,
+		UserID:             userID,
+	}})
+	if err != nil {
+		return false, err
+	}
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true, nil
+	case "restricted":
+		return member.IsMember, nil
+	}
+	return false, nil
+}
+
+// checkChannelMember 查询并缓存用户的频道成员状态，useCache 为 false 时忽略缓存重新查询。
+// 查询失败时（例如机器人不是频道管理员）放行，避免配置问题导致客服转发中断。
+func (b *BotInstance) checkChannelMember(cfg *subscribeConfig, userID int64, useCache bool) bool {
+	ctx := context.Background()
+	channel := cfg.key()
+	if useCache {
+		member, cached, err := b.redisClient.GetChannelMember(ctx, channel, userID)
+		if err != nil {
+			log.Printf("读取用户 %d 的频道成员缓存失败: %v", userID, err)
+		} else if cached {
+			return member
+		}
+	}
+
+	member, err := b.isChannelMember(cfg, userID)
+	if err != nil {
+		log.Printf("查询用户 %d 是否加入频道 %s 失败，按已加入处理: %v", userID, channel, err)
+		return true
+	}
+	ttl := cfg.CacheTTL
+	if !member {
+		ttl = min(ttl, subscribeMissCacheTTL)
+	}
+	if err := b.redisClient.SetChannelMember(ctx, channel, userID, member, ttl); err != nil {
+		log.Printf("缓存用户 %d 的频道成员状态失败: %v", userID, err)
+	}
+	return member
+}
+
+// checkSubscription 在转发用户消息前检查用户是否已加入必需的频道，未加入时提示用户加入。
+// 返回 false 表示该消息不应继续处理。
+func (b *BotInstance) checkSubscription(msg *tgbotapi.Message) bool {
+	cfg := b.subscribeSettings()
+	if cfg == nil || b.checkChannelMember(cfg, msg.From.ID, true) {
+		return true
+	}
+	notice := tgbotapi.NewMessage(msg.Chat.ID, "请先加入频道，加入后点击「我已加入」，再重新发送您的消息。")
+	notice.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("📢 加入频道", cfg.JoinURL)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ 我已加入", subscribeCheckCallback)),
+	)
+	b.API.Send(notice)
+	return false
+}
+
+// handleSubscribeCheckCallback 处理“我已加入”按钮：忽略缓存重新查询成员状态
+func (b *BotInstance) handleSubscribeCheckCallback(q *tgbotapi.CallbackQuery) {
+	cfg := b.subscribeSettings()
+	if cfg == nil || b.checkChannelMember(cfg, q.From.ID, false) {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "✅ 验证通过"))
+		if q.Message != nil {
+			b.API.Send(tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID, "✅ 已确认加入频道，现在可以发送消息了。"))
+		}
+		return
+	}
+	alert := tgbotapi.NewCallbackWithAlert(q.ID, "您还没有加入频道，请先加入后再点击。")
+	b.API.Request(alert)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTaggedUsersListed /tags <标签> 最多列出的用户数
+const maxTaggedUsersListed = 50
+
+// parseTagCommand 解析 /tag、/untag 的参数：用户和至少一个标签
+func (b *BotInstance) parseTagCommand(msg *tgbotapi.Message) (int64, []string, bool) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) < 2 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("用法：/%s <用户ID|@用户名> <标签> [标签...]\n标签只能包含字母、数字、下划线、连字符和中文，最长 %d 字节。", msg.Command(), cache.MaxTagLength)))
+		return 0, nil, false
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return 0, nil, false
+	}
+	var tags []string
+	for _, arg := range args[1:] {
+		tag := cache.NormalizeTag(arg)
+		if tag == "" {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 无效的标签：%s", arg)))
+			return 0, nil, false
+		}
+		tags = append(tags, tag)
+	}
+	return userID, tags, true
+}
+
+// handleTagCommand 处理 /tag 命令，为用户添加标签
+func (b *BotInstance) handleTagCommand(msg *tgbotapi.Message) {
+	userID, tags, ok := b.parseTagCommand(msg)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	for _, tag := range tags {
+		if _, err := b.redisClient.AddUserTag(ctx, userID, tag); err != nil {
+			log.Printf("为用户 %d 添加标签 %s 失败: %v", userID, tag, err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 添加标签失败，请稍后重试。"))
+			return
+		}
+	}
+	b.audit(msg.From.ID, cache.AuditTag, fmt.Sprintf("为用户 %d 添加标签：%s", userID, formatTags(tags)))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已为%s添加标签：%s", b.userLabel(userID), formatTags(tags))))
+}
+
+// handleUntagCommand 处理 /untag 命令，移除用户的标签
+func (b *BotInstance) handleUntagCommand(msg *tgbotapi.Message) {
+	userID, tags, ok := b.parseTagCommand(msg)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	var removed []string
+	for _, tag := range tags {
+		ok, err := b.redisClient.RemoveUserTag(ctx, userID, tag)
+		if err != nil {
+			log.Printf("移除用户 %d 的标签 %s 失败: %v", userID, tag, err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 移除标签失败，请稍后重试。"))
+			return
+		}
+		if ok {
+			removed = append(removed, tag)
+		}
+	}
+	if len(removed) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 没有这些标签。", b.userLabel(userID))))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditTag, fmt.Sprintf("移除用户 %d 的标签：%s", userID, formatTags(removed)))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已移除%s的标签：%s", b.userLabel(userID), formatTags(removed))))
+}
+
+// handleTags 处理 /tags 命令：不带参数时列出所有标签及人数，带标签时列出带该标签的用户
+func (b *BotInstance) handleTags(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		counts, err := b.redisClient.GetTagCounts(ctx)
+		if err != nil {
+			log.Printf("获取标签列表失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取标签列表失败。"))
+			return
+		}
+		if len(counts) == 0 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "还没有任何标签，使用 /tag <用户ID|@用户名> <标签> 为用户添加标签。"))
+			return
+		}
+		tags := make([]string, 0, len(counts))
+		for tag := range counts {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("标签共 %d 个：\n", len(tags)))
+		for _, tag := range tags {
+			sb.WriteString(fmt.Sprintf("#%s - %d 位用户\n", tag, counts[tag]))
+		}
+		sb.WriteString("\n使用 /tags <标签> 查看带该标签的用户。")
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+		return
+	}
+
+	tag := cache.NormalizeTag(arg)
+	if tag == "" {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 无效的标签：%s", arg)))
+		return
+	}
+	ids, err := b.redisClient.GetTagUserIDs(ctx, tag)
+	if err != nil {
+		log.Printf("获取标签 %s 的用户失败: %v", tag, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取用户列表失败。"))
+		return
+	}
+	if len(ids) == 0 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("没有用户带有标签 #%s。", tag)))
+		return
+	}
+	sort.Strings(ids)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("带有标签 #%s 的用户共 %d 位：\n", tag, len(ids)))
+	for i, idStr := range ids {
+		if i >= maxTaggedUsersListed {
+			sb.WriteString(fmt.Sprintf("（仅列出前 %d 位）\n", maxTaggedUsersListed))
+			break
+		}
+		userID, _ := strconv.ParseInt(idStr, 10, 64)
+		sb.WriteString(b.userLabel(userID) + "\n")
+	}
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+}
+
+// formatTags 将标签格式化为 “#a #b” 的形式
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return "无"
+	}
+	return "#" + strings.Join(tags, " #")
+}
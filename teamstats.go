@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	teamStatsCallback    = "teamstats_" // /teamstats 周期按钮的回调前缀，后接天数
+	teamStatsDefaultDays = 7            // 不带参数时的统计天数
+)
+
+// teamStatsPeriods 是 /teamstats 可选的统计周期
+var teamStatsPeriods = []struct {
+	days int
+	name string
+}{
+	{1, "今天"},
+	{7, "最近 7 天"},
+	{30, "最近 30 天"},
+}
+
+// teamStatsPeriodName 返回周期的名称，不是可选周期时返回 false
+func teamStatsPeriodName(days int) (string, bool) {
+	for _, period := range teamStatsPeriods {
+		if period.days == days {
+			return period.name, true
+		}
+	}
+	return "", false
+}
+
+// handleTeamStats 处理 /teamstats [天数]：按回复数列出各客服的回复数、平均首次响应时间和解决的会话数
+func (b *BotInstance) handleTeamStats(msg *tgbotapi.Message) {
+	days := teamStatsDefaultDays
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if _, ok := teamStatsPeriodName(n); err != nil || !ok {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/teamstats [1|7|30]\n不带参数时显示最近 7 天的统计。"))
+			return
+		}
+		days = n
+	}
+	text, keyboard, err := b.teamStatsPanel(days)
+	if err != nil {
+		log.Printf("获取客服统计失败: %v", err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取客服统计失败。"))
+		return
+	}
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyMarkup = keyboard
+	b.API.Send(reply)
+}
+
+// handleTeamStatsCallback 切换 /teamstats 的统计周期
+func (b *BotInstance) handleTeamStatsCallback(q *tgbotapi.CallbackQuery) {
+	days, err := strconv.Atoi(strings.TrimPrefix(q.Data, teamStatsCallback))
+	if _, ok := teamStatsPeriodName(days); err != nil || !ok || q.Message == nil {
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	text, keyboard, err := b.teamStatsPanel(days)
+	if err != nil {
+		log.Printf("获取客服统计失败: %v", err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 获取客服统计失败"))
+		return
+	}
+	b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(q.Message.Chat.ID, q.Message.MessageID, text, keyboard))
+	b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+}
+
+// teamStatsPanel 生成截至今天 days 天的客服排行榜和周期切换按钮
+func (b *BotInstance) teamStatsPanel(days int) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	stats, err := b.redisClient.GetOperatorStats(context.Background(), time.Now(), days)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	board := make([]*cache.OperatorStats, 0, len(stats))
+	for _, s := range stats {
+		board = append(board, s)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Replies != board[j].Replies {
+			return board[i].Replies > board[j].Replies
+		}
+		if board[i].Resolved != board[j].Resolved {
+			return board[i].Resolved > board[j].Resolved
+		}
+		return board[i].AdminID < board[j].AdminID
+	})
+
+	name, _ := teamStatsPeriodName(days)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("👥 客服统计（%s）\n", name))
+	if len(board) == 0 {
+		sb.WriteString("\n该时间段内没有客服回复或解决会话的记录。")
+	}
+	for i, s := range board {
+		response := "-"
+		if s.Responses > 0 {
+			response = formatWait(time.Duration(s.ResponseSeconds/s.Responses) * time.Second)
+		}
+		sb.WriteString(fmt.Sprintf("\n%d. %s\n   回复 %d 条 · 平均首次响应 %s · 解决 %d 个会话",
+			i+1, b.adminNameByID(s.AdminID), s.Replies, response, s.Resolved))
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, period := range teamStatsPeriods {
+		label := period.name
+		if period.days == days {
+			label = "· " + label + " ·"
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("%s%d", teamStatsCallback, period.days)))
+	}
+	return sb.String(), tgbotapi.NewInlineKeyboardMarkup(row), nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ticketSummaryLength 工单消息摘要保留的最大字符数
+const ticketSummaryLength = 100
+
+// userTicket 返回用户的工单号，没有时创建，失败时返回空字符串
+func (b *BotInstance) userTicket(userID int64) string {
+	ticket, err := b.redisClient.GetOrCreateUserTicket(context.Background(), userID)
+	if err != nil {
+		log.Printf("获取用户 %d 的工单失败: %v", userID, err)
+		return ""
+	}
+	return ticket.ID
+}
+
+// recordTicketMessage 在用户的工单中记录一条消息摘要
+func (b *BotInstance) recordTicketMessage(userID int64, author string, msg *tgbotapi.Message) {
+	id := b.userTicket(userID)
+	if id == "" {
+		return
+	}
+	entry := fmt.Sprintf("%s %s：%s", time.Now().Format("01-02 15:04"), author, messageSummary(msg))
+	if err := b.redisClient.AddTicketMessage(context.Background(), id, entry); err != nil {
+		log.Printf("记录工单 %s 消息失败: %v", id, err)
+	}
+}
+
+// messageTypeLabels 是非文本消息在摘要中的类型标记
+var messageTypeLabels = map[string]string{
+	"photo":      "[图片]",
+	"video":      "[视频]",
+	"animation":  "[动图]",
+	"sticker":    "[贴纸]",
+	"voice":      "[语音]",
+	"audio":      "[音频]",
+	"video_note": "[视频消息]",
+	"document":   "[文件]",
+	"location":   "[位置]",
+	"contact":    "[联系人]",
+	"poll":       "[投票]",
+}
+
+// messageType 返回消息的类型，与 Bot API 中的字段名一致；纯文本为 text，无法识别时为 other
+func messageType(msg *tgbotapi.Message) string {
+	switch {
+	case len(msg.Photo) > 0:
+		return "photo"
+	case msg.Video != nil:
+		return "video"
+	case msg.Animation != nil:
+		return "animation"
+	case msg.Sticker != nil:
+		return "sticker"
+	case msg.Voice != nil:
+		return "voice"
+	case msg.Audio != nil:
+		return "audio"
+	case msg.VideoNote != nil:
+		return "video_note"
+	case msg.Document != nil:
+		return "document"
+	case msg.Venue != nil, msg.Location != nil:
+		return "location"
+	case msg.Contact != nil:
+		return "contact"
+	case msg.Poll != nil:
+		return "poll"
+	case msg.Text != "":
+		return "text"
+	}
+	return "other"
+}
+
+// messageSummary 生成消息的简短摘要，非文本消息以类型表示
+func messageSummary(msg *tgbotapi.Message) string {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	kind := messageTypeLabels[messageType(msg)]
+	summary := strings.TrimSpace(kind + " " + strings.ReplaceAll(text, "\n", " "))
+	if runes := []rune(summary); len(runes) > ticketSummaryLength {
+		summary = string(runes[:ticketSummaryLength]) + "…"
+	}
+	if summary == "" {
+		summary = "[其他消息]"
+	}
+	return summary
+}
+
+// handleTicket 显示工单对应的用户、状态和最近消息
+func (b *BotInstance) handleTicket(msg *tgbotapi.Message) {
+	id := cache.NormalizeTicketID(msg.CommandArguments())
+	if id == "" {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/ticket <工单号>，例如：/ticket #A1024"))
+		return
+	}
+	b.showTicket(msg.Chat.ID, id)
+}
+
+// showTicket 向 chatID 发送工单详情
+func (b *BotInstance) showTicket(chatID int64, id string) {
+	ctx := context.Background()
+	ticket, ok, err := b.redisClient.GetTicket(ctx, id)
+	if err != nil {
+		log.Printf("获取工单 %s 失败: %v", id, err)
+		b.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取工单失败。"))
+		return
+	}
+	if !ok {
+		b.API.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("找不到工单 #%s。", id)))
+		return
+	}
+
+	firstName, lastName, username, _ := b.redisClient.GetUserInfo(ctx, ticket.UserID)
+	name := strings.TrimSpace(firstName + " " + lastName)
+	if username != "" {
+		name = strings.TrimSpace(name + " @" + username)
+	}
+	if name == "" {
+		name = "Unknown"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("工单 #%s\n用户：%s - ID: %d\n状态：%s\n创建时间：%s\n", ticket.ID, name, ticket.UserID, ticketStatusName(ticket.Status), ticket.CreatedAt.Format("2006-01-02 15:04")))
+	entries, err := b.redisClient.GetTicketMessages(ctx, ticket.ID, 10)
+	if err != nil {
+		log.Printf("获取工单 %s 消息失败: %v", id, err)
+	}
+	if len(entries) > 0 {
+		sb.WriteString("\n最近消息：\n")
+		for _, entry := range entries {
+			sb.WriteString(entry + "\n")
+		}
+	}
+
+	reply := tgbotapi.NewMessage(chatID, sb.String())
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonURL("与用户对话", fmt.Sprintf("tg://user?id=%d", ticket.UserID)),
+	))
+	b.API.Send(reply)
+}
+
+// maxOpenTicketsListed /open 最多列出的工单数
+const maxOpenTicketsListed = 50
+
+// ticketStatusName 返回工单状态的中文名称
+func ticketStatusName(status string) string {
+	switch status {
+	case cache.TicketStatusOpen:
+		return "待回复"
+	case cache.TicketStatusPending:
+		return "等待用户"
+	case cache.TicketStatusClosed:
+		return "已解决"
+	}
+	return status
+}
+
+// updateTicketStatus 更新用户工单的状态
+func (b *BotInstance) updateTicketStatus(userID int64, status string) {
+	id := b.userTicket(userID)
+	if id == "" {
+		return
+	}
+	if err := b.redisClient.SetTicketStatus(context.Background(), id, status); err != nil {
+		log.Printf("更新工单 %s 状态为 %s 失败: %v", id, status, err)
+	}
+}
+
+// handleResolveCallback 处理转发消息上的“标记已解决”按钮
+func (b *BotInstance) handleResolveCallback(q *tgbotapi.CallbackQuery) {
+	id := strings.TrimPrefix(q.Data, "resolve_")
+	ticket, ok, _ := b.redisClient.GetTicket(context.Background(), id)
+	if err := b.redisClient.SetTicketStatus(context.Background(), id, cache.TicketStatusClosed); err != nil {
+		log.Printf("标记工单 %s 已解决失败: %v", id, err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 操作失败"))
+		return
+	}
+	if ok {
+		// 重复点击已解决的工单不重复计入客服统计
+		if ticket.Status != cache.TicketStatusClosed {
+			if err := b.redisClient.RecordOperatorResolved(context.Background(), q.From.ID, time.Now()); err != nil {
+				log.Printf("记录管理员 %d 解决的会话数失败: %v", q.From.ID, err)
+			}
+		}
+		b.clearAwaitingReply(ticket.UserID)
+		b.releaseAssignment(ticket.UserID)
+		b.unpinVIPMessage(ticket.UserID)
+		if err := b.redisClient.ClearResponseWait(context.Background(), ticket.UserID); err != nil {
+			log.Printf("清除用户 %d 的响应计时失败: %v", ticket.UserID, err)
+		}
+	}
+	b.API.Request(tgbotapi.NewCallback(q.ID, fmt.Sprintf("✅ 工单 #%s 已标记为已解决", id)))
+	log.Printf("管理员 %d 将工单 %s 标记为已解决", q.From.ID, id)
+}
+
+// handleOpenTickets 列出所有未解决（待回复和等待用户）的工单
+func (b *BotInstance) handleOpenTickets(chatID int64) {
+	ctx := context.Background()
+	var sb strings.Builder
+	total := 0
+	for _, status := range []string{cache.TicketStatusOpen, cache.TicketStatusPending} {
+		ids, err := b.redisClient.GetTicketIDsByStatus(ctx, status)
+		if err != nil {
+			log.Printf("获取 %s 状态的工单失败: %v", status, err)
+			b.API.Send(tgbotapi.NewMessage(chatID, "❌ 获取未解决工单失败。"))
+			return
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n%s（%d）：\n", ticketStatusName(status), len(ids)))
+		for _, id := range ids {
+			total++
+			if total > maxOpenTicketsListed {
+				continue
+			}
+			ticket, _, _ := b.redisClient.GetTicket(ctx, id)
+			firstName, lastName, username, _ := b.redisClient.GetUserInfo(ctx, ticket.UserID)
+			name := strings.TrimSpace(firstName + " " + lastName)
+			if username != "" {
+				name = strings.TrimSpace(name + " @" + username)
+			}
+			sb.WriteString(fmt.Sprintf("#%s %s - ID: %d\n", id, name, ticket.UserID))
+		}
+	}
+	if total == 0 {
+		b.API.Send(tgbotapi.NewMessage(chatID, "当前没有未解决的会话。"))
+		return
+	}
+	text := fmt.Sprintf("未解决的会话共 %d 个：\n%s", total, sb.String())
+	if total > maxOpenTicketsListed {
+		text += fmt.Sprintf("\n（仅列出前 %d 个）", maxOpenTicketsListed)
+	}
+	text += "\n使用 /ticket <工单号> 查看详情。"
+	b.API.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// ticketStatsText 生成 /stats 中的会话状态统计
+func (b *BotInstance) ticketStatsText() string {
+	counts, err := b.redisClient.CountTicketsByStatus(context.Background())
+	if err != nil {
+		log.Printf("统计工单状态失败: %v", err)
+		return ""
+	}
+	return fmt.Sprintf("\n\n会话统计：\n- 待回复: %d\n- 等待用户: %d\n- 已解决: %d",
+		counts[cache.TicketStatusOpen], counts[cache.TicketStatusPending], counts[cache.TicketStatusClosed])
+}
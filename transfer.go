@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 转接按钮的回调数据
+const (
+	transferCallbackPrefix = "transfer_"        // 打开客服选择列表，后接用户 ID
+	transferPickPrefix     = "transfer_pick_"   // 选中接手的客服，后接“用户ID_客服ID”
+	transferDoPrefix       = "transfer_do_"     // 确认转接，后接“用户ID_客服ID_是否通知用户”
+	transferCancelPrefix   = "transfer_cancel_" // 取消转接，后接用户 ID
+)
+
+// adminNameByID 返回管理员的显示名称，优先使用用户名，与 adminDisplayName 一致
+func (b *BotInstance) adminNameByID(adminID int64) string {
+	firstName, lastName, username, _ := b.redisClient.GetUserInfo(context.Background(), adminID)
+	if username != "" {
+		return "@" + username
+	}
+	if name := strings.TrimSpace(firstName + " " + lastName); name != "" {
+		return name
+	}
+	return strconv.FormatInt(adminID, 10)
+}
+
+// parseTransferArgs 解析回调数据中以下划线分隔的整数参数
+func parseTransferArgs(data, prefix string, n int) ([]int64, bool) {
+	parts := strings.Split(strings.TrimPrefix(data, prefix), "_")
+	if len(parts) != n {
+		return nil, false
+	}
+	args := make([]int64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		args[i] = v
+	}
+	return args, true
+}
+
+// handleTransferCallback 处理转接相关的按钮，只有当前认领该用户的客服可以转接
+func (b *BotInstance) handleTransferCallback(q *tgbotapi.CallbackQuery) {
+	if q.Message == nil {
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	var args []int64
+	var ok bool
+	switch {
+	case strings.HasPrefix(q.Data, transferPickPrefix):
+		args, ok = parseTransferArgs(q.Data, transferPickPrefix, 2)
+	case strings.HasPrefix(q.Data, transferDoPrefix):
+		args, ok = parseTransferArgs(q.Data, transferDoPrefix, 3)
+	case strings.HasPrefix(q.Data, transferCancelPrefix):
+		args, ok = parseTransferArgs(q.Data, transferCancelPrefix, 1)
+	default:
+		args, ok = parseTransferArgs(q.Data, transferCallbackPrefix, 1)
+	}
+	if !ok {
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+		return
+	}
+	userID := args[0]
+
+	assignee, _, err := b.redisClient.GetAssignee(context.Background(), userID)
+	if err != nil {
+		log.Printf("获取用户 %d 的认领客服失败: %v", userID, err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 操作失败，请稍后再试"))
+		return
+	}
+	if assignee != q.From.ID {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "只有认领该用户的客服可以转接，请先认领"))
+		return
+	}
+
+	chatID := q.Message.Chat.ID
+	switch {
+	case strings.HasPrefix(q.Data, transferPickPrefix):
+		text := fmt.Sprintf("将%s转接给 %s，是否通知用户？", b.userLabel(userID), b.adminNameByID(args[1]))
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("转接并通知用户", fmt.Sprintf("%s%d_%d_1", transferDoPrefix, userID, args[1])),
+				tgbotapi.NewInlineKeyboardButtonData("仅转接", fmt.Sprintf("%s%d_%d_0", transferDoPrefix, userID, args[1])),
+			),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("取消", fmt.Sprintf("%s%d", transferCancelPrefix, userID))),
+		)
+		b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, q.Message.MessageID, text, keyboard))
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+	case strings.HasPrefix(q.Data, transferDoPrefix):
+		b.transferConversation(q, userID, args[1], args[2] == 1)
+	case strings.HasPrefix(q.Data, transferCancelPrefix):
+		b.API.Send(tgbotapi.NewEditMessageText(chatID, q.Message.MessageID, "已取消转接。"))
+		b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+	default:
+		b.sendTransferPicker(q, userID)
+	}
+}
+
+// sendTransferPicker 回复一条消息，列出可以接手该用户的其他管理员
+func (b *BotInstance) sendTransferPicker(q *tgbotapi.CallbackQuery, userID int64) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, adminID := range b.adminIDList() {
+		if adminID == q.From.ID {
+			continue
+		}
+		label := fmt.Sprintf("%s（%s）", b.adminNameByID(adminID), roleName(b.roleOf(adminID)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("%s%d_%d", transferPickPrefix, userID, adminID)),
+		))
+	}
+	if len(rows) == 0 {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "没有其他管理员可以接手"))
+		return
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("取消", fmt.Sprintf("%s%d", transferCancelPrefix, userID))))
+
+	picker := tgbotapi.NewMessage(q.Message.Chat.ID, fmt.Sprintf("🔀 请选择接手%s的客服：", b.userLabel(userID)))
+	picker.ReplyToMessageID = q.Message.MessageID
+	picker.AllowSendingWithoutReply = true
+	picker.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.API.Send(picker)
+	b.API.Request(tgbotapi.NewCallback(q.ID, ""))
+}
+
+// transferConversation 将用户从点击者转给 toID，并通知双方客服，notifyUser 时同时告知用户
+func (b *BotInstance) transferConversation(q *tgbotapi.CallbackQuery, userID, toID int64, notifyUser bool) {
+	if !b.isAdmin(toID) {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 该用户已不是管理员"))
+		return
+	}
+	toName := b.adminNameByID(toID)
+	transferred, err := b.redisClient.TransferUser(context.Background(), userID, q.From.ID, toID, toName)
+	if err != nil {
+		log.Printf("管理员 %d 将用户 %d 转接给 %d 失败: %v", q.From.ID, userID, toID, err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 转接失败，请稍后再试"))
+		return
+	}
+	if !transferred {
+		b.API.Request(tgbotapi.NewCallback(q.ID, "该用户已不由您认领，无法转接"))
+		return
+	}
+
+	fromName := adminDisplayName(q.From)
+	label := b.userLabel(userID)
+	b.audit(q.From.ID, cache.AuditAssign, fmt.Sprintf("将用户 %d 转接给管理员 %d", userID, toID))
+	log.Printf("管理员 %d 将用户 %d 转接给管理员 %d", q.From.ID, userID, toID)
+
+	text := fmt.Sprintf("🔀 %s 已将%s转接给 %s", fromName, label, toName)
+	if notifyUser {
+		text += "，已通知用户"
+	}
+	b.API.Send(tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID, text))
+	b.API.Request(tgbotapi.NewCallback(q.ID, "✅ 已转接"))
+
+	// 两位客服都在私聊中收到通知，转接发生在私聊中时点击者已看到上面的结果
+	if toID != q.Message.Chat.ID {
+		if _, err := b.API.Send(tgbotapi.NewMessage(toID, fmt.Sprintf("🔀 %s 将%s转接给了您，请跟进处理。使用 /myconversations 查看您认领的会话。", fromName, label))); err != nil {
+			log.Printf("通知管理员 %d 接手用户 %d 失败: %v", toID, userID, err)
+		}
+	}
+	if q.From.ID != q.Message.Chat.ID {
+		if _, err := b.API.Send(tgbotapi.NewMessage(q.From.ID, fmt.Sprintf("✅ 已将%s转接给 %s。", label, toName))); err != nil {
+			log.Printf("通知管理员 %d 转接结果失败: %v", q.From.ID, err)
+		}
+	}
+	if notifyUser {
+		if _, err := b.API.Send(tgbotapi.NewMessage(userID, "您的会话已转接给其他客服，请稍候，我们会尽快回复您。")); err != nil {
+			log.Printf("通知用户 %d 会话转接失败: %v", userID, err)
+		}
+	}
+}
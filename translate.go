@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultTranslateTarget = "zh"             // 客服使用的语言
+	translateTimeout       = 10 * time.Second // 单次翻译请求的超时时间
+	translateReplyTimeout  = 3 * time.Second  // 翻译客服回复的超时时间，回复在管理员的工作协程中同步翻译，超时后发送原文
+	translateMinRunes      = 2                // 少于该字数的消息不翻译
+	translateHanRatio      = 0.3              // 汉字占字母的比例达到该值时视为中文消息，不请求翻译
+)
+
+// 翻译服务
+const (
+	translateGoogle = "google"
+	translateDeepL  = "deepl"
+	translateLibre  = "libretranslate"
+)
+
+// translateConfig 是自动翻译的配置，未设置 TRANSLATE_PROVIDER 时为 nil
+type translateConfig struct {
+	Provider string
+	APIKey   string
+	APIURL   string // 翻译接口地址，DeepL 和 Google 可留空使用默认地址
+	Target   string // 客服使用的语言代码，用户消息译为该语言
+}
+
+// loadTranslateConfig 读取 TRANSLATE_PROVIDER、TRANSLATE_API_KEY、TRANSLATE_API_URL 和 TRANSLATE_TARGET，
+// 未设置 TRANSLATE_PROVIDER 时返回 nil
+func loadTranslateConfig() (*translateConfig, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("TRANSLATE_PROVIDER")))
+	if provider == "" {
+		return nil, nil
+	}
+	cfg := &translateConfig{
+		Provider: provider,
+		APIKey:   os.Getenv("TRANSLATE_API_KEY"),
+		APIURL:   strings.TrimSpace(os.Getenv("TRANSLATE_API_URL")),
+		Target:   strings.ToLower(strings.TrimSpace(os.Getenv("TRANSLATE_TARGET"))),
+	}
+	if cfg.Target == "" {
+		cfg.Target = defaultTranslateTarget
+	}
+	switch provider {
+	case translateGoogle:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("使用 Google 翻译时必须设置 TRANSLATE_API_KEY")
+		}
+		if cfg.APIURL == "" {
+			cfg.APIURL = "https://translation.googleapis.com/language/translate/v2"
+		}
+	case translateDeepL:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("使用 DeepL 时必须设置 TRANSLATE_API_KEY")
+		}
+		if cfg.APIURL == "" {
+			// 免费版的密钥以 :fx 结尾，使用单独的接口地址
+			cfg.APIURL = "https://api.deepl.com/v2/translate"
+			if strings.HasSuffix(cfg.APIKey, ":fx") {
+				cfg.APIURL = "https://api-free.deepl.com/v2/translate"
+			}
+		}
+	case translateLibre:
+		if cfg.APIURL == "" {
+			return nil, fmt.Errorf("使用 LibreTranslate 时必须设置 TRANSLATE_API_URL，例如 https://libretranslate.example.com/translate")
+		}
+	default:
+		return nil, fmt.Errorf("TRANSLATE_PROVIDER 无效（%s），可用值：%s、%s、%s", provider, translateGoogle, translateDeepL, translateLibre)
+	}
+	if u, err := url.Parse(cfg.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("TRANSLATE_API_URL 无效（%s）", cfg.APIURL)
+	}
+	return cfg, nil
+}
+
+// describe 返回配置的可读描述，用于日志和配置检查
+func (cfg *translateConfig) describe() string {
+	return fmt.Sprintf("%s，用户消息译为 %s", cfg.Provider, cfg.Target)
+}
+
+// translator 调用翻译服务
+type translator struct {
+	cfg    translateConfig
+	client *http.Client
+}
+
+func newTranslator(cfg translateConfig) *translator {
+	return &translator{cfg: cfg, client: &http.Client{Timeout: translateTimeout}}
+}
+
+// translate 将 text 译为 target 语言，返回译文和识别出的原文语言代码（小写）
+func (t *translator) translate(ctx context.Context, text, target string) (string, string, error) {
+	switch t.cfg.Provider {
+	case translateGoogle:
+		return t.google(ctx, text, target)
+	case translateDeepL:
+		return t.deepl(ctx, text, target)
+	default:
+		return t.libre(ctx, text, target)
+	}
+}
+
+func (t *translator) google(ctx context.Context, text, target string) (string, string, error) {
+	var resp struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText         string `json:"translatedText"`
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	body := map[string]string{"q": text, "target": target, "format": "text"}
+	if err := t.post(ctx, t.cfg.APIURL+"?key="+url.QueryEscape(t.cfg.APIKey), body, nil, &resp); err != nil {
+		return "", "", err
+	}
+	if len(resp.Data.Translations) == 0 {
+		return "", "", fmt.Errorf("翻译服务未返回结果")
+	}
+	result := resp.Data.Translations[0]
+	return result.TranslatedText, normalizeLanguage(result.DetectedSourceLanguage), nil
+}
+
+func (t *translator) deepl(ctx context.Context, text, target string) (string, string, error) {
+	var resp struct {
+		Translations []struct {
+			Text                   string `json:"text"`
+			DetectedSourceLanguage string `json:"detected_source_language"`
+		} `json:"translations"`
+	}
+	body := map[string]interface{}{"text": []string{text}, "target_lang": deeplLanguage(target)}
+	headers := map[string]string{"Authorization": "DeepL-Auth-Key " + t.cfg.APIKey}
+	if err := t.post(ctx, t.cfg.APIURL, body, headers, &resp); err != nil {
+		return "", "", err
+	}
+	if len(resp.Translations) == 0 {
+		return "", "", fmt.Errorf("翻译服务未返回结果")
+	}
+	result := resp.Translations[0]
+	return result.Text, normalizeLanguage(result.DetectedSourceLanguage), nil
+}
+
+func (t *translator) libre(ctx context.Context, text, target string) (string, string, error) {
+	var resp struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	body := map[string]string{"q": text, "source": "auto", "target": target, "format": "text"}
+	if t.cfg.APIKey != "" {
+		body["api_key"] = t.cfg.APIKey
+	}
+	if err := t.post(ctx, t.cfg.APIURL, body, nil, &resp); err != nil {
+		return "", "", err
+	}
+	return resp.TranslatedText, normalizeLanguage(resp.DetectedLanguage.Language), nil
+}
+
+// post 以 JSON 发送请求并解析 JSON 响应
+func (t *translator) post(ctx context.Context, endpoint string, body interface{}, headers map[string]string, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// 错误中可能包含带密钥的地址，只保留原因
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("请求翻译服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("翻译服务返回 HTTP %d: %s", resp.StatusCode, truncateRunes(string(data), 200))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// normalizeLanguage 将语言代码统一为小写的主语言部分，例如 EN-US -> en、zh-CN -> zh
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+// deeplLanguage 将语言代码转换为 DeepL 要求的目标语言代码
+func deeplLanguage(lang string) string {
+	switch normalizeLanguage(lang) {
+	case "en":
+		return "EN-US"
+	case "pt":
+		return "PT-BR"
+	}
+	return strings.ToUpper(normalizeLanguage(lang))
+}
+
+// looksLikeTarget 粗略判断文字是否已是客服使用的语言，避免对中文消息请求翻译。目前只识别中文
+func looksLikeTarget(text, target string) bool {
+	if normalizeLanguage(target) != "zh" {
+		return false
+	}
+	var letters, han int
+	for _, r := range text {
+		// 日文和韩文也可能包含汉字，出现假名或谚文时不是中文
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return false
+		}
+		if unicode.Is(unicode.Han, r) {
+			han++
+			letters++
+		} else if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters == 0 || float64(han)/float64(letters) >= translateHanRatio
+}
+
+// translateEnabled 检查与用户的会话是否需要自动翻译
+func (b *BotInstance) translateEnabled(userID int64) bool {
+	if b.translator == nil {
+		return false
+	}
+	enabled, err := b.redisClient.IsTranslateEnabled(context.Background(), userID)
+	if err != nil {
+		log.Printf("检查用户 %d 的自动翻译设置失败: %v", userID, err)
+		return false
+	}
+	return enabled
+}
+
+// translateInbound 在后台翻译用户消息，记录用户的语言，并将译文回复在转发到 chatID 的消息 messageID 下。
+// 中文消息和过短的消息不翻译
+func (b *BotInstance) translateInbound(msg *tgbotapi.Message, chatID int64, messageID int) {
+	text := strings.TrimSpace(messageText(msg))
+	if len([]rune(text)) < translateMinRunes || !b.translateEnabled(msg.From.ID) {
+		return
+	}
+	target := b.translator.cfg.Target
+	if looksLikeTarget(text, target) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), translateTimeout)
+		defer cancel()
+		translated, source, err := b.translator.translate(ctx, text, target)
+		if err != nil {
+			log.Printf("翻译用户 %d 的消息失败: %v", msg.From.ID, err)
+			return
+		}
+		if source == "" || source == normalizeLanguage(target) {
+			return
+		}
+		if err := b.redisClient.SetUserLanguage(context.Background(), msg.From.ID, source); err != nil {
+			log.Printf("记录用户 %d 的语言失败: %v", msg.From.ID, err)
+		}
+		note := tgbotapi.NewMessage(chatID, fmt.Sprintf("🌐 译文（%s → %s）：\n%s", source, target, translated))
+		note.ReplyToMessageID = messageID
+		note.AllowSendingWithoutReply = true
+		if _, err := b.API.Send(note); err != nil {
+			log.Printf("发送用户 %d 消息的译文失败: %v", msg.From.ID, err)
+		}
+	}()
+}
+
+// translateOutbound 将客服发给用户的文字译为用户的语言，返回要发送的文字和译成的语言；
+// 未开启翻译、不知道用户语言或翻译失败时原样返回，语言为空
+func (b *BotInstance) translateOutbound(userID int64, text string) (string, string) {
+	if strings.TrimSpace(text) == "" || !b.translateEnabled(userID) {
+		return text, ""
+	}
+	lang, err := b.redisClient.GetUserLanguage(context.Background(), userID)
+	if err != nil {
+		log.Printf("读取用户 %d 的语言失败: %v", userID, err)
+		return text, ""
+	}
+	if lang == "" || lang == normalizeLanguage(b.translator.cfg.Target) {
+		return text, ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), translateReplyTimeout)
+	defer cancel()
+	translated, _, err := b.translator.translate(ctx, text, lang)
+	if err != nil || strings.TrimSpace(translated) == "" {
+		log.Printf("将回复翻译为 %s 失败，发送原文给用户 %d: %v", lang, userID, err)
+		return text, ""
+	}
+	return translated, lang
+}
+
+// translatedNote 返回告知客服回复已被翻译的附注
+func translatedNote(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	return fmt.Sprintf("（已自动翻译为 %s）", lang)
+}
+
+const translateUsage = "用法：\n" +
+	"/translate —— 查看自动翻译状态\n" +
+	"/translate <用户ID|@用户名> on|off —— 开启或关闭与该用户会话的自动翻译"
+
+// handleTranslate 处理 /translate：查看状态，或为单个会话开启、关闭自动翻译
+func (b *BotInstance) handleTranslate(msg *tgbotapi.Message) {
+	if b.translator == nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "未启用自动翻译，请在配置中设置 TRANSLATE_PROVIDER。"))
+		return
+	}
+	ctx := context.Background()
+	args := strings.Fields(msg.CommandArguments())
+	switch len(args) {
+	case 0:
+		off, err := b.redisClient.CountTranslateOff(ctx)
+		if err != nil {
+			log.Printf("获取关闭自动翻译的会话数失败: %v", err)
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🌐 自动翻译：%s\n%d 个会话已关闭自动翻译。\n\n%s", b.translator.cfg.describe(), off, translateUsage)))
+		return
+	case 1:
+		userID, err := b.resolveUserArg(args[0])
+		if err != nil {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+			return
+		}
+		lang, _ := b.redisClient.GetUserLanguage(ctx, userID)
+		if lang == "" {
+			lang = "未知"
+		}
+		state := "已关闭"
+		if b.translateEnabled(userID) {
+			state = "已开启"
+		}
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 的自动翻译%s，用户语言：%s", b.userLabel(userID), state, lang)))
+		return
+	}
+	if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, translateUsage))
+		return
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	enabled := args[1] == "on"
+	if _, err := b.redisClient.SetTranslateEnabled(ctx, userID, enabled); err != nil {
+		log.Printf("修改用户 %d 的自动翻译设置失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 修改失败，请稍后再试。"))
+		return
+	}
+	state := "关闭"
+	if enabled {
+		state = "开启"
+	}
+	b.audit(msg.From.ID, cache.AuditSettings, fmt.Sprintf("%s与用户 %d 会话的自动翻译", state, userID))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已%s与%s会话的自动翻译。", state, b.userLabel(userID))))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// pollTimeout getUpdates 长轮询的等待秒数
+	pollTimeout = 60
+	// pollRetryDelay 获取更新失败后的重试间隔
+	pollRetryDelay = 3 * time.Second
+)
+
+// updateTracker 记录长轮询已分发和尚未处理完的更新。已分发的更新即向 Telegram 确认，
+// 之前的更新全部处理完的位置保存到 Redis，重启后跳过该位置及之前的更新
+type updateTracker struct {
+	mu         sync.Mutex
+	dispatched int          // 已分发的最大更新 ID
+	pending    map[int]bool // 已分发但尚未处理完的更新
+}
+
+// newUpdateTracker 从保存的位置 offset 开始跟踪
+func newUpdateTracker(offset int) *updateTracker {
+	return &updateTracker{dispatched: offset, pending: make(map[int]bool)}
+}
+
+// start 标记更新开始处理，已分发过时返回 false
+func (t *updateTracker) start(updateID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if updateID <= t.dispatched {
+		return false
+	}
+	t.dispatched = updateID
+	t.pending[updateID] = true
+	return true
+}
+
+// done 标记更新处理完毕
+func (t *updateTracker) done(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, updateID)
+}
+
+// inFlight 返回已分发但尚未处理完的更新数
+func (t *updateTracker) inFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// watermark 返回可以确认的最大更新 ID：该 ID 及之前的更新都已处理完
+func (t *updateTracker) watermark() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	mark := t.dispatched
+	for id := range t.pending {
+		if id-1 < mark {
+			mark = id - 1
+		}
+	}
+	return mark
+}
+
+// pollUpdates 以长轮询获取更新，从 Redis 中保存的位置继续。每次获取时确认已分发的更新，
+// 并保存已处理完的位置供重启后继续
+func (b *BotInstance) pollUpdates() tgbotapi.UpdatesChannel {
+	ctx := context.Background()
+	offset, err := b.redisClient.GetUpdateOffset(ctx)
+	if err != nil {
+		log.Printf("读取更新位置失败，从 Telegram 保留的最早更新开始: %v", err)
+	} else if offset > 0 {
+		log.Printf("从更新 %d 之后继续处理", offset)
+	}
+	b.updateOffsets = newUpdateTracker(offset)
+
+	updates := make(chan tgbotapi.Update, b.API.Buffer)
+	go func() {
+		saved, next := offset, offset+1
+		for {
+			if mark := b.updateOffsets.watermark(); mark != saved {
+				if err := b.redisClient.SetUpdateOffset(ctx, mark); err != nil {
+					log.Printf("保存更新位置 %d 失败: %v", mark, err)
+				} else {
+					saved = mark
+				}
+			}
+
+			u := tgbotapi.NewUpdate(next)
+			u.Timeout = pollTimeout
+			batch, err := b.API.GetUpdates(u)
+			if err != nil {
+				log.Printf("获取更新失败，%s 后重试: %v", pollRetryDelay, err)
+				time.Sleep(pollRetryDelay)
+				continue
+			}
+			for _, update := range batch {
+				updates <- update
+				next = update.UpdateID + 1
+			}
+		}
+	}()
+	return updates
+}
+
+// beginUpdate 在分发更新前调用，跳过已分发或重启前已处理过的更新
+func (b *BotInstance) beginUpdate(updateID int) bool {
+	return b.updateOffsets == nil || b.updateOffsets.start(updateID)
+}
+
+// finishUpdate 在更新处理完毕后调用，推进已处理完的位置
+func (b *BotInstance) finishUpdate(updateID int) {
+	if b.updateOffsets != nil {
+		b.updateOffsets.done(updateID)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// vipCaption 是 VIP 用户转发标题的首行
+const vipCaption = "⭐ VIP 客户"
+
+// isVIP 检查用户是否为 VIP，读取失败时按普通用户处理
+func (b *BotInstance) isVIP(userID int64) bool {
+	vip, err := b.redisClient.IsVIP(context.Background(), userID)
+	if err != nil {
+		log.Printf("检查用户 %d 是否为 VIP 失败: %v", userID, err)
+	}
+	return vip
+}
+
+// pinVIPMessage 将 VIP 用户的消息置顶在管理员会话中，直到客服回复或标记已解决；
+// 已有未回复的置顶时不重复置顶
+func (b *BotInstance) pinVIPMessage(userID, chatID int64, messageID int) {
+	ok, err := b.redisClient.SetVIPPin(context.Background(), userID, chatID, messageID)
+	if err != nil {
+		log.Printf("记录 VIP 用户 %d 的置顶消息失败: %v", userID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	// 置顶时发送通知，确保客服及时看到
+	if _, err := b.API.Request(tgbotapi.PinChatMessageConfig{ChatID: chatID, MessageID: messageID}); err != nil {
+		log.Printf("置顶 VIP 用户 %d 的消息失败: %v", userID, err)
+		b.redisClient.TakeVIPPin(context.Background(), userID)
+	}
+}
+
+// unpinVIPMessage 取消为 VIP 用户置顶的消息
+func (b *BotInstance) unpinVIPMessage(userID int64) {
+	chatID, messageID, ok, err := b.redisClient.TakeVIPPin(context.Background(), userID)
+	if err != nil {
+		log.Printf("读取 VIP 用户 %d 的置顶消息失败: %v", userID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if _, err := b.API.Request(tgbotapi.UnpinChatMessageConfig{ChatID: chatID, MessageID: messageID}); err != nil {
+		log.Printf("取消置顶 VIP 用户 %d 的消息失败: %v", userID, err)
+	}
+}
+
+// handleVIP 处理 /vip 命令：不带参数时列出 VIP 用户，带用户时将其标记为 VIP
+func (b *BotInstance) handleVIP(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		ids, err := b.redisClient.GetVIPs(ctx)
+		if err != nil {
+			log.Printf("获取 VIP 用户失败: %v", err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 获取 VIP 用户失败。"))
+			return
+		}
+		if len(ids) == 0 {
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "还没有 VIP 用户。\n\n用法：\n/vip <用户ID|@用户名> —— 标记为 VIP\n/unvip <用户ID|@用户名> —— 取消 VIP"))
+			return
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("VIP 用户共 %d 位：\n", len(ids)))
+		for _, id := range ids {
+			sb.WriteString(b.userLabel(id) + "\n")
+		}
+		sb.WriteString("\nVIP 用户的消息标题带有「" + vipCaption + "」，不参与汇总，并置顶直到有客服回复。")
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, sb.String()))
+		return
+	}
+
+	userID, err := b.resolveUserArg(arg)
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	added, err := b.redisClient.AddVIP(ctx, userID)
+	if err != nil {
+		log.Printf("标记用户 %d 为 VIP 失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 操作失败，请稍后重试。"))
+		return
+	}
+	if !added {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 已经是 VIP。", b.userLabel(userID))))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditTag, fmt.Sprintf("将用户 %d 标记为 VIP", userID))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已将%s标记为 VIP。", b.userLabel(userID))))
+}
+
+// handleUnVIP 处理 /unvip 命令，取消用户的 VIP 标记
+func (b *BotInstance) handleUnVIP(msg *tgbotapi.Message) {
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/unvip <用户ID|@用户名>"))
+		return
+	}
+	userID, err := b.resolveUserArg(arg)
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	removed, err := b.redisClient.RemoveVIP(context.Background(), userID)
+	if err != nil {
+		log.Printf("取消用户 %d 的 VIP 失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 操作失败，请稍后重试。"))
+		return
+	}
+	if !removed {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s 不是 VIP。", b.userLabel(userID))))
+		return
+	}
+	b.unpinVIPMessage(userID)
+	b.audit(msg.From.ID, cache.AuditTag, fmt.Sprintf("取消用户 %d 的 VIP", userID))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已取消%s的 VIP。", b.userLabel(userID))))
+}
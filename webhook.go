@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultListenAddr = ":8443"
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// webhookConfig 是 Webhook 模式的配置，未设置 WEBHOOK_URL 时为 nil，使用长轮询
+type webhookConfig struct {
+	URL         *url.URL
+	ListenAddr  string // 内置 HTTP 服务器监听地址
+	SecretToken string // Telegram 在每个请求头中携带的密钥，用于验证请求来源
+	CertFile    string // 同时设置证书和私钥时直接以 HTTPS 提供服务，否则使用 HTTP（通常位于反向代理之后）
+	KeyFile     string
+}
+
+// loadWebhookConfig 从环境变量读取 Webhook 配置，未设置 WEBHOOK_URL 时返回 nil
+func loadWebhookConfig() (*webhookConfig, error) {
+	rawURL := os.Getenv("WEBHOOK_URL")
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("WEBHOOK_URL 必须是有效的 https 地址: %s", rawURL)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	cfg := &webhookConfig{
+		URL:         u,
+		ListenAddr:  os.Getenv("LISTEN_ADDR"),
+		SecretToken: os.Getenv("WEBHOOK_SECRET"),
+		CertFile:    os.Getenv("TLS_CERT_FILE"),
+		KeyFile:     os.Getenv("TLS_KEY_FILE"),
+	}
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = defaultListenAddr
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE 和 TLS_KEY_FILE 必须同时设置")
+	}
+	return cfg, nil
+}
+
+// startWebhook 向 Telegram 注册 Webhook 并启动内置 HTTP 服务器，返回接收更新的通道
+func (b *BotInstance) startWebhook() (tgbotapi.UpdatesChannel, error) {
+	cfg := b.webhook
+	params := tgbotapi.Params{}
+	params.AddNonEmpty("url", cfg.URL.String())
+	params.AddNonEmpty("secret_token", cfg.SecretToken)
+	if _, err := b.API.MakeRequest("setWebhook", params); err != nil {
+		return nil, fmt.Errorf("设置 Webhook 失败: %w", err)
+	}
+
+	updates := make(chan tgbotapi.Update, b.API.Buffer)
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.URL.Path, func(w http.ResponseWriter, r *http.Request) {
+		if cfg.SecretToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(cfg.SecretToken)) != 1 {
+			log.Printf("拒绝来自 %s 的 Webhook 请求：密钥不匹配", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		update, err := b.API.HandleUpdate(r)
+		if err != nil {
+			log.Printf("解析 Webhook 更新失败: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates <- *update
+	})
+
+	go func() {
+		var err error
+		if cfg.CertFile != "" {
+			log.Printf("Webhook HTTPS 服务器监听 %s", cfg.ListenAddr)
+			err = http.ListenAndServeTLS(cfg.ListenAddr, cfg.CertFile, cfg.KeyFile, mux)
+		} else {
+			log.Printf("Webhook HTTP 服务器监听 %s", cfg.ListenAddr)
+			err = http.ListenAndServe(cfg.ListenAddr, mux)
+		}
+		log.Fatalf("Webhook 服务器已停止: %v", err)
+	}()
+
+	log.Printf("已启用 Webhook 模式: %s", cfg.URL.String())
+	return updates, nil
+}
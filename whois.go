@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-tg-bot/internal/cache"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	whoisNotesShown    = 10 // /whois 显示的最近备注条数
+	whoisMessagesShown = 5  // /whois 显示的工单最近消息条数
+)
+
+// handleWhois 处理 /whois 命令，显示用户资料卡
+func (b *BotInstance) handleWhois(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 1 {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/whois <用户ID|@用户名>"))
+		return
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+	text, keyboard := b.whoisCard(userID)
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyMarkup = keyboard
+	b.API.Send(reply)
+}
+
+// handleNote 处理 /note 命令，为用户添加一条备注，/whois 中可以看到
+func (b *BotInstance) handleNote(msg *tgbotapi.Message) {
+	args := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 2)
+	if len(args) != 2 || strings.TrimSpace(args[1]) == "" {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/note <用户ID|@用户名> <备注内容>\n使用 /note <用户ID|@用户名> clear 清空备注。"))
+		return
+	}
+	userID, err := b.resolveUserArg(args[0])
+	if err != nil {
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+
+	ctx := context.Background()
+	text := strings.TrimSpace(args[1])
+	if text == "clear" {
+		if err := b.redisClient.ClearUserNotes(ctx, userID); err != nil {
+			log.Printf("清空用户 %d 的备注失败: %v", userID, err)
+			b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 清空备注失败，请稍后重试。"))
+			return
+		}
+		b.audit(msg.From.ID, cache.AuditNote, fmt.Sprintf("清空用户 %d 的备注", userID))
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已清空%s的备注", b.userLabel(userID))))
+		return
+	}
+
+	note := fmt.Sprintf("%s 管理员 %d：%s", time.Now().Format("01-02 15:04"), msg.From.ID, text)
+	if err := b.redisClient.AddUserNote(ctx, userID, note); err != nil {
+		log.Printf("添加用户 %d 的备注失败: %v", userID, err)
+		b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 添加备注失败，请稍后重试。"))
+		return
+	}
+	b.audit(msg.From.ID, cache.AuditNote, fmt.Sprintf("用户 %d：%s", userID, text))
+	b.API.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已为%s添加备注", b.userLabel(userID))))
+}
+
+// whoisCard 生成用户资料卡的文本和操作按钮
+func (b *BotInstance) whoisCard(userID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	ctx := context.Background()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("用户资料 - ID: %d\n", userID))
+
+	profile, known, err := b.redisClient.GetUserProfile(ctx, userID)
+	if err != nil {
+		log.Printf("获取用户 %d 资料失败: %v", userID, err)
+	}
+	if known {
+		name := strings.TrimSpace(profile.FirstName + " " + profile.LastName)
+		if name == "" {
+			name = "Unknown"
+		}
+		sb.WriteString("昵称：" + name + "\n")
+		if profile.Username != "" {
+			sb.WriteString("用户名：@" + profile.Username + "\n")
+		}
+		sb.WriteString("首次联系：" + formatProfileTime(profile.FirstSeen) + "\n")
+		sb.WriteString("最后活跃：" + formatProfileTime(profile.LastActive) + "\n")
+		if profile.Source != "" {
+			source := profile.Source
+			if profile.LastSource != "" && profile.LastSource != profile.Source {
+				source += "（最近：" + profile.LastSource + "）"
+			}
+			sb.WriteString("来源：" + source + "\n")
+		}
+	} else {
+		sb.WriteString("（没有该用户的资料，可能从未联系过机器人）\n")
+	}
+
+	blocked, _ := b.redisClient.IsUserBlocked(ctx, userID)
+	optedOut, _ := b.redisClient.IsBroadcastOptedOut(ctx, userID)
+	unreachable, _ := b.redisClient.IsUnreachableUser(ctx, userID)
+	vip, _ := b.redisClient.IsVIP(ctx, userID)
+	sb.WriteString(fmt.Sprintf("\nVIP：%s\n拉黑：%s\n退订广播：%s\n屏蔽机器人：%s\n", yesNo(vip), yesNo(blocked), yesNo(optedOut), yesNo(unreachable)))
+	if tags, err := b.redisClient.GetUserTags(ctx, userID); err != nil {
+		log.Printf("获取用户 %d 的标签失败: %v", userID, err)
+	} else {
+		sb.WriteString("标签：" + formatTags(tags) + "\n")
+	}
+	if topic, _ := b.redisClient.GetUserTopic(ctx, userID); topic != "" {
+		sb.WriteString("主题：" + topic + "\n")
+	}
+
+	ticketID, err := b.redisClient.GetUserTicketID(ctx, userID)
+	if err != nil {
+		log.Printf("获取用户 %d 的工单失败: %v", userID, err)
+	}
+	if ticket, ok, _ := b.ticketByID(ticketID); ok {
+		sb.WriteString(fmt.Sprintf("\n工单 #%s（%s，创建于 %s）\n", ticket.ID, ticketStatusName(ticket.Status), ticket.CreatedAt.Format("2006-01-02 15:04")))
+		entries, _ := b.redisClient.GetTicketMessages(ctx, ticket.ID, whoisMessagesShown)
+		for _, entry := range entries {
+			sb.WriteString(entry + "\n")
+		}
+	}
+
+	notes, err := b.redisClient.GetUserNotes(ctx, userID, whoisNotesShown)
+	if err != nil {
+		log.Printf("获取用户 %d 的备注失败: %v", userID, err)
+	}
+	if len(notes) > 0 {
+		sb.WriteString("\n备注：\n")
+		for _, note := range notes {
+			sb.WriteString(note + "\n")
+		}
+	}
+
+	actionButton := tgbotapi.NewInlineKeyboardButtonData("🚫 拉黑", fmt.Sprintf("whois_block_%d", userID))
+	if blocked {
+		actionButton = tgbotapi.NewInlineKeyboardButtonData("✅ 解除拉黑", fmt.Sprintf("whois_unblock_%d", userID))
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("与用户对话", fmt.Sprintf("tg://user?id=%d", userID)),
+			actionButton,
+		),
+	}
+	if b.topicsManager.Enabled() {
+		if link, err := b.topicsManager.TopicLink(userID); err != nil {
+			log.Printf("获取用户 %d 的话题链接失败: %v", userID, err)
+		} else if link != "" {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("打开话题", link)))
+		}
+	}
+	return sb.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleWhoisCallback 处理资料卡上的拉黑/解除拉黑按钮，并刷新资料卡
+func (b *BotInstance) handleWhoisCallback(q *tgbotapi.CallbackQuery) {
+	block := strings.HasPrefix(q.Data, "whois_block_")
+	userID, err := strconv.ParseInt(q.Data[strings.LastIndex(q.Data, "_")+1:], 10, 64)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	answer := "✅ 用户已解除拉黑"
+	if block {
+		if b.isAdmin(userID) {
+			b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 不能拉黑管理员"))
+			return
+		}
+		err = b.redisClient.AddBlockedUser(ctx, userID)
+		answer = "✅ 用户已拉黑"
+	} else {
+		err = b.redisClient.RemoveBlockedUser(ctx, userID)
+	}
+	if err != nil {
+		log.Printf("更新用户 %d 的拉黑状态失败: %v", userID, err)
+		b.API.Request(tgbotapi.NewCallback(q.ID, "❌ 操作失败"))
+		return
+	}
+	if block {
+		b.audit(q.From.ID, cache.AuditBlock, fmt.Sprintf("用户 %d（资料卡）", userID))
+		b.emitBlocked(userID, q.From.ID, "profile")
+	} else {
+		b.audit(q.From.ID, cache.AuditUnblock, fmt.Sprintf("用户 %d（资料卡）", userID))
+	}
+	b.API.Request(tgbotapi.NewCallback(q.ID, answer))
+
+	text, keyboard := b.whoisCard(userID)
+	b.API.Send(tgbotapi.NewEditMessageTextAndMarkup(q.Message.Chat.ID, q.Message.MessageID, text, keyboard))
+}
+
+// ticketByID 获取工单，工单号为空时直接返回不存在
+func (b *BotInstance) ticketByID(id string) (cache.Ticket, bool, error) {
+	if id == "" {
+		return cache.Ticket{}, false, nil
+	}
+	return b.redisClient.GetTicket(context.Background(), id)
+}
+
+// formatProfileTime 格式化资料中的时间，未记录时显示“未知”
+func formatProfileTime(t time.Time) string {
+	if t.IsZero() {
+		return "未知"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "是"
+	}
+	return "否"
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultUpdateWorkers = 8
+	// updateQueueSize 每个工作协程的待处理更新数，队列满时接收更新会等待，形成背压
+	updateQueueSize = 100
+)
+
+// loadUpdateWorkers 从 UPDATE_WORKERS 读取并发处理更新的协程数，1 表示按顺序处理
+func loadUpdateWorkers() int {
+	workersStr := os.Getenv("UPDATE_WORKERS")
+	if workersStr == "" {
+		return defaultUpdateWorkers
+	}
+	n, err := strconv.Atoi(workersStr)
+	if err != nil || n < 1 {
+		log.Printf("警告：UPDATE_WORKERS 无效（%s），使用默认值 %d", workersStr, defaultUpdateWorkers)
+		return defaultUpdateWorkers
+	}
+	return n
+}
+
+// poolJob 是工作协程处理的一项工作：一条更新，或 task 不为 nil 时的一个后台任务
+type poolJob struct {
+	update tgbotapi.Update
+	task   func()
+}
+
+// updatePool 并发处理更新。键相同的更新总是交给同一个工作协程，按到达顺序处理
+type updatePool struct {
+	queues []chan poolJob
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newUpdatePool 启动 size 个工作协程，每个协程依次调用 handle 处理分配给它的更新
+func newUpdatePool(size int, handle func(tgbotapi.Update)) *updatePool {
+	p := &updatePool{queues: make([]chan poolJob, size)}
+	for i := range p.queues {
+		queue := make(chan poolJob, updateQueueSize)
+		p.queues[i] = queue
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range queue {
+				if job.task != nil {
+					job.task()
+				} else {
+					handle(job.update)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// dispatch 将更新交给键 key 对应的工作协程
+func (p *updatePool) dispatch(key int64, update tgbotapi.Update) {
+	p.queues[uint64(key)%uint64(len(p.queues))] <- poolJob{update: update}
+}
+
+// run 将后台任务交给键 key 对应的工作协程，与该键的更新按顺序执行；工作池已关闭时返回 false
+func (p *updatePool) run(key int64, task func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	p.queues[uint64(key)%uint64(len(p.queues))] <- poolJob{task: task}
+	return true
+}
+
+// queued 返回各工作协程队列中等待处理的更新总数及队列总容量
+func (p *updatePool) queued() (int, int) {
+	n := 0
+	for _, queue := range p.queues {
+		n += len(queue)
+	}
+	return n, len(p.queues) * updateQueueSize
+}
+
+// close 停止接收更新，并等待已分配的更新处理完毕
+func (p *updatePool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// runForUser 在用户的工作协程中执行 task，与该用户的更新按顺序处理；工作池未启动或已关闭时直接执行。
+// 工作协程中调用时应在新的 goroutine 中调用，避免等待自己的队列
+func (b *BotInstance) runForUser(userID int64, task func()) {
+	if b.updatePool == nil || !b.updatePool.run(userID, task) {
+		task()
+	}
+}
+
+// updateKey 返回决定更新由哪个工作协程处理的键。用户的更新按会话分配，保证同一会话内按顺序处理；
+// 管理员的更新全部交给同一个协程，因为各功能的编辑状态（adminStates 等）保存在不加锁的共享 map 中。
+func (b *BotInstance) updateKey(update tgbotapi.Update) int64 {
+	var from *tgbotapi.User
+	var chatID int64
+	switch {
+	case update.Message != nil:
+		from, chatID = update.Message.From, update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		from, chatID = update.EditedMessage.From, update.EditedMessage.Chat.ID
+	case update.CallbackQuery != nil:
+		from = update.CallbackQuery.From
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.ID
+		}
+	case update.InlineQuery != nil:
+		from = update.InlineQuery.From
+	case update.PreCheckoutQuery != nil:
+		from = update.PreCheckoutQuery.From
+	}
+	if from == nil || b.isAdmin(from.ID) {
+		return 0
+	}
+	if chatID == 0 {
+		chatID = from.ID
+	}
+	return chatID
+}